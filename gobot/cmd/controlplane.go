@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/instructlab/instructlab-bot/pkg/controlplane"
+	"github.com/instructlab/instructlab-bot/pkg/jobqueue"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// newControlPlane returns the gRPC server the workers started with --control-plane-addr register
+// on, with mutual TLS unless --control-plane-tls-cert is blank
+func newControlPlane(logger *zap.SugaredLogger) (*grpc.Server, error) {
+	var opts []grpc.ServerOption
+	if ControlPlaneTLSCert != "" {
+		tlsConfig, err := controlplane.ServerTLSConfig(ControlPlaneTLSCert, ControlPlaneTLSKey, ControlPlaneTLSCA)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	} else {
+		logger.Warn("Serving the control plane without TLS, set --control-plane-tls-cert outside of local development")
+	}
+	queue := jobqueue.NewClient(RedisHost)
+	return controlplane.NewGRPCServer(controlplane.NewQueueServer(queue), opts...), nil
+}
+
+// serveControlPlane serves the control plane on --control-plane-port until ctx is done, the
+// streams of the workers are closed then
+func serveControlPlane(ctx context.Context, logger *zap.SugaredLogger, server *grpc.Server) error {
+	addr := net.JoinHostPort("", strconv.Itoa(ControlPlanePort))
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("could not listen for the control plane on %s: %w", addr, err)
+	}
+	go func() {
+		<-ctx.Done()
+		logger.Info("Shutting down the control plane")
+		server.Stop()
+	}()
+	logger.Infof("Starting the control plane on %s...", addr)
+	return server.Serve(lis)
+}
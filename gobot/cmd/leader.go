@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/instructlab/instructlab-bot/pkg/jobqueue"
+	"go.uber.org/zap"
+)
+
+// leaderRole is the lease the bot replicas compete for to run the scheduler and the janitor
+const leaderRole = "gobot"
+
+// replicaID identifies the bot replica holding the lease
+func replicaID() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "gobot"
+	}
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
+}
+
+// runAsLeader runs lead while the replica holds the lease of --leader-lease, renewed every third
+// of it, until ctx is done. lead is canceled when the lease is lost, so that the replica taking
+// it over does not run alongside, and the lease is released on shutdown.
+func runAsLeader(ctx context.Context, logger *zap.SugaredLogger, lease *jobqueue.Lease, lead func(context.Context)) {
+	var (
+		wg           sync.WaitGroup
+		stopLeading  context.CancelFunc
+		lastRenewal  time.Time
+		renewalEvery = LeaderLease / 3
+	)
+	stepDown := func() {
+		if stopLeading == nil {
+			return
+		}
+		stopLeading()
+		wg.Wait()
+		stopLeading = nil
+	}
+
+	ticker := time.NewTicker(renewalEvery)
+	defer ticker.Stop()
+	for {
+		held, err := lease.Acquire(ctx)
+		switch {
+		case ctx.Err() != nil:
+		case err != nil:
+			logger.Errorf("Failed to renew the leader lease: %v", err)
+			// Step down before the lease expires and another replica takes it over
+			if stopLeading != nil && time.Since(lastRenewal) >= LeaderLease-renewalEvery {
+				logger.Warn("Leader lease about to expire, stopping the scheduler and the janitor")
+				stepDown()
+			}
+		case held:
+			lastRenewal = time.Now()
+			if stopLeading == nil {
+				logger.Infof("Elected leader as %s, starting the scheduler and the janitor", replicaID())
+				var leaderCtx context.Context
+				leaderCtx, stopLeading = context.WithCancel(ctx)
+				wg.Add(1)
+				go func() {
+					lead(leaderCtx)
+					wg.Done()
+				}()
+			}
+		case stopLeading != nil:
+			logger.Warn("Lost the leader lease, stopping the scheduler and the janitor")
+			stepDown()
+		}
+
+		select {
+		case <-ctx.Done():
+			leading := stopLeading != nil
+			stepDown()
+			if leading {
+				releaseCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+				if err := lease.Release(releaseCtx); err != nil {
+					logger.Errorf("Failed to release the leader lease: %v", err)
+				}
+				cancel()
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-github/v61/github"
+	"github.com/instructlab/instructlab-bot/gobot/common"
+	"github.com/instructlab/instructlab-bot/gobot/util"
+	"github.com/instructlab/instructlab-bot/pkg/jobqueue"
+	"go.uber.org/zap"
+)
+
+// concludePipeline posts the summary of the e2e pipeline of a job once the job was its last
+// stage or failed. The stages after a failed one were never queued and are marked skipped.
+func concludePipeline(ctx context.Context, r *jobqueue.Client, logger *zap.SugaredLogger, client *github.Client, job string, failed bool, params util.PullRequestStatusParams) {
+	pipelineID, _ := r.Get(ctx, job, jobqueue.FieldPipelineID)
+	if pipelineID == "" {
+		return
+	}
+	nextJob, _ := r.Get(ctx, job, jobqueue.FieldNextJob)
+	if nextJob != "" && !failed {
+		return
+	}
+
+	jobIDs, err := r.Get(ctx, pipelineID, jobqueue.FieldPipelineJobs)
+	if err != nil || jobIDs == "" {
+		logger.Errorf("No jobs found for pipeline %s", pipelineID)
+		return
+	}
+
+	var stages []util.PipelineStage
+	for _, id := range strings.Split(jobIDs, ",") {
+		stage := util.PipelineStage{JobID: id}
+		stage.JobType, _ = r.Get(ctx, id, jobqueue.FieldJobType)
+		stage.Status, _ = r.Get(ctx, id, jobqueue.FieldStatus)
+		if failed && stage.Status == common.CheckStatusPending {
+			stage.Status = common.CheckStatusSkipped
+			if err := r.Set(ctx, id, jobqueue.FieldStatus, stage.Status); err != nil {
+				logger.Errorf("Failed to mark job %s of pipeline %s as skipped: %v", id, pipelineID, err)
+			}
+		}
+		stage.Duration, _ = r.Get(ctx, id, jobqueue.FieldDuration)
+		stage.S3URL, _ = r.Get(ctx, id, jobqueue.FieldS3URL)
+		stages = append(stages, stage)
+	}
+
+	summary := util.PipelineSummary(stages)
+	params.Status = common.CheckComplete
+	params.CheckName = common.E2ECheck
+	params.JobType = "e2e"
+	params.JobID = pipelineID
+	params.Annotations = nil
+	params.CheckDetails = summary
+	if failed {
+		params.Conclusion = common.CheckStatusFailure
+		params.CheckSummary = JobFailed
+		params.Comment = util.Message(util.MessagePipelineResult, util.MessageData{PipelineID: pipelineID, JobID: job, Summary: summary, Failed: true})
+	} else {
+		params.Conclusion = common.CheckStatusSuccess
+		params.CheckSummary = fmt.Sprintf("Pipeline ID: %s completed successfully. Check Details.", pipelineID)
+		params.Comment = util.Message(util.MessagePipelineResult, util.MessageData{PipelineID: pipelineID, Summary: summary})
+	}
+
+	if err := util.PostPullRequestCheck(ctx, client, params); err != nil {
+		logger.Errorf("Failed to post pipeline check on pr %s/%s#%d: %v", params.RepoOwner, params.RepoName, params.PrNum, err)
+	}
+	if err := util.PostPullRequestComment(ctx, client, params); err != nil {
+		logger.Errorf("Failed to post pipeline comment on pr %s/%s#%d: %v", params.RepoOwner, params.RepoName, params.PrNum, err)
+	}
+}
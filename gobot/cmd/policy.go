@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/go-github/v61/github"
+	"github.com/instructlab/instructlab-bot/gobot/common"
+	"github.com/instructlab/instructlab-bot/gobot/util"
+	"github.com/instructlab/instructlab-bot/pkg/jobqueue"
+	"go.uber.org/zap"
+)
+
+// policyResultsTTL keeps the job results of a PR head for its merge policy
+const policyResultsTTL = 30 * 24 * time.Hour
+
+// policyKey is the hash of the latest job result of every job type on a PR head
+func policyKey(repoOwner, repoName, prSha string) string {
+	return fmt.Sprintf("%s:%s/%s:%s", common.RedisKeyPolicy, repoOwner, repoName, prSha)
+}
+
+// evaluatePolicy records the outcome of a job of a PR and sets the merge policy check of the PR
+// head from the latest job of every job type, when the repository has a policy
+func evaluatePolicy(ctx context.Context, r *jobqueue.Client, logger *zap.SugaredLogger, client *github.Client, repoConfigs util.RepoConfigs, job, jobType string, failed bool, params util.PullRequestStatusParams) {
+	repoCfg, ok := repoConfigs.Lookup(params.RepoOwner, params.RepoName, common.RepoName, util.RepoConfig{})
+	if !ok || len(repoCfg.Policy.Rules) == 0 {
+		return
+	}
+	policy := repoCfg.Policy
+
+	result := util.PolicyJobResult{JobID: job, Failed: failed}
+	if !failed {
+		metricsJSON, _ := r.Get(ctx, job, jobqueue.FieldMetrics)
+		if metricsJSON != "" {
+			if err := json.Unmarshal([]byte(metricsJSON), &result.Metrics); err != nil {
+				logger.Errorf("Failed to parse metrics for job %s: %v", job, err)
+			}
+		}
+	}
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		logger.Errorf("Failed to marshal the policy result of job %s: %v", job, err)
+		return
+	}
+
+	key := policyKey(params.RepoOwner, params.RepoName, params.PrSha)
+	if err := r.HSet(ctx, key, jobType, resultJSON).Err(); err != nil {
+		logger.Errorf("Failed to record the policy result of job %s: %v", job, err)
+		return
+	}
+	if err := r.Expire(ctx, key, policyResultsTTL).Err(); err != nil {
+		logger.Warnf("Failed to set the expiry of %s: %v", key, err)
+	}
+	stored, err := r.HGetAll(ctx, key).Result()
+	if err != nil {
+		logger.Errorf("Failed to read the policy results of %s: %v", key, err)
+		return
+	}
+	results := make(map[string]util.PolicyJobResult)
+	for storedType, storedJSON := range stored {
+		var storedResult util.PolicyJobResult
+		if err := json.Unmarshal([]byte(storedJSON), &storedResult); err != nil {
+			logger.Errorf("Failed to parse the policy result of the %s job in %s: %v", storedType, key, err)
+			continue
+		}
+		results[storedType] = storedResult
+	}
+
+	conclusion, rules := policy.Evaluate(results)
+	params.CheckName = policy.CheckName()
+	params.JobType = "policy"
+	params.JobID = job
+	params.Annotations = nil
+	params.CheckDetails = util.PolicySummary(rules)
+	switch conclusion {
+	case common.CheckStatusPending:
+		params.Status = common.CheckInProgress
+		params.Conclusion = ""
+		params.CheckSummary = "Waiting for the jobs the merge policy requires."
+	case common.CheckStatusSuccess:
+		params.Status = common.CheckComplete
+		params.Conclusion = common.CheckStatusSuccess
+		params.CheckSummary = "Every rule of the merge policy passed."
+	default:
+		params.Status = common.CheckComplete
+		params.Conclusion = common.CheckStatusFailure
+		params.CheckSummary = "A rule of the merge policy failed. Check Details."
+	}
+	logger.Infof("Merge policy of %s/%s#%d at %s: %s", params.RepoOwner, params.RepoName, params.PrNum, params.PrSha, conclusion)
+
+	if err := util.PostPullRequestCheck(ctx, client, params); err != nil {
+		logger.Errorf("Failed to post policy check on pr %s/%s#%d: %v", params.RepoOwner, params.RepoName, params.PrNum, err)
+	}
+	if policy.Label == "" {
+		return
+	}
+	if conclusion == common.CheckStatusSuccess {
+		err = util.AddPullRequestLabel(ctx, client, params, policy.Label)
+	} else {
+		err = util.RemovePullRequestLabel(ctx, client, params, policy.Label)
+	}
+	if err != nil {
+		logger.Errorf("Failed to update the %s label on pr %s/%s#%d: %v", policy.Label, params.RepoOwner, params.RepoName, params.PrNum, err)
+	}
+}
@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/instructlab/instructlab-bot/gobot/util"
+	"github.com/instructlab/instructlab-bot/pkg/jobqueue"
+	"go.uber.org/zap"
+)
+
+// resultCommentsTTL keeps the results comments of a PR long after it is likely to get new commits
+const resultCommentsTTL = 90 * 24 * time.Hour
+
+// postedResultComment is a results comment of the bot on a PR, with the job it reports for every
+// job type
+type postedResultComment struct {
+	PrSha string            `json:"pr_sha"`
+	Jobs  map[string]string `json:"jobs"`
+}
+
+// recordResultComment records a results comment posted on a PR so that newer results can minimize it
+func recordResultComment(ctx context.Context, r *jobqueue.Client, params util.PullRequestStatusParams, nodeID string, jobs map[string]string) error {
+	if nodeID == "" {
+		return nil
+	}
+	commentJSON, err := json.Marshal(postedResultComment{PrSha: params.PrSha, Jobs: jobs})
+	if err != nil {
+		return err
+	}
+	key := jobqueue.ResultCommentsKey(params.RepoOwner, params.RepoName, strconv.Itoa(params.PrNum))
+	if err := r.HSet(ctx, key, nodeID, commentJSON).Err(); err != nil {
+		return err
+	}
+	return r.Expire(ctx, key, resultCommentsTTL).Err()
+}
+
+// minimizeSupersededComments minimizes the results comments of the PR whose every job has a newer
+// job of the same type among the results, run on another commit. A re-run on the same commit
+// leaves the earlier comments alone.
+func minimizeSupersededComments(ctx context.Context, r *jobqueue.Client, logger *zap.SugaredLogger, comments []resultComment) {
+	latest := make(map[string]util.PullRequestStatusParams)
+	for _, comment := range comments {
+		if prev, ok := latest[comment.params.JobType]; !ok || jobNumber(comment.params.JobID) > jobNumber(prev.JobID) {
+			latest[comment.params.JobType] = comment.params
+		}
+	}
+	params := comments[0].params
+	key := jobqueue.ResultCommentsKey(params.RepoOwner, params.RepoName, strconv.Itoa(params.PrNum))
+	posted, err := r.HGetAll(ctx, key).Result()
+	if err != nil {
+		logger.Errorf("Failed to read the results comments of pr %s/%s#%d: %v", params.RepoOwner, params.RepoName, params.PrNum, err)
+		return
+	}
+	for nodeID, commentJSON := range posted {
+		var comment postedResultComment
+		if err := json.Unmarshal([]byte(commentJSON), &comment); err != nil {
+			logger.Errorf("Failed to parse results comment %s of pr %s/%s#%d: %v", nodeID, params.RepoOwner, params.RepoName, params.PrNum, err)
+			continue
+		}
+		if !supersededComment(comment, latest) {
+			continue
+		}
+		if err := util.MinimizeComment(ctx, comments[0].client, nodeID); err != nil {
+			logger.Errorf("Failed to minimize results comment %s of pr %s/%s#%d: %v", nodeID, params.RepoOwner, params.RepoName, params.PrNum, err)
+			continue
+		}
+		logger.Infof("Minimized results comment %s of pr %s/%s#%d, superseded by the results of commit %s", nodeID, params.RepoOwner, params.RepoName, params.PrNum, params.PrSha)
+		if err := r.HDel(ctx, key, nodeID).Err(); err != nil {
+			logger.Errorf("Failed to forget results comment %s of pr %s/%s#%d: %v", nodeID, params.RepoOwner, params.RepoName, params.PrNum, err)
+		}
+	}
+}
+
+// supersededComment reports whether every job of the comment has a newer job of its type on
+// another commit
+func supersededComment(comment postedResultComment, latest map[string]util.PullRequestStatusParams) bool {
+	if len(comment.Jobs) == 0 {
+		return false
+	}
+	for jobType, job := range comment.Jobs {
+		newer, ok := latest[jobType]
+		if !ok || newer.PrSha == comment.PrSha || jobNumber(newer.JobID) <= jobNumber(job) {
+			return false
+		}
+	}
+	return true
+}
+
+// outdatedResults tells that the results of a job are for an older commit when its PR was pushed to
+// since the job was queued, "" when the job ran on the head of the PR
+func outdatedResults(ctx context.Context, r *jobqueue.Client, repoOwner, repoName, prNumber, prSha string) string {
+	headSha, _ := r.Client.Get(ctx, jobqueue.HeadSHAKey(repoOwner, repoName, prNumber)).Result()
+	if headSha == "" || headSha == prSha {
+		return ""
+	}
+	return util.Message(util.MessageOutdatedResults, util.MessageData{Commit: prSha, HeadCommit: headSha})
+}
+
+// jobNumber orders the jobs, their IDs are numbered in the order they were queued
+func jobNumber(jobID string) int64 {
+	number, _ := strconv.ParseInt(jobID, 10, 64)
+	return number
+}
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net"
 	"net/http"
@@ -14,11 +15,12 @@ import (
 	"time"
 
 	gosmee "github.com/chmouel/gosmee/gosmee"
-	"github.com/go-redis/redis/v8"
+	"github.com/google/go-github/v61/github"
 	"github.com/gregjones/httpcache"
 	"github.com/instructlab/instructlab-bot/gobot/common"
 	"github.com/instructlab/instructlab-bot/gobot/handlers"
 	"github.com/instructlab/instructlab-bot/gobot/util"
+	"github.com/instructlab/instructlab-bot/pkg/jobqueue"
 	"github.com/palantir/go-githubapp/githubapp"
 	"github.com/rcrowley/go-metrics"
 	"github.com/spf13/cobra"
@@ -28,9 +30,7 @@ import (
 )
 
 const (
-	JobFailed          = "Command execution failed. Check details."
-	redisQueueResults  = "results"
-	redisQueueArchived = "archived"
+	JobFailed = "Command execution failed. Check details."
 )
 
 var (
@@ -48,6 +48,37 @@ var (
 	RequiredLabels      []string
 	Maintainers         []string
 	BotUsername         string
+	CommandTriggers     []string
+	HandleEdits         bool
+	MinimizeSuperseded  bool
+	RetargetOnPush      bool
+	RepoConfigPath      string
+	AuditS3Bucket       string
+	AuditS3Prefix       string
+	AWSRegion           string
+	ResultsConcurrency  int
+	ResultsBatchSize    int
+	RateLimitReserve    int
+	GithubMaxRetries    int
+	GithubRetryBackoff  time.Duration
+	MessagesDir         string
+	ControlPlanePort    int
+	ControlPlaneTLSCert string
+	ControlPlaneTLSKey  string
+	ControlPlaneTLSCA   string
+	LeaderElection      bool
+	LeaderLease         time.Duration
+	StaleJobTimeout     time.Duration
+	JobRetention        time.Duration
+	QueueWaitSLOs       []string
+	EndToEndSLOs        []string
+	SLOSlackWebhookURL  string
+	SLOAlertCooldown    time.Duration
+	ShedQueueDepth      int
+	ShedJobTypes        []string
+	ShedPolicy          string
+	OffPeakHours        string
+	BackfillInterval    time.Duration
 	Debug               bool
 )
 
@@ -67,6 +98,37 @@ func init() {
 	rootCmd.PersistentFlags().StringSliceVarP(&Maintainers, "maintainers", "", []string{}, "GitHub users or groups that are considered maintainers")
 	rootCmd.PersistentFlags().BoolVarP(&Debug, "debug", "d", false, "Enable debug logging")
 	rootCmd.PersistentFlags().StringVarP(&BotUsername, "bot-username", "", "@instructlab-bot", "The username of the bot")
+	rootCmd.PersistentFlags().StringSliceVarP(&CommandTriggers, "command-triggers", "", []string{"/ilab"}, "Mention aliases and slash commands starting a bot command besides --bot-username, matched case-insensitively")
+	rootCmd.PersistentFlags().BoolVarP(&HandleEdits, "handle-edited-comments", "", false, "Run the command of an edited PR comment when its previous body had no valid command, such as a fixed typo")
+	rootCmd.PersistentFlags().BoolVarP(&MinimizeSuperseded, "minimize-superseded-results", "", true, "Hide the results comments of a PR as outdated once jobs of the same types reported results for a newer commit")
+	rootCmd.PersistentFlags().BoolVarP(&RetargetOnPush, "retarget-on-push", "", true, "Move the jobs of a PR no worker started yet to its new head when it is pushed to. The results of the jobs already running say they are for an older commit")
+	rootCmd.PersistentFlags().StringVarP(&RepoConfigPath, "repo-config", "", "", "Path to a YAML file with per-repository configuration keyed by owner/name. If blank, only the taxonomy repo is served")
+	rootCmd.PersistentFlags().StringVarP(&AuditS3Bucket, "audit-s3-bucket", "", "", "The S3 bucket to append the audit log of the bot commands to. If blank, commands are not audited")
+	rootCmd.PersistentFlags().StringVarP(&AuditS3Prefix, "audit-s3-prefix", "", util.AuditPrefix, "The S3 prefix of the audit log")
+	rootCmd.PersistentFlags().StringVarP(&AWSRegion, "aws-region", "", "us-east-2", "The AWS region of the audit log bucket")
+	rootCmd.PersistentFlags().IntVarP(&ResultsConcurrency, "results-concurrency", "", 1, "Number of job results reported to GitHub at the same time, the results of a PR are always reported in order")
+	rootCmd.PersistentFlags().IntVarP(&ResultsBatchSize, "results-batch-size", "", 10, "Number of job results taken from the results queue at once, the results of a PR in a batch are posted in one comment")
+	rootCmd.PersistentFlags().IntVarP(&RateLimitReserve, "github-rate-limit-reserve", "", 100, "Number of GitHub API requests kept for the webhooks, the results are held back below it until the rate limit resets")
+	rootCmd.PersistentFlags().IntVarP(&GithubMaxRetries, "github-max-retries", "", 3, "Number of retries of the GitHub API requests failing with a 502, 503, 504, a network error or a secondary rate limit")
+	rootCmd.PersistentFlags().DurationVarP(&GithubRetryBackoff, "github-retry-backoff", "", time.Second, "Wait before the first retry of a GitHub API request, doubled for each of the next ones unless GitHub sends a Retry-After")
+	rootCmd.PersistentFlags().StringVarP(&MessagesDir, "messages-dir", "", "", "Directory of Go templates replacing the default messages of the bot with the same file name. If blank, the default messages are used")
+	rootCmd.PersistentFlags().IntVarP(&ControlPlanePort, "control-plane-port", "", 0, "Port of the gRPC control plane the workers started with --control-plane-addr receive their jobs from and report to. 0 disables it, the workers poll Redis")
+	rootCmd.PersistentFlags().StringVarP(&ControlPlaneTLSCert, "control-plane-tls-cert", "", "", "Server certificate of the control plane. If blank, the control plane is served without TLS")
+	rootCmd.PersistentFlags().StringVarP(&ControlPlaneTLSKey, "control-plane-tls-key", "", "", "Key of the control plane server certificate")
+	rootCmd.PersistentFlags().StringVarP(&ControlPlaneTLSCA, "control-plane-tls-ca", "", "", "CA the client certificates of the workers must be signed by")
+	rootCmd.PersistentFlags().BoolVarP(&LeaderElection, "leader-election", "", false, "Elect one of the bot replicas sharing Redis to run the scheduler, the janitor and the deferred queue. Without it every replica runs them")
+	rootCmd.PersistentFlags().DurationVarP(&LeaderLease, "leader-lease", "", 15*time.Second, "Lease of the leader, another replica takes over this long after the leader died")
+	rootCmd.PersistentFlags().DurationVarP(&StaleJobTimeout, "stale-job-timeout", "", 6*time.Hour, "Fail the running jobs whose worker did not report for this long. 0 disables it")
+	rootCmd.PersistentFlags().StringSliceVarP(&QueueWaitSLOs, "queue-wait-slo", "", []string{}, "SLO of the wait of the jobs in the queue, a duration for every job type or type=duration, 30m,precheck=5m for instance")
+	rootCmd.PersistentFlags().StringSliceVarP(&EndToEndSLOs, "end-to-end-slo", "", []string{}, "SLO of the latency of the jobs from their comment to their results, a duration for every job type or type=duration")
+	rootCmd.PersistentFlags().StringVarP(&SLOSlackWebhookURL, "slo-slack-webhook-url", "", "", "Slack incoming webhook alerted when a job breaches an SLO. If blank, breaches are only logged and counted")
+	rootCmd.PersistentFlags().DurationVarP(&SLOAlertCooldown, "slo-alert-cooldown", "", time.Hour, "Minimum time between two Slack alerts for the same SLO and job type")
+	rootCmd.PersistentFlags().IntVarP(&ShedQueueDepth, "shed-queue-depth", "", 0, "Number of queued jobs the bot is at capacity with, the jobs of --shed-job-types are then rejected or deferred. 0 disables load shedding")
+	rootCmd.PersistentFlags().StringSliceVarP(&ShedJobTypes, "shed-job-types", "", []string{"train", "evaluate"}, "Low priority job types shed while the bot is at capacity, the e2e pipeline is shed when one of its stages is")
+	rootCmd.PersistentFlags().StringVarP(&ShedPolicy, "shed-policy", "", util.ShedReject, "What happens to the low priority jobs while the bot is at capacity: reject, or defer to the off-peak hours")
+	rootCmd.PersistentFlags().StringVarP(&OffPeakHours, "off-peak-hours", "", "0-6", "UTC hours the deferred jobs are queued in, start-end such as 22-6")
+	rootCmd.PersistentFlags().DurationVarP(&BackfillInterval, "backfill-interval", "", 30*time.Second, "Time between the prechecks queued by the backfill command")
+	rootCmd.PersistentFlags().DurationVarP(&JobRetention, "job-retention", "", 0, "Delete the reported jobs requested longer ago from Redis. 0 keeps them")
 	if GithubToken == "" {
 		GithubToken = os.Getenv("ILWORKER_GITHUB_TOKEN")
 	}
@@ -89,7 +151,7 @@ var rootCmd = &cobra.Command{
 }
 
 func run(logger *zap.SugaredLogger) error {
-	logger.Info("Starting bot...")
+	logger.Infof("Starting bot %s...", common.VersionString())
 	metricsRegistry := metrics.DefaultRegistry
 	// Replace all instances of \n with actual newlines
 	GithubAppPrivateKey = strings.ReplaceAll(GithubAppPrivateKey, "\\n", "\n")
@@ -107,34 +169,113 @@ func run(logger *zap.SugaredLogger) error {
 		},
 	}
 
+	if ResultsConcurrency < 1 || ResultsBatchSize < 1 {
+		return fmt.Errorf("--results-concurrency and --results-batch-size must be at least 1")
+	}
+	if MessagesDir != "" {
+		if err := util.LoadMessages(MessagesDir); err != nil {
+			return err
+		}
+	}
+	if GithubMaxRetries < 0 {
+		return fmt.Errorf("--github-max-retries must not be negative")
+	}
+	if LeaderElection && LeaderLease < 3*time.Second {
+		return fmt.Errorf("--leader-lease must be at least 3s")
+	}
+	queueWaitSLOs, err := util.ParseSLOs(QueueWaitSLOs)
+	if err != nil {
+		return fmt.Errorf("--queue-wait-slo: %w", err)
+	}
+	endToEndSLOs, err := util.ParseSLOs(EndToEndSLOs)
+	if err != nil {
+		return fmt.Errorf("--end-to-end-slo: %w", err)
+	}
+	latencies := &util.LatencyTracker{
+		Logger: logger,
+		SLOs: map[string]map[string]time.Duration{
+			util.LatencyQueueWait: queueWaitSLOs,
+			util.LatencyEndToEnd:  endToEndSLOs,
+		},
+		SlackWebhookURL: SLOSlackWebhookURL,
+		Cooldown:        SLOAlertCooldown,
+	}
+	offPeak, err := util.ParseOffPeakHours(OffPeakHours)
+	if err != nil {
+		return fmt.Errorf("--off-peak-hours: %w", err)
+	}
+	loadShedding := util.LoadShedding{QueueDepth: ShedQueueDepth, JobTypes: ShedJobTypes, Policy: ShedPolicy, OffPeak: offPeak}
+	if err := loadShedding.Validate(); err != nil {
+		return fmt.Errorf("invalid load shedding: %w", err)
+	}
+	rateLimiter := &util.RateLimiter{Reserve: RateLimitReserve}
+	apiRetrier := &util.APIRetrier{
+		MaxRetries: GithubMaxRetries,
+		Backoff:    GithubRetryBackoff,
+		MaxWait:    time.Minute,
+		Timeout:    3 * time.Second,
+	}
+
 	cc, err := githubapp.NewDefaultCachingClientCreator(
 		ghConfig,
-		githubapp.WithClientUserAgent("instructlab-bot/0.0.1"),
-		githubapp.WithClientTimeout(3*time.Second),
+		githubapp.WithClientUserAgent("instructlab-bot/"+common.Version),
+		githubapp.WithClientTimeout(apiRetrier.TotalTimeout()),
 		githubapp.WithClientCaching(false, func() httpcache.Cache { return httpcache.NewMemoryCache() }),
 		githubapp.WithClientMiddleware(
 			githubapp.ClientMetrics(metricsRegistry),
+			apiRetrier.Middleware,
+			rateLimiter.Middleware,
 		),
 	)
 	if err != nil {
 		return err
 	}
 
+	var repoConfigs util.RepoConfigs
+	if RepoConfigPath != "" {
+		repoConfigs, err = util.LoadRepoConfigs(RepoConfigPath)
+		if err != nil {
+			return err
+		}
+		logger.Infof("Serving %d configured repositories", len(repoConfigs))
+	}
+
+	repoFiles := util.NewRepoFiles()
+
+	auditLog, err := util.NewAuditLog(context.Background(), AuditS3Bucket, AWSRegion, AuditS3Prefix)
+	if err != nil {
+		return err
+	}
+	if auditLog != nil {
+		logger.Infof("Recording the bot commands in s3://%s/%s", AuditS3Bucket, AuditS3Prefix)
+	}
+
 	prCommentHandler := &handlers.PRCommentHandler{
-		ClientCreator:  cc,
-		Logger:         logger,
-		RedisHostPort:  RedisHost,
-		RequiredLabels: RequiredLabels,
-		BotUsername:    BotUsername,
-		Maintainers:    Maintainers,
+		ClientCreator:    cc,
+		Logger:           logger,
+		RedisHostPort:    RedisHost,
+		RequiredLabels:   RequiredLabels,
+		BotUsername:      BotUsername,
+		CommandTriggers:  CommandTriggers,
+		HandleEdits:      HandleEdits,
+		Maintainers:      Maintainers,
+		RepoConfigs:      repoConfigs,
+		RepoFiles:        repoFiles,
+		AuditLog:         auditLog,
+		LoadShedding:     loadShedding,
+		BackfillInterval: BackfillInterval,
 	}
 
 	prHandler := &handlers.PullRequestEventHandler{
 		ClientCreator:  cc,
 		Logger:         logger,
+		RedisHostPort:  RedisHost,
 		RequiredLabels: RequiredLabels,
 		BotUsername:    BotUsername,
 		Maintainers:    Maintainers,
+		RepoConfigs:    repoConfigs,
+		RepoFiles:      repoFiles,
+		RetargetOnPush: RetargetOnPush,
 	}
 
 	prCreateHandler := &handlers.PullRequestCreateHandler{
@@ -145,7 +286,18 @@ func run(logger *zap.SugaredLogger) error {
 		GithubToken:    GithubToken,
 	}
 
-	webhookHandler := githubapp.NewDefaultEventDispatcher(ghConfig, prCommentHandler, prHandler)
+	installationHandler := &handlers.InstallationEventHandler{
+		ClientCreator:  cc,
+		Logger:         logger,
+		RedisHostPort:  RedisHost,
+		RequiredLabels: RequiredLabels,
+		BotUsername:    BotUsername,
+		Maintainers:    Maintainers,
+		RepoConfigs:    repoConfigs,
+		RepoFiles:      repoFiles,
+	}
+
+	webhookHandler := githubapp.NewDefaultEventDispatcher(ghConfig, prCommentHandler, prHandler, installationHandler)
 
 	http.Handle(githubapp.DefaultWebhookRoute, webhookHandler)
 
@@ -183,6 +335,12 @@ func run(logger *zap.SugaredLogger) error {
 	httpServer := &http.Server{Addr: addr}
 	http.HandleFunc("/pr/skill", prCreateHandler.SkillPRHandler)
 	http.HandleFunc("/pr/knowledge", prCreateHandler.KnowledgePRHandler)
+	http.Handle("/metrics", &handlers.QueueMetricsHandler{
+		Logger:        logger,
+		RedisHostPort: RedisHost,
+		GithubAPI:     apiRetrier,
+		Latencies:     latencies,
+	})
 
 	go func() {
 		logger.Infof("Starting server on %s...", addr)
@@ -193,10 +351,79 @@ func run(logger *zap.SugaredLogger) error {
 	}()
 	wg.Add(1)
 	go func() {
-		receiveResults(ctx, RedisHost, logger, cc)
+		receiveResults(ctx, RedisHost, logger, cc, repoConfigs, rateLimiter, latencies)
+		wg.Done()
+	}()
+	wg.Add(1)
+	go func() {
+		updater := &handlers.StatusCommentUpdater{
+			ClientCreator: cc,
+			Logger:        logger,
+			RedisHostPort: RedisHost,
+		}
+		updater.Run(ctx)
+		wg.Done()
+	}()
+	scheduler := &handlers.Scheduler{
+		ClientCreator: cc,
+		Logger:        logger,
+		RedisHostPort: RedisHost,
+		RepoConfigs:   repoConfigs,
+	}
+	janitor := &handlers.Janitor{
+		Logger:          logger,
+		RedisHostPort:   RedisHost,
+		StaleJobTimeout: StaleJobTimeout,
+		JobRetention:    JobRetention,
+	}
+	deferredQueue := &handlers.DeferredQueue{
+		Logger:        logger,
+		RedisHostPort: RedisHost,
+		LoadShedding:  loadShedding,
+	}
+	lead := func(ctx context.Context) {
+		var leaderWg sync.WaitGroup
+		leaderWg.Add(3)
+		go func() {
+			scheduler.Run(ctx)
+			leaderWg.Done()
+		}()
+		go func() {
+			janitor.Run(ctx)
+			leaderWg.Done()
+		}()
+		go func() {
+			deferredQueue.Run(ctx)
+			leaderWg.Done()
+		}()
+		leaderWg.Wait()
+	}
+	wg.Add(1)
+	go func() {
+		if LeaderElection {
+			r := jobqueue.NewClient(RedisHost)
+			runAsLeader(ctx, logger, r.NewLease(leaderRole, replicaID(), LeaderLease), lead)
+			r.Close()
+		} else {
+			lead(ctx)
+		}
 		wg.Done()
 	}()
 
+	if ControlPlanePort > 0 {
+		controlPlane, err := newControlPlane(logger)
+		if err != nil {
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			if err := serveControlPlane(ctx, logger, controlPlane); err != nil {
+				logger.Errorf("Control plane hit an error: %v", err)
+			}
+			wg.Done()
+		}()
+	}
+
 	<-ctx.Done()
 
 	ctx, cancel = context.WithTimeout(ctx, 2*time.Second)
@@ -253,12 +480,8 @@ func bindFlags(cmd *cobra.Command, v *viper.Viper) {
 	})
 }
 
-func receiveResults(ctx context.Context, redisHostPort string, logger *zap.SugaredLogger, cc githubapp.ClientCreator) {
-	r := redis.NewClient(&redis.Options{
-		Addr:     redisHostPort,
-		Password: "", // no password set
-		DB:       0,  // use default DB
-	})
+func receiveResults(ctx context.Context, redisHostPort string, logger *zap.SugaredLogger, cc githubapp.ClientCreator, repoConfigs util.RepoConfigs, limiter *util.RateLimiter, latencies *util.LatencyTracker) {
+	r := jobqueue.NewClient(redisHostPort)
 
 	for {
 		select {
@@ -266,7 +489,7 @@ func receiveResults(ctx context.Context, redisHostPort string, logger *zap.Sugar
 			logger.Info("Context cancelled, stopping receiveResults")
 			return
 		default:
-			count, err := r.LLen(ctx, redisQueueResults).Result()
+			count, err := r.PendingResults(ctx)
 			if err != nil {
 				logger.Errorf("Redis Client Error: %v", err)
 				continue
@@ -277,230 +500,459 @@ func receiveResults(ctx context.Context, redisHostPort string, logger *zap.Sugar
 				continue
 			}
 
-			// Use LMove to move the job from "results" to the "archived" list
-			result, err := r.LMove(ctx, redisQueueResults, redisQueueArchived, "RIGHT", "LEFT").Result()
-			if err != nil {
-				logger.Errorf("Redis Client Error during LMove: %v", err)
+			// Hold the results back while GitHub is rate limiting the bot
+			if err := limiter.Wait(ctx); err != nil {
 				continue
 			}
+			reportResults(ctx, r, logger, cc, repoConfigs, limiter, latencies, nextResults(ctx, r, logger))
+		}
+	}
+}
 
-			if result == "" {
-				logger.Info("No job moved, possibly due to an empty 'results' list")
-				continue
-			}
+// nextResults moves up to --results-batch-size jobs from the results queue to the archived
+// queue and groups them by PR, oldest first
+func nextResults(ctx context.Context, r *jobqueue.Client, logger *zap.SugaredLogger) [][]string {
+	var groups [][]string
+	index := make(map[string]int)
+	for i := 0; i < ResultsBatchSize; i++ {
+		result, err := r.NextResult(ctx)
+		if err != nil {
+			logger.Errorf("Redis Client Error while archiving a result: %v", err)
+			break
+		}
+		if result == "" {
+			break
+		}
+		logger.Debugf("Job %s moved to archive queue successfully.", result)
 
-			// Log that the job has been archived successfully
-			logger.Debugf("Job %s moved to archive queue successfully.", result)
+		pr := resultPR(ctx, r, result)
+		if j, ok := index[pr]; ok {
+			groups[j] = append(groups[j], result)
+			continue
+		}
+		index[pr] = len(groups)
+		groups = append(groups, []string{result})
+	}
+	return groups
+}
 
-			prNumber, err := r.Get(ctx, buildRedisKey(result, common.RedisKeyPRNumber)).Result()
-			if err != nil || prNumber == "" {
-				logger.Errorf("No PR number found for job %s", result)
-				continue
-			}
+// resultPR identifies the PR of a job, the jobs without one are grouped alone
+func resultPR(ctx context.Context, r *jobqueue.Client, jobID string) string {
+	repoOwner, _ := r.Get(ctx, jobID, jobqueue.FieldRepoOwner)
+	repoName, _ := r.Get(ctx, jobID, jobqueue.FieldRepoName)
+	prNumber, _ := r.Get(ctx, jobID, jobqueue.FieldPRNumber)
+	if repoOwner == "" || repoName == "" || prNumber == "" {
+		return "job " + jobID
+	}
+	return fmt.Sprintf("%s/%s#%s", repoOwner, repoName, prNumber)
+}
 
-			installID, err := r.Get(ctx, buildRedisKey(result, common.RedisKeyInstallationID)).Result()
-			if err != nil || installID == "" {
-				logger.Errorf("No installation ID found for job %s", result)
-				continue
-			}
-			installIDInt, err := strconv.Atoi(installID)
-			if err != nil {
-				logger.Errorf("Error converting installation ID to int: %v", err)
-				continue
+// reportResults reports the groups of results on --results-concurrency consumers. The results of a
+// PR are reported in order by the same consumer and their comments posted together.
+func reportResults(ctx context.Context, r *jobqueue.Client, logger *zap.SugaredLogger, cc githubapp.ClientCreator, repoConfigs util.RepoConfigs, limiter *util.RateLimiter, latencies *util.LatencyTracker, groups [][]string) {
+	pending := make(chan []string)
+	wg := sync.WaitGroup{}
+	for i := 0; i < ResultsConcurrency && i < len(groups); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for group := range pending {
+				var comments []resultComment
+				for _, result := range group {
+					if comment := handleResult(ctx, r, logger, cc, repoConfigs, latencies, result); comment != nil {
+						comments = append(comments, *comment)
+					}
+				}
+				if err := limiter.Wait(ctx); err == nil {
+					postResultComments(ctx, r, logger, comments)
+				}
 			}
+		}()
+	}
+	for _, group := range groups {
+		pending <- group
+	}
+	close(pending)
+	wg.Wait()
+}
 
-			repoOwner, err := r.Get(ctx, buildRedisKey(result, common.RedisKeyRepoOwner)).Result()
-			if err != nil || repoOwner == "" {
-				logger.Errorf("No repo owner found for job %s", result)
-				continue
-			}
+// resultComment is the results comments of a successful job
+type resultComment struct {
+	client *github.Client
+	params util.PullRequestStatusParams
+	bodies []string
+	// replyTo is the review comment the job was requested in, its results are replied in its thread
+	replyTo int64
+}
 
-			repoName, err := r.Get(ctx, buildRedisKey(result, common.RedisKeyRepoName)).Result()
-			if err != nil || repoName == "" {
-				logger.Errorf("No repo name found for job %s", result)
-				continue
-			}
+// postResultComments posts the results comments of the jobs of a PR in as few comments as GitHub
+// allows, rather than one per job. The results of the jobs requested in a review comment are
+// replied in its thread. The earlier results comments they supersede are then minimized.
+func postResultComments(ctx context.Context, r *jobqueue.Client, logger *zap.SugaredLogger, comments []resultComment) {
+	if len(comments) == 0 {
+		return
+	}
+	var bodies []string
+	jobs := make(map[string]string)
+	for _, comment := range comments {
+		if comment.replyTo != 0 {
+			postResultComment(ctx, r, logger, comment.client, comment.params, comment.bodies, comment.replyTo, map[string]string{comment.params.JobType: comment.params.JobID})
+			continue
+		}
+		bodies = append(bodies, comment.bodies...)
+		jobs[comment.params.JobType] = comment.params.JobID
+	}
+	if len(bodies) > 0 {
+		postResultComment(ctx, r, logger, comments[0].client, comments[0].params, util.JoinComments(bodies), 0, jobs)
+	}
+	if MinimizeSuperseded {
+		minimizeSupersededComments(ctx, r, logger, comments)
+	}
+}
 
-			jobType, err := r.Get(ctx, buildRedisKey(result, common.RedisKeyJobType)).Result()
-			if err != nil || jobType == "" {
-				logger.Errorf("No job type found for job %s", result)
-				continue
-			}
+// postResultComment posts the bodies and records the comments as reporting the jobs, by job type
+func postResultComment(ctx context.Context, r *jobqueue.Client, logger *zap.SugaredLogger, client *github.Client, params util.PullRequestStatusParams, bodies []string, replyTo int64, jobs map[string]string) {
+	for _, body := range bodies {
+		params.Comment = body
+		nodeID, err := util.PostResultComment(ctx, client, params, replyTo)
+		if err != nil {
+			logger.Errorf("Failed to post comment on pr %s/%s#%d: %v", params.RepoOwner, params.RepoName, params.PrNum, err)
+			continue
+		}
+		if err := recordResultComment(ctx, r, params, nodeID, jobs); err != nil {
+			logger.Errorf("Failed to record results comment %s of pr %s/%s#%d: %v", nodeID, params.RepoOwner, params.RepoName, params.PrNum, err)
+		}
+	}
+}
 
-			prSha, err := r.Get(ctx, buildRedisKey(result, common.RedisKeyPRSHA)).Result()
-			if err != nil || prSha == "" {
-				logger.Errorf("No PR SHA found for job %s", result)
-				continue
-			}
+// handleResult reports the result of a job on its PR: the check run right away, and the results
+// comment it returns to be posted with the other results of the PR. The results of the jobs of a
+// group are summarized in the post of the group instead of a comment.
+func handleResult(ctx context.Context, r *jobqueue.Client, logger *zap.SugaredLogger, cc githubapp.ClientCreator, repoConfigs util.RepoConfigs, latencies *util.LatencyTracker, result string) *resultComment {
+	group, _ := r.Get(ctx, result, jobqueue.FieldGroup)
+	if group != "" {
+		defer handlers.UpdateGroupSummary(ctx, r, logger, cc, group)
+	}
 
-			requestTimeStr, err := r.Get(ctx, buildRedisKey(result, common.RedisKeyRequestTime)).Result()
-			if err != nil || requestTimeStr == "" {
-				logger.Errorf("No request time found for job %s", result)
-				continue
-			}
-			requestTime, err := strconv.ParseInt(requestTimeStr, 10, 64)
-			if err != nil {
-				logger.Errorf("Error parsing request time for job %s: %v", result, err)
-				continue
-			}
-			totalTime := time.Now().Unix() - requestTime
+	prNumber, err := r.Get(ctx, result, jobqueue.FieldPRNumber)
+	if prNumber == "" {
+		// Scheduled jobs run against a branch and have no PR
+		if branch, _ := r.Get(ctx, result, jobqueue.FieldBranch); branch != "" {
+			reportScheduledResult(ctx, r, logger, cc, result)
+			return nil
+		}
+	}
+	if err != nil || prNumber == "" {
+		logger.Errorf("No PR number found for job %s", result)
+		return nil
+	}
 
-			prURL := fmt.Sprintf("https://github.com/%s/%s/pull/%s", repoOwner, repoName, prNumber)
+	installID, err := r.Get(ctx, result, jobqueue.FieldInstallationID)
+	if err != nil || installID == "" {
+		logger.Errorf("No installation ID found for job %s", result)
+		return nil
+	}
+	installIDInt, err := strconv.Atoi(installID)
+	if err != nil {
+		logger.Errorf("Error converting installation ID to int: %v", err)
+		return nil
+	}
 
-			jobDuration, err := r.Get(ctx, buildRedisKey(result, common.RedisKeyDuration)).Result()
+	repoOwner, err := r.Get(ctx, result, jobqueue.FieldRepoOwner)
+	if err != nil || repoOwner == "" {
+		logger.Errorf("No repo owner found for job %s", result)
+		return nil
+	}
 
-			if err != nil || jobDuration == "" {
-				logger.Infof("Job result for %s/%s#%s, job ID: %s, GitHub URL: %s (No job duration time found for job)", repoOwner, repoName, prNumber, result, prURL)
-			} else {
+	repoName, err := r.Get(ctx, result, jobqueue.FieldRepoName)
+	if err != nil || repoName == "" {
+		logger.Errorf("No repo name found for job %s", result)
+		return nil
+	}
 
-				jobDurationInt, err := strconv.ParseInt(jobDuration, 10, 64)
-				if err != nil {
-					logger.Errorf("Error parsing duration time for job %s: %v", result, err)
-					continue
-				}
-				queueTime := totalTime - jobDurationInt
-				logger.Infof("Job result for %s/%s#%s, job ID: %s, job duration: %s, queue time: %d URL: %s", repoOwner, repoName, prNumber, result, jobDuration, queueTime, prURL)
-			}
+	jobType, err := r.Get(ctx, result, jobqueue.FieldJobType)
+	if err != nil || jobType == "" {
+		logger.Errorf("No job type found for job %s", result)
+		return nil
+	}
 
-			var statusContext string
-			switch jobType {
-			case "generate":
-				statusContext = common.GenerateLocalCheck
-			case "precheck":
-				statusContext = common.PrecheckCheck
-			case "sdg-svc":
-				statusContext = common.GenerateSDGCheck
-			default:
-				logger.Errorf("Unknown job type: %s", jobType)
-			}
+	prSha, err := r.Get(ctx, result, jobqueue.FieldPRSHA)
+	if err != nil || prSha == "" {
+		logger.Errorf("No PR SHA found for job %s", result)
+		return nil
+	}
 
-			client, err := cc.NewInstallationClient(int64(installIDInt))
-			if err != nil {
-				logger.Errorf("Failed to create installation client: %v", err)
-				continue
-			}
+	requestTimeStr, err := r.Get(ctx, result, jobqueue.FieldRequestTime)
+	if err != nil || requestTimeStr == "" {
+		logger.Errorf("No request time found for job %s", result)
+		return nil
+	}
+	requestTime, err := strconv.ParseInt(requestTimeStr, 10, 64)
+	if err != nil {
+		logger.Errorf("Error parsing request time for job %s: %v", result, err)
+		return nil
+	}
+	totalTime := time.Now().Unix() - requestTime
+	observeLatencies(ctx, r, latencies, result, jobType, requestTime)
 
-			prNum, err := strconv.Atoi(prNumber)
-			if err != nil {
-				logger.Errorf("error converting string to int: %v", err)
-				continue
-			}
+	prURL := fmt.Sprintf("https://github.com/%s/%s/pull/%s", repoOwner, repoName, prNumber)
+	outdated := outdatedResults(ctx, r, repoOwner, repoName, prNumber, prSha)
 
-			// check for errors prior to checking for an S3 url and models since that will not get produced on a failure
-			prErrors, _ := r.Get(ctx, "jobs:"+result+":errors").Result()
-			if prErrors != "" {
-				errCommentBody := fmt.Sprintf("An error occurred while processing your request, please review the following log for job id %s :\n\n```\n%s\n```", result, prErrors)
-
-				params := util.PullRequestStatusParams{
-					Status:       common.CheckComplete,
-					Conclusion:   common.CheckStatusFailure,
-					CheckName:    statusContext,
-					CheckSummary: JobFailed,
-					CheckDetails: errCommentBody,
-					Comment:      errCommentBody,
-					JobType:      jobType,
-					JobID:        result,
-					JobErr:       errCommentBody,
-					RepoOwner:    repoOwner,
-					RepoName:     repoName,
-					PrNum:        prNum,
-					PrSha:        prSha,
-				}
+	jobDuration, err := r.Get(ctx, result, jobqueue.FieldDuration)
 
-				logger.Errorf("Error processing command on %s/%s#%d: err %s",
-					params.RepoOwner, params.RepoName, params.PrNum, params.JobErr)
+	if err != nil || jobDuration == "" {
+		logger.Infof("Job result for %s/%s#%s, job ID: %s, GitHub URL: %s (No job duration time found for job)", repoOwner, repoName, prNumber, result, prURL)
+	} else {
 
-				err = util.PostPullRequestCheck(ctx, client, params)
-				if err != nil {
-					logger.Errorf("Failed to update error message on PR for job %s error: %v", result, err)
-				}
+		jobDurationInt, err := strconv.ParseInt(jobDuration, 10, 64)
+		if err != nil {
+			logger.Errorf("Error parsing duration time for job %s: %v", result, err)
+			return nil
+		}
+		queueTime := totalTime - jobDurationInt
+		logger.Infof("Job result for %s/%s#%s, job ID: %s, job duration: %s, queue time: %d URL: %s", repoOwner, repoName, prNumber, result, jobDuration, queueTime, prURL)
+		recordQuotaSeconds(ctx, r, logger, result, repoOwner, repoName, jobDurationInt)
+	}
 
-				// Enable redis keys deletion once we have solution for persisting the job history
-				// cleanupRedisKeys(logger, r, result)
-				continue
-			}
+	var statusContext string
+	switch jobType {
+	case "generate":
+		statusContext = common.GenerateLocalCheck
+	case "precheck":
+		statusContext = common.PrecheckCheck
+	case "sdg-svc":
+		statusContext = common.GenerateSDGCheck
+	case "train":
+		statusContext = common.TrainCheck
+	case "evaluate":
+		statusContext = common.EvaluateCheck
+	default:
+		logger.Errorf("Unknown job type: %s", jobType)
+	}
 
-			s3Url, err := r.Get(ctx, "jobs:"+result+":s3_url").Result()
-			if err != nil || s3Url == "" {
-				logger.Errorf("No S3 URL found for job %s", result)
-				continue
-			}
+	client, err := cc.NewInstallationClient(int64(installIDInt))
+	if err != nil {
+		logger.Errorf("Failed to create installation client: %v", err)
+		return nil
+	}
 
-			modelName, err := r.Get(ctx, "jobs:"+result+":model_name").Result()
-			if err != nil || modelName == "" || modelName == "unknown" {
-				logger.Infof("No specific model name found for job %s, using generic message.", result)
-				modelName = ""
-			} else {
-				modelName = "using the model " + modelName
-			}
+	prNum, err := strconv.Atoi(prNumber)
+	if err != nil {
+		logger.Errorf("error converting string to int: %v", err)
+		return nil
+	}
 
-			// Add the model name only if it's not empty
-			detailsMsg := fmt.Sprintf("Beep, boop 🤖, Here are the %s results for your PR", jobType)
-			if modelName != "" {
-				detailsMsg += " " + modelName
-			}
-			detailsMsg += fmt.Sprintf("!\n\nResults can be found [here](%s).", s3Url)
-
-			summaryMsg := fmt.Sprintf("Job ID: %s completed successfully. Check Details.", result)
-
-			params := util.PullRequestStatusParams{
-				Status:       common.CheckComplete,
-				Conclusion:   common.CheckStatusSuccess,
-				JobID:        result,
-				JobType:      jobType,
-				CheckName:    statusContext,
-				CheckSummary: summaryMsg,
-				CheckDetails: detailsMsg,
-				Comment:      detailsMsg,
-				RepoOwner:    repoOwner,
-				RepoName:     repoName,
-				PrNum:        prNum,
-				PrSha:        prSha,
-			}
+	// Dry runs only plan the job, they don't count towards the merge policy
+	dryRun, _ := r.Get(ctx, result, jobqueue.FieldDryRun)
 
-			err = util.PostPullRequestCheck(ctx, client, params)
-			if err != nil {
-				logger.Errorf("Failed to post check on pr %s/%s#%d: %v", params.RepoOwner, params.RepoName, params.PrNum, err)
-			}
+	// Annotations (e.g. YAML lint findings) are attached to the check run for both failures and successes
+	var annotations []*github.CheckRunAnnotation
+	annotationsJSON, _ := r.Get(ctx, result, jobqueue.FieldAnnotations)
+	if annotationsJSON != "" {
+		if err := json.Unmarshal([]byte(annotationsJSON), &annotations); err != nil {
+			logger.Errorf("Failed to parse annotations for job %s: %v", result, err)
+		}
+	}
 
-			err = util.PostPullRequestComment(ctx, client, params)
-			if err != nil {
-				logger.Errorf("Failed to post comment on pr %s/%s#%d: %v", params.RepoOwner, params.RepoName, params.PrNum, err)
-			}
-			// Enable redis keys deletion once we have solution for persisting the job history
-			// cleanupRedisKeys(logger, r, result)
+	// check for errors prior to checking for an S3 url and models since that will not get produced on a failure
+	prErrors, _ := r.Get(ctx, result, jobqueue.FieldErrors)
+	if prErrors != "" {
+		// The link to the artifacts stays at the top when a long log is cut to fit the check
+		failedArtifacts, _ := r.Get(ctx, result, jobqueue.FieldFailedURL)
+		errorCategory, _ := r.Get(ctx, result, jobqueue.FieldErrorCategory)
+		encrypted, _ := r.Get(ctx, result, jobqueue.FieldEncrypted)
+		errComment := util.ResultComment{
+			Header: util.Message(util.MessageJobFailed, util.MessageData{
+				JobID:     result,
+				FailedURL: failedArtifacts,
+				Encrypted: encrypted == "true",
+				Guidance:  util.ErrorGuidance(errorCategory),
+			}),
+			Sections: []string{fmt.Sprintf("```\n%s\n```", prErrors)},
+		}
+		if outdated != "" {
+			errComment.Sections = append([]string{outdated}, errComment.Sections...)
+		}
+		if buildInfo := jobBuildInfo(ctx, r, result); buildInfo != "" {
+			errComment.Sections = append(errComment.Sections, buildInfo)
+		}
+		errCommentBody := errComment.Render()[0]
+
+		params := util.PullRequestStatusParams{
+			Status:       common.CheckComplete,
+			Conclusion:   common.CheckStatusFailure,
+			CheckName:    statusContext,
+			CheckSummary: JobFailed,
+			CheckDetails: errCommentBody,
+			Comment:      errCommentBody,
+			JobType:      jobType,
+			JobID:        result,
+			JobErr:       errCommentBody,
+			Annotations:  annotations,
+			RepoOwner:    repoOwner,
+			RepoName:     repoName,
+			PrNum:        prNum,
+			PrSha:        prSha,
+		}
+
+		logger.Errorf("Error processing command on %s/%s#%d: err %s",
+			params.RepoOwner, params.RepoName, params.PrNum, params.JobErr)
+
+		err = util.PostPullRequestCheck(ctx, client, params)
+		if err != nil {
+			logger.Errorf("Failed to update error message on PR for job %s error: %v", result, err)
+		}
+		handlers.FinishStatusComment(ctx, r, logger, client, result, true)
+		concludePipeline(ctx, r, logger, client, result, true, params)
+		if dryRun != "true" {
+			evaluatePolicy(ctx, r, logger, client, repoConfigs, result, jobType, true, params)
 		}
+
+		// Enable redis keys deletion once we have solution for persisting the job history
+		// cleanupRedisKeys(logger, r, result)
+		return nil
 	}
-}
 
-// buildRedisKey constructs a Redis key for job attributes.
-func buildRedisKey(jobID, keyType string) string {
-	return fmt.Sprintf("%s:%s:%s", common.RedisKeyJobs, jobID, keyType)
-}
+	s3Url, err := r.Get(ctx, result, jobqueue.FieldS3URL)
+	if err != nil || s3Url == "" {
+		logger.Errorf("No S3 URL found for job %s", result)
+		return nil
+	}
+
+	modelName, err := r.Get(ctx, result, jobqueue.FieldModelName)
+	if err != nil || modelName == "" || modelName == "unknown" {
+		logger.Infof("No specific model name found for job %s, using generic message.", result)
+		modelName = ""
+	}
 
-//lint:ignore U1000
-func cleanupRedisKeys(ctx context.Context, logger *zap.SugaredLogger, r *redis.Client, jobID string) {
-	matchKey := fmt.Sprintf("%s:%s:*", common.RedisKeyJobs, jobID)
-	var cursor uint64 = 0
+	encrypted, _ := r.Get(ctx, result, jobqueue.FieldEncrypted)
+	msgData := util.MessageData{JobType: jobType, JobID: result, Model: modelName, URL: s3Url, Encrypted: encrypted == "true", DryRun: dryRun == "true"}
+	comment := util.ResultComment{
+		Header:    util.Message(util.MessageJobResults, msgData),
+		Continued: util.Message(util.MessageJobResultsContinued, msgData),
+	}
+	if outdated != "" {
+		comment.Sections = append(comment.Sections, outdated)
+	}
 
-	for {
-		keys, nextCursor, err := r.Scan(ctx, cursor, matchKey, 0).Result()
+	usageJSON, _ := r.Get(ctx, result, jobqueue.FieldTokenUsage)
+	if usageJSON != "" {
+		usage, err := util.ParseTokenUsage(usageJSON)
 		if err != nil {
-			logger.Errorf("Error scanning keys matching to %s: %v", matchKey, err)
-			return
+			logger.Errorf("Failed to parse token usage for job %s: %v", result, err)
+		} else {
+			comment.Sections = append(comment.Sections, usage.Markdown())
 		}
+	}
 
-		for _, key := range keys {
-			err := r.Del(ctx, key).Err()
-			if err != nil {
-				logger.Warnf("Error deleting key %s: %v", key, err)
-			}
+	// Precheck jobs provide a markdown summary of the answers so they can be triaged on the PR
+	summary, _ := r.Get(ctx, result, jobqueue.FieldSummary)
+	if summary != "" {
+		comment.Sections = append(comment.Sections, summary)
+	}
+	if buildInfo := jobBuildInfo(ctx, r, result); buildInfo != "" {
+		comment.Sections = append(comment.Sections, buildInfo)
+	}
+	// The check shows the first comment, which holds as much of the results as GitHub accepts
+	bodies := comment.Render()
+	detailsMsg := bodies[0]
+
+	if jobDuration != "" {
+		recordJobDuration(ctx, r, logger, result, jobType, jobDuration)
+	}
+
+	summaryMsg := fmt.Sprintf("Job ID: %s completed successfully. Check Details.", result)
+
+	params := util.PullRequestStatusParams{
+		Status:       common.CheckComplete,
+		Conclusion:   common.CheckStatusSuccess,
+		JobID:        result,
+		JobType:      jobType,
+		CheckName:    statusContext,
+		CheckSummary: summaryMsg,
+		CheckDetails: detailsMsg,
+		Comment:      detailsMsg,
+		Annotations:  annotations,
+		RepoOwner:    repoOwner,
+		RepoName:     repoName,
+		PrNum:        prNum,
+		PrSha:        prSha,
+	}
+
+	err = util.PostPullRequestCheck(ctx, client, params)
+	if err != nil {
+		logger.Errorf("Failed to post check on pr %s/%s#%d: %v", params.RepoOwner, params.RepoName, params.PrNum, err)
+	}
+
+	handlers.FinishStatusComment(ctx, r, logger, client, result, false)
+	concludePipeline(ctx, r, logger, client, result, false, params)
+	if dryRun != "true" {
+		evaluatePolicy(ctx, r, logger, client, repoConfigs, result, jobType, false, params)
+	}
+	// Enable redis keys deletion once we have solution for persisting the job history
+	// cleanupRedisKeys(logger, r, result)
+	if group != "" {
+		return nil
+	}
+	replyTo, _ := r.GetInt(ctx, result, jobqueue.FieldReplyTo)
+	return &resultComment{client: client, params: params, bodies: bodies, replyTo: replyTo}
+}
+
+// recordQuotaSeconds counts the compute time of a job, failed or not, towards the quotas of its
+// author and repository
+func recordQuotaSeconds(ctx context.Context, r *jobqueue.Client, logger *zap.SugaredLogger, jobID, repoOwner, repoName string, seconds int64) {
+	author, _ := r.Get(ctx, jobID, jobqueue.FieldAuthor)
+	period := util.QuotaPeriod(time.Now())
+	keys := []string{util.QuotaUsageKey(period, util.QuotaScopeRepo, repoOwner+"/"+repoName)}
+	if author != "" {
+		keys = append(keys, util.QuotaUsageKey(period, util.QuotaScopeUser, author))
+	}
+	for _, key := range keys {
+		pipe := r.TxPipeline()
+		pipe.HIncrBy(ctx, key, util.QuotaFieldSeconds, seconds)
+		pipe.Expire(ctx, key, util.QuotaUsageTTL)
+		if _, err := pipe.Exec(ctx); err != nil {
+			logger.Errorf("Failed to count the compute time of job %s towards the quotas: %v", jobID, err)
 		}
+	}
+}
 
-		cursor = nextCursor
-		if cursor == 0 {
-			break
+// jobBuildInfo tells which builds queued and ran a job, for its results comment
+func jobBuildInfo(ctx context.Context, r *jobqueue.Client, jobID string) string {
+	botVersion, _ := r.Get(ctx, jobID, jobqueue.FieldBotVersion)
+	workerVersion, _ := r.Get(ctx, jobID, jobqueue.FieldWorkerVersion)
+	ilabVersion, _ := r.Get(ctx, jobID, jobqueue.FieldIlabVersion)
+	return util.BuildInfoMarkdown(botVersion, workerVersion, ilabVersion)
+}
+
+// observeLatencies records the wait of a job in the queue and its end-to-end latency, from the
+// comment requesting it to its results being reported now. Jobs queued before the enqueue time was
+// recorded wait from their request.
+func observeLatencies(ctx context.Context, r *jobqueue.Client, latencies *util.LatencyTracker, jobID, jobType string, requestTime int64) {
+	enqueueTime, _ := r.GetInt(ctx, jobID, jobqueue.FieldEnqueueTime)
+	if enqueueTime == 0 {
+		enqueueTime = requestTime
+	}
+	if startTime, _ := r.GetInt(ctx, jobID, jobqueue.FieldStartTime); startTime > 0 {
+		latencies.Observe(util.LatencyQueueWait, jobType, jobID, time.Duration(startTime-enqueueTime)*time.Second)
+	}
+	latencies.Observe(util.LatencyEndToEnd, jobType, jobID, time.Since(time.Unix(requestTime, 0)))
+}
+
+// recordJobDuration keeps the recent durations of successful jobs per job type for the queue
+// estimates, and with the size of their PR for the completion estimates
+func recordJobDuration(ctx context.Context, r *jobqueue.Client, logger *zap.SugaredLogger, jobID, jobType, duration string) {
+	key := jobqueue.DurationsKey(jobType)
+	if err := r.LPush(ctx, key, duration).Err(); err != nil {
+		logger.Errorf("Failed to record the duration of a %s job: %v", jobType, err)
+		return
+	}
+	if err := r.LTrim(ctx, key, 0, util.MaxRecordedDurations-1).Err(); err != nil {
+		logger.Errorf("Failed to trim the durations of %s jobs: %v", jobType, err)
+	}
+	if seconds, err := strconv.ParseInt(duration, 10, 64); err == nil {
+		if err := handlers.RecordDurationSample(ctx, r, jobID, jobType, seconds); err != nil {
+			logger.Errorf("Failed to record the duration sample of job %s: %v", jobID, err)
 		}
 	}
-	logger.Infof("Deleted all keys matching to %s", matchKey)
 }
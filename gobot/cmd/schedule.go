@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/instructlab/instructlab-bot/gobot/util"
+	"github.com/instructlab/instructlab-bot/pkg/jobqueue"
+	"github.com/palantir/go-githubapp/githubapp"
+	"go.uber.org/zap"
+)
+
+// reportScheduledResult logs the result of a scheduled job and comments it on the tracking issue
+// of its schedule, if there is one. The jobs of a group are reported in its summary instead.
+func reportScheduledResult(ctx context.Context, r *jobqueue.Client, logger *zap.SugaredLogger, cc githubapp.ClientCreator, job string) {
+	get := func(field jobqueue.Field) string {
+		value, _ := r.Get(ctx, job, field)
+		return value
+	}
+	schedule, branch, jobType := get(jobqueue.FieldSchedule), get(jobqueue.FieldBranch), get(jobqueue.FieldJobType)
+	repoOwner, repoName := get(jobqueue.FieldRepoOwner), get(jobqueue.FieldRepoName)
+
+	data := util.MessageData{JobType: jobType, JobID: job, Schedule: schedule, Branch: branch, Encrypted: get(jobqueue.FieldEncrypted) == "true"}
+	if jobErrors := get(jobqueue.FieldErrors); jobErrors != "" {
+		logger.Errorf("Scheduled job %s of schedule %s for %s/%s failed: %s", job, schedule, repoOwner, repoName, jobErrors)
+		data.Failed, data.Error, data.FailedURL = true, jobErrors, get(jobqueue.FieldFailedURL)
+	} else {
+		data.URL, data.Summary = get(jobqueue.FieldS3URL), get(jobqueue.FieldSummary)
+		logger.Infof("Scheduled job %s of schedule %s for %s/%s done, results: %s", job, schedule, repoOwner, repoName, data.URL)
+	}
+	body := util.Message(util.MessageScheduledResult, data)
+
+	trackingIssue := get(jobqueue.FieldTrackingIssue)
+	if trackingIssue == "" || get(jobqueue.FieldGroup) != "" {
+		return
+	}
+	issueNum, err := strconv.Atoi(trackingIssue)
+	if err != nil {
+		logger.Errorf("Invalid tracking issue %q for job %s: %v", trackingIssue, job, err)
+		return
+	}
+	installID, err := strconv.ParseInt(get(jobqueue.FieldInstallationID), 10, 64)
+	if err != nil || installID == 0 {
+		logger.Errorf("No installation ID found for scheduled job %s, cannot comment on %s/%s#%d", job, repoOwner, repoName, issueNum)
+		return
+	}
+	client, err := cc.NewInstallationClient(installID)
+	if err != nil {
+		logger.Errorf("Failed to create installation client: %v", err)
+		return
+	}
+
+	params := util.PullRequestStatusParams{
+		Comment:   body,
+		RepoOwner: repoOwner,
+		RepoName:  repoName,
+		PrNum:     issueNum,
+	}
+	if err := util.PostPullRequestComment(ctx, client, params); err != nil {
+		logger.Errorf("Failed to comment on tracking issue %s/%s#%d: %v", repoOwner, repoName, issueNum, err)
+	}
+}
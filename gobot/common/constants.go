@@ -10,6 +10,7 @@ const (
 	CheckStatusFailure = "failure"
 	CheckStatusError   = "error"
 	CheckStatusPending = "pending"
+	CheckStatusSkipped = "skipped"
 
 	BotReadyStatus    = "InstructLab Bot"
 	BotReadyStatusMsg = "InstructLab bot is ready to assist!!"
@@ -17,25 +18,19 @@ const (
 	PrecheckCheck      = "Precheck Check"
 	GenerateLocalCheck = "Generate Local Check"
 	GenerateSDGCheck   = "Generate SDG Check"
+	TrainCheck         = "Train Check"
+	EvaluateCheck      = "Evaluate Check"
+	E2ECheck           = "E2E Check"
 
 	PrecheckStatus      = "Precheck Status"
 	GenerateLocalStatus = "Generate Local Status"
 	GenerateSDGStatus   = "Generate SDG Status"
+	TrainStatus         = "Train Status"
+	EvaluateStatus      = "Evaluate Status"
+	E2EStatus           = "E2E Status"
 
 	InstructLabBotUrl = "https://github.com/instructlab/instructlab-bot"
 )
 
-const (
-	RedisKeyJobs           = "jobs"
-	RedisKeyPRNumber       = "pr_number"
-	RedisKeyPRSHA          = "pr_sha"
-	RedisKeyAuthor         = "author"
-	RedisKeyInstallationID = "installation_id"
-	RedisKeyRepoOwner      = "repo_owner"
-	RedisKeyRepoName       = "repo_name"
-	RedisKeyJobType        = "job_type"
-	RedisKeyErrors         = "errors"
-	RedisKeyRequestTime    = "request_time"
-	RedisKeyDuration       = "duration"
-	RedisKeyStatus         = "status"
-)
+// RedisKeyPolicy prefixes the merge policy results of a PR head, the job keys are in jobqueue
+const RedisKeyPolicy = "policy"
@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/go-github/v61/github"
+	"github.com/instructlab/instructlab-bot/gobot/common"
+	"github.com/instructlab/instructlab-bot/gobot/util"
+	"github.com/instructlab/instructlab-bot/pkg/jobqueue"
+)
+
+// backfillCapacityWait is how long a backfill waits for the queue to drain below its capacity
+const backfillCapacityWait = time.Minute
+
+// backfillCommand prechecks the open PRs of the repository lacking precheck results for their
+// head, such as after the bot was installed on an existing repository. The PRs are queued one
+// every BackfillInterval in the background, for maintainers only.
+func (h *PRCommentHandler) backfillCommand(ctx context.Context, client *github.Client, prComment *PRComment) error {
+	h.Logger.Infof("Backfill command received on %s/%s#%d by %s",
+		prComment.repoOwner, prComment.repoName, prComment.prNum, prComment.author)
+
+	params := util.PullRequestStatusParams{
+		RepoOwner: prComment.repoOwner,
+		RepoName:  prComment.repoName,
+		PrNum:     prComment.prNum,
+	}
+
+	isAllowed := len(prComment.repoCfg.Maintainers) > 0 && h.checkAuthorPermission(ctx, client, prComment)
+	if !isAllowed {
+		prComment.outcome = util.AuditDenied
+		params.Comment = util.Message(util.MessageCommandNotAllowed, util.MessageData{Author: prComment.author, Command: "backfill", Maintainers: prComment.repoCfg.Maintainers})
+		if err := util.PostPullRequestComment(ctx, client, params); err != nil {
+			h.Logger.Errorf("Failed to post comment on PR %s/%s#%d: %v", prComment.repoOwner, prComment.repoName, prComment.prNum, err)
+			return err
+		}
+		return nil
+	}
+
+	options, err := util.ParseCommandOptions(prComment.args, []string{"limit", "dry-run"})
+	if err != nil {
+		return h.invalidOptions(ctx, client, prComment, "backfill", err)
+	}
+	limit, err := util.BackfillLimit(options)
+	if err != nil {
+		return h.invalidOptions(ctx, client, prComment, "backfill", err)
+	}
+	jobOptions := make(map[jobqueue.Field]string)
+	if err := util.ApplyDryRunOption(options, jobOptions); err != nil {
+		return h.invalidOptions(ctx, client, prComment, "backfill", err)
+	}
+	dryRun := jobOptions[jobqueue.FieldDryRun] == "true"
+
+	prs, err := h.backfillCandidates(ctx, client, prComment, limit)
+	if err != nil {
+		h.Logger.Errorf("Failed to list the PRs to backfill on %s/%s: %v", prComment.repoOwner, prComment.repoName, err)
+		return err
+	}
+
+	r := jobqueue.NewClient(h.RedisHostPort)
+	var group *jobqueue.Group
+	var issueURL string
+	if !dryRun && len(prs) > 0 {
+		if !h.claimComment(ctx, r, prComment) {
+			return nil
+		}
+		if declineOverQuota(ctx, h.Logger, client, r, prComment, "precheck", len(prs)) {
+			h.releaseComment(ctx, r, prComment)
+			return nil
+		}
+		// The outcomes are summarized in one issue rather than commented on every PR
+		var issue *github.Issue
+		group, issue, err = openGroupIssue(ctx, client, r, jobqueue.Group{
+			Title:          fmt.Sprintf("Precheck backfill of %d PRs requested by @%s in #%d", len(prs), prComment.author, prComment.prNum),
+			RepoOwner:      prComment.repoOwner,
+			RepoName:       prComment.repoName,
+			InstallationID: prComment.installID,
+		})
+		if err != nil {
+			h.Logger.Errorf("Failed to open the summary issue of the backfill on %s/%s, commenting the results on the PRs: %v", prComment.repoOwner, prComment.repoName, err)
+		} else {
+			issueURL = issue.GetHTMLURL()
+		}
+	}
+
+	items := make([]string, 0, len(prs))
+	for _, pr := range prs {
+		items = append(items, fmt.Sprintf("#%d %s", pr.GetNumber(), pr.GetTitle()))
+	}
+	params.Comment = util.Message(util.MessageBackfill, util.MessageData{Items: items, Duration: h.BackfillInterval.String(), URL: issueURL, DryRun: dryRun})
+	if err := util.PostPullRequestComment(ctx, client, params); err != nil {
+		h.Logger.Errorf("Failed to post comment on PR %s/%s#%d: %v", prComment.repoOwner, prComment.repoName, prComment.prNum, err)
+	}
+	if dryRun || len(prs) == 0 {
+		return nil
+	}
+
+	prComment.outcome = util.AuditQueued
+	// The webhook is answered long before the backfill is over
+	go h.runBackfill(context.Background(), client, *prComment, prs, group)
+	return nil
+}
+
+// backfillCandidates lists up to limit open PRs, oldest first, that have the required labels and
+// no precheck check run on their head. Draft PRs are left out.
+func (h *PRCommentHandler) backfillCandidates(ctx context.Context, client *github.Client, prComment *PRComment, limit int) ([]*github.PullRequest, error) {
+	var candidates []*github.PullRequest
+	opts := &github.PullRequestListOptions{
+		State:       "open",
+		Sort:        "created",
+		Direction:   "asc",
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	for {
+		prs, response, err := client.PullRequests.List(ctx, prComment.repoOwner, prComment.repoName, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, pr := range prs {
+			if pr.GetDraft() {
+				continue
+			}
+			if found, _ := util.CheckRequiredLabel(pr.Labels, prComment.repoCfg.RequiredLabels); !found {
+				continue
+			}
+			prechecked, err := util.CheckRunExists(ctx, client, prComment.repoOwner, prComment.repoName, pr.GetHead().GetSHA(), common.PrecheckCheck)
+			if err != nil {
+				return nil, err
+			}
+			if prechecked {
+				continue
+			}
+			candidates = append(candidates, pr)
+			if len(candidates) == limit {
+				return candidates, nil
+			}
+		}
+		if response.NextPage == 0 {
+			return candidates, nil
+		}
+		opts.Page = response.NextPage
+	}
+}
+
+// runBackfill prechecks the PRs on behalf of the author of the backfill comment, one every
+// BackfillInterval and only while the queue is below its capacity. A PR closed or prechecked
+// since it was listed is skipped. The jobs are added to the group, if any, whose summary lists
+// them as they are queued.
+func (h *PRCommentHandler) runBackfill(ctx context.Context, client *github.Client, prComment PRComment, prs []*github.PullRequest, group *jobqueue.Group) {
+	r := jobqueue.NewClient(h.RedisHostPort)
+	defer r.Close()
+
+	var jobOptions map[jobqueue.Field]string
+	if group != nil {
+		jobOptions = map[jobqueue.Field]string{jobqueue.FieldGroup: group.ID}
+	}
+
+	queued := 0
+	for i, listed := range prs {
+		if i > 0 {
+			time.Sleep(h.BackfillInterval)
+		}
+		h.waitQueueCapacity(ctx, r)
+
+		pr, _, err := client.PullRequests.Get(ctx, prComment.repoOwner, prComment.repoName, listed.GetNumber())
+		if err != nil {
+			h.Logger.Errorf("Failed to get PR %s/%s#%d to backfill: %v", prComment.repoOwner, prComment.repoName, listed.GetNumber(), err)
+			continue
+		}
+		if pr.GetState() != "open" {
+			continue
+		}
+		prechecked, err := util.CheckRunExists(ctx, client, prComment.repoOwner, prComment.repoName, pr.GetHead().GetSHA(), common.PrecheckCheck)
+		if err != nil || prechecked {
+			continue
+		}
+
+		job := &PRComment{
+			repoOwner:    prComment.repoOwner,
+			repoName:     prComment.repoName,
+			repoOrg:      prComment.repoOrg,
+			prNum:        pr.GetNumber(),
+			author:       prComment.author,
+			installID:    prComment.installID,
+			prSha:        pr.GetHead().GetSHA(),
+			baseRef:      pr.GetBase().GetRef(),
+			changedFiles: pr.GetChangedFiles(),
+			labels:       pr.Labels,
+			repoCfg:      prComment.repoCfg,
+		}
+		jobID, err := queuePrecheck(ctx, h.Logger, client, r, job, jobOptions, "Backfilling the precheck of the PR.")
+		if err != nil {
+			continue
+		}
+		queued++
+		h.Logger.Infof("Queued backfill precheck job %s for %s/%s#%d", jobID, job.repoOwner, job.repoName, job.prNum)
+		if group != nil {
+			if err := updateGroupSummary(ctx, client, r, group); err != nil {
+				h.Logger.Errorf("Failed to update the summary of group %s on %s/%s#%d: %v", group.ID, group.RepoOwner, group.RepoName, group.Issue, err)
+			}
+		}
+	}
+	h.Logger.Infof("Backfill requested on %s/%s#%d by %s is over, %d of %d PRs prechecked",
+		prComment.repoOwner, prComment.repoName, prComment.prNum, prComment.author, queued, len(prs))
+}
+
+// waitQueueCapacity waits while the queue holds as many jobs as the load shedding depth, so that
+// a backfill does not push the jobs requested on the PRs over capacity
+func (h *PRCommentHandler) waitQueueCapacity(ctx context.Context, r *jobqueue.Client) {
+	if h.LoadShedding.QueueDepth <= 0 {
+		return
+	}
+	for {
+		depth, err := r.LLen(ctx, jobqueue.QueueGenerate).Result()
+		if err != nil || depth < int64(h.LoadShedding.QueueDepth) {
+			return
+		}
+		time.Sleep(backfillCapacityWait)
+	}
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/instructlab/instructlab-bot/pkg/jobqueue"
+	"go.uber.org/zap"
+)
+
+const (
+	// deliveryTTL covers the window in which GitHub, or a maintainer, redelivers a webhook
+	deliveryTTL = 72 * time.Hour
+	// commentJobTTL keeps the jobs of a comment long after any redelivery could arrive
+	commentJobTTL = 30 * 24 * time.Hour
+)
+
+func deliveryKey(deliveryID string) string {
+	return fmt.Sprintf("deliveries:%s", deliveryID)
+}
+
+// commentJobKey is the job of a comment, the issue comments have no kind
+func commentJobKey(kind string, commentID int64) string {
+	if kind == "" {
+		kind = "comments"
+	}
+	return fmt.Sprintf("%s:%d:job", kind, commentID)
+}
+
+// handleOnce runs handle unless the webhook delivery was already processed. A failed delivery is
+// forgotten so that it can be redelivered. Redis errors let the delivery through rather than drop it.
+func handleOnce(ctx context.Context, redisHostPort string, logger *zap.SugaredLogger, eventType, deliveryID string, handle func() error) error {
+	if deliveryID == "" {
+		return handle()
+	}
+
+	r := jobqueue.NewClient(redisHostPort)
+	defer r.Close()
+
+	first, err := r.SetNX(ctx, deliveryKey(deliveryID), eventType, deliveryTTL).Result()
+	if err != nil {
+		logger.Errorf("Failed to record webhook delivery %s: %v", deliveryID, err)
+		return handle()
+	}
+	if !first {
+		logger.Infof("Skipping %s webhook delivery %s, it was already processed", eventType, deliveryID)
+		return nil
+	}
+
+	if err := handle(); err != nil {
+		if delErr := r.Del(context.Background(), deliveryKey(deliveryID)).Err(); delErr != nil {
+			logger.Errorf("Failed to forget failed webhook delivery %s: %v", deliveryID, delErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// claimComment makes sure a comment queues its job once, even when the same comment arrives in
+// distinct webhook deliveries. It reports the job already queued for the comment, if any.
+func claimComment(ctx context.Context, r *jobqueue.Client, kind string, commentID int64) (bool, string, error) {
+	if commentID == 0 {
+		return true, "", nil
+	}
+	first, err := r.SetNX(ctx, commentJobKey(kind, commentID), "queueing", commentJobTTL).Result()
+	if err != nil || first {
+		return first, "", err
+	}
+	job, _ := r.Client.Get(ctx, commentJobKey(kind, commentID)).Result()
+	return false, job, nil
+}
+
+// releaseComment drops the claim of a comment whose job could not be queued, so a redelivery can queue it
+func releaseComment(ctx context.Context, r *jobqueue.Client, kind string, commentID int64) error {
+	if commentID == 0 {
+		return nil
+	}
+	return r.Del(ctx, commentJobKey(kind, commentID)).Err()
+}
+
+// recordCommentJob replaces the claim of the comment with the job it queued
+func recordCommentJob(ctx context.Context, r *jobqueue.Client, kind string, commentID int64, job string) error {
+	if commentID == 0 {
+		return nil
+	}
+	return r.Client.Set(ctx, commentJobKey(kind, commentID), job, commentJobTTL).Err()
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/google/go-github/v61/github"
+	"github.com/instructlab/instructlab-bot/gobot/common"
+	"github.com/instructlab/instructlab-bot/gobot/util"
+	"github.com/instructlab/instructlab-bot/pkg/jobqueue"
+)
+
+// headSHATTL keeps the head of a PR long after its last jobs are likely to report
+const headSHATTL = 90 * 24 * time.Hour
+
+// recordHead records the new head of the PR, so that the results of the jobs run on an earlier
+// commit say so. On a push, the jobs of the PR no worker started yet are moved to the new head.
+func (h *PullRequestEventHandler) recordHead(ctx context.Context, client *github.Client, event *github.PullRequestEvent) {
+	r := jobqueue.NewClient(h.RedisHostPort)
+	defer r.Close()
+
+	pr := event.GetPullRequest()
+	repoOwner := event.GetRepo().GetOwner().GetLogin()
+	repoName := event.GetRepo().GetName()
+	prNumber := strconv.Itoa(pr.GetNumber())
+	headSha := pr.GetHead().GetSHA()
+	if err := r.Client.Set(ctx, jobqueue.HeadSHAKey(repoOwner, repoName, prNumber), headSha, headSHATTL).Err(); err != nil {
+		h.Logger.Errorf("Failed to record the head of PR %s/%s#%s: %v", repoOwner, repoName, prNumber, err)
+	}
+	if event.GetAction() != "synchronize" || !h.RetargetOnPush {
+		return
+	}
+
+	queued, err := r.Queued(ctx)
+	if err != nil {
+		h.Logger.Errorf("Failed to list the queued jobs of PR %s/%s#%s: %v", repoOwner, repoName, prNumber, err)
+		return
+	}
+	deferred, err := r.Deferred(ctx)
+	if err != nil {
+		h.Logger.Errorf("Failed to list the deferred jobs of PR %s/%s#%s: %v", repoOwner, repoName, prNumber, err)
+		return
+	}
+	for _, jobID := range append(queued, deferred...) {
+		if !jobOfPR(ctx, r, jobID, repoOwner, repoName, prNumber) {
+			continue
+		}
+		// The stages of a pipeline build on each other, they keep the commit they were queued for
+		if pipelineID, _ := r.Get(ctx, jobID, jobqueue.FieldPipelineID); pipelineID != "" {
+			continue
+		}
+		prSha, err := r.Get(ctx, jobID, jobqueue.FieldPRSHA)
+		if err != nil || prSha == "" || prSha == headSha {
+			continue
+		}
+		retargeted, err := r.Retarget(ctx, jobID, headSha)
+		if err != nil {
+			h.Logger.Errorf("Failed to move job %s of PR %s/%s#%s to commit %s: %v", jobID, repoOwner, repoName, prNumber, headSha, err)
+			continue
+		}
+		if !retargeted {
+			continue
+		}
+		h.Logger.Infof("Moved queued job %s of PR %s/%s#%s from commit %s to the new head %s", jobID, repoOwner, repoName, prNumber, prSha, headSha)
+		h.moveJobCheck(ctx, client, r, jobID, pr.GetNumber(), repoOwner, repoName, prSha, headSha)
+	}
+}
+
+// jobOfPR reports whether the job was queued for the PR
+func jobOfPR(ctx context.Context, r *jobqueue.Client, jobID, repoOwner, repoName, prNumber string) bool {
+	if number, _ := r.Get(ctx, jobID, jobqueue.FieldPRNumber); number != prNumber {
+		return false
+	}
+	owner, _ := r.Get(ctx, jobID, jobqueue.FieldRepoOwner)
+	name, _ := r.Get(ctx, jobID, jobqueue.FieldRepoName)
+	return owner == repoOwner && name == repoName
+}
+
+// moveJobCheck skips the check run of a job moved to the new head of its PR on the commit it was
+// queued for, and starts one on the new head
+func (h *PullRequestEventHandler) moveJobCheck(ctx context.Context, client *github.Client, r *jobqueue.Client, jobID string, prNum int, repoOwner, repoName, prSha, headSha string) {
+	jobType, _ := r.Get(ctx, jobID, jobqueue.FieldJobType)
+	params := util.PullRequestStatusParams{
+		Status:       common.CheckComplete,
+		Conclusion:   common.CheckStatusSkipped,
+		CheckName:    jobCheckName(jobType),
+		CheckSummary: fmt.Sprintf("Job ID: %s was moved to commit %s, pushed while it was queued.", jobID, headSha),
+		JobType:      jobType,
+		JobID:        jobID,
+		RepoOwner:    repoOwner,
+		RepoName:     repoName,
+		PrNum:        prNum,
+		PrSha:        prSha,
+	}
+	if params.CheckName == "" {
+		return
+	}
+	if err := util.PostPullRequestCheck(ctx, client, params); err != nil {
+		h.Logger.Errorf("Failed to skip the check of job %s on PR %s/%s#%d: %v", jobID, repoOwner, repoName, prNum, err)
+	}
+	params.Status = common.CheckInProgress
+	params.Conclusion = ""
+	params.CheckSummary = fmt.Sprintf("Job ID: %s - Queued, moved from commit %s.", jobID, prSha)
+	params.PrSha = headSha
+	if err := util.PostPullRequestCheck(ctx, client, params); err != nil {
+		h.Logger.Errorf("Failed to post the check of job %s on PR %s/%s#%d: %v", jobID, repoOwner, repoName, prNum, err)
+	}
+}
+
+// jobCheckName is the check run reporting the jobs of the job type, "" for an unknown type
+func jobCheckName(jobType string) string {
+	switch jobType {
+	case "generate":
+		return common.GenerateLocalCheck
+	case "precheck":
+		return common.PrecheckCheck
+	case "sdg-svc":
+		return common.GenerateSDGCheck
+	case "train":
+		return common.TrainCheck
+	case "evaluate":
+		return common.EvaluateCheck
+	}
+	return ""
+}
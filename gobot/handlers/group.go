@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-github/v61/github"
+	"github.com/instructlab/instructlab-bot/gobot/util"
+	"github.com/instructlab/instructlab-bot/pkg/jobqueue"
+	"github.com/palantir/go-githubapp/githubapp"
+	"go.uber.org/zap"
+)
+
+// openGroupIssue opens an issue holding the summary of a new group of jobs in its body, and
+// records the group with it
+func openGroupIssue(ctx context.Context, client *github.Client, r *jobqueue.Client, g jobqueue.Group) (*jobqueue.Group, *github.Issue, error) {
+	body := util.Message(util.MessageGroupSummary, util.MessageData{Title: g.Title, Summary: util.GroupSummaryTable(nil)})
+	issue, _, err := client.Issues.Create(ctx, g.RepoOwner, g.RepoName, &github.IssueRequest{Title: github.String(g.Title), Body: &body})
+	if err != nil {
+		return nil, nil, err
+	}
+	g.Issue = issue.GetNumber()
+	if g.ID, err = r.NewGroup(ctx, g); err != nil {
+		return nil, nil, err
+	}
+	return &g, issue, nil
+}
+
+// postGroupComment posts the summary of a new group of jobs as a comment on its existing issue,
+// and records the group with it
+func postGroupComment(ctx context.Context, client *github.Client, r *jobqueue.Client, g jobqueue.Group) (*jobqueue.Group, error) {
+	body := util.Message(util.MessageGroupSummary, util.MessageData{Title: g.Title, Summary: util.GroupSummaryTable(nil)})
+	comment, _, err := client.Issues.CreateComment(ctx, g.RepoOwner, g.RepoName, g.Issue, &github.IssueComment{Body: &body})
+	if err != nil {
+		return nil, err
+	}
+	g.Comment = comment.GetID()
+	if g.ID, err = r.NewGroup(ctx, g); err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+// groupSummaryRows reads the outcome of every job of the group
+func groupSummaryRows(ctx context.Context, r *jobqueue.Client, groupID string) ([]util.GroupSummaryRow, error) {
+	jobs, err := r.GroupJobs(ctx, groupID)
+	if err != nil {
+		return nil, err
+	}
+	rows := make([]util.GroupSummaryRow, 0, len(jobs))
+	for _, jobID := range jobs {
+		get := func(field jobqueue.Field) string {
+			value, _ := r.Get(ctx, jobID, field)
+			return value
+		}
+		row := util.GroupSummaryRow{JobID: jobID, JobType: get(jobqueue.FieldJobType), Status: get(jobqueue.FieldStatus)}
+		if prNumber := get(jobqueue.FieldPRNumber); prNumber != "" {
+			row.Subject = "#" + prNumber
+		} else if branch := get(jobqueue.FieldBranch); branch != "" {
+			row.Subject = fmt.Sprintf("`%s` (%s)", branch, get(jobqueue.FieldSchedule))
+		}
+		switch row.Status {
+		case jobqueue.StatusSuccess:
+			row.URL = get(jobqueue.FieldS3URL)
+		case jobqueue.StatusError:
+			row.URL = get(jobqueue.FieldFailedURL)
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// updateGroupSummary renders the summary of the group from the outcomes of its jobs and updates
+// the issue body or the comment holding it
+func updateGroupSummary(ctx context.Context, client *github.Client, r *jobqueue.Client, g *jobqueue.Group) error {
+	rows, err := groupSummaryRows(ctx, r, g.ID)
+	if err != nil {
+		return err
+	}
+	body := util.Message(util.MessageGroupSummary, util.MessageData{Title: g.Title, Summary: util.GroupSummaryTable(rows)})
+	if g.Comment != 0 {
+		_, _, err = client.Issues.EditComment(ctx, g.RepoOwner, g.RepoName, g.Comment, &github.IssueComment{Body: &body})
+		return err
+	}
+	_, _, err = client.Issues.Edit(ctx, g.RepoOwner, g.RepoName, g.Issue, &github.IssueRequest{Body: &body})
+	return err
+}
+
+// UpdateGroupSummary updates the summary of a group of jobs once one of them reported
+func UpdateGroupSummary(ctx context.Context, r *jobqueue.Client, logger *zap.SugaredLogger, cc githubapp.ClientCreator, groupID string) {
+	g, err := r.Group(ctx, groupID)
+	if err != nil || g == nil {
+		if err != nil {
+			logger.Errorf("Failed to read group %s: %v", groupID, err)
+		}
+		return
+	}
+	client, err := cc.NewInstallationClient(g.InstallationID)
+	if err != nil {
+		logger.Errorf("Failed to create installation client: %v", err)
+		return
+	}
+	if err := updateGroupSummary(ctx, client, r, g); err != nil {
+		logger.Errorf("Failed to update the summary of group %s on %s/%s#%d: %v", groupID, g.RepoOwner, g.RepoName, g.Issue, err)
+	}
+}
+
+// addToGroup adds a job to the group of its options before it is queued, so that its outcome is
+// only reported in the summary of the group
+func addToGroup(ctx context.Context, r *jobqueue.Client, jobOptions map[jobqueue.Field]string, jobID string) error {
+	groupID := jobOptions[jobqueue.FieldGroup]
+	if groupID == "" {
+		return nil
+	}
+	return r.AddToGroup(ctx, groupID, jobID)
+}
@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-github/v61/github"
+	"github.com/instructlab/instructlab-bot/gobot/common"
+	"github.com/instructlab/instructlab-bot/gobot/util"
+	"github.com/instructlab/instructlab-bot/pkg/jobqueue"
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	onboardingIssueTitle = "Welcome to the InstructLab bot"
+	// onboardingLabelColor is the color of the labels the bot creates
+	onboardingLabelColor = "ededed"
+)
+
+func onboardingKey(repoOwner, repoName string) string {
+	return fmt.Sprintf("onboarding:%s/%s", repoOwner, repoName)
+}
+
+// InstallationEventHandler onboards the repositories the app is installed on: it creates the
+// labels the bot needs and opens an issue describing the commands and the setup of the repository
+type InstallationEventHandler struct {
+	githubapp.ClientCreator
+	Logger         *zap.SugaredLogger
+	RedisHostPort  string
+	RequiredLabels []string
+	BotUsername    string
+	Maintainers    []string
+	RepoConfigs    util.RepoConfigs
+	RepoFiles      *util.RepoFiles
+}
+
+func (h *InstallationEventHandler) Handles() []string {
+	return []string{"installation", "installation_repositories"}
+}
+
+func (h *InstallationEventHandler) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	return handleOnce(ctx, h.RedisHostPort, h.Logger, eventType, deliveryID, func() error {
+		return h.handle(ctx, eventType, payload)
+	})
+}
+
+func (h *InstallationEventHandler) handle(ctx context.Context, eventType string, payload []byte) error {
+	var installID int64
+	var repos []*github.Repository
+	switch eventType {
+	case "installation":
+		var event github.InstallationEvent
+		if err := json.Unmarshal(payload, &event); err != nil {
+			return errors.Wrap(err, "failed to parse installation event payload")
+		}
+		if event.GetAction() != "created" {
+			return nil
+		}
+		installID, repos = event.GetInstallation().GetID(), event.Repositories
+	case "installation_repositories":
+		var event github.InstallationRepositoriesEvent
+		if err := json.Unmarshal(payload, &event); err != nil {
+			return errors.Wrap(err, "failed to parse installation repositories event payload")
+		}
+		if event.GetAction() != "added" {
+			return nil
+		}
+		installID, repos = event.GetInstallation().GetID(), event.RepositoriesAdded
+	default:
+		return nil
+	}
+
+	client, err := h.NewInstallationClient(installID)
+	if err != nil {
+		h.Logger.Errorf("Failed to create installation client: %v", err)
+		return err
+	}
+	r := jobqueue.NewClient(h.RedisHostPort)
+	defer r.Close()
+
+	var failed []string
+	for _, repo := range repos {
+		// The repositories of installation events only carry their full name
+		repoOwner, repoName, ok := strings.Cut(repo.GetFullName(), "/")
+		if !ok {
+			continue
+		}
+		if err := h.onboard(ctx, r, client, repoOwner, repoName); err != nil {
+			h.Logger.Errorf("Failed to onboard %s/%s: %v", repoOwner, repoName, err)
+			failed = append(failed, repo.GetFullName())
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to onboard %v", failed)
+	}
+	return nil
+}
+
+// onboard creates the missing labels of a repository the bot serves and opens the welcome
+// issue, once per repository even when the app is installed again
+func (h *InstallationEventHandler) onboard(ctx context.Context, r *jobqueue.Client, client *github.Client, repoOwner, repoName string) error {
+	repoCfg, ok := h.RepoConfigs.Lookup(repoOwner, repoName, common.RepoName,
+		util.RepoConfig{RequiredLabels: h.RequiredLabels, Maintainers: h.Maintainers})
+	if !ok {
+		h.Logger.Infof("The app was installed on %s/%s, which the bot does not serve", repoOwner, repoName)
+		return nil
+	}
+
+	first, err := r.SetNX(ctx, onboardingKey(repoOwner, repoName), "onboarding", 0).Result()
+	if err != nil {
+		h.Logger.Errorf("Failed to claim the onboarding of %s/%s, onboarding anyway: %v", repoOwner, repoName, err)
+	} else if !first {
+		h.Logger.Infof("%s/%s was already onboarded", repoOwner, repoName)
+		return nil
+	}
+
+	var setup []string
+	repoCfg, fileStatus := h.repoFileStatus(ctx, client, repoOwner, repoName, repoCfg)
+	setup = append(setup, fileStatus)
+
+	for _, label := range onboardingLabels(repoCfg) {
+		created, err := util.EnsureLabel(ctx, client, repoOwner, repoName, label.Name, onboardingLabelColor, label.Description)
+		switch {
+		case err != nil:
+			h.Logger.Errorf("Failed to create the %s label of %s/%s: %v", label.Name, repoOwner, repoName, err)
+			setup = append(setup, fmt.Sprintf("❌ The `%s` label could not be created: %v", label.Name, err))
+		case created:
+			setup = append(setup, fmt.Sprintf("🆕 Created the `%s` label", label.Name))
+		default:
+			setup = append(setup, fmt.Sprintf("✅ The `%s` label exists", label.Name))
+		}
+	}
+
+	body := util.Message(util.MessageInstalled, util.MessageData{
+		BotName: h.BotUsername,
+		Help:    util.BotCommandsHelp(h.BotUsername, repoCfg.Maintainers),
+		Items:   setup,
+	})
+	issue, _, err := client.Issues.Create(ctx, repoOwner, repoName, &github.IssueRequest{
+		Title: github.String(onboardingIssueTitle),
+		Body:  github.String(body),
+	})
+	if err != nil {
+		if delErr := r.Del(ctx, onboardingKey(repoOwner, repoName)).Err(); delErr != nil {
+			h.Logger.Errorf("Failed to forget the onboarding of %s/%s: %v", repoOwner, repoName, delErr)
+		}
+		return fmt.Errorf("could not open the welcome issue: %w", err)
+	}
+	h.Logger.Infof("Onboarded %s/%s in issue #%d", repoOwner, repoName, issue.GetNumber())
+	return nil
+}
+
+type onboardingLabel struct {
+	Name        string
+	Description string
+}
+
+// onboardingLabels are the labels the bot needs in the repository
+func onboardingLabels(repoCfg util.RepoConfig) []onboardingLabel {
+	var labels []onboardingLabel
+	for _, name := range repoCfg.RequiredLabels {
+		labels = append(labels, onboardingLabel{Name: name, Description: "PRs the bot runs its commands on"})
+	}
+	if repoCfg.Policy.Label != "" {
+		labels = append(labels, onboardingLabel{Name: repoCfg.Policy.Label, Description: "PRs passing the merge policy of the bot"})
+	}
+	return labels
+}
+
+// repoFileStatus applies the repository file and describes it for the welcome issue
+func (h *InstallationEventHandler) repoFileStatus(ctx context.Context, client *github.Client, repoOwner, repoName string, repoCfg util.RepoConfig) (util.RepoConfig, string) {
+	if h.RepoFiles == nil {
+		return repoCfg, fmt.Sprintf("ℹ️ No `%s` is read, the bot uses its own settings", util.RepoFileName)
+	}
+	file, err := h.RepoFiles.Get(ctx, client, repoOwner, repoName)
+	switch {
+	case err != nil:
+		return repoCfg, fmt.Sprintf("❌ `%s` is ignored: %v", util.RepoFileName, err)
+	case !file.Found:
+		return repoCfg, fmt.Sprintf("ℹ️ There is no `%s`, add one to the default branch to tune the bot", util.RepoFileName)
+	}
+	repoCfg = repoCfg.WithRepoFile(file)
+	return repoCfg, fmt.Sprintf("✅ `%s` is valid, the enabled commands are %v", util.RepoFileName, repoCfg.Commands())
+}
@@ -8,10 +8,10 @@ import (
 	"strings"
 	"time"
 
-	"github.com/go-redis/redis/v8"
 	"github.com/google/go-github/v61/github"
 	"github.com/instructlab/instructlab-bot/gobot/common"
 	"github.com/instructlab/instructlab-bot/gobot/util"
+	"github.com/instructlab/instructlab-bot/pkg/jobqueue"
 	"github.com/palantir/go-githubapp/githubapp"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
@@ -31,7 +31,18 @@ type PRCommentHandler struct {
 	RedisHostPort  string
 	RequiredLabels []string
 	BotUsername    string
-	Maintainers    []string
+	// CommandTriggers are the mention aliases and slash commands accepted besides BotUsername
+	CommandTriggers []string
+	// HandleEdits runs the command of an edited comment whose previous body had none
+	HandleEdits bool
+	Maintainers []string
+	RepoConfigs util.RepoConfigs
+	RepoFiles   *util.RepoFiles
+	AuditLog    *util.AuditLog
+	// LoadShedding rejects or defers the low priority jobs while the queue is over capacity
+	LoadShedding util.LoadShedding
+	// BackfillInterval spaces the prechecks queued by the backfill command
+	BackfillInterval time.Duration
 }
 
 type PRComment struct {
@@ -39,48 +50,166 @@ type PRComment struct {
 	repoName  string
 	repoOrg   string
 	prNum     int
-	author    string
-	body      string
-	installID int64
-	prSha     string
-	labels    []*github.Label
+	// commentKind and commentID identify the comment, a review or a review comment
+	commentKind string
+	commentID   int64
+	author      string
+	body        string
+	installID   int64
+	prSha       string
+	baseRef     string
+	labels      []*github.Label
+	repoCfg     util.RepoConfig
+	args        []string
+	// changedFiles is the number of files changed by the PR, the completion of its jobs is estimated from it
+	changedFiles int
+	// jobOptions are the validated command options, stored as keys of the queued job
+	jobOptions map[jobqueue.Field]string
+	// outcome and jobIDs are what the command came to, for the audit log
+	outcome string
+	jobIDs  []string
 }
 
 func (h *PRCommentHandler) Handles() []string {
-	// PR comments come in as issue comments, not an independent event type.
-	return []string{"issue_comment"}
+	// PR comments come in as issue comments, not an independent event type. Reviews and review
+	// comments have their own events.
+	return []string{"issue_comment", "pull_request_review", "pull_request_review_comment"}
 }
 
 func (h *PRCommentHandler) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	return handleOnce(ctx, h.RedisHostPort, h.Logger, eventType, deliveryID, func() error {
+		return h.handle(ctx, eventType, payload)
+	})
+}
+
+// commentEvent is a comment of a PR that may hold a bot command: an issue comment, the body of a
+// review or a review comment
+type commentEvent struct {
+	action       string
+	repo         *github.Repository
+	org          string
+	prNum        int
+	kind         string
+	id           int64
+	author       string
+	body         string
+	previousBody string
+	installID    int64
+}
+
+// The kinds of comments, their IDs are unique within a kind only
+const (
+	commentKindIssue         = ""
+	commentKindReview        = "reviews"
+	commentKindReviewComment = "review_comments"
+)
+
+// parseCommentEvent reads the comment of the event. It returns false for the issue comments that
+// are not on a PR.
+func parseCommentEvent(eventType string, payload []byte) (commentEvent, bool, error) {
+	switch eventType {
+	case "pull_request_review":
+		var event github.PullRequestReviewEvent
+		if err := json.Unmarshal(payload, &event); err != nil {
+			return commentEvent{}, false, errors.Wrap(err, "failed to parse pull request review event payload")
+		}
+		// A submitted review reads like a new comment
+		action := event.GetAction()
+		if action == "submitted" {
+			action = "created"
+		}
+		return commentEvent{
+			action:    action,
+			repo:      event.GetRepo(),
+			org:       event.GetOrganization().GetLogin(),
+			prNum:     event.GetPullRequest().GetNumber(),
+			kind:      commentKindReview,
+			id:        event.GetReview().GetID(),
+			author:    event.GetReview().GetUser().GetLogin(),
+			body:      event.GetReview().GetBody(),
+			installID: githubapp.GetInstallationIDFromEvent(&event),
+		}, true, nil
+	case "pull_request_review_comment":
+		var event github.PullRequestReviewCommentEvent
+		if err := json.Unmarshal(payload, &event); err != nil {
+			return commentEvent{}, false, errors.Wrap(err, "failed to parse pull request review comment event payload")
+		}
+		return commentEvent{
+			action:       event.GetAction(),
+			repo:         event.GetRepo(),
+			org:          event.GetOrg().GetLogin(),
+			prNum:        event.GetPullRequest().GetNumber(),
+			kind:         commentKindReviewComment,
+			id:           event.GetComment().GetID(),
+			author:       event.GetComment().GetUser().GetLogin(),
+			body:         event.GetComment().GetBody(),
+			previousBody: event.GetChanges().GetBody().GetFrom(),
+			installID:    githubapp.GetInstallationIDFromEvent(&event),
+		}, true, nil
+	}
+
 	var event github.IssueCommentEvent
 	if err := json.Unmarshal(payload, &event); err != nil {
-		return errors.Wrap(err, "failed to parse issue comment event payload")
+		return commentEvent{}, false, errors.Wrap(err, "failed to parse issue comment event payload")
+	}
+	if !event.GetIssue().IsPullRequest() {
+		return commentEvent{}, false, nil
 	}
+	return commentEvent{
+		action:       event.GetAction(),
+		repo:         event.GetRepo(),
+		org:          event.GetOrganization().GetLogin(),
+		prNum:        event.GetIssue().GetNumber(),
+		kind:         commentKindIssue,
+		id:           event.GetComment().GetID(),
+		author:       event.GetComment().GetUser().GetLogin(),
+		body:         event.GetComment().GetBody(),
+		previousBody: event.GetChanges().GetBody().GetFrom(),
+		installID:    githubapp.GetInstallationIDFromEvent(&event),
+	}, true, nil
+}
 
-	if event.GetRepo().GetName() != common.RepoName {
-		h.Logger.Warnf("Received unexpected event %s from %s/%s repo. Skipping the event.",
-			eventType, event.GetOrganization().GetLogin(), event.GetRepo().GetName())
-		return nil
+func (h *PRCommentHandler) handle(ctx context.Context, eventType string, payload []byte) error {
+	event, ok, err := parseCommentEvent(eventType, payload)
+	if err != nil || !ok {
+		return err
 	}
 
-	if !event.GetIssue().IsPullRequest() {
+	repoCfg, ok := h.RepoConfigs.Lookup(event.repo.GetOwner().GetLogin(), event.repo.GetName(),
+		common.RepoName, util.RepoConfig{RequiredLabels: h.RequiredLabels, Maintainers: h.Maintainers})
+	if !ok {
+		h.Logger.Warnf("Received unexpected event %s from %s/%s repo. Skipping the event.",
+			eventType, event.org, event.repo.GetName())
 		return nil
 	}
 
-	if event.GetAction() != "created" {
+	switch event.action {
+	case "created":
+	case "edited":
+		if !h.HandleEdits || !h.editAddsCommand(event) {
+			return nil
+		}
+	default:
 		return nil
 	}
 
-	h.Logger.Debugf("Details of the event: %v", event)
-	repo := event.GetRepo()
+	h.Logger.Debugf("Details of the %s event: %+v", eventType, event)
 	prComment := PRComment{
-		repoOwner: repo.GetOwner().GetLogin(),
-		repoName:  repo.GetName(),
-		repoOrg:   event.GetOrganization().GetLogin(),
-		prNum:     event.GetIssue().GetNumber(),
-		author:    event.GetComment().GetUser().GetLogin(),
-		body:      event.GetComment().GetBody(),
-		installID: githubapp.GetInstallationIDFromEvent(&event),
+		repoOwner:   event.repo.GetOwner().GetLogin(),
+		repoName:    event.repo.GetName(),
+		repoOrg:     event.org,
+		prNum:       event.prNum,
+		commentKind: event.kind,
+		commentID:   event.id,
+		author:      event.author,
+		body:        event.body,
+		installID:   event.installID,
+		repoCfg:     repoCfg,
+	}
+
+	trigger, args := util.FindCommand(prComment.body, h.commandTriggers())
+	if trigger == "" {
+		return nil
 	}
 
 	client, err := h.NewInstallationClient(prComment.installID)
@@ -88,25 +217,55 @@ func (h *PRCommentHandler) Handle(ctx context.Context, eventType, deliveryID str
 		h.Logger.Errorf("Failed to create installation client: %v", err)
 		return err
 	}
-	words := strings.Fields(strings.TrimSpace(prComment.body))
-	if len(words) < 2 {
-		return nil
-	}
-	if words[0] == DeprecatedBotUsername {
+	if trigger == DeprecatedBotUsername {
 		params := util.PullRequestStatusParams{
 			RepoOwner: prComment.repoOwner,
 			RepoName:  prComment.repoName,
 			PrNum:     prComment.prNum,
 		}
-		params.Comment = fmt.Sprintf("> [!WARNING] \n > Beep, boop 🤖, The bot username `%s` is going to"+
-			" be deprecated soon. Please use `%s` instead.", DeprecatedBotUsername, h.BotUsername)
+		params.Comment = util.Message(util.MessageDeprecatedUsername, util.MessageData{OldBotName: DeprecatedBotUsername, BotName: h.BotUsername})
 		if err := util.PostPullRequestComment(ctx, client, params); err != nil {
 			h.Logger.Errorf("Failed to post pull request comment: %v", err)
 		}
-	} else if words[0] != h.BotUsername {
-		return nil
 	}
+	prComment.args = args[1:]
+
+	err = h.runCommand(ctx, client, &prComment, args[0])
+	h.audit(ctx, &prComment, args[0], err)
+	return err
+}
+
+// editAddsCommand reports whether an edit turned a comment without a valid command into one with
+// a valid command, like a fixed typo. The edits of a valid command are left alone, its command
+// ran with the original delivery.
+func (h *PRCommentHandler) editAddsCommand(event commentEvent) bool {
+	triggers := h.commandTriggers()
+	_, before := util.FindCommand(event.previousBody, triggers)
+	_, after := util.FindCommand(event.body, triggers)
+	return !(len(before) > 0 && isBotCommand(before[0])) && len(after) > 0 && isBotCommand(after[0])
+}
+
+// isBotCommand reports whether the bot knows command
+func isBotCommand(command string) bool {
+	switch command {
+	case "help", "enable", "quota", "backfill":
+		return true
+	}
+	for _, known := range util.BotCommands {
+		if command == known {
+			return true
+		}
+	}
+	return false
+}
+
+// commandTriggers are the words starting a bot command: the bot mention, its deprecated name and
+// the configured aliases and slash commands
+func (h *PRCommentHandler) commandTriggers() []string {
+	return append([]string{h.BotUsername, DeprecatedBotUsername}, h.CommandTriggers...)
+}
 
+func (h *PRCommentHandler) runCommand(ctx context.Context, client *github.Client, prComment *PRComment, command string) error {
 	// Fetch the PR sha and labels to avoid multiple Pull Request API calls
 	pr, _, err := client.PullRequests.Get(ctx, prComment.repoOwner, prComment.repoName, prComment.prNum)
 	if err != nil {
@@ -115,113 +274,205 @@ func (h *PRCommentHandler) Handle(ctx context.Context, eventType, deliveryID str
 	}
 
 	prComment.prSha = pr.GetHead().GetSHA()
+	prComment.baseRef = pr.GetBase().GetRef()
+	prComment.changedFiles = pr.GetChangedFiles()
 	prComment.labels = pr.Labels
+	prComment.repoCfg = withRepoFile(ctx, h.Logger, h.RepoFiles, client, prComment.repoOwner, prComment.repoName, prComment.repoCfg)
 
-	switch words[1] {
+	// The backfill queues prechecks, it is allowed where precheck is
+	if command == "backfill" && !prComment.repoCfg.CommandAllowed("precheck") {
+		return h.disabledCommand(ctx, client, prComment, "precheck")
+	}
+	if command != "help" && command != "quota" && command != "backfill" && !prComment.repoCfg.CommandAllowed(command) {
+		return h.disabledCommand(ctx, client, prComment, command)
+	}
+
+	switch command {
 	case "help":
-		return h.helpCommand(ctx, client, &prComment)
+		return h.helpCommand(ctx, client, prComment)
 	case "enable":
-		return h.enableCommand(ctx, client, &prComment)
+		return h.enableCommand(ctx, client, prComment)
 	case "generate-local":
-		return h.generateCommand(ctx, client, &prComment)
+		return h.generateCommand(ctx, client, prComment)
 	case "precheck":
-		return h.precheckCommand(ctx, client, &prComment)
+		return h.precheckCommand(ctx, client, prComment)
 	case "generate":
-		return h.sdgSvcCommand(ctx, client, &prComment)
+		return h.sdgSvcCommand(ctx, client, prComment)
+	case "train":
+		return h.trainCommand(ctx, client, prComment)
+	case "evaluate":
+		return h.evaluateCommand(ctx, client, prComment)
+	case "e2e":
+		return h.e2eCommand(ctx, client, prComment)
+	case "quota":
+		return h.quotaCommand(ctx, client, prComment)
+	case "backfill":
+		return h.backfillCommand(ctx, client, prComment)
 	default:
-		return h.unknownCommand(ctx, client, &prComment)
+		return h.unknownCommand(ctx, client, prComment)
 	}
 }
 
-func setJobKey(r *redis.Client, jobNumber int64, key string, value interface{}) error {
-	return r.Set(context.Background(), "jobs:"+strconv.FormatInt(jobNumber, 10)+":"+key, value, 0).Err()
-}
-
-func (h *PRCommentHandler) queueGenerateJob(ctx context.Context, client *github.Client, prComment *PRComment, jobType string) error {
-	r := redis.NewClient(&redis.Options{
-		Addr:     h.RedisHostPort,
-		Password: "", // no password set
-		DB:       0,  // use default DB
-	})
-
-	jobNumber, err := r.Incr(ctx, common.RedisKeyJobs).Result()
-	if err != nil {
-		return err
+// audit appends the command to the audit log, with the outcome its handler left on the comment
+func (h *PRCommentHandler) audit(ctx context.Context, prComment *PRComment, command string, err error) {
+	record := util.AuditRecord{
+		Time:      time.Now(),
+		User:      prComment.author,
+		Repo:      prComment.repoOwner + "/" + prComment.repoName,
+		PR:        prComment.prNum,
+		CommentID: prComment.commentID,
+		Command:   command,
+		Args:      prComment.args,
+		Outcome:   prComment.outcome,
+		JobIDs:    prComment.jobIDs,
 	}
-
-	err = setJobKey(r, jobNumber, common.RedisKeyPRNumber, prComment.prNum)
 	if err != nil {
-		return err
+		record.Error = err.Error()
+		if record.Outcome == "" {
+			record.Outcome = util.AuditFailed
+		}
 	}
-
-	err = setJobKey(r, jobNumber, common.RedisKeyPRSHA, prComment.prSha)
-	if err != nil {
-		return err
+	if record.Outcome == "" {
+		record.Outcome = util.AuditAnswered
 	}
-
-	err = setJobKey(r, jobNumber, common.RedisKeyAuthor, prComment.author)
-	if err != nil {
-		return err
+	if err := h.AuditLog.Record(ctx, record); err != nil {
+		h.Logger.Errorf("Failed to record the %s command of %s on %s in the audit log: %v", command, record.User, record.Repo, err)
 	}
+}
 
-	err = setJobKey(r, jobNumber, common.RedisKeyInstallationID, prComment.installID)
-	if err != nil {
-		return err
+// createJob stores a job of jobType for the PR without queueing it and returns its ID
+func createJob(ctx context.Context, r *jobqueue.Client, prComment *PRComment, jobType string, jobOptions map[jobqueue.Field]string) (string, error) {
+	fields := map[jobqueue.Field]interface{}{
+		jobqueue.FieldAuthor:         prComment.author,
+		jobqueue.FieldInstallationID: prComment.installID,
+		jobqueue.FieldRepoOwner:      prComment.repoOwner,
+		jobqueue.FieldRepoName:       prComment.repoName,
+		jobqueue.FieldJobType:        jobType,
+		jobqueue.FieldErrors:         "",
+		jobqueue.FieldStatus:         jobqueue.StatusPending,
+		jobqueue.FieldRequestTime:    strconv.FormatInt(time.Now().Unix(), 10),
+		jobqueue.FieldGitRemote:      prComment.repoCfg.GitRemote,
+		jobqueue.FieldS3Prefix:       prComment.repoCfg.S3Prefix,
+		jobqueue.FieldBotVersion:     common.VersionString(),
 	}
-
-	err = setJobKey(r, jobNumber, common.RedisKeyRepoOwner, prComment.repoOwner)
-	if err != nil {
-		return err
+	// Scheduled jobs run against a branch and have no PR
+	if prComment.prNum > 0 {
+		fields[jobqueue.FieldPRNumber] = prComment.prNum
+		fields[jobqueue.FieldPRSHA] = prComment.prSha
+		if prComment.baseRef != "" {
+			fields[jobqueue.FieldBaseRef] = prComment.baseRef
+		}
 	}
-
-	err = setJobKey(r, jobNumber, common.RedisKeyRepoName, prComment.repoName)
-	if err != nil {
-		return err
+	if prComment.changedFiles > 0 {
+		fields[jobqueue.FieldChangedFiles] = prComment.changedFiles
+	}
+	// The results of a command in a review comment are replied in its thread
+	if prComment.commentKind == commentKindReviewComment && prComment.commentID != 0 {
+		fields[jobqueue.FieldReplyTo] = prComment.commentID
 	}
+	if prComment.repoCfg.NumInstructions > 0 && (jobType == "generate" || jobType == "sdg-svc") {
+		fields[jobqueue.FieldNumInstructions] = prComment.repoCfg.NumInstructions
+	}
+	for field, value := range jobOptions {
+		fields[field] = value
+	}
+	return r.NewJob(ctx, fields)
+}
 
-	err = setJobKey(r, jobNumber, common.RedisKeyJobType, jobType)
+// claimComment reports whether the comment may queue its job, a comment delivered twice only queues one
+func (h *PRCommentHandler) claimComment(ctx context.Context, r *jobqueue.Client, prComment *PRComment) bool {
+	claimed, job, err := claimComment(ctx, r, prComment.commentKind, prComment.commentID)
 	if err != nil {
-		return err
+		h.Logger.Errorf("Failed to claim comment %d, queueing anyway: %v", prComment.commentID, err)
+		return true
+	}
+	if !claimed {
+		prComment.outcome = util.AuditDuplicate
+		h.Logger.Infof("Comment %d on %s/%s#%d already queued job %s, skipping",
+			prComment.commentID, prComment.repoOwner, prComment.repoName, prComment.prNum, job)
 	}
+	return claimed
+}
 
-	err = setJobKey(r, jobNumber, common.RedisKeyErrors, "")
-	if err != nil {
-		return err
+func (h *PRCommentHandler) releaseComment(ctx context.Context, r *jobqueue.Client, prComment *PRComment) {
+	if err := releaseComment(ctx, r, prComment.commentKind, prComment.commentID); err != nil {
+		h.Logger.Errorf("Failed to release comment %d: %v", prComment.commentID, err)
 	}
+}
 
-	err = setJobKey(r, jobNumber, common.RedisKeyStatus, common.CheckStatusPending)
+// queueStatus describes the position of a queued job and estimates when it starts, after the
+// notice of the maintenance in progress
+func (h *PRCommentHandler) queueStatus(ctx context.Context, r *jobqueue.Client, jobID string) string {
+	position, wait, waitKnown, err := queueWait(ctx, r, jobID)
 	if err != nil {
-		return err
+		h.Logger.Errorf("Failed to read the job queue: %v", err)
+		return ""
+	}
+	status := util.QueueStatus(position, wait, waitKnown)
+	if maintenance, err := r.Maintenance(ctx); err != nil {
+		h.Logger.Errorf("Failed to read the maintenance: %v", err)
+	} else if maintenance != nil {
+		status = maintenance.Notice() + " " + status
 	}
+	return status
+}
+
+func (h *PRCommentHandler) queueGenerateJob(ctx context.Context, client *github.Client, prComment *PRComment, jobType string) error {
+	r := jobqueue.NewClient(h.RedisHostPort)
 
-	err = setJobKey(r, jobNumber, common.RedisKeyRequestTime, strconv.FormatInt(time.Now().Unix(), 10))
+	if declineOverQuota(ctx, h.Logger, client, r, prComment, jobType, 1) {
+		return nil
+	}
+	declined, deferred := h.shedLoad(ctx, client, r, prComment, jobType)
+	if declined {
+		return nil
+	}
+	if !h.claimComment(ctx, r, prComment) {
+		return nil
+	}
+	jobID, err := createJob(ctx, r, prComment, jobType, prComment.jobOptions)
 	if err != nil {
+		h.releaseComment(ctx, r, prComment)
 		return err
 	}
 
-	err = r.LPush(ctx, "generate", strconv.FormatInt(jobNumber, 10)).Err()
+	if deferred {
+		err = r.Defer(ctx, jobID)
+	} else {
+		err = r.Enqueue(ctx, jobID)
+	}
 	if err != nil {
-		h.Logger.Errorf("Failed to LPUSH job %d to redis %v", jobNumber, err)
+		h.Logger.Errorf("Failed to queue job %s to redis %v", jobID, err)
+		h.releaseComment(ctx, r, prComment)
 		return err
 	}
+	prComment.outcome = util.AuditQueued
+	if deferred {
+		prComment.outcome = util.AuditDeferred
+	}
+	prComment.jobIDs = []string{jobID}
+	if err := recordQuotaJobs(ctx, r, prComment, 1); err != nil {
+		h.Logger.Errorf("Failed to count job %s towards the quotas: %v", jobID, err)
+	}
+	if err := recordCommentJob(ctx, r, prComment.commentKind, prComment.commentID, jobID); err != nil {
+		h.Logger.Errorf("Failed to record job %s of comment %d: %v", jobID, prComment.commentID, err)
+	}
 
-	summaryMsg := "Job ID: " + strconv.FormatInt(jobNumber, 10) + " - Generating test data.\n\n"
-	detailsMsg := fmt.Sprintf("Generating test data for your PR with the job type: *%s*. \n"+
-		"Related Job ID is %d.\n"+
-		"This may take several minutes...\n\n", jobType, jobNumber)
-	commentMsg := fmt.Sprintf("Beep, boop 🤖, Working on *%s* job for your PR. The "+
-		"results will be presented below in the pull request status box. This may take several minutes...\n\n",
-		jobType)
+	queueMsg := h.queueStatus(ctx, r, jobID)
+	if deferred {
+		queueMsg = h.deferredStatus()
+	}
+	summaryMsg := "Job ID: " + jobID + " - Generating test data.\n\n"
+	dryRun := prComment.jobOptions[jobqueue.FieldDryRun] == "true"
+	if dryRun {
+		summaryMsg = "Job ID: " + jobID + " - Dry run, no model will be called.\n\n"
+	}
+	msgData := util.MessageData{JobType: jobType, JobID: jobID, Queue: queueMsg, DryRun: dryRun}
+	detailsMsg := util.Message(util.MessageJobQueuedDetails, msgData)
+	commentMsg := util.Message(util.MessageJobQueued, msgData)
 
-	var checkName string
-	switch jobType {
-	case "generate":
-		checkName = common.GenerateLocalCheck
-	case "precheck":
-		checkName = common.PrecheckCheck
-	case "sdg-svc":
-		checkName = common.GenerateSDGCheck
-	default:
+	checkName := jobCheckName(jobType)
+	if checkName == "" {
 		h.Logger.Errorf("Unknown job type: %s", jobType)
 	}
 
@@ -232,7 +483,7 @@ func (h *PRCommentHandler) queueGenerateJob(ctx context.Context, client *github.
 		Comment:      commentMsg,
 		CheckName:    checkName,
 		JobType:      jobType,
-		JobID:        strconv.FormatInt(jobNumber, 10),
+		JobID:        jobID,
 		RepoOwner:    prComment.repoOwner,
 		RepoName:     prComment.repoName,
 		PrNum:        prComment.prNum,
@@ -244,6 +495,13 @@ func (h *PRCommentHandler) queueGenerateJob(ctx context.Context, client *github.
 		h.Logger.Errorf("Failed to post check on PR %s/%s#%d: %v", params.RepoOwner, params.RepoName, params.PrNum, err)
 		return err
 	}
+
+	// Dry runs are over in a moment, the other jobs get a status comment with their estimated completion
+	if prComment.jobOptions[jobqueue.FieldDryRun] != "true" {
+		if err := postStatusComment(ctx, r, client, params); err != nil {
+			h.Logger.Errorf("Failed to post the status comment of job %s on PR %s/%s#%d: %v", jobID, params.RepoOwner, params.RepoName, params.PrNum, err)
+		}
+	}
 	return nil
 
 }
@@ -255,7 +513,7 @@ func (h *PRCommentHandler) checkAuthorPermission(ctx context.Context, client *gi
 
 	// Check if user is part of the teams that are allowed to enable the bot
 	isAllowed := true
-	for _, teamName := range h.Maintainers {
+	for _, teamName := range prComment.repoCfg.Maintainers {
 		var err error
 		isAllowed = true
 		teamMembership, _, err := client.Teams.GetTeamMembershipBySlug(ctx, prComment.repoOrg, teamName, prComment.author)
@@ -281,7 +539,7 @@ func (h *PRCommentHandler) checkAuthorPermission(ctx context.Context, client *gi
 func (h *PRCommentHandler) helpCommand(ctx context.Context, client *github.Client, prComment *PRComment) error {
 	h.Logger.Infof("Help command received on %s/%s#%d by %s",
 		prComment.repoOwner, prComment.repoName, prComment.prNum, prComment.author)
-	err := util.PostBotWelcomeMessage(ctx, client, prComment.repoOwner, prComment.repoName, prComment.prNum, prComment.prSha, h.BotUsername, h.Maintainers)
+	err := util.PostBotWelcomeMessage(ctx, client, prComment.repoOwner, prComment.repoName, prComment.prNum, prComment.prSha, h.BotUsername, prComment.repoCfg.Maintainers)
 	if err != nil {
 		h.Logger.Errorf("Failed to post welcome message on PR %s/%s#%d: %v", prComment.repoOwner, prComment.repoName, prComment.prNum, err)
 		return err
@@ -298,8 +556,7 @@ func (h *PRCommentHandler) enableCommand(ctx context.Context, client *github.Cli
 		PrNum:     prComment.prNum,
 		PrSha:     prComment.prSha,
 	}
-	params.Comment = fmt.Sprintf("> [!NOTE] \n > **Enable command is deprecated and removed now. If you are member of the maintainers team [%v], "+
-		"you can run the commands directly. Enabling the bot is not required.**", h.Maintainers)
+	params.Comment = util.Message(util.MessageEnableDeprecated, util.MessageData{Maintainers: prComment.repoCfg.Maintainers})
 
 	err := util.PostPullRequestComment(ctx, client, params)
 	if err != nil {
@@ -327,7 +584,8 @@ func (h *PRCommentHandler) generateCommand(ctx context.Context, client *github.C
 	isAllowed := h.checkAuthorPermission(ctx, client, prComment)
 
 	if !isAllowed {
-		params.Comment = fmt.Sprintf("User %s is not allowed to run the InstructLab bot. Only %v teams are allowed to access the bot functions.", prComment.author, h.Maintainers)
+		prComment.outcome = util.AuditDenied
+		params.Comment = util.Message(util.MessageNotAllowed, util.MessageData{Author: prComment.author, Maintainers: prComment.repoCfg.Maintainers})
 
 		err := util.PostPullRequestComment(ctx, client, params)
 		if err != nil {
@@ -337,15 +595,17 @@ func (h *PRCommentHandler) generateCommand(ctx context.Context, client *github.C
 		return nil
 	}
 
-	present, err := util.CheckRequiredLabel(prComment.labels, h.RequiredLabels)
+	present, err := util.CheckRequiredLabel(prComment.labels, prComment.repoCfg.RequiredLabels)
 	if err != nil {
 		h.Logger.Errorf("Failed to check required labels: %v", err)
 	}
 	if !present {
-		detailsMsg := fmt.Sprintf("Beep, boop 🤖: To proceed, the pull request must have one of the '%v' labels.", h.RequiredLabels)
+		prComment.outcome = util.AuditMissingLabel
+		labelData := util.MessageData{Labels: prComment.repoCfg.RequiredLabels}
 		if err != nil {
-			detailsMsg = fmt.Sprintf("%s\nError: %v", detailsMsg, err)
+			labelData.Error = err.Error()
 		}
+		detailsMsg := util.Message(util.MessageMissingLabel, labelData)
 
 		params.CheckSummary = LabelsNotFound
 		params.CheckDetails = detailsMsg
@@ -353,6 +613,18 @@ func (h *PRCommentHandler) generateCommand(ctx context.Context, client *github.C
 		return util.PostPullRequestCheck(ctx, client, params)
 	}
 
+	options, err := util.ParseCommandOptions(prComment.args, []string{"pipeline", "sdg-scale-factor", "chunk-word-count", "dry-run"})
+	if err != nil {
+		return h.invalidOptions(ctx, client, prComment, "generate-local", err)
+	}
+	prComment.jobOptions, err = util.ValidatePipelineOptions(options)
+	if err != nil {
+		return h.invalidOptions(ctx, client, prComment, "generate-local", err)
+	}
+	if err := util.ApplyDryRunOption(options, prComment.jobOptions); err != nil {
+		return h.invalidOptions(ctx, client, prComment, "generate-local", err)
+	}
+
 	return h.queueGenerateJob(ctx, client, prComment, "generate")
 }
 
@@ -373,7 +645,8 @@ func (h *PRCommentHandler) precheckCommand(ctx context.Context, client *github.C
 	// Check if user is part of the teams that are allowed to enable the bot
 	isAllowed := h.checkAuthorPermission(ctx, client, prComment)
 	if !isAllowed {
-		params.Comment = fmt.Sprintf("User %s is not allowed to run the InstructLab bot. Only %v teams are allowed to access the bot functions.", prComment.author, h.Maintainers)
+		prComment.outcome = util.AuditDenied
+		params.Comment = util.Message(util.MessageNotAllowed, util.MessageData{Author: prComment.author, Maintainers: prComment.repoCfg.Maintainers})
 
 		err := util.PostPullRequestComment(ctx, client, params)
 		if err != nil {
@@ -383,15 +656,17 @@ func (h *PRCommentHandler) precheckCommand(ctx context.Context, client *github.C
 		return nil
 	}
 
-	present, err := util.CheckRequiredLabel(prComment.labels, h.RequiredLabels)
+	present, err := util.CheckRequiredLabel(prComment.labels, prComment.repoCfg.RequiredLabels)
 	if err != nil {
 		h.Logger.Errorf("Failed to check required labels: %v", err)
 	}
 	if !present {
-		detailsMsg := fmt.Sprintf("Beep, boop 🤖: To proceed, the pull request must have one of the '%v' labels.", h.RequiredLabels)
+		prComment.outcome = util.AuditMissingLabel
+		labelData := util.MessageData{Labels: prComment.repoCfg.RequiredLabels}
 		if err != nil {
-			detailsMsg = fmt.Sprintf("%s\nError: %v", detailsMsg, err)
+			labelData.Error = err.Error()
 		}
+		detailsMsg := util.Message(util.MessageMissingLabel, labelData)
 
 		params.CheckSummary = LabelsNotFound
 		params.CheckDetails = detailsMsg
@@ -399,6 +674,27 @@ func (h *PRCommentHandler) precheckCommand(ctx context.Context, client *github.C
 		return util.PostPullRequestCheck(ctx, client, params)
 	}
 
+	options, err := util.ParseCommandOptions(prComment.args, []string{"models", "temperature", "max-tokens", "top-p", "system-prompt", "dry-run", "grounded", "paraphrases"})
+	if err != nil {
+		return h.invalidOptions(ctx, client, prComment, "precheck", err)
+	}
+	prComment.jobOptions, err = util.ValidateGenerationOptions(options)
+	if err != nil {
+		return h.invalidOptions(ctx, client, prComment, "precheck", err)
+	}
+	if err := util.ApplyDryRunOption(options, prComment.jobOptions); err != nil {
+		return h.invalidOptions(ctx, client, prComment, "precheck", err)
+	}
+	if err := util.ApplyGroundedOption(options, prComment.jobOptions); err != nil {
+		return h.invalidOptions(ctx, client, prComment, "precheck", err)
+	}
+	if err := util.ApplyParaphrasesOption(options, prComment.jobOptions); err != nil {
+		return h.invalidOptions(ctx, client, prComment, "precheck", err)
+	}
+	if models, ok := options["models"]; ok {
+		prComment.jobOptions[jobqueue.FieldModels] = models
+	}
+
 	return h.queueGenerateJob(ctx, client, prComment, "precheck")
 }
 
@@ -419,7 +715,8 @@ func (h *PRCommentHandler) sdgSvcCommand(ctx context.Context, client *github.Cli
 	// Check if user is part of the teams that are allowed to enable the bot
 	isAllowed := h.checkAuthorPermission(ctx, client, prComment)
 	if !isAllowed {
-		params.Comment = fmt.Sprintf("User %s is not allowed to run the InstructLab bot. Only %v teams are allowed to access the bot functions.", prComment.author, h.Maintainers)
+		prComment.outcome = util.AuditDenied
+		params.Comment = util.Message(util.MessageNotAllowed, util.MessageData{Author: prComment.author, Maintainers: prComment.repoCfg.Maintainers})
 
 		err := util.PostPullRequestComment(ctx, client, params)
 		if err != nil {
@@ -429,15 +726,17 @@ func (h *PRCommentHandler) sdgSvcCommand(ctx context.Context, client *github.Cli
 		return nil
 	}
 
-	present, err := util.CheckRequiredLabel(prComment.labels, h.RequiredLabels)
+	present, err := util.CheckRequiredLabel(prComment.labels, prComment.repoCfg.RequiredLabels)
 	if err != nil {
 		h.Logger.Errorf("Failed to check required labels: %v", err)
 	}
 	if !present {
-		detailsMsg := fmt.Sprintf("Beep, boop 🤖: To proceed, the pull request must have one of the '%v' labels.", h.RequiredLabels)
+		prComment.outcome = util.AuditMissingLabel
+		labelData := util.MessageData{Labels: prComment.repoCfg.RequiredLabels}
 		if err != nil {
-			detailsMsg = fmt.Sprintf("%s\nError: %v", detailsMsg, err)
+			labelData.Error = err.Error()
 		}
+		detailsMsg := util.Message(util.MessageMissingLabel, labelData)
 
 		params.CheckSummary = LabelsNotFound
 		params.CheckDetails = detailsMsg
@@ -445,14 +744,314 @@ func (h *PRCommentHandler) sdgSvcCommand(ctx context.Context, client *github.Cli
 		return util.PostPullRequestCheck(ctx, client, params)
 	}
 
+	options, err := util.ParseCommandOptions(prComment.args, []string{"dry-run"})
+	if err != nil {
+		return h.invalidOptions(ctx, client, prComment, "generate", err)
+	}
+	prComment.jobOptions = make(map[jobqueue.Field]string)
+	if err := util.ApplyDryRunOption(options, prComment.jobOptions); err != nil {
+		return h.invalidOptions(ctx, client, prComment, "generate", err)
+	}
+
 	return h.queueGenerateJob(ctx, client, prComment, "sdg-svc")
 }
 
+func (h *PRCommentHandler) trainCommand(ctx context.Context, client *github.Client, prComment *PRComment) error {
+	h.Logger.Infof("Train command received on %s/%s#%d by %s",
+		prComment.repoOwner, prComment.repoName, prComment.prNum, prComment.author)
+
+	params := util.PullRequestStatusParams{
+		Status:     common.CheckComplete,
+		Conclusion: common.CheckStatusFailure,
+		CheckName:  common.TrainCheck,
+		RepoOwner:  prComment.repoOwner,
+		RepoName:   prComment.repoName,
+		PrNum:      prComment.prNum,
+		PrSha:      prComment.prSha,
+	}
+
+	// Training takes a GPU for a long time, so unlike the other commands it is never open to
+	// everyone when no maintainer teams are configured
+	isAllowed := len(prComment.repoCfg.Maintainers) > 0 && h.checkAuthorPermission(ctx, client, prComment)
+	if !isAllowed {
+		prComment.outcome = util.AuditDenied
+		params.Comment = util.Message(util.MessageCommandNotAllowed, util.MessageData{Author: prComment.author, Command: "train", Maintainers: prComment.repoCfg.Maintainers})
+
+		err := util.PostPullRequestComment(ctx, client, params)
+		if err != nil {
+			h.Logger.Errorf("Failed to post comment on PR %s/%s#%d: %v", prComment.repoOwner, prComment.repoName, prComment.prNum, err)
+			return err
+		}
+		return nil
+	}
+
+	present, err := util.CheckRequiredLabel(prComment.labels, prComment.repoCfg.RequiredLabels)
+	if err != nil {
+		h.Logger.Errorf("Failed to check required labels: %v", err)
+	}
+	if !present {
+		prComment.outcome = util.AuditMissingLabel
+		labelData := util.MessageData{Labels: prComment.repoCfg.RequiredLabels}
+		if err != nil {
+			labelData.Error = err.Error()
+		}
+		detailsMsg := util.Message(util.MessageMissingLabel, labelData)
+
+		params.CheckSummary = LabelsNotFound
+		params.CheckDetails = detailsMsg
+
+		return util.PostPullRequestCheck(ctx, client, params)
+	}
+
+	options, err := util.ParseCommandOptions(prComment.args, []string{"generate-job", "num-epochs", "iters"})
+	if err != nil {
+		return h.invalidOptions(ctx, client, prComment, "train", err)
+	}
+	prComment.jobOptions, err = util.ValidateTrainOptions(options)
+	if err != nil {
+		return h.invalidOptions(ctx, client, prComment, "train", err)
+	}
+
+	return h.queueGenerateJob(ctx, client, prComment, "train")
+}
+
+func (h *PRCommentHandler) evaluateCommand(ctx context.Context, client *github.Client, prComment *PRComment) error {
+	h.Logger.Infof("Evaluate command received on %s/%s#%d by %s",
+		prComment.repoOwner, prComment.repoName, prComment.prNum, prComment.author)
+
+	params := util.PullRequestStatusParams{
+		Status:     common.CheckComplete,
+		Conclusion: common.CheckStatusFailure,
+		CheckName:  common.EvaluateCheck,
+		RepoOwner:  prComment.repoOwner,
+		RepoName:   prComment.repoName,
+		PrNum:      prComment.prNum,
+		PrSha:      prComment.prSha,
+	}
+
+	// Like training, an evaluation takes a GPU for a long time
+	isAllowed := len(prComment.repoCfg.Maintainers) > 0 && h.checkAuthorPermission(ctx, client, prComment)
+	if !isAllowed {
+		prComment.outcome = util.AuditDenied
+		params.Comment = util.Message(util.MessageCommandNotAllowed, util.MessageData{Author: prComment.author, Command: "evaluate", Maintainers: prComment.repoCfg.Maintainers})
+
+		err := util.PostPullRequestComment(ctx, client, params)
+		if err != nil {
+			h.Logger.Errorf("Failed to post comment on PR %s/%s#%d: %v", prComment.repoOwner, prComment.repoName, prComment.prNum, err)
+			return err
+		}
+		return nil
+	}
+
+	present, err := util.CheckRequiredLabel(prComment.labels, prComment.repoCfg.RequiredLabels)
+	if err != nil {
+		h.Logger.Errorf("Failed to check required labels: %v", err)
+	}
+	if !present {
+		prComment.outcome = util.AuditMissingLabel
+		labelData := util.MessageData{Labels: prComment.repoCfg.RequiredLabels}
+		if err != nil {
+			labelData.Error = err.Error()
+		}
+		detailsMsg := util.Message(util.MessageMissingLabel, labelData)
+
+		params.CheckSummary = LabelsNotFound
+		params.CheckDetails = detailsMsg
+
+		return util.PostPullRequestCheck(ctx, client, params)
+	}
+
+	options, err := util.ParseCommandOptions(prComment.args, []string{"benchmark", "model", "base-model", "base-branch"})
+	if err != nil {
+		return h.invalidOptions(ctx, client, prComment, "evaluate", err)
+	}
+	prComment.jobOptions, err = util.ValidateEvaluateOptions(options)
+	if err != nil {
+		return h.invalidOptions(ctx, client, prComment, "evaluate", err)
+	}
+
+	return h.queueGenerateJob(ctx, client, prComment, "evaluate")
+}
+
+func (h *PRCommentHandler) e2eCommand(ctx context.Context, client *github.Client, prComment *PRComment) error {
+	h.Logger.Infof("E2E command received on %s/%s#%d by %s",
+		prComment.repoOwner, prComment.repoName, prComment.prNum, prComment.author)
+
+	params := util.PullRequestStatusParams{
+		Status:     common.CheckComplete,
+		Conclusion: common.CheckStatusFailure,
+		CheckName:  common.E2ECheck,
+		RepoOwner:  prComment.repoOwner,
+		RepoName:   prComment.repoName,
+		PrNum:      prComment.prNum,
+		PrSha:      prComment.prSha,
+	}
+
+	// The pipeline trains and evaluates a model, so it is restricted like those commands
+	isAllowed := len(prComment.repoCfg.Maintainers) > 0 && h.checkAuthorPermission(ctx, client, prComment)
+	if !isAllowed {
+		prComment.outcome = util.AuditDenied
+		params.Comment = util.Message(util.MessageCommandNotAllowed, util.MessageData{Author: prComment.author, Command: "e2e", Maintainers: prComment.repoCfg.Maintainers})
+
+		err := util.PostPullRequestComment(ctx, client, params)
+		if err != nil {
+			h.Logger.Errorf("Failed to post comment on PR %s/%s#%d: %v", prComment.repoOwner, prComment.repoName, prComment.prNum, err)
+			return err
+		}
+		return nil
+	}
+
+	present, err := util.CheckRequiredLabel(prComment.labels, prComment.repoCfg.RequiredLabels)
+	if err != nil {
+		h.Logger.Errorf("Failed to check required labels: %v", err)
+	}
+	if !present {
+		prComment.outcome = util.AuditMissingLabel
+		labelData := util.MessageData{Labels: prComment.repoCfg.RequiredLabels}
+		if err != nil {
+			labelData.Error = err.Error()
+		}
+		detailsMsg := util.Message(util.MessageMissingLabel, labelData)
+
+		params.CheckSummary = LabelsNotFound
+		params.CheckDetails = detailsMsg
+
+		return util.PostPullRequestCheck(ctx, client, params)
+	}
+
+	options, err := util.ParseCommandOptions(prComment.args, []string{
+		"pipeline", "sdg-scale-factor", "chunk-word-count",
+		"num-epochs", "iters",
+		"benchmark", "model", "base-model", "base-branch",
+	})
+	if err != nil {
+		return h.invalidOptions(ctx, client, prComment, "e2e", err)
+	}
+	stageOptions := make(map[string]map[jobqueue.Field]string)
+	if stageOptions["generate"], err = util.ValidatePipelineOptions(options); err != nil {
+		return h.invalidOptions(ctx, client, prComment, "e2e", err)
+	}
+	if stageOptions["train"], err = util.ValidateTrainOptions(options); err != nil {
+		return h.invalidOptions(ctx, client, prComment, "e2e", err)
+	}
+	if stageOptions["evaluate"], err = util.ValidateEvaluateOptions(options); err != nil {
+		return h.invalidOptions(ctx, client, prComment, "e2e", err)
+	}
+
+	return h.queuePipeline(ctx, client, prComment, stageOptions)
+}
+
+// queuePipeline creates a job for every pipeline stage, chains each one to the previous stage
+// and queues the first stage. The workers queue the next stage when a stage succeeds.
+func (h *PRCommentHandler) queuePipeline(ctx context.Context, client *github.Client, prComment *PRComment, stageOptions map[string]map[jobqueue.Field]string) error {
+	r := jobqueue.NewClient(h.RedisHostPort)
+
+	// Every stage counts as a job, even when an earlier stage fails and the later ones never run
+	if declineOverQuota(ctx, h.Logger, client, r, prComment, "e2e", len(util.PipelineStages)) {
+		return nil
+	}
+	declined, deferred := h.shedLoad(ctx, client, r, prComment, "e2e", util.PipelineStages...)
+	if declined {
+		return nil
+	}
+	if !h.claimComment(ctx, r, prComment) {
+		return nil
+	}
+	queued := false
+	defer func() {
+		if !queued {
+			h.releaseComment(ctx, r, prComment)
+		}
+	}()
+
+	jobIDs := make([]string, len(util.PipelineStages))
+	var generateJob string
+	for i, jobType := range util.PipelineStages {
+		jobOptions := stageOptions[jobType]
+		if jobType == "train" && generateJob != "" {
+			// Train on the data of this pipeline rather than on the latest generate job of the PR
+			jobOptions[jobqueue.FieldGenerateJob] = generateJob
+		}
+		jobID, err := createJob(ctx, r, prComment, jobType, jobOptions)
+		if err != nil {
+			return err
+		}
+		jobIDs[i] = jobID
+		if jobType == "generate" {
+			generateJob = jobID
+		}
+
+		if err := r.Set(ctx, jobID, jobqueue.FieldPipelineID, jobIDs[0]); err != nil {
+			return err
+		}
+		if i > 0 {
+			if err := r.Set(ctx, jobID, jobqueue.FieldDependsOn, jobIDs[i-1]); err != nil {
+				return err
+			}
+			if err := r.Set(ctx, jobIDs[i-1], jobqueue.FieldNextJob, jobID); err != nil {
+				return err
+			}
+		}
+	}
+	if err := r.Set(ctx, jobIDs[0], jobqueue.FieldPipelineJobs, strings.Join(jobIDs, ",")); err != nil {
+		return err
+	}
+
+	enqueue := r.Enqueue
+	if deferred {
+		enqueue = r.Defer
+	}
+	if err := enqueue(ctx, jobIDs[0]); err != nil {
+		h.Logger.Errorf("Failed to queue job %s to redis %v", jobIDs[0], err)
+		return err
+	}
+	queued = true
+	prComment.outcome = util.AuditQueued
+	if deferred {
+		prComment.outcome = util.AuditDeferred
+	}
+	prComment.jobIDs = jobIDs
+	if err := recordQuotaJobs(ctx, r, prComment, len(jobIDs)); err != nil {
+		h.Logger.Errorf("Failed to count pipeline %s towards the quotas: %v", jobIDs[0], err)
+	}
+	if err := recordCommentJob(ctx, r, prComment.commentKind, prComment.commentID, jobIDs[0]); err != nil {
+		h.Logger.Errorf("Failed to record pipeline %s of comment %d: %v", jobIDs[0], prComment.commentID, err)
+	}
+
+	stages := make([]string, len(util.PipelineStages))
+	for i, jobType := range util.PipelineStages {
+		stages[i] = fmt.Sprintf("*%s*, job ID %s", jobType, jobIDs[i])
+	}
+	queueMsg := h.queueStatus(ctx, r, jobIDs[0])
+	if deferred {
+		queueMsg = h.deferredStatus()
+	}
+	params := util.PullRequestStatusParams{
+		Status:       common.CheckInProgress,
+		CheckSummary: fmt.Sprintf("Pipeline ID: %s - Running the e2e pipeline.\n\n", jobIDs[0]),
+		CheckDetails: util.Message(util.MessageE2EQueued, util.MessageData{Items: stages, Queue: queueMsg}),
+		CheckName:    common.E2ECheck,
+		JobType:      "e2e",
+		JobID:        jobIDs[0],
+		RepoOwner:    prComment.repoOwner,
+		RepoName:     prComment.repoName,
+		PrNum:        prComment.prNum,
+		PrSha:        prComment.prSha,
+	}
+
+	if err := util.PostPullRequestCheck(ctx, client, params); err != nil {
+		h.Logger.Errorf("Failed to post check on PR %s/%s#%d: %v", params.RepoOwner, params.RepoName, params.PrNum, err)
+		return err
+	}
+	return nil
+}
+
 func (h *PRCommentHandler) unknownCommand(ctx context.Context, client *github.Client, prComment *PRComment) error {
 	h.Logger.Infof("Unknown command received on %s/%s#%d by %s",
 		prComment.repoOwner, prComment.repoName, prComment.prNum, prComment.author)
+	prComment.outcome = util.AuditUnknown
 
-	msg := "Beep, boop 🤖  Sorry, I don't understand that command"
+	msg := util.Message(util.MessageUnknownCommand, util.MessageData{})
 	botComment := github.IssueComment{
 		Body: &msg,
 	}
@@ -464,3 +1063,41 @@ func (h *PRCommentHandler) unknownCommand(ctx context.Context, client *github.Cl
 
 	return nil
 }
+
+func (h *PRCommentHandler) disabledCommand(ctx context.Context, client *github.Client, prComment *PRComment, command string) error {
+	h.Logger.Infof("Disabled command %s received on %s/%s#%d by %s",
+		command, prComment.repoOwner, prComment.repoName, prComment.prNum, prComment.author)
+	prComment.outcome = util.AuditDisabled
+
+	params := util.PullRequestStatusParams{
+		RepoOwner: prComment.repoOwner,
+		RepoName:  prComment.repoName,
+		PrNum:     prComment.prNum,
+	}
+	params.Comment = util.Message(util.MessageDisabledCommand, util.MessageData{Command: command, Commands: prComment.repoCfg.Commands()})
+
+	if err := util.PostPullRequestComment(ctx, client, params); err != nil {
+		h.Logger.Errorf("Failed to post comment on PR %s/%s#%d: %v", prComment.repoOwner, prComment.repoName, prComment.prNum, err)
+		return err
+	}
+	return nil
+}
+
+func (h *PRCommentHandler) invalidOptions(ctx context.Context, client *github.Client, prComment *PRComment, command string, optErr error) error {
+	h.Logger.Infof("Invalid options for %s command received on %s/%s#%d by %s: %v",
+		command, prComment.repoOwner, prComment.repoName, prComment.prNum, prComment.author, optErr)
+	prComment.outcome = util.AuditInvalid
+
+	params := util.PullRequestStatusParams{
+		RepoOwner: prComment.repoOwner,
+		RepoName:  prComment.repoName,
+		PrNum:     prComment.prNum,
+	}
+	params.Comment = util.Message(util.MessageInvalidOptions, util.MessageData{Command: command, Error: optErr.Error()})
+
+	if err := util.PostPullRequestComment(ctx, client, params); err != nil {
+		h.Logger.Errorf("Failed to post comment on PR %s/%s#%d: %v", prComment.repoOwner, prComment.repoName, prComment.prNum, err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/instructlab/instructlab-bot/gobot/util"
+	"github.com/instructlab/instructlab-bot/pkg/jobqueue"
+	"go.uber.org/zap"
+)
+
+const janitorInterval = time.Minute
+
+// Janitor fails the jobs whose worker stopped reporting and deletes the reported jobs once they
+// are older than the retention
+type Janitor struct {
+	Logger        *zap.SugaredLogger
+	RedisHostPort string
+	// StaleJobTimeout fails a running job without a progress update for this long, 0 never does
+	StaleJobTimeout time.Duration
+	// JobRetention deletes the keys of the archived jobs requested longer ago, 0 keeps them
+	JobRetention time.Duration
+}
+
+// Run cleans up every janitorInterval until the context is cancelled
+func (j *Janitor) Run(ctx context.Context) {
+	if j.StaleJobTimeout <= 0 && j.JobRetention <= 0 {
+		return
+	}
+	r := jobqueue.NewClient(j.RedisHostPort)
+	defer r.Close()
+
+	ticker := time.NewTicker(janitorInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			j.Logger.Info("Context cancelled, stopping janitor")
+			return
+		case now := <-ticker.C:
+			if j.StaleJobTimeout > 0 {
+				j.failStaleJobs(ctx, r, now)
+			}
+			if j.JobRetention > 0 {
+				j.expireArchivedJobs(ctx, r, now)
+			}
+		}
+	}
+}
+
+// failStaleJobs completes the running jobs without a heartbeat since StaleJobTimeout with an
+// error, the results loop then reports them like any failed job
+func (j *Janitor) failStaleJobs(ctx context.Context, r *jobqueue.Client, now time.Time) {
+	running, err := r.Running(ctx)
+	if err != nil {
+		j.Logger.Errorf("Failed to list the running jobs: %v", err)
+		return
+	}
+	for _, jobID := range running {
+		heartbeat, err := lastHeartbeat(ctx, r, jobID)
+		if err != nil {
+			j.Logger.Errorf("Failed to read the heartbeat of job %s: %v", jobID, err)
+			continue
+		}
+		if now.Sub(heartbeat) < j.StaleJobTimeout {
+			continue
+		}
+		j.Logger.Warnf("Job %s has not reported since %s, failing it", jobID, heartbeat.UTC().Format(time.RFC3339))
+		err = r.Complete(ctx, jobID, map[jobqueue.Field]interface{}{
+			jobqueue.FieldStatus:        jobqueue.StatusError,
+			jobqueue.FieldErrors:        fmt.Sprintf("The worker running the job stopped reporting for %s, it was likely restarted", j.StaleJobTimeout),
+			jobqueue.FieldErrorCategory: "timeout",
+		})
+		if err != nil {
+			j.Logger.Errorf("Failed to fail stale job %s: %v", jobID, err)
+		}
+	}
+}
+
+// lastHeartbeat is the last progress update of a running job, or its start
+func lastHeartbeat(ctx context.Context, r *jobqueue.Client, jobID string) (time.Time, error) {
+	startTime, err := r.GetInt(ctx, jobID, jobqueue.FieldStartTime)
+	if err != nil {
+		return time.Time{}, err
+	}
+	heartbeat := startTime
+	if progressJSON, _ := r.Get(ctx, jobID, jobqueue.FieldProgress); progressJSON != "" {
+		var progress util.JobProgress
+		if err := json.Unmarshal([]byte(progressJSON), &progress); err == nil && progress.UpdatedAt > heartbeat {
+			heartbeat = progress.UpdatedAt
+		}
+	}
+	return time.Unix(heartbeat, 0), nil
+}
+
+// expireArchivedJobs deletes the oldest archived jobs requested before the retention, the
+// archived queue is ordered by report so it stops at the first recent one
+func (j *Janitor) expireArchivedJobs(ctx context.Context, r *jobqueue.Client, now time.Time) {
+	expired := 0
+	for {
+		jobID, err := r.LIndex(ctx, jobqueue.QueueArchived, -1).Result()
+		if err != nil {
+			// redis.Nil when the archive is empty
+			break
+		}
+		requested, err := r.GetInt(ctx, jobID, jobqueue.FieldRequestTime)
+		if err != nil {
+			j.Logger.Errorf("Failed to read the request time of job %s: %v", jobID, err)
+			break
+		}
+		if requested > 0 && now.Sub(time.Unix(requested, 0)) < j.JobRetention {
+			break
+		}
+		if err := deleteJobKeys(ctx, r, jobID); err != nil {
+			j.Logger.Errorf("Failed to delete the keys of job %s: %v", jobID, err)
+			break
+		}
+		if err := r.LRem(ctx, jobqueue.QueueArchived, -1, jobID).Err(); err != nil {
+			j.Logger.Errorf("Failed to remove job %s from the archive: %v", jobID, err)
+			break
+		}
+		expired++
+	}
+	if expired > 0 {
+		j.Logger.Infof("Deleted %d archived jobs older than %s", expired, j.JobRetention)
+	}
+}
+
+// deleteJobKeys deletes every field of a job
+func deleteJobKeys(ctx context.Context, r *jobqueue.Client, jobID string) error {
+	var cursor uint64
+	for {
+		keys, next, err := r.Scan(ctx, cursor, jobqueue.JobPattern(jobID), 0).Result()
+		if err != nil {
+			return err
+		}
+		if len(keys) > 0 {
+			if err := r.Del(ctx, keys...).Err(); err != nil {
+				return err
+			}
+		}
+		if cursor = next; cursor == 0 {
+			return nil
+		}
+	}
+}
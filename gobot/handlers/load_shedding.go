@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/go-github/v61/github"
+	"github.com/instructlab/instructlab-bot/gobot/util"
+	"github.com/instructlab/instructlab-bot/pkg/jobqueue"
+	"go.uber.org/zap"
+)
+
+const deferredInterval = time.Minute
+
+// shedLoad applies the load shedding policy to a job of the job types, a pipeline passing the
+// types of its stages. It reports whether the job was declined, and whether it is to be deferred
+// rather than queued. Redis errors let the job through.
+func (h *PRCommentHandler) shedLoad(ctx context.Context, client *github.Client, r *jobqueue.Client, prComment *PRComment, jobType string, jobTypes ...string) (bool, bool) {
+	if h.LoadShedding.QueueDepth <= 0 {
+		return false, false
+	}
+	depth, err := r.LLen(ctx, jobqueue.QueueGenerate).Result()
+	if err != nil {
+		h.Logger.Errorf("Failed to read the depth of the job queue, queueing anyway: %v", err)
+		return false, false
+	}
+	if !h.LoadShedding.Sheds(int(depth), append([]string{jobType}, jobTypes...)...) {
+		return false, false
+	}
+	if h.LoadShedding.Policy == util.ShedDefer {
+		h.Logger.Infof("Deferring %s job on %s/%s#%d by %s, %d jobs are queued", jobType, prComment.repoOwner, prComment.repoName, prComment.prNum, prComment.author, depth)
+		return false, true
+	}
+
+	h.Logger.Infof("Declining %s job on %s/%s#%d by %s, %d jobs are queued", jobType, prComment.repoOwner, prComment.repoName, prComment.prNum, prComment.author, depth)
+	prComment.outcome = util.AuditOverCapacity
+	params := util.PullRequestStatusParams{
+		RepoOwner: prComment.repoOwner,
+		RepoName:  prComment.repoName,
+		PrNum:     prComment.prNum,
+	}
+	reason := fmt.Sprintf("the bot is at capacity with %d jobs queued", depth)
+	params.Comment = util.Message(util.MessageOverCapacity, util.MessageData{JobType: jobType, Reason: reason})
+	if err := util.PostPullRequestComment(ctx, client, params); err != nil {
+		h.Logger.Errorf("Failed to post comment on PR %s/%s#%d: %v", prComment.repoOwner, prComment.repoName, prComment.prNum, err)
+	}
+	return true, false
+}
+
+// deferredStatus tells the requester their job is deferred to the off-peak hours
+func (h *PRCommentHandler) deferredStatus() string {
+	return util.Message(util.MessageJobDeferred, util.MessageData{Reason: h.LoadShedding.OffPeak.String()})
+}
+
+// DeferredQueue moves the deferred jobs to the job queue during the off-peak hours, as long as
+// the queue stays below the depth it is at capacity with
+type DeferredQueue struct {
+	Logger        *zap.SugaredLogger
+	RedisHostPort string
+	LoadShedding  util.LoadShedding
+}
+
+// Run moves the deferred jobs every deferredInterval until the context is cancelled
+func (d *DeferredQueue) Run(ctx context.Context) {
+	if d.LoadShedding.QueueDepth <= 0 || d.LoadShedding.Policy != util.ShedDefer {
+		return
+	}
+	r := jobqueue.NewClient(d.RedisHostPort)
+	defer r.Close()
+
+	ticker := time.NewTicker(deferredInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			d.Logger.Info("Context cancelled, stopping the deferred queue")
+			return
+		case now := <-ticker.C:
+			if d.LoadShedding.OffPeak.Contains(now) {
+				d.queueDeferredJobs(ctx, r)
+			}
+		}
+	}
+}
+
+// queueDeferredJobs moves the oldest deferred jobs to the job queue until it is at capacity
+func (d *DeferredQueue) queueDeferredJobs(ctx context.Context, r *jobqueue.Client) {
+	depth, err := r.LLen(ctx, jobqueue.QueueGenerate).Result()
+	if err != nil {
+		d.Logger.Errorf("Failed to read the depth of the job queue: %v", err)
+		return
+	}
+	for ; depth < int64(d.LoadShedding.QueueDepth); depth++ {
+		jobID, err := r.Undefer(ctx)
+		if err != nil {
+			d.Logger.Errorf("Failed to queue a deferred job: %v", err)
+			return
+		}
+		if jobID == "" {
+			return
+		}
+		d.Logger.Infof("Queued deferred job %s", jobID)
+	}
+}
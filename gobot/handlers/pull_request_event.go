@@ -7,6 +7,7 @@ import (
 	"github.com/google/go-github/v61/github"
 	"github.com/instructlab/instructlab-bot/gobot/common"
 	"github.com/instructlab/instructlab-bot/gobot/util"
+	"github.com/instructlab/instructlab-bot/pkg/jobqueue"
 	"github.com/palantir/go-githubapp/githubapp"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
@@ -15,9 +16,14 @@ import (
 type PullRequestEventHandler struct {
 	githubapp.ClientCreator
 	Logger         *zap.SugaredLogger
+	RedisHostPort  string
 	RequiredLabels []string
 	BotUsername    string
 	Maintainers    []string
+	RepoConfigs    util.RepoConfigs
+	RepoFiles      *util.RepoFiles
+	// RetargetOnPush moves the queued jobs of a PR to its new head when it is pushed to
+	RetargetOnPush bool
 }
 
 func (h *PullRequestEventHandler) Handles() []string {
@@ -25,18 +31,33 @@ func (h *PullRequestEventHandler) Handles() []string {
 }
 
 func (h *PullRequestEventHandler) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	return handleOnce(ctx, h.RedisHostPort, h.Logger, eventType, deliveryID, func() error {
+		return h.handle(ctx, eventType, payload)
+	})
+}
+
+func (h *PullRequestEventHandler) handle(ctx context.Context, eventType string, payload []byte) error {
 	var event github.PullRequestEvent
 	if err := json.Unmarshal(payload, &event); err != nil {
 		return errors.Wrap(err, "failed to parse issue comment event payload")
 	}
 
-	if event.GetRepo().GetName() != common.RepoName {
+	repoCfg, ok := h.RepoConfigs.Lookup(event.GetRepo().GetOwner().GetLogin(), event.GetRepo().GetName(),
+		common.RepoName, util.RepoConfig{RequiredLabels: h.RequiredLabels, Maintainers: h.Maintainers})
+	if !ok {
 		h.Logger.Warnf("Received unexpected event %s from %s/%s repo. Skipping the event.",
 			eventType, event.GetOrganization().GetLogin(), event.GetRepo().GetName())
 		return nil
 	}
 
-	if event.GetPullRequest().GetState() != "open" || event.GetAction() != "labeled" {
+	if event.GetPullRequest().GetState() != "open" {
+		return nil
+	}
+	switch event.GetAction() {
+	case "opened", "reopened", "synchronize":
+		return h.handleNewHead(ctx, &event, repoCfg)
+	case "labeled":
+	default:
 		return nil
 	}
 
@@ -49,12 +70,19 @@ func (h *PullRequestEventHandler) Handle(ctx context.Context, eventType, deliver
 	prNum := event.GetPullRequest().GetNumber()
 	prSha := event.GetPullRequest().GetHead().GetSHA()
 
-	h.Logger.Infof("Checking for required labels: %v", h.RequiredLabels)
-	if len(h.RequiredLabels) == 0 {
+	client, err := h.NewInstallationClient(installID)
+	if err != nil {
+		h.Logger.Errorf("Failed to create installation client: %v", err)
+		return err
+	}
+	repoCfg = withRepoFile(ctx, h.Logger, h.RepoFiles, client, repoOwner, repoName, repoCfg)
+
+	h.Logger.Infof("Checking for required labels: %v", repoCfg.RequiredLabels)
+	if len(repoCfg.RequiredLabels) == 0 {
 		return nil
 	}
 
-	labelFound, err := util.CheckRequiredLabel(event.GetPullRequest().Labels, h.RequiredLabels)
+	labelFound, err := util.CheckRequiredLabel(event.GetPullRequest().Labels, repoCfg.RequiredLabels)
 	if err != nil {
 		h.Logger.Errorf("Failed to check required labels: %v", err)
 	}
@@ -64,12 +92,6 @@ func (h *PullRequestEventHandler) Handle(ctx context.Context, eventType, deliver
 		return nil
 	}
 
-	client, err := h.NewInstallationClient(installID)
-	if err != nil {
-		h.Logger.Errorf("Failed to create installation client: %v", err)
-		return err
-	}
-
 	params := util.PullRequestStatusParams{
 		CheckName: common.BotReadyStatus,
 		RepoOwner: repoOwner,
@@ -88,10 +110,110 @@ func (h *PullRequestEventHandler) Handle(ctx context.Context, eventType, deliver
 		return nil
 	}
 
-	err = util.PostBotWelcomeMessage(ctx, client, repoOwner, repoName, prNum, prSha, h.BotUsername, h.Maintainers)
+	err = util.PostBotWelcomeMessage(ctx, client, repoOwner, repoName, prNum, prSha, h.BotUsername, repoCfg.Maintainers)
 	if err != nil {
 		h.Logger.Errorf("Failed to post bot welcome message on PR %s/%s#%d: %v", repoOwner, repoName, prNum, err)
 		return err
 	}
 	return nil
 }
+
+// handleNewHead records the new head of a PR and moves its queued jobs to it, removes the approval
+// of the merge policy from the PR, and prechecks the new head when the repository runs precheck
+// automatically
+func (h *PullRequestEventHandler) handleNewHead(ctx context.Context, event *github.PullRequestEvent, repoCfg util.RepoConfig) error {
+	pr := event.GetPullRequest()
+	repoOwner := event.GetRepo().GetOwner().GetLogin()
+	repoName := event.GetRepo().GetName()
+	client, err := h.NewInstallationClient(githubapp.GetInstallationIDFromEvent(event))
+	if err != nil {
+		h.Logger.Errorf("Failed to create installation client: %v", err)
+		return err
+	}
+	h.recordHead(ctx, client, event)
+
+	// The merge policy approved the previous head, the new one waits for its own jobs
+	if event.GetAction() == "synchronize" && repoCfg.Policy.Label != "" {
+		if found, _ := util.CheckRequiredLabel(pr.Labels, []string{repoCfg.Policy.Label}); found {
+			params := util.PullRequestStatusParams{RepoOwner: repoOwner, RepoName: repoName, PrNum: pr.GetNumber()}
+			if err := util.RemovePullRequestLabel(ctx, client, params, repoCfg.Policy.Label); err != nil {
+				h.Logger.Errorf("Failed to remove the %s label from PR %s/%s#%d: %v", repoCfg.Policy.Label, repoOwner, repoName, pr.GetNumber(), err)
+			}
+		}
+	}
+
+	repoCfg = withRepoFile(ctx, h.Logger, h.RepoFiles, client, repoOwner, repoName, repoCfg)
+	if !repoCfg.AutoPrecheck || !repoCfg.CommandAllowed("precheck") || pr.GetDraft() {
+		return nil
+	}
+	if found, _ := util.CheckRequiredLabel(pr.Labels, repoCfg.RequiredLabels); !found {
+		h.Logger.Infof("Required labels not found on PR %s/%s#%d, skipping the automatic precheck", repoOwner, repoName, pr.GetNumber())
+		return nil
+	}
+	return h.queueAutoPrecheck(ctx, client, event, repoCfg)
+}
+
+// queueAutoPrecheck queues a precheck of the head of the PR, on behalf of the sender of the event
+func (h *PullRequestEventHandler) queueAutoPrecheck(ctx context.Context, client *github.Client, event *github.PullRequestEvent, repoCfg util.RepoConfig) error {
+	r := jobqueue.NewClient(h.RedisHostPort)
+
+	job := &PRComment{
+		repoOwner:    event.GetRepo().GetOwner().GetLogin(),
+		repoName:     event.GetRepo().GetName(),
+		repoOrg:      event.GetOrganization().GetLogin(),
+		prNum:        event.GetPullRequest().GetNumber(),
+		author:       event.GetSender().GetLogin(),
+		installID:    githubapp.GetInstallationIDFromEvent(event),
+		prSha:        event.GetPullRequest().GetHead().GetSHA(),
+		baseRef:      event.GetPullRequest().GetBase().GetRef(),
+		changedFiles: event.GetPullRequest().GetChangedFiles(),
+		labels:       event.GetPullRequest().Labels,
+		repoCfg:      repoCfg,
+	}
+	if declineOverQuota(ctx, h.Logger, client, r, job, "precheck", 1) {
+		return nil
+	}
+	jobID, err := queuePrecheck(ctx, h.Logger, client, r, job, nil, "Prechecking the new head of the PR.")
+	if err != nil {
+		return err
+	}
+	h.Logger.Infof("Queued automatic precheck job %s for %s/%s#%d", jobID, job.repoOwner, job.repoName, job.prNum)
+	return nil
+}
+
+// queuePrecheck queues a precheck of the head of the PR the bot was not asked for in a comment,
+// counts it towards the quotas and starts its check run with the summary
+func queuePrecheck(ctx context.Context, logger *zap.SugaredLogger, client *github.Client, r *jobqueue.Client, job *PRComment, jobOptions map[jobqueue.Field]string, summary string) (string, error) {
+	jobID, err := createJob(ctx, r, job, "precheck", jobOptions)
+	if err != nil {
+		return "", err
+	}
+	if err := addToGroup(ctx, r, jobOptions, jobID); err != nil {
+		logger.Errorf("Failed to add job %s to group %s: %v", jobID, jobOptions[jobqueue.FieldGroup], err)
+	}
+	if err := r.Enqueue(ctx, jobID); err != nil {
+		logger.Errorf("Failed to queue job %s to redis %v", jobID, err)
+		return "", err
+	}
+	if err := recordQuotaJobs(ctx, r, job, 1); err != nil {
+		logger.Errorf("Failed to count job %s towards the quotas: %v", jobID, err)
+	}
+
+	params := util.PullRequestStatusParams{
+		Status:       common.CheckInProgress,
+		CheckName:    common.PrecheckCheck,
+		CheckSummary: "Job ID: " + jobID + " - " + summary,
+		CheckDetails: util.Message(util.MessagePrecheckQueued, util.MessageData{JobID: jobID}),
+		JobType:      "precheck",
+		JobID:        jobID,
+		RepoOwner:    job.repoOwner,
+		RepoName:     job.repoName,
+		PrNum:        job.prNum,
+		PrSha:        job.prSha,
+	}
+	if err := util.PostPullRequestCheck(ctx, client, params); err != nil {
+		logger.Errorf("Failed to post check on PR %s/%s#%d: %v", params.RepoOwner, params.RepoName, params.PrNum, err)
+		return jobID, err
+	}
+	return jobID, nil
+}
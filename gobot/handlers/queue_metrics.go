@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/instructlab/instructlab-bot/gobot/util"
+	"github.com/instructlab/instructlab-bot/pkg/jobqueue"
+	"go.uber.org/zap"
+)
+
+// QueueMetricsHandler exports the backlog of the job queue and the running jobs, so that worker
+// deployments can autoscale on them, the errors of the GitHub API and the latencies of the jobs
+type QueueMetricsHandler struct {
+	Logger        *zap.SugaredLogger
+	RedisHostPort string
+	GithubAPI     *util.APIRetrier
+	Latencies     *util.LatencyTracker
+}
+
+func (h *QueueMetricsHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	r := jobqueue.NewClient(h.RedisHostPort)
+	defer r.Close()
+
+	queued, err := r.Queued(ctx)
+	if err != nil {
+		h.Logger.Errorf("Failed to read the job queue: %v", err)
+		http.Error(w, "Failed to read the job queue", http.StatusServiceUnavailable)
+		return
+	}
+
+	depths, err := countJobTypes(ctx, r, queued)
+	if err != nil {
+		h.Logger.Errorf("Failed to read the type of the queued jobs: %v", err)
+		http.Error(w, "Failed to read the job queue", http.StatusServiceUnavailable)
+		return
+	}
+
+	runningJobs, err := r.Running(ctx)
+	if err != nil {
+		h.Logger.Errorf("Failed to read the running jobs: %v", err)
+		http.Error(w, "Failed to read the job queue", http.StatusServiceUnavailable)
+		return
+	}
+	running, err := countJobTypes(ctx, r, runningJobs)
+	if err != nil {
+		h.Logger.Errorf("Failed to read the type of the running jobs: %v", err)
+		http.Error(w, "Failed to read the job queue", http.StatusServiceUnavailable)
+		return
+	}
+
+	averages := make(map[string]time.Duration)
+	for _, jobType := range util.JobTypes {
+		durations, _ := r.LRange(ctx, jobqueue.DurationsKey(jobType), 0, -1).Result()
+		if average, ok := util.AverageDuration(durations); ok {
+			averages[jobType] = average
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	fmt.Fprint(w, util.QueueMetrics(depths, running, averages))
+	if h.GithubAPI != nil {
+		fmt.Fprint(w, h.GithubAPI.Metrics())
+	}
+	if h.Latencies != nil {
+		fmt.Fprint(w, h.Latencies.Metrics())
+	}
+}
+
+// countJobTypes counts the jobs by type
+func countJobTypes(ctx context.Context, r *jobqueue.Client, jobIDs []string) (map[string]int, error) {
+	counts := make(map[string]int)
+	if len(jobIDs) == 0 {
+		return counts, nil
+	}
+	keys := make([]string, len(jobIDs))
+	for i, id := range jobIDs {
+		keys[i] = jobqueue.Key(id, jobqueue.FieldJobType)
+	}
+	jobTypes, err := r.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	for _, jobType := range jobTypes {
+		if jobType, ok := jobType.(string); ok {
+			counts[jobType]++
+		}
+	}
+	return counts, nil
+}
@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v61/github"
+	"github.com/instructlab/instructlab-bot/gobot/util"
+	"github.com/instructlab/instructlab-bot/pkg/jobqueue"
+	"go.uber.org/zap"
+)
+
+// quotaSubject is a user or repository a quota applies to
+type quotaSubject struct {
+	scope string
+	name  string
+}
+
+func (s quotaSubject) String() string {
+	if s.scope == util.QuotaScopeUser {
+		return "user `" + s.name + "`"
+	}
+	return "repository `" + s.name + "`"
+}
+
+// quotaSubjects are the author of the comment and the repository, the jobs count towards both
+func quotaSubjects(prComment *PRComment) []quotaSubject {
+	return []quotaSubject{
+		{scope: util.QuotaScopeUser, name: prComment.author},
+		{scope: util.QuotaScopeRepo, name: prComment.repoOwner + "/" + prComment.repoName},
+	}
+}
+
+// quotaUsage reads what the user or repository used this month
+func quotaUsage(ctx context.Context, r *jobqueue.Client, subject quotaSubject) (util.QuotaUsage, error) {
+	fields, err := r.HGetAll(ctx, util.QuotaUsageKey(util.QuotaPeriod(time.Now()), subject.scope, subject.name)).Result()
+	if err != nil {
+		return util.QuotaUsage{}, err
+	}
+	return util.ParseQuotaUsage(fields), nil
+}
+
+// quotaLimit returns the configured limit of the user or repository, lowered by the limits an admin
+// of the repository set
+func quotaLimit(ctx context.Context, r *jobqueue.Client, prComment *PRComment, subject quotaSubject) (util.QuotaLimit, error) {
+	fields, err := r.HGetAll(ctx, quotaLimitKey(prComment, subject)).Result()
+	if err != nil {
+		return util.QuotaLimit{}, err
+	}
+	return prComment.repoCfg.Quota.Limits(subject.scope).WithOverrides(fields), nil
+}
+
+// quotaLimitKey is the key of the limits the admins of the repository of the comment set for the subject
+func quotaLimitKey(prComment *PRComment, subject quotaSubject) string {
+	return util.QuotaLimitKey(prComment.repoOwner+"/"+prComment.repoName, subject.scope, subject.name)
+}
+
+// declineOverQuota reports whether the jobs would take the author or the repository over their
+// monthly quota, and declines them with a comment when they do. Redis errors let the jobs through.
+func declineOverQuota(ctx context.Context, logger *zap.SugaredLogger, client *github.Client, r *jobqueue.Client, prComment *PRComment, jobType string, jobs int) bool {
+	var reason string
+	for _, subject := range quotaSubjects(prComment) {
+		limit, err := quotaLimit(ctx, r, prComment, subject)
+		if err != nil {
+			logger.Errorf("Failed to read the quota of the %s, queueing anyway: %v", subject, err)
+			return false
+		}
+		usage, err := quotaUsage(ctx, r, subject)
+		if err != nil {
+			logger.Errorf("Failed to read the quota usage of the %s, queueing anyway: %v", subject, err)
+			return false
+		}
+		if reason = limit.Exceeded(usage, jobs); reason != "" {
+			reason = fmt.Sprintf("the %s is over the monthly quota, %s", subject, reason)
+			break
+		}
+	}
+	if reason == "" {
+		return false
+	}
+
+	logger.Infof("Declining %s job on %s/%s#%d by %s: %s", jobType, prComment.repoOwner, prComment.repoName, prComment.prNum, prComment.author, reason)
+	prComment.outcome = util.AuditOverQuota
+	params := util.PullRequestStatusParams{
+		RepoOwner: prComment.repoOwner,
+		RepoName:  prComment.repoName,
+		PrNum:     prComment.prNum,
+	}
+	params.Comment = util.Message(util.MessageQuotaExceeded, util.MessageData{JobType: jobType, Reason: reason})
+	if err := util.PostPullRequestComment(ctx, client, params); err != nil {
+		logger.Errorf("Failed to post comment on PR %s/%s#%d: %v", prComment.repoOwner, prComment.repoName, prComment.prNum, err)
+	}
+	return true
+}
+
+// recordQuotaJobs counts the queued jobs towards the quotas of the author and the repository
+func recordQuotaJobs(ctx context.Context, r *jobqueue.Client, prComment *PRComment, jobs int) error {
+	period := util.QuotaPeriod(time.Now())
+	for _, subject := range quotaSubjects(prComment) {
+		key := util.QuotaUsageKey(period, subject.scope, subject.name)
+		pipe := r.TxPipeline()
+		pipe.HIncrBy(ctx, key, util.QuotaFieldJobs, int64(jobs))
+		pipe.Expire(ctx, key, util.QuotaUsageTTL)
+		if _, err := pipe.Exec(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// quotaCommand reports the usage of the month of the author, or of `--user`, and of the
+// repository. Repository admins adjust the quotas with `quota set` and `quota reset`.
+func (h *PRCommentHandler) quotaCommand(ctx context.Context, client *github.Client, prComment *PRComment) error {
+	h.Logger.Infof("Quota command received on %s/%s#%d by %s",
+		prComment.repoOwner, prComment.repoName, prComment.prNum, prComment.author)
+
+	r := jobqueue.NewClient(h.RedisHostPort)
+
+	if len(prComment.args) > 0 && (prComment.args[0] == "set" || prComment.args[0] == "reset") {
+		return h.adjustQuota(ctx, client, r, prComment)
+	}
+
+	options, err := util.ParseCommandOptions(prComment.args, []string{"user"})
+	if err != nil {
+		return h.invalidOptions(ctx, client, prComment, "quota", err)
+	}
+	subjects := quotaSubjects(prComment)
+	if user, ok := options["user"]; ok {
+		subjects[0].name = strings.TrimPrefix(user, "@")
+	}
+	return h.postQuotas(ctx, client, r, prComment, "Quota usage for "+time.Now().UTC().Format("January 2006")+":", subjects)
+}
+
+// adjustQuota sets or resets the limits of a user or of the repository, for repository admins only.
+// The limits are those of the repository and can only be lowered below its configuration.
+func (h *PRCommentHandler) adjustQuota(ctx context.Context, client *github.Client, r *jobqueue.Client, prComment *PRComment) error {
+	params := util.PullRequestStatusParams{
+		RepoOwner: prComment.repoOwner,
+		RepoName:  prComment.repoName,
+		PrNum:     prComment.prNum,
+	}
+
+	permission, _, err := client.Repositories.GetPermissionLevel(ctx, prComment.repoOwner, prComment.repoName, prComment.author)
+	if err != nil || permission.GetPermission() != "admin" {
+		if err != nil {
+			h.Logger.Errorf("Failed to get the permission of %s on %s/%s: %v", prComment.author, prComment.repoOwner, prComment.repoName, err)
+		}
+		prComment.outcome = util.AuditDenied
+		params.Comment = util.Message(util.MessageQuotaDenied, util.MessageData{Author: prComment.author})
+		if err := util.PostPullRequestComment(ctx, client, params); err != nil {
+			h.Logger.Errorf("Failed to post comment on PR %s/%s#%d: %v", prComment.repoOwner, prComment.repoName, prComment.prNum, err)
+			return err
+		}
+		return nil
+	}
+
+	action, args := prComment.args[0], prComment.args[1:]
+	var subject quotaSubject
+	switch {
+	case len(args) > 0 && args[0] == util.QuotaScopeRepo:
+		subject = quotaSubject{scope: util.QuotaScopeRepo, name: prComment.repoOwner + "/" + prComment.repoName}
+		args = args[1:]
+	case len(args) > 1 && args[0] == util.QuotaScopeUser && !strings.HasPrefix(args[1], "--"):
+		subject = quotaSubject{scope: util.QuotaScopeUser, name: strings.TrimPrefix(args[1], "@")}
+		args = args[2:]
+	default:
+		return h.invalidOptions(ctx, client, prComment, "quota "+action, fmt.Errorf("expected `user <login>` or `repo`"))
+	}
+
+	key := quotaLimitKey(prComment, subject)
+	if action == "reset" {
+		if _, err := util.ParseCommandOptions(args, nil); err != nil {
+			return h.invalidOptions(ctx, client, prComment, "quota reset", err)
+		}
+		if err := r.Del(ctx, key).Err(); err != nil {
+			return err
+		}
+	} else {
+		options, err := util.ParseCommandOptions(args, []string{util.QuotaFieldJobs, util.QuotaFieldMinutes})
+		if err != nil {
+			return h.invalidOptions(ctx, client, prComment, "quota set", err)
+		}
+		limits, err := util.ParseQuotaLimits(options)
+		if err == nil {
+			err = prComment.repoCfg.Quota.Limits(subject.scope).CheckOverrides(limits)
+		}
+		if err != nil {
+			return h.invalidOptions(ctx, client, prComment, "quota set", err)
+		}
+		if err := r.HSet(ctx, key, limits).Err(); err != nil {
+			return err
+		}
+	}
+	h.Logger.Infof("Quota of the %s %s by %s", subject, action, prComment.author)
+	return h.postQuotas(ctx, client, r, prComment, fmt.Sprintf("Updated the quota of the %s:", subject), []quotaSubject{subject})
+}
+
+// postQuotas comments the usage of the month of the users and repositories against their limits
+func (h *PRCommentHandler) postQuotas(ctx context.Context, client *github.Client, r *jobqueue.Client, prComment *PRComment, title string, subjects []quotaSubject) error {
+	var lines []string
+	for _, subject := range subjects {
+		limit, err := quotaLimit(ctx, r, prComment, subject)
+		if err != nil {
+			return err
+		}
+		usage, err := quotaUsage(ctx, r, subject)
+		if err != nil {
+			return err
+		}
+		lines = append(lines, fmt.Sprintf("The %s: %s", subject, limit.Describe(usage)))
+	}
+
+	params := util.PullRequestStatusParams{
+		RepoOwner: prComment.repoOwner,
+		RepoName:  prComment.repoName,
+		PrNum:     prComment.prNum,
+		Comment:   util.Message(util.MessageQuotas, util.MessageData{Title: title, Items: lines}),
+	}
+	if err := util.PostPullRequestComment(ctx, client, params); err != nil {
+		h.Logger.Errorf("Failed to post comment on PR %s/%s#%d: %v", prComment.repoOwner, prComment.repoName, prComment.prNum, err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+package handlers
+
+import (
+	"context"
+
+	"github.com/google/go-github/v61/github"
+	"github.com/instructlab/instructlab-bot/gobot/util"
+	"go.uber.org/zap"
+)
+
+// withRepoFile applies the repository file of the repository to its configuration. An invalid
+// or unreachable file is logged and the configuration of the bot is kept.
+func withRepoFile(ctx context.Context, logger *zap.SugaredLogger, files *util.RepoFiles, client *github.Client, repoOwner, repoName string, repoCfg util.RepoConfig) util.RepoConfig {
+	if files == nil {
+		return repoCfg
+	}
+	file, err := files.Get(ctx, client, repoOwner, repoName)
+	if err != nil {
+		logger.Warnf("Ignoring the %s of %s/%s: %v", util.RepoFileName, repoOwner, repoName, err)
+		return repoCfg
+	}
+	return repoCfg.WithRepoFile(file)
+}
@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v61/github"
+	"github.com/instructlab/instructlab-bot/gobot/common"
+	"github.com/instructlab/instructlab-bot/gobot/util"
+	"github.com/instructlab/instructlab-bot/pkg/jobqueue"
+	"github.com/palantir/go-githubapp/githubapp"
+	"go.uber.org/zap"
+)
+
+const schedulerInterval = 30 * time.Second
+
+// Scheduler queues the scheduled jobs of the configured repositories
+type Scheduler struct {
+	githubapp.ClientCreator
+	Logger        *zap.SugaredLogger
+	RedisHostPort string
+	RepoConfigs   util.RepoConfigs
+}
+
+// Run queues the jobs of the schedules due in each minute until the context is cancelled
+func (s *Scheduler) Run(ctx context.Context) {
+	r := jobqueue.NewClient(s.RedisHostPort)
+
+	ticker := time.NewTicker(schedulerInterval)
+	defer ticker.Stop()
+	var lastMinute time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			s.Logger.Info("Context cancelled, stopping scheduler")
+			return
+		case now := <-ticker.C:
+			minute := now.UTC().Truncate(time.Minute)
+			if !minute.After(lastMinute) {
+				continue
+			}
+			lastMinute = minute
+			s.queueDueJobs(ctx, r, minute)
+		}
+	}
+}
+
+// queueDueJobs queues the jobs of the schedules due in the minute. The jobs of the schedules of a
+// repository due together and sharing a tracking issue are grouped, their results are summarized
+// in one comment on the issue rather than commented one by one.
+func (s *Scheduler) queueDueJobs(ctx context.Context, r *jobqueue.Client, minute time.Time) {
+	for fullName, cfg := range s.RepoConfigs {
+		due := make(map[int][]util.ScheduleConfig)
+		var issues []int
+		for _, schedule := range cfg.Schedules {
+			cron, err := util.ParseCron(schedule.Cron)
+			if err != nil || !cron.Matches(minute) {
+				continue
+			}
+
+			// Bot replicas sharing the Redis instance must not queue the same run twice
+			runKey := fmt.Sprintf("schedules:%s:%s:%d", fullName, schedule.Name, minute.Unix())
+			first, err := r.SetNX(ctx, runKey, minute.Unix(), time.Hour).Result()
+			if err != nil {
+				s.Logger.Errorf("Failed to claim the %s run of schedule %s for %s: %v", minute, schedule.Name, fullName, err)
+				continue
+			}
+			if !first {
+				continue
+			}
+			if _, ok := due[schedule.TrackingIssue]; !ok {
+				issues = append(issues, schedule.TrackingIssue)
+			}
+			due[schedule.TrackingIssue] = append(due[schedule.TrackingIssue], schedule)
+		}
+
+		for _, issue := range issues {
+			schedules := due[issue]
+			var group *jobqueue.Group
+			var client *github.Client
+			if issue > 0 && len(schedules) > 1 {
+				group, client = s.newScheduleGroup(ctx, r, fullName, issue, schedules, minute)
+			}
+			for _, schedule := range schedules {
+				jobID, err := s.queueScheduledJob(ctx, r, fullName, schedule, group)
+				if err != nil {
+					s.Logger.Errorf("Failed to queue schedule %s for %s: %v", schedule.Name, fullName, err)
+					continue
+				}
+				s.Logger.Infof("Queued job %s of schedule %s for %s against %s", jobID, schedule.Name, fullName, schedule.Branch)
+			}
+			if group != nil {
+				if err := updateGroupSummary(ctx, client, r, group); err != nil {
+					s.Logger.Errorf("Failed to update the summary of group %s on %s#%d: %v", group.ID, fullName, group.Issue, err)
+				}
+			}
+		}
+	}
+}
+
+// newScheduleGroup posts the summary of the runs of the schedules on their tracking issue and
+// returns their group, nil when it could not be posted and the runs report one by one
+func (s *Scheduler) newScheduleGroup(ctx context.Context, r *jobqueue.Client, fullName string, issue int, schedules []util.ScheduleConfig, minute time.Time) (*jobqueue.Group, *github.Client) {
+	repoOwner, repoName, _ := strings.Cut(fullName, "/")
+	installID := s.installationID(ctx, repoOwner, repoName)
+	if installID == 0 {
+		return nil, nil
+	}
+	client, err := s.NewInstallationClient(installID)
+	if err != nil {
+		s.Logger.Errorf("Failed to create installation client: %v", err)
+		return nil, nil
+	}
+	names := make([]string, 0, len(schedules))
+	for _, schedule := range schedules {
+		names = append(names, schedule.Name)
+	}
+	group, err := postGroupComment(ctx, client, r, jobqueue.Group{
+		Title:          fmt.Sprintf("Scheduled runs of %s: %s", minute.UTC().Format("2006-01-02 15:04 UTC"), strings.Join(names, ", ")),
+		RepoOwner:      repoOwner,
+		RepoName:       repoName,
+		InstallationID: installID,
+		Issue:          issue,
+	})
+	if err != nil {
+		s.Logger.Errorf("Failed to post the summary of the scheduled runs on %s#%d, reporting them one by one: %v", fullName, issue, err)
+		return nil, nil
+	}
+	return group, client
+}
+
+// queueScheduledJob queues the job of the schedule, in the group when there is one
+func (s *Scheduler) queueScheduledJob(ctx context.Context, r *jobqueue.Client, fullName string, schedule util.ScheduleConfig, group *jobqueue.Group) (string, error) {
+	repoOwner, repoName, _ := strings.Cut(fullName, "/")
+	repoCfg, _ := s.RepoConfigs.Lookup(repoOwner, repoName, common.RepoName, util.RepoConfig{})
+
+	jobOptions, err := schedule.JobOptions()
+	if err != nil {
+		return "", err
+	}
+	jobOptions[jobqueue.FieldBranch] = schedule.Branch
+	jobOptions[jobqueue.FieldSchedule] = schedule.Name
+	if schedule.TrackingIssue > 0 {
+		jobOptions[jobqueue.FieldTrackingIssue] = strconv.Itoa(schedule.TrackingIssue)
+	}
+	if group != nil {
+		jobOptions[jobqueue.FieldGroup] = group.ID
+	}
+
+	job := &PRComment{
+		repoOwner: repoOwner,
+		repoName:  repoName,
+		author:    "schedule/" + schedule.Name,
+		installID: s.installationID(ctx, repoOwner, repoName),
+		repoCfg:   repoCfg,
+	}
+	jobID, err := createJob(ctx, r, job, schedule.JobType(), jobOptions)
+	if err != nil {
+		return "", err
+	}
+	if err := addToGroup(ctx, r, jobOptions, jobID); err != nil {
+		s.Logger.Errorf("Failed to add job %s to group %s: %v", jobID, group.ID, err)
+	}
+	return jobID, r.Enqueue(ctx, jobID)
+}
+
+// installationID looks up the app installation of the repository, which is needed to comment
+// the results on the tracking issue
+func (s *Scheduler) installationID(ctx context.Context, repoOwner, repoName string) int64 {
+	client, err := s.NewAppClient()
+	if err != nil {
+		s.Logger.Errorf("Failed to create app client: %v", err)
+		return 0
+	}
+	installation, _, err := client.Apps.FindRepositoryInstallation(ctx, repoOwner, repoName)
+	if err != nil {
+		s.Logger.Errorf("Failed to find the app installation of %s/%s: %v", repoOwner, repoName, err)
+		return 0
+	}
+	return installation.GetID()
+}
@@ -0,0 +1,303 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/go-github/v61/github"
+	"github.com/instructlab/instructlab-bot/gobot/util"
+	"github.com/instructlab/instructlab-bot/pkg/jobqueue"
+	"github.com/palantir/go-githubapp/githubapp"
+	"go.uber.org/zap"
+)
+
+const statusCommentInterval = time.Minute
+
+// StatusCommentUpdater keeps the status comments of the queued and running jobs up to date
+type StatusCommentUpdater struct {
+	githubapp.ClientCreator
+	Logger        *zap.SugaredLogger
+	RedisHostPort string
+	// posted is the last body of every comment, a comment is only edited when it changes
+	posted map[string]string
+}
+
+// Run edits the status comments every statusCommentInterval until the context is cancelled
+func (u *StatusCommentUpdater) Run(ctx context.Context) {
+	r := jobqueue.NewClient(u.RedisHostPort)
+	u.posted = make(map[string]string)
+
+	ticker := time.NewTicker(statusCommentInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			u.Logger.Info("Context cancelled, stopping status comment updates")
+			return
+		case <-ticker.C:
+			jobIDs, err := r.SMembers(ctx, jobqueue.KeyStatusComments).Result()
+			if err != nil {
+				u.Logger.Errorf("Failed to list the status comments: %v", err)
+				continue
+			}
+			active := make(map[string]bool, len(jobIDs))
+			for _, jobID := range jobIDs {
+				active[jobID] = true
+				u.updateStatusComment(ctx, r, jobID)
+			}
+			for jobID := range u.posted {
+				if !active[jobID] {
+					delete(u.posted, jobID)
+				}
+			}
+		}
+	}
+}
+
+func (u *StatusCommentUpdater) updateStatusComment(ctx context.Context, r *jobqueue.Client, jobID string) {
+	// Jobs with results are finished by the results loop
+	if status, _ := r.Get(ctx, jobID, jobqueue.FieldStatus); status == jobqueue.StatusSuccess || status == jobqueue.StatusError {
+		return
+	}
+	status, err := jobStatus(ctx, r, jobID)
+	if err != nil {
+		u.Logger.Errorf("Failed to read the status of job %s: %v", jobID, err)
+		return
+	}
+	body := util.StatusComment(status, time.Now())
+	if u.posted[jobID] == body {
+		return
+	}
+
+	params, commentID, installID, err := statusCommentParams(ctx, r, jobID)
+	if err != nil {
+		u.Logger.Errorf("Failed to find the status comment of job %s: %v", jobID, err)
+		return
+	}
+	client, err := u.NewInstallationClient(installID)
+	if err != nil {
+		u.Logger.Errorf("Failed to create installation client: %v", err)
+		return
+	}
+	params.Comment = body
+	if err := util.EditPullRequestComment(ctx, client, params, commentID); err != nil {
+		u.Logger.Errorf("Failed to update the status comment of job %s on %s/%s#%d: %v", jobID, params.RepoOwner, params.RepoName, params.PrNum, err)
+		return
+	}
+	u.posted[jobID] = body
+}
+
+// statusCommentParams returns the PR and ID of the status comment of a job and the installation
+// it was posted with
+func statusCommentParams(ctx context.Context, r *jobqueue.Client, jobID string) (util.PullRequestStatusParams, int64, int64, error) {
+	params := util.PullRequestStatusParams{JobID: jobID}
+	get := func(field jobqueue.Field) (int64, error) {
+		value, err := r.GetInt(ctx, jobID, field)
+		if err == nil && value == 0 {
+			err = fmt.Errorf("job %s has no %s", jobID, field)
+		}
+		return value, err
+	}
+	commentID, err := get(jobqueue.FieldStatusComment)
+	if err != nil {
+		return params, 0, 0, err
+	}
+	installID, err := get(jobqueue.FieldInstallationID)
+	if err != nil {
+		return params, 0, 0, err
+	}
+	prNum, err := get(jobqueue.FieldPRNumber)
+	if err != nil {
+		return params, 0, 0, err
+	}
+	params.PrNum = int(prNum)
+	if params.RepoOwner, err = r.Get(ctx, jobID, jobqueue.FieldRepoOwner); err != nil {
+		return params, 0, 0, err
+	}
+	if params.RepoName, err = r.Get(ctx, jobID, jobqueue.FieldRepoName); err != nil {
+		return params, 0, 0, err
+	}
+	return params, commentID, installID, nil
+}
+
+// jobStatus reads what the status comment of a job tells about it: its place in the queue or
+// its progress, and the estimated duration of the jobs of its type and size
+func jobStatus(ctx context.Context, r *jobqueue.Client, jobID string) (util.JobStatus, error) {
+	status := util.JobStatus{JobID: jobID}
+	var err error
+	if status.JobType, err = r.Get(ctx, jobID, jobqueue.FieldJobType); err != nil {
+		return status, err
+	}
+
+	startTime, err := r.GetInt(ctx, jobID, jobqueue.FieldStartTime)
+	if err != nil {
+		return status, err
+	}
+	if startTime > 0 {
+		status.Started = time.Unix(startTime, 0)
+		if progressJSON, _ := r.Get(ctx, jobID, jobqueue.FieldProgress); progressJSON != "" {
+			if err := json.Unmarshal([]byte(progressJSON), &status.Progress); err != nil {
+				return status, err
+			}
+		}
+	} else {
+		if status.Deferred, err = r.IsDeferred(ctx, jobID); err != nil {
+			return status, err
+		}
+		if status.Maintenance, err = maintenanceNotice(ctx, r); err != nil {
+			return status, err
+		}
+		if !status.Deferred {
+			status.Position, status.Wait, status.WaitKnown, err = queueWait(ctx, r, jobID)
+			if err != nil {
+				return status, err
+			}
+		}
+	}
+
+	files, err := r.GetInt(ctx, jobID, jobqueue.FieldChangedFiles)
+	if err != nil {
+		return status, err
+	}
+	samples, err := r.LRange(ctx, jobqueue.DurationSamplesKey(status.JobType), 0, -1).Result()
+	if err != nil {
+		return status, err
+	}
+	status.Estimate, status.EstimateKnown = util.EstimateDuration(samples, int(files), status.Progress.Total)
+	return status, nil
+}
+
+// maintenanceNotice is the notice of the maintenance in progress, "" when there is none
+func maintenanceNotice(ctx context.Context, r *jobqueue.Client) (string, error) {
+	maintenance, err := r.Maintenance(ctx)
+	if err != nil || maintenance == nil {
+		return "", err
+	}
+	return maintenance.Notice(), nil
+}
+
+// queueWait returns the position of a queued job and estimates when it starts from the recent
+// durations of the job types ahead of it. Workers pop jobs from the right of the queue. The workers
+// busy with the running jobs are taken as the active workers, they take the jobs ahead as the
+// running ones finish.
+func queueWait(ctx context.Context, r *jobqueue.Client, jobID string) (int, time.Duration, bool, error) {
+	queued, err := r.Queued(ctx)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	ahead := queued
+	for i, id := range queued {
+		if id == jobID {
+			ahead = queued[i+1:]
+			break
+		}
+	}
+	running, err := r.Running(ctx)
+	if err != nil {
+		return 0, 0, false, err
+	}
+
+	averages := make(map[string]time.Duration)
+	average := func(id string) (time.Duration, bool) {
+		jobType, _ := r.Get(ctx, id, jobqueue.FieldJobType)
+		if average, ok := averages[jobType]; ok {
+			return average, true
+		}
+		durations, _ := r.LRange(ctx, jobqueue.DurationsKey(jobType), 0, -1).Result()
+		average, ok := util.AverageDuration(durations)
+		if ok {
+			averages[jobType] = average
+		}
+		return average, ok
+	}
+
+	now := time.Now()
+	remaining := make([]time.Duration, 0, len(running))
+	for _, id := range running {
+		duration, ok := average(id)
+		if !ok {
+			return len(ahead) + 1, 0, false, nil
+		}
+		if started, err := r.GetInt(ctx, id, jobqueue.FieldStartTime); err == nil && started > 0 {
+			duration -= now.Sub(time.Unix(started, 0))
+		}
+		remaining = append(remaining, duration)
+	}
+	durations := make([]time.Duration, 0, len(ahead))
+	for _, id := range ahead {
+		duration, ok := average(id)
+		if !ok {
+			return len(ahead) + 1, 0, false, nil
+		}
+		durations = append(durations, duration)
+	}
+	return len(ahead) + 1, util.QueueStart(remaining, durations), true, nil
+}
+
+// postStatusComment acknowledges a queued job with its status comment, which is then kept up to
+// date by the StatusCommentUpdater
+func postStatusComment(ctx context.Context, r *jobqueue.Client, client *github.Client, params util.PullRequestStatusParams) error {
+	status, err := jobStatus(ctx, r, params.JobID)
+	if err != nil {
+		return err
+	}
+	params.Comment = util.StatusComment(status, time.Now())
+	commentID, err := util.CreatePullRequestComment(ctx, client, params)
+	if err != nil {
+		return err
+	}
+	if err := r.Set(ctx, params.JobID, jobqueue.FieldStatusComment, commentID); err != nil {
+		return err
+	}
+	return r.SAdd(ctx, jobqueue.KeyStatusComments, params.JobID).Err()
+}
+
+// FinishStatusComment tells on the status comment of a job, if it has one, that the job is done
+// and stops its updates
+func FinishStatusComment(ctx context.Context, r *jobqueue.Client, logger *zap.SugaredLogger, client *github.Client, jobID string, failed bool) {
+	if member, err := r.SIsMember(ctx, jobqueue.KeyStatusComments, jobID).Result(); err != nil || !member {
+		return
+	}
+	params, commentID, _, err := statusCommentParams(ctx, r, jobID)
+	if err != nil {
+		logger.Errorf("Failed to find the status comment of job %s: %v", jobID, err)
+		return
+	}
+	status := util.JobStatus{JobID: jobID, Finished: true, Failed: failed}
+	status.JobType, _ = r.Get(ctx, jobID, jobqueue.FieldJobType)
+	if seconds, err := r.GetInt(ctx, jobID, jobqueue.FieldDuration); err == nil {
+		status.Duration = time.Duration(seconds) * time.Second
+	}
+	params.Comment = util.StatusComment(status, time.Now())
+	if err := util.EditPullRequestComment(ctx, client, params, commentID); err != nil {
+		logger.Errorf("Failed to finish the status comment of job %s on %s/%s#%d: %v", jobID, params.RepoOwner, params.RepoName, params.PrNum, err)
+	}
+	if err := r.SRem(ctx, jobqueue.KeyStatusComments, jobID).Err(); err != nil {
+		logger.Errorf("Failed to stop the status comment updates of job %s: %v", jobID, err)
+	}
+}
+
+// RecordDurationSample keeps the duration of a successful job with the size of its PR, for the
+// completion estimates of the status comments
+func RecordDurationSample(ctx context.Context, r *jobqueue.Client, jobID, jobType string, seconds int64) error {
+	sample := util.DurationSample{Seconds: float64(seconds)}
+	files, _ := r.GetInt(ctx, jobID, jobqueue.FieldChangedFiles)
+	sample.Files = int(files)
+	if progressJSON, _ := r.Get(ctx, jobID, jobqueue.FieldProgress); progressJSON != "" {
+		var progress util.JobProgress
+		if err := json.Unmarshal([]byte(progressJSON), &progress); err == nil {
+			sample.Questions = progress.Total
+		}
+	}
+	sampleJSON, err := json.Marshal(sample)
+	if err != nil {
+		return err
+	}
+	key := jobqueue.DurationSamplesKey(jobType)
+	if err := r.LPush(ctx, key, sampleJSON).Err(); err != nil {
+		return err
+	}
+	return r.LTrim(ctx, key, 0, util.MaxDurationSamples-1).Err()
+}
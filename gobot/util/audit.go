@@ -0,0 +1,109 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// AuditPrefix is the default S3 prefix of the command audit log
+const AuditPrefix = "audit/commands"
+
+// The outcomes of the commands in the audit log
+const (
+	// AuditQueued commands queued the jobs of the record
+	AuditQueued = "queued"
+	// AuditAnswered commands were answered by the bot without a job, such as help
+	AuditAnswered = "answered"
+	// AuditDenied commands were sent by a user who is not allowed to run them
+	AuditDenied       = "denied"
+	AuditDisabled     = "disabled"
+	AuditMissingLabel = "missing-label"
+	AuditInvalid      = "invalid-options"
+	AuditUnknown      = "unknown-command"
+	// AuditOverQuota commands would have taken the user or the repository over their monthly quota
+	AuditOverQuota = "over-quota"
+	// AuditOverCapacity commands were declined while the queue was over capacity, AuditDeferred
+	// commands had their jobs deferred to the off-peak hours
+	AuditOverCapacity = "over-capacity"
+	AuditDeferred     = "deferred"
+	// AuditDuplicate commands are comments that already queued a job
+	AuditDuplicate = "duplicate"
+	// AuditFailed commands failed before the bot could answer them
+	AuditFailed = "failed"
+)
+
+// AuditRecord is a bot command received on a PR, one object of the audit log
+type AuditRecord struct {
+	Time      time.Time `json:"time"`
+	User      string    `json:"user"`
+	Repo      string    `json:"repo"`
+	PR        int       `json:"pr"`
+	CommentID int64     `json:"comment_id"`
+	Command   string    `json:"command"`
+	Args      []string  `json:"args,omitempty"`
+	Outcome   string    `json:"outcome"`
+	// JobIDs are the queued jobs, every stage of a pipeline
+	JobIDs []string `json:"job_ids,omitempty"`
+	Error  string   `json:"error,omitempty"`
+}
+
+// AuditKey is the key of the record in the audit log. Records are grouped by UTC day so
+// a time range only lists the days it covers, and never overwrite each other.
+func AuditKey(prefix string, record AuditRecord) string {
+	t := record.Time.UTC()
+	name := fmt.Sprintf("%s-%d.json", t.Format("20060102T150405.000000000Z"), record.CommentID)
+	return path.Join(prefix, t.Format("2006/01/02"), name)
+}
+
+// AuditLog appends the bot commands to an S3 bucket, one object per command. A nil log
+// records nothing.
+type AuditLog struct {
+	svc    *s3.Client
+	bucket string
+	prefix string
+}
+
+// NewAuditLog returns the audit log of the bucket, nil when no bucket is configured
+func NewAuditLog(ctx context.Context, bucket, region, prefix string) (*AuditLog, error) {
+	if bucket == "" {
+		return nil, nil
+	}
+	cfg, err := awsconfig.LoadDefaultConfig(ctx, awsconfig.WithRegion(region))
+	if err != nil {
+		return nil, fmt.Errorf("could not load the AWS config of the audit log: %w", err)
+	}
+	if prefix == "" {
+		prefix = AuditPrefix
+	}
+	return &AuditLog{svc: s3.NewFromConfig(cfg), bucket: bucket, prefix: strings.Trim(prefix, "/")}, nil
+}
+
+// Record appends the record to the log
+func (a *AuditLog) Record(ctx context.Context, record AuditRecord) error {
+	if a == nil {
+		return nil
+	}
+	if record.Time.IsZero() {
+		record.Time = time.Now()
+	}
+	body, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	_, err = a.svc.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(a.bucket),
+		Key:         aws.String(AuditKey(a.prefix, record)),
+		Body:        bytes.NewReader(body),
+		ContentType: aws.String("application/json"),
+	})
+	return err
+}
@@ -0,0 +1,23 @@
+package util
+
+import "strings"
+
+// BuildInfoMarkdown tells which builds of the bot, the worker and ilab ran a job, at the bottom
+// of its results so that a change of behavior can be traced to a deployment. It is empty when
+// none is known.
+func BuildInfoMarkdown(botVersion, workerVersion, ilabVersion string) string {
+	var parts []string
+	for _, build := range []struct{ name, version string }{
+		{"bot", botVersion},
+		{"worker", workerVersion},
+		{"ilab", ilabVersion},
+	} {
+		if build.version != "" {
+			parts = append(parts, build.name+" "+build.version)
+		}
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "<sub>" + strings.Join(parts, " · ") + "</sub>"
+}
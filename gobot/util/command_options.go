@@ -0,0 +1,319 @@
+package util
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/instructlab/instructlab-bot/pkg/jobqueue"
+)
+
+// SplitCommandArgs splits a comment into words like a shell would, keeping double or single
+// quoted text such as `--system-prompt "Be brief."` together
+func SplitCommandArgs(text string) []string {
+	var args []string
+	var current strings.Builder
+	var quote rune
+	inArg := false
+	for _, r := range text {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			current.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote = r
+			inArg = true
+		case unicode.IsSpace(r):
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args
+}
+
+// FindCommand finds the bot command of a comment: the first of triggers, such as the bot mention
+// or a slash command like `/ilab`, anywhere in the first line that is not blank nor quoted with
+// `>`. Triggers match case-insensitively as whole words. It returns the trigger as configured,
+// and the command followed by its arguments.
+func FindCommand(body string, triggers []string) (string, []string) {
+	lineStart := 0
+	for _, line := range strings.Split(body, "\n") {
+		offset := lineStart
+		lineStart += len(line) + 1
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, ">") {
+			continue
+		}
+		start, found := -1, ""
+		for _, trigger := range triggers {
+			if i := findWord(line, trigger); i >= 0 && (start < 0 || i < start) {
+				start, found = i, trigger
+			}
+		}
+		if start < 0 {
+			return "", nil
+		}
+		// The arguments may go on after the first line, like a quoted system prompt
+		args := SplitCommandArgs(body[offset+start+len(found):])
+		if len(args) == 0 {
+			return "", nil
+		}
+		args[0] = strings.ToLower(args[0])
+		return found, args
+	}
+	return "", nil
+}
+
+// findWord returns the index of the first case-insensitive occurrence of word in s, between
+// spaces or the ends of s, or -1
+func findWord(s, word string) int {
+	if word == "" {
+		return -1
+	}
+	for i := 0; i+len(word) <= len(s); i++ {
+		if !strings.EqualFold(s[i:i+len(word)], word) {
+			continue
+		}
+		if i > 0 {
+			if r, _ := utf8.DecodeLastRuneInString(s[:i]); !unicode.IsSpace(r) {
+				continue
+			}
+		}
+		if end := i + len(word); end < len(s) {
+			if r, _ := utf8.DecodeRuneInString(s[end:]); !unicode.IsSpace(r) {
+				continue
+			}
+		}
+		return i
+	}
+	return -1
+}
+
+// commandFlags are the options that take no value, `--dry-run` alone reads as `--dry-run=true`
+var commandFlags = []string{"dry-run", "grounded"}
+
+// ParseCommandOptions parses `--name value` and `--name=value` options following a bot command.
+// Only the options listed in allowed are accepted.
+func ParseCommandOptions(args []string, allowed []string) (map[string]string, error) {
+	options := make(map[string]string)
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "--") {
+			return nil, fmt.Errorf("unexpected argument `%s`", arg)
+		}
+		name, value, hasValue := strings.Cut(strings.TrimPrefix(arg, "--"), "=")
+		if !contains(allowed, name) {
+			if len(allowed) == 0 {
+				return nil, fmt.Errorf("unknown option `--%s`, this command takes no options", name)
+			}
+			return nil, fmt.Errorf("unknown option `--%s`, supported options are: --%s", name, strings.Join(allowed, ", --"))
+		}
+		if !hasValue && contains(commandFlags, name) {
+			options[name] = "true"
+			continue
+		}
+		if !hasValue {
+			if i+1 >= len(args) || strings.HasPrefix(args[i+1], "--") {
+				return nil, fmt.Errorf("option `--%s` requires a value", name)
+			}
+			i++
+			value = args[i]
+		}
+		options[name] = value
+	}
+	return options, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateGenerationOptions checks the model generation options of a command and returns them
+// keyed by their job key
+func ValidateGenerationOptions(options map[string]string) (map[jobqueue.Field]string, error) {
+	jobOptions := make(map[jobqueue.Field]string)
+	if value, ok := options["temperature"]; ok {
+		temperature, err := strconv.ParseFloat(value, 64)
+		if err != nil || temperature < 0 || temperature > 2 {
+			return nil, fmt.Errorf("`--temperature` must be a number between 0 and 2")
+		}
+		jobOptions[jobqueue.FieldTemperature] = value
+	}
+	if value, ok := options["max-tokens"]; ok {
+		maxTokens, err := strconv.Atoi(value)
+		if err != nil || maxTokens <= 0 {
+			return nil, fmt.Errorf("`--max-tokens` must be a positive integer")
+		}
+		jobOptions[jobqueue.FieldMaxTokens] = value
+	}
+	if value, ok := options["top-p"]; ok {
+		topP, err := strconv.ParseFloat(value, 64)
+		if err != nil || topP <= 0 || topP > 1 {
+			return nil, fmt.Errorf("`--top-p` must be a number greater than 0 and at most 1")
+		}
+		jobOptions[jobqueue.FieldTopP] = value
+	}
+	if value, ok := options["system-prompt"]; ok {
+		if strings.TrimSpace(value) == "" {
+			return nil, fmt.Errorf("`--system-prompt` must not be empty")
+		}
+		jobOptions[jobqueue.FieldSystemPrompt] = value
+	}
+	return jobOptions, nil
+}
+
+// ApplyDryRunOption checks the `--dry-run` flag of a command and marks the job as a dry run
+// when it is set
+func ApplyDryRunOption(options map[string]string, jobOptions map[jobqueue.Field]string) error {
+	return applyFlagOption(options, "dry-run", jobqueue.FieldDryRun, jobOptions)
+}
+
+// ApplyGroundedOption checks the `--grounded` flag of the precheck command, which asks the
+// knowledge questions without their context too
+func ApplyGroundedOption(options map[string]string, jobOptions map[jobqueue.Field]string) error {
+	return applyFlagOption(options, "grounded", jobqueue.FieldGrounded, jobOptions)
+}
+
+// maxParaphrases bounds the paraphrases of each precheck question, each is asked to every model
+const maxParaphrases = 5
+
+// ApplyParaphrasesOption checks the `--paraphrases` option of the precheck command, which asks
+// each question again in that many other wordings
+func ApplyParaphrasesOption(options map[string]string, jobOptions map[jobqueue.Field]string) error {
+	value, ok := options["paraphrases"]
+	if !ok {
+		return nil
+	}
+	if paraphrases, err := strconv.Atoi(value); err != nil || paraphrases < 1 || paraphrases > maxParaphrases {
+		return fmt.Errorf("`--paraphrases` must be an integer between 1 and %d", maxParaphrases)
+	}
+	jobOptions[jobqueue.FieldParaphrases] = value
+	return nil
+}
+
+// Bounds of the PRs a backfill prechecks
+const (
+	defaultBackfillLimit = 50
+	maxBackfillLimit     = 500
+)
+
+// BackfillLimit returns how many PRs a backfill prechecks at most, `--limit` or 50 by default
+func BackfillLimit(options map[string]string) (int, error) {
+	value, ok := options["limit"]
+	if !ok {
+		return defaultBackfillLimit, nil
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 1 || limit > maxBackfillLimit {
+		return 0, fmt.Errorf("`--limit` must be an integer between 1 and %d", maxBackfillLimit)
+	}
+	return limit, nil
+}
+
+// applyFlagOption sets the job field of a flag to "true" when the flag is set
+func applyFlagOption(options map[string]string, name string, field jobqueue.Field, jobOptions map[jobqueue.Field]string) error {
+	value, ok := options[name]
+	if !ok {
+		return nil
+	}
+	switch value {
+	case "true":
+		jobOptions[field] = "true"
+	case "false":
+	default:
+		return fmt.Errorf("`--%s` takes no value, or `true` or `false`", name)
+	}
+	return nil
+}
+
+// ValidateTrainOptions checks the options of the train command and returns them keyed by their job key
+func ValidateTrainOptions(options map[string]string) (map[jobqueue.Field]string, error) {
+	jobOptions := make(map[jobqueue.Field]string)
+	if value, ok := options["generate-job"]; ok {
+		if job, err := strconv.Atoi(value); err != nil || job <= 0 {
+			return nil, fmt.Errorf("`--generate-job` must be the ID of a generate-local job")
+		}
+		jobOptions[jobqueue.FieldGenerateJob] = value
+	}
+	if value, ok := options["num-epochs"]; ok {
+		if epochs, err := strconv.Atoi(value); err != nil || epochs <= 0 {
+			return nil, fmt.Errorf("`--num-epochs` must be a positive integer")
+		}
+		jobOptions[jobqueue.FieldNumEpochs] = value
+	}
+	if value, ok := options["iters"]; ok {
+		if iters, err := strconv.Atoi(value); err != nil || iters <= 0 {
+			return nil, fmt.Errorf("`--iters` must be a positive integer")
+		}
+		jobOptions[jobqueue.FieldIters] = value
+	}
+	return jobOptions, nil
+}
+
+// ValidateEvaluateOptions checks the options of the evaluate command and returns them keyed by their job key
+func ValidateEvaluateOptions(options map[string]string) (map[jobqueue.Field]string, error) {
+	jobOptions := make(map[jobqueue.Field]string)
+	if value, ok := options["benchmark"]; ok {
+		if value != "mmlu" && value != "mt_bench" && value != "mt_bench_branch" {
+			return nil, fmt.Errorf("`--benchmark` must be `mmlu`, `mt_bench` or `mt_bench_branch`")
+		}
+		jobOptions[jobqueue.FieldBenchmark] = value
+	}
+	for option, key := range map[string]jobqueue.Field{
+		"model":       jobqueue.FieldModel,
+		"base-model":  jobqueue.FieldBaseModel,
+		"base-branch": jobqueue.FieldBaseBranch,
+	} {
+		value, ok := options[option]
+		if !ok {
+			continue
+		}
+		if strings.TrimSpace(value) == "" || strings.HasPrefix(value, "-") {
+			return nil, fmt.Errorf("`--%s` must be a name, not `%s`", option, value)
+		}
+		jobOptions[key] = value
+	}
+	return jobOptions, nil
+}
+
+// ValidatePipelineOptions checks the generate-local pipeline options of a command and returns them
+// keyed by their job key
+func ValidatePipelineOptions(options map[string]string) (map[jobqueue.Field]string, error) {
+	jobOptions := make(map[jobqueue.Field]string)
+	if value, ok := options["pipeline"]; ok {
+		if value != "simple" && value != "full" {
+			return nil, fmt.Errorf("`--pipeline` must be `simple` or `full`")
+		}
+		jobOptions[jobqueue.FieldPipeline] = value
+	}
+	if value, ok := options["sdg-scale-factor"]; ok {
+		if scale, err := strconv.Atoi(value); err != nil || scale <= 0 {
+			return nil, fmt.Errorf("`--sdg-scale-factor` must be a positive integer")
+		}
+		jobOptions[jobqueue.FieldSdgScaleFactor] = value
+	}
+	if value, ok := options["chunk-word-count"]; ok {
+		if count, err := strconv.Atoi(value); err != nil || count <= 0 {
+			return nil, fmt.Errorf("`--chunk-word-count` must be a positive integer")
+		}
+		jobOptions[jobqueue.FieldChunkWordCount] = value
+	}
+	return jobOptions, nil
+}
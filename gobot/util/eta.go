@@ -0,0 +1,226 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MaxDurationSamples is how many recent jobs per job type the completion estimates are based on
+const MaxDurationSamples = 200
+
+// minEstimateSamples is the number of jobs needed for an estimate, the jobs of a similar size are
+// only used on their own when there are that many of them
+const minEstimateSamples = 3
+
+// DurationSample is the duration of a successful job with the size features of its PR
+type DurationSample struct {
+	Seconds float64 `json:"seconds"`
+	// Files is the number of files changed by the PR, 0 when unknown
+	Files int `json:"files,omitempty"`
+	// Questions is the number of questions the job asked, 0 when unknown
+	Questions int `json:"questions,omitempty"`
+}
+
+// JobProgress is the partial progress a worker publishes on a running job
+type JobProgress struct {
+	Done  int `json:"done"`
+	Total int `json:"total"`
+	// UpdatedAt is the Unix time of the update, the heartbeat of the worker
+	UpdatedAt int64 `json:"updated_at,omitempty"`
+}
+
+// DurationEstimate is the expected duration of a job from the recent jobs of its type
+type DurationEstimate struct {
+	P50     time.Duration
+	P90     time.Duration
+	Samples int
+	// Similar is set when only the jobs of a similar size were used
+	Similar bool
+}
+
+// sizeBucket groups sizes by powers of 4: 1, 2-4, 5-16, 17-64... 0 is unknown
+func sizeBucket(n int) int {
+	if n <= 0 {
+		return 0
+	}
+	return 1 + int(math.Ceil(math.Log(float64(n))/math.Log(4)))
+}
+
+// EstimateDuration returns the median and 90th percentile durations of the recorded samples of a
+// job type, from the jobs with as many files and questions when there are enough of them.
+// Unparseable samples are ignored.
+func EstimateDuration(samples []string, files, questions int) (DurationEstimate, bool) {
+	var all []DurationSample
+	for _, s := range samples {
+		var sample DurationSample
+		if err := json.Unmarshal([]byte(s), &sample); err != nil || sample.Seconds < 0 {
+			continue
+		}
+		all = append(all, sample)
+	}
+
+	similar := func(sample DurationSample) bool {
+		if sizeBucket(sample.Files) != sizeBucket(files) {
+			return false
+		}
+		return questions == 0 || sizeBucket(sample.Questions) == sizeBucket(questions)
+	}
+	var matching []float64
+	if files > 0 || questions > 0 {
+		for _, sample := range all {
+			if similar(sample) {
+				matching = append(matching, sample.Seconds)
+			}
+		}
+	}
+	estimate := DurationEstimate{Similar: true}
+	if len(matching) < minEstimateSamples {
+		estimate.Similar = false
+		matching = matching[:0]
+		for _, sample := range all {
+			matching = append(matching, sample.Seconds)
+		}
+	}
+	if len(matching) < minEstimateSamples {
+		return DurationEstimate{}, false
+	}
+
+	sort.Float64s(matching)
+	estimate.P50 = secondsDuration(percentile(matching, 50))
+	estimate.P90 = secondsDuration(percentile(matching, 90))
+	estimate.Samples = len(matching)
+	return estimate, true
+}
+
+// percentile is the nearest-rank percentile p of the sorted values
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+func secondsDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// Remaining is the expected time left of a job that has run for elapsed. The progress of the job,
+// when it reports some, is extrapolated rather than relying on the recent jobs. It is false when
+// the job already took longer than 90% of the recent jobs.
+func (e DurationEstimate) Remaining(elapsed time.Duration, progress JobProgress) (time.Duration, bool) {
+	if progress.Done > 0 && progress.Total > progress.Done {
+		return time.Duration(float64(elapsed) * float64(progress.Total-progress.Done) / float64(progress.Done)), true
+	}
+	if elapsed > e.P90 {
+		return 0, false
+	}
+	if elapsed > e.P50 {
+		return e.P90 - elapsed, true
+	}
+	return e.P50 - elapsed, true
+}
+
+// JobStatus is what the status comment of a job tells about it
+type JobStatus struct {
+	JobType string
+	JobID   string
+	// Position and Wait are the place of a queued job in the queue and its estimated wait,
+	// WaitKnown is false when the durations of the jobs ahead are not known
+	Position  int
+	Wait      time.Duration
+	WaitKnown bool
+	// Deferred jobs wait on the deferred queue for the off-peak hours
+	Deferred bool
+	// Maintenance is the notice of the maintenance in progress, the job waits for it to end
+	Maintenance string
+	// Started is zero until a worker picks the job up
+	Started  time.Time
+	Progress JobProgress
+	// Finished is set once the results are reported, Failed when the job failed
+	Finished bool
+	Failed   bool
+	Duration time.Duration
+
+	Estimate      DurationEstimate
+	EstimateKnown bool
+}
+
+// StatusComment renders the status comment of a job, posted when the job is queued and edited
+// as it progresses
+func StatusComment(s JobStatus, now time.Time) string {
+	data := MessageData{JobType: s.JobType, JobID: s.JobID, Finished: s.Finished, Failed: s.Failed}
+	if s.Finished {
+		if s.Duration > 0 {
+			data.Duration = formatDuration(s.Duration)
+		}
+		return Message(MessageJobStatus, data)
+	}
+
+	var sb strings.Builder
+	var remaining time.Duration
+	remainingKnown := s.EstimateKnown
+	fromProgress := false
+	if s.Maintenance != "" {
+		sb.WriteString(s.Maintenance + " ")
+	}
+	if s.Deferred {
+		sb.WriteString("The bot is at capacity, so the job is deferred to the off-peak hours.")
+		remainingKnown = false
+	} else if s.Started.IsZero() {
+		sb.WriteString(QueueStatus(s.Position, s.Wait, s.WaitKnown))
+		remaining = s.Wait + s.Estimate.P50
+		remainingKnown = remainingKnown && (s.WaitKnown || s.Position <= 1) && s.Maintenance == ""
+	} else {
+		elapsed := now.Sub(s.Started)
+		fmt.Fprintf(&sb, "The job has been running for %s", formatDuration(elapsed))
+		if s.Progress.Total > 0 {
+			fmt.Fprintf(&sb, ", %d of %d questions done", s.Progress.Done, s.Progress.Total)
+		}
+		sb.WriteString(".")
+		fromProgress = s.Progress.Done > 0 && s.Progress.Total > s.Progress.Done
+		if fromProgress || remainingKnown {
+			var ok bool
+			remaining, ok = s.Estimate.Remaining(elapsed, s.Progress)
+			remainingKnown = ok
+			if !ok {
+				fmt.Fprintf(&sb, " It is taking longer than 90%% of the recent *%s* jobs.", s.JobType)
+			}
+		}
+	}
+
+	if remainingKnown {
+		fmt.Fprintf(&sb, " Estimated completion in %s, around %s UTC", formatETA(remaining), now.Add(remaining).UTC().Format("15:04"))
+		if fromProgress {
+			sb.WriteString(", from the pace of the job so far.")
+		} else {
+			size := ""
+			if s.Estimate.Similar {
+				size = " of a similar size"
+			}
+			fmt.Fprintf(&sb, ", from the last %d *%s* jobs%s (90%% of them took at most %s).",
+				s.Estimate.Samples, s.JobType, size, formatDuration(s.Estimate.P90))
+		}
+	}
+	data.Progress = sb.String()
+	return Message(MessageJobStatus, data)
+}
+
+// formatDuration rounds a duration to the minute, or to the hour past two hours
+func formatDuration(d time.Duration) string {
+	minutes := int(math.Round(d.Minutes()))
+	switch {
+	case minutes < 1:
+		return "less than a minute"
+	case minutes == 1:
+		return "1 minute"
+	case minutes < 120:
+		return fmt.Sprintf("%d minutes", minutes)
+	default:
+		return fmt.Sprintf("%d hours", int(math.Round(float64(minutes)/60)))
+	}
+}
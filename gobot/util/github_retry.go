@@ -0,0 +1,214 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxErrorBodySize is how much of a 403 response is read to tell a secondary rate limit from a
+// missing permission
+const maxErrorBodySize = 64 << 10
+
+// APIRetrier retries the GitHub requests failing with a 502, 503 or 504, a network error or a
+// secondary rate limit, so that a flaky GitHub does not drop the result comments. The waits
+// follow the Retry-After header, or double from Backoff. It counts the failed requests for the
+// /metrics endpoint.
+//
+// A retried POST may be a duplicate when GitHub applied it before failing, the rare duplicated
+// comment is preferred to a lost one.
+type APIRetrier struct {
+	// MaxRetries is the number of retries of a request before its failure is returned
+	MaxRetries int
+	// Backoff is the wait before the first retry, doubled for each of the next ones
+	Backoff time.Duration
+	// MaxWait is the longest wait before a retry, longer Retry-After are returned to the caller
+	MaxWait time.Duration
+	// Timeout limits each attempt of a request
+	Timeout time.Duration
+
+	mu        sync.Mutex
+	errors    map[string]int
+	retries   int
+	exhausted int
+}
+
+type retryTransport struct {
+	retrier *APIRetrier
+	next    http.RoundTripper
+}
+
+func (t retryTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	return t.retrier.roundTrip(t.next, request)
+}
+
+// Middleware retries the failing requests of the GitHub clients it wraps
+func (r *APIRetrier) Middleware(next http.RoundTripper) http.RoundTripper {
+	return retryTransport{retrier: r, next: next}
+}
+
+// TotalTimeout is the longest a request can take with all its retries, for the client timeout
+func (r *APIRetrier) TotalTimeout() time.Duration {
+	return time.Duration(r.MaxRetries+1)*r.Timeout + time.Duration(r.MaxRetries)*r.MaxWait
+}
+
+func (r *APIRetrier) roundTrip(next http.RoundTripper, request *http.Request) (*http.Response, error) {
+	ctx := request.Context()
+	replayable := request.Body == nil || request.Body == http.NoBody || request.GetBody != nil
+	for attempt := 0; ; attempt++ {
+		attemptRequest := request
+		if attempt > 0 {
+			attemptRequest = request.Clone(ctx)
+			if request.GetBody != nil {
+				body, err := request.GetBody()
+				if err != nil {
+					return nil, err
+				}
+				attemptRequest.Body = body
+			}
+		}
+		response, err := r.attempt(next, attemptRequest)
+
+		delay, retry := r.retryDelay(response, err, attempt)
+		retry = retry && replayable
+		r.record(response, err, retry)
+		if !retry {
+			return response, err
+		}
+		if response != nil {
+			_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, maxErrorBodySize))
+			response.Body.Close()
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// attempt sends the request with the timeout of an attempt, which lasts until its response body
+// is closed
+func (r *APIRetrier) attempt(next http.RoundTripper, request *http.Request) (*http.Response, error) {
+	if r.Timeout <= 0 {
+		return next.RoundTrip(request)
+	}
+	ctx, cancel := context.WithTimeout(request.Context(), r.Timeout)
+	response, err := next.RoundTrip(request.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	response.Body = cancelBody{ReadCloser: response.Body, cancel: cancel}
+	return response, nil
+}
+
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// retryDelay tells whether the attempt of a request is retried and after how long
+func (r *APIRetrier) retryDelay(response *http.Response, err error, attempt int) (time.Duration, bool) {
+	if attempt >= r.MaxRetries {
+		return 0, false
+	}
+	backoff := r.Backoff << attempt
+	if err != nil {
+		return backoff, true
+	}
+	switch response.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return backoff, true
+	case http.StatusForbidden, http.StatusTooManyRequests:
+		if !isSecondaryRateLimit(response) {
+			return 0, false
+		}
+		delay := secondaryRateLimitPause
+		if retryAfter, err := strconv.Atoi(response.Header.Get("Retry-After")); err == nil {
+			delay = time.Duration(retryAfter) * time.Second
+		}
+		return delay, delay <= r.MaxWait
+	}
+	return 0, false
+}
+
+// isSecondaryRateLimit tells a secondary rate limit from a missing permission or an exhausted
+// primary rate limit, the response body is kept for the caller
+func isSecondaryRateLimit(response *http.Response) bool {
+	if response.Header.Get("X-RateLimit-Remaining") == "0" {
+		return false
+	}
+	if response.StatusCode == http.StatusTooManyRequests || response.Header.Get("Retry-After") != "" {
+		return true
+	}
+	body, _ := io.ReadAll(io.LimitReader(response.Body, maxErrorBodySize))
+	response.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), response.Body), response.Body}
+	return strings.Contains(strings.ToLower(string(body)), "secondary rate limit")
+}
+
+func (r *APIRetrier) record(response *http.Response, err error, retry bool) {
+	status := ""
+	if err != nil {
+		status = "error"
+	} else if response.StatusCode >= http.StatusBadRequest {
+		status = strconv.Itoa(response.StatusCode)
+	}
+	if status == "" {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.errors == nil {
+		r.errors = make(map[string]int)
+	}
+	r.errors[status]++
+	if retry {
+		r.retries++
+	} else if status == "error" || response.StatusCode >= http.StatusInternalServerError || response.StatusCode == http.StatusTooManyRequests {
+		r.exhausted++
+	}
+}
+
+// Metrics returns the GitHub API error counters in the Prometheus text format
+func (r *APIRetrier) Metrics() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	statuses := make([]string, 0, len(r.errors))
+	for status := range r.errors {
+		statuses = append(statuses, status)
+	}
+	sort.Strings(statuses)
+
+	var b strings.Builder
+	b.WriteString("# HELP instructlab_bot_github_api_errors_total GitHub API responses with an error status, or network errors.\n")
+	b.WriteString("# TYPE instructlab_bot_github_api_errors_total counter\n")
+	for _, status := range statuses {
+		fmt.Fprintf(&b, "instructlab_bot_github_api_errors_total{status=%q} %d\n", status, r.errors[status])
+	}
+	b.WriteString("# HELP instructlab_bot_github_api_retries_total GitHub API requests retried after a transient error.\n")
+	b.WriteString("# TYPE instructlab_bot_github_api_retries_total counter\n")
+	fmt.Fprintf(&b, "instructlab_bot_github_api_retries_total %d\n", r.retries)
+	b.WriteString("# HELP instructlab_bot_github_api_failures_total GitHub API requests that still failed with a transient error after the retries.\n")
+	b.WriteString("# TYPE instructlab_bot_github_api_failures_total counter\n")
+	fmt.Fprintf(&b, "instructlab_bot_github_api_failures_total %d\n", r.exhausted)
+	return b.String()
+}
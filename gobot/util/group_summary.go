@@ -0,0 +1,65 @@
+package util
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/instructlab/instructlab-bot/pkg/jobqueue"
+)
+
+// GroupSummaryRow is a job of a group of jobs, in the table summarizing the group
+type GroupSummaryRow struct {
+	JobID   string
+	JobType string
+	// Subject is what the job ran on, a PR such as #12 or a branch
+	Subject string
+	Status  string
+	// URL links to the results of the job, or to the artifacts of a failed job
+	URL string
+}
+
+// groupStatuses describe the statuses of the jobs in the summary table
+var groupStatuses = map[string]string{
+	jobqueue.StatusPending: "⏳ queued",
+	jobqueue.StatusRunning: "🏃 running",
+	jobqueue.StatusSuccess: "✅ succeeded",
+	jobqueue.StatusError:   "❌ failed",
+}
+
+// GroupSummaryTable counts the outcomes of the jobs of a group and tabulates them, one row per job
+func GroupSummaryTable(rows []GroupSummaryRow) string {
+	if len(rows) == 0 {
+		return "No job is queued yet."
+	}
+	var finished, failed int
+	for _, row := range rows {
+		switch row.Status {
+		case jobqueue.StatusSuccess:
+			finished++
+		case jobqueue.StatusError:
+			finished++
+			failed++
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d of %d jobs finished, %d succeeded and %d failed.\n\n", finished, len(rows), finished-failed, failed)
+	b.WriteString("| Job | Type | On | Status | Results |\n")
+	b.WriteString("| --- | --- | --- | --- | --- |\n")
+	for _, row := range rows {
+		status, ok := groupStatuses[row.Status]
+		if !ok {
+			status = groupStatuses[jobqueue.StatusPending]
+		}
+		results := ""
+		switch {
+		case row.URL == "":
+		case row.Status == jobqueue.StatusError:
+			results = fmt.Sprintf("[artifacts](%s)", row.URL)
+		default:
+			results = fmt.Sprintf("[results](%s)", row.URL)
+		}
+		fmt.Fprintf(&b, "| %s | %s | %s | %s | %s |\n", row.JobID, row.JobType, row.Subject, status, results)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
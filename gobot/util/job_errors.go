@@ -0,0 +1,65 @@
+package util
+
+import "fmt"
+
+// ErrorCategory describes a kind of job failure reported by the workers
+type ErrorCategory struct {
+	Title string
+	// Contributor is set when the contributor can fix the failure in their PR, the other
+	// categories are infrastructure problems
+	Contributor bool
+	Remediation string
+}
+
+// ErrorCategories are keyed by the category the worker stores on a failed job
+var ErrorCategories = map[string]ErrorCategory{
+	"invalid-yaml": {
+		Title:       "Invalid YAML",
+		Contributor: true,
+		Remediation: "A taxonomy file in this PR could not be parsed. Fix the YAML syntax reported below, the lint annotations on the check point at the offending lines, and push the fix.",
+	},
+	"missing-seed-examples": {
+		Title:       "Missing seed examples",
+		Contributor: true,
+		Remediation: "A `qna.yaml` in this PR has no `seed_examples` list. Add the seed examples, each with a `question` and an `answer`, and push the fix.",
+	},
+	"compliance-failed": {
+		Title:       "Compliance checks failed",
+		Contributor: true,
+		Remediation: "A knowledge contribution in this PR is missing its `attribution.txt`, uses a license that is not accepted, or references a document repo that is not public. The annotations on the check point at what to fix.",
+	},
+	"pr-too-large": {
+		Title:       "PR too large",
+		Contributor: true,
+		Remediation: "This PR changes more taxonomy files or seed questions than a precheck job checks. Split it into smaller PRs, for example one per skill or knowledge contribution, so that each is checked in full.",
+	},
+	"model-endpoint-unreachable": {
+		Title:       "Model endpoint unreachable",
+		Remediation: "The worker could not reach the model serving endpoint. There is nothing to change in the PR, retry the command later or ask a maintainer to check the endpoint.",
+	},
+	"git-fetch-failed": {
+		Title:       "Git fetch failed",
+		Remediation: "The worker could not fetch this PR from GitHub. Retry the command; if it keeps failing, ask a maintainer to check the worker's access to the repository.",
+	},
+	"timeout": {
+		Title:       "Timeout",
+		Remediation: "The job took too long. Retry the command later; if it keeps timing out, ask a maintainer whether the backend is overloaded.",
+	},
+	"out-of-disk": {
+		Title:       "Out of disk space",
+		Remediation: "The worker ran out of disk space. There is nothing to change in the PR, a maintainer needs to free space on the worker before the command is retried.",
+	},
+}
+
+// ErrorGuidance explains a failure category to the contributor, it is empty for unknown categories
+func ErrorGuidance(category string) string {
+	c, ok := ErrorCategories[category]
+	if !ok {
+		return ""
+	}
+	who := "⚙️ This is an infrastructure problem, not an issue with your PR."
+	if c.Contributor {
+		who = "🛠️ This can be fixed in your PR."
+	}
+	return fmt.Sprintf("**%s** (`%s`): %s\n\n%s", c.Title, category, who, c.Remediation)
+}
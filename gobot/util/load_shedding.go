@@ -0,0 +1,92 @@
+package util
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Policies of the low priority jobs requested while the queue is over capacity
+const (
+	// ShedReject declines the job
+	ShedReject = "reject"
+	// ShedDefer queues the job on the deferred queue, run during the off-peak hours
+	ShedDefer = "defer"
+)
+
+// LoadShedding is the backpressure policy of the bot: once more than QueueDepth jobs are queued,
+// the jobs of the JobTypes are rejected or deferred to the off-peak hours
+type LoadShedding struct {
+	// QueueDepth is the number of queued jobs the queue is at capacity with, 0 never sheds
+	QueueDepth int
+	// JobTypes are the low priority job types, the e2e pipeline is low priority when one of its stages is
+	JobTypes []string
+	Policy   string
+	OffPeak  OffPeakHours
+}
+
+// Validate checks the policy of the load shedding
+func (l LoadShedding) Validate() error {
+	if l.QueueDepth < 0 {
+		return fmt.Errorf("the queue depth must not be negative")
+	}
+	if l.Policy != ShedReject && l.Policy != ShedDefer {
+		return fmt.Errorf("invalid policy %q, expected %s or %s", l.Policy, ShedReject, ShedDefer)
+	}
+	return nil
+}
+
+// Sheds reports whether a job of the job types is shed once the queue holds depth jobs
+func (l LoadShedding) Sheds(depth int, jobTypes ...string) bool {
+	if l.QueueDepth <= 0 || depth < l.QueueDepth {
+		return false
+	}
+	for _, jobType := range jobTypes {
+		if contains(l.JobTypes, jobType) {
+			return true
+		}
+	}
+	return false
+}
+
+// OffPeakHours is the daily window, in UTC hours, the deferred jobs are run in. It may wrap around
+// midnight, 22-6 runs them from 22:00 to 06:00.
+type OffPeakHours struct {
+	Start int
+	End   int
+}
+
+// ParseOffPeakHours parses a start-end window of UTC hours, 22-6 for instance
+func ParseOffPeakHours(value string) (OffPeakHours, error) {
+	start, end, found := strings.Cut(value, "-")
+	if !found {
+		return OffPeakHours{}, fmt.Errorf("invalid off-peak hours %q, expected start-end such as 22-6", value)
+	}
+	var hours OffPeakHours
+	var err error
+	if hours.Start, err = strconv.Atoi(strings.TrimSpace(start)); err != nil || hours.Start < 0 || hours.Start > 23 {
+		return OffPeakHours{}, fmt.Errorf("invalid off-peak start hour %q, expected 0 to 23", start)
+	}
+	if hours.End, err = strconv.Atoi(strings.TrimSpace(end)); err != nil || hours.End < 0 || hours.End > 23 {
+		return OffPeakHours{}, fmt.Errorf("invalid off-peak end hour %q, expected 0 to 23", end)
+	}
+	return hours, nil
+}
+
+// Contains reports whether the time falls in the window, a window starting and ending at the same
+// hour lasts all day
+func (h OffPeakHours) Contains(t time.Time) bool {
+	hour := t.UTC().Hour()
+	if h.Start == h.End {
+		return true
+	}
+	if h.Start < h.End {
+		return hour >= h.Start && hour < h.End
+	}
+	return hour >= h.Start || hour < h.End
+}
+
+func (h OffPeakHours) String() string {
+	return fmt.Sprintf("%02d:00-%02d:00 UTC", h.Start, h.End)
+}
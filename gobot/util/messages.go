@@ -0,0 +1,221 @@
+package util
+
+import (
+	"embed"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+//go:embed messages/*.tmpl
+var defaultMessageTemplates embed.FS
+
+// The messages of the bot, named after their template file without the .tmpl extension
+const (
+	MessageError               = "error"
+	MessageWelcome             = "welcome"
+	MessageHelp                = "help"
+	MessageInstalled           = "installed"
+	MessageQuotaExceeded       = "quota_exceeded"
+	MessageQuotaDenied         = "quota_denied"
+	MessageOverCapacity        = "over_capacity"
+	MessageQuotas              = "quotas"
+	MessageBackfill            = "backfill"
+	MessageGroupSummary        = "group_summary"
+	MessageDeprecatedUsername  = "deprecated_username"
+	MessageJobQueued           = "job_queued"
+	MessageJobQueuedDetails    = "job_queued_details"
+	MessageJobDeferred         = "job_deferred"
+	MessagePrecheckQueued      = "precheck_queued_details"
+	MessageE2EQueued           = "e2e_queued_details"
+	MessageEnableDeprecated    = "enable_deprecated"
+	MessageNotAllowed          = "not_allowed"
+	MessageCommandNotAllowed   = "command_not_allowed"
+	MessageMissingLabel        = "missing_label"
+	MessageUnknownCommand      = "unknown_command"
+	MessageDisabledCommand     = "disabled_command"
+	MessageInvalidOptions      = "invalid_options"
+	MessagePipelineResult      = "pipeline_result"
+	MessageJobResults          = "job_results"
+	MessageJobResultsContinued = "job_results_continued"
+	MessageJobFailed           = "job_failed"
+	MessageOutdatedResults     = "outdated_results"
+	MessageScheduledResult     = "scheduled_result"
+	MessageJobStatus           = "job_status"
+)
+
+// MessageData holds the variables of the message templates, each message uses some of them
+type MessageData struct {
+	BotName    string
+	OldBotName string
+	// Help is the rendered help message, for the welcome messages
+	Help        string
+	Author      string
+	Maintainers []string
+	Labels      []string
+	Command     string
+	Commands    []string
+
+	JobType    string
+	JobID      string
+	PipelineID string
+	Model      string
+	// URL links to the results of a job, FailedURL to the artifacts of a failed job. They link to
+	// the access instructions when the artifacts are Encrypted.
+	URL       string
+	FailedURL string
+	Encrypted bool
+	Schedule  string
+	Branch    string
+	// Commit is the commit a job ran on, HeadCommit the head of its PR when it was pushed to since
+	Commit     string
+	HeadCommit string
+	// Queue is the place of a job in the queue, Progress how far a running job is
+	Queue    string
+	Progress string
+	Duration string
+	Summary  string
+	Error    string
+	Guidance string
+	Reason   string
+	Title    string
+	// Items are the lines of a list, such as the setup of a repository or its quotas
+	Items []string
+
+	DryRun   bool
+	Failed   bool
+	Finished bool
+}
+
+// messageFuncs are the functions available to the message templates
+var messageFuncs = template.FuncMap{
+	// inc numbers the items of a list from 1
+	"inc": func(i int) int { return i + 1 },
+}
+
+var messages = mustLoadMessages()
+
+func mustLoadMessages() map[string]*template.Template {
+	loaded, err := loadMessages("")
+	if err != nil {
+		panic(err)
+	}
+	return loaded
+}
+
+// LoadMessages replaces the messages of the bot by the templates of dir with the same file
+// name, the other messages keep their default template
+func LoadMessages(dir string) error {
+	loaded, err := loadMessages(dir)
+	if err != nil {
+		return err
+	}
+	messages = loaded
+	return nil
+}
+
+func loadMessages(dir string) (map[string]*template.Template, error) {
+	entries, err := defaultMessageTemplates.ReadDir("messages")
+	if err != nil {
+		return nil, err
+	}
+	loaded := make(map[string]*template.Template)
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), ".tmpl")
+		path := "messages/" + entry.Name()
+		text, err := defaultMessageTemplates.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if dir != "" {
+			override, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+			if err == nil {
+				path, text = filepath.Join(dir, entry.Name()), override
+			} else if !os.IsNotExist(err) {
+				return nil, fmt.Errorf("could not read message template: %w", err)
+			}
+		}
+
+		// The final newline of the files is not part of the messages
+		tmpl, err := template.New(name).Funcs(messageFuncs).Parse(strings.TrimRight(string(text), "\n"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid message template %s: %w", path, err)
+		}
+		// Catch the templates that only fail when executed, such as a missing field
+		for _, data := range sampleMessageData() {
+			if err := tmpl.Execute(io.Discard, data); err != nil {
+				return nil, fmt.Errorf("invalid message template %s: %w", path, err)
+			}
+		}
+		loaded[name] = tmpl
+	}
+
+	// A misnamed template would silently keep the default message
+	if dir != "" {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, fmt.Errorf("could not read the message templates: %w", err)
+		}
+		for _, entry := range entries {
+			if name, ok := strings.CutSuffix(entry.Name(), ".tmpl"); ok && loaded[name] == nil {
+				return nil, fmt.Errorf("unknown message template %s", filepath.Join(dir, entry.Name()))
+			}
+		}
+	}
+	return loaded, nil
+}
+
+// sampleMessageData are the variables of the messages with and without the optional ones, to
+// run through all the branches of the templates
+func sampleMessageData() []MessageData {
+	return []MessageData{{}, {
+		BotName:     "@instructlab-bot",
+		OldBotName:  "@instruct-lab-bot",
+		Help:        "help",
+		Author:      "octocat",
+		Maintainers: []string{"maintainers"},
+		Labels:      []string{"skill"},
+		Command:     "evaluate",
+		Commands:    []string{"precheck"},
+		JobType:     "precheck",
+		JobID:       "1",
+		PipelineID:  "1",
+		Model:       "granite",
+		URL:         "https://example.com/results",
+		FailedURL:   "https://example.com/failed",
+		Schedule:    "nightly",
+		Branch:      "main",
+		Commit:      "0a1b2c3",
+		HeadCommit:  "4d5e6f7",
+		Queue:       "The job is next in the queue.",
+		Progress:    "The job has been running for 1 minute.",
+		Duration:    "1 minute",
+		Summary:     "summary",
+		Error:       "error",
+		Guidance:    "guidance",
+		Reason:      "reason",
+		Title:       "title",
+		Items:       []string{"item"},
+		Encrypted:   true,
+		DryRun:      true,
+		Failed:      true,
+		Finished:    true,
+	}}
+}
+
+// Message renders the message name of the bot with data
+func Message(name string, data MessageData) string {
+	tmpl, ok := messages[name]
+	if !ok {
+		return fmt.Sprintf("Beep, boop 🤖  Sorry, the %s message is missing", name)
+	}
+	var b strings.Builder
+	// The templates ran on sample data when loaded, they fail only on a bug of the caller
+	if err := tmpl.Execute(&b, data); err != nil {
+		return fmt.Sprintf("Beep, boop 🤖  Sorry, the %s message could not be rendered: %v", name, err)
+	}
+	return b.String()
+}
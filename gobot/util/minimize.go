@@ -0,0 +1,52 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/google/go-github/v61/github"
+)
+
+// minimizeCommentMutation hides a comment as outdated, which only the GraphQL API can
+const minimizeCommentMutation = `mutation($id: ID!) {
+  minimizeComment(input: {subjectId: $id, classifier: OUTDATED}) {
+    minimizedComment { isMinimized }
+  }
+}`
+
+// MinimizeComment hides a comment of the bot, from its node ID, as outdated on the PR
+func MinimizeComment(ctx context.Context, client *github.Client, nodeID string) error {
+	body := map[string]interface{}{
+		"query":     minimizeCommentMutation,
+		"variables": map[string]string{"id": nodeID},
+	}
+	req, err := client.NewRequest(http.MethodPost, graphQLURL(client.BaseURL), body)
+	if err != nil {
+		return err
+	}
+	var resp struct {
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if _, err := client.Do(ctx, req, &resp); err != nil {
+		return err
+	}
+	if len(resp.Errors) > 0 {
+		return fmt.Errorf("could not minimize comment %s: %s", nodeID, resp.Errors[0].Message)
+	}
+	return nil
+}
+
+// graphQLURL is the GraphQL endpoint next to the REST API, /api/graphql on GitHub Enterprise
+func graphQLURL(base *url.URL) string {
+	if strings.HasSuffix(base.Path, "/api/v3/") {
+		u := *base
+		u.Path = strings.TrimSuffix(base.Path, "v3/") + "graphql"
+		return u.String()
+	}
+	return base.ResolveReference(&url.URL{Path: "graphql"}).String()
+}
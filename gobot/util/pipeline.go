@@ -0,0 +1,39 @@
+package util
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PipelineStages are the job types the e2e command chains, each stage only runs once the
+// previous one succeeded
+var PipelineStages = []string{"precheck", "generate", "train", "evaluate"}
+
+// PipelineStage is the state of one job of a pipeline
+type PipelineStage struct {
+	JobID    string
+	JobType  string
+	Status   string
+	Duration string
+	S3URL    string
+}
+
+// PipelineSummary describes every stage of a pipeline for the final comment
+func PipelineSummary(stages []PipelineStage) string {
+	var sb strings.Builder
+	sb.WriteString("### E2E pipeline summary\n\n")
+	sb.WriteString("| Stage | Job ID | Status | Duration | Results |\n")
+	sb.WriteString("|-------|--------|--------|----------|---------|\n")
+	for _, stage := range stages {
+		duration := "-"
+		if stage.Duration != "" {
+			duration = stage.Duration + "s"
+		}
+		results := "-"
+		if stage.S3URL != "" {
+			results = fmt.Sprintf("[results](%s)", stage.S3URL)
+		}
+		fmt.Fprintf(&sb, "| %s | %s | %s | %s | %s |\n", stage.JobType, stage.JobID, stage.Status, duration, results)
+	}
+	return sb.String()
+}
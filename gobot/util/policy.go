@@ -0,0 +1,184 @@
+package util
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/instructlab/instructlab-bot/gobot/common"
+)
+
+// DefaultPolicyCheck is the name of the check the merge policy sets, when the policy names none
+const DefaultPolicyCheck = "InstructLab Policy"
+
+// policyJobTypes maps the commands a policy rule can require to their job types
+var policyJobTypes = map[string]string{
+	"precheck":       "precheck",
+	"generate":       "sdg-svc",
+	"generate-local": "generate",
+	"train":          "train",
+	"evaluate":       "evaluate",
+}
+
+// policyRequirePattern matches a requirement such as `min_score >= 0.7`
+var policyRequirePattern = regexp.MustCompile(`^\s*([a-z_]+)\s*(>=|<=|==|!=|>|<)\s*(-?[0-9]+(?:\.[0-9]+)?)\s*$`)
+
+// PolicyConfig is the merge policy of a repository. Its rules are evaluated every time a job of a
+// PR completes, and set a check maintainers can make required to merge.
+type PolicyConfig struct {
+	// Check is the name of the check, DefaultPolicyCheck when empty
+	Check string `yaml:"check"`
+	// Label is added to the PR while every rule passes, and removed otherwise
+	Label string       `yaml:"label"`
+	Rules []PolicyRule `yaml:"rules"`
+}
+
+// PolicyRule requires the latest job of a command on the PR head to have succeeded and, when
+// Require is set, one of the metrics of the job to compare to a value
+type PolicyRule struct {
+	Job     string `yaml:"job"`
+	Require string `yaml:"require"`
+}
+
+// PolicyJobResult is the outcome of the latest job of a job type on a PR head
+type PolicyJobResult struct {
+	JobID   string             `json:"job_id"`
+	Failed  bool               `json:"failed"`
+	Metrics map[string]float64 `json:"metrics,omitempty"`
+}
+
+// PolicyRuleResult is a rule evaluated against the job results, its state is a check status
+type PolicyRuleResult struct {
+	Rule   PolicyRule
+	State  string
+	Detail string
+}
+
+// CheckName returns the name of the check the policy sets
+func (p PolicyConfig) CheckName() string {
+	if p.Check == "" {
+		return DefaultPolicyCheck
+	}
+	return p.Check
+}
+
+// JobType returns the job type of the command the rule requires
+func (r PolicyRule) JobType() string {
+	return policyJobTypes[r.Job]
+}
+
+// String describes the rule for the check summary
+func (r PolicyRule) String() string {
+	if r.Require == "" {
+		return fmt.Sprintf("`%s` succeeded", r.Job)
+	}
+	return fmt.Sprintf("`%s`: `%s`", r.Job, strings.TrimSpace(r.Require))
+}
+
+// requirement splits the requirement of the rule into its metric, operator and value
+func (r PolicyRule) requirement() (string, string, float64, error) {
+	match := policyRequirePattern.FindStringSubmatch(r.Require)
+	if match == nil {
+		return "", "", 0, fmt.Errorf("invalid requirement %q, expected `<metric> <operator> <number>`", r.Require)
+	}
+	value, err := strconv.ParseFloat(match[3], 64)
+	if err != nil {
+		return "", "", 0, fmt.Errorf("invalid requirement %q: %w", r.Require, err)
+	}
+	return match[1], match[2], value, nil
+}
+
+// validate checks the rule can be evaluated
+func (r PolicyRule) validate() error {
+	if r.JobType() == "" {
+		return fmt.Errorf("unknown job %q, it must be precheck, generate, generate-local, train or evaluate", r.Job)
+	}
+	if r.Require == "" {
+		return nil
+	}
+	_, _, _, err := r.requirement()
+	return err
+}
+
+// evaluate checks the rule against the result of its job, pending while the job has not completed
+func (r PolicyRule) evaluate(result *PolicyJobResult) PolicyRuleResult {
+	if result == nil {
+		return PolicyRuleResult{Rule: r, State: common.CheckStatusPending, Detail: fmt.Sprintf("waiting for a `%s` job", r.Job)}
+	}
+	if result.Failed {
+		return PolicyRuleResult{Rule: r, State: common.CheckStatusFailure, Detail: fmt.Sprintf("job %s failed", result.JobID)}
+	}
+	if r.Require == "" {
+		return PolicyRuleResult{Rule: r, State: common.CheckStatusSuccess, Detail: fmt.Sprintf("job %s succeeded", result.JobID)}
+	}
+
+	metric, op, value, _ := r.requirement()
+	actual, ok := result.Metrics[metric]
+	if !ok {
+		return PolicyRuleResult{Rule: r, State: common.CheckStatusFailure, Detail: fmt.Sprintf("job %s did not report `%s`", result.JobID, metric)}
+	}
+	var passed bool
+	switch op {
+	case ">=":
+		passed = actual >= value
+	case "<=":
+		passed = actual <= value
+	case ">":
+		passed = actual > value
+	case "<":
+		passed = actual < value
+	case "==":
+		passed = actual == value
+	case "!=":
+		passed = actual != value
+	}
+	state := common.CheckStatusFailure
+	if passed {
+		state = common.CheckStatusSuccess
+	}
+	return PolicyRuleResult{Rule: r, State: state, Detail: fmt.Sprintf("`%s` is %s in job %s", metric, strconv.FormatFloat(actual, 'f', -1, 64), result.JobID)}
+}
+
+// validate checks every rule of the policy
+func (p PolicyConfig) validate() error {
+	for i, rule := range p.Rules {
+		if err := rule.validate(); err != nil {
+			return fmt.Errorf("policy rule %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// Evaluate checks the rules against the latest job results of the PR head, keyed by job type.
+// The conclusion is a failure as soon as a rule fails, and pending while a rule waits for its job.
+func (p PolicyConfig) Evaluate(results map[string]PolicyJobResult) (string, []PolicyRuleResult) {
+	conclusion := common.CheckStatusSuccess
+	var rules []PolicyRuleResult
+	for _, rule := range p.Rules {
+		var result *PolicyJobResult
+		if r, ok := results[rule.JobType()]; ok {
+			result = &r
+		}
+		evaluated := rule.evaluate(result)
+		switch {
+		case evaluated.State == common.CheckStatusFailure:
+			conclusion = common.CheckStatusFailure
+		case evaluated.State == common.CheckStatusPending && conclusion == common.CheckStatusSuccess:
+			conclusion = common.CheckStatusPending
+		}
+		rules = append(rules, evaluated)
+	}
+	return conclusion, rules
+}
+
+// PolicySummary renders the evaluated rules as a markdown table for the check details
+func PolicySummary(rules []PolicyRuleResult) string {
+	var sb strings.Builder
+	sb.WriteString("| Rule | Status | Details |\n")
+	sb.WriteString("|------|--------|---------|\n")
+	for _, rule := range rules {
+		fmt.Fprintf(&sb, "| %s | %s | %s |\n", rule.Rule, rule.State, rule.Detail)
+	}
+	return sb.String()
+}
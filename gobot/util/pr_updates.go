@@ -2,7 +2,6 @@ package util
 
 import (
 	"context"
-	"fmt"
 	"net/http"
 	"strings"
 	"time"
@@ -19,6 +18,7 @@ type PullRequestStatusParams struct {
 	CheckDetails string
 	Comment      string
 	StatusDesc   string
+	Annotations  []*github.CheckRunAnnotation
 
 	JobType string
 	JobID   string
@@ -48,8 +48,21 @@ func StatusExist(ctx context.Context, client *github.Client, params PullRequestS
 	return false, nil
 }
 
+// CheckRunExists reports whether a check run of the name was created on the commit, whatever its
+// status
+func CheckRunExists(ctx context.Context, client *github.Client, repoOwner, repoName, sha, checkName string) (bool, error) {
+	runs, _, err := client.Checks.ListCheckRunsForRef(ctx, repoOwner, repoName, sha, &github.ListCheckRunsOptions{
+		CheckName:   github.String(checkName),
+		ListOptions: github.ListOptions{PerPage: 1},
+	})
+	if err != nil {
+		return false, err
+	}
+	return runs.GetTotal() > 0, nil
+}
+
 func PostPullRequestErrorComment(ctx context.Context, client *github.Client, params PullRequestStatusParams, err error) error {
-	params.Comment = fmt.Sprintf("Beep, boop 🤖  Sorry, An error has occurred : %v", err)
+	params.Comment = Message(MessageError, MessageData{Error: err.Error()})
 	return PostPullRequestComment(ctx, client, params)
 }
 
@@ -63,6 +76,59 @@ func PostPullRequestComment(ctx context.Context, client *github.Client, params P
 	return nil
 }
 
+// maxCommentLength is the longest comment body GitHub accepts
+const maxCommentLength = 65536
+
+// commentSeparator separates the results of the jobs joined in one comment
+const commentSeparator = "\n\n---\n\n"
+
+// JoinComments joins comment bodies, in order, into as few comments as GitHub accepts. A body
+// too long on its own is left alone.
+func JoinComments(bodies []string) []string {
+	var joined []string
+	for _, body := range bodies {
+		last := len(joined) - 1
+		if last >= 0 && len(joined[last])+len(commentSeparator)+len(body) <= maxCommentLength {
+			joined[last] += commentSeparator + body
+			continue
+		}
+		joined = append(joined, body)
+	}
+	return joined
+}
+
+// CreatePullRequestComment posts the comment and returns its ID, for the comments edited later on
+func CreatePullRequestComment(ctx context.Context, client *github.Client, params PullRequestStatusParams) (int64, error) {
+	comment, _, err := client.Issues.CreateComment(ctx, params.RepoOwner, params.RepoName, params.PrNum, &github.IssueComment{Body: &params.Comment})
+	if err != nil {
+		return 0, err
+	}
+	return comment.GetID(), nil
+}
+
+// PostResultComment posts the comment as a reply in the thread of the review comment replyTo, or
+// on the PR when replyTo is 0, and returns its node ID for the GraphQL API
+func PostResultComment(ctx context.Context, client *github.Client, params PullRequestStatusParams, replyTo int64) (string, error) {
+	if replyTo != 0 {
+		comment, _, err := client.PullRequests.CreateCommentInReplyTo(ctx, params.RepoOwner, params.RepoName, params.PrNum, params.Comment, replyTo)
+		if err != nil {
+			return "", err
+		}
+		return comment.GetNodeID(), nil
+	}
+	comment, _, err := client.Issues.CreateComment(ctx, params.RepoOwner, params.RepoName, params.PrNum, &github.IssueComment{Body: &params.Comment})
+	if err != nil {
+		return "", err
+	}
+	return comment.GetNodeID(), nil
+}
+
+// EditPullRequestComment replaces the body of a comment of the bot
+func EditPullRequestComment(ctx context.Context, client *github.Client, params PullRequestStatusParams, commentID int64) error {
+	_, _, err := client.Issues.EditComment(ctx, params.RepoOwner, params.RepoName, commentID, &github.IssueComment{Body: &params.Comment})
+	return err
+}
+
 func PostPullRequestCheck(ctx context.Context, client *github.Client, params PullRequestStatusParams) error {
 
 	checkRequest := github.CreateCheckRunOptions{
@@ -77,6 +143,10 @@ func PostPullRequestCheck(ctx context.Context, client *github.Client, params Pul
 		},
 	}
 
+	if len(params.Annotations) > 0 {
+		checkRequest.Output.Annotations = params.Annotations
+	}
+
 	if params.Conclusion != "" {
 		checkRequest.Conclusion = github.String(params.Conclusion)
 		checkRequest.CompletedAt = &github.Timestamp{Time: time.Now().Add(time.Duration(40))}
@@ -90,6 +160,37 @@ func PostPullRequestCheck(ctx context.Context, client *github.Client, params Pul
 	return nil
 }
 
+// AddPullRequestLabel adds the label to the PR, creating the label when the repository has none of that name
+func AddPullRequestLabel(ctx context.Context, client *github.Client, params PullRequestStatusParams, label string) error {
+	_, _, err := client.Issues.AddLabelsToIssue(ctx, params.RepoOwner, params.RepoName, params.PrNum, []string{label})
+	return err
+}
+
+// RemovePullRequestLabel removes the label from the PR, a PR without the label is left as is
+func RemovePullRequestLabel(ctx context.Context, client *github.Client, params PullRequestStatusParams, label string) error {
+	response, err := client.Issues.RemoveLabelForIssue(ctx, params.RepoOwner, params.RepoName, params.PrNum, label)
+	if response != nil && response.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	return err
+}
+
+// EnsureLabel creates the label in the repository when it has none of that name, and reports whether it was created
+func EnsureLabel(ctx context.Context, client *github.Client, repoOwner, repoName, name, color, description string) (bool, error) {
+	_, response, err := client.Issues.GetLabel(ctx, repoOwner, repoName, name)
+	if err == nil {
+		return false, nil
+	}
+	if response == nil || response.StatusCode != http.StatusNotFound {
+		return false, err
+	}
+	label := &github.Label{Name: github.String(name), Color: github.String(color), Description: github.String(description)}
+	if _, _, err := client.Issues.CreateLabel(ctx, repoOwner, repoName, label); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 func PostPullRequestStatus(ctx context.Context, client *github.Client, params PullRequestStatusParams) error {
 	status := &github.RepoStatus{
 		State:       github.String(params.Conclusion),        // Status state: success, failure, error, or pending
@@ -112,19 +213,7 @@ func PostBotWelcomeMessage(ctx context.Context, client *github.Client, repoOwner
 		PrNum:     prNum,
 		PrSha:     prSha,
 	}
-	detailsMsg := fmt.Sprintf("Beep, boop 🤖, Hi, I'm %s and I'm going to help you"+
-		" with your pull request. Thanks for you contribution! 🎉\n\n", botName)
-	detailsMsg += fmt.Sprintf("I support the following commands:\n\n"+
-		"* `%s precheck` -- Check existing model behavior using the questions in this proposed change.\n"+
-		"* `%s generate` -- Generate a sample of synthetic data using the synthetic data generation backend infrastructure.\n"+
-		"* `%s generate-local` -- Generate a sample of synthetic data using a local model.\n"+
-		"* `%s help` -- Print this help message again.\n"+
-		"> [!NOTE] \n > **Results or Errors of these commands will be posted as a pull request check in the Checks section below**\n\n",
-		botName, botName, botName, botName)
-
-	if len(maintainers) > 0 {
-		detailsMsg += fmt.Sprintf("> [!NOTE] \n > **Currently only maintainers belongs to [%v] teams are allowed to run these commands**.\n", maintainers)
-	}
+	detailsMsg := Message(MessageWelcome, MessageData{BotName: botName, Help: BotCommandsHelp(botName, maintainers)})
 	params.Status = common.CheckComplete
 	params.Conclusion = common.CheckStatusSuccess
 	params.CheckSummary = common.BotReadyStatusMsg
@@ -144,3 +233,8 @@ func PostBotWelcomeMessage(ctx context.Context, client *github.Client, repoOwner
 	return nil
 
 }
+
+// BotCommandsHelp describes the commands of the bot, for the welcome messages
+func BotCommandsHelp(botName string, maintainers []string) string {
+	return Message(MessageHelp, MessageData{BotName: botName, Maintainers: maintainers})
+}
@@ -0,0 +1,35 @@
+package util
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestJoinComments verify the bodies are joined in order while they fit in one comment.
+func TestJoinComments(t *testing.T) {
+	if joined := JoinComments(nil); len(joined) != 0 {
+		t.Errorf("JoinComments(nil) = %q, want none", joined)
+	}
+
+	joined := JoinComments([]string{"a", "b", "c"})
+	if want := []string{"a" + commentSeparator + "b" + commentSeparator + "c"}; len(joined) != 1 || joined[0] != want[0] {
+		t.Errorf("JoinComments = %q, want %q", joined, want)
+	}
+
+	half := strings.Repeat("x", maxCommentLength/2)
+	joined = JoinComments([]string{half, half, "tail"})
+	if len(joined) != 2 || joined[0] != half || joined[1] != half+commentSeparator+"tail" {
+		t.Errorf("JoinComments split into %d comments, want the second half joined with the tail", len(joined))
+	}
+	for _, comment := range joined {
+		if len(comment) > maxCommentLength {
+			t.Errorf("comment of %d bytes over the limit", len(comment))
+		}
+	}
+
+	// A body over the limit is left alone in its own comment
+	long := strings.Repeat("y", maxCommentLength+1)
+	if joined := JoinComments([]string{"a", long, "b"}); len(joined) != 3 {
+		t.Errorf("JoinComments split into %d comments, want 3", len(joined))
+	}
+}
@@ -0,0 +1,133 @@
+package util
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// JobTypes are the job types the workers process, the queue metrics report all of them
+var JobTypes = []string{"precheck", "generate", "sdg-svc", "train", "evaluate"}
+
+// MaxRecordedDurations is how many recent durations per job type the queue estimates average
+const MaxRecordedDurations = 20
+
+// AverageDuration returns the mean of the job durations, recorded in seconds. Unparseable
+// entries are ignored.
+func AverageDuration(durations []string) (time.Duration, bool) {
+	var total float64
+	var count int
+	for _, d := range durations {
+		seconds, err := strconv.ParseFloat(d, 64)
+		if err != nil || seconds < 0 {
+			continue
+		}
+		total += seconds
+		count++
+	}
+	if count == 0 {
+		return 0, false
+	}
+	return time.Duration(total / float64(count) * float64(time.Second)), true
+}
+
+// QueueStart estimates when a queued job starts, from the remaining durations of the running jobs
+// and the durations of the queued jobs ahead of it, in queue order. Each running job holds a
+// worker, which takes the next job ahead once it is done. Without running jobs a single worker is
+// assumed.
+func QueueStart(running, ahead []time.Duration) time.Duration {
+	free := make([]time.Duration, 0, len(running))
+	for _, remaining := range running {
+		free = append(free, max(remaining, 0))
+	}
+	if len(free) == 0 {
+		free = append(free, 0)
+	}
+	// next is the worker free the soonest
+	next := func() int {
+		soonest := 0
+		for i := range free {
+			if free[i] < free[soonest] {
+				soonest = i
+			}
+		}
+		return soonest
+	}
+	for _, duration := range ahead {
+		free[next()] += duration
+	}
+	return free[next()]
+}
+
+// QueueStatus tells the requester where their job is in the queue and, when the durations of
+// the jobs ahead are known, when it should start
+func QueueStatus(position int, eta time.Duration, etaKnown bool) string {
+	if position <= 1 {
+		return "You are #1 in queue, the job will start as soon as a worker is free."
+	}
+	msg := fmt.Sprintf("You are #%d in queue", position)
+	if etaKnown {
+		msg += ", estimated start in " + formatETA(eta)
+	}
+	return msg + "."
+}
+
+func formatETA(eta time.Duration) string {
+	minutes := int(math.Ceil(eta.Minutes()))
+	switch {
+	case minutes <= 1:
+		return "~1 minute"
+	case minutes < 120:
+		return fmt.Sprintf("~%d minutes", minutes)
+	default:
+		return fmt.Sprintf("~%d hours", int(math.Round(float64(minutes)/60)))
+	}
+}
+
+// QueueMetrics renders the queue backlog and the running jobs in the Prometheus text format, so
+// worker deployments can scale on them. The backlog in seconds only counts the job types with
+// recorded durations.
+func QueueMetrics(depths, running map[string]int, averages map[string]time.Duration) string {
+	jobTypes := append([]string{}, JobTypes...)
+	for _, counts := range []map[string]int{depths, running} {
+		for jobType := range counts {
+			if !contains(jobTypes, jobType) {
+				jobTypes = append(jobTypes, jobType)
+			}
+		}
+	}
+	sort.Strings(jobTypes)
+
+	var b strings.Builder
+	b.WriteString("# HELP instructlab_bot_queue_depth Jobs waiting for a worker.\n")
+	b.WriteString("# TYPE instructlab_bot_queue_depth gauge\n")
+	for _, jobType := range jobTypes {
+		fmt.Fprintf(&b, "instructlab_bot_queue_depth{job_type=%q} %d\n", jobType, depths[jobType])
+	}
+
+	b.WriteString("# HELP instructlab_bot_running_jobs Jobs a worker is running.\n")
+	b.WriteString("# TYPE instructlab_bot_running_jobs gauge\n")
+	for _, jobType := range jobTypes {
+		fmt.Fprintf(&b, "instructlab_bot_running_jobs{job_type=%q} %d\n", jobType, running[jobType])
+	}
+
+	b.WriteString("# HELP instructlab_bot_job_duration_seconds_average Average duration of the recent successful jobs.\n")
+	b.WriteString("# TYPE instructlab_bot_job_duration_seconds_average gauge\n")
+	var backlog time.Duration
+	for _, jobType := range jobTypes {
+		average, ok := averages[jobType]
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(&b, "instructlab_bot_job_duration_seconds_average{job_type=%q} %g\n", jobType, average.Seconds())
+		backlog += time.Duration(depths[jobType]) * average
+	}
+
+	b.WriteString("# HELP instructlab_bot_queue_backlog_seconds Estimated worker time needed to process the queued jobs.\n")
+	b.WriteString("# TYPE instructlab_bot_queue_backlog_seconds gauge\n")
+	fmt.Fprintf(&b, "instructlab_bot_queue_backlog_seconds %g\n", backlog.Seconds())
+	return b.String()
+}
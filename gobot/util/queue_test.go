@@ -0,0 +1,53 @@
+package util
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQueueStart(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		running []time.Duration
+		ahead   []time.Duration
+		want    time.Duration
+	}{
+		{"idle", nil, nil, 0},
+		{"single worker", nil, []time.Duration{10 * time.Minute, 5 * time.Minute}, 15 * time.Minute},
+		{"running job", []time.Duration{3 * time.Minute}, []time.Duration{10 * time.Minute}, 13 * time.Minute},
+		{"overdue running job", []time.Duration{-2 * time.Minute}, []time.Duration{10 * time.Minute}, 10 * time.Minute},
+		{"two workers", []time.Duration{2 * time.Minute, 8 * time.Minute}, []time.Duration{10 * time.Minute, 10 * time.Minute}, 12 * time.Minute},
+		{"worker free first", []time.Duration{2 * time.Minute, 8 * time.Minute}, nil, 2 * time.Minute},
+	} {
+		if got := QueueStart(tc.running, tc.ahead); got != tc.want {
+			t.Errorf("%s: QueueStart() = %s, want %s", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestQueueMetrics(t *testing.T) {
+	metrics := QueueMetrics(
+		map[string]int{"precheck": 3, "custom": 1},
+		map[string]int{"train": 2},
+		map[string]time.Duration{"precheck": 2 * time.Minute, "train": time.Hour},
+	)
+	for _, want := range []string{
+		"instructlab_bot_queue_depth{job_type=\"precheck\"} 3\n",
+		"instructlab_bot_queue_depth{job_type=\"custom\"} 1\n",
+		"instructlab_bot_queue_depth{job_type=\"train\"} 0\n",
+		"# TYPE instructlab_bot_running_jobs gauge\n",
+		"instructlab_bot_running_jobs{job_type=\"train\"} 2\n",
+		"instructlab_bot_running_jobs{job_type=\"precheck\"} 0\n",
+		"instructlab_bot_job_duration_seconds_average{job_type=\"precheck\"} 120\n",
+		"instructlab_bot_job_duration_seconds_average{job_type=\"train\"} 3600\n",
+		"instructlab_bot_queue_backlog_seconds 360\n",
+	} {
+		if !strings.Contains(metrics, want) {
+			t.Errorf("QueueMetrics() is missing %q:\n%s", want, metrics)
+		}
+	}
+	if strings.Contains(metrics, "instructlab_bot_job_duration_seconds_average{job_type=\"custom\"}") {
+		t.Errorf("QueueMetrics() has an average for a job type without durations:\n%s", metrics)
+	}
+}
@@ -0,0 +1,165 @@
+package util
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// The scopes of the quotas, a user counts the jobs they run on every repository the bot serves
+const (
+	QuotaScopeUser = "user"
+	QuotaScopeRepo = "repo"
+)
+
+// The fields of the usage and limit hashes of the quotas
+const (
+	QuotaFieldJobs    = "jobs"
+	QuotaFieldSeconds = "seconds"
+	QuotaFieldMinutes = "minutes"
+)
+
+// QuotaUsageTTL keeps the usage of a month for a year, for the quota command to report it
+const QuotaUsageTTL = 400 * 24 * time.Hour
+
+// QuotaConfig is the monthly quota of the jobs run on a repository, a zero limit is unlimited
+type QuotaConfig struct {
+	// UserJobs and UserMinutes limit every user running commands on the repository
+	UserJobs    int `yaml:"user_jobs"`
+	UserMinutes int `yaml:"user_minutes"`
+	// RepoJobs and RepoMinutes limit the repository as a whole
+	RepoJobs    int `yaml:"repo_jobs"`
+	RepoMinutes int `yaml:"repo_minutes"`
+}
+
+// validate checks the limits are not negative
+func (q QuotaConfig) validate() error {
+	if q.UserJobs < 0 || q.UserMinutes < 0 || q.RepoJobs < 0 || q.RepoMinutes < 0 {
+		return fmt.Errorf("quota limits must be at least 0, 0 being unlimited")
+	}
+	return nil
+}
+
+// QuotaLimit is the monthly limit of a user or repository, zero is unlimited
+type QuotaLimit struct {
+	Jobs    int
+	Minutes int
+}
+
+// QuotaUsage is what a user or repository used over a month, Seconds only counts the completed jobs
+type QuotaUsage struct {
+	Jobs    int
+	Seconds int64
+}
+
+// QuotaPeriod is the month the usage at t counts towards
+func QuotaPeriod(t time.Time) string {
+	return t.UTC().Format("2006-01")
+}
+
+// QuotaUsageKey is the Redis hash of the usage of a user or repository (owner/name) over a month
+func QuotaUsageKey(period, scope, name string) string {
+	return fmt.Sprintf("quota:usage:%s:%s:%s", period, scope, name)
+}
+
+// QuotaLimitKey is the Redis hash of the limits an admin of the repository (owner/name) set for a
+// user or for the repository, which replace the configured limits on that repository only
+func QuotaLimitKey(repo, scope, name string) string {
+	if scope == QuotaScopeUser {
+		return fmt.Sprintf("quota:limits:%s:%s:%s", repo, scope, name)
+	}
+	return fmt.Sprintf("quota:limits:%s:%s", scope, repo)
+}
+
+// Limits returns the configured limits of the scope
+func (q QuotaConfig) Limits(scope string) QuotaLimit {
+	if scope == QuotaScopeUser {
+		return QuotaLimit{Jobs: q.UserJobs, Minutes: q.UserMinutes}
+	}
+	return QuotaLimit{Jobs: q.RepoJobs, Minutes: q.RepoMinutes}
+}
+
+// ParseQuotaUsage reads a usage hash, missing fields are zero
+func ParseQuotaUsage(fields map[string]string) QuotaUsage {
+	jobs, _ := strconv.Atoi(fields[QuotaFieldJobs])
+	seconds, _ := strconv.ParseInt(fields[QuotaFieldSeconds], 10, 64)
+	return QuotaUsage{Jobs: jobs, Seconds: seconds}
+}
+
+// WithOverrides returns the limits replaced by the fields of a limits hash an admin set. An
+// override only lowers the configured limit, raising it past the repository configuration is left
+// to the operator.
+func (l QuotaLimit) WithOverrides(fields map[string]string) QuotaLimit {
+	if jobs, err := strconv.Atoi(fields[QuotaFieldJobs]); err == nil && quotaWithin(l.Jobs, jobs) {
+		l.Jobs = jobs
+	}
+	if minutes, err := strconv.Atoi(fields[QuotaFieldMinutes]); err == nil && quotaWithin(l.Minutes, minutes) {
+		l.Minutes = minutes
+	}
+	return l
+}
+
+// CheckOverrides explains which of the limits an admin sets would raise the configured limits
+func (l QuotaLimit) CheckOverrides(fields map[string]string) error {
+	for _, field := range []struct {
+		name       string
+		configured int
+	}{{QuotaFieldJobs, l.Jobs}, {QuotaFieldMinutes, l.Minutes}} {
+		value, ok := fields[field.name]
+		if !ok {
+			continue
+		}
+		if n, err := strconv.Atoi(value); err != nil || !quotaWithin(field.configured, n) {
+			return fmt.Errorf("`--%s %s` would raise the limit of %d configured for the repository, only the operator can raise it", field.name, value, field.configured)
+		}
+	}
+	return nil
+}
+
+// quotaWithin reports whether a limit stays within the configured one, 0 being unlimited
+func quotaWithin(configured, limit int) bool {
+	return configured == 0 || (limit > 0 && limit <= configured)
+}
+
+// Minutes returns the compute minutes used, rounded down
+func (u QuotaUsage) Minutes() int {
+	return int(u.Seconds / 60)
+}
+
+// Exceeded explains why queueing more jobs goes over the limit, it is empty when they fit
+func (l QuotaLimit) Exceeded(u QuotaUsage, jobs int) string {
+	if l.Jobs > 0 && u.Jobs+jobs > l.Jobs {
+		return fmt.Sprintf("%d of the %d jobs of the month already ran", u.Jobs, l.Jobs)
+	}
+	if l.Minutes > 0 && u.Minutes() >= l.Minutes {
+		return fmt.Sprintf("the jobs of the month already used %d of the %d compute minutes", u.Minutes(), l.Minutes)
+	}
+	return ""
+}
+
+// Describe summarizes the usage against the limit for the quota command
+func (l QuotaLimit) Describe(u QuotaUsage) string {
+	limit := func(value int) string {
+		if value == 0 {
+			return "unlimited"
+		}
+		return strconv.Itoa(value)
+	}
+	return fmt.Sprintf("%d jobs (limit: %s), %d compute minutes (limit: %s)", u.Jobs, limit(l.Jobs), u.Minutes(), limit(l.Minutes))
+}
+
+// ParseQuotaLimits validates the --jobs and --minutes options of the quota command
+func ParseQuotaLimits(options map[string]string) (map[string]string, error) {
+	if len(options) == 0 {
+		return nil, fmt.Errorf("set `--jobs`, `--minutes` or both")
+	}
+	limits := make(map[string]string)
+	for name, value := range options {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid `--%s` value `%s`, expected a number of at least 0, 0 being unlimited", name, value)
+		}
+		limits[name] = strconv.Itoa(n)
+	}
+	return limits, nil
+}
@@ -0,0 +1,35 @@
+package util
+
+import "testing"
+
+func TestQuotaLimitKey(t *testing.T) {
+	if got := QuotaLimitKey("instructlab/taxonomy", QuotaScopeUser, "octocat"); got != "quota:limits:instructlab/taxonomy:user:octocat" {
+		t.Errorf("QuotaLimitKey(user) = %q", got)
+	}
+	if got := QuotaLimitKey("instructlab/taxonomy", QuotaScopeRepo, "instructlab/taxonomy"); got != "quota:limits:repo:instructlab/taxonomy" {
+		t.Errorf("QuotaLimitKey(repo) = %q", got)
+	}
+}
+
+// TestQuotaOverrides verify the admins of a repository can lower its configured limits, not raise them.
+func TestQuotaOverrides(t *testing.T) {
+	configured := QuotaLimit{Jobs: 20}
+	for _, tc := range []struct {
+		fields map[string]string
+		want   QuotaLimit
+		valid  bool
+	}{
+		{map[string]string{QuotaFieldJobs: "5"}, QuotaLimit{Jobs: 5}, true},
+		{map[string]string{QuotaFieldJobs: "20", QuotaFieldMinutes: "600"}, QuotaLimit{Jobs: 20, Minutes: 600}, true},
+		{map[string]string{QuotaFieldJobs: "0"}, QuotaLimit{Jobs: 20}, false},
+		{map[string]string{QuotaFieldJobs: "50"}, QuotaLimit{Jobs: 20}, false},
+		{map[string]string{QuotaFieldMinutes: "0"}, QuotaLimit{Jobs: 20}, true},
+	} {
+		if got := configured.WithOverrides(tc.fields); got != tc.want {
+			t.Errorf("WithOverrides(%v) = %+v, want %+v", tc.fields, got, tc.want)
+		}
+		if err := configured.CheckOverrides(tc.fields); (err == nil) != tc.valid {
+			t.Errorf("CheckOverrides(%v) = %v, want valid %t", tc.fields, err, tc.valid)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package util
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// secondaryRateLimitPause is how long the bot pauses after a secondary rate limit response
+// without a Retry-After header, as GitHub advises
+const secondaryRateLimitPause = time.Minute
+
+// RateLimiter follows the GitHub rate limits from the X-RateLimit headers of the responses of
+// the bot, so that the results are posted before running out rather than failing. The limits of
+// all installations are followed together, the bot mostly serves a single one.
+type RateLimiter struct {
+	// Reserve is the number of requests kept for the webhooks once the results are paused
+	Reserve int
+
+	mu        sync.Mutex
+	remaining int
+	reset     time.Time
+	// pausedUntil is set by a secondary rate limit
+	pausedUntil time.Time
+}
+
+type rateLimitTransport struct {
+	limiter *RateLimiter
+	next    http.RoundTripper
+}
+
+func (t rateLimitTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	response, err := t.next.RoundTrip(request)
+	if err == nil {
+		t.limiter.Observe(response, time.Now())
+	}
+	return response, err
+}
+
+// Middleware records the rate limits of the responses of the GitHub clients it wraps
+func (l *RateLimiter) Middleware(next http.RoundTripper) http.RoundTripper {
+	return rateLimitTransport{limiter: l, next: next}
+}
+
+// Observe records the rate limit headers of a GitHub response
+func (l *RateLimiter) Observe(response *http.Response, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if remaining, err := strconv.Atoi(response.Header.Get("X-RateLimit-Remaining")); err == nil {
+		if reset, err := strconv.ParseInt(response.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+			l.remaining = remaining
+			l.reset = time.Unix(reset, 0)
+		}
+	}
+
+	// Secondary rate limits are 403 or 429 responses with a Retry-After header or a message telling
+	// so, a 403 for a missing permission pauses nothing
+	if response.StatusCode != http.StatusForbidden && response.StatusCode != http.StatusTooManyRequests {
+		return
+	}
+	if !isSecondaryRateLimit(response) {
+		return
+	}
+	if retryAfter, err := strconv.Atoi(response.Header.Get("Retry-After")); err == nil {
+		l.pause(now.Add(time.Duration(retryAfter) * time.Second))
+	} else {
+		l.pause(now.Add(secondaryRateLimitPause))
+	}
+}
+
+func (l *RateLimiter) pause(until time.Time) {
+	if until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+}
+
+// Delay is how long to wait before the next requests: until a secondary rate limit is over, or
+// until the reset of the primary limit once it is down to the reserve
+func (l *RateLimiter) Delay(now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var delay time.Duration
+	if l.pausedUntil.After(now) {
+		delay = l.pausedUntil.Sub(now)
+	}
+	if l.remaining <= l.Reserve && l.reset.After(now) && l.reset.Sub(now) > delay {
+		delay = l.reset.Sub(now)
+	}
+	return delay
+}
+
+// Wait blocks until the rate limits allow more requests or the context is cancelled
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	delay := l.Delay(time.Now())
+	if delay <= 0 {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(delay):
+		return nil
+	}
+}
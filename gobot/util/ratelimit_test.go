@@ -0,0 +1,67 @@
+package util
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func rateLimitResponse(status int, headers map[string]string, body string) *http.Response {
+	response := &http.Response{StatusCode: status, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(body))}
+	for name, value := range headers {
+		response.Header.Set(name, value)
+	}
+	return response
+}
+
+// TestRateLimiterPrimary verify the results wait for the reset once the primary limit is down to the reserve.
+func TestRateLimiterPrimary(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	reset := strconv.FormatInt(now.Add(10*time.Minute).Unix(), 10)
+	l := &RateLimiter{Reserve: 100}
+
+	l.Observe(rateLimitResponse(http.StatusOK, map[string]string{"X-RateLimit-Remaining": "500", "X-RateLimit-Reset": reset}, ""), now)
+	if delay := l.Delay(now); delay != 0 {
+		t.Errorf("Delay above the reserve = %v, want 0", delay)
+	}
+	l.Observe(rateLimitResponse(http.StatusOK, map[string]string{"X-RateLimit-Remaining": "100", "X-RateLimit-Reset": reset}, ""), now)
+	if delay := l.Delay(now); delay != 10*time.Minute {
+		t.Errorf("Delay at the reserve = %v, want 10m", delay)
+	}
+	if delay := l.Delay(now.Add(11 * time.Minute)); delay != 0 {
+		t.Errorf("Delay after the reset = %v, want 0", delay)
+	}
+}
+
+// TestRateLimiterSecondary verify only the secondary rate limits pause the results, not the missing permissions.
+func TestRateLimiterSecondary(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	tests := []struct {
+		name     string
+		response *http.Response
+		want     time.Duration
+	}{
+		{"missing permission", rateLimitResponse(http.StatusForbidden, map[string]string{"X-RateLimit-Remaining": "4000"}, `{"message":"Resource not accessible by integration"}`), 0},
+		{"retry after", rateLimitResponse(http.StatusForbidden, map[string]string{"Retry-After": "30"}, ""), 30 * time.Second},
+		{"secondary message", rateLimitResponse(http.StatusForbidden, map[string]string{"X-RateLimit-Remaining": "4000"}, `{"message":"You have exceeded a secondary rate limit."}`), secondaryRateLimitPause},
+		{"too many requests", rateLimitResponse(http.StatusTooManyRequests, nil, ""), secondaryRateLimitPause},
+		{"server error", rateLimitResponse(http.StatusBadGateway, map[string]string{"Retry-After": "30"}, ""), 0},
+	}
+	for _, test := range tests {
+		l := &RateLimiter{}
+		l.Observe(test.response, now)
+		if delay := l.Delay(now); delay != test.want {
+			t.Errorf("%s: Delay = %v, want %v", test.name, delay, test.want)
+		}
+	}
+
+	// The body is still readable by the client
+	response := rateLimitResponse(http.StatusForbidden, nil, `{"message":"Resource not accessible by integration"}`)
+	(&RateLimiter{}).Observe(response, now)
+	if body, _ := io.ReadAll(response.Body); !strings.Contains(string(body), "Resource not accessible") {
+		t.Errorf("body = %q, want it intact", body)
+	}
+}
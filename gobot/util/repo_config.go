@@ -0,0 +1,172 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/instructlab/instructlab-bot/pkg/jobqueue"
+	"gopkg.in/yaml.v3"
+)
+
+// RepoConfig holds the per-repository settings the bot applies to a taxonomy repo.
+type RepoConfig struct {
+	GitRemote       string           `yaml:"git_remote"`
+	RequiredLabels  []string         `yaml:"required_labels"`
+	AllowedCommands []string         `yaml:"allowed_commands"`
+	S3Prefix        string           `yaml:"s3_prefix"`
+	Schedules       []ScheduleConfig `yaml:"schedules"`
+	Policy          PolicyConfig     `yaml:"policy"`
+	Quota           QuotaConfig      `yaml:"quota"`
+	// Maintainers are the teams allowed to run the commands, the --maintainers teams when unset
+	Maintainers []string `yaml:"maintainers"`
+	// NumInstructions is the number of instructions of the generate jobs, the worker default when unset
+	NumInstructions int `yaml:"num_instructions"`
+	// AutoPrecheck runs precheck on every new head of the PRs
+	AutoPrecheck bool `yaml:"auto_precheck"`
+	// EnabledCommands are the commands the repository file enables, on top of AllowedCommands
+	EnabledCommands []string `yaml:"-"`
+}
+
+// ScheduleConfig is a job the bot runs on a cron schedule against a branch of the repository,
+// independently of any PR
+type ScheduleConfig struct {
+	Name    string `yaml:"name"`
+	Cron    string `yaml:"cron"`
+	Command string `yaml:"command"`
+	Branch  string `yaml:"branch"`
+	// Options are the command options without their leading dashes
+	Options map[string]string `yaml:"options"`
+	// TrackingIssue is an issue the results are commented on, results are only logged without one
+	TrackingIssue int `yaml:"tracking_issue"`
+}
+
+// scheduledJobTypes maps the commands that can be scheduled to their job types. PR specific
+// commands such as precheck and train cannot be scheduled.
+var scheduledJobTypes = map[string]string{
+	"generate":       "sdg-svc",
+	"generate-local": "generate",
+	"evaluate":       "evaluate",
+}
+
+// JobType returns the job type of the scheduled command
+func (s ScheduleConfig) JobType() string {
+	return scheduledJobTypes[s.Command]
+}
+
+// JobOptions validates the options of the scheduled command and returns them keyed by their job key
+func (s ScheduleConfig) JobOptions() (map[jobqueue.Field]string, error) {
+	switch s.Command {
+	case "generate-local":
+		return ValidatePipelineOptions(s.Options)
+	case "evaluate":
+		if s.Options["benchmark"] == "mt_bench_branch" {
+			return nil, fmt.Errorf("`mt_bench_branch` compares a PR with its base branch and cannot be scheduled")
+		}
+		return ValidateEvaluateOptions(s.Options)
+	default:
+		return map[jobqueue.Field]string{}, nil
+	}
+}
+
+// validate checks the schedule can be run
+func (s ScheduleConfig) validate() error {
+	if s.Name == "" {
+		return fmt.Errorf("schedule without a name")
+	}
+	if _, err := ParseCron(s.Cron); err != nil {
+		return fmt.Errorf("schedule %s: %w", s.Name, err)
+	}
+	if s.JobType() == "" {
+		return fmt.Errorf("schedule %s: command %q cannot be scheduled, it must be generate, generate-local or evaluate", s.Name, s.Command)
+	}
+	if _, err := s.JobOptions(); err != nil {
+		return fmt.Errorf("schedule %s: %w", s.Name, err)
+	}
+	return nil
+}
+
+// RepoConfigs maps a repository full name (owner/name) to its configuration.
+type RepoConfigs map[string]RepoConfig
+
+// LoadRepoConfigs reads the per-repository configuration file. The file is a
+// YAML map keyed by `owner/name`.
+func LoadRepoConfigs(configPath string) (RepoConfigs, error) {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not read repo config file %s: %w", configPath, err)
+	}
+
+	configs := RepoConfigs{}
+	if err := yaml.Unmarshal(data, &configs); err != nil {
+		return nil, fmt.Errorf("could not parse repo config file %s: %w", configPath, err)
+	}
+
+	for fullName, cfg := range configs {
+		if len(strings.Split(fullName, "/")) != 2 {
+			return nil, fmt.Errorf("invalid repository %q in repo config, expected owner/name", fullName)
+		}
+		if err := cfg.Policy.validate(); err != nil {
+			return nil, fmt.Errorf("invalid policy in repo config for %s: %w", fullName, err)
+		}
+		if err := cfg.Quota.validate(); err != nil {
+			return nil, fmt.Errorf("invalid quota in repo config for %s: %w", fullName, err)
+		}
+		names := make(map[string]bool)
+		for i, schedule := range cfg.Schedules {
+			if err := schedule.validate(); err != nil {
+				return nil, fmt.Errorf("invalid schedule in repo config for %s: %w", fullName, err)
+			}
+			if names[schedule.Name] {
+				return nil, fmt.Errorf("duplicate schedule %s in repo config for %s", schedule.Name, fullName)
+			}
+			names[schedule.Name] = true
+			if schedule.Branch == "" {
+				cfg.Schedules[i].Branch = "main"
+			}
+		}
+	}
+	return configs, nil
+}
+
+// Lookup returns the configuration for the given repository. When no repositories
+// are configured, the bot falls back to serving any repo named common.RepoName with
+// the supplied defaults.
+func (rc RepoConfigs) Lookup(repoOwner, repoName, defaultRepoName string, defaults RepoConfig) (RepoConfig, bool) {
+	if len(rc) == 0 {
+		return defaults, repoName == defaultRepoName
+	}
+
+	cfg, ok := rc[fmt.Sprintf("%s/%s", repoOwner, repoName)]
+	if !ok {
+		return RepoConfig{}, false
+	}
+	if cfg.GitRemote == "" {
+		cfg.GitRemote = fmt.Sprintf("https://github.com/%s/%s", repoOwner, repoName)
+	}
+	if cfg.RequiredLabels == nil {
+		cfg.RequiredLabels = defaults.RequiredLabels
+	}
+	if cfg.Maintainers == nil {
+		cfg.Maintainers = defaults.Maintainers
+	}
+	return cfg, true
+}
+
+// CommandAllowed reports whether the command may be run against the repository, it must be in
+// both the allow list and the commands the repository file enables. An empty list permits every command.
+func (c RepoConfig) CommandAllowed(command string) bool {
+	return commandListed(c.AllowedCommands, command) && commandListed(c.EnabledCommands, command)
+}
+
+func commandListed(commands []string, command string) bool {
+	if len(commands) == 0 {
+		return true
+	}
+	for _, listed := range commands {
+		if listed == command {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,138 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v61/github"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// RepoFileName is the bot configuration taxonomy maintainers keep in their repository
+	RepoFileName = ".instructlab-bot.yaml"
+	// RepoFileTTL is how long a fetched repository file is used before it is fetched again
+	RepoFileTTL = 5 * time.Minute
+)
+
+// BotCommands are the commands a repository can enable, help and quota are always enabled
+var BotCommands = []string{"precheck", "generate", "generate-local", "train", "evaluate", "e2e"}
+
+// RepoFileConfig is the repository file, read from the default branch so a PR cannot change
+// the rules it is checked with. Unset fields keep the settings of the bot.
+type RepoFileConfig struct {
+	// Commands are the enabled commands, within the allowed_commands of the bot
+	Commands        []string `yaml:"commands"`
+	NumInstructions int      `yaml:"num_instructions"`
+	RequiredLabels  []string `yaml:"required_labels"`
+	AutoPrecheck    *bool    `yaml:"auto_precheck"`
+	Maintainers     []string `yaml:"maintainers"`
+	// Found reports whether the repository has the file
+	Found bool `yaml:"-"`
+}
+
+// ParseRepoFile reads a repository file, unknown fields are an error so typos are not ignored
+func ParseRepoFile(data []byte) (RepoFileConfig, error) {
+	var file RepoFileConfig
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	// An empty file has no document
+	if err := decoder.Decode(&file); err != nil && !errors.Is(err, io.EOF) {
+		return RepoFileConfig{}, fmt.Errorf("could not parse %s: %w", RepoFileName, err)
+	}
+	for _, command := range file.Commands {
+		if !commandListed(BotCommands, command) {
+			return RepoFileConfig{}, fmt.Errorf("unknown command %q in %s", command, RepoFileName)
+		}
+	}
+	if file.NumInstructions < 0 {
+		return RepoFileConfig{}, fmt.Errorf("invalid num_instructions %d in %s, it must be a positive integer", file.NumInstructions, RepoFileName)
+	}
+	return file, nil
+}
+
+// WithRepoFile returns the configuration with the settings of the repository file applied
+func (c RepoConfig) WithRepoFile(file RepoFileConfig) RepoConfig {
+	if file.Commands != nil {
+		c.EnabledCommands = file.Commands
+	}
+	if file.NumInstructions > 0 {
+		c.NumInstructions = file.NumInstructions
+	}
+	if file.RequiredLabels != nil {
+		c.RequiredLabels = file.RequiredLabels
+	}
+	if file.AutoPrecheck != nil {
+		c.AutoPrecheck = *file.AutoPrecheck
+	}
+	if file.Maintainers != nil {
+		c.Maintainers = file.Maintainers
+	}
+	return c
+}
+
+// Commands returns the commands enabled for the repository
+func (c RepoConfig) Commands() []string {
+	var commands []string
+	for _, command := range BotCommands {
+		if c.CommandAllowed(command) {
+			commands = append(commands, command)
+		}
+	}
+	return commands
+}
+
+type repoFileEntry struct {
+	file      RepoFileConfig
+	err       error
+	fetchedAt time.Time
+}
+
+// RepoFiles fetches the repository files through the GitHub API, and keeps them for RepoFileTTL
+type RepoFiles struct {
+	mu      sync.Mutex
+	entries map[string]repoFileEntry
+}
+
+func NewRepoFiles() *RepoFiles {
+	return &RepoFiles{entries: make(map[string]repoFileEntry)}
+}
+
+// Get returns the repository file of the default branch of the repository, empty when it has none
+func (f *RepoFiles) Get(ctx context.Context, client *github.Client, repoOwner, repoName string) (RepoFileConfig, error) {
+	key := repoOwner + "/" + repoName
+	f.mu.Lock()
+	entry, ok := f.entries[key]
+	f.mu.Unlock()
+	if ok && time.Since(entry.fetchedAt) < RepoFileTTL {
+		return entry.file, entry.err
+	}
+
+	entry = repoFileEntry{fetchedAt: time.Now()}
+	content, _, response, err := client.Repositories.GetContents(ctx, repoOwner, repoName, RepoFileName, nil)
+	switch {
+	case response != nil && response.StatusCode == http.StatusNotFound:
+	case err != nil:
+		// Not cached, the next event tries again
+		return RepoFileConfig{}, fmt.Errorf("could not fetch %s: %w", RepoFileName, err)
+	default:
+		data, err := content.GetContent()
+		if err != nil {
+			entry.err = fmt.Errorf("could not decode %s: %w", RepoFileName, err)
+		} else {
+			entry.file, entry.err = ParseRepoFile([]byte(data))
+			entry.file.Found = true
+		}
+	}
+
+	f.mu.Lock()
+	f.entries[key] = entry
+	f.mu.Unlock()
+	return entry.file, entry.err
+}
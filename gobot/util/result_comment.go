@@ -0,0 +1,218 @@
+package util
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxVisibleTableRows is how many rows of a result table are shown, the next ones are collapsed
+const maxVisibleTableRows = 20
+
+// blockSeparator separates the markdown blocks of a result comment
+const blockSeparator = "\n\n"
+
+// ResultComment is the markdown of a job result, rendered into comments GitHub accepts
+type ResultComment struct {
+	// Header is kept whole at the top of the first comment, it holds the link to the artifacts
+	Header string
+	// Sections follow the header, such as the token usage or the summary of the job
+	Sections []string
+	// Continued starts the follow-up comments, it links to the artifacts as well
+	Continued string
+}
+
+// Render returns the comments of the result. The rows of the long tables past the first ones
+// are collapsed in a <details> block, and the blocks that do not fit in a comment go into
+// follow-up comments: tables are split between rows with their header repeated, code and
+// <details> blocks are closed and reopened, and lines too long on their own are truncated.
+func (c ResultComment) Render() []string {
+	var comments []string
+	current := c.Header
+	freshRoom := maxCommentLength - len(c.Continued) - len(blockSeparator)
+	for _, block := range c.blocks() {
+		for {
+			room := maxCommentLength - len(current) - len(blockSeparator)
+			if text := block.String(); len(text) <= room {
+				current = joinBlocks(current, text)
+				break
+			}
+			// Blocks fitting in a comment of their own are moved whole to the next one
+			fresh := current == c.Continued
+			if fresh || len(block.String()) > freshRoom {
+				head, rest, ok := block.split(room, fresh)
+				if !ok && fresh {
+					break
+				}
+				if ok {
+					current = joinBlocks(current, head)
+					if len(rest.lines) == 0 {
+						break
+					}
+					block = rest
+				}
+			}
+			comments = append(comments, current)
+			current = c.Continued
+		}
+	}
+	return append(comments, current)
+}
+
+func joinBlocks(comment, block string) string {
+	if comment == "" {
+		return block
+	}
+	return comment + blockSeparator + block
+}
+
+// markdownBlock is a paragraph, a table, a code block or a <details> block of a comment. Its
+// opening and closing lines, such as the header of a table, are repeated when it is split.
+type markdownBlock struct {
+	open  []string
+	lines []string
+	close []string
+}
+
+func (b markdownBlock) render(lines []string) string {
+	all := make([]string, 0, len(b.open)+len(lines)+len(b.close))
+	all = append(all, b.open...)
+	all = append(all, lines...)
+	return strings.Join(append(all, b.close...), "\n")
+}
+
+func (b markdownBlock) String() string {
+	return b.render(b.lines)
+}
+
+// split returns the start of the block fitting in room and the rest of the block. With force,
+// the first line is truncated when not even it fits.
+func (b markdownBlock) split(room int, force bool) (string, markdownBlock, bool) {
+	size := len(b.render(nil))
+	n := 0
+	for n < len(b.lines) && size+len(b.lines[n])+1 <= room {
+		size += len(b.lines[n]) + 1
+		n++
+	}
+	rest := markdownBlock{open: b.open, close: b.close}
+	if n > 0 {
+		rest.lines = b.lines[n:]
+		return b.render(b.lines[:n]), rest, true
+	}
+	if !force || len(b.lines) == 0 || room-size-1 <= len("…") {
+		return "", b, false
+	}
+	rest.lines = b.lines[1:]
+	return b.render([]string{truncateBytes(b.lines[0], room-size-1)}), rest, true
+}
+
+// truncateBytes cuts text to at most maxLen bytes, on a rune boundary, ending with an ellipsis
+func truncateBytes(text string, maxLen int) string {
+	if len(text) <= maxLen {
+		return text
+	}
+	cut := maxLen - len("…")
+	for cut > 0 && !isRuneStart(text[cut]) {
+		cut--
+	}
+	return text[:cut] + "…"
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+// blocks parses the sections into markdown blocks and collapses the long tables
+func (c ResultComment) blocks() []markdownBlock {
+	var blocks []markdownBlock
+	for _, section := range c.Sections {
+		for _, block := range parseMarkdownBlocks(section) {
+			if !block.isTable() || len(block.lines) <= maxVisibleTableRows {
+				blocks = append(blocks, block)
+				continue
+			}
+			hidden := block.lines[maxVisibleTableRows:]
+			block.lines = block.lines[:maxVisibleTableRows]
+			blocks = append(blocks, block, markdownBlock{
+				open:  append([]string{"<details>", fmt.Sprintf("<summary>%d more rows</summary>", len(hidden)), ""}, block.open...),
+				lines: hidden,
+				close: []string{"", "</details>"},
+			})
+		}
+	}
+	return blocks
+}
+
+func (b markdownBlock) isTable() bool {
+	return len(b.open) == 2 && strings.HasPrefix(b.open[0], "|")
+}
+
+// parseMarkdownBlocks splits markdown into blocks on the blank lines outside of the code and
+// <details> blocks
+func parseMarkdownBlocks(text string) []markdownBlock {
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+	var blocks []markdownBlock
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+			i++
+		case strings.HasPrefix(trimmed, "```"):
+			end := i + 1
+			for end < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[end]), "```") {
+				end++
+			}
+			block := markdownBlock{open: []string{line}, lines: lines[i+1 : min(end, len(lines))], close: []string{"```"}}
+			blocks = append(blocks, block)
+			i = end + 1
+		case strings.HasPrefix(trimmed, "<details") && !strings.Contains(trimmed, "</details>"):
+			depth, end := 1, i+1
+			for ; end < len(lines) && depth > 0; end++ {
+				inner := strings.TrimSpace(lines[end])
+				if strings.HasPrefix(inner, "<details") {
+					depth++
+				} else if strings.HasPrefix(inner, "</details>") {
+					depth--
+				}
+			}
+			block := markdownBlock{open: []string{line}, lines: lines[i+1 : end]}
+			if len(block.lines) > 0 && strings.HasPrefix(strings.TrimSpace(block.lines[0]), "<summary") {
+				block.open = append(block.open, block.lines[0])
+				block.lines = block.lines[1:]
+			}
+			if depth == 0 {
+				block.close = block.lines[len(block.lines)-1:]
+				block.lines = block.lines[:len(block.lines)-1]
+			} else {
+				block.close = []string{"</details>"}
+			}
+			blocks = append(blocks, block)
+			i = end
+		case strings.HasPrefix(trimmed, "|"):
+			end := i + 1
+			for end < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[end]), "|") {
+				end++
+			}
+			block := markdownBlock{lines: lines[i:end]}
+			if len(block.lines) > 1 && strings.Contains(block.lines[1], "---") {
+				block.open, block.lines = block.lines[:2], block.lines[2:]
+			}
+			blocks = append(blocks, block)
+			i = end
+		default:
+			end := i + 1
+			for end < len(lines) && !startsBlock(lines[end]) {
+				end++
+			}
+			blocks = append(blocks, markdownBlock{lines: lines[i:end]})
+			i = end
+		}
+	}
+	return blocks
+}
+
+// startsBlock tells whether a line ends the paragraph before it
+func startsBlock(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	return trimmed == "" || strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "<details") || strings.HasPrefix(trimmed, "|")
+}
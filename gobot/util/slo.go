@@ -0,0 +1,201 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Latencies of a job tracked against their SLO
+const (
+	// LatencyQueueWait is the wait of a job in the queue, from its enqueue to its start by a worker
+	LatencyQueueWait = "queue_wait"
+	// LatencyEndToEnd is the latency of a job from the comment requesting it to its results comment
+	LatencyEndToEnd = "end_to_end"
+)
+
+// latencyBuckets are the upper bounds of the latency histograms, in seconds
+var latencyBuckets = []float64{10, 30, 60, 300, 900, 1800, 3600, 7200, 21600, 43200, 86400}
+
+// ParseSLOs parses SLO thresholds, type=duration for a job type or a bare duration for the job
+// types without one, 30m,precheck=5m for instance. The default is keyed by "".
+func ParseSLOs(values []string) (map[string]time.Duration, error) {
+	slos := make(map[string]time.Duration)
+	for _, value := range values {
+		jobType, threshold, found := strings.Cut(value, "=")
+		if !found {
+			jobType, threshold = "", value
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(threshold))
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid SLO %q, expected a positive duration or type=duration", value)
+		}
+		slos[strings.TrimSpace(jobType)] = d
+	}
+	return slos, nil
+}
+
+// sloThreshold returns the SLO of the job type, falling back to the default
+func sloThreshold(slos map[string]time.Duration, jobType string) (time.Duration, bool) {
+	if d, ok := slos[jobType]; ok {
+		return d, true
+	}
+	d, ok := slos[""]
+	return d, ok
+}
+
+// latencyKey identifies a latency of a job type
+type latencyKey struct {
+	latency string
+	jobType string
+}
+
+// latencyHistogram is a Prometheus histogram of latencies in seconds
+type latencyHistogram struct {
+	counts []int64
+	count  int64
+	sum    float64
+}
+
+// LatencyTracker records the queue wait and the end-to-end latency of the jobs by job type,
+// exports them as Prometheus histograms, and alerts a Slack incoming webhook when a job breaches
+// the SLO of its type. An alert is sent at most once per Cooldown for a latency of a job type.
+type LatencyTracker struct {
+	Logger          *zap.SugaredLogger
+	SLOs            map[string]map[string]time.Duration
+	SlackWebhookURL string
+	Cooldown        time.Duration
+
+	mu         sync.Mutex
+	histograms map[latencyKey]*latencyHistogram
+	breaches   map[latencyKey]int64
+	lastAlert  map[latencyKey]time.Time
+}
+
+// Observe records a latency of a job and alerts when it breaches the SLO of its type
+func (t *LatencyTracker) Observe(latency, jobType, jobID string, d time.Duration) {
+	if d < 0 {
+		return
+	}
+	key := latencyKey{latency: latency, jobType: jobType}
+	threshold, hasSLO := sloThreshold(t.SLOs[latency], jobType)
+	breached := hasSLO && d > threshold
+
+	t.mu.Lock()
+	if t.histograms == nil {
+		t.histograms = make(map[latencyKey]*latencyHistogram)
+		t.breaches = make(map[latencyKey]int64)
+		t.lastAlert = make(map[latencyKey]time.Time)
+	}
+	h, ok := t.histograms[key]
+	if !ok {
+		h = &latencyHistogram{counts: make([]int64, len(latencyBuckets))}
+		t.histograms[key] = h
+	}
+	for i, bound := range latencyBuckets {
+		if d.Seconds() <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += d.Seconds()
+	alert := false
+	if breached {
+		t.breaches[key]++
+		if last, ok := t.lastAlert[key]; !ok || time.Since(last) >= t.Cooldown {
+			t.lastAlert[key] = time.Now()
+			alert = t.SlackWebhookURL != ""
+		}
+	}
+	t.mu.Unlock()
+
+	if breached {
+		t.Logger.Warnf("Job %s of type %s breached its %s SLO: %s, over %s", jobID, jobType, latency, d.Round(time.Second), threshold)
+	}
+	if alert {
+		text := fmt.Sprintf(":warning: The %s latency of %s job %s is %s, over its SLO of %s.", strings.ReplaceAll(latency, "_", "-"), jobType, jobID, d.Round(time.Second), threshold)
+		go t.postSlackAlert(text)
+	}
+}
+
+// postSlackAlert posts the alert to the Slack incoming webhook
+func (t *LatencyTracker) postSlackAlert(text string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	body, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.SlackWebhookURL, bytes.NewReader(body))
+	if err != nil {
+		t.Logger.Errorf("Failed to post the SLO alert to Slack: %v", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Logger.Errorf("Failed to post the SLO alert to Slack: %v", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		t.Logger.Errorf("Failed to post the SLO alert to Slack: %s", resp.Status)
+	}
+}
+
+// Metrics returns the latency histograms and the SLO breaches in the Prometheus text format
+func (t *LatencyTracker) Metrics() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	keys := make([]latencyKey, 0, len(t.histograms))
+	for key := range t.histograms {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].latency != keys[j].latency {
+			return keys[i].latency < keys[j].latency
+		}
+		return keys[i].jobType < keys[j].jobType
+	})
+
+	var b strings.Builder
+	for _, latency := range []string{LatencyQueueWait, LatencyEndToEnd} {
+		name := "instructlab_bot_job_" + latency + "_seconds"
+		fmt.Fprintf(&b, "# HELP %s %s\n", name, latencyHelp[latency])
+		fmt.Fprintf(&b, "# TYPE %s histogram\n", name)
+		for _, key := range keys {
+			if key.latency != latency {
+				continue
+			}
+			h := t.histograms[key]
+			for i, bound := range latencyBuckets {
+				fmt.Fprintf(&b, "%s_bucket{job_type=%q,le=\"%g\"} %d\n", name, key.jobType, bound, h.counts[i])
+			}
+			fmt.Fprintf(&b, "%s_bucket{job_type=%q,le=\"+Inf\"} %d\n", name, key.jobType, h.count)
+			fmt.Fprintf(&b, "%s_sum{job_type=%q} %g\n", name, key.jobType, h.sum)
+			fmt.Fprintf(&b, "%s_count{job_type=%q} %d\n", name, key.jobType, h.count)
+		}
+	}
+	b.WriteString("# HELP instructlab_bot_slo_breaches_total Jobs whose latency breached the SLO of their type.\n")
+	b.WriteString("# TYPE instructlab_bot_slo_breaches_total counter\n")
+	for _, key := range keys {
+		if n, ok := t.breaches[key]; ok {
+			fmt.Fprintf(&b, "instructlab_bot_slo_breaches_total{job_type=%q,slo=%q} %d\n", key.jobType, key.latency, n)
+		}
+	}
+	return b.String()
+}
+
+var latencyHelp = map[string]string{
+	LatencyQueueWait: "Wait of the jobs in the queue, from their enqueue to their start by a worker.",
+	LatencyEndToEnd:  "Latency of the jobs from the comment requesting them to their results.",
+}
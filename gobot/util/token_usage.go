@@ -0,0 +1,39 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// TokenUsage is the token usage summary a worker records for a job
+type TokenUsage struct {
+	Requests         int     `json:"requests"`
+	CachedRequests   int     `json:"cached_requests"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	TotalTokens      int     `json:"total_tokens"`
+	EstimatedCost    float64 `json:"estimated_cost"`
+	Currency         string  `json:"currency"`
+}
+
+// ParseTokenUsage decodes the token usage of a job
+func ParseTokenUsage(usageJSON string) (*TokenUsage, error) {
+	var usage TokenUsage
+	if err := json.Unmarshal([]byte(usageJSON), &usage); err != nil {
+		return nil, err
+	}
+	return &usage, nil
+}
+
+// Markdown describes the token usage for the results comment
+func (u *TokenUsage) Markdown() string {
+	msg := fmt.Sprintf("**Token usage:** %d prompt + %d completion tokens over %d requests",
+		u.PromptTokens, u.CompletionTokens, u.Requests)
+	if u.CachedRequests > 0 {
+		msg += fmt.Sprintf(", %d answered from cache", u.CachedRequests)
+	}
+	if u.Currency != "" {
+		msg += fmt.Sprintf(" (estimated cost: %.4f %s)", u.EstimatedCost, u.Currency)
+	}
+	return msg + "."
+}
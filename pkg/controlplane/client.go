@@ -0,0 +1,126 @@
+package controlplane
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// Client is the worker side of the control plane
+type Client struct {
+	conn *grpc.ClientConn
+}
+
+// NewClient returns a client of the control plane at addr, host:port. A nil tlsConfig connects
+// without TLS, for local development only.
+func NewClient(addr string, tlsConfig *tls.Config, opts ...grpc.DialOption) (*Client, error) {
+	creds := insecure.NewCredentials()
+	if tlsConfig != nil {
+		creds = credentials.NewTLS(tlsConfig)
+	}
+	opts = append(opts, grpc.WithTransportCredentials(creds), grpc.WithDefaultCallOptions(grpc.ForceCodec(codec{})))
+	conn, err := grpc.NewClient(addr, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{conn: conn}, nil
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Register registers the worker, again after the bot restarted and forgot it
+func (c *Client) Register(ctx context.Context, req *RegisterRequest) (*RegisterResponse, error) {
+	resp := new(RegisterResponse)
+	if err := c.conn.Invoke(ctx, methodName("Register"), req, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Complete reports the results of a job
+func (c *Client) Complete(ctx context.Context, req *ResultRequest) error {
+	return c.conn.Invoke(ctx, methodName("Complete"), req, new(ResultResponse))
+}
+
+// Jobs opens the stream the worker asks for its jobs on
+func (c *Client) Jobs(ctx context.Context) (*JobsClient, error) {
+	stream, err := c.conn.NewStream(ctx, &serviceDesc.Streams[0], methodName("Jobs"))
+	if err != nil {
+		return nil, err
+	}
+	return &JobsClient{stream: stream}, nil
+}
+
+// Progress opens the stream the worker sends the progress of its jobs on
+func (c *Client) Progress(ctx context.Context) (*ProgressClient, error) {
+	stream, err := c.conn.NewStream(ctx, &serviceDesc.Streams[1], methodName("Progress"))
+	if err != nil {
+		return nil, err
+	}
+	return &ProgressClient{stream: stream}, nil
+}
+
+// JobsClient asks for jobs one at a time
+type JobsClient struct {
+	stream grpc.ClientStream
+}
+
+// Next asks for the next job and waits until the bot assigns one
+func (j *JobsClient) Next(workerID string) (*JobAssignment, error) {
+	if err := j.stream.SendMsg(&JobRequest{WorkerID: workerID}); err != nil {
+		return nil, err
+	}
+	assignment := new(JobAssignment)
+	if err := j.stream.RecvMsg(assignment); err != nil {
+		return nil, err
+	}
+	return assignment, nil
+}
+
+// Close tells the bot the worker asks for no more jobs
+func (j *JobsClient) Close() error {
+	return j.stream.CloseSend()
+}
+
+// ProgressClient sends progress updates
+type ProgressClient struct {
+	stream grpc.ClientStream
+}
+
+func (p *ProgressClient) Send(update *ProgressUpdate) error {
+	return p.stream.SendMsg(update)
+}
+
+// CloseAndRecv closes the stream and returns how many updates the bot received
+func (p *ProgressClient) CloseAndRecv() (*ProgressResponse, error) {
+	if err := p.stream.CloseSend(); err != nil {
+		return nil, err
+	}
+	resp := new(ProgressResponse)
+	if err := p.stream.RecvMsg(resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// IsUnavailable reports whether err is a failure to reach the control plane, the call can be
+// retried
+func IsUnavailable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	return status.Code(err) == codes.Unavailable
+}
+
+// IsUnknownWorker reports whether the bot does not know the worker, which has to register again
+func IsUnknownWorker(err error) bool {
+	return status.Code(err) == codes.NotFound
+}
@@ -0,0 +1,216 @@
+// Package controlplane is the gRPC API between the bot and the workers, for the deployments that
+// dispatch the jobs to the workers instead of having them poll the Redis job queue. The workers
+// register, ask for their next job and are pushed one as soon as it is queued, stream their
+// progress and report their results. The bot keeps the jobs in Redis, see jobqueue.
+//
+// The messages are Go types encoded as JSON, there is no protobuf compiler in the build.
+package controlplane
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/instructlab/instructlab-bot/pkg/jobqueue"
+	"google.golang.org/grpc"
+)
+
+// ServiceName is the gRPC service of the control plane
+const ServiceName = "instructlab.bot.controlplane.v1.ControlPlane"
+
+// RegisterRequest introduces a worker to the bot
+type RegisterRequest struct {
+	// Worker names the worker in the logs of the bot, the common name of its client certificate
+	// replaces it
+	Worker  string `json:"worker"`
+	Version string `json:"version,omitempty"`
+}
+
+type RegisterResponse struct {
+	// WorkerID identifies the worker in its next requests, until the bot restarts
+	WorkerID string `json:"worker_id"`
+}
+
+// JobRequest asks for the next job, a worker sends one whenever it is idle
+type JobRequest struct {
+	WorkerID string `json:"worker_id"`
+}
+
+// JobAssignment is the job the worker runs next, with the fields the bot queued it with. The bot
+// starts the job as it assigns it.
+type JobAssignment struct {
+	JobID  string                    `json:"job_id"`
+	Fields map[jobqueue.Field]string `json:"fields,omitempty"`
+}
+
+// ProgressUpdate is the partial progress of the job assigned to the worker, the JSON of
+// jobs:<id>:progress
+type ProgressUpdate struct {
+	WorkerID string `json:"worker_id"`
+	JobID    string `json:"job_id"`
+	Progress string `json:"progress"`
+}
+
+type ProgressResponse struct {
+	// Updates is the number of updates the bot received on the stream
+	Updates int `json:"updates"`
+}
+
+// ResultRequest completes the job assigned to the worker with the fields it sets once it is done
+type ResultRequest struct {
+	WorkerID string                    `json:"worker_id"`
+	JobID    string                    `json:"job_id"`
+	Fields   map[jobqueue.Field]string `json:"fields"`
+}
+
+type ResultResponse struct{}
+
+// FieldValues formats the job fields of a result the way Redis stores them
+func FieldValues(fields map[jobqueue.Field]interface{}) map[jobqueue.Field]string {
+	values := make(map[jobqueue.Field]string, len(fields))
+	for field, value := range fields {
+		switch v := value.(type) {
+		case string:
+			values[field] = v
+		case []byte:
+			values[field] = string(v)
+		case float64:
+			values[field] = strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			values[field] = fmt.Sprint(v)
+		}
+	}
+	return values
+}
+
+// codec encodes the messages as JSON
+type codec struct{}
+
+func (codec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (codec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+func (codec) Name() string {
+	return "json"
+}
+
+// Server is the bot side of the control plane
+type Server interface {
+	Register(context.Context, *RegisterRequest) (*RegisterResponse, error)
+	// Jobs answers every JobRequest of the stream with a JobAssignment once a job is queued
+	Jobs(JobsServer) error
+	// Progress records the updates of the stream until the worker closes it
+	Progress(ProgressServer) error
+	Complete(context.Context, *ResultRequest) (*ResultResponse, error)
+}
+
+// JobsServer is the stream of the job requests of a worker
+type JobsServer interface {
+	Send(*JobAssignment) error
+	Recv() (*JobRequest, error)
+	grpc.ServerStream
+}
+
+// ProgressServer is the stream of the progress updates of a worker
+type ProgressServer interface {
+	SendAndClose(*ProgressResponse) error
+	Recv() (*ProgressUpdate, error)
+	grpc.ServerStream
+}
+
+// NewGRPCServer returns a gRPC server encoding the messages of the control plane, serving srv
+func NewGRPCServer(srv Server, opts ...grpc.ServerOption) *grpc.Server {
+	s := grpc.NewServer(append(opts, grpc.ForceServerCodec(codec{}))...)
+	s.RegisterService(&serviceDesc, srv)
+	return s
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*Server)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "Register", Handler: registerHandler},
+		{MethodName: "Complete", Handler: completeHandler},
+	},
+	Streams: []grpc.StreamDesc{
+		{StreamName: "Jobs", Handler: jobsHandler, ServerStreams: true, ClientStreams: true},
+		{StreamName: "Progress", Handler: progressHandler, ClientStreams: true},
+	},
+}
+
+func methodName(method string) string {
+	return "/" + ServiceName + "/" + method
+}
+
+func registerHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RegisterRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(Server).Register(ctx, req.(*RegisterRequest))
+	}
+	if interceptor == nil {
+		return handler(ctx, in)
+	}
+	return interceptor(ctx, in, &grpc.UnaryServerInfo{Server: srv, FullMethod: methodName("Register")}, handler)
+}
+
+func completeHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ResultRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(Server).Complete(ctx, req.(*ResultRequest))
+	}
+	if interceptor == nil {
+		return handler(ctx, in)
+	}
+	return interceptor(ctx, in, &grpc.UnaryServerInfo{Server: srv, FullMethod: methodName("Complete")}, handler)
+}
+
+func jobsHandler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(Server).Jobs(&jobsServer{stream})
+}
+
+func progressHandler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(Server).Progress(&progressServer{stream})
+}
+
+type jobsServer struct {
+	grpc.ServerStream
+}
+
+func (s *jobsServer) Send(assignment *JobAssignment) error {
+	return s.SendMsg(assignment)
+}
+
+func (s *jobsServer) Recv() (*JobRequest, error) {
+	req := new(JobRequest)
+	if err := s.RecvMsg(req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+type progressServer struct {
+	grpc.ServerStream
+}
+
+func (s *progressServer) SendAndClose(resp *ProgressResponse) error {
+	return s.SendMsg(resp)
+}
+
+func (s *progressServer) Recv() (*ProgressUpdate, error) {
+	update := new(ProgressUpdate)
+	if err := s.RecvMsg(update); err != nil {
+		return nil, err
+	}
+	return update, nil
+}
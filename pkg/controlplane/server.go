@@ -0,0 +1,245 @@
+package controlplane
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/instructlab/instructlab-bot/pkg/jobqueue"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// dequeueWait is how long a job request blocks on the queue before checking its stream is alive
+const dequeueWait = 5 * time.Second
+
+// Queue is the job queue the control plane dispatches, a *jobqueue.Client
+type Queue interface {
+	DequeueWait(ctx context.Context, timeout time.Duration) (string, error)
+	Requeue(ctx context.Context, jobID string) error
+	Start(ctx context.Context, jobID string, fields map[jobqueue.Field]interface{}) error
+	Fields(ctx context.Context, jobID string, fields []jobqueue.Field) (map[jobqueue.Field]string, error)
+	Set(ctx context.Context, jobID string, field jobqueue.Field, value interface{}) error
+	Complete(ctx context.Context, jobID string, fields map[jobqueue.Field]interface{}) error
+	Maintenance(ctx context.Context) (*jobqueue.Maintenance, error)
+}
+
+// WorkerInfo is a registered worker
+type WorkerInfo struct {
+	ID      string
+	Name    string
+	Version string
+	// Job is the last job assigned to the worker, "" before its first one
+	Job      string
+	LastSeen time.Time
+}
+
+// QueueServer is the control plane of the bot, it dispatches the jobs of the Redis job queue to
+// the workers and writes back their progress and results
+type QueueServer struct {
+	queue   Queue
+	wait    time.Duration
+	mu      sync.Mutex
+	workers map[string]*WorkerInfo
+	count   int
+}
+
+func NewQueueServer(queue Queue) *QueueServer {
+	return &QueueServer{queue: queue, wait: dequeueWait, workers: make(map[string]*WorkerInfo)}
+}
+
+func (s *QueueServer) Register(ctx context.Context, req *RegisterRequest) (*RegisterResponse, error) {
+	name := req.Worker
+	// The certificate authenticates the worker, its name cannot be borrowed
+	if cn := peerName(ctx); cn != "" {
+		name = cn
+	}
+	if name == "" {
+		return nil, status.Error(codes.InvalidArgument, "the worker has no name")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.count++
+	id := fmt.Sprintf("%s-%d", name, s.count)
+	s.workers[id] = &WorkerInfo{ID: id, Name: name, Version: req.Version, LastSeen: time.Now()}
+	return &RegisterResponse{WorkerID: id}, nil
+}
+
+// Workers lists the registered workers
+func (s *QueueServer) Workers() []WorkerInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	workers := make([]WorkerInfo, 0, len(s.workers))
+	for _, worker := range s.workers {
+		workers = append(workers, *worker)
+	}
+	sort.Slice(workers, func(i, j int) bool { return workers[i].ID < workers[j].ID })
+	return workers
+}
+
+// seen records the activity of a worker, it reports false for the unknown workers
+func (s *QueueServer) seen(workerID, job string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	worker, ok := s.workers[workerID]
+	if !ok {
+		return false
+	}
+	worker.LastSeen = time.Now()
+	if job != "" {
+		worker.Job = job
+	}
+	return true
+}
+
+// assigned records the activity of a worker reporting on a job, it fails unless the job is the
+// one assigned to the worker
+func (s *QueueServer) assigned(workerID, jobID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	worker, ok := s.workers[workerID]
+	if !ok {
+		return status.Errorf(codes.NotFound, "unknown worker %q, register first", workerID)
+	}
+	worker.LastSeen = time.Now()
+	if jobID == "" || jobID != worker.Job {
+		return status.Errorf(codes.PermissionDenied, "job %q is not assigned to worker %q", jobID, workerID)
+	}
+	return nil
+}
+
+// version is the version the worker registered with
+func (s *QueueServer) version(workerID string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if worker, ok := s.workers[workerID]; ok {
+		return worker.Version
+	}
+	return ""
+}
+
+func (s *QueueServer) Jobs(stream JobsServer) error {
+	ctx := stream.Context()
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !s.seen(req.WorkerID, "") {
+			return status.Errorf(codes.NotFound, "unknown worker %q, register first", req.WorkerID)
+		}
+		jobID, err := s.nextJob(ctx)
+		if err != nil {
+			return err
+		}
+		assignment, err := s.startJob(ctx, req.WorkerID, jobID)
+		if err == nil {
+			// The job is the worker's before it hears of it, its first progress update may come
+			// before Send returns
+			s.seen(req.WorkerID, jobID)
+			err = stream.Send(assignment)
+		}
+		if err != nil {
+			// The worker is gone, its job goes back to the head of the queue
+			if requeueErr := s.queue.Requeue(context.Background(), jobID); requeueErr != nil {
+				return fmt.Errorf("could not requeue job %s: %v, after %w", jobID, requeueErr, err)
+			}
+			return err
+		}
+	}
+}
+
+// startJob marks the job as started by the worker, like a worker starting it in Redis, and reads
+// the fields the worker runs it with
+func (s *QueueServer) startJob(ctx context.Context, workerID, jobID string) (*JobAssignment, error) {
+	err := s.queue.Start(ctx, jobID, map[jobqueue.Field]interface{}{
+		jobqueue.FieldStatus:        jobqueue.StatusRunning,
+		jobqueue.FieldStartTime:     time.Now().Unix(),
+		jobqueue.FieldWorkerVersion: s.version(workerID),
+	})
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "could not start job %s: %v", jobID, err)
+	}
+	fields, err := s.queue.Fields(ctx, jobID, jobqueue.QueueFields)
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "could not read the fields of job %s: %v", jobID, err)
+	}
+	return &JobAssignment{JobID: jobID, Fields: fields}, nil
+}
+
+// nextJob waits for a job to be queued, or the stream to end. No job is handed out during a
+// maintenance, the queued jobs wait for it to end.
+func (s *QueueServer) nextJob(ctx context.Context) (string, error) {
+	for {
+		if maintenance, err := s.queue.Maintenance(ctx); err == nil && maintenance != nil {
+			select {
+			case <-ctx.Done():
+				return "", status.FromContextError(ctx.Err()).Err()
+			case <-time.After(s.wait):
+			}
+			continue
+		}
+		jobID, err := s.queue.DequeueWait(ctx, s.wait)
+		if ctx.Err() != nil {
+			if jobID != "" {
+				_ = s.queue.Requeue(context.Background(), jobID)
+			}
+			return "", status.FromContextError(ctx.Err()).Err()
+		}
+		if err != nil {
+			return "", status.Errorf(codes.Unavailable, "could not read the job queue: %v", err)
+		}
+		if jobID != "" {
+			return jobID, nil
+		}
+	}
+}
+
+func (s *QueueServer) Progress(stream ProgressServer) error {
+	updates := 0
+	for {
+		update, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return stream.SendAndClose(&ProgressResponse{Updates: updates})
+		}
+		if err != nil {
+			return err
+		}
+		if update.JobID == "" {
+			return status.Error(codes.InvalidArgument, "the progress update has no job")
+		}
+		if err := s.assigned(update.WorkerID, update.JobID); err != nil {
+			return err
+		}
+		if err := s.queue.Set(stream.Context(), update.JobID, jobqueue.FieldProgress, update.Progress); err != nil {
+			return status.Errorf(codes.Unavailable, "could not set the progress of job %s: %v", update.JobID, err)
+		}
+		updates++
+	}
+}
+
+// Complete sets the results of the job and queues it for the bot to report, like a worker
+// completing it in Redis. Only the worker the job is assigned to completes it.
+func (s *QueueServer) Complete(ctx context.Context, req *ResultRequest) (*ResultResponse, error) {
+	if req.JobID == "" {
+		return nil, status.Error(codes.InvalidArgument, "the result has no job")
+	}
+	if err := s.assigned(req.WorkerID, req.JobID); err != nil {
+		return nil, err
+	}
+	fields := make(map[jobqueue.Field]interface{}, len(req.Fields))
+	for field, value := range req.Fields {
+		fields[field] = value
+	}
+	if err := s.queue.Complete(ctx, req.JobID, fields); err != nil {
+		return nil, status.Errorf(codes.Unavailable, "could not complete job %s: %v", req.JobID, err)
+	}
+	return &ResultResponse{}, nil
+}
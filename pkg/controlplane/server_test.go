@@ -0,0 +1,313 @@
+package controlplane
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/instructlab/instructlab-bot/pkg/jobqueue"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryQueue is a job queue kept in memory
+type memoryQueue struct {
+	mu        sync.Mutex
+	queued    []string
+	fields    map[string]map[jobqueue.Field]string
+	completed []string
+	// maintenance is the maintenance in progress, nil when there is none
+	maintenance *jobqueue.Maintenance
+}
+
+func newMemoryQueue(jobs ...string) *memoryQueue {
+	return &memoryQueue{queued: jobs, fields: make(map[string]map[jobqueue.Field]string)}
+}
+
+func (q *memoryQueue) DequeueWait(ctx context.Context, timeout time.Duration) (string, error) {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) && ctx.Err() == nil {
+		q.mu.Lock()
+		if len(q.queued) > 0 {
+			jobID := q.queued[0]
+			q.queued = q.queued[1:]
+			q.mu.Unlock()
+			return jobID, nil
+		}
+		q.mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+	}
+	return "", nil
+}
+
+func (q *memoryQueue) Requeue(ctx context.Context, jobID string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.queued = append([]string{jobID}, q.queued...)
+	return nil
+}
+
+func (q *memoryQueue) Start(ctx context.Context, jobID string, fields map[jobqueue.Field]interface{}) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for field, value := range fields {
+		q.set(jobID, field, fmt.Sprint(value))
+	}
+	return nil
+}
+
+func (q *memoryQueue) Fields(ctx context.Context, jobID string, fields []jobqueue.Field) (map[jobqueue.Field]string, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	values := make(map[jobqueue.Field]string)
+	for _, field := range fields {
+		if value, ok := q.fields[jobID][field]; ok {
+			values[field] = value
+		}
+	}
+	return values, nil
+}
+
+func (q *memoryQueue) Set(ctx context.Context, jobID string, field jobqueue.Field, value interface{}) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.set(jobID, field, value)
+	return nil
+}
+
+func (q *memoryQueue) Complete(ctx context.Context, jobID string, fields map[jobqueue.Field]interface{}) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for field, value := range fields {
+		q.set(jobID, field, value)
+	}
+	q.completed = append(q.completed, jobID)
+	return nil
+}
+
+func (q *memoryQueue) Maintenance(ctx context.Context) (*jobqueue.Maintenance, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.maintenance, nil
+}
+
+func (q *memoryQueue) set(jobID string, field jobqueue.Field, value interface{}) {
+	if q.fields[jobID] == nil {
+		q.fields[jobID] = make(map[jobqueue.Field]string)
+	}
+	q.fields[jobID][field] = value.(string)
+}
+
+// startServer serves a control plane of the queue on a local port
+func startServer(t *testing.T, queue Queue) (*QueueServer, *Client) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := NewQueueServer(queue)
+	srv.wait = 50 * time.Millisecond
+	grpcServer := NewGRPCServer(srv)
+	go func() { _ = grpcServer.Serve(lis) }()
+	t.Cleanup(grpcServer.Stop)
+
+	client, err := NewClient(lis.Addr().String(), nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = client.Close() })
+	return srv, client
+}
+
+// TestControlPlane verify a worker registers, receives the queued jobs in order with their fields,
+// and its progress and results are written to the queue.
+func TestControlPlane(t *testing.T) {
+	queue := newMemoryQueue("1", "2")
+	queue.set("1", jobqueue.FieldJobType, "precheck")
+	queue.set("1", jobqueue.FieldPRNumber, "7")
+	srv, client := startServer(t, queue)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	registered, err := client.Register(ctx, &RegisterRequest{Worker: "gpu", Version: "v1"})
+	require.NoError(t, err)
+	assert.Equal(t, "gpu-1", registered.WorkerID)
+
+	jobs, err := client.Jobs(ctx)
+	require.NoError(t, err)
+	defer jobs.Close()
+	first, err := jobs.Next(registered.WorkerID)
+	require.NoError(t, err)
+	assert.Equal(t, "1", first.JobID)
+	assert.Equal(t, map[jobqueue.Field]string{jobqueue.FieldJobType: "precheck", jobqueue.FieldPRNumber: "7"}, first.Fields)
+
+	progress, err := client.Progress(ctx)
+	require.NoError(t, err)
+	require.NoError(t, progress.Send(&ProgressUpdate{WorkerID: registered.WorkerID, JobID: "1", Progress: `{"done":1}`}))
+	require.NoError(t, progress.Send(&ProgressUpdate{WorkerID: registered.WorkerID, JobID: "1", Progress: `{"done":2}`}))
+	closed, err := progress.CloseAndRecv()
+	require.NoError(t, err)
+	assert.Equal(t, 2, closed.Updates)
+
+	err = client.Complete(ctx, &ResultRequest{
+		WorkerID: registered.WorkerID,
+		JobID:    "1",
+		Fields:   FieldValues(map[jobqueue.Field]interface{}{jobqueue.FieldStatus: jobqueue.StatusSuccess, jobqueue.FieldDuration: float64(42)}),
+	})
+	require.NoError(t, err)
+
+	second, err := jobs.Next(registered.WorkerID)
+	require.NoError(t, err)
+	assert.Equal(t, "2", second.JobID)
+
+	queue.mu.Lock()
+	assert.Equal(t, []string{"1"}, queue.completed)
+	assert.Equal(t, `{"done":2}`, queue.fields["1"][jobqueue.FieldProgress])
+	assert.Equal(t, jobqueue.StatusSuccess, queue.fields["1"][jobqueue.FieldStatus])
+	assert.Equal(t, "42", queue.fields["1"][jobqueue.FieldDuration])
+	assert.Equal(t, "v1", queue.fields["1"][jobqueue.FieldWorkerVersion])
+	assert.NotEmpty(t, queue.fields["1"][jobqueue.FieldStartTime])
+	assert.Equal(t, jobqueue.StatusRunning, queue.fields["2"][jobqueue.FieldStatus])
+	queue.mu.Unlock()
+
+	workers := srv.Workers()
+	require.Len(t, workers, 1)
+	assert.Equal(t, "gpu", workers[0].Name)
+	assert.Equal(t, "2", workers[0].Job)
+}
+
+// TestControlPlaneUnknownWorker verify a worker the bot forgot is asked to register again.
+func TestControlPlaneUnknownWorker(t *testing.T) {
+	_, client := startServer(t, newMemoryQueue("1"))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := client.Register(ctx, &RegisterRequest{})
+	assert.Error(t, err)
+
+	jobs, err := client.Jobs(ctx)
+	require.NoError(t, err)
+	defer jobs.Close()
+	_, err = jobs.Next("gpu-1")
+	assert.True(t, IsUnknownWorker(err))
+	assert.False(t, IsUnavailable(err))
+}
+
+// TestControlPlaneAssignedJob verify the progress and results of a job are only taken from the
+// worker it is assigned to.
+func TestControlPlaneAssignedJob(t *testing.T) {
+	queue := newMemoryQueue("1")
+	_, client := startServer(t, queue)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	owner, err := client.Register(ctx, &RegisterRequest{Worker: "gpu"})
+	require.NoError(t, err)
+	other, err := client.Register(ctx, &RegisterRequest{Worker: "cpu"})
+	require.NoError(t, err)
+	jobs, err := client.Jobs(ctx)
+	require.NoError(t, err)
+	defer jobs.Close()
+	_, err = jobs.Next(owner.WorkerID)
+	require.NoError(t, err)
+
+	result := func(workerID, jobID string) *ResultRequest {
+		return &ResultRequest{WorkerID: workerID, JobID: jobID, Fields: map[jobqueue.Field]string{jobqueue.FieldStatus: jobqueue.StatusSuccess}}
+	}
+	assert.True(t, IsUnknownWorker(client.Complete(ctx, result("gpu-9", "1"))))
+	assert.Error(t, client.Complete(ctx, result(other.WorkerID, "1")))
+	assert.Error(t, client.Complete(ctx, result(owner.WorkerID, "2")))
+
+	progress, err := client.Progress(ctx)
+	require.NoError(t, err)
+	require.NoError(t, progress.Send(&ProgressUpdate{WorkerID: other.WorkerID, JobID: "1", Progress: `{"done":1}`}))
+	_, err = progress.CloseAndRecv()
+	assert.Error(t, err)
+
+	queue.mu.Lock()
+	assert.Empty(t, queue.completed)
+	assert.Empty(t, queue.fields["1"][jobqueue.FieldProgress])
+	queue.mu.Unlock()
+	assert.NoError(t, client.Complete(ctx, result(owner.WorkerID, "1")))
+}
+
+// TestControlPlaneRequeue verify the job waited for by a worker that left goes back to the queue.
+func TestControlPlaneRequeue(t *testing.T) {
+	queue := newMemoryQueue()
+	_, client := startServer(t, queue)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	registered, err := client.Register(ctx, &RegisterRequest{Worker: "gpu"})
+	require.NoError(t, err)
+
+	streamCtx, cancelStream := context.WithCancel(ctx)
+	jobs, err := client.Jobs(streamCtx)
+	require.NoError(t, err)
+	done := make(chan error, 1)
+	go func() {
+		_, err := jobs.Next(registered.WorkerID)
+		done <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+	cancelStream()
+	assert.Error(t, <-done)
+
+	// The next job is not lost to the canceled stream
+	require.NoError(t, queue.Requeue(ctx, "7"))
+	jobs, err = client.Jobs(ctx)
+	require.NoError(t, err)
+	defer jobs.Close()
+	next, err := jobs.Next(registered.WorkerID)
+	require.NoError(t, err)
+	assert.Equal(t, "7", next.JobID)
+}
+
+// TestControlPlaneMaintenance verify no job is handed out during a maintenance, and the queued
+// jobs are once it is over.
+func TestControlPlaneMaintenance(t *testing.T) {
+	queue := newMemoryQueue("1")
+	queue.maintenance = &jobqueue.Maintenance{Message: "model upgrade"}
+	_, client := startServer(t, queue)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	registered, err := client.Register(ctx, &RegisterRequest{Worker: "gpu"})
+	require.NoError(t, err)
+	jobs, err := client.Jobs(ctx)
+	require.NoError(t, err)
+	defer jobs.Close()
+	assigned := make(chan string, 1)
+	go func() {
+		next, err := jobs.Next(registered.WorkerID)
+		if err == nil {
+			assigned <- next.JobID
+		}
+	}()
+
+	select {
+	case jobID := <-assigned:
+		t.Fatalf("job %s was handed out during the maintenance", jobID)
+	case <-time.After(200 * time.Millisecond):
+	}
+	queue.mu.Lock()
+	queue.maintenance = nil
+	queue.mu.Unlock()
+	select {
+	case jobID := <-assigned:
+		assert.Equal(t, "1", jobID)
+	case <-ctx.Done():
+		t.Fatal("the job was not handed out after the maintenance")
+	}
+}
+
+// TestFieldValues verify the result fields are formatted like Redis stores them.
+func TestFieldValues(t *testing.T) {
+	assert.Equal(t, map[jobqueue.Field]string{
+		jobqueue.FieldDuration: "12",
+		jobqueue.FieldS3URL:    "https://example.com/index.html",
+		jobqueue.FieldMetrics:  `{"questions":3}`,
+	}, FieldValues(map[jobqueue.Field]interface{}{
+		jobqueue.FieldDuration: float64(12),
+		jobqueue.FieldS3URL:    "https://example.com/index.html",
+		jobqueue.FieldMetrics:  []byte(`{"questions":3}`),
+	}))
+}
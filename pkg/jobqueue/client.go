@@ -0,0 +1,285 @@
+package jobqueue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Options configure the connections of a Client, the zero values keep the go-redis defaults
+type Options struct {
+	Addr string
+	// PoolSize is the maximum number of connections open at once
+	PoolSize int
+	// IdleTimeout closes the connections idle for longer
+	IdleTimeout time.Duration
+	// Timeout bounds connecting and every command
+	Timeout time.Duration
+}
+
+// Client reads and writes the jobs of the queue. The underlying go-redis client stays available
+// for the keys that are not job fields.
+type Client struct {
+	*redis.Client
+}
+
+// NewClient returns a client of the Redis server at addr with the default options
+func NewClient(addr string) *Client {
+	return New(Options{Addr: addr})
+}
+
+// New returns a client configured by the options
+func New(opts Options) *Client {
+	return &Client{Client: redis.NewClient(&redis.Options{
+		Addr:         opts.Addr,
+		PoolSize:     opts.PoolSize,
+		IdleTimeout:  opts.IdleTimeout,
+		DialTimeout:  opts.Timeout,
+		ReadTimeout:  opts.Timeout,
+		WriteTimeout: opts.Timeout,
+		PoolTimeout:  opts.Timeout,
+	})}
+}
+
+// IsConnectionError reports whether err is a failure to reach Redis, as opposed to an error
+// reply, a missing key or a canceled context. The command can be retried on a new connection.
+func IsConnectionError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var reply redis.Error
+	return !errors.As(err, &reply)
+}
+
+// Get returns a field of a job, "" when it is not set
+func (c *Client) Get(ctx context.Context, jobID string, field Field) (string, error) {
+	value, err := c.Client.Get(ctx, Key(jobID, field)).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return value, err
+}
+
+// GetInt returns a field of a job holding a number, 0 when it is not set
+func (c *Client) GetInt(ctx context.Context, jobID string, field Field) (int64, error) {
+	value, err := c.Get(ctx, jobID, field)
+	if err != nil || value == "" {
+		return 0, err
+	}
+	number, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q of job %s: %w", field, value, jobID, err)
+	}
+	return number, nil
+}
+
+// Fields returns the fields of a job that are set
+func (c *Client) Fields(ctx context.Context, jobID string, fields []Field) (map[Field]string, error) {
+	keys := make([]string, len(fields))
+	for i, field := range fields {
+		keys[i] = Key(jobID, field)
+	}
+	values, err := c.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	set := make(map[Field]string, len(fields))
+	for i, value := range values {
+		if value, ok := value.(string); ok {
+			set[fields[i]] = value
+		}
+	}
+	return set, nil
+}
+
+// Set sets a field of a job
+func (c *Client) Set(ctx context.Context, jobID string, field Field, value interface{}) error {
+	return c.Client.Set(ctx, Key(jobID, field), value, 0).Err()
+}
+
+// SetFields sets several fields of a job at once
+func (c *Client) SetFields(ctx context.Context, jobID string, fields map[Field]interface{}) error {
+	if len(fields) == 0 {
+		return nil
+	}
+	return c.MSet(ctx, fieldValues(jobID, fields)...).Err()
+}
+
+// NewJob numbers a new job and sets its fields, it is queued by Enqueue
+func (c *Client) NewJob(ctx context.Context, fields map[Field]interface{}) (string, error) {
+	number, err := c.Incr(ctx, KeyJobCounter).Result()
+	if err != nil {
+		return "", err
+	}
+	jobID := strconv.FormatInt(number, 10)
+	return jobID, c.SetFields(ctx, jobID, fields)
+}
+
+// Enqueue queues a job for the workers and records when, its wait in the queue starts then
+func (c *Client) Enqueue(ctx context.Context, jobID string) error {
+	_, err := c.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, Key(jobID, FieldEnqueueTime), time.Now().Unix(), 0)
+		pipe.LPush(ctx, QueueGenerate, jobID)
+		return nil
+	})
+	return err
+}
+
+// Dequeue pops the oldest queued job, "" when the queue is empty
+func (c *Client) Dequeue(ctx context.Context) (string, error) {
+	jobID, err := c.RPop(ctx, QueueGenerate).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return jobID, err
+}
+
+// DequeueWait pops the oldest queued job, waiting up to timeout for one to be queued. It returns
+// "" when none was.
+func (c *Client) DequeueWait(ctx context.Context, timeout time.Duration) (string, error) {
+	reply, err := c.BRPop(ctx, timeout, QueueGenerate).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	// The reply is the name of the queue and the job
+	return reply[1], nil
+}
+
+// Requeue puts a dequeued job that could not be run back at the head of the queue
+func (c *Client) Requeue(ctx context.Context, jobID string) error {
+	return c.RPush(ctx, QueueGenerate, jobID).Err()
+}
+
+// Defer puts a job on the deferred queue, it is not run until Undefer queues it
+func (c *Client) Defer(ctx context.Context, jobID string) error {
+	return c.LPush(ctx, QueueDeferred, jobID).Err()
+}
+
+// Undefer queues the oldest deferred job for the workers and returns it, "" when there is none
+func (c *Client) Undefer(ctx context.Context) (string, error) {
+	jobID, err := c.RPop(ctx, QueueDeferred).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if err := c.Enqueue(ctx, jobID); err != nil {
+		// Put it back at the head of the deferred queue rather than lose it
+		_ = c.RPush(ctx, QueueDeferred, jobID).Err()
+		return "", err
+	}
+	return jobID, nil
+}
+
+// IsDeferred reports whether a job waits on the deferred queue
+func (c *Client) IsDeferred(ctx context.Context, jobID string) (bool, error) {
+	_, err := c.LPos(ctx, QueueDeferred, jobID, redis.LPosArgs{}).Result()
+	if err == redis.Nil {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Deferred lists the deferred jobs, the next one to be queued last
+func (c *Client) Deferred(ctx context.Context) ([]string, error) {
+	return c.LRange(ctx, QueueDeferred, 0, -1).Result()
+}
+
+// Queued lists the queued jobs, the next one to run last
+func (c *Client) Queued(ctx context.Context) ([]string, error) {
+	return c.LRange(ctx, QueueGenerate, 0, -1).Result()
+}
+
+// Start sets the fields of a job a worker starts and records it among the running jobs
+func (c *Client) Start(ctx context.Context, jobID string, fields map[Field]interface{}) error {
+	_, err := c.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		if len(fields) > 0 {
+			pipe.MSet(ctx, fieldValues(jobID, fields)...)
+		}
+		pipe.SAdd(ctx, KeyRunningJobs, jobID)
+		return nil
+	})
+	return err
+}
+
+// Retarget moves a job no worker started yet to another commit of its PR. It reports false, leaving
+// the job as is, when a worker started it meanwhile.
+func (c *Client) Retarget(ctx context.Context, jobID, prSha string) (bool, error) {
+	retargeted := false
+	statusKey := Key(jobID, FieldStatus)
+	err := c.Watch(ctx, func(tx *redis.Tx) error {
+		status, err := tx.Get(ctx, statusKey).Result()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+		if status != "" && status != StatusPending {
+			return nil
+		}
+		// The worker sets the status before it reads the commit, the transaction fails if it did
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, Key(jobID, FieldPRSHA), prSha, 0)
+			return nil
+		})
+		retargeted = err == nil
+		return err
+	}, statusKey)
+	if err == redis.TxFailedErr {
+		return false, nil
+	}
+	return retargeted, err
+}
+
+// Running lists the jobs started and not completed yet
+func (c *Client) Running(ctx context.Context) ([]string, error) {
+	return c.SMembers(ctx, KeyRunningJobs).Result()
+}
+
+// Complete sets the result fields of a job and pushes it on the results queue, in one
+// transaction so the bot never reads the results of a job before they are all set
+func (c *Client) Complete(ctx context.Context, jobID string, fields map[Field]interface{}) error {
+	_, err := c.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		if len(fields) > 0 {
+			pipe.MSet(ctx, fieldValues(jobID, fields)...)
+		}
+		pipe.LPush(ctx, QueueResults, jobID)
+		pipe.SRem(ctx, KeyRunningJobs, jobID)
+		return nil
+	})
+	return err
+}
+
+// PendingResults is the number of completed jobs waiting to be reported
+func (c *Client) PendingResults(ctx context.Context) (int64, error) {
+	return c.LLen(ctx, QueueResults).Result()
+}
+
+// NextResult moves the oldest completed job to the archived queue and returns it, "" when there
+// is none
+func (c *Client) NextResult(ctx context.Context) (string, error) {
+	jobID, err := c.LMove(ctx, QueueResults, QueueArchived, "RIGHT", "LEFT").Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return jobID, err
+}
+
+// Archived lists the reported jobs, newest first
+func (c *Client) Archived(ctx context.Context) ([]string, error) {
+	return c.LRange(ctx, QueueArchived, 0, -1).Result()
+}
+
+func fieldValues(jobID string, fields map[Field]interface{}) []interface{} {
+	values := make([]interface{}, 0, 2*len(fields))
+	for field, value := range fields {
+		values = append(values, Key(jobID, field), value)
+	}
+	return values
+}
@@ -0,0 +1,44 @@
+package jobqueue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestKey verify the keys match the schema the bot, the workers and the UI read.
+func TestKey(t *testing.T) {
+	assert.Equal(t, "jobs:42:pr_number", Key("42", FieldPRNumber))
+	assert.Equal(t, "jobs:42:*", JobPattern("42"))
+	assert.Equal(t, "leader:janitor", LeaderKey("janitor"))
+	assert.Equal(t, "durations:precheck", DurationsKey("precheck"))
+	assert.Equal(t, "durations:precheck:samples", DurationSamplesKey("precheck"))
+	assert.Equal(t, "prs:instructlab/taxonomy/7:generate_job", LatestGenerateJobKey("instructlab", "taxonomy", "7"))
+	assert.Equal(t, "prs:instructlab/taxonomy/7:result_comments", ResultCommentsKey("instructlab", "taxonomy", "7"))
+	assert.Equal(t, "prs:instructlab/taxonomy/7:head_sha", HeadSHAKey("instructlab", "taxonomy", "7"))
+	assert.Equal(t, "groups:3", GroupKey("3"))
+	assert.Equal(t, "groups:3:jobs", GroupJobsKey("3"))
+	assert.ElementsMatch(t, []interface{}{"jobs:42:status", "success"}, fieldValues("42", map[Field]interface{}{FieldStatus: StatusSuccess}))
+}
+
+// TestMaintenanceNotice verify the requesters are told when the jobs resume, when it is known.
+func TestMaintenanceNotice(t *testing.T) {
+	assert.Equal(t, "Maintenance in progress, jobs will resume once it is over.", Maintenance{}.Notice())
+	until := time.Date(2026, 10, 17, 6, 0, 0, 0, time.FixedZone("CEST", 2*3600))
+	assert.Equal(t, "Maintenance in progress: model upgrade, jobs will resume at 2026-10-17 04:00 UTC.", Maintenance{Until: until, Message: "model upgrade"}.Notice())
+}
+
+// TestIsConnectionError verify only the failures to reach Redis are retried.
+func TestIsConnectionError(t *testing.T) {
+	assert.False(t, IsConnectionError(nil))
+	assert.False(t, IsConnectionError(redis.Nil))
+	assert.False(t, IsConnectionError(context.Canceled))
+	assert.True(t, IsConnectionError(io.EOF))
+	assert.True(t, IsConnectionError(fmt.Errorf("could not set the status: %w", errors.New("dial tcp: connection refused"))))
+}
@@ -0,0 +1,78 @@
+package jobqueue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// GroupTTL keeps a group long after its last job reported
+const GroupTTL = 90 * 24 * time.Hour
+
+// Group is the jobs queued by a bulk operation, such as a backfill or the scheduled runs of a
+// night. Their outcomes are summarized in one post rather than on each PR or in one comment each.
+type Group struct {
+	ID             string `json:"-"`
+	Title          string `json:"title"`
+	RepoOwner      string `json:"repo_owner"`
+	RepoName       string `json:"repo_name"`
+	InstallationID int64  `json:"installation_id"`
+	// Issue holds the summary, in its body, or in Comment when the group posts on an existing issue
+	Issue   int   `json:"issue,omitempty"`
+	Comment int64 `json:"comment,omitempty"`
+}
+
+// NewGroup numbers and stores a new group, its jobs are added by AddToGroup
+func (c *Client) NewGroup(ctx context.Context, g Group) (string, error) {
+	number, err := c.Incr(ctx, KeyGroupCounter).Result()
+	if err != nil {
+		return "", err
+	}
+	g.ID = strconv.FormatInt(number, 10)
+	return g.ID, c.SaveGroup(ctx, g)
+}
+
+// SaveGroup stores the group, once its summary is posted for instance
+func (c *Client) SaveGroup(ctx context.Context, g Group) error {
+	value, err := json.Marshal(g)
+	if err != nil {
+		return err
+	}
+	return c.Client.Set(ctx, GroupKey(g.ID), value, GroupTTL).Err()
+}
+
+// Group returns the group, nil when it expired
+func (c *Client) Group(ctx context.Context, groupID string) (*Group, error) {
+	value, err := c.Client.Get(ctx, GroupKey(groupID)).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var g Group
+	if err := json.Unmarshal(value, &g); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", GroupKey(groupID), err)
+	}
+	g.ID = groupID
+	return &g, nil
+}
+
+// AddToGroup adds a job to the group, the job records its group in FieldGroup
+func (c *Client) AddToGroup(ctx context.Context, groupID, jobID string) error {
+	_, err := c.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.RPush(ctx, GroupJobsKey(groupID), jobID)
+		pipe.Expire(ctx, GroupJobsKey(groupID), GroupTTL)
+		return nil
+	})
+	return err
+}
+
+// GroupJobs lists the jobs of the group in the order they were added
+func (c *Client) GroupJobs(ctx context.Context, groupID string) ([]string, error) {
+	return c.LRange(ctx, GroupJobsKey(groupID), 0, -1).Result()
+}
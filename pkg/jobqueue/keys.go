@@ -0,0 +1,186 @@
+// Package jobqueue is the Redis schema shared by the bot and the workers: the job queues, the
+// fields stored on every job and the client reading and writing them.
+package jobqueue
+
+import "fmt"
+
+// Queues are Redis lists of job IDs. The bot pushes jobs on the generate queue, the workers pop
+// them and push them on the results queue once done, and the bot moves them to the archived queue
+// once reported. The jobs deferred while the generate queue is over capacity wait on the deferred
+// queue until the bot moves them to the generate queue.
+const (
+	QueueGenerate = "generate"
+	QueueResults  = "results"
+	QueueArchived = "archived"
+	QueueDeferred = "deferred"
+)
+
+// KeyJobCounter is incremented to number the jobs
+const KeyJobCounter = "jobs"
+
+// KeyGroupCounter is incremented to number the groups of jobs
+const KeyGroupCounter = "groups"
+
+// KeyStatusComments is the set of the jobs whose status comment the bot keeps up to date
+const KeyStatusComments = "status_comments"
+
+// KeyRunningJobs is the set of the jobs a worker started and did not complete yet, the bot fails
+// the ones whose worker stopped reporting
+const KeyRunningJobs = "running_jobs"
+
+// KeyMaintenance holds the maintenance in progress, the workers take no job while it is set
+const KeyMaintenance = "maintenance"
+
+// Field is an attribute of a job, stored at jobs:<id>:<field>
+type Field string
+
+// Fields set by the bot when queueing a job
+const (
+	FieldPRNumber        Field = "pr_number"
+	FieldPRSHA           Field = "pr_sha"
+	FieldBaseRef         Field = "base_ref"
+	FieldAuthor          Field = "author"
+	FieldInstallationID  Field = "installation_id"
+	FieldRepoOwner       Field = "repo_owner"
+	FieldRepoName        Field = "repo_name"
+	FieldJobType         Field = "job_type"
+	FieldRequestTime     Field = "request_time"
+	FieldGitRemote       Field = "git_remote"
+	FieldS3Prefix        Field = "s3_prefix"
+	FieldModels          Field = "models"
+	FieldTemperature     Field = "temperature"
+	FieldMaxTokens       Field = "max_tokens"
+	FieldTopP            Field = "top_p"
+	FieldSystemPrompt    Field = "system_prompt"
+	FieldPipeline        Field = "pipeline"
+	FieldSdgScaleFactor  Field = "sdg_scale_factor"
+	FieldChunkWordCount  Field = "chunk_word_count"
+	FieldNumInstructions Field = "num_instructions"
+	FieldNumEpochs       Field = "num_epochs"
+	FieldIters           Field = "iters"
+	FieldBenchmark       Field = "benchmark"
+	FieldModel           Field = "model"
+	FieldBaseModel       Field = "base_model"
+	FieldBaseBranch      Field = "base_branch"
+	FieldPipelineID      Field = "pipeline_id"
+	FieldPipelineJobs    Field = "pipeline_jobs"
+	FieldDependsOn       Field = "depends_on"
+	FieldNextJob         Field = "next_job"
+	FieldBranch          Field = "branch"
+	FieldSchedule        Field = "schedule"
+	FieldTrackingIssue   Field = "tracking_issue"
+	FieldDryRun          Field = "dry_run"
+	FieldGrounded        Field = "grounded"
+	FieldParaphrases     Field = "paraphrases"
+	FieldChangedFiles    Field = "changed_files"
+	FieldStatusComment   Field = "status_comment"
+	FieldBotVersion      Field = "bot_version"
+	FieldReplyTo         Field = "reply_to"
+	FieldEnqueueTime     Field = "enqueue_time"
+	FieldGroup           Field = "group"
+)
+
+// QueueFields are the fields set by the bot when queueing a job, the control plane hands them to
+// the worker with the job. The bot also sets FieldGenerateJob of a train job for --generate-job.
+var QueueFields = []Field{
+	FieldPRNumber, FieldPRSHA, FieldBaseRef, FieldAuthor, FieldInstallationID, FieldRepoOwner,
+	FieldRepoName, FieldJobType, FieldRequestTime, FieldGitRemote, FieldS3Prefix, FieldModels,
+	FieldTemperature, FieldMaxTokens, FieldTopP, FieldSystemPrompt, FieldPipeline,
+	FieldSdgScaleFactor, FieldChunkWordCount, FieldNumInstructions, FieldNumEpochs, FieldIters,
+	FieldBenchmark, FieldModel, FieldBaseModel, FieldBaseBranch, FieldPipelineID, FieldPipelineJobs,
+	FieldDependsOn, FieldNextJob, FieldBranch, FieldSchedule, FieldTrackingIssue, FieldDryRun,
+	FieldGrounded, FieldParaphrases, FieldChangedFiles, FieldStatusComment, FieldBotVersion,
+	FieldReplyTo, FieldEnqueueTime, FieldGroup, FieldGenerateJob,
+}
+
+// Fields set by the worker while running a job and once it is done
+const (
+	FieldStatus         Field = "status"
+	FieldStartTime      Field = "start_time"
+	FieldDuration       Field = "duration"
+	FieldErrors         Field = "errors"
+	FieldErrorCategory  Field = "error_category"
+	FieldS3URL          Field = "s3_url"
+	FieldFailedURL      Field = "failed_artifacts_url"
+	FieldCmd            Field = "cmd"
+	FieldModelName      Field = "model_name"
+	FieldAnnotations    Field = "annotations"
+	FieldSummary        Field = "summary"
+	FieldTokenUsage     Field = "token_usage"
+	FieldMetrics        Field = "metrics"
+	FieldProgress       Field = "progress"
+	FieldIlabVersion    Field = "ilab_version"
+	FieldPipelineParams Field = "pipeline_params"
+	FieldGenerateJob    Field = "generate_job"
+	FieldTrainingData   Field = "training_data"
+	FieldAreaScores     Field = "area_scores"
+	FieldWorkerVersion  Field = "worker_version"
+	// FieldEncrypted is "true" when FieldS3URL and FieldFailedURL link to the access page of
+	// encrypted artifacts
+	FieldEncrypted Field = "encrypted"
+)
+
+// Statuses of a job in FieldStatus
+const (
+	StatusPending = "pending"
+	StatusRunning = "running"
+	StatusSuccess = "success"
+	StatusError   = "error"
+)
+
+// Key is the Redis key of a field of a job
+func Key(jobID string, field Field) string {
+	return fmt.Sprintf("jobs:%s:%s", jobID, field)
+}
+
+// JobPattern matches every key of a job
+func JobPattern(jobID string) string {
+	return fmt.Sprintf("jobs:%s:*", jobID)
+}
+
+// LeaderKey holds the ID of the bot replica leading the role, until its lease expires
+func LeaderKey(role string) string {
+	return "leader:" + role
+}
+
+// DurationsKey lists the recent durations of the jobs of a type, newest first
+func DurationsKey(jobType string) string {
+	return "durations:" + jobType
+}
+
+// DurationSamplesKey lists the durations of the recent jobs of a type with the size of their PR,
+// newest first
+func DurationSamplesKey(jobType string) string {
+	return "durations:" + jobType + ":samples"
+}
+
+// PrecheckHistoryKey holds the last answers of the precheck jobs of a PR, compared by the next ones
+func PrecheckHistoryKey(repoOwner, repoName, prNumber string) string {
+	return fmt.Sprintf("prs:%s/%s/%s:precheck_answers", repoOwner, repoName, prNumber)
+}
+
+// LatestGenerateJobKey records the last successful generate-local job of a PR
+func LatestGenerateJobKey(repoOwner, repoName, prNumber string) string {
+	return fmt.Sprintf("prs:%s/%s/%s:generate_job", repoOwner, repoName, prNumber)
+}
+
+// GroupKey holds a group of jobs queued by a bulk operation
+func GroupKey(groupID string) string {
+	return fmt.Sprintf("groups:%s", groupID)
+}
+
+// GroupJobsKey lists the jobs of a group
+func GroupJobsKey(groupID string) string {
+	return fmt.Sprintf("groups:%s:jobs", groupID)
+}
+
+// HeadSHAKey records the head commit of a PR, as of its last push
+func HeadSHAKey(repoOwner, repoName, prNumber string) string {
+	return fmt.Sprintf("prs:%s/%s/%s:head_sha", repoOwner, repoName, prNumber)
+}
+
+// ResultCommentsKey holds the results comments the bot posted on a PR, by node ID, until newer
+// results supersede them
+func ResultCommentsKey(repoOwner, repoName, prNumber string) string {
+	return fmt.Sprintf("prs:%s/%s/%s:result_comments", repoOwner, repoName, prNumber)
+}
@@ -0,0 +1,62 @@
+package jobqueue
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// acquireLease takes the lease of a role when it is free and extends it when the caller already
+// holds it
+var acquireLease = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+if redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+	return 1
+end
+return 0
+`)
+
+// releaseLease frees the lease of a role, unless another replica took it over in the meantime
+var releaseLease = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// Lease elects one of the bot replicas sharing the Redis server to play a role. The replica
+// holding it has to renew it within its TTL, the others take it over once it expires.
+type Lease struct {
+	client *Client
+	role   string
+	holder string
+	ttl    time.Duration
+}
+
+// NewLease returns the lease of role, holder identifies the replica asking for it
+func (c *Client) NewLease(role, holder string, ttl time.Duration) *Lease {
+	return &Lease{client: c, role: role, holder: holder, ttl: ttl}
+}
+
+// Acquire takes or renews the lease, it reports whether the replica holds it
+func (l *Lease) Acquire(ctx context.Context) (bool, error) {
+	held, err := acquireLease.Run(ctx, l.client, []string{LeaderKey(l.role)}, l.holder, l.ttl.Milliseconds()).Int()
+	return held == 1, err
+}
+
+// Release frees the lease so another replica takes it over without waiting for it to expire
+func (l *Lease) Release(ctx context.Context) error {
+	return releaseLease.Run(ctx, l.client, []string{LeaderKey(l.role)}, l.holder).Err()
+}
+
+// Holder is the replica holding the lease, "" when it is free
+func (l *Lease) Holder(ctx context.Context) (string, error) {
+	holder, err := l.client.Client.Get(ctx, LeaderKey(l.role)).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return holder, err
+}
@@ -0,0 +1,61 @@
+package jobqueue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Maintenance is the planned maintenance of the bot and its workers: the workers stop taking jobs
+// and the bot tells the requesters when the jobs resume. The queued jobs wait until it is over.
+type Maintenance struct {
+	// Until is when the jobs are expected to resume, zero when it is not known
+	Until   time.Time `json:"until,omitempty"`
+	Message string    `json:"message,omitempty"`
+	Started time.Time `json:"started"`
+}
+
+// Notice tells the requesters about the maintenance and when their jobs resume
+func (m Maintenance) Notice() string {
+	notice := "Maintenance in progress"
+	if m.Message != "" {
+		notice += ": " + m.Message
+	}
+	if m.Until.IsZero() {
+		return notice + ", jobs will resume once it is over."
+	}
+	return fmt.Sprintf("%s, jobs will resume at %s.", notice, m.Until.UTC().Format("2006-01-02 15:04 UTC"))
+}
+
+// StartMaintenance puts the bot and its workers in maintenance until StopMaintenance
+func (c *Client) StartMaintenance(ctx context.Context, m Maintenance) error {
+	value, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return c.Client.Set(ctx, KeyMaintenance, value, 0).Err()
+}
+
+// StopMaintenance ends the maintenance, the workers take jobs again
+func (c *Client) StopMaintenance(ctx context.Context) error {
+	return c.Del(ctx, KeyMaintenance).Err()
+}
+
+// Maintenance returns the maintenance in progress, nil when there is none
+func (c *Client) Maintenance(ctx context.Context) (*Maintenance, error) {
+	value, err := c.Client.Get(ctx, KeyMaintenance).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var m Maintenance
+	if err := json.Unmarshal(value, &m); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", KeyMaintenance, err)
+	}
+	return &m, nil
+}
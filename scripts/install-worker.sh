@@ -16,6 +16,8 @@ WORK_DIR=${WORK_DIR:-"${HOME}/instructlab-bot"}
 
 PRECHECK_ENDPOINT_URL=${PRECHECK_ENDPOINT_URL:-"http://localhost:8000/v1"}
 SDG_ENDPOINT_URL=${SDG_ENDPOINT_URL:-""}
+SDG_AUTH_MODE=${SDG_AUTH_MODE:-""}
+SDG_TOKEN=${SDG_TOKEN:-""}
 TLS_INSECURE=${TLS_INSECURE:-"false"}
 
 TLS_CLIENT_KEY=${TLS_CLIENT_KEY:-""}
@@ -58,6 +60,8 @@ usage() {
     echo "  --work-dir DIR: Optionally the directory to use for the worker. Default: ${WORK_DIR}"
     echo "  --precheck-endpoint-url URL: The endpoint URL for the ilab precheck. Default: http://localhost:8000/v1"
     echo "  --sdg-endpoint-url URL: The endpoint URL for the ilab sdg-svc. Default: "
+    echo "  --sdg-auth-mode MODE: How to authenticate to the ilab sdg-svc: mtls, bearer, api-key or none. Default: mtls"
+    echo "  --sdg-token TOKEN: The bearer token or API key for ilab sdg-svc"
     echo "  --tls-insecure BOOL: Use insecure TLS connection. Default: ${TLS_INSECURE}"
     echo "  --tls-client-key KEY: The TLS client key for ilab sdg-svc"
     echo "  --tls-client-cert CERT: The TLS client certificate for ilab sdg-svc"
@@ -271,6 +275,7 @@ install_bot_worker() {
 ILWORKER_GITHUB_TOKEN=${GITHUB_TOKEN}
 AWS_ACCESS_KEY_ID=${AWS_ACCESS_KEY_ID}
 AWS_SECRET_ACCESS_KEY=${AWS_SECRET_ACCESS_KEY}
+ILWORKER_SDG_TOKEN=${SDG_TOKEN}
 EOF
     sudo install -m 0600 labbotworker.sysconfig /etc/sysconfig/labbotworker
 
@@ -284,6 +289,11 @@ EOF
         EXTRA_ARGS="${EXTRA_ARGS} --sdg-endpoint-url ${SDG_ENDPOINT_URL} "
     fi
 
+    # Check if SDG_AUTH_MODE is set
+    if [ -n "${SDG_AUTH_MODE}" ]; then
+        EXTRA_ARGS="${EXTRA_ARGS} --sdg-auth-mode ${SDG_AUTH_MODE}"
+    fi
+
     # Check if TLS_INSECURE is set to true
     if [ "${TLS_INSECURE}" == "true" ]; then
         EXTRA_ARGS="${EXTRA_ARGS} --tls-insecure true"
@@ -399,6 +409,14 @@ while [ $# -gt 0 ]; do
             SDG_ENDPOINT_URL="$2"
             shift
             ;;
+        --sdg-auth-mode)
+            SDG_AUTH_MODE="$2"
+            shift
+            ;;
+        --sdg-token)
+            SDG_TOKEN="$2"
+            shift
+            ;;
         --tls-insecure)
             TLS_INSECURE="$2"
             shift
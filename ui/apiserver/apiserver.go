@@ -10,9 +10,13 @@ import (
 	"net/http"
 	"os"
 	"os/exec"
+	"path"
 	"strings"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/go-redis/redis/v8"
@@ -25,6 +29,17 @@ const (
 	redisQueueArchive  = "archived"
 )
 
+const (
+	auditPrefix = "audit/commands"
+	// auditDefaultRange is the time range of the audit log returned without a since parameter
+	auditDefaultRange = 7 * 24 * time.Hour
+	// auditMaxRange bounds the days a single audit query lists
+	auditMaxRange = 92 * 24 * time.Hour
+	auditDay      = 24 * time.Hour
+	// auditKeyTime is the layout of the time starting the name of the audit log objects
+	auditKeyTime = "20060102T150405.000000000Z"
+)
+
 const PreCheckEndpointURL = "https://merlinite-7b-vllm-openai.apps.fmaas-backend.fmaas.res.ibm.com/v1"
 const InstructLabBotUrl = "http://bot:8081"
 
@@ -36,6 +51,11 @@ type ApiServer struct {
 	testMode            bool
 	preCheckEndpointURL string
 	instructLabBotUrl   string
+	auditS3             *s3.Client
+	auditBucket         string
+	auditPrefix         string
+	// artifacts is nil unless the job results are served through the API server
+	artifacts *artifactsConfig
 }
 
 type JobData struct {
@@ -54,6 +74,22 @@ type JobData struct {
 	JobType        string `json:"jobType"`
 	InstallationID string `json:"installationID"`
 	Cmd            string `json:"cmd"`
+	TokenUsage     string `json:"tokenUsage"`
+	Progress       string `json:"progress"`
+}
+
+// AuditRecord is a bot command of the audit log the bot appends to S3
+type AuditRecord struct {
+	Time      time.Time `json:"time"`
+	User      string    `json:"user"`
+	Repo      string    `json:"repo"`
+	PR        int       `json:"pr"`
+	CommentID int64     `json:"comment_id"`
+	Command   string    `json:"command"`
+	Args      []string  `json:"args,omitempty"`
+	Outcome   string    `json:"outcome"`
+	JobIDs    []string  `json:"job_ids,omitempty"`
+	Error     string    `json:"error,omitempty"`
 }
 
 type ChatRequest struct {
@@ -275,10 +311,110 @@ func (api *ApiServer) fetchJobData(jobID string) (JobData, error) {
 	jobData.JobType = api.redis.Get(context.Background(), fmt.Sprintf("jobs:%s:job_type", jobID)).Val()
 	jobData.InstallationID = api.redis.Get(context.Background(), fmt.Sprintf("jobs:%s:installation_id", jobID)).Val()
 	jobData.Cmd = api.redis.Get(context.Background(), fmt.Sprintf("jobs:%s:cmd", jobID)).Val()
+	jobData.TokenUsage = api.redis.Get(context.Background(), fmt.Sprintf("jobs:%s:token_usage", jobID)).Val()
+	jobData.Progress = api.redis.Get(context.Background(), fmt.Sprintf("jobs:%s:progress", jobID)).Val()
 
 	return jobData, nil
 }
 
+// getAuditLog returns the bot commands received between the since and until times, RFC 3339,
+// the last week by default. The user, repo, command and outcome parameters filter them.
+func (api *ApiServer) getAuditLog(c *gin.Context) {
+	if api.auditS3 == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "The audit log is not configured"})
+		return
+	}
+
+	until := time.Now().UTC()
+	if value := c.Query("until"); value != "" {
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid until time, expected RFC 3339"})
+			return
+		}
+		until = t.UTC()
+	}
+	since := until.Add(-auditDefaultRange)
+	if value := c.Query("since"); value != "" {
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid since time, expected RFC 3339"})
+			return
+		}
+		since = t.UTC()
+	}
+	if !since.Before(until) || until.Sub(since) > auditMaxRange {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("The time range must be positive and at most %d days", int(auditMaxRange/auditDay))})
+		return
+	}
+
+	filters := map[string]string{
+		"user":    c.Query("user"),
+		"repo":    c.Query("repo"),
+		"command": c.Query("command"),
+		"outcome": c.Query("outcome"),
+	}
+	records := make([]AuditRecord, 0)
+	// The log is grouped by UTC day, only the days of the range are listed
+	for day := since.Truncate(auditDay); day.Before(until); day = day.Add(auditDay) {
+		paginator := s3.NewListObjectsV2Paginator(api.auditS3, &s3.ListObjectsV2Input{
+			Bucket: aws.String(api.auditBucket),
+			Prefix: aws.String(path.Join(api.auditPrefix, day.Format("2006/01/02")) + "/"),
+		})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(c.Request.Context())
+			if err != nil {
+				api.logger.Error("Error listing the audit log", zap.Error(err))
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list the audit log"})
+				return
+			}
+			for _, object := range page.Contents {
+				key := aws.ToString(object.Key)
+				// Skip the records out of the range without fetching them
+				if t, err := time.Parse(auditKeyTime, strings.SplitN(path.Base(key), "-", 2)[0]); err == nil && (t.Before(since) || !t.Before(until)) {
+					continue
+				}
+				record, err := api.fetchAuditRecord(c.Request.Context(), key)
+				if err != nil {
+					api.logger.Error("Failed to fetch audit record", zap.String("key", key), zap.Error(err))
+					continue
+				}
+				if record.Time.Before(since) || !record.Time.Before(until) || !record.matches(filters) {
+					continue
+				}
+				records = append(records, record)
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, records)
+}
+
+func (api *ApiServer) fetchAuditRecord(ctx context.Context, key string) (AuditRecord, error) {
+	var record AuditRecord
+	object, err := api.auditS3.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(api.auditBucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return record, err
+	}
+	defer object.Body.Close()
+	err = json.NewDecoder(object.Body).Decode(&record)
+	return record, err
+}
+
+// matches reports whether the record has the values of the filters, empty filters match everything
+func (r AuditRecord) matches(filters map[string]string) bool {
+	values := map[string]string{"user": r.User, "repo": r.Repo, "command": r.Command, "outcome": r.Outcome}
+	for name, filter := range filters {
+		if filter != "" && !strings.EqualFold(values[name], filter) {
+			return false
+		}
+	}
+	return true
+}
+
 func AuthRequired(username, password string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		user, pass, hasAuth := c.Request.BasicAuth()
@@ -304,9 +440,21 @@ func (api *ApiServer) setupRoutes(apiUser, apiPass string) {
 	authorized := api.router.Group("/")
 	authorized.Use(AuthRequired(apiUser, apiPass))
 	authorized.GET("/jobs", api.getAllJobs)
+	authorized.GET("/audit", api.getAuditLog)
 	authorized.POST("/chat", api.chatHandler)
 	authorized.POST("/pr/skill", api.skillPRHandler)
 	authorized.POST("/pr/knowledge", api.knowledgePRHandler)
+	authorized.GET("/maintenance", api.getMaintenance)
+	authorized.PUT("/maintenance", api.startMaintenance)
+	authorized.DELETE("/maintenance", api.stopMaintenance)
+
+	// The artifacts are opened from the links of the job results in a browser, with a GitHub login
+	// rather than the API credentials
+	if api.artifacts != nil {
+		api.router.GET("/artifacts/login", api.artifactsLogin)
+		api.router.GET("/artifacts/login/callback", api.artifactsCallback)
+		api.router.GET("/artifacts/jobs/*key", api.getArtifact)
+	}
 
 	api.router.GET("/", func(c *gin.Context) {
 		c.String(http.StatusOK, "IL Redis Queue")
@@ -461,6 +609,13 @@ func main() {
 	apiPass := pflag.String("api-pass", "", "API password")
 	preCheckEndpointURL := pflag.String("precheck-endpoint", PreCheckEndpointURL, "Precheck endpoint URL")
 	InstructLabBotUrl := pflag.String("bot-url", InstructLabBotUrl, "InstructLab Bot URL")
+	auditBucket := pflag.String("audit-s3-bucket", "", "S3 bucket of the audit log of the bot commands. If blank, the audit API is disabled")
+	auditPrefixFlag := pflag.String("audit-s3-prefix", auditPrefix, "S3 prefix of the audit log")
+	awsRegion := pflag.String("aws-region", "us-east-2", "AWS region of the audit log and artifacts buckets")
+	artifactsBucket := pflag.String("artifacts-s3-bucket", "", "S3 bucket of the job results served to the GitHub users who can read their repository. If blank, the artifacts are not served")
+	publicURL := pflag.String("public-url", "", "URL of the API server seen by the browsers, for the GitHub OAuth callback of the artifacts")
+	oauthClientID := pflag.String("github-oauth-client-id", "", "Client ID of the GitHub OAuth app of the artifacts login")
+	oauthClientSecret := pflag.String("github-oauth-client-secret", "", "Client secret of the GitHub OAuth app of the artifacts login")
 	pflag.Parse()
 
 	logger := setupLogger(*debugFlag)
@@ -483,6 +638,31 @@ func main() {
 		testMode:            *testMode,
 		preCheckEndpointURL: *preCheckEndpointURL,
 		instructLabBotUrl:   *InstructLabBotUrl,
+		auditBucket:         *auditBucket,
+		auditPrefix:         strings.Trim(*auditPrefixFlag, "/"),
+	}
+	if *auditBucket != "" {
+		cfg, err := awsconfig.LoadDefaultConfig(svr.ctx, awsconfig.WithRegion(*awsRegion))
+		if err != nil {
+			logger.Fatal("Failed to load the AWS config of the audit log", zap.Error(err))
+		}
+		svr.auditS3 = s3.NewFromConfig(cfg)
+	}
+	if *artifactsBucket != "" {
+		if *publicURL == "" || *oauthClientID == "" || *oauthClientSecret == "" {
+			logger.Fatal("Serving the artifacts needs --public-url, --github-oauth-client-id and --github-oauth-client-secret")
+		}
+		cfg, err := awsconfig.LoadDefaultConfig(svr.ctx, awsconfig.WithRegion(*awsRegion))
+		if err != nil {
+			logger.Fatal("Failed to load the AWS config of the artifacts", zap.Error(err))
+		}
+		svr.artifacts = &artifactsConfig{
+			s3:           s3.NewFromConfig(cfg),
+			bucket:       *artifactsBucket,
+			clientID:     *oauthClientID,
+			clientSecret: *oauthClientSecret,
+			publicURL:    strings.TrimSuffix(*publicURL, "/"),
+		}
 	}
 	svr.setupRoutes(*apiUser, *apiPass)
 
@@ -0,0 +1,424 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+const (
+	githubOAuthAuthorizeURL = "https://github.com/login/oauth/authorize"
+	githubOAuthTokenURL     = "https://github.com/login/oauth/access_token"
+	githubAPIURL            = "https://api.github.com"
+	// githubOAuthScope lets the API server read the permissions of the user on private repositories
+	githubOAuthScope = "repo"
+
+	artifactsSessionCookie = "artifacts_session"
+	// artifactsStateCookie binds the OAuth state to the browser that started the login
+	artifactsStateCookie = "artifacts_state"
+	artifactsSessionTTL  = 12 * time.Hour
+	artifactsStateTTL    = 10 * time.Minute
+	// artifactsAccessTTL is how long the repository permission of a user is trusted before the
+	// user is sent through the GitHub login again, the token of the user is not kept
+	artifactsAccessTTL = time.Hour
+	// artifactRepoMetadata is the S3 metadata of the repository of the job, set by the workers
+	artifactRepoMetadata = "repo"
+)
+
+// artifactJobPattern finds the job ID in the results directory of a job,
+// <prefix>/<job type>-pr-<number>-<sha>-job-<ID>/<file>
+var artifactJobPattern = regexp.MustCompile(`-job-([^/]+)/`)
+
+// artifactsConfig serves the job results of the S3 bucket to the GitHub users who can read the
+// repository of the job, for the organizations that cannot make the bucket public
+type artifactsConfig struct {
+	s3           *s3.Client
+	bucket       string
+	clientID     string
+	clientSecret string
+	// publicURL is the URL of the API server seen by the browsers, the OAuth callback is under it
+	publicURL string
+}
+
+func artifactsSessionKey(id string) string {
+	return fmt.Sprintf("artifacts:sessions:%s", id)
+}
+
+func artifactsStateKey(state string) string {
+	return fmt.Sprintf("artifacts:oauth:%s", state)
+}
+
+func artifactsAccessKey(session, owner, repo string) string {
+	return fmt.Sprintf("artifacts:access:%s:%s/%s", session, owner, repo)
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// artifactJobID returns the ID of the job whose results hold the key
+func artifactJobID(key string) (string, bool) {
+	match := artifactJobPattern.FindStringSubmatch(key)
+	if match == nil {
+		return "", false
+	}
+	return match[1], true
+}
+
+// signState signs the OAuth state for its cookie with the client secret of the OAuth app
+func (a *artifactsConfig) signState(state string) string {
+	mac := hmac.New(sha256.New, []byte(a.clientSecret))
+	mac.Write([]byte(state))
+	return state + "." + hex.EncodeToString(mac.Sum(nil))
+}
+
+// checkState reports whether the state cookie of the browser was signed by the server for state
+func (a *artifactsConfig) checkState(cookie, state string) bool {
+	return state != "" && hmac.Equal([]byte(cookie), []byte(a.signState(state)))
+}
+
+// artifactKey is the S3 key of the requested path, refusing the paths out of the bucket root
+func artifactKey(requested string) (string, bool) {
+	key := strings.TrimPrefix(requested, "/")
+	if key == "" || key != path.Clean(key) || strings.HasPrefix(key, "../") || key == ".." {
+		return "", false
+	}
+	return key, true
+}
+
+// artifactsLogin sends the browser to the GitHub login, back to next once signed in. Only the
+// artifacts of this server are valid destinations.
+func (api *ApiServer) artifactsLogin(c *gin.Context) {
+	next := c.Query("next")
+	if !strings.HasPrefix(next, "/artifacts/jobs/") {
+		next = "/"
+	}
+	state, err := randomToken()
+	if err != nil {
+		api.logger.Error("Failed to create the OAuth state", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start the login"})
+		return
+	}
+	if err := api.redis.Set(c.Request.Context(), artifactsStateKey(state), next, artifactsStateTTL).Err(); err != nil {
+		api.logger.Error("Failed to store the OAuth state", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start the login"})
+		return
+	}
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(artifactsStateCookie, api.artifacts.signState(state), int(artifactsStateTTL.Seconds()), "/artifacts/login", "", api.artifacts.secure(), true)
+
+	query := url.Values{}
+	query.Set("client_id", api.artifacts.clientID)
+	query.Set("redirect_uri", api.artifacts.publicURL+"/artifacts/login/callback")
+	query.Set("scope", githubOAuthScope)
+	query.Set("state", state)
+	c.Redirect(http.StatusFound, githubOAuthAuthorizeURL+"?"+query.Encode())
+}
+
+// artifactsCallback checks the login was started by this browser, exchanges the OAuth code for a
+// token of the user and opens a session. The token is only used to check the permission of the
+// user on the repository of the requested artifact, then dropped: the session holds the login
+// and the permissions.
+func (api *ApiServer) artifactsCallback(c *gin.Context) {
+	ctx := c.Request.Context()
+	state := c.Query("state")
+	cookie, _ := c.Cookie(artifactsStateCookie)
+	c.SetCookie(artifactsStateCookie, "", -1, "/artifacts/login", "", api.artifacts.secure(), true)
+	if !api.artifacts.checkState(cookie, state) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired login, please try again"})
+		return
+	}
+	next, err := api.redis.GetDel(ctx, artifactsStateKey(state)).Result()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired login, please try again"})
+		return
+	}
+
+	token, err := api.exchangeOAuthCode(ctx, c.Query("code"))
+	if err != nil {
+		api.logger.Error("Failed to exchange the OAuth code", zap.Error(err))
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "GitHub login failed"})
+		return
+	}
+	var user struct {
+		Login string `json:"login"`
+	}
+	if _, err := githubGet(ctx, token, "/user", &user); err != nil {
+		api.logger.Error("Failed to read the GitHub user", zap.Error(err))
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "GitHub login failed"})
+		return
+	}
+
+	// The session of the browser is kept when it is the same user, so that it gathers the
+	// permissions of every repository the user opened artifacts of
+	session, _ := c.Cookie(artifactsSessionCookie)
+	if session == "" || api.redis.HGet(ctx, artifactsSessionKey(session), "login").Val() != user.Login {
+		if session, err = randomToken(); err != nil {
+			api.logger.Error("Failed to create the session", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open a session"})
+			return
+		}
+	}
+	key := artifactsSessionKey(session)
+	if err := api.redis.HSet(ctx, key, "login", user.Login).Err(); err != nil {
+		api.logger.Error("Failed to store the session", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open a session"})
+		return
+	}
+	api.redis.Expire(ctx, key, artifactsSessionTTL)
+
+	if artifact, ok := nextArtifactKey(next); ok {
+		owner, repo, err := api.artifactRepo(ctx, artifact)
+		if err == nil {
+			err = api.recordRepoAccess(ctx, session, token, owner, repo)
+		}
+		if err != nil && !errors.Is(err, errArtifactNotFound) {
+			api.logger.Error("Failed to check the repository permission", zap.String("user", user.Login), zap.Error(err))
+			c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to check the repository permission"})
+			return
+		}
+	}
+
+	api.logger.Infof("Artifacts session opened for GitHub user %s", user.Login)
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(artifactsSessionCookie, session, int(artifactsSessionTTL.Seconds()), "/artifacts/", "", api.artifacts.secure(), true)
+	c.Redirect(http.StatusFound, next)
+}
+
+// nextArtifactKey is the S3 key of the artifact the login was started for, if any
+func nextArtifactKey(next string) (string, bool) {
+	parsed, err := url.Parse(next)
+	if err != nil || !strings.HasPrefix(parsed.Path, "/artifacts/jobs/") {
+		return "", false
+	}
+	return artifactKey(strings.TrimPrefix(parsed.Path, "/artifacts/jobs"))
+}
+
+// secure reports whether the cookies are only sent over https, as the public URL is served
+func (a *artifactsConfig) secure() bool {
+	return strings.HasPrefix(a.publicURL, "https://")
+}
+
+func (api *ApiServer) exchangeOAuthCode(ctx context.Context, code string) (string, error) {
+	if code == "" {
+		return "", errors.New("no OAuth code")
+	}
+	form := url.Values{}
+	form.Set("client_id", api.artifacts.clientID)
+	form.Set("client_secret", api.artifacts.clientSecret)
+	form.Set("code", code)
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, githubOAuthTokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	var result struct {
+		AccessToken string `json:"access_token"`
+		Error       string `json:"error"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&result); err != nil {
+		return "", err
+	}
+	if result.AccessToken == "" {
+		return "", fmt.Errorf("no access token: %s", result.Error)
+	}
+	return result.AccessToken, nil
+}
+
+// githubGet decodes a GitHub API response into v and returns its status
+func githubGet(ctx context.Context, token, endpoint string, v interface{}) (int, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, githubAPIURL+endpoint, nil)
+	if err != nil {
+		return 0, err
+	}
+	request.Header.Set("Authorization", "Bearer "+token)
+	request.Header.Set("Accept", "application/vnd.github+json")
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return response.StatusCode, fmt.Errorf("GitHub API %s returned %s", endpoint, response.Status)
+	}
+	return response.StatusCode, json.NewDecoder(response.Body).Decode(v)
+}
+
+// recordRepoAccess asks GitHub, with the token of the user, whether the user of the session can
+// read the repository and records the answer for artifactsAccessTTL
+func (api *ApiServer) recordRepoAccess(ctx context.Context, session, token, owner, repo string) error {
+	var repository struct {
+		Permissions struct {
+			Pull bool `json:"pull"`
+		} `json:"permissions"`
+	}
+	status, err := githubGet(ctx, token, fmt.Sprintf("/repos/%s/%s", url.PathEscape(owner), url.PathEscape(repo)), &repository)
+	if err != nil && status != http.StatusNotFound && status != http.StatusForbidden {
+		return err
+	}
+	allowed := "0"
+	if err == nil && repository.Permissions.Pull {
+		allowed = "1"
+	}
+	return api.redis.Set(ctx, artifactsAccessKey(session, owner, repo), allowed, artifactsAccessTTL).Err()
+}
+
+// errArtifactNotFound is returned for the keys of no artifact, or of an artifact whose repository
+// is unknown
+var errArtifactNotFound = errors.New("artifact not found")
+
+// artifactRepo is the repository of the job of an artifact, from the metadata of the object set by
+// the workers. The artifacts uploaded before it was set fall back to the keys of their job, as long
+// as they are kept.
+func (api *ApiServer) artifactRepo(ctx context.Context, key string) (string, string, error) {
+	head, err := api.artifacts.s3.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(api.artifacts.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		var notFound *types.NotFound
+		if errors.As(err, &notFound) {
+			return "", "", errArtifactNotFound
+		}
+		return "", "", err
+	}
+	if owner, repo, found := strings.Cut(head.Metadata[artifactRepoMetadata], "/"); found && owner != "" && repo != "" {
+		return owner, repo, nil
+	}
+
+	jobID, ok := artifactJobID(key)
+	if !ok {
+		return "", "", errArtifactNotFound
+	}
+	owner := api.redis.Get(ctx, fmt.Sprintf("jobs:%s:repo_owner", jobID)).Val()
+	repo := api.redis.Get(ctx, fmt.Sprintf("jobs:%s:repo_name", jobID)).Val()
+	if owner == "" || repo == "" {
+		return "", "", errArtifactNotFound
+	}
+	return owner, repo, nil
+}
+
+// getArtifact serves an object of the results of a job to a signed in user who can read the
+// repository of the job. Range requests are passed to S3, the JSONL viewer reads the datasets
+// in chunks.
+func (api *ApiServer) getArtifact(c *gin.Context) {
+	ctx := c.Request.Context()
+	key, ok := artifactKey(c.Param("key"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return
+	}
+
+	loginURL := "/artifacts/login?next=" + url.QueryEscape(c.Request.URL.RequestURI())
+	session, _ := c.Cookie(artifactsSessionCookie)
+	var login string
+	if session != "" {
+		var err error
+		login, err = api.redis.HGet(ctx, artifactsSessionKey(session), "login").Result()
+		if err != nil && err != redis.Nil {
+			api.logger.Error("Failed to read the session", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read the session"})
+			return
+		}
+	}
+	if login == "" {
+		c.Redirect(http.StatusFound, loginURL)
+		return
+	}
+
+	owner, repo, err := api.artifactRepo(ctx, key)
+	if errors.Is(err, errArtifactNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return
+	} else if err != nil {
+		api.logger.Error("Failed to read the repository of the artifact", zap.String("key", key), zap.Error(err))
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to get the artifact"})
+		return
+	}
+	// The permission is checked again through the GitHub login once it expired
+	allowed, err := api.redis.Get(ctx, artifactsAccessKey(session, owner, repo)).Result()
+	if err == redis.Nil {
+		c.Redirect(http.StatusFound, loginURL)
+		return
+	} else if err != nil {
+		api.logger.Error("Failed to read the repository permission", zap.String("user", login), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read the session"})
+		return
+	}
+	if allowed != "1" {
+		c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("%s cannot read %s/%s", login, owner, repo)})
+		return
+	}
+
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(api.artifacts.bucket),
+		Key:    aws.String(key),
+	}
+	if rangeHeader := c.GetHeader("Range"); rangeHeader != "" {
+		input.Range = aws.String(rangeHeader)
+	}
+	object, err := api.artifacts.s3.GetObject(ctx, input)
+	if err != nil {
+		var noSuchKey *types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+			return
+		}
+		api.logger.Error("Failed to get the artifact", zap.String("key", key), zap.Error(err))
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to get the artifact"})
+		return
+	}
+	defer object.Body.Close()
+
+	status := http.StatusOK
+	header := c.Writer.Header()
+	if object.ContentRange != nil {
+		status = http.StatusPartialContent
+		header.Set("Content-Range", aws.ToString(object.ContentRange))
+	}
+	if object.ContentLength != nil {
+		header.Set("Content-Length", strconv.FormatInt(*object.ContentLength, 10))
+	}
+	if object.ContentType != nil {
+		header.Set("Content-Type", *object.ContentType)
+	}
+	header.Set("Accept-Ranges", "bytes")
+	// The artifacts depend on the permission of the user, they must not be shared by proxies
+	header.Set("Cache-Control", "private")
+	c.Status(status)
+	if _, err := io.Copy(c.Writer, object.Body); err != nil {
+		api.logger.Warn("Failed to send the artifact", zap.String("key", key), zap.Error(err))
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+// redisKeyMaintenance holds the maintenance in progress, the workers take no job while it is set
+const redisKeyMaintenance = "maintenance"
+
+// Maintenance is the planned maintenance of the bot and its workers, as stored by the bot
+type Maintenance struct {
+	Until   time.Time `json:"until,omitempty"`
+	Message string    `json:"message,omitempty"`
+	Started time.Time `json:"started"`
+}
+
+// getMaintenance returns the maintenance in progress, 404 when there is none
+func (api *ApiServer) getMaintenance(c *gin.Context) {
+	value, err := api.redis.Get(c.Request.Context(), redisKeyMaintenance).Bytes()
+	if err == redis.Nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No maintenance in progress"})
+		return
+	}
+	if err != nil {
+		api.logger.Errorf("Failed to read the maintenance: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read the maintenance"})
+		return
+	}
+	var m Maintenance
+	if err := json.Unmarshal(value, &m); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid maintenance"})
+		return
+	}
+	c.JSON(http.StatusOK, m)
+}
+
+// startMaintenance starts a maintenance, the body gives when the jobs resume and what for
+func (api *ApiServer) startMaintenance(c *gin.Context) {
+	var req struct {
+		Until   time.Time `json:"until"`
+		Message string    `json:"message"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request, expected until as RFC 3339 and message"})
+		return
+	}
+	m := Maintenance{Until: req.Until.UTC(), Message: req.Message, Started: time.Now().UTC()}
+	value, err := json.Marshal(m)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start the maintenance"})
+		return
+	}
+	if err := api.redis.Set(c.Request.Context(), redisKeyMaintenance, value, 0).Err(); err != nil {
+		api.logger.Errorf("Failed to start the maintenance: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start the maintenance"})
+		return
+	}
+	api.logger.Infof("Maintenance started until %s: %s", m.Until.Format(time.RFC3339), m.Message)
+	c.JSON(http.StatusOK, m)
+}
+
+// stopMaintenance ends the maintenance, the workers take the queued jobs again
+func (api *ApiServer) stopMaintenance(c *gin.Context) {
+	if err := api.redis.Del(c.Request.Context(), redisKeyMaintenance).Err(); err != nil {
+		api.logger.Errorf("Failed to end the maintenance: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to end the maintenance"})
+		return
+	}
+	api.logger.Info("Maintenance ended")
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/instructlab/instructlab-bot/pkg/jobqueue"
+	"github.com/spf13/cobra"
+)
+
+var (
+	MaintenanceUntil   string
+	MaintenanceMessage string
+)
+
+func init() {
+	maintenanceOnCmd.Flags().StringVarP(&MaintenanceUntil, "until", "", "", "When the jobs are expected to resume, a duration from now such as 2h, a date or an RFC 3339 time. If blank, the requesters are not told when")
+	maintenanceOnCmd.Flags().StringVarP(&MaintenanceMessage, "message", "m", "", "What the maintenance is for, told to the requesters")
+	maintenanceCmd.AddCommand(maintenanceOnCmd, maintenanceOffCmd, maintenanceStatusCmd)
+	adminCmd.AddCommand(maintenanceCmd)
+	rootCmd.AddCommand(adminCmd)
+}
+
+var adminCmd = &cobra.Command{
+	Use:   "admin",
+	Short: "Administer the bot and the workers sharing the Redis instance",
+}
+
+var maintenanceCmd = &cobra.Command{
+	Use:   "maintenance",
+	Short: "Pause the workers for a planned maintenance, the bot tells the requesters when the jobs resume",
+}
+
+var maintenanceOnCmd = &cobra.Command{
+	Use:   "on",
+	Short: "Start a maintenance, the workers finish their running job and take no new one",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		now := time.Now()
+		until, err := parseMaintenanceUntil(MaintenanceUntil, now)
+		if err != nil {
+			return err
+		}
+		queue := jobqueue.NewClient(RedisHost)
+		defer queue.Close()
+		m := jobqueue.Maintenance{Until: until, Message: MaintenanceMessage, Started: now.UTC()}
+		if err := queue.StartMaintenance(commandContext(cmd), m); err != nil {
+			return fmt.Errorf("could not start the maintenance: %w", err)
+		}
+		writeMaintenance(cmd.OutOrStdout(), &m)
+		return nil
+	},
+}
+
+var maintenanceOffCmd = &cobra.Command{
+	Use:   "off",
+	Short: "End the maintenance, the workers take the queued jobs again",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		queue := jobqueue.NewClient(RedisHost)
+		defer queue.Close()
+		if err := queue.StopMaintenance(commandContext(cmd)); err != nil {
+			return fmt.Errorf("could not end the maintenance: %w", err)
+		}
+		writeMaintenance(cmd.OutOrStdout(), nil)
+		return nil
+	},
+}
+
+var maintenanceStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Tell whether a maintenance is in progress",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		queue := jobqueue.NewClient(RedisHost)
+		defer queue.Close()
+		m, err := queue.Maintenance(commandContext(cmd))
+		if err != nil {
+			return fmt.Errorf("could not read the maintenance: %w", err)
+		}
+		writeMaintenance(cmd.OutOrStdout(), m)
+		return nil
+	},
+}
+
+// commandContext is the context of a command, the background one when it was run without
+func commandContext(cmd *cobra.Command) context.Context {
+	if ctx := cmd.Context(); ctx != nil {
+		return ctx
+	}
+	return context.Background()
+}
+
+// parseMaintenanceUntil parses when the jobs resume, a duration from now, a date or an RFC 3339
+// time. It is not known for "".
+func parseMaintenanceUntil(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		if d <= 0 {
+			return time.Time{}, fmt.Errorf("invalid --until %q, the duration must be positive", value)
+		}
+		return now.Add(d).UTC().Truncate(time.Minute), nil
+	}
+	t, err := parseReportTime(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid --until %q, expected a duration such as 2h, a date or an RFC 3339 time", value)
+	}
+	return t.UTC(), nil
+}
+
+// writeMaintenance tells whether a maintenance is in progress and what the requesters are told
+func writeMaintenance(out io.Writer, m *jobqueue.Maintenance) {
+	if m == nil {
+		fmt.Fprintln(out, "No maintenance in progress, the workers take jobs.")
+		return
+	}
+	fmt.Fprintf(out, "Maintenance in progress since %s, the workers take no job.\n", m.Started.UTC().Format(time.RFC3339))
+	fmt.Fprintf(out, "Requesters are told: %s\n", m.Notice())
+}
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/instructlab/instructlab-bot/pkg/jobqueue"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseMaintenanceUntil verify the end of a maintenance is a duration from now, a date or a time.
+func TestParseMaintenanceUntil(t *testing.T) {
+	now := time.Date(2026, 10, 16, 20, 30, 15, 0, time.UTC)
+
+	until, err := parseMaintenanceUntil("", now)
+	require.NoError(t, err)
+	assert.True(t, until.IsZero())
+
+	until, err = parseMaintenanceUntil("2h", now)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 10, 16, 22, 30, 0, 0, time.UTC), until)
+
+	until, err = parseMaintenanceUntil("2026-10-17T06:00:00+02:00", now)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 10, 17, 4, 0, 0, 0, time.UTC), until)
+
+	until, err = parseMaintenanceUntil("2026-10-17", now)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC), until)
+
+	_, err = parseMaintenanceUntil("-1h", now)
+	assert.Error(t, err)
+	_, err = parseMaintenanceUntil("tomorrow", now)
+	assert.Error(t, err)
+}
+
+// TestWriteMaintenance verify the status tells what the requesters are told.
+func TestWriteMaintenance(t *testing.T) {
+	var out bytes.Buffer
+	writeMaintenance(&out, nil)
+	assert.Equal(t, "No maintenance in progress, the workers take jobs.\n", out.String())
+
+	out.Reset()
+	writeMaintenance(&out, &jobqueue.Maintenance{
+		Until:   time.Date(2026, 10, 17, 4, 0, 0, 0, time.UTC),
+		Message: "model upgrade",
+		Started: time.Date(2026, 10, 16, 20, 0, 0, 0, time.UTC),
+	})
+	assert.Equal(t, "Maintenance in progress since 2026-10-16T20:00:00Z, the workers take no job.\n"+
+		"Requesters are told: Maintenance in progress: model upgrade, jobs will resume at 2026-10-17 04:00 UTC.\n", out.String())
+}
@@ -0,0 +1,191 @@
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	diffEqual  = "equal"
+	diffInsert = "insert"
+	diffDelete = "delete"
+	// diffContextWords are the unchanged words kept visible around the changes, longer unchanged
+	// runs are collapsed
+	diffContextWords = 8
+	// maxDiffCells bounds the word diff table, longer answers are shown as replaced whole
+	maxDiffCells = 4_000_000
+)
+
+// diffWordPattern splits a text into words, each with the whitespace following it
+var diffWordPattern = regexp.MustCompile(`\s*\S+\s*|\s+`)
+
+// diffSegment is a run of words of a diff. Collapsed unchanged runs are folded in the reports.
+type diffSegment struct {
+	Op        string
+	Text      string
+	Collapsed bool
+	Summary   string
+}
+
+// answerDiff compares the answer of a contributor with the answer of a model, for the reports
+type answerDiff struct {
+	Question string
+	Context  string
+	Model    string
+	// Expected is the contributor answer, with the words the model left out deleted
+	Expected []diffSegment
+	// Actual is the model answer, with the words the contributor did not write inserted
+	Actual []diffSegment
+	// Inline is both answers merged
+	Inline []diffSegment
+}
+
+// diffWords returns the word level diff turning expected into actual
+func diffWords(expected, actual string) []diffSegment {
+	a, b := diffWordPattern.FindAllString(expected, -1), diffWordPattern.FindAllString(actual, -1)
+	var segments []diffSegment
+	add := func(op, text string) {
+		segments = appendSegment(segments, diffSegment{Op: op, Text: text})
+	}
+
+	if len(a)*len(b) > maxDiffCells {
+		add(diffDelete, expected)
+		add(diffInsert, actual)
+		return segments
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int32, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if sameWord(a[i], b[j]) {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case sameWord(a[i], b[j]):
+			add(diffEqual, b[j])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			add(diffDelete, a[i])
+			i++
+		default:
+			add(diffInsert, b[j])
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		add(diffDelete, a[i])
+	}
+	for ; j < len(b); j++ {
+		add(diffInsert, b[j])
+	}
+	return segments
+}
+
+// sameWord compares words ignoring the whitespace around them
+func sameWord(a, b string) bool {
+	return strings.TrimSpace(a) == strings.TrimSpace(b)
+}
+
+// collapseContext folds the middle of the unchanged runs longer than twice diffContextWords
+func collapseContext(segments []diffSegment) []diffSegment {
+	var collapsed []diffSegment
+	for i, segment := range segments {
+		words := diffWordPattern.FindAllString(segment.Text, -1)
+		if segment.Op != diffEqual || len(words) <= 2*diffContextWords+1 {
+			collapsed = append(collapsed, segment)
+			continue
+		}
+		// The first and last runs have nothing to give context to on one side
+		head, tail := diffContextWords, diffContextWords
+		if i == 0 {
+			head = 0
+		}
+		if i == len(segments)-1 {
+			tail = 0
+		}
+		hidden := words[head : len(words)-tail]
+		if head > 0 {
+			collapsed = append(collapsed, diffSegment{Op: diffEqual, Text: strings.Join(words[:head], "")})
+		}
+		collapsed = append(collapsed, diffSegment{
+			Op:        diffEqual,
+			Text:      strings.Join(hidden, ""),
+			Collapsed: true,
+			Summary:   fmt.Sprintf("%d unchanged words", len(hidden)),
+		})
+		if tail > 0 {
+			collapsed = append(collapsed, diffSegment{Op: diffEqual, Text: strings.Join(words[len(words)-tail:], "")})
+		}
+	}
+	return collapsed
+}
+
+// appendSegment appends the segment, merged into the last one when they have the same op
+func appendSegment(segments []diffSegment, segment diffSegment) []diffSegment {
+	if n := len(segments); n > 0 && segments[n-1].Op == segment.Op {
+		segments[n-1].Text += segment.Text
+		return segments
+	}
+	return append(segments, segment)
+}
+
+// newAnswerDiff compares the answers, each side of the side by side view only holds its own words
+func newAnswerDiff(question, context, model, expected, actual string) *answerDiff {
+	inline := diffWords(expected, actual)
+	var expectedSide, actualSide []diffSegment
+	for _, segment := range inline {
+		if segment.Op != diffInsert {
+			expectedSide = appendSegment(expectedSide, segment)
+		}
+		if segment.Op != diffDelete {
+			actualSide = appendSegment(actualSide, segment)
+		}
+	}
+	return &answerDiff{
+		Question: question,
+		Context:  context,
+		Model:    model,
+		Expected: collapseContext(expectedSide),
+		Actual:   collapseContext(actualSide),
+		Inline:   collapseContext(inline),
+	}
+}
+
+// chatlogReportFile is a precheck chat log of the combined report, with the diff of the
+// answers when the contributor gave one
+func chatlogReportFile(name string, logData map[string]interface{}, content string) reportFile {
+	file := reportFile{Name: name, Content: content}
+	input := logData["input"]
+	expected, actual := stringField(input, "answer"), stringField(logData, "output")
+	if expected == "" || actual == "" {
+		return file
+	}
+	file.Diff = newAnswerDiff(stringField(input, "question"), stringField(input, "context"), stringField(logData, "model"), expected, actual)
+	return file
+}
+
+// stringField returns the string value of key in a map decoded from YAML, empty when it has none
+func stringField(m interface{}, key string) string {
+	var value interface{}
+	switch m := m.(type) {
+	case map[string]interface{}:
+		value = m[key]
+	case map[interface{}]interface{}:
+		value = m[key]
+	}
+	s, _ := value.(string)
+	return s
+}
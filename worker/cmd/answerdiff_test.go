@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+)
+
+// TestDiffWords verify the word diff keeps the whitespace and only marks the changed words.
+func TestDiffWords(t *testing.T) {
+	assert.Equal(t, []diffSegment{
+		{Op: diffEqual, Text: "The sky is "},
+		{Op: diffDelete, Text: "blue "},
+		{Op: diffInsert, Text: "grey "},
+		{Op: diffEqual, Text: "today."},
+	}, diffWords("The sky is blue today.", "The sky is grey today."))
+
+	assert.Equal(t, []diffSegment{{Op: diffInsert, Text: "new answer"}}, diffWords("", "new answer"))
+	assert.Equal(t, []diffSegment{{Op: diffEqual, Text: "same\nanswer"}}, diffWords("same\nanswer", "same\nanswer"))
+}
+
+// TestCollapseContext verify long unchanged runs are folded, keeping the words next to the changes.
+func TestCollapseContext(t *testing.T) {
+	long := strings.Repeat("word ", 30)
+	segments := collapseContext([]diffSegment{
+		{Op: diffEqual, Text: long},
+		{Op: diffInsert, Text: "added "},
+		{Op: diffEqual, Text: long},
+		{Op: diffDelete, Text: "removed "},
+		{Op: diffEqual, Text: "short end"},
+	})
+	var ops []string
+	for _, segment := range segments {
+		op := segment.Op
+		if segment.Collapsed {
+			op = "collapsed"
+		}
+		ops = append(ops, op)
+	}
+	// The first run only keeps the words before the change, the middle one the words on both sides
+	assert.Equal(t, []string{"collapsed", diffEqual, diffInsert, diffEqual, "collapsed", diffEqual, diffDelete, diffEqual}, ops)
+	assert.Equal(t, "22 unchanged words", segments[0].Summary)
+	assert.Equal(t, strings.Repeat("word ", diffContextWords), segments[1].Text)
+	assert.Equal(t, "14 unchanged words", segments[4].Summary)
+}
+
+// TestChatlogReportFile verify the chat logs with a contributor answer compare it with the model answer.
+func TestChatlogReportFile(t *testing.T) {
+	var logData map[string]interface{}
+	assert.NoError(t, yaml.Unmarshal([]byte(`
+input:
+  question: What color is the sky?
+  answer: The sky is blue
+  context: Colors
+model: granite
+output: The sky is grey
+`), &logData))
+	file := chatlogReportFile("chat.yaml", logData, "raw")
+	assert.NotNil(t, file.Diff)
+	assert.Equal(t, "What color is the sky?", file.Diff.Question)
+	assert.Equal(t, "Colors", file.Diff.Context)
+	assert.Equal(t, "granite", file.Diff.Model)
+	assert.Equal(t, []diffSegment{{Op: diffEqual, Text: "The sky is "}, {Op: diffDelete, Text: "blue"}}, file.Diff.Expected)
+	assert.Equal(t, []diffSegment{{Op: diffEqual, Text: "The sky is "}, {Op: diffInsert, Text: "grey"}}, file.Diff.Actual)
+
+	delete(logData["input"].(map[interface{}]interface{}), "answer")
+	assert.Nil(t, chatlogReportFile("chat.yaml", logData, "raw").Diff)
+}
+
+// TestCombinedDiffHTML verify the combined report shows the diff of the answers next to the raw chat log.
+func TestCombinedDiffHTML(t *testing.T) {
+	var out bytes.Buffer
+	assert.NoError(t, generateAllHTML(&out, "Precheck chat logs", nil, []reportFile{
+		{Name: "chat.yaml", Content: "raw", Diff: newAnswerDiff("Color?", "", "granite", "The sky is <blue>", "The sky is grey")},
+		{Name: "other.yaml", Content: "no answer"},
+	}))
+	html := out.String()
+	assert.Contains(t, html, `<button type="button" class="diff-mode"`)
+	assert.Contains(t, html, "<h4>Model answer (granite)</h4>")
+	assert.Contains(t, html, "<p>The sky is <del>&lt;blue&gt;</del></p>")
+	assert.Contains(t, html, "<p>The sky is <ins>grey</ins></p>")
+	assert.Contains(t, html, "<p>The sky is <del>&lt;blue&gt;</del><ins>grey</ins></p>")
+	assert.NotContains(t, html, `class="context"`)
+	assert.Contains(t, html, "<pre>no answer</pre>")
+}
@@ -0,0 +1,308 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	// encryptedSuffix is appended to the names of the encrypted artifacts
+	encryptedSuffix = ".enc"
+	// encryptedChunkSize is the plaintext size of the chunks sealed one at a time, so that large
+	// datasets are encrypted and decrypted without holding them in memory
+	encryptedChunkSize = 64 * 1024
+	encryptedMagic     = "ILBOTENC"
+	encryptedVersion   = 1
+	// encryptedKeyIDSize is the size of the key ID in the header, a prefix of the SHA-256 of the key
+	encryptedKeyIDSize = 8
+	// encryptedNoncePrefixSize leaves 4 bytes of the nonce to the chunk counter and 1 to the last
+	// chunk flag
+	encryptedNoncePrefixSize = 7
+	encryptedHeaderSize      = len(encryptedMagic) + 1 + encryptedKeyIDSize + encryptedNoncePrefixSize
+)
+
+var (
+	ArtifactEncryptionKey string
+	ArtifactKeyLocation   string
+	EncryptedArtifacts    []string
+	DecryptKey            string
+	DecryptOutputDir      string
+)
+
+// artifactEncryption encrypts the sensitive artifacts of the jobs, nil when
+// --artifact-encryption-key is unset
+var artifactEncryption *artifactCipher
+
+func init() {
+	decryptArtifactsCmd.Flags().StringVarP(&DecryptKey, "key", "", "", "File holding the base64 AES-256 key the artifacts are encrypted with")
+	decryptArtifactsCmd.Flags().StringVarP(&DecryptOutputDir, "output-dir", "", "", "Directory the decrypted artifacts are written to. Defaults to the directory of every artifact")
+	_ = decryptArtifactsCmd.MarkFlagRequired("key")
+	rootCmd.AddCommand(decryptArtifactsCmd)
+}
+
+var decryptArtifactsCmd = &cobra.Command{
+	Use:   "decrypt-artifacts <artifact.enc>...",
+	Short: "Decrypt the artifacts of a job encrypted with --artifact-encryption-key.",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := loadArtifactCipher(DecryptKey)
+		if err != nil {
+			return err
+		}
+		for _, path := range args {
+			out, err := c.decryptFile(path, DecryptOutputDir)
+			if err != nil {
+				return fmt.Errorf("could not decrypt %s: %w", path, err)
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Decrypted %s to %s\n", path, out)
+		}
+		return nil
+	},
+}
+
+// artifactCipher encrypts artifacts with AES-256-GCM, in chunks sealed with the nonce prefix of
+// the artifact, their counter and a last chunk flag so that chunks can't be reordered or dropped
+type artifactCipher struct {
+	aead  cipher.AEAD
+	keyID []byte
+}
+
+// loadArtifactCipher reads the base64 AES-256 key of a file, as written by openssl rand -base64 32
+func loadArtifactCipher(keyPath string) (*artifactCipher, error) {
+	content, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not read the artifact encryption key: %w", err)
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(content)))
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("the artifact encryption key %s must hold 32 bytes in base64", keyPath)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256(key)
+	return &artifactCipher{aead: aead, keyID: digest[:encryptedKeyIDSize]}, nil
+}
+
+// KeyID names the key on the access page of the jobs, without revealing it
+func (c *artifactCipher) KeyID() string {
+	return hex.EncodeToString(c.keyID)
+}
+
+func (c *artifactCipher) chunkNonce(prefix []byte, counter uint32, last bool) []byte {
+	nonce := make([]byte, c.aead.NonceSize())
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[encryptedNoncePrefixSize:], counter)
+	if last {
+		nonce[len(nonce)-1] = 1
+	}
+	return nonce
+}
+
+// encrypt writes the header and the sealed chunks of src to dst
+func (c *artifactCipher) encrypt(dst io.Writer, src io.Reader) error {
+	header := make([]byte, 0, encryptedHeaderSize)
+	header = append(header, encryptedMagic...)
+	header = append(header, encryptedVersion)
+	header = append(header, c.keyID...)
+	prefix := make([]byte, encryptedNoncePrefixSize)
+	if _, err := rand.Read(prefix); err != nil {
+		return err
+	}
+	header = append(header, prefix...)
+	if _, err := dst.Write(header); err != nil {
+		return err
+	}
+
+	reader := bufio.NewReaderSize(src, encryptedChunkSize)
+	chunk := make([]byte, encryptedChunkSize)
+	for counter := uint32(0); ; counter++ {
+		n, err := io.ReadFull(reader, chunk)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		_, peekErr := reader.Peek(1)
+		last := peekErr != nil
+		sealed := c.aead.Seal(nil, c.chunkNonce(prefix, counter, last), chunk[:n], header)
+		if _, err := dst.Write(sealed); err != nil {
+			return err
+		}
+		if last {
+			return nil
+		}
+	}
+}
+
+// decrypt checks the header and the chunks of src and writes the plaintext to dst. A truncated
+// or tampered artifact fails, possibly after part of it was written.
+func (c *artifactCipher) decrypt(dst io.Writer, src io.Reader) error {
+	header := make([]byte, encryptedHeaderSize)
+	if _, err := io.ReadFull(src, header); err != nil {
+		return fmt.Errorf("not an encrypted artifact: %w", err)
+	}
+	if string(header[:len(encryptedMagic)]) != encryptedMagic || header[len(encryptedMagic)] != encryptedVersion {
+		return errors.New("not an encrypted artifact")
+	}
+	keyID := header[len(encryptedMagic)+1 : len(encryptedMagic)+1+encryptedKeyIDSize]
+	if !bytes.Equal(keyID, c.keyID) {
+		return fmt.Errorf("encrypted with key %s, not with key %s", hex.EncodeToString(keyID), c.KeyID())
+	}
+	prefix := header[len(header)-encryptedNoncePrefixSize:]
+
+	reader := bufio.NewReaderSize(src, encryptedChunkSize+c.aead.Overhead())
+	chunk := make([]byte, encryptedChunkSize+c.aead.Overhead())
+	for counter := uint32(0); ; counter++ {
+		n, err := io.ReadFull(reader, chunk)
+		if err != nil && err != io.ErrUnexpectedEOF {
+			if err == io.EOF {
+				return errors.New("the artifact is truncated")
+			}
+			return err
+		}
+		_, peekErr := reader.Peek(1)
+		last := peekErr != nil
+		plaintext, err := c.aead.Open(nil, c.chunkNonce(prefix, counter, last), chunk[:n], header)
+		if err != nil {
+			return errors.New("the artifact is corrupted, truncated or was tampered with")
+		}
+		if _, err := dst.Write(plaintext); err != nil {
+			return err
+		}
+		if last {
+			return nil
+		}
+	}
+}
+
+// encryptFile writes the encrypted copy of a file next to it, named with encryptedSuffix
+func (c *artifactCipher) encryptFile(path string) (string, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+	out := path + encryptedSuffix
+	dst, err := os.OpenFile(out, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return "", err
+	}
+	if err := c.encrypt(dst, src); err != nil {
+		dst.Close()
+		return "", err
+	}
+	return out, dst.Close()
+}
+
+// decryptFile writes the plaintext of an encrypted artifact to outputDir, or next to it, without
+// its encryptedSuffix. Nothing is left behind when it fails.
+func (c *artifactCipher) decryptFile(path, outputDir string) (string, error) {
+	if !strings.HasSuffix(path, encryptedSuffix) {
+		return "", fmt.Errorf("the name of an encrypted artifact ends with %s", encryptedSuffix)
+	}
+	src, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+	if outputDir == "" {
+		outputDir = filepath.Dir(path)
+	}
+	out := filepath.Join(outputDir, strings.TrimSuffix(filepath.Base(path), encryptedSuffix))
+	dst, err := os.OpenFile(out, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return "", err
+	}
+	err = c.decrypt(dst, src)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(out)
+		return "", err
+	}
+	return out, nil
+}
+
+// encryptedArtifact reports whether a job file is encrypted before its upload, by the patterns of
+// --encrypted-artifacts. The job log holds the ilab output about the contributor content, it is
+// always encrypted. The provenance holds no contributor content, and is left as it is.
+func encryptedArtifact(filename string) bool {
+	if artifactEncryption == nil || filename == provenanceFilename || strings.HasSuffix(filename, encryptedSuffix) {
+		return false
+	}
+	if filename == jobLogFilename {
+		return true
+	}
+	for _, pattern := range EncryptedArtifacts {
+		if matched, _ := filepath.Match(pattern, filename); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// validateEncryptedArtifacts checks the patterns of --encrypted-artifacts
+func validateEncryptedArtifacts() error {
+	for _, pattern := range EncryptedArtifacts {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid --encrypted-artifacts pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// accessFilename is the page the results of a job with encrypted artifacts link to
+const accessFilename = "access.html"
+
+// accessData is the data of the access page: the key the artifacts are encrypted with, where to
+// get it, and the encrypted artifacts
+type accessData struct {
+	KeyID       string
+	KeyLocation string
+	Files       []string
+}
+
+// generateAccessHTML writes the access page of a job with encrypted artifacts, telling how to
+// decrypt them, in place of its index
+func generateAccessHTML(accessFile io.Writer, name string, metadata []reportField, presignedFiles []map[string]string) error {
+	files := make([]reportFile, len(presignedFiles))
+	access := accessData{KeyID: artifactEncryption.KeyID(), KeyLocation: ArtifactKeyLocation}
+	for i, file := range presignedFiles {
+		files[i] = reportFile{Name: file["name"], URL: file["url"]}
+		if strings.HasSuffix(file["name"], encryptedSuffix) {
+			access.Files = append(access.Files, file["name"])
+		}
+	}
+	return reportTemplates.renderAccess(accessFile, fmt.Sprintf("Encrypted Data for %s", name), metadata, groupArtifacts(files), access)
+}
+
+// renderAccess writes the access page, in the branding of the renderer
+func (r *reportRenderer) renderAccess(out io.Writer, title string, metadata []reportField, sections []reportSection, access accessData) error {
+	return r.pages[reportAccessPage].Execute(out, reportData{
+		Title:    title,
+		Branding: r.branding,
+		Metadata: metadata,
+		Sections: sections,
+		Access:   &access,
+	})
+}
@@ -0,0 +1,151 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestArtifactKey writes a random base64 AES-256 key in dir
+func writeTestArtifactKey(t *testing.T, dir, name string) string {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	require.NoError(t, err)
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, []byte(base64.StdEncoding.EncodeToString(key)+"\n"), 0600))
+	return path
+}
+
+// TestArtifactEncryptRoundTrip verify artifacts of any size, chunk boundaries included, decrypt
+// to their plaintext.
+func TestArtifactEncryptRoundTrip(t *testing.T) {
+	c, err := loadArtifactCipher(writeTestArtifactKey(t, t.TempDir(), "artifacts.key"))
+	require.NoError(t, err)
+	assert.Len(t, c.KeyID(), 16)
+
+	for _, size := range []int{0, 1, encryptedChunkSize - 1, encryptedChunkSize, 3*encryptedChunkSize + 5} {
+		plaintext := bytes.Repeat([]byte("q"), size)
+		var sealed, opened bytes.Buffer
+		require.NoError(t, c.encrypt(&sealed, bytes.NewReader(plaintext)))
+		assert.NotContains(t, sealed.String(), strings.Repeat("q", 16))
+		require.NoError(t, c.decrypt(&opened, &sealed), "size %d", size)
+		assert.Equal(t, string(plaintext), opened.String(), "size %d", size)
+	}
+}
+
+// TestArtifactDecryptRefused verify other keys, truncated and tampered artifacts are refused.
+func TestArtifactDecryptRefused(t *testing.T) {
+	dir := t.TempDir()
+	c, err := loadArtifactCipher(writeTestArtifactKey(t, dir, "artifacts.key"))
+	require.NoError(t, err)
+	other, err := loadArtifactCipher(writeTestArtifactKey(t, dir, "other.key"))
+	require.NoError(t, err)
+
+	var sealed bytes.Buffer
+	require.NoError(t, c.encrypt(&sealed, bytes.NewReader(bytes.Repeat([]byte("a"), 2*encryptedChunkSize+10))))
+	data := sealed.Bytes()
+
+	err = other.decrypt(&bytes.Buffer{}, bytes.NewReader(data))
+	assert.ErrorContains(t, err, "encrypted with key "+c.KeyID())
+	// Dropping the last chunk makes the previous one look last
+	chunk := encryptedChunkSize + c.aead.Overhead()
+	assert.Error(t, c.decrypt(&bytes.Buffer{}, bytes.NewReader(data[:encryptedHeaderSize+2*chunk])))
+	assert.Error(t, c.decrypt(&bytes.Buffer{}, bytes.NewReader(data[:encryptedHeaderSize])))
+	tampered := append([]byte(nil), data...)
+	tampered[encryptedHeaderSize+5] ^= 1
+	assert.Error(t, c.decrypt(&bytes.Buffer{}, bytes.NewReader(tampered)))
+	assert.Error(t, c.decrypt(&bytes.Buffer{}, strings.NewReader("plain text of a chat log")))
+
+	_, err = loadArtifactCipher(filepath.Join(dir, "missing.key"))
+	assert.Error(t, err)
+	short := filepath.Join(dir, "short.key")
+	require.NoError(t, os.WriteFile(short, []byte(base64.StdEncoding.EncodeToString([]byte("short"))), 0600))
+	_, err = loadArtifactCipher(short)
+	assert.Error(t, err)
+}
+
+// TestArtifactEncryptFile verify an encrypted file decrypts to another directory, and a failed
+// decryption leaves no file behind.
+func TestArtifactEncryptFile(t *testing.T) {
+	dir := t.TempDir()
+	c, err := loadArtifactCipher(writeTestArtifactKey(t, dir, "artifacts.key"))
+	require.NoError(t, err)
+	chatLog := filepath.Join(dir, "chat.log")
+	require.NoError(t, os.WriteFile(chatLog, []byte("Q: What is blue?\nA: The sky"), 0644))
+
+	encrypted, err := c.encryptFile(chatLog)
+	require.NoError(t, err)
+	assert.Equal(t, chatLog+encryptedSuffix, encrypted)
+
+	outDir := t.TempDir()
+	decrypted, err := c.decryptFile(encrypted, outDir)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(outDir, "chat.log"), decrypted)
+	content, err := os.ReadFile(decrypted)
+	require.NoError(t, err)
+	assert.Equal(t, "Q: What is blue?\nA: The sky", string(content))
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "bad.log.enc"), []byte("not encrypted"), 0644))
+	_, err = c.decryptFile(filepath.Join(dir, "bad.log.enc"), outDir)
+	assert.Error(t, err)
+	assert.NoFileExists(t, filepath.Join(outDir, "bad.log"))
+	_, err = c.decryptFile(chatLog, outDir)
+	assert.Error(t, err)
+}
+
+// TestEncryptedArtifact verify only the files matching the patterns and the job log are encrypted,
+// never the provenance.
+func TestEncryptedArtifact(t *testing.T) {
+	defer func(c *artifactCipher, patterns []string) {
+		artifactEncryption, EncryptedArtifacts = c, patterns
+	}(artifactEncryption, EncryptedArtifacts)
+
+	artifactEncryption, EncryptedArtifacts = nil, []string{"*.log", "*.jsonl"}
+	assert.False(t, encryptedArtifact("chat.log"))
+
+	c, err := loadArtifactCipher(writeTestArtifactKey(t, t.TempDir(), "artifacts.key"))
+	require.NoError(t, err)
+	artifactEncryption = c
+	assert.True(t, encryptedArtifact("chat.log"))
+	assert.True(t, encryptedArtifact("generated.jsonl"))
+	assert.False(t, encryptedArtifact("chat.log.enc"))
+	assert.False(t, encryptedArtifact("index.html"))
+	assert.False(t, encryptedArtifact(provenanceFilename))
+	EncryptedArtifacts = nil
+	assert.True(t, encryptedArtifact(jobLogFilename))
+
+	EncryptedArtifacts = []string{"[log"}
+	assert.Error(t, validateEncryptedArtifacts())
+}
+
+// TestGenerateAccessHTML verify the access page names the key and the command decrypting the
+// encrypted artifacts.
+func TestGenerateAccessHTML(t *testing.T) {
+	defer func(c *artifactCipher, location string) {
+		artifactEncryption, ArtifactKeyLocation = c, location
+	}(artifactEncryption, ArtifactKeyLocation)
+	c, err := loadArtifactCipher(writeTestArtifactKey(t, t.TempDir(), "artifacts.key"))
+	require.NoError(t, err)
+	artifactEncryption, ArtifactKeyLocation = c, "the data governance team"
+
+	var out bytes.Buffer
+	err = generateAccessHTML(&out, "PR 7", []reportField{{Name: "Job", Value: "42"}}, []map[string]string{
+		{"name": "chat.log.enc", "url": "https://example.com/chat.log.enc"},
+		{"name": "provenance.intoto.jsonl", "url": "https://example.com/provenance.intoto.jsonl"},
+	})
+	require.NoError(t, err)
+	page := out.String()
+	assert.Contains(t, page, "Encrypted Data for PR 7")
+	assert.Contains(t, page, c.KeyID())
+	assert.Contains(t, page, "the data governance team")
+	assert.Contains(t, page, "decrypt-artifacts --key &lt;key file&gt; chat.log.enc</pre>")
+	assert.Contains(t, page, `<h2>Encrypted</h2>`)
+	assert.Contains(t, page, `href="https://example.com/provenance.intoto.jsonl"`)
+}
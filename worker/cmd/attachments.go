@@ -0,0 +1,221 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	fdiff "github.com/go-git/go-git/v5/plumbing/format/diff"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/utils/merkletrie"
+)
+
+const (
+	// attachmentsFilename is the page of the attachments changed by a PR, listed by the job index
+	attachmentsFilename = "attachments.html"
+	// maxAttachmentSize is the size of the largest attachment shown, the larger ones are only listed
+	maxAttachmentSize = 256 * 1024
+)
+
+// The status of a changed attachment
+const (
+	attachmentAdded    = "added"
+	attachmentModified = "modified"
+	attachmentDeleted  = "deleted"
+)
+
+// attachment is a changed file of a contribution other than its qna.yaml: the attribution.txt of a
+// knowledge contribution or a markdown context file. ilab diff only lists the YAML files.
+type attachment struct {
+	// Path is relative to the taxonomy root, with forward slashes
+	Path   string
+	Status string
+	// Lines are the diff of the attachment, every line of it when it was added
+	Lines []attachmentLine
+	// Omitted tells why the content is not shown, such as a binary or too large file
+	Omitted string
+}
+
+// attachmentLine is a line of the diff of an attachment, Op is "insert", "delete" or "equal"
+type attachmentLine struct {
+	Op   string
+	Text string
+}
+
+// isAttachment reports whether a file of the taxonomy is an attachment of a contribution
+func isAttachment(root, file string) bool {
+	parsed, ok := parseTaxonomyPath(root, file)
+	if !ok {
+		return false
+	}
+	return path.Base(parsed.Path) == attributionFilename || strings.EqualFold(path.Ext(parsed.Path), ".md")
+}
+
+// changedAttachments lists the attachments changed by the PR since it forked from its base
+// branch, sorted by path. Scheduled jobs look at the whole taxonomy, they have none.
+func (w *Worker) changedAttachments() ([]attachment, error) {
+	if w.branch != "" {
+		return nil, nil
+	}
+	r, err := git.PlainOpen(w.taxonomyDir)
+	if err != nil {
+		return nil, err
+	}
+	head, err := r.Head()
+	if err != nil {
+		return nil, err
+	}
+	headCommit, err := r.CommitObject(head.Hash())
+	if err != nil {
+		return nil, err
+	}
+	baseRef, err := r.Reference(plumbing.NewRemoteReferenceName(Origin, w.prBaseRef()), true)
+	if err != nil {
+		return nil, fmt.Errorf("could not find base branch %s: %w", w.prBaseRef(), err)
+	}
+	baseCommit, err := r.CommitObject(baseRef.Hash())
+	if err != nil {
+		return nil, err
+	}
+	// The changes merged into the base branch since the PR forked are not part of it
+	if bases, err := headCommit.MergeBase(baseCommit); err == nil && len(bases) > 0 {
+		baseCommit = bases[0]
+	}
+	return diffAttachments(w.taxonomyDir, baseCommit, headCommit)
+}
+
+// diffAttachments lists the attachments changed between two commits, sorted by path
+func diffAttachments(root string, from, to *object.Commit) ([]attachment, error) {
+	fromTree, err := from.Tree()
+	if err != nil {
+		return nil, err
+	}
+	toTree, err := to.Tree()
+	if err != nil {
+		return nil, err
+	}
+	changes, err := object.DiffTree(fromTree, toTree)
+	if err != nil {
+		return nil, err
+	}
+
+	var attachments []attachment
+	for _, change := range changes {
+		name := change.To.Name
+		if name == "" {
+			name = change.From.Name
+		}
+		if !isAttachment(root, name) {
+			continue
+		}
+		a := attachment{Path: name, Status: attachmentModified}
+		action, err := change.Action()
+		if err != nil {
+			return nil, err
+		}
+		switch action {
+		case merkletrie.Insert:
+			a.Status = attachmentAdded
+		case merkletrie.Delete:
+			a.Status = attachmentDeleted
+		}
+		for _, side := range []struct {
+			tree *object.Tree
+			name string
+		}{{fromTree, change.From.Name}, {toTree, change.To.Name}} {
+			if side.name != "" && a.Omitted == "" {
+				a.Omitted, err = attachmentTooLarge(side.tree, side.name)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+		if a.Omitted == "" {
+			if a.Lines, a.Omitted, err = attachmentDiff(change); err != nil {
+				return nil, err
+			}
+		}
+		attachments = append(attachments, a)
+	}
+	sort.Slice(attachments, func(i, j int) bool { return attachments[i].Path < attachments[j].Path })
+	return attachments, nil
+}
+
+// attachmentTooLarge tells why an attachment of the tree is not shown when it is over
+// maxAttachmentSize, "" otherwise
+func attachmentTooLarge(tree *object.Tree, name string) (string, error) {
+	file, err := tree.File(name)
+	if err != nil {
+		return "", err
+	}
+	if file.Size > maxAttachmentSize {
+		return fmt.Sprintf("too large to be shown (%d bytes)", file.Size), nil
+	}
+	return "", nil
+}
+
+// attachmentDiff splits the patch of a changed attachment into lines. omitted tells why there are
+// none, such as a binary file.
+func attachmentDiff(change *object.Change) (lines []attachmentLine, omitted string, err error) {
+	patch, err := change.Patch()
+	if err != nil {
+		return nil, "", err
+	}
+	for _, filePatch := range patch.FilePatches() {
+		if filePatch.IsBinary() {
+			return nil, "binary file", nil
+		}
+		for _, chunk := range filePatch.Chunks() {
+			op := "equal"
+			switch chunk.Type() {
+			case fdiff.Add:
+				op = "insert"
+			case fdiff.Delete:
+				op = "delete"
+			}
+			for _, text := range strings.SplitAfter(chunk.Content(), "\n") {
+				if text != "" {
+					lines = append(lines, attachmentLine{Op: op, Text: text})
+				}
+			}
+		}
+	}
+	return lines, "", nil
+}
+
+// writeAttachments writes the page of the attachments changed by the PR to outputDir, so that the
+// reviewers find them next to the precheck results. There is no page when there are none.
+func (w *Worker) writeAttachments(outputDir string) error {
+	attachments, err := w.changedAttachments()
+	if err != nil || len(attachments) == 0 {
+		return err
+	}
+	for _, a := range attachments {
+		w.logger.Debugf("Attachment %s was %s", a.Path, a.Status)
+	}
+	file, err := os.Create(filepath.Join(outputDir, attachmentsFilename))
+	if err != nil {
+		return err
+	}
+	if err := reportTemplates.renderAttachments(file, "Changed attachments", w.reportMetadata(""), attachments); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// renderAttachments writes the attachments page, in the branding of the renderer
+func (r *reportRenderer) renderAttachments(out io.Writer, title string, metadata []reportField, attachments []attachment) error {
+	return r.pages[reportAttachmentsPage].Execute(out, reportData{
+		Title:       title,
+		Branding:    r.branding,
+		Metadata:    metadata,
+		Attachments: attachments,
+	})
+}
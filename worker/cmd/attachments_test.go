@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsAttachment(t *testing.T) {
+	assert.True(t, isAttachment("", "knowledge/science/attribution.txt"))
+	assert.True(t, isAttachment("", "knowledge/science/context.md"))
+	assert.True(t, isAttachment("", "compositional_skills/writing/README.MD"))
+	assert.False(t, isAttachment("", "knowledge/science/qna.yaml"))
+	assert.False(t, isAttachment("", "README.md"))
+	assert.False(t, isAttachment("", "docs/attribution.txt"))
+}
+
+// TestChangedAttachments verify the attachments changed since the PR forked are listed, and not
+// the ones changed on the base branch since.
+func TestChangedAttachments(t *testing.T) {
+	dir := t.TempDir()
+	r, err := git.PlainInit(dir, false)
+	assert.NoError(t, err)
+	wt, err := r.Worktree()
+	assert.NoError(t, err)
+
+	commit := func(files map[string]string, remove ...string) plumbing.Hash {
+		for name, content := range files {
+			assert.NoError(t, os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0o755))
+			assert.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+			_, err := wt.Add(name)
+			assert.NoError(t, err)
+		}
+		for _, name := range remove {
+			_, err := wt.Remove(name)
+			assert.NoError(t, err)
+		}
+		hash, err := wt.Commit("commit", &git.CommitOptions{Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()}})
+		assert.NoError(t, err)
+		return hash
+	}
+	fork := commit(map[string]string{
+		"README.md":                          "taxonomy\n",
+		"knowledge/science/qna.yaml":         "version: 3\n",
+		"knowledge/science/attribution.txt":  "Title of work: Physics\nRevision: 1\n",
+		"knowledge/history/attribution.txt":  "Title of work: History\n",
+		"compositional_skills/writing/notes": "notes\n",
+	})
+	base := commit(map[string]string{"knowledge/geography/context.md": "# Rivers\n"})
+	assert.NoError(t, wt.Checkout(&git.CheckoutOptions{Hash: fork, Branch: plumbing.NewBranchReferenceName("pr"), Create: true}))
+	commit(map[string]string{
+		"README.md":                         "taxonomy bot\n",
+		"knowledge/science/qna.yaml":        "version: 3\ndocument: {}\n",
+		"knowledge/science/attribution.txt": "Title of work: Physics\nRevision: 2\n",
+		"knowledge/science/context.md":      "# Physics\n",
+	}, "knowledge/history/attribution.txt")
+	assert.NoError(t, r.Storer.SetReference(plumbing.NewHashReference(plumbing.NewRemoteReferenceName(Origin, "main"), base)))
+
+	w := &Worker{taxonomyDir: dir, baseRef: "main"}
+	attachments, err := w.changedAttachments()
+	assert.NoError(t, err)
+	assert.Equal(t, []attachment{
+		{Path: "knowledge/history/attribution.txt", Status: attachmentDeleted, Lines: []attachmentLine{{Op: "delete", Text: "Title of work: History\n"}}},
+		{Path: "knowledge/science/attribution.txt", Status: attachmentModified, Lines: []attachmentLine{
+			{Op: "equal", Text: "Title of work: Physics\n"},
+			{Op: "delete", Text: "Revision: 1\n"},
+			{Op: "insert", Text: "Revision: 2\n"},
+		}},
+		{Path: "knowledge/science/context.md", Status: attachmentAdded, Lines: []attachmentLine{{Op: "insert", Text: "# Physics\n"}}},
+	}, attachments)
+
+	// Scheduled jobs look at the whole taxonomy
+	attachments, err = (&Worker{taxonomyDir: dir, branch: "main"}).changedAttachments()
+	assert.NoError(t, err)
+	assert.Empty(t, attachments)
+}
+
+func TestRenderAttachments(t *testing.T) {
+	var out bytes.Buffer
+	assert.NoError(t, reportTemplates.renderAttachments(&out, "Changed attachments", nil, []attachment{
+		{Path: "knowledge/science/attribution.txt", Status: attachmentModified, Lines: []attachmentLine{
+			{Op: "equal", Text: "Title of work: <Physics>\n"},
+			{Op: "insert", Text: "Revision: 2\n"},
+		}},
+		{Path: "knowledge/science/context.md", Status: attachmentAdded, Omitted: "too large to be shown (300000 bytes)"},
+	}))
+	html := out.String()
+	assert.Contains(t, html, "<h3>knowledge/science/attribution.txt (modified)</h3>")
+	assert.Contains(t, html, " Title of work: &lt;Physics&gt;\n<ins>+Revision: 2\n</ins>")
+	assert.Contains(t, html, "<p>The content is not shown: too large to be shown (300000 bytes).</p>")
+}
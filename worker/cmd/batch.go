@@ -0,0 +1,174 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// batchChatCompletionRequest sends several conversations in one request to the endpoints
+// supporting batch inference, vLLM-style: messages is a list of conversations, and the choices of
+// the response name the conversation they answer with their index
+type batchChatCompletionRequest struct {
+	Model       string          `json:"model,omitempty"`
+	Messages    [][]chatMessage `json:"messages"`
+	Temperature *float64        `json:"temperature,omitempty"`
+	MaxTokens   *int            `json:"max_tokens,omitempty"`
+	TopP        *float64        `json:"top_p,omitempty"`
+}
+
+// batched tells whether the questions of the target are sent in batches
+func (t precheckTarget) batched() bool {
+	return t.BatchSize > 1
+}
+
+// seedExamplePrompts renders the prompts of the seed examples of a taxonomy file the way the
+// precheck asks them, for the batches
+func (w *Worker) seedExamplePrompts(kind, file, taskDescription string, seedExamples []interface{}) [][]chatMessage {
+	var prompts [][]chatMessage
+	for _, item := range seedExamples {
+		example, ok := item.(map[interface{}]interface{})
+		if !ok {
+			continue
+		}
+		question, ok := example["question"].(string)
+		if !ok {
+			continue
+		}
+		context, _ := example["context"].(string)
+		prompt := promptData{Question: question, Context: context, TaskDescription: taskDescription, TaxonomyPath: file}
+		messages, err := precheckPrompts.render(kind, prompt)
+		if err != nil {
+			continue
+		}
+		prompts = append(prompts, w.genParams.applySystemPrompt(messages))
+		if ungrounded, err := w.ungroundedMessages(kind, prompt); err == nil && ungrounded != nil {
+			prompts = append(prompts, ungrounded)
+		}
+	}
+	return prompts
+}
+
+// prefetchAnswers asks the batched targets the prompts ahead of the precheck questions, which then
+// read the answers instead of sending a request each. The prompts with a cached answer are left
+// out, and a failed batch leaves its questions to the single requests with their retries.
+func (w *Worker) prefetchAnswers(client *http.Client, targets []precheckTarget, prompts [][]chatMessage) {
+	for _, target := range targets {
+		if !target.batched() {
+			continue
+		}
+		var pending [][]chatMessage
+		for _, messages := range prompts {
+			if !w.hasCachedAnswer(target, messages) {
+				pending = append(pending, messages)
+			}
+		}
+		for start := 0; start < len(pending); start += target.BatchSize {
+			batch := pending[start:min(start+target.BatchSize, len(pending))]
+			results, err := w.batchChatCompletion(client, target, batch)
+			if err != nil {
+				w.logger.Warnf("Batch of %d precheck questions to %s failed, asking them one by one: %v", len(batch), target.Endpoint, err)
+				continue
+			}
+			for i, messages := range batch {
+				w.storePrefetched(target, messages, results[i])
+			}
+		}
+	}
+}
+
+// batchChatCompletion sends the conversations in one request to the first endpoint of the target
+func (w *Worker) batchChatCompletion(client *http.Client, target precheckTarget, batch [][]chatMessage) ([]*chatResult, error) {
+	ctx := w.ctx
+	if PrecheckQuestionTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(w.ctx, PrecheckQuestionTimeout)
+		defer cancel()
+	}
+	// The request timeout is for the answer of a single question
+	batchClient := *client
+	batchClient.Timeout = client.Timeout * time.Duration(len(batch))
+
+	request := batchChatCompletionRequest{
+		Model:       target.Model,
+		Messages:    batch,
+		Temperature: w.genParams.Temperature,
+		MaxTokens:   w.genParams.MaxTokens,
+		TopP:        w.genParams.TopP,
+	}
+	start := time.Now()
+	completion, err := postChatCompletions(ctx, &batchClient, target, request)
+	if err != nil {
+		return nil, err
+	}
+	return batchResults(completion, len(batch), time.Since(start), target.Endpoint)
+}
+
+// batchResults matches the choices of a batch response with its conversations. The usage of the
+// batch is shared evenly by its answers.
+func batchResults(completion *chatCompletionResponse, size int, latency time.Duration, endpoint string) ([]*chatResult, error) {
+	results := make([]*chatResult, size)
+	for _, choice := range completion.Choices {
+		if choice.Index < 0 || choice.Index >= size || results[choice.Index] != nil {
+			return nil, fmt.Errorf("unexpected choice %d in the answers of a batch of %d questions", choice.Index, size)
+		}
+		results[choice.Index] = &chatResult{
+			Answer:       strings.TrimSpace(choice.Message.Content),
+			FinishReason: choice.FinishReason,
+			Latency:      latency,
+			Attempts:     1,
+			Endpoint:     endpoint,
+			Usage: chatUsage{
+				PromptTokens:     completion.Usage.PromptTokens / size,
+				CompletionTokens: completion.Usage.CompletionTokens / size,
+				TotalTokens:      completion.Usage.TotalTokens / size,
+			},
+		}
+	}
+	for i, result := range results {
+		if result == nil {
+			return nil, fmt.Errorf("no answer to question %d of a batch of %d, the endpoint may not support batches", i, size)
+		}
+	}
+	return results, nil
+}
+
+// hasCachedAnswer tells whether the answer cache already holds the answer of the target to the messages
+func (w *Worker) hasCachedAnswer(target precheckTarget, messages []chatMessage) bool {
+	if w.queue == nil || PrecheckCacheTTL <= 0 {
+		return false
+	}
+	key, err := answerCacheKey(target, w.genParams, messages)
+	if err != nil {
+		return false
+	}
+	exists, err := w.queue.Client.Exists(w.ctx, key).Result()
+	return err == nil && exists > 0
+}
+
+func (w *Worker) storePrefetched(target precheckTarget, messages []chatMessage, result *chatResult) {
+	key, err := answerCacheKey(target, w.genParams, messages)
+	if err != nil {
+		return
+	}
+	if w.prefetched == nil {
+		w.prefetched = make(map[string]*chatResult)
+	}
+	w.prefetched[key] = result
+}
+
+// takePrefetched returns the answer of a batch to the messages, once
+func (w *Worker) takePrefetched(target precheckTarget, messages []chatMessage) *chatResult {
+	if len(w.prefetched) == 0 {
+		return nil
+	}
+	key, err := answerCacheKey(target, w.genParams, messages)
+	if err != nil {
+		return nil
+	}
+	result := w.prefetched[key]
+	delete(w.prefetched, key)
+	return result
+}
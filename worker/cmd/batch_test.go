@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// TestPrefetchAnswers verify batched targets get the answers of several questions in one request.
+func TestPrefetchAnswers(t *testing.T) {
+	var batches []int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request batchChatCompletionRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		batches = append(batches, len(request.Messages))
+		// The choices come in any order, their index names the conversation
+		fmt.Fprint(w, `{"choices": [`)
+		for i := len(request.Messages) - 1; i >= 0; i-- {
+			fmt.Fprintf(w, `{"index": %d, "message": {"role": "assistant", "content": "answer to %s"}, "finish_reason": "stop"}`, i, request.Messages[i][0].Content)
+			if i > 0 {
+				fmt.Fprint(w, ",")
+			}
+		}
+		fmt.Fprint(w, `], "usage": {"prompt_tokens": 30, "completion_tokens": 9, "total_tokens": 39}}`)
+	}))
+	defer server.Close()
+
+	w := &Worker{ctx: context.Background(), logger: zap.NewNop().Sugar()}
+	target := precheckTarget{Endpoint: server.URL, BatchSize: 2}
+	prompts := [][]chatMessage{{{Role: "user", Content: "a"}}, {{Role: "user", Content: "b"}}, {{Role: "user", Content: "c"}}}
+	w.prefetchAnswers(server.Client(), []precheckTarget{target, {Endpoint: "http://unbatched.example.com"}}, prompts)
+	assert.Equal(t, []int{2, 1}, batches)
+
+	result, err := w.chatCompletion(context.Background(), server.Client(), target, prompts[1])
+	assert.NoError(t, err)
+	assert.Equal(t, "answer to b", result.Answer)
+	assert.Equal(t, chatUsage{PromptTokens: 15, CompletionTokens: 4, TotalTokens: 19}, result.Usage, "the usage of a batch is shared by its answers")
+	assert.Nil(t, w.takePrefetched(target, prompts[1]), "a prefetched answer is used once")
+}
+
+// TestBatchResults verify a response not answering every conversation of the batch is rejected.
+func TestBatchResults(t *testing.T) {
+	var completion chatCompletionResponse
+	assert.NoError(t, json.Unmarshal([]byte(`{"choices": [{"index": 0, "message": {"content": "Paris."}, "finish_reason": "stop"}]}`), &completion))
+	results, err := batchResults(&completion, 1, time.Second, "http://a")
+	assert.NoError(t, err)
+	assert.Equal(t, "Paris.", results[0].Answer)
+
+	_, err = batchResults(&completion, 2, time.Second, "http://a")
+	assert.ErrorContains(t, err, "no answer to question 1 of a batch of 2")
+
+	assert.NoError(t, json.Unmarshal([]byte(`{"choices": [{"index": 0}, {"index": 0}]}`), &completion))
+	_, err = batchResults(&completion, 2, time.Second, "http://a")
+	assert.ErrorContains(t, err, "unexpected choice 0")
+}
@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const answerCacheKeyPrefix = "precheck:answers"
+
+// answerCacheKey identifies an answer by the model that produced it and a hash of the full prompt
+// and generation parameters
+func answerCacheKey(target precheckTarget, params generationParams, messages []chatMessage) (string, error) {
+	prompt, err := json.Marshal(messages)
+	if err != nil {
+		return "", err
+	}
+	paramsJSON, err := json.Marshal(params)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.New()
+	hash.Write([]byte(target.Endpoint))
+	hash.Write([]byte{0})
+	hash.Write(paramsJSON)
+	hash.Write([]byte{0})
+	hash.Write(prompt)
+	model := target.Model
+	if model == "" {
+		model = "default"
+	}
+	return fmt.Sprintf("%s:%s:%s", answerCacheKeyPrefix, model, hex.EncodeToString(hash.Sum(nil))), nil
+}
+
+// cachedChatCompletion returns the cached answer for the prompt when there is one, otherwise it
+// asks the model and caches the answer for PrecheckCacheTTL
+func (w *Worker) cachedChatCompletion(ctx context.Context, client *http.Client, target precheckTarget, messages []chatMessage) (*chatResult, error) {
+	if w.queue == nil || PrecheckCacheTTL <= 0 {
+		return w.chatCompletion(ctx, client, target, messages)
+	}
+
+	key, err := answerCacheKey(target, w.genParams, messages)
+	if err != nil {
+		return nil, fmt.Errorf("could not build answer cache key: %w", err)
+	}
+
+	cached, err := w.queue.Client.Get(ctx, key).Bytes()
+	if err == nil {
+		var result chatResult
+		if err := json.Unmarshal(cached, &result); err == nil {
+			w.logger.Debugf("Using cached answer %s", key)
+			result.Cached = true
+			return &result, nil
+		}
+		w.logger.Warnf("Ignoring unreadable cached answer %s", key)
+	} else if err != redis.Nil {
+		w.logger.Warnf("Could not read the answer cache: %v", err)
+	}
+
+	result, err := w.chatCompletion(ctx, client, target, messages)
+	if err != nil {
+		return nil, err
+	}
+	// Truncated answers are not cached so that a retry can get a complete one
+	if result.FinishReason == "length" {
+		return result, nil
+	}
+
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		w.logger.Warnf("Could not encode answer for the cache: %v", err)
+		return result, nil
+	}
+	if err := w.queue.Client.Set(ctx, key, encoded, PrecheckCacheTTL).Err(); err != nil {
+		w.logger.Warnf("Could not write the answer cache: %v", err)
+	}
+	return result, nil
+}
@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestAnswerCacheKey verify cache keys change with the model and the prompt but nothing else.
+func TestAnswerCacheKey(t *testing.T) {
+	target := precheckTarget{Name: "granite", Endpoint: "https://granite.example.com/v1", Model: "granite-7b-lab"}
+	messages := []chatMessage{{Role: "user", Content: "What is the capital of France?"}}
+
+	key, err := answerCacheKey(target, generationParams{}, messages)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(key, answerCacheKeyPrefix+":granite-7b-lab:"), key)
+
+	renamed := target
+	renamed.Name = "base"
+	renamed.APIKey = "secret"
+	same, _ := answerCacheKey(renamed, generationParams{}, messages)
+	assert.Equal(t, key, same, "the target name and API key should not change the key")
+
+	other := target
+	other.Model = "merlinite-7b-lab"
+	otherModel, _ := answerCacheKey(other, generationParams{}, messages)
+	assert.NotEqual(t, key, otherModel)
+
+	otherPrompt, _ := answerCacheKey(target, generationParams{}, []chatMessage{{Role: "user", Content: "What is the capital of Spain?"}})
+	assert.NotEqual(t, key, otherPrompt)
+
+	temperature := 0.0
+	otherParams, _ := answerCacheKey(target, generationParams{Temperature: &temperature}, messages)
+	assert.NotEqual(t, key, otherParams)
+}
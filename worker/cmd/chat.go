@@ -0,0 +1,291 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultSystemPrompt matches the system prompt used by `ilab chat`
+	defaultSystemPrompt = "You are an AI language model developed by IBM Research. You are a cautious assistant. " +
+		"You carefully follow instructions. You are helpful and harmless and you follow ethical guidelines and promote positive behavior."
+	maxChatRetryBackoff = time.Minute
+)
+
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type chatCompletionRequest struct {
+	Model       string        `json:"model,omitempty"`
+	Messages    []chatMessage `json:"messages"`
+	Temperature *float64      `json:"temperature,omitempty"`
+	MaxTokens   *int          `json:"max_tokens,omitempty"`
+	TopP        *float64      `json:"top_p,omitempty"`
+}
+
+type chatUsage struct {
+	PromptTokens     int `json:"prompt_tokens" yaml:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens" yaml:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens" yaml:"total_tokens"`
+}
+
+type chatCompletionResponse struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		// Index is the conversation the choice answers in a batched request
+		Index        int         `json:"index"`
+		Message      chatMessage `json:"message"`
+		FinishReason string      `json:"finish_reason"`
+	} `json:"choices"`
+	Usage chatUsage `json:"usage"`
+}
+
+// precheckTarget is an endpoint and model precheck questions are sent to
+type precheckTarget struct {
+	Name     string `json:"name,omitempty"`
+	Endpoint string `json:"endpoint"`
+	// Endpoints are set when several endpoints serve the model, Endpoint is the first one
+	Endpoints []string `json:"endpoints,omitempty"`
+	Model     string   `json:"model,omitempty"`
+	APIKey    string   `json:"-"`
+	// BatchSize is how many questions are sent in a request to endpoints supporting batches
+	BatchSize int `json:"batch_size,omitempty"`
+}
+
+// endpoints are the endpoints serving the target, in their configured order
+func (t precheckTarget) endpoints() []string {
+	if len(t.Endpoints) > 0 {
+		return t.Endpoints
+	}
+	return []string{t.Endpoint}
+}
+
+// label names the target in reports, the configured name or else the model
+func (t precheckTarget) label() string {
+	if t.Name != "" {
+		return t.Name
+	}
+	return t.Model
+}
+
+// chatResult is the answer to a single chat completion along with its metadata
+type chatResult struct {
+	Answer       string        `json:"answer"`
+	FinishReason string        `json:"finish_reason"`
+	Usage        chatUsage     `json:"usage"`
+	Latency      time.Duration `json:"latency"`
+	Attempts     int           `json:"attempts"`
+	// Endpoint served the answer
+	Endpoint string `json:"endpoint,omitempty"`
+	// Warnings are the failed requests before the answer, they are not cached
+	Warnings []string `json:"-"`
+	Cached   bool     `json:"-"`
+	// TooLong answers are over --precheck-max-answer-length
+	TooLong bool `json:"-"`
+}
+
+// retryableError marks chat failures that are worth retrying (connection errors, 429 and 5xx responses)
+type retryableError struct {
+	err error
+	// retryAfter is the delay requested by the server, if any
+	retryAfter time.Duration
+}
+
+func (e *retryableError) Error() string { return e.err.Error() }
+func (e *retryableError) Unwrap() error { return e.err }
+
+// precheckHTTPClient builds the HTTP client used for requests to the precheck endpoint
+func precheckHTTPClient() *http.Client {
+	return &http.Client{
+		Timeout: PrecheckRequestTimeout,
+		Transport: &http.Transport{
+			TLSClientConfig:       &tls.Config{InsecureSkipVerify: TlsInsecure},
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: 1 * time.Second,
+		},
+	}
+}
+
+// chatCompletionsURL returns the chat/completions URL for an OpenAI compatible base endpoint
+func chatCompletionsURL(endpoint string) string {
+	return strings.TrimSuffix(endpoint, "/") + "/chat/completions"
+}
+
+// chatCompletion sends the messages to the precheck target, failing over to its other endpoints
+// and retrying transient failures with exponential backoff once every endpoint failed
+func (w *Worker) chatCompletion(ctx context.Context, client *http.Client, target precheckTarget, messages []chatMessage) (*chatResult, error) {
+	if result := w.takePrefetched(target, messages); result != nil {
+		return result, nil
+	}
+	pool := endpointPoolFor(target.endpoints())
+	var lastErr error
+	var warnings []string
+	requests := 0
+	for attempt := 1; attempt <= PrecheckMaxRetries+1; attempt++ {
+		var delay time.Duration
+		endpoints := pool.order(time.Now())
+		for i, endpoint := range endpoints {
+			requests++
+			attemptTarget := target
+			attemptTarget.Endpoint = endpoint
+			result, err := w.doChatCompletion(ctx, client, attemptTarget, messages)
+			if err == nil {
+				pool.markUp(endpoint, result.Latency)
+				result.Attempts = requests
+				result.Endpoint = endpoint
+				result.Warnings = warnings
+				return result, nil
+			}
+			lastErr = err
+			warnings = append(warnings, fmt.Sprintf("request %d to %s failed: %v", requests, endpoint, err))
+			retryable, ok := err.(*retryableError)
+			if !ok || ctx.Err() != nil {
+				return nil, lastErr
+			}
+			pool.markDown(endpoint, time.Now())
+			if retryable.retryAfter > delay {
+				delay = retryable.retryAfter
+			}
+			if i < len(endpoints)-1 {
+				w.logger.Infof("Failing over from precheck endpoint %s to %s: %v", endpoint, endpoints[i+1], err)
+			}
+		}
+		if attempt > PrecheckMaxRetries {
+			break
+		}
+
+		if backoff := retryBackoff(attempt); backoff > delay {
+			delay = backoff
+		}
+		w.logger.Infof("Retrying chat completion in %s, attempt %d/%d: %v", delay, attempt+1, PrecheckMaxRetries+1, lastErr)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+	return nil, lastErr
+}
+
+// retryBackoff is the delay before the next attempt: the base backoff doubled on every attempt,
+// capped at maxChatRetryBackoff, with up to 20% jitter so parallel workers don't retry in lockstep
+func retryBackoff(attempt int) time.Duration {
+	return backoffDelay(PrecheckRetryBackoff, attempt)
+}
+
+// backoffDelay doubles the base delay on every attempt, see retryBackoff
+func backoffDelay(base time.Duration, attempt int) time.Duration {
+	delay := base
+	for i := 1; i < attempt && delay < maxChatRetryBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxChatRetryBackoff {
+		delay = maxChatRetryBackoff
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return delay + time.Duration(rand.Int63n(int64(delay)/5+1))
+}
+
+func (w *Worker) doChatCompletion(ctx context.Context, client *http.Client, target precheckTarget, messages []chatMessage) (*chatResult, error) {
+	return doChatRequest(ctx, client, target, w.chatRequest(target, messages))
+}
+
+// chatRequest is the chat completion request of a precheck question, with the generation
+// parameters of the job
+func (w *Worker) chatRequest(target precheckTarget, messages []chatMessage) chatCompletionRequest {
+	return chatCompletionRequest{
+		Model:       target.Model,
+		Messages:    messages,
+		Temperature: w.genParams.Temperature,
+		MaxTokens:   w.genParams.MaxTokens,
+		TopP:        w.genParams.TopP,
+	}
+}
+
+// doChatRequest sends a single chat completion request to the endpoint of the target
+func doChatRequest(ctx context.Context, client *http.Client, target precheckTarget, request chatCompletionRequest) (*chatResult, error) {
+	start := time.Now()
+	completion, err := postChatCompletions(ctx, client, target, request)
+	if err != nil {
+		return nil, err
+	}
+	if len(completion.Choices) == 0 {
+		return nil, fmt.Errorf("chat response contained no choices")
+	}
+
+	return &chatResult{
+		Answer:       strings.TrimSpace(completion.Choices[0].Message.Content),
+		FinishReason: completion.Choices[0].FinishReason,
+		Usage:        completion.Usage,
+		Latency:      time.Since(start),
+	}, nil
+}
+
+// postChatCompletions posts a request to the chat completions API of the target endpoint
+func postChatCompletions(ctx context.Context, client *http.Client, target precheckTarget, request interface{}) (*chatCompletionResponse, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal chat request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", chatCompletionsURL(target.Endpoint), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if target.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+target.APIKey)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, &retryableError{err: modelEndpointError(fmt.Errorf("failed to execute chat request: %w", err))}
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, &retryableError{err: fmt.Errorf("failed to read chat response: %w", err)}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, string(respBody))
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+			return nil, &retryableError{err: err, retryAfter: retryAfter(resp)}
+		}
+		return nil, err
+	}
+
+	var completion chatCompletionResponse
+	if err := json.Unmarshal(respBody, &completion); err != nil {
+		return nil, fmt.Errorf("failed to parse chat response: %w", err)
+	}
+	return &completion, nil
+}
+
+// retryAfter returns the delay requested by the Retry-After header in seconds, 0 when unset. It
+// is capped at maxChatRetryBackoff so that a server can't stall a job indefinitely.
+func retryAfter(response *http.Response) time.Duration {
+	seconds, err := strconv.Atoi(response.Header.Get("Retry-After"))
+	if err != nil || seconds <= 0 {
+		return 0
+	}
+	if seconds >= int(maxChatRetryBackoff/time.Second) {
+		return maxChatRetryBackoff
+	}
+	return time.Duration(seconds) * time.Second
+}
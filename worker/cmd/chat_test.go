@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// TestChatCompletion verify the precheck question is sent to the chat completions API and the answer parsed
+func TestChatCompletion(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/chat/completions", r.URL.Path)
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+
+		var req chatCompletionRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, "merlinite-7b", req.Model)
+		if assert.Len(t, req.Messages, 2) {
+			assert.Equal(t, "user", req.Messages[1].Role)
+			assert.Equal(t, "What is the capital of France?", req.Messages[1].Content)
+		}
+
+		fmt.Fprintln(w, `{
+			"model": "merlinite-7b",
+			"choices": [
+				{"message": {"role": "assistant", "content": " Paris.\n"}, "finish_reason": "stop"}
+			],
+			"usage": {"prompt_tokens": 52, "completion_tokens": 3, "total_tokens": 55}
+		}`)
+	}))
+	defer mockServer.Close()
+
+	w := NewJobProcessor(
+		context.Background(),
+		nil,
+		nil,
+		zap.NewExample().Sugar(),
+		"job-id",
+		mockServer.URL,
+		"http://sdg-example.com",
+		"dummy-client-cert-path.pem",
+		"dummy-client-key-path.pem",
+		"dummy-ca-cert-path.pem",
+		20,
+	)
+
+	messages := []chatMessage{
+		{Role: "system", Content: defaultSystemPrompt},
+		{Role: "user", Content: "What is the capital of France?"},
+	}
+	target := precheckTarget{Endpoint: mockServer.URL, Model: "merlinite-7b", APIKey: "secret"}
+	result, err := w.chatCompletion(context.Background(), mockServer.Client(), target, messages)
+	assert.NoError(t, err, "chatCompletion should not return an error")
+	assert.Equal(t, "Paris.", result.Answer)
+	assert.Equal(t, "stop", result.FinishReason)
+	assert.Equal(t, 55, result.Usage.TotalTokens)
+	assert.Equal(t, 1, result.Attempts)
+}
+
+// TestChatCompletionClientError negative test that a 4xx response is not retried
+func TestChatCompletionClientError(t *testing.T) {
+	requests := 0
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.Error(w, `{"error": "model not found"}`, http.StatusNotFound)
+	}))
+	defer mockServer.Close()
+
+	w := NewJobProcessor(
+		context.Background(),
+		nil,
+		nil,
+		zap.NewExample().Sugar(),
+		"job-id",
+		mockServer.URL,
+		"http://sdg-example.com",
+		"dummy-client-cert-path.pem",
+		"dummy-client-key-path.pem",
+		"dummy-ca-cert-path.pem",
+		20,
+	)
+
+	target := precheckTarget{Endpoint: mockServer.URL, Model: "unknown-model"}
+	_, err := w.chatCompletion(context.Background(), mockServer.Client(), target, nil)
+	assert.Error(t, err, "chatCompletion should return an error")
+	assert.Equal(t, 1, requests, "client errors should not be retried")
+}
+
+// TestChatCompletionRetry verify server errors are retried until the model answers
+func TestChatCompletionRetry(t *testing.T) {
+	saved := PrecheckRetryBackoff
+	PrecheckRetryBackoff = time.Millisecond
+	defer func() { PrecheckRetryBackoff = saved }()
+
+	requests := 0
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			http.Error(w, "overloaded", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, `{"choices": [{"message": {"role": "assistant", "content": "Paris."}, "finish_reason": "stop"}]}`)
+	}))
+	defer mockServer.Close()
+
+	w := NewJobProcessor(context.Background(), nil, nil, zap.NewExample().Sugar(), "job-id",
+		mockServer.URL, "", "", "", "", 20)
+
+	result, err := w.chatCompletion(context.Background(), mockServer.Client(), precheckTarget{Endpoint: mockServer.URL}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "Paris.", result.Answer)
+	assert.Equal(t, 2, result.Attempts)
+}
+
+// TestRetryAfter verify the delay requested by the server is capped.
+func TestRetryAfter(t *testing.T) {
+	response := func(value string) *http.Response {
+		return &http.Response{Header: http.Header{"Retry-After": []string{value}}}
+	}
+	assert.Equal(t, time.Duration(0), retryAfter(response("")))
+	assert.Equal(t, time.Duration(0), retryAfter(response("-5")))
+	assert.Equal(t, 30*time.Second, retryAfter(response("30")))
+	assert.Equal(t, maxChatRetryBackoff, retryAfter(response("86400")))
+	assert.Equal(t, maxChatRetryBackoff, retryAfter(response("9223372036854775807")))
+}
+
+// TestRetryBackoff verify the backoff doubles per attempt and is capped
+func TestRetryBackoff(t *testing.T) {
+	saved := PrecheckRetryBackoff
+	PrecheckRetryBackoff = time.Second
+	defer func() { PrecheckRetryBackoff = saved }()
+
+	for attempt, base := range map[int]time.Duration{1: time.Second, 3: 4 * time.Second, 10: maxChatRetryBackoff} {
+		delay := retryBackoff(attempt)
+		assert.GreaterOrEqual(t, delay, base, "attempt %d", attempt)
+		assert.LessOrEqual(t, delay, base+base/5, "attempt %d", attempt)
+	}
+}
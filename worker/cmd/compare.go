@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const precheckComparisonFilename = "precheck_comparison.html"
+
+// precheckComparison holds the answers of every compared model to one question
+type precheckComparison struct {
+	File           string
+	Question       string
+	ExpectedAnswer string
+	Answers        map[string]string
+	// Issues are the answers that are empty or cut short, see answerIssue
+	Issues map[string]string
+}
+
+// splitModelNames parses the comma separated model list of a job
+func splitModelNames(models string) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(models, ",") {
+		name = strings.TrimSpace(name)
+		if name != "" && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// precheckTargets returns the models the precheck questions are sent to. Jobs without a model
+// list use the precheck endpoints of the worker.
+func (w *Worker) precheckTargets(modelName string) ([]precheckTarget, error) {
+	if len(w.models) == 0 {
+		target := newPrecheckTarget("", splitEndpoints(w.precheckEndpoint))
+		target.Model, target.APIKey = modelName, PrecheckAPIKey
+		if PrecheckBatchSize > 1 {
+			target.BatchSize = PrecheckBatchSize
+		}
+		if modelName == "unknown" {
+			target.Model = ""
+		}
+		return []precheckTarget{target}, nil
+	}
+
+	var targets []precheckTarget
+	for _, name := range w.models {
+		model, ok := precheckModels[name]
+		if !ok {
+			available := make([]string, 0, len(precheckModels))
+			for n := range precheckModels {
+				available = append(available, n)
+			}
+			sort.Strings(available)
+			return nil, fmt.Errorf("unknown precheck model %q, the configured models are: %s", name, strings.Join(available, ", "))
+		}
+		target := newPrecheckTarget(name, model.endpoints())
+		target.Model, target.APIKey = model.Model, model.APIKey
+		target.BatchSize = model.BatchSize
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
+
+// newPrecheckTarget returns a target served by the endpoints, the first one being its endpoint
+func newPrecheckTarget(name string, endpoints []string) precheckTarget {
+	target := precheckTarget{Name: name}
+	if len(endpoints) > 0 {
+		target.Endpoint = endpoints[0]
+	}
+	if len(endpoints) > 1 {
+		target.Endpoints = endpoints
+	}
+	return target
+}
+
+// writePrecheckComparison writes the side by side answers of the compared models into the output directory
+func writePrecheckComparison(outputDir string, models []string, rows []precheckComparison) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	reportFile, err := os.Create(filepath.Join(outputDir, precheckComparisonFilename))
+	if err != nil {
+		return fmt.Errorf("could not create %s: %w", precheckComparisonFilename, err)
+	}
+	defer reportFile.Close()
+	return generateComparisonHTML(reportFile, models, rows)
+}
@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// TestPrecheckTargets verify job model lists are resolved against the configured models.
+func TestPrecheckTargets(t *testing.T) {
+	saved := precheckModels
+	precheckModels = map[string]precheckModelConfig{
+		"granite":    {Endpoint: "https://granite.example.com/v1", Model: "granite-7b-lab"},
+		"merlinite":  {Endpoint: "https://merlinite.example.com/v1", Model: "merlinite-7b-lab", APIKey: "key"},
+		"unselected": {Endpoint: "https://other.example.com/v1"},
+	}
+	defer func() { precheckModels = saved }()
+
+	w := NewJobProcessor(context.Background(), nil, nil, zap.NewExample().Sugar(), "job-id",
+		"http://precheck.example.com/v1", "", "", "", "", 20)
+
+	targets, err := w.precheckTargets("unknown")
+	assert.NoError(t, err)
+	assert.Equal(t, []precheckTarget{{Endpoint: "http://precheck.example.com/v1"}}, targets)
+
+	w.models = splitModelNames(" granite, merlinite,granite,")
+	targets, err = w.precheckTargets("unknown")
+	assert.NoError(t, err)
+	if assert.Len(t, targets, 2) {
+		assert.Equal(t, "granite", targets[0].Name)
+		assert.Equal(t, "merlinite-7b-lab", targets[1].Model)
+		assert.Equal(t, "key", targets[1].APIKey)
+	}
+
+	w.models = []string{"mistral"}
+	_, err = w.precheckTargets("unknown")
+	assert.ErrorContains(t, err, "granite, merlinite, unselected")
+}
+
+// TestWritePrecheckComparison verify every model gets a column and missing or partial answers are marked.
+func TestWritePrecheckComparison(t *testing.T) {
+	dir := t.TempDir()
+	rows := []precheckComparison{
+		{File: "knowledge/a/qna.yaml", Question: "Q1", ExpectedAnswer: "A", Answers: map[string]string{"granite": "granite says", "merlinite": "merlinite says"}},
+		{File: "knowledge/a/qna.yaml", Question: "Q2", ExpectedAnswer: "B", Answers: map[string]string{"granite": "only granite"}, Issues: map[string]string{"granite": answerTruncated}},
+	}
+	assert.NoError(t, writePrecheckComparison(dir, []string{"granite", "merlinite"}, rows))
+
+	content, err := os.ReadFile(path.Join(dir, precheckComparisonFilename))
+	assert.NoError(t, err)
+	html := string(content)
+	assert.Contains(t, html, "<th>merlinite</th>")
+	assert.Contains(t, html, "merlinite says")
+	assert.Contains(t, html, "no answer")
+	assert.Contains(t, html, "truncated answer")
+	assert.Contains(t, html, "The comparison is partial: 2 answers are missing, empty or were cut short.")
+}
@@ -0,0 +1,248 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	complianceRuleAttribution    = "attribution"
+	complianceRuleLicense        = "license"
+	complianceRuleDocumentAccess = "document-access"
+
+	attributionFilename      = "attribution.txt"
+	complianceReportFilename = "compliance_report.json"
+	// complianceRepoTimeout bounds the anonymous listing of a document repo
+	complianceRepoTimeout = 30 * time.Second
+)
+
+// The fields of attribution.txt, each on its own `<field>: <value>` line
+const (
+	attributionTitle   = "Title of work"
+	attributionLink    = "Link to work"
+	attributionLicense = "License of the work"
+	attributionCreator = "Creator names"
+)
+
+// requiredAttributionFields must be filled in every attribution.txt
+var requiredAttributionFields = []string{attributionTitle, attributionLink, attributionLicense, attributionCreator}
+
+// attributionField is a field of attribution.txt and the line it is on
+type attributionField struct {
+	Value string
+	Line  int
+}
+
+// complianceReport is the result of the compliance checks of one knowledge taxonomy file
+type complianceReport struct {
+	TaxonomyFile string        `json:"taxonomy_file"`
+	Attribution  string        `json:"attribution"`
+	License      string        `json:"license,omitempty"`
+	Repo         string        `json:"repo,omitempty"`
+	Problems     []lintProblem `json:"problems,omitempty"`
+}
+
+// parseAttribution reads the `<field>: <value>` lines of attribution.txt, keyed by the lower
+// case field name. The first occurrence of a field wins.
+func parseAttribution(content []byte) map[string]attributionField {
+	fields := make(map[string]attributionField)
+	scanner := bufio.NewScanner(strings.NewReader(string(content)))
+	for line := 1; scanner.Scan(); line++ {
+		name, value, found := strings.Cut(scanner.Text(), ":")
+		if !found {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(name))
+		if _, ok := fields[key]; !ok {
+			fields[key] = attributionField{Value: strings.TrimSpace(value), Line: line}
+		}
+	}
+	return fields
+}
+
+// checkAttribution checks the required fields of the attribution file at attributionPath and
+// that its license is in the allowlist, an empty allowlist accepting any license
+func checkAttribution(attributionPath string, content []byte, allowlist []string) (string, []lintProblem) {
+	fields := parseAttribution(content)
+	var problems []lintProblem
+	for _, name := range requiredAttributionFields {
+		if fields[strings.ToLower(name)].Value != "" {
+			continue
+		}
+		problems = append(problems, lintProblem{
+			Path:    attributionPath,
+			Line:    1,
+			EndLine: 1,
+			Level:   lintLevelError,
+			Rule:    complianceRuleAttribution,
+			Message: fmt.Sprintf("%q is missing, add a `%s: ...` line", name, name),
+		})
+	}
+
+	license := fields[strings.ToLower(attributionLicense)]
+	if license.Value != "" && !licenseAllowed(license.Value, allowlist) {
+		problems = append(problems, lintProblem{
+			Path:    attributionPath,
+			Line:    license.Line,
+			EndLine: license.Line,
+			Level:   lintLevelError,
+			Rule:    complianceRuleLicense,
+			Message: fmt.Sprintf("license %s is not accepted, the document must be under one of %s", license.Value, strings.Join(allowlist, ", ")),
+		})
+	}
+	return license.Value, problems
+}
+
+// licenseAllowed compares the SPDX identifier of a license with the allowlist, ignoring case
+func licenseAllowed(license string, allowlist []string) bool {
+	if len(allowlist) == 0 {
+		return true
+	}
+	for _, allowed := range allowlist {
+		if strings.EqualFold(strings.TrimSpace(allowed), license) {
+			return true
+		}
+	}
+	return false
+}
+
+// yamlKeyLine returns the line of the first `key:` in a YAML file, 1 when there is none
+func yamlKeyLine(content []byte, key string) int {
+	for i, line := range strings.Split(string(content), "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), key+":") {
+			return i + 1
+		}
+	}
+	return 1
+}
+
+// checkDocumentRepo lists the references of a document repo without credentials, the repo must
+// be public for the documents to be fetched and credited
+func checkDocumentRepo(ctx context.Context, repoURL string) error {
+	u, err := url.Parse(repoURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return fmt.Errorf("document repo %s is not a public http(s) URL", repoURL)
+	}
+	ctx, cancel := context.WithTimeout(ctx, complianceRepoTimeout)
+	defer cancel()
+
+	remote := git.NewRemote(memory.NewStorage(), &config.RemoteConfig{Name: "origin", URLs: []string{repoURL}})
+	_, err = remote.ListContext(ctx, &git.ListOptions{})
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, transport.ErrAuthenticationRequired), errors.Is(err, transport.ErrAuthorizationFailed), errors.Is(err, transport.ErrRepositoryNotFound):
+		return fmt.Errorf("document repo %s is not publicly accessible (%v), make it public or host the documents in a public repo", repoURL, err)
+	default:
+		return fmt.Errorf("document repo %s could not be reached: %v", repoURL, err)
+	}
+}
+
+// checkCompliance verifies the attribution.txt next to each knowledge file, its license against
+// --compliance-licenses and that the document repo is public. The findings are written into the
+// output directory and annotated on the check run. An error is returned if any check failed.
+func (w *Worker) checkCompliance(knowledgeFiles []string, outputDir string) error {
+	if len(knowledgeFiles) == 0 {
+		return nil
+	}
+
+	start := time.Now()
+	repoErrs := make(map[string]error)
+	var reports []complianceReport
+	var annotations []lintProblem
+	var problems []string
+	for _, file := range knowledgeFiles {
+		report := complianceReport{
+			TaxonomyFile: file,
+			Attribution:  path.Join(path.Dir(file), attributionFilename),
+		}
+
+		content, err := os.ReadFile(filepath.Join(w.taxonomyDir, filepath.FromSlash(file)))
+		if err != nil {
+			return fmt.Errorf("could not read knowledge file %s: %w", file, err)
+		}
+
+		attribution, err := os.ReadFile(filepath.Join(w.taxonomyDir, filepath.FromSlash(report.Attribution)))
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			report.Problems = append(report.Problems, lintProblem{
+				Path:    file,
+				Line:    1,
+				EndLine: 1,
+				Level:   lintLevelError,
+				Rule:    complianceRuleAttribution,
+				Message: fmt.Sprintf("%s is missing, add it next to this file with the %s of the documents", report.Attribution, strings.Join(requiredAttributionFields, ", ")),
+			})
+		case err != nil:
+			return fmt.Errorf("could not read %s: %w", report.Attribution, err)
+		default:
+			var licenseProblems []lintProblem
+			report.License, licenseProblems = checkAttribution(report.Attribution, attribution, ComplianceLicenses)
+			report.Problems = append(report.Problems, licenseProblems...)
+		}
+
+		// A missing or unparsable document section is reported by checkKnowledgeDocuments
+		var qna struct {
+			Document knowledgeDocument `yaml:"document"`
+		}
+		if err := yaml.Unmarshal(content, &qna); err == nil && qna.Document.Repo != "" {
+			report.Repo = qna.Document.Repo
+			repoErr, checked := repoErrs[report.Repo]
+			if !checked {
+				w.logger.Infof("Checking that document repo %s is public", report.Repo)
+				repoErr = checkDocumentRepo(w.ctx, report.Repo)
+				repoErrs[report.Repo] = repoErr
+			}
+			if repoErr != nil {
+				line := yamlKeyLine(content, "repo")
+				report.Problems = append(report.Problems, lintProblem{
+					Path:    file,
+					Line:    line,
+					EndLine: line,
+					Level:   lintLevelError,
+					Rule:    complianceRuleDocumentAccess,
+					Message: repoErr.Error(),
+				})
+			}
+		}
+
+		for _, p := range report.Problems {
+			problems = append(problems, fmt.Sprintf("%s:%d: [%s] %s", p.Path, p.Line, p.Rule, p.Message))
+		}
+		annotations = append(annotations, report.Problems...)
+		reports = append(reports, report)
+	}
+	w.setMetric(metricComplianceErrors, float64(len(problems)))
+	w.setJobAnnotations(annotations)
+
+	reportJSON, err := json.MarshalIndent(reports, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not marshal compliance report: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(outputDir, complianceReportFilename), reportJSON, 0644); err != nil {
+		return fmt.Errorf("could not write compliance report: %w", err)
+	}
+
+	if len(problems) > 0 {
+		err := categorize(errorComplianceFailed, fmt.Errorf("knowledge compliance checks failed:\n%s", strings.Join(problems, "\n")))
+		w.logStep("compliance checks", start, err)
+		return err
+	}
+	w.logStep("compliance checks", start, nil)
+	return nil
+}
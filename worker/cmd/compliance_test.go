@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// TestCheckAttribution verify the required fields and the license allowlist of attribution.txt.
+func TestCheckAttribution(t *testing.T) {
+	allowlist := []string{"CC-BY-SA-4.0", "MIT"}
+	content := []byte("Title of work: Phoenix (constellation)\nLink to work: https://en.wikipedia.org/wiki/Phoenix_(constellation)\nRevision: https://en.wikipedia.org/w/index.php?oldid=1236190151\nLicense of the work: cc-by-sa-4.0\nCreator names: Wikipedia Authors\n")
+	license, problems := checkAttribution("knowledge/astronomy/attribution.txt", content, allowlist)
+	assert.Equal(t, "cc-by-sa-4.0", license)
+	assert.Empty(t, problems)
+
+	content = []byte("Title of work: Phoenix (constellation)\nLicense of the work: All rights reserved\n")
+	license, problems = checkAttribution("knowledge/astronomy/attribution.txt", content, allowlist)
+	assert.Equal(t, "All rights reserved", license)
+	if assert.Len(t, problems, 3) {
+		assert.Equal(t, complianceRuleAttribution, problems[0].Rule)
+		assert.Contains(t, problems[0].Message, `"Link to work" is missing`)
+		assert.Contains(t, problems[1].Message, `"Creator names" is missing`)
+		assert.Equal(t, complianceRuleLicense, problems[2].Rule)
+		assert.Equal(t, 2, problems[2].Line)
+		assert.Equal(t, "license All rights reserved is not accepted, the document must be under one of CC-BY-SA-4.0, MIT", problems[2].Message)
+	}
+
+	_, problems = checkAttribution("knowledge/astronomy/attribution.txt", content, nil)
+	assert.Len(t, problems, 2, "an empty allowlist accepts any license")
+}
+
+// TestCheckDocumentRepo negative test that private, missing and non http(s) document repos are rejected.
+func TestCheckDocumentRepo(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/private.git/info/refs" {
+			http.Error(w, "authentication required", http.StatusUnauthorized)
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	err := checkDocumentRepo(context.Background(), server.URL+"/private.git")
+	assert.ErrorContains(t, err, "is not publicly accessible")
+	err = checkDocumentRepo(context.Background(), server.URL+"/missing.git")
+	assert.ErrorContains(t, err, "is not publicly accessible")
+	err = checkDocumentRepo(context.Background(), "git@github.com:example/docs.git")
+	assert.ErrorContains(t, err, "is not a public http(s) URL")
+}
+
+// TestCheckCompliance verify the findings are annotated next to the lint ones and fail the job.
+func TestCheckCompliance(t *testing.T) {
+	taxonomyDir := t.TempDir()
+	for file, content := range map[string]string{
+		"knowledge/astronomy/qna.yaml":        "version: 3\ndocument:\n  repo: git@github.com:example/docs.git\n  commit: abc123\n",
+		"knowledge/astronomy/attribution.txt": "Title of work: Phoenix\nLink to work: https://example.com\nLicense of the work: CC-BY-4.0\nCreator names: Example Authors\n",
+		"knowledge/history/qna.yaml":          "version: 3\n",
+	} {
+		assert.NoError(t, os.MkdirAll(filepath.Join(taxonomyDir, filepath.Dir(file)), 0755))
+		assert.NoError(t, os.WriteFile(filepath.Join(taxonomyDir, file), []byte(content), 0644))
+	}
+
+	w := NewJobProcessor(context.Background(), nil, nil, zap.NewExample().Sugar(), "job-id", "", "", "", "", "", 20)
+	w.taxonomyDir = taxonomyDir
+	w.setJobAnnotations([]lintProblem{{Path: "knowledge/history/qna.yaml", Line: 1, Rule: lintRuleSyntax}})
+	outputDir := t.TempDir()
+	err := w.checkCompliance([]string{"knowledge/astronomy/qna.yaml", "knowledge/history/qna.yaml"}, outputDir)
+	assert.ErrorContains(t, err, "knowledge/astronomy/qna.yaml:3: [document-access]")
+	assert.ErrorContains(t, err, "knowledge/history/qna.yaml:1: [attribution] knowledge/history/attribution.txt is missing")
+	assert.Equal(t, errorComplianceFailed, errorCategoryOf(err))
+	assert.Equal(t, 2.0, w.metrics[metricComplianceErrors])
+	if assert.Len(t, w.annotations, 3) {
+		assert.Equal(t, lintRuleSyntax, w.annotations[0].Rule)
+		assert.Equal(t, complianceRuleDocumentAccess, w.annotations[1].Rule)
+		assert.Equal(t, complianceRuleAttribution, w.annotations[2].Rule)
+	}
+
+	var reports []complianceReport
+	content, err := os.ReadFile(filepath.Join(outputDir, complianceReportFilename))
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(content, &reports))
+	if assert.Len(t, reports, 2) {
+		assert.Equal(t, "CC-BY-4.0", reports[0].License)
+		assert.Equal(t, "git@github.com:example/docs.git", reports[0].Repo)
+	}
+}
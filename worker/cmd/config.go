@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// precheckModelConfig is a named model precheck questions can be sent to
+type precheckModelConfig struct {
+	Endpoint string `yaml:"endpoint"`
+	// Endpoints also serve the model, the questions are spread over them and fail over between them
+	Endpoints []string `yaml:"endpoints"`
+	Model     string   `yaml:"model"`
+	APIKey    string   `yaml:"api_key"`
+	// BatchSize sends that many questions per request to endpoints supporting batch inference
+	BatchSize int `yaml:"batch_size"`
+}
+
+// endpoints are the endpoint of the model followed by its other endpoints
+func (m precheckModelConfig) endpoints() []string {
+	return splitEndpoints(strings.Join(append([]string{m.Endpoint}, m.Endpoints...), ","))
+}
+
+// sdgRouteConfig sends the taxonomy files under a path prefix to a dedicated SDG endpoint or model
+type sdgRouteConfig struct {
+	Prefix   string `yaml:"prefix"`
+	Endpoint string `yaml:"endpoint"`
+	Model    string `yaml:"model"`
+}
+
+// workerConfig is the part of the worker config file that can't be expressed as flags
+type workerConfig struct {
+	PromptTemplates promptTemplateConfig           `yaml:"prompt_templates"`
+	PrecheckModels  map[string]precheckModelConfig `yaml:"precheck_models"`
+	SdgRoutes       []sdgRouteConfig               `yaml:"sdg_routes"`
+	SubprocessEnv   map[string]subprocessEnvConfig `yaml:"subprocess_env"`
+	IlabContainers  map[string]containerConfig     `yaml:"ilab_containers"`
+	IlabKubernetes  map[string]kubernetesConfig    `yaml:"ilab_kubernetes"`
+	// RedactEnv are variables whose values are masked in the logs, the job metadata and the artifacts
+	RedactEnv []string     `yaml:"redact_env"`
+	Report    reportConfig `yaml:"report"`
+}
+
+// precheckModels are the models available to `precheck --models`, keyed by name
+var precheckModels map[string]precheckModelConfig
+
+// sdgRoutes are checked in order, the first one matching a taxonomy file routes it
+var sdgRoutes []sdgRouteConfig
+
+// readWorkerConfig reads the worker config file, a missing file is an empty config
+func readWorkerConfig(configPath string) (*workerConfig, error) {
+	cfg := &workerConfig{}
+	if configPath == "" {
+		return cfg, nil
+	}
+	content, err := os.ReadFile(configPath)
+	if os.IsNotExist(err) {
+		return cfg, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("could not read worker config %s: %w", configPath, err)
+	}
+	if err := yaml.Unmarshal(content, cfg); err != nil {
+		return nil, fmt.Errorf("could not parse worker config %s: %w", configPath, err)
+	}
+
+	for name, model := range cfg.PrecheckModels {
+		if len(model.endpoints()) == 0 {
+			return nil, fmt.Errorf("precheck model %q in %s has no endpoint", name, configPath)
+		}
+	}
+	for i, route := range cfg.SdgRoutes {
+		if route.Prefix == "" {
+			return nil, fmt.Errorf("SDG route %d in %s has no prefix", i+1, configPath)
+		}
+		if route.Endpoint == "" && route.Model == "" {
+			return nil, fmt.Errorf("SDG route %q in %s sets neither an endpoint nor a model", route.Prefix, configPath)
+		}
+	}
+	if err := validateSubprocessEnv(cfg.SubprocessEnv); err != nil {
+		return nil, fmt.Errorf("%s: %w", configPath, err)
+	}
+	if err := validateContainers(cfg.IlabContainers); err != nil {
+		return nil, fmt.Errorf("%s: %w", configPath, err)
+	}
+	if err := validateKubernetes(cfg.IlabKubernetes); err != nil {
+		return nil, fmt.Errorf("%s: %w", configPath, err)
+	}
+	return cfg, nil
+}
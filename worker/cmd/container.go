@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	containerRuntimePodman = "podman"
+	containerRuntimeDocker = "docker"
+	// containerStopTimeout is how long a container is given to exit when its job is cancelled
+	containerStopTimeout = 10 * time.Second
+)
+
+// containerEnvSkipped are the variables of the worker that describe the host, the image sets its own
+var containerEnvSkipped = []string{"PATH", "SHELL", "TERM", "VIRTUAL_ENV", "LOGNAME", "USER", "HOSTNAME"}
+
+// containerConfig runs the ilab commands of a job type in a container of image, with the work
+// and taxonomy directories mounted at the same paths as on the host
+type containerConfig struct {
+	// Runtime is podman or docker, defaults to podman
+	Runtime string `yaml:"runtime"`
+	Image   string `yaml:"image"`
+	// GPUs passed to the container, all or a comma separated list of device indexes. Empty passes none.
+	GPUs string `yaml:"gpus"`
+	// Volumes are extra host:container[:options] mounts
+	Volumes []string `yaml:"volumes"`
+	// Args are extra arguments of the run command, for example --userns=keep-id
+	Args []string `yaml:"args"`
+}
+
+// ilabContainers are keyed by job type, the default config applies to the job types without one
+var ilabContainers map[string]containerConfig
+
+// validateContainers checks the container configs are keyed by job type and name an image
+func validateContainers(containers map[string]containerConfig) error {
+	for key, cfg := range containers {
+		switch key {
+		case defaultEnvPolicy, jobGenerateLocal, jobPreCheck, jobSDG, jobTrain, jobEvaluate:
+		default:
+			return fmt.Errorf("unknown job type %q in ilab_containers", key)
+		}
+		if cfg.Image == "" {
+			return fmt.Errorf("ilab_containers %s has no image", key)
+		}
+		switch cfg.Runtime {
+		case "", containerRuntimePodman, containerRuntimeDocker:
+		default:
+			return fmt.Errorf("unknown container runtime %q in ilab_containers %s, expected %s or %s",
+				cfg.Runtime, key, containerRuntimePodman, containerRuntimeDocker)
+		}
+	}
+	return nil
+}
+
+func (c containerConfig) runtime() string {
+	if c.Runtime == "" {
+		return containerRuntimePodman
+	}
+	return c.Runtime
+}
+
+// runArgs returns the arguments of the runtime running the ilab command args in dir. env is
+// passed by name, so the values are read from the environment of the runtime.
+func (c containerConfig) runArgs(name, dir string, mounts, env, args []string) []string {
+	runArgs := []string{"run", "--rm", "--name", name, "--workdir", dir}
+	for _, mount := range mounts {
+		runArgs = append(runArgs, "--volume", mount+":"+mount)
+	}
+	for _, volume := range c.Volumes {
+		runArgs = append(runArgs, "--volume", volume)
+	}
+	if c.GPUs != "" {
+		if c.runtime() == containerRuntimeDocker {
+			gpus := c.GPUs
+			if gpus != "all" {
+				gpus = fmt.Sprintf(`"device=%s"`, gpus)
+			}
+			runArgs = append(runArgs, "--gpus", gpus)
+		} else {
+			for _, device := range strings.Split(c.GPUs, ",") {
+				runArgs = append(runArgs, "--device", "nvidia.com/gpu="+strings.TrimSpace(device))
+			}
+		}
+	}
+	for _, kv := range env {
+		if name, _, _ := strings.Cut(kv, "="); !matchesEnv(containerEnvSkipped, name) {
+			runArgs = append(runArgs, "--env", name)
+		}
+	}
+	runArgs = append(runArgs, c.Args...)
+	runArgs = append(runArgs, c.Image, "ilab")
+	return append(runArgs, args...)
+}
+
+// containerExecutor runs the ilab commands in a container, with the work and taxonomy directories
+// mounted at the same paths as on the host
+type containerExecutor struct {
+	cfg containerConfig
+}
+
+func (e containerExecutor) command(c *ilabCommand) *exec.Cmd {
+	w := c.w
+	env := w.subprocessEnv()
+	dir := c.dir
+	if dir == "" {
+		dir, _ = os.Getwd()
+	}
+	mounts := []string{dir}
+	for _, mount := range []string{WorkDir, w.taxonomyDir, w.jobHome} {
+		if mount == "" {
+			continue
+		}
+		if abs, err := filepath.Abs(mount); err == nil && !containsPath(mounts, abs) {
+			mounts = append(mounts, abs)
+		}
+	}
+
+	name := fmt.Sprintf("ilab-job-%s-%d", w.job, time.Now().UnixNano())
+	runtime := e.cfg.runtime()
+	cmd := exec.CommandContext(w.ctx, runtime, e.cfg.runArgs(name, dir, mounts, env, c.args)...)
+	cmd.Env = env
+	cmd.Stdout = c.Stdout
+	cmd.Stderr = c.Stderr
+	// Killing the runtime client leaves the container running, stop it first
+	cmd.Cancel = func() error {
+		stop := exec.Command(runtime, "stop", "--time", fmt.Sprintf("%d", int(containerStopTimeout.Seconds())), name)
+		if err := stop.Run(); err != nil {
+			w.logger.Errorf("Could not stop container %s: %v", name, err)
+		}
+		return cmd.Process.Kill()
+	}
+	return cmd
+}
+
+func (e containerExecutor) run(c *ilabCommand) error {
+	return e.command(c).Run()
+}
+
+func (e containerExecutor) describe(c *ilabCommand) string {
+	return e.command(c).String()
+}
+
+// containsPath reports whether path is one of the dirs or inside one of them
+func containsPath(dirs []string, path string) bool {
+	for _, dir := range dirs {
+		if rel, err := filepath.Rel(dir, path); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
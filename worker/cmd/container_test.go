@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestContainerRunArgs verify the ilab command runs in the image with the directories, GPUs and environment of the job.
+func TestContainerRunArgs(t *testing.T) {
+	env := []string{"PATH=/usr/bin", "HOME=/home/worker", "HF_TOKEN=hf"}
+	podman := containerConfig{Image: "ghcr.io/instructlab/instructlab:v0.16", GPUs: "0,1", Args: []string{"--userns=keep-id"}}
+	assert.Equal(t, []string{
+		"run", "--rm", "--name", "ilab-job-1", "--workdir", "/work",
+		"--volume", "/work:/work", "--volume", "/taxonomy:/taxonomy",
+		"--device", "nvidia.com/gpu=0", "--device", "nvidia.com/gpu=1",
+		"--env", "HOME", "--env", "HF_TOKEN",
+		"--userns=keep-id",
+		"ghcr.io/instructlab/instructlab:v0.16", "ilab", "train", "--num-epochs", "1",
+	}, podman.runArgs("ilab-job-1", "/work", []string{"/work", "/taxonomy"}, env, []string{"train", "--num-epochs", "1"}))
+
+	docker := containerConfig{Runtime: containerRuntimeDocker, Image: "ilab:latest", GPUs: "all", Volumes: []string{"/models:/models:ro"}}
+	assert.Equal(t, []string{
+		"run", "--rm", "--name", "ilab-job-2", "--workdir", "/work",
+		"--volume", "/work:/work", "--volume", "/models:/models:ro",
+		"--gpus", "all",
+		"ilab:latest", "ilab", "diff",
+	}, docker.runArgs("ilab-job-2", "/work", []string{"/work"}, nil, []string{"diff"}))
+
+	docker.GPUs = "0,1"
+	assert.Contains(t, docker.runArgs("ilab-job-3", "/work", nil, nil, nil), `"device=0,1"`)
+}
+
+// TestValidateContainers verify the container configs are keyed by job type and name an image and a known runtime.
+func TestValidateContainers(t *testing.T) {
+	containers := map[string]containerConfig{
+		defaultEnvPolicy: {Image: "ilab:default"},
+		jobTrain:         {Image: "ilab:train"},
+	}
+	assert.NoError(t, validateContainers(containers))
+	assert.Error(t, validateContainers(map[string]containerConfig{jobTrain: {}}))
+	assert.Error(t, validateContainers(map[string]containerConfig{"unknown": {Image: "ilab"}}))
+	assert.Error(t, validateContainers(map[string]containerConfig{jobTrain: {Image: "ilab", Runtime: "lxc"}}))
+}
+
+// TestContainerCommand verify the ilab command runs in the runtime with the work directory mounted once.
+func TestContainerCommand(t *testing.T) {
+	w := &Worker{ctx: context.Background(), job: "7", jobType: jobTrain, taxonomyDir: "/work/taxonomy"}
+	c := &ilabCommand{w: w, lab: "/venv/bin/ilab", dir: "/work", args: []string{"train"}}
+	cmd := containerExecutor{cfg: containerConfig{Image: "ilab:train"}}.command(c)
+	assert.Equal(t, "podman", cmd.Args[0])
+	// The taxonomy is inside the work directory, which is only mounted once
+	volumes := 0
+	for _, arg := range cmd.Args {
+		if arg == "--volume" {
+			volumes++
+		}
+	}
+	assert.Equal(t, 1, volumes)
+	assert.Equal(t, []string{"--volume", "/work:/work"}, cmd.Args[7:9])
+	assert.Equal(t, []string{"ilab:train", "ilab", "train"}, cmd.Args[len(cmd.Args)-3:])
+	assert.NotNil(t, cmd.Cancel)
+}
@@ -0,0 +1,230 @@
+package cmd
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/instructlab/instructlab-bot/pkg/controlplane"
+	"github.com/instructlab/instructlab-bot/pkg/jobqueue"
+	"go.uber.org/zap"
+)
+
+// controlPlaneRetryBackoff is the first delay before reconnecting to the control plane, doubled on
+// every failure
+const controlPlaneRetryBackoff = time.Second
+
+// controlPlane receives the jobs of the worker from the gRPC control plane of the bot instead of
+// polling the Redis job queue, with their fields, and reports their progress and results through
+// it. Redis only holds the state shared between the jobs: the precheck answer cache and history,
+// the data of the generate jobs trained on, and the stages of the pipelines.
+type controlPlane struct {
+	client   *controlplane.Client
+	name     string
+	logger   *zap.SugaredLogger
+	workerID string
+}
+
+// newControlPlane connects to the control plane at ControlPlaneAddr, with mutual TLS when the
+// worker has a certificate
+func newControlPlane(name string, logger *zap.SugaredLogger) (*controlPlane, error) {
+	var tlsConfig *tls.Config
+	if ControlPlaneTLSCert != "" {
+		var err error
+		tlsConfig, err = controlplane.ClientTLSConfig(ControlPlaneTLSCert, ControlPlaneTLSKey, ControlPlaneTLSCA)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		logger.Warn("Connecting to the control plane without TLS, set --control-plane-tls-cert outside of local development")
+	}
+	client, err := controlplane.NewClient(ControlPlaneAddr, tlsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to the control plane at %s: %w", ControlPlaneAddr, err)
+	}
+	return &controlPlane{client: client, name: name, logger: logger}, nil
+}
+
+func (c *controlPlane) Close() error {
+	return c.client.Close()
+}
+
+// run processes the jobs of the control plane until stopChan is closed, the job running then
+// finishes first
+func (c *controlPlane) run(ctx context.Context, wg *sync.WaitGroup, stopChan <-chan struct{}, queue *jobqueue.Client, svc *s3.Client, logger *zap.SugaredLogger) {
+	defer wg.Done()
+	listenCtx, stopListening := context.WithCancel(ctx)
+	defer stopListening()
+	go func() {
+		<-stopChan
+		stopListening()
+	}()
+	logger.Infof("Receiving jobs from the control plane at %s", ControlPlaneAddr)
+	c.listen(listenCtx, func(assignment *controlplane.JobAssignment) {
+		w := NewJobProcessor(ctx, queue, svc, logger, assignment.JobID,
+			PreCheckEndpointURL,
+			SdgEndpointURL,
+			TlsClientCertPath,
+			TlsClientKeyPath,
+			TlsServerCaCertPath,
+			MaxSeed)
+		w.control = c
+		w.jobFields = assignment.Fields
+		if w.jobFields == nil {
+			w.jobFields = make(map[jobqueue.Field]string)
+		}
+		w.processJob()
+		w.closeControlPlaneProgress()
+	})
+	logger.Info("Shutting down job listener")
+}
+
+// workerName is the name the worker registers with, --worker-name or the hostname
+func workerName() string {
+	if WorkerName != "" {
+		return WorkerName
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		return hostname
+	}
+	return "worker"
+}
+
+// listen runs the jobs the bot assigns to the worker one at a time, until ctx is done. It
+// registers again when the bot restarted and reconnects, backing off, when the bot is unreachable.
+func (c *controlPlane) listen(ctx context.Context, process func(*controlplane.JobAssignment)) {
+	failures := 0
+	for ctx.Err() == nil {
+		jobs, err := c.serveJobs(ctx, process)
+		if ctx.Err() != nil {
+			return
+		}
+		if jobs > 0 {
+			failures = 0
+		}
+		if controlplane.IsUnknownWorker(err) {
+			c.logger.Info("The control plane forgot the worker, registering again")
+			c.workerID = ""
+			continue
+		}
+		failures++
+		delay := backoffDelay(controlPlaneRetryBackoff, failures)
+		c.logger.Errorf("Lost the control plane, retrying in %s: %v", delay.Round(time.Second), err)
+		select {
+		case <-ctx.Done():
+		case <-time.After(delay):
+		}
+	}
+}
+
+// serveJobs registers the worker if needed and asks for jobs until the stream fails, it returns
+// the number of jobs it ran
+func (c *controlPlane) serveJobs(ctx context.Context, process func(*controlplane.JobAssignment)) (int, error) {
+	if c.workerID == "" {
+		resp, err := c.client.Register(ctx, &controlplane.RegisterRequest{Worker: c.name, Version: versionString()})
+		if err != nil {
+			return 0, fmt.Errorf("could not register: %w", err)
+		}
+		c.workerID = resp.WorkerID
+		c.logger.Infof("Registered with the control plane as %s", c.workerID)
+	}
+	stream, err := c.client.Jobs(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer stream.Close()
+	for jobs := 0; ; jobs++ {
+		assignment, err := stream.Next(c.workerID)
+		if err != nil {
+			return jobs, err
+		}
+		process(assignment)
+	}
+}
+
+// jobProgress opens the stream the progress of a job is sent on
+func (c *controlPlane) jobProgress(ctx context.Context) (*controlplane.ProgressClient, error) {
+	return c.client.Progress(ctx)
+}
+
+// complete reports the results of a job, the bot sets them on the job and queues it to be reported
+func (c *controlPlane) complete(ctx context.Context, jobID string, fields map[jobqueue.Field]interface{}) error {
+	return c.client.Complete(ctx, &controlplane.ResultRequest{
+		WorkerID: c.workerID,
+		JobID:    jobID,
+		Fields:   controlplane.FieldValues(fields),
+	})
+}
+
+// completeJob sets the result fields of the job and queues it for the bot, through the control
+// plane when the worker is dispatched by it, with the fields the job set while it ran
+func (w *Worker) completeJob(fields map[jobqueue.Field]interface{}) error {
+	if w.control != nil {
+		results := make(map[jobqueue.Field]interface{}, len(w.resultFields)+len(fields))
+		for field, value := range w.resultFields {
+			results[field] = value
+		}
+		for field, value := range fields {
+			results[field] = value
+		}
+		return w.control.complete(w.ctx, w.job, results)
+	}
+	return w.queue.Complete(w.ctx, w.job, fields)
+}
+
+// jobField reads a field of the job, from its assignment when the control plane dispatched it
+func (w *Worker) jobField(field jobqueue.Field) (string, error) {
+	if w.jobFields != nil {
+		return w.jobFields[field], nil
+	}
+	return w.queue.Get(w.ctx, w.job, field)
+}
+
+// setJobField sets a field of the job, sent with its results when the control plane dispatched it
+func (w *Worker) setJobField(field jobqueue.Field, value interface{}) error {
+	if w.control != nil {
+		if w.resultFields == nil {
+			w.resultFields = make(map[jobqueue.Field]interface{})
+		}
+		w.resultFields[field] = value
+		return nil
+	}
+	return w.queue.Set(w.ctx, w.job, field, value)
+}
+
+// sendControlPlaneProgress sends the progress of the job on its progress stream, opened by the
+// first update
+func (w *Worker) sendControlPlaneProgress(progressJSON []byte) error {
+	if w.progressStream == nil {
+		stream, err := w.control.jobProgress(w.ctx)
+		if err != nil {
+			return err
+		}
+		w.progressStream = stream
+	}
+	err := w.progressStream.Send(&controlplane.ProgressUpdate{
+		WorkerID: w.control.workerID,
+		JobID:    w.job,
+		Progress: string(progressJSON),
+	})
+	if err != nil {
+		// The next update opens a new stream
+		w.progressStream = nil
+	}
+	return err
+}
+
+// closeControlPlaneProgress closes the progress stream of the job, once it is done
+func (w *Worker) closeControlPlaneProgress() {
+	if w.progressStream == nil {
+		return
+	}
+	if _, err := w.progressStream.CloseAndRecv(); err != nil {
+		w.logger.Warnf("Could not close the progress stream of job %s: %v", w.job, err)
+	}
+	w.progressStream = nil
+}
@@ -0,0 +1,166 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/instructlab/instructlab-bot/pkg/controlplane"
+	"github.com/instructlab/instructlab-bot/pkg/jobqueue"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// fakeControlPlaneQueue hands out its jobs once and records what the control plane writes back
+type fakeControlPlaneQueue struct {
+	mu       sync.Mutex
+	jobs     []string
+	progress map[string]string
+	// updates counts the progress updates of every job
+	updates map[string]int
+	results map[string]map[jobqueue.Field]interface{}
+}
+
+func (q *fakeControlPlaneQueue) DequeueWait(ctx context.Context, timeout time.Duration) (string, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.jobs) == 0 {
+		q.mu.Unlock()
+		select {
+		case <-ctx.Done():
+		case <-time.After(timeout):
+		}
+		q.mu.Lock()
+		return "", nil
+	}
+	job := q.jobs[0]
+	q.jobs = q.jobs[1:]
+	return job, nil
+}
+
+func (q *fakeControlPlaneQueue) Requeue(ctx context.Context, jobID string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.jobs = append([]string{jobID}, q.jobs...)
+	return nil
+}
+
+func (q *fakeControlPlaneQueue) Start(ctx context.Context, jobID string, fields map[jobqueue.Field]interface{}) error {
+	return nil
+}
+
+func (q *fakeControlPlaneQueue) Fields(ctx context.Context, jobID string, fields []jobqueue.Field) (map[jobqueue.Field]string, error) {
+	return map[jobqueue.Field]string{jobqueue.FieldJobType: "precheck", jobqueue.FieldPRNumber: jobID}, nil
+}
+
+func (q *fakeControlPlaneQueue) Set(ctx context.Context, jobID string, field jobqueue.Field, value interface{}) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.progress[jobID] = value.(string)
+	q.updates[jobID]++
+	return nil
+}
+
+func (q *fakeControlPlaneQueue) Complete(ctx context.Context, jobID string, fields map[jobqueue.Field]interface{}) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.results[jobID] = fields
+	return nil
+}
+
+func (q *fakeControlPlaneQueue) Maintenance(ctx context.Context) (*jobqueue.Maintenance, error) {
+	return nil, nil
+}
+
+// startFakeControlPlane serves a control plane handing out the jobs, and connects a worker to it
+func startFakeControlPlane(t *testing.T, jobs ...string) (*fakeControlPlaneQueue, *controlPlane) {
+	queue := &fakeControlPlaneQueue{
+		jobs:     jobs,
+		progress: make(map[string]string),
+		updates:  make(map[string]int),
+		results:  make(map[string]map[jobqueue.Field]interface{}),
+	}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := controlplane.NewGRPCServer(controlplane.NewQueueServer(queue))
+	go func() { _ = server.Serve(lis) }()
+	t.Cleanup(server.Stop)
+
+	ControlPlaneAddr = lis.Addr().String()
+	t.Cleanup(func() { ControlPlaneAddr = "" })
+	control, err := newControlPlane("gpu", zap.NewNop().Sugar())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = control.Close() })
+	return queue, control
+}
+
+// TestControlPlaneListen verify the worker runs the jobs pushed by the control plane with their
+// fields, and reports their progress and results through it rather than Redis.
+func TestControlPlaneListen(t *testing.T) {
+	queue, control := startFakeControlPlane(t, "3", "4")
+	logger := zap.NewNop().Sugar()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var ran []string
+	control.listen(ctx, func(assignment *controlplane.JobAssignment) {
+		job := assignment.JobID
+		w := &Worker{ctx: ctx, logger: logger, job: job, control: control, jobFields: assignment.Fields}
+		prNumber, err := w.jobField(jobqueue.FieldPRNumber)
+		assert.NoError(t, err)
+		assert.Equal(t, job, prNumber)
+		assert.NoError(t, w.setJobField(jobqueue.FieldSummary, "summary of "+job))
+		w.setJobProgress(jobProgress{Done: 1, Total: 2})
+		assert.NoError(t, w.completeJob(map[jobqueue.Field]interface{}{jobqueue.FieldStatus: jobqueue.StatusSuccess}))
+		w.closeControlPlaneProgress()
+		ran = append(ran, job)
+		if len(ran) == 2 {
+			cancel()
+		}
+	})
+
+	assert.Equal(t, []string{"3", "4"}, ran)
+	assert.Equal(t, "gpu-1", control.workerID)
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+	assert.Contains(t, queue.progress["4"], `"done":1,"total":2`)
+	assert.Equal(t, jobqueue.StatusSuccess, queue.results["3"][jobqueue.FieldStatus])
+	assert.Equal(t, jobqueue.StatusSuccess, queue.results["4"][jobqueue.FieldStatus])
+	assert.Equal(t, "summary of 4", queue.results["4"][jobqueue.FieldSummary])
+}
+
+// TestJobHeartbeat verify a job without progress updates still sends its heartbeat, keeping the
+// last progress it published.
+func TestJobHeartbeat(t *testing.T) {
+	defer func(interval time.Duration) { jobHeartbeatInterval = interval }(jobHeartbeatInterval)
+	jobHeartbeatInterval = 20 * time.Millisecond
+	queue, control := startFakeControlPlane(t, "5")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	control.listen(ctx, func(assignment *controlplane.JobAssignment) {
+		w := &Worker{ctx: ctx, logger: zap.NewNop().Sugar(), job: assignment.JobID, control: control, jobFields: assignment.Fields}
+		w.setJobProgress(jobProgress{Done: 2, Total: 3})
+		stop := w.startHeartbeat()
+		assert.Eventually(t, func() bool {
+			queue.mu.Lock()
+			defer queue.mu.Unlock()
+			return queue.updates["5"] >= 3
+		}, 5*time.Second, 10*time.Millisecond)
+		stop()
+		w.closeControlPlaneProgress()
+		cancel()
+	})
+
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+	var progress jobProgress
+	require.NoError(t, json.Unmarshal([]byte(queue.progress["5"]), &progress))
+	assert.Equal(t, 2, progress.Done)
+	assert.Equal(t, 3, progress.Total)
+	assert.NotZero(t, progress.UpdatedAt)
+}
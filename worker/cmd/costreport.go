@@ -0,0 +1,435 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/instructlab/instructlab-bot/pkg/jobqueue"
+	"github.com/spf13/cobra"
+)
+
+const (
+	costReportTable    = "table"
+	costReportCSV      = "csv"
+	costReportJSON     = "json"
+	costReportMarkdown = "markdown"
+	// costReportTimeout bounds the requests posting the report
+	costReportTimeout = 30 * time.Second
+)
+
+var (
+	CostReportPeriod       time.Duration
+	CostReportSince        string
+	CostReportUntil        string
+	CostReportFormat       string
+	CostReportOutput       string
+	CostReportCostPerHour  float64
+	CostReportCurrency     string
+	CostReportSlackWebhook string
+	CostReportIssue        string
+	CostReportGithubToken  string
+	CostReportGithubAPIURL string
+)
+
+// trackingIssuePattern matches the owner/repo#number of the issue a report is commented on
+var trackingIssuePattern = regexp.MustCompile(`^([\w.-]+)/([\w.-]+)#(\d+)$`)
+
+func init() {
+	costReportCmd.Flags().DurationVarP(&CostReportPeriod, "period", "", 7*24*time.Hour, "Period the report covers, ending at --until")
+	costReportCmd.Flags().StringVarP(&CostReportSince, "since", "", "", "Start of the report, a date or an RFC 3339 time. Overrides --period")
+	costReportCmd.Flags().StringVarP(&CostReportUntil, "until", "", "", "End of the report, a date or an RFC 3339 time. Defaults to now")
+	costReportCmd.Flags().StringVarP(&CostReportFormat, "format", "", costReportTable, "Format of the report: table, csv, json or markdown")
+	costReportCmd.Flags().StringVarP(&CostReportOutput, "output", "", "", "File the report is written to. Defaults to stdout")
+	costReportCmd.Flags().Float64VarP(&CostReportCostPerHour, "cost-per-hour", "", 0, "Price of an hour of job compute time, added to the token cost of the jobs")
+	costReportCmd.Flags().StringVarP(&CostReportCurrency, "cost-currency", "", "USD", "Currency of --cost-per-hour")
+	costReportCmd.Flags().StringVarP(&CostReportSlackWebhook, "slack-webhook-url", "", "", "Slack incoming webhook the report is posted to")
+	costReportCmd.Flags().StringVarP(&CostReportIssue, "tracking-issue", "", "", "GitHub issue the report is commented on, as owner/repo#number")
+	costReportCmd.Flags().StringVarP(&CostReportGithubToken, "github-token", "g", "", "GitHub token commenting on --tracking-issue")
+	costReportCmd.Flags().StringVarP(&CostReportGithubAPIURL, "github-api-url", "", "https://api.github.com", "URL of the GitHub API")
+	rootCmd.AddCommand(costReportCmd)
+}
+
+var costReportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Report the jobs, compute time, token usage and estimated cost per repository, user and job type.",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		if CostReportGithubToken == "" {
+			CostReportGithubToken = os.Getenv("ILWORKER_GITHUB_TOKEN")
+		}
+		since, until, err := costReportRange(time.Now(), CostReportSince, CostReportUntil, CostReportPeriod)
+		if err != nil {
+			return err
+		}
+		switch CostReportFormat {
+		case costReportTable, costReportCSV, costReportJSON, costReportMarkdown:
+		default:
+			return fmt.Errorf("invalid format %q, expected table, csv, json or markdown", CostReportFormat)
+		}
+
+		queue := jobqueue.NewClient(RedisHost)
+		defer queue.Close()
+		jobs, err := readJobHistory(ctx, queue, since, until)
+		if err != nil {
+			return err
+		}
+		report := newCostReport(since, until, jobs, CostReportCostPerHour, CostReportCurrency)
+
+		out := io.Writer(os.Stdout)
+		if CostReportOutput != "" {
+			f, err := os.Create(CostReportOutput)
+			if err != nil {
+				return fmt.Errorf("could not create report %s: %w", CostReportOutput, err)
+			}
+			defer f.Close()
+			out = f
+		}
+		if err := report.write(out, CostReportFormat); err != nil {
+			return err
+		}
+
+		if CostReportSlackWebhook != "" {
+			if err := postSlackReport(ctx, CostReportSlackWebhook, report); err != nil {
+				return err
+			}
+		}
+		if CostReportIssue != "" {
+			if err := commentReportOnIssue(ctx, CostReportGithubAPIURL, CostReportGithubToken, CostReportIssue, report); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+// costReportRange returns the time range of the report, since defaulting to the period before until
+func costReportRange(now time.Time, since, until string, period time.Duration) (time.Time, time.Time, error) {
+	end := now
+	if until != "" {
+		t, err := parseReportTime(until)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid --until: %w", err)
+		}
+		end = t
+	}
+	start := end.Add(-period)
+	if since != "" {
+		t, err := parseReportTime(since)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid --since: %w", err)
+		}
+		start = t
+	}
+	if !start.Before(end) {
+		return time.Time{}, time.Time{}, fmt.Errorf("the report starts at %s, after its end %s", start.Format(time.RFC3339), end.Format(time.RFC3339))
+	}
+	return start, end, nil
+}
+
+// parseReportTime accepts a date, midnight UTC, or an RFC 3339 time
+func parseReportTime(value string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// jobRecord is a finished job of the history
+type jobRecord struct {
+	ID          string
+	Repo        string
+	User        string
+	JobType     string
+	Failed      bool
+	RequestTime time.Time
+	// Duration is unknown for the jobs that never ran, such as the later stages of a failed pipeline
+	Duration time.Duration
+	Usage    *jobUsage
+	// AreaScores are the scores per taxonomy file of the prechecks and branch evaluations
+	AreaScores map[string]fileScore
+}
+
+// jobHistoryKeys are the keys of a job read by the report, in the order of parseJobRecord
+var jobHistoryKeys = []jobqueue.Field{
+	jobqueue.FieldRequestTime, jobqueue.FieldDuration, jobqueue.FieldJobType, jobqueue.FieldRepoOwner, jobqueue.FieldRepoName,
+	jobqueue.FieldAuthor, jobqueue.FieldStatus, jobqueue.FieldTokenUsage, jobqueue.FieldSchedule,
+	jobqueue.FieldAreaScores,
+}
+
+// readJobHistory reads the finished jobs requested between since and until
+func readJobHistory(ctx context.Context, queue *jobqueue.Client, since, until time.Time) ([]jobRecord, error) {
+	ids, err := queue.Archived(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not read the archived jobs from redis at %s: %w", RedisHost, err)
+	}
+	var jobs []jobRecord
+	seen := make(map[string]bool)
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		keys := make([]string, len(jobHistoryKeys))
+		for i, field := range jobHistoryKeys {
+			keys[i] = jobqueue.Key(id, field)
+		}
+		replies, err := queue.MGet(ctx, keys...).Result()
+		if err != nil {
+			return nil, fmt.Errorf("could not read job %s: %w", id, err)
+		}
+		// Unset keys are nil
+		values := make([]string, len(replies))
+		for i, reply := range replies {
+			values[i], _ = reply.(string)
+		}
+		job, ok := parseJobRecord(id, values)
+		if !ok || job.RequestTime.Before(since) || !job.RequestTime.Before(until) {
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// parseJobRecord decodes the keys of a job, it reports false for the jobs without a request time
+func parseJobRecord(id string, values []string) (jobRecord, bool) {
+	requestTime, err := strconv.ParseInt(values[0], 10, 64)
+	if err != nil {
+		return jobRecord{}, false
+	}
+	job := jobRecord{
+		ID:          id,
+		JobType:     values[2],
+		Repo:        values[3] + "/" + values[4],
+		User:        values[5],
+		Failed:      values[6] == jobqueue.StatusError,
+		RequestTime: time.Unix(requestTime, 0),
+	}
+	if seconds, err := strconv.ParseFloat(values[1], 64); err == nil {
+		job.Duration = time.Duration(seconds * float64(time.Second))
+	}
+	if job.User == "" && values[8] != "" {
+		job.User = "schedule:" + values[8]
+	}
+	if values[7] != "" {
+		var usage jobUsage
+		if err := json.Unmarshal([]byte(values[7]), &usage); err == nil {
+			job.Usage = &usage
+		}
+	}
+	if values[9] != "" {
+		var scores map[string]fileScore
+		if err := json.Unmarshal([]byte(values[9]), &scores); err == nil {
+			job.AreaScores = scores
+		}
+	}
+	return job, true
+}
+
+// costReportRow sums the jobs of a repository, user and job type. The total row leaves them empty.
+type costReportRow struct {
+	Repo             string  `json:"repo,omitempty"`
+	User             string  `json:"user,omitempty"`
+	JobType          string  `json:"job_type,omitempty"`
+	Jobs             int     `json:"jobs"`
+	Failed           int     `json:"failed"`
+	DurationSeconds  float64 `json:"duration_seconds"`
+	MeanDuration     float64 `json:"mean_duration_seconds"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	// TokenCost is the cost the jobs estimated for their tokens, ComputeCost prices their duration
+	TokenCost     float64 `json:"token_cost"`
+	ComputeCost   float64 `json:"compute_cost"`
+	EstimatedCost float64 `json:"estimated_cost"`
+	// timedJobs are the jobs with a known duration, which the mean duration is over
+	timedJobs int
+}
+
+func (r *costReportRow) add(job jobRecord, costPerHour float64) {
+	r.Jobs++
+	if job.Failed {
+		r.Failed++
+	}
+	if job.Duration > 0 {
+		r.timedJobs++
+		r.DurationSeconds += job.Duration.Seconds()
+		r.MeanDuration = r.DurationSeconds / float64(r.timedJobs)
+		r.ComputeCost += job.Duration.Hours() * costPerHour
+	}
+	if job.Usage != nil {
+		r.PromptTokens += job.Usage.PromptTokens
+		r.CompletionTokens += job.Usage.CompletionTokens
+		r.TokenCost += job.Usage.EstimatedCost
+	}
+	r.EstimatedCost = r.TokenCost + r.ComputeCost
+}
+
+// costReport attributes the jobs of a time range to the repositories, users and job types
+type costReport struct {
+	Since    time.Time       `json:"since"`
+	Until    time.Time       `json:"until"`
+	Currency string          `json:"currency"`
+	Rows     []costReportRow `json:"rows"`
+	Total    costReportRow   `json:"total"`
+}
+
+func newCostReport(since, until time.Time, jobs []jobRecord, costPerHour float64, currency string) costReport {
+	report := costReport{Since: since.UTC(), Until: until.UTC(), Currency: currency, Rows: []costReportRow{}}
+	rows := make(map[[3]string]*costReportRow)
+	for _, job := range jobs {
+		key := [3]string{job.Repo, job.User, job.JobType}
+		row, ok := rows[key]
+		if !ok {
+			row = &costReportRow{Repo: job.Repo, User: job.User, JobType: job.JobType}
+			rows[key] = row
+		}
+		row.add(job, costPerHour)
+		report.Total.add(job, costPerHour)
+	}
+	for _, row := range rows {
+		report.Rows = append(report.Rows, *row)
+	}
+	// The most expensive first, then the longest running
+	sort.Slice(report.Rows, func(i, j int) bool {
+		a, b := report.Rows[i], report.Rows[j]
+		if a.EstimatedCost != b.EstimatedCost {
+			return a.EstimatedCost > b.EstimatedCost
+		}
+		if a.DurationSeconds != b.DurationSeconds {
+			return a.DurationSeconds > b.DurationSeconds
+		}
+		return a.Repo+a.User+a.JobType < b.Repo+b.User+b.JobType
+	})
+	return report
+}
+
+var costReportHeader = []string{"repo", "user", "job_type", "jobs", "failed", "duration_seconds", "mean_duration_seconds",
+	"prompt_tokens", "completion_tokens", "token_cost", "compute_cost", "estimated_cost"}
+
+// cells formats the row for the table, CSV and markdown reports
+func (r costReportRow) cells() []string {
+	return []string{r.Repo, r.User, r.JobType, strconv.Itoa(r.Jobs), strconv.Itoa(r.Failed),
+		strconv.FormatFloat(r.DurationSeconds, 'f', 0, 64), strconv.FormatFloat(r.MeanDuration, 'f', 0, 64),
+		strconv.Itoa(r.PromptTokens), strconv.Itoa(r.CompletionTokens),
+		strconv.FormatFloat(r.TokenCost, 'f', 2, 64), strconv.FormatFloat(r.ComputeCost, 'f', 2, 64), strconv.FormatFloat(r.EstimatedCost, 'f', 2, 64)}
+}
+
+func (r costReport) title() string {
+	return fmt.Sprintf("InstructLab bot jobs from %s to %s", r.Since.Format(time.RFC3339), r.Until.Format(time.RFC3339))
+}
+
+// write writes the report in the format
+func (r costReport) write(out io.Writer, format string) error {
+	total := r.Total
+	total.Repo = "total"
+	switch format {
+	case costReportJSON:
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r)
+	case costReportCSV:
+		w := csv.NewWriter(out)
+		_ = w.Write(costReportHeader)
+		for _, row := range r.Rows {
+			_ = w.Write(row.cells())
+		}
+		_ = w.Write(total.cells())
+		w.Flush()
+		return w.Error()
+	case costReportMarkdown:
+		fmt.Fprintf(out, "### %s\n\nCosts are in %s.\n\n", r.title(), r.Currency)
+		fmt.Fprintf(out, "| %s |\n|%s\n", strings.Join(costReportHeader, " | "), strings.Repeat(" --- |", len(costReportHeader)))
+		for _, row := range append(r.Rows, total) {
+			fmt.Fprintf(out, "| %s |\n", strings.Join(row.cells(), " | "))
+		}
+		return nil
+	default:
+		fmt.Fprintf(out, "%s, costs in %s\n\n", r.title(), r.Currency)
+		tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.ToUpper(strings.Join(costReportHeader, "\t")))
+		for _, row := range append(r.Rows, total) {
+			fmt.Fprintln(tw, strings.Join(row.cells(), "\t"))
+		}
+		return tw.Flush()
+	}
+}
+
+// postSlackReport posts the report table to a Slack incoming webhook
+func postSlackReport(ctx context.Context, webhookURL string, report costReport) error {
+	var table bytes.Buffer
+	if err := report.write(&table, costReportTable); err != nil {
+		return err
+	}
+	body, err := json.Marshal(map[string]string{"text": "```\n" + table.String() + "```"})
+	if err != nil {
+		return err
+	}
+	if err := postReport(ctx, webhookURL, "", body); err != nil {
+		return fmt.Errorf("could not post the report to Slack: %w", err)
+	}
+	return nil
+}
+
+// commentReportOnIssue comments the report on the owner/repo#number GitHub issue
+func commentReportOnIssue(ctx context.Context, apiURL, token, issue string, report costReport) error {
+	match := trackingIssuePattern.FindStringSubmatch(issue)
+	if match == nil {
+		return fmt.Errorf("invalid --tracking-issue %q, expected owner/repo#number", issue)
+	}
+	if token == "" {
+		return fmt.Errorf("--github-token is required to comment on %s", issue)
+	}
+	var comment bytes.Buffer
+	if err := report.write(&comment, costReportMarkdown); err != nil {
+		return err
+	}
+	body, err := json.Marshal(map[string]string{"body": comment.String()})
+	if err != nil {
+		return err
+	}
+	url := fmt.Sprintf("%s/repos/%s/%s/issues/%s/comments", strings.TrimSuffix(apiURL, "/"), match[1], match[2], match[3])
+	if err := postReport(ctx, url, token, body); err != nil {
+		return fmt.Errorf("could not comment the report on %s: %w", issue, err)
+	}
+	return nil
+}
+
+func postReport(ctx context.Context, url, token string, body []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, costReportTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Accept", "application/vnd.github+json")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
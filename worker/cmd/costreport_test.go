@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestCostReportRange verify the report covers the period before until unless since is given.
+func TestCostReportRange(t *testing.T) {
+	now := time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC)
+
+	since, until, err := costReportRange(now, "", "", 7*24*time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, now.AddDate(0, 0, -7), since)
+	assert.Equal(t, now, until)
+
+	since, until, err = costReportRange(now, "2024-06-01", "2024-06-08T00:00:00Z", time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), since)
+	assert.Equal(t, time.Date(2024, 6, 8, 0, 0, 0, 0, time.UTC), until)
+
+	_, _, err = costReportRange(now, "2024-06-20", "", time.Hour)
+	assert.Error(t, err)
+	_, _, err = costReportRange(now, "last week", "", time.Hour)
+	assert.Error(t, err)
+}
+
+// TestParseJobRecord verify the keys of a job are decoded, scheduled jobs attributed to their schedule.
+func TestParseJobRecord(t *testing.T) {
+	job, ok := parseJobRecord("7", []string{"1717243200", "90", "train", "instructlab", "taxonomy", "alice", "error", `{"prompt_tokens":10,"estimated_cost":0.5}`, "", ""})
+	assert.True(t, ok)
+	assert.Equal(t, "instructlab/taxonomy", job.Repo)
+	assert.Equal(t, "alice", job.User)
+	assert.True(t, job.Failed)
+	assert.Equal(t, 90*time.Second, job.Duration)
+	assert.Equal(t, 10, job.Usage.PromptTokens)
+
+	job, ok = parseJobRecord("8", []string{"1717243200", "", "evaluate", "instructlab", "taxonomy", "", "", "", "weekly", ""})
+	assert.True(t, ok)
+	assert.Equal(t, "schedule:weekly", job.User)
+	assert.Zero(t, job.Duration)
+	assert.Nil(t, job.Usage)
+
+	_, ok = parseJobRecord("9", []string{"", "", "", "", "", "", "", "", "", ""})
+	assert.False(t, ok)
+}
+
+// TestNewCostReport verify jobs are summed per repo, user and job type, the most expensive first.
+func TestNewCostReport(t *testing.T) {
+	since := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	jobs := []jobRecord{
+		{Repo: "o/taxonomy", User: "alice", JobType: "train", Duration: 2 * time.Hour},
+		{Repo: "o/taxonomy", User: "alice", JobType: "train", Duration: time.Hour, Failed: true},
+		{Repo: "o/taxonomy", User: "alice", JobType: "train"},
+		{Repo: "o/taxonomy", User: "bob", JobType: "precheck", Duration: time.Minute, Usage: &jobUsage{modelUsage: modelUsage{PromptTokens: 100, CompletionTokens: 50, EstimatedCost: 0.25}}},
+	}
+	report := newCostReport(since, since.AddDate(0, 0, 7), jobs, 2, "USD")
+
+	assert.Len(t, report.Rows, 2)
+	train := report.Rows[0]
+	assert.Equal(t, "train", train.JobType)
+	assert.Equal(t, 3, train.Jobs)
+	assert.Equal(t, 1, train.Failed)
+	assert.InDelta(t, 3*3600, train.DurationSeconds, 1e-9)
+	// The job that never ran is left out of the mean
+	assert.InDelta(t, 1.5*3600, train.MeanDuration, 1e-9)
+	assert.InDelta(t, 6, train.EstimatedCost, 1e-9)
+
+	precheck := report.Rows[1]
+	assert.Equal(t, 100, precheck.PromptTokens)
+	assert.InDelta(t, 0.25, precheck.TokenCost, 1e-9)
+	assert.InDelta(t, 0.25+2.0/60, precheck.EstimatedCost, 1e-9)
+
+	assert.Equal(t, 4, report.Total.Jobs)
+	assert.InDelta(t, 6.25+2.0/60, report.Total.EstimatedCost, 1e-9)
+}
+
+// TestCostReportWrite verify the CSV, JSON and markdown reports end with the total.
+func TestCostReportWrite(t *testing.T) {
+	since := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	report := newCostReport(since, since.AddDate(0, 0, 7), []jobRecord{{Repo: "o/taxonomy", User: "alice", JobType: "train", Duration: time.Hour}}, 2, "USD")
+
+	var out bytes.Buffer
+	assert.NoError(t, report.write(&out, costReportCSV))
+	assert.Equal(t, strings.Join(costReportHeader, ",")+"\n"+
+		"o/taxonomy,alice,train,1,0,3600,3600,0,0,0.00,2.00,2.00\n"+
+		"total,,,1,0,3600,3600,0,0,0.00,2.00,2.00\n", out.String())
+
+	out.Reset()
+	assert.NoError(t, report.write(&out, costReportJSON))
+	var decoded costReport
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &decoded))
+	assert.Len(t, decoded.Rows, 1)
+	assert.Equal(t, "alice", decoded.Rows[0].User)
+	assert.InDelta(t, 2, decoded.Total.EstimatedCost, 1e-9)
+	assert.Equal(t, "USD", decoded.Currency)
+
+	out.Reset()
+	assert.NoError(t, report.write(&out, costReportMarkdown))
+	assert.Contains(t, out.String(), "| o/taxonomy | alice | train | 1 | 0 |")
+	assert.Contains(t, out.String(), "| total |  |  | 1 |")
+}
+
+// TestCommentReportOnIssue verify the markdown report is commented on the tracking issue.
+func TestCommentReportOnIssue(t *testing.T) {
+	var path, auth, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, auth = r.URL.Path, r.Header.Get("Authorization")
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	since := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	report := newCostReport(since, since.AddDate(0, 0, 7), nil, 0, "USD")
+	assert.NoError(t, commentReportOnIssue(context.Background(), server.URL, "token", "instructlab/taxonomy#42", report))
+	assert.Equal(t, "/repos/instructlab/taxonomy/issues/42/comments", path)
+	assert.Equal(t, "Bearer token", auth)
+	assert.Contains(t, body, "InstructLab bot jobs from 2024-06-01T00:00:00Z")
+
+	assert.Error(t, commentReportOnIssue(context.Background(), server.URL, "token", "taxonomy#42", report))
+	assert.Error(t, commentReportOnIssue(context.Background(), server.URL, "", "instructlab/taxonomy#42", report))
+}
@@ -0,0 +1,343 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/instructlab/instructlab-bot/pkg/jobqueue"
+	"github.com/spf13/cobra"
+)
+
+const (
+	dashboardJSONFilename = "dashboard.json"
+	dashboardHTMLFilename = "dashboard.html"
+)
+
+// The sources of the scores of the dashboard, the job types publishing per file scores
+const (
+	// dashboardPrecheck scores are the similarity of the precheck answers with the seed answers, 0 to 1
+	dashboardPrecheck = "precheck"
+	// dashboardEvaluate scores are the per taxonomy file scores of the branch benchmarks, 0 to 10
+	dashboardEvaluate = "evaluate"
+)
+
+var (
+	DashboardPeriod    time.Duration
+	DashboardSince     string
+	DashboardUntil     string
+	DashboardDepth     int
+	DashboardInterval  time.Duration
+	DashboardOutputDir string
+	DashboardS3Key     string
+)
+
+func init() {
+	dashboardCmd.Flags().DurationVarP(&DashboardPeriod, "period", "", 90*24*time.Hour, "Period the dashboard covers, ending at --until")
+	dashboardCmd.Flags().StringVarP(&DashboardSince, "since", "", "", "Start of the dashboard, a date or an RFC 3339 time. Overrides --period")
+	dashboardCmd.Flags().StringVarP(&DashboardUntil, "until", "", "", "End of the dashboard, a date or an RFC 3339 time. Defaults to now")
+	dashboardCmd.Flags().IntVarP(&DashboardDepth, "depth", "", 2, "Number of folders of the taxonomy subtrees the scores are grouped by, 2 groups compositional_skills/writing/*")
+	dashboardCmd.Flags().DurationVarP(&DashboardInterval, "interval", "", 7*24*time.Hour, "Length of the periods the scores are tracked over")
+	dashboardCmd.Flags().StringVarP(&DashboardOutputDir, "output-dir", "", "", "Directory the dashboard is written to, in addition to the upload")
+	dashboardCmd.Flags().StringVarP(&DashboardS3Key, "s3-dashboard-key", "", "dashboard", "S3 directory the dashboard is uploaded to, under --s3-key-prefix. Empty to not upload it")
+	rootCmd.AddCommand(dashboardCmd)
+}
+
+// dashboardCmd uploads with the S3 flags of the generate command, see its init
+var dashboardCmd = &cobra.Command{
+	Use:   "dashboard",
+	Short: "Publish the precheck and evaluation scores per taxonomy area over time, to find where the model is weakest.",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		since, until, err := costReportRange(time.Now(), DashboardSince, DashboardUntil, DashboardPeriod)
+		if err != nil {
+			return err
+		}
+		if DashboardDepth < 1 {
+			return fmt.Errorf("--depth must be at least 1")
+		}
+		if DashboardInterval <= 0 {
+			return fmt.Errorf("--interval must be positive")
+		}
+		if DashboardS3Key != "" {
+			if err := validateS3Settings(); err != nil {
+				return err
+			}
+		}
+
+		queue := jobqueue.NewClient(RedisHost)
+		defer queue.Close()
+		jobs, err := readJobHistory(ctx, queue, since, until)
+		if err != nil {
+			return err
+		}
+		board := newDashboard(since, until, DashboardDepth, DashboardInterval, jobs)
+
+		var jsonData, htmlData bytes.Buffer
+		if err := board.writeJSON(&jsonData); err != nil {
+			return err
+		}
+		if err := reportTemplates.renderDashboard(&htmlData, board); err != nil {
+			return fmt.Errorf("could not render the dashboard: %w", err)
+		}
+		files := map[string][]byte{dashboardJSONFilename: jsonData.Bytes(), dashboardHTMLFilename: htmlData.Bytes()}
+
+		if DashboardOutputDir != "" {
+			if err := os.MkdirAll(DashboardOutputDir, 0755); err != nil {
+				return fmt.Errorf("could not create %s: %w", DashboardOutputDir, err)
+			}
+			for name, data := range files {
+				if err := os.WriteFile(filepath.Join(DashboardOutputDir, name), data, 0644); err != nil {
+					return fmt.Errorf("could not write %s: %w", name, err)
+				}
+			}
+		}
+		if DashboardS3Key == "" || TestMode {
+			return nil
+		}
+		cfg, err := awsconfig.LoadDefaultConfig(ctx, awsconfig.WithRegion(AWSRegion))
+		if err != nil {
+			return fmt.Errorf("could not load the AWS config: %w", err)
+		}
+		svc := newS3Client(cfg)
+		for name, contentType := range map[string]string{dashboardJSONFilename: "application/json", dashboardHTMLFilename: "text/html"} {
+			key := path.Join(S3KeyPrefix, DashboardS3Key, name)
+			if _, err := svc.PutObject(ctx, putObjectInput(key, bytes.NewReader(files[name]), contentType, "")); err != nil {
+				return fmt.Errorf("could not upload %s to bucket %s: %w", key, S3Bucket, err)
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Uploaded %s\n", s3PublicURL(key))
+		}
+		return nil
+	},
+}
+
+// fileScore is the score of a taxonomy file in a job, published on the job for the dashboard
+type fileScore struct {
+	// Questions is the number of scored answers the score is the mean of, 1 for the evaluations
+	Questions int     `json:"questions"`
+	Score     float64 `json:"score"`
+}
+
+// precheckAreaScores is the mean similarity of the answers of the model to the seed answers, per
+// taxonomy file. The comparison models are left out.
+func precheckAreaScores(rows []precheckSummaryRow, model string) map[string]fileScore {
+	scores := make(map[string]fileScore)
+	for _, row := range rows {
+		if row.Scores == nil || row.Model != model {
+			continue
+		}
+		score := scores[row.File]
+		score.Score = (score.Score*float64(score.Questions) + row.Scores.Score()) / float64(score.Questions+1)
+		score.Questions++
+		scores[row.File] = score
+	}
+	return scores
+}
+
+// evaluationAreaScores are the scores of the new branch per taxonomy file of a branch benchmark
+func evaluationAreaScores(scores []evaluationScore) map[string]fileScore {
+	areaScores := make(map[string]fileScore)
+	for _, score := range scores {
+		if score.New != nil && strings.HasSuffix(score.Name, ".yaml") {
+			areaScores[score.Name] = fileScore{Questions: 1, Score: *score.New}
+		}
+	}
+	return areaScores
+}
+
+// recordAreaScores publishes the per file scores of the job for the dashboard
+func (w *Worker) recordAreaScores(scores map[string]fileScore) error {
+	if len(scores) == 0 || w.queue == nil {
+		return nil
+	}
+	scoresJSON, err := json.Marshal(scores)
+	if err != nil {
+		return fmt.Errorf("could not marshal area scores: %w", err)
+	}
+	if err := w.setJobField(jobqueue.FieldAreaScores, scoresJSON); err != nil {
+		return fmt.Errorf("could not set area scores for job %s: %w", w.job, err)
+	}
+	return nil
+}
+
+// taxonomyArea is the subtree of the taxonomy file, its first depth folders
+func taxonomyArea(file string, depth int) string {
+	folders := strings.Split(path.Dir(path.Clean(file)), "/")
+	if len(folders) > depth {
+		folders = folders[:depth]
+	}
+	return strings.Join(folders, "/")
+}
+
+// dashboardPoint is the score of an area over a period, the mean of its scored answers
+type dashboardPoint struct {
+	Start     time.Time `json:"start"`
+	Jobs      int       `json:"jobs"`
+	Questions int       `json:"questions"`
+	Score     float64   `json:"score"`
+}
+
+// addScore adds the answers of a file score to the mean score of questions answers
+func addScore(mean *float64, questions *int, score fileScore) {
+	if score.Questions <= 0 {
+		return
+	}
+	*mean = (*mean*float64(*questions) + score.Score*float64(score.Questions)) / float64(*questions+score.Questions)
+	*questions += score.Questions
+}
+
+// dashboardArea tracks the scores of a taxonomy subtree from a source. Points has a point per
+// period of the dashboard, the periods without scores have no questions.
+type dashboardArea struct {
+	Area      string           `json:"area"`
+	Source    string           `json:"source"`
+	Jobs      int              `json:"jobs"`
+	Questions int              `json:"questions"`
+	Score     float64          `json:"score"`
+	Points    []dashboardPoint `json:"points"`
+}
+
+// dashboard aggregates the scores the jobs of a time range published per taxonomy area
+type dashboard struct {
+	Since    time.Time       `json:"since"`
+	Until    time.Time       `json:"until"`
+	Depth    int             `json:"depth"`
+	Interval string          `json:"interval"`
+	Periods  []time.Time     `json:"periods"`
+	Areas    []dashboardArea `json:"areas"`
+}
+
+func newDashboard(since, until time.Time, depth int, interval time.Duration, jobs []jobRecord) dashboard {
+	board := dashboard{Since: since.UTC(), Until: until.UTC(), Depth: depth, Interval: interval.String(), Areas: []dashboardArea{}}
+	for start := board.Since.Truncate(interval); start.Before(board.Until); start = start.Add(interval) {
+		board.Periods = append(board.Periods, start)
+	}
+	areas := make(map[[2]string]*dashboardArea)
+	for _, job := range jobs {
+		if job.Failed || (job.JobType != dashboardPrecheck && job.JobType != dashboardEvaluate) {
+			continue
+		}
+		period := int(job.RequestTime.UTC().Sub(board.Periods[0]) / interval)
+		if period < 0 || period >= len(board.Periods) {
+			continue
+		}
+		// A job counts once per area however many of its files are in it
+		counted := make(map[*dashboardArea]bool)
+		for file, score := range job.AreaScores {
+			key := [2]string{job.JobType, taxonomyArea(file, depth)}
+			area, ok := areas[key]
+			if !ok {
+				area = &dashboardArea{Source: key[0], Area: key[1], Points: make([]dashboardPoint, len(board.Periods))}
+				for i, start := range board.Periods {
+					area.Points[i].Start = start
+				}
+				areas[key] = area
+			}
+			point := &area.Points[period]
+			addScore(&area.Score, &area.Questions, score)
+			addScore(&point.Score, &point.Questions, score)
+			if !counted[area] {
+				counted[area] = true
+				area.Jobs++
+				point.Jobs++
+			}
+		}
+	}
+	for _, area := range areas {
+		board.Areas = append(board.Areas, *area)
+	}
+	// The prechecks first, then the weakest areas first
+	sort.Slice(board.Areas, func(i, j int) bool {
+		a, b := board.Areas[i], board.Areas[j]
+		if a.Source != b.Source {
+			return a.Source == dashboardPrecheck
+		}
+		if a.Score != b.Score {
+			return a.Score < b.Score
+		}
+		return a.Area < b.Area
+	})
+	return board
+}
+
+// sources are the sources of the dashboard with their areas, in display order
+func (d dashboard) sources() []dashboardSource {
+	var sources []dashboardSource
+	for _, area := range d.Areas {
+		if len(sources) == 0 || sources[len(sources)-1].Name != area.Source {
+			sources = append(sources, dashboardSource{Name: area.Source, Title: dashboardSourceTitles[area.Source], Max: dashboardSourceMax[area.Source]})
+		}
+		sources[len(sources)-1].Areas = append(sources[len(sources)-1].Areas, area)
+	}
+	return sources
+}
+
+// dashboardSource is a table of the dashboard page
+type dashboardSource struct {
+	Name  string
+	Title string
+	// Max is the best score of the source
+	Max   float64
+	Areas []dashboardArea
+}
+
+var dashboardSourceTitles = map[string]string{
+	dashboardPrecheck: "Precheck answer similarity (0 to 1)",
+	dashboardEvaluate: "Branch evaluation scores (0 to 10)",
+}
+
+var dashboardSourceMax = map[string]float64{
+	dashboardPrecheck: 1,
+	dashboardEvaluate: 10,
+}
+
+func (d dashboard) writeJSON(out io.Writer) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(d)
+}
+
+// renderDashboard writes the dashboard page, in the branding of the renderer
+func (r *reportRenderer) renderDashboard(out io.Writer, board dashboard) error {
+	return r.pages[reportDashboardPage].Execute(out, reportData{
+		Title:     fmt.Sprintf("Scores per taxonomy area from %s to %s", board.Since.Format(time.DateOnly), board.Until.Format(time.DateOnly)),
+		Branding:  r.branding,
+		Metadata:  []reportField{{Name: "Areas", Value: fmt.Sprintf("%d folders deep", board.Depth)}, {Name: "Period", Value: board.Interval}},
+		Dashboard: &dashboardData{Periods: board.Periods, Sources: board.sources()},
+	})
+}
+
+// dashboardData is the data of the dashboard page, its tables and their columns
+type dashboardData struct {
+	Periods []time.Time
+	Sources []dashboardSource
+}
+
+// sampleDashboard checks the dashboard template when the renderer is created
+func sampleDashboard() *dashboardData {
+	start := time.Date(2024, 6, 3, 0, 0, 0, 0, time.UTC)
+	return &dashboardData{
+		Periods: []time.Time{start},
+		Sources: []dashboardSource{{Name: dashboardPrecheck, Title: dashboardSourceTitles[dashboardPrecheck], Max: 1, Areas: []dashboardArea{{
+			Area:      "compositional_skills/writing",
+			Source:    dashboardPrecheck,
+			Jobs:      1,
+			Questions: 3,
+			Score:     0.5,
+			Points:    []dashboardPoint{{Start: start, Jobs: 1, Questions: 3, Score: 0.5}},
+		}}}},
+	}
+}
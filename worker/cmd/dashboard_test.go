@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestTaxonomyArea verify the files are grouped by their first folders.
+func TestTaxonomyArea(t *testing.T) {
+	assert.Equal(t, "compositional_skills/writing", taxonomyArea("compositional_skills/writing/freeform/poetry/qna.yaml", 2))
+	assert.Equal(t, "compositional_skills", taxonomyArea("compositional_skills/writing/freeform/poetry/qna.yaml", 1))
+	assert.Equal(t, "knowledge/science", taxonomyArea("knowledge/science/qna.yaml", 3))
+}
+
+// TestAreaScores verify a precheck publishes the mean score per file of its main model, and a
+// branch evaluation the new score of each file.
+func TestAreaScores(t *testing.T) {
+	rows := []precheckSummaryRow{
+		{File: "skills/a/qna.yaml", Model: "", Scores: &similarityScores{RougeL: 0.2}},
+		{File: "skills/a/qna.yaml", Model: "", Scores: &similarityScores{RougeL: 0.6}},
+		{File: "skills/a/qna.yaml", Model: "granite", Scores: &similarityScores{RougeL: 1}},
+		{File: "skills/b/qna.yaml", Model: ""},
+	}
+	scores := precheckAreaScores(rows, "")
+	assert.Len(t, scores, 1)
+	assert.Equal(t, 2, scores["skills/a/qna.yaml"].Questions)
+	assert.InDelta(t, 0.4, scores["skills/a/qna.yaml"].Score, 1e-9)
+
+	seven := 7.0
+	scores = evaluationAreaScores([]evaluationScore{
+		{Name: "compositional_skills/writing/qna.yaml", New: &seven},
+		{Name: "compositional_skills/poems/qna.yaml"},
+		{Name: "overall", New: &seven},
+	})
+	assert.Equal(t, map[string]fileScore{"compositional_skills/writing/qna.yaml": {Questions: 1, Score: 7}}, scores)
+}
+
+// TestNewDashboard verify the scores are aggregated per area and period, weighted by their
+// answers, the weakest precheck areas first.
+func TestNewDashboard(t *testing.T) {
+	since := time.Date(2024, 6, 3, 0, 0, 0, 0, time.UTC)
+	until := since.AddDate(0, 0, 14)
+	jobs := []jobRecord{
+		{ID: "1", JobType: "precheck", RequestTime: since.Add(time.Hour), AreaScores: map[string]fileScore{
+			"compositional_skills/writing/poetry/qna.yaml": {Questions: 3, Score: 0.8},
+			"compositional_skills/writing/prose/qna.yaml":  {Questions: 1, Score: 0.4},
+		}},
+		{ID: "2", JobType: "precheck", RequestTime: since.AddDate(0, 0, 8), AreaScores: map[string]fileScore{
+			"knowledge/science/qna.yaml": {Questions: 2, Score: 0.3},
+		}},
+		{ID: "3", JobType: "evaluate", RequestTime: since.AddDate(0, 0, 9), AreaScores: map[string]fileScore{
+			"compositional_skills/writing/qna.yaml": {Questions: 1, Score: 6},
+		}},
+		{ID: "4", JobType: "precheck", Failed: true, RequestTime: since, AreaScores: map[string]fileScore{
+			"knowledge/science/qna.yaml": {Questions: 1, Score: 1},
+		}},
+		{ID: "5", JobType: "train", RequestTime: since},
+	}
+	board := newDashboard(since, until, 2, 7*24*time.Hour, jobs)
+	assert.Equal(t, []time.Time{since, since.AddDate(0, 0, 7)}, board.Periods)
+	assert.Len(t, board.Areas, 3)
+
+	science := board.Areas[0]
+	assert.Equal(t, "knowledge/science", science.Area)
+	assert.Equal(t, dashboardPrecheck, science.Source)
+	assert.Equal(t, 0, science.Points[0].Questions)
+	assert.Equal(t, 2, science.Points[1].Questions)
+
+	writing := board.Areas[1]
+	assert.Equal(t, "compositional_skills/writing", writing.Area)
+	assert.Equal(t, 1, writing.Jobs)
+	assert.Equal(t, 4, writing.Questions)
+	assert.InDelta(t, 0.7, writing.Score, 1e-9)
+	assert.Equal(t, 1, writing.Points[0].Jobs)
+
+	assert.Equal(t, dashboardEvaluate, board.Areas[2].Source)
+	assert.InDelta(t, 6, board.Areas[2].Score, 1e-9)
+}
+
+// TestRenderDashboard verify the dashboard page has a table per source with the areas.
+func TestRenderDashboard(t *testing.T) {
+	since := time.Date(2024, 6, 3, 0, 0, 0, 0, time.UTC)
+	board := newDashboard(since, since.AddDate(0, 0, 7), 2, 7*24*time.Hour, []jobRecord{
+		{ID: "1", JobType: "evaluate", RequestTime: since, AreaScores: map[string]fileScore{
+			"compositional_skills/writing/qna.yaml": {Questions: 1, Score: 6},
+		}},
+	})
+	var out bytes.Buffer
+	assert.NoError(t, reportTemplates.renderDashboard(&out, board))
+	assert.Contains(t, out.String(), "Branch evaluation scores")
+	assert.Contains(t, out.String(), "compositional_skills/writing/*")
+	assert.Contains(t, out.String(), "6.00")
+	assert.NotContains(t, out.String(), "Precheck answer similarity")
+
+	out.Reset()
+	assert.NoError(t, reportTemplates.renderDashboard(&out, newDashboard(since, since.AddDate(0, 0, 7), 2, 7*24*time.Hour, nil)))
+	assert.Contains(t, out.String(), "No prechecks or branch evaluations")
+}
@@ -0,0 +1,307 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	datasetStatsFilename     = "stats.json"
+	datasetStatsHTMLFilename = "stats.html"
+	// maxDatasetErrors keeps the report readable when a whole file is malformed
+	maxDatasetErrors = 50
+)
+
+// datasetStats describes the generated samples of a job
+type datasetStats struct {
+	Files              []string `json:"files"`
+	Records            int      `json:"records"`
+	ValidSamples       int      `json:"valid_samples"`
+	InvalidRecords     int      `json:"invalid_records"`
+	EmptyFields        int      `json:"empty_fields"`
+	Duplicates         int      `json:"duplicates"`
+	DuplicateRate      float64  `json:"duplicate_rate"`
+	AvgPromptChars     float64  `json:"avg_prompt_chars"`
+	AvgResponseChars   float64  `json:"avg_response_chars"`
+	Errors             []string `json:"errors,omitempty"`
+	TruncatedErrors    int      `json:"truncated_errors,omitempty"`
+	promptCharsTotal   int
+	responseCharsTotal int
+	seen               map[string]bool
+}
+
+// datasetSample is a generated record reduced to the text the model is trained on
+type datasetSample struct {
+	Prompt   string
+	Response string
+}
+
+// key identifies exact duplicates
+func (s datasetSample) key() string {
+	return strings.TrimSpace(s.Prompt) + "\x00" + strings.TrimSpace(s.Response)
+}
+
+// generatedDatasetFiles returns the dataset files written by `ilab generate` into the output directory
+func generatedDatasetFiles(outputDir string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(outputDir, "generated_*.json"))
+	if err != nil {
+		return nil, err
+	}
+	jsonl, err := filepath.Glob(filepath.Join(outputDir, "generated_*.jsonl"))
+	if err != nil {
+		return nil, err
+	}
+	return append(files, jsonl...), nil
+}
+
+// validateDataset checks the generated records against the expected sample schema and writes the
+// statistics into the output directory. A dataset without a single valid sample is an error.
+func (w *Worker) validateDataset(outputDir string, files []string) (*datasetStats, error) {
+	stats := &datasetStats{seen: make(map[string]bool)}
+	for _, file := range files {
+		stats.Files = append(stats.Files, filepath.Base(file))
+		if err := stats.addFile(file); err != nil {
+			stats.addError(fmt.Sprintf("%s: %v", filepath.Base(file), err))
+		}
+	}
+	stats.finish()
+	w.setDatasetMetrics(stats)
+
+	statsJSON, err := json.MarshalIndent(stats, "", "  ")
+	if err != nil {
+		return stats, fmt.Errorf("could not marshal dataset statistics: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(outputDir, datasetStatsFilename), statsJSON, 0644); err != nil {
+		return stats, fmt.Errorf("could not write dataset statistics: %w", err)
+	}
+	reportFile, err := os.Create(filepath.Join(outputDir, datasetStatsHTMLFilename))
+	if err != nil {
+		return stats, fmt.Errorf("could not create %s: %w", datasetStatsHTMLFilename, err)
+	}
+	defer reportFile.Close()
+	if err := generateDatasetStatsHTML(reportFile, stats); err != nil {
+		return stats, fmt.Errorf("could not write dataset statistics report: %w", err)
+	}
+
+	w.logger.Infof("Generated dataset: %d valid samples out of %d records, %d duplicates, %d empty fields",
+		stats.ValidSamples, stats.Records, stats.Duplicates, stats.EmptyFields)
+	if stats.ValidSamples == 0 {
+		err := fmt.Errorf("generated dataset has no valid samples out of %d records in %d files", stats.Records, len(files))
+		if len(stats.Errors) > 0 {
+			err = fmt.Errorf("%w, first error: %s", err, stats.Errors[0])
+		}
+		return stats, err
+	}
+	return stats, nil
+}
+
+// datasetFormat is the layout of a dataset file, kept when the file is rewritten
+type datasetFormat int
+
+const (
+	datasetFormatArray datasetFormat = iota
+	datasetFormatDataObject
+	datasetFormatJSONLines
+)
+
+// readDatasetRecords splits a JSON array, a JSON object holding a `data` array, or JSON lines
+// into its records
+func readDatasetRecords(content []byte) ([]json.RawMessage, datasetFormat, error) {
+	trimmed := bytes.TrimSpace(content)
+	if len(trimmed) == 0 {
+		return nil, 0, fmt.Errorf("file is empty")
+	}
+
+	var records []json.RawMessage
+	switch trimmed[0] {
+	case '[':
+		if err := json.Unmarshal(trimmed, &records); err != nil {
+			return nil, 0, fmt.Errorf("invalid JSON array: %w", err)
+		}
+		return records, datasetFormatArray, nil
+	case '{':
+		var wrapper struct {
+			Data []json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(trimmed, &wrapper); err == nil && wrapper.Data != nil {
+			return wrapper.Data, datasetFormatDataObject, nil
+		}
+		// Not a single JSON document, read it as JSON lines
+		scanner := bufio.NewScanner(bytes.NewReader(trimmed))
+		scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+		for scanner.Scan() {
+			if line := bytes.TrimSpace(scanner.Bytes()); len(line) > 0 {
+				records = append(records, json.RawMessage(append([]byte(nil), line...)))
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, 0, fmt.Errorf("could not read JSON lines: %w", err)
+		}
+		return records, datasetFormatJSONLines, nil
+	default:
+		return nil, 0, fmt.Errorf("expected a JSON array, an object or JSON lines")
+	}
+}
+
+// processDataset validates the generated dataset and, when enabled, drops its duplicate samples.
+// Only a failed validation is an error.
+func (w *Worker) processDataset(outputDir string, files []string) error {
+	if _, err := w.validateDataset(outputDir, files); err != nil {
+		return err
+	}
+	if !DedupDataset {
+		return nil
+	}
+	if _, err := w.dedupDataset(outputDir, files); err != nil {
+		w.logger.Errorf("Could not drop duplicate samples: %v", err)
+	}
+	return nil
+}
+
+// addFile validates every record of a dataset file
+func (s *datasetStats) addFile(file string) error {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	name := filepath.Base(file)
+
+	records, _, err := readDatasetRecords(content)
+	if err != nil {
+		return err
+	}
+
+	for i, raw := range records {
+		s.Records++
+		sample, emptyFields, err := parseDatasetRecord(raw)
+		s.EmptyFields += emptyFields
+		if err != nil {
+			s.InvalidRecords++
+			s.addError(fmt.Sprintf("%s record %d: %v", name, i+1, err))
+			continue
+		}
+		s.ValidSamples++
+		s.promptCharsTotal += utf8.RuneCountInString(sample.Prompt)
+		s.responseCharsTotal += utf8.RuneCountInString(sample.Response)
+
+		key := sample.key()
+		if s.seen[key] {
+			s.Duplicates++
+		}
+		s.seen[key] = true
+	}
+	return nil
+}
+
+func (s *datasetStats) addError(msg string) {
+	if len(s.Errors) >= maxDatasetErrors {
+		s.TruncatedErrors++
+		return
+	}
+	s.Errors = append(s.Errors, msg)
+}
+
+func (s *datasetStats) finish() {
+	if s.ValidSamples == 0 {
+		return
+	}
+	s.DuplicateRate = float64(s.Duplicates) / float64(s.ValidSamples)
+	s.AvgPromptChars = float64(s.promptCharsTotal) / float64(s.ValidSamples)
+	s.AvgResponseChars = float64(s.responseCharsTotal) / float64(s.ValidSamples)
+}
+
+// parseDatasetRecord reads a sample in the instruction/output format of `ilab generate` and the
+// SDG service, the user/assistant format of the training files, or the chat messages format.
+// It also returns how many of the sample fields are present but empty.
+func parseDatasetRecord(raw json.RawMessage) (datasetSample, int, error) {
+	var record map[string]interface{}
+	if err := json.Unmarshal(raw, &record); err != nil {
+		return datasetSample{}, 0, fmt.Errorf("not a JSON object")
+	}
+
+	var sample datasetSample
+	var err error
+	if messages, ok := record["messages"]; ok {
+		sample, err = parseDatasetMessages(messages)
+	} else if _, ok := record["user"]; ok {
+		sample.Prompt, err = datasetField(record, "user")
+		if err == nil {
+			sample.Response, err = datasetField(record, "assistant")
+		}
+	} else {
+		sample.Prompt, err = datasetField(record, "instruction", "question")
+		if input, inputErr := datasetField(record, "input"); err == nil && inputErr == nil && strings.TrimSpace(input) != "" {
+			sample.Prompt += "\n" + input
+		}
+		if err == nil {
+			sample.Response, err = datasetField(record, "output", "answer", "response")
+		}
+	}
+	if err != nil {
+		return sample, 0, err
+	}
+
+	emptyFields := 0
+	if strings.TrimSpace(sample.Prompt) == "" {
+		emptyFields++
+	}
+	if strings.TrimSpace(sample.Response) == "" {
+		emptyFields++
+	}
+	if emptyFields > 0 {
+		return sample, emptyFields, fmt.Errorf("empty prompt or response")
+	}
+	return sample, 0, nil
+}
+
+// datasetField returns the first of the named string fields present in the record
+func datasetField(record map[string]interface{}, names ...string) (string, error) {
+	for _, name := range names {
+		value, ok := record[name]
+		if !ok {
+			continue
+		}
+		text, ok := value.(string)
+		if !ok {
+			return "", fmt.Errorf("field %q is not a string", name)
+		}
+		return text, nil
+	}
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = fmt.Sprintf("%q", name)
+	}
+	return "", fmt.Errorf("missing field %s", strings.Join(quoted, " or "))
+}
+
+// parseDatasetMessages joins the user and assistant turns of a chat messages record
+func parseDatasetMessages(value interface{}) (datasetSample, error) {
+	messages, ok := value.([]interface{})
+	if !ok || len(messages) == 0 {
+		return datasetSample{}, fmt.Errorf("field \"messages\" is not a list of messages")
+	}
+	var prompt, response []string
+	for _, m := range messages {
+		message, ok := m.(map[string]interface{})
+		if !ok {
+			return datasetSample{}, fmt.Errorf("message is not a JSON object")
+		}
+		content, err := datasetField(message, "content")
+		if err != nil {
+			return datasetSample{}, err
+		}
+		switch message["role"] {
+		case "user":
+			prompt = append(prompt, content)
+		case "assistant":
+			response = append(response, content)
+		}
+	}
+	return datasetSample{Prompt: strings.Join(prompt, "\n"), Response: strings.Join(response, "\n")}, nil
+}
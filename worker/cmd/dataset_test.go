@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// TestValidateDataset verify records of every supported format are counted and the reports are written.
+func TestValidateDataset(t *testing.T) {
+	dir := t.TempDir()
+	generated := path.Join(dir, "generated_test.json")
+	assert.NoError(t, os.WriteFile(generated, []byte(`[
+		{"instruction": "What is 2+2?", "input": "", "output": "4"},
+		{"instruction": "What is 2+2?", "input": "", "output": "4"},
+		{"instruction": "Name a color", "output": ""},
+		{"question": "Missing answer"}
+	]`), 0644))
+	sdg := path.Join(dir, "sdg_1_0_qna.yaml.json")
+	assert.NoError(t, os.WriteFile(sdg, []byte(`{"data": [{"user": "Hi", "assistant": "Hello"}]}`), 0644))
+	train := path.Join(dir, "train.jsonl")
+	assert.NoError(t, os.WriteFile(train, []byte(`{"messages": [{"role": "user", "content": "Ping"}, {"role": "assistant", "content": "Pong"}]}
+not json
+`), 0644))
+
+	w := NewJobProcessor(context.Background(), nil, nil, zap.NewExample().Sugar(), "job-id", "", "", "", "", "", 20)
+	stats, err := w.validateDataset(dir, []string{generated, sdg, train})
+	assert.NoError(t, err)
+	assert.Equal(t, 7, stats.Records)
+	assert.Equal(t, 4, stats.ValidSamples)
+	assert.Equal(t, 3, stats.InvalidRecords)
+	assert.Equal(t, 1, stats.EmptyFields)
+	assert.Equal(t, 1, stats.Duplicates)
+	assert.Equal(t, 0.25, stats.DuplicateRate)
+	assert.Len(t, stats.Errors, 3)
+
+	statsJSON, err := os.ReadFile(path.Join(dir, datasetStatsFilename))
+	assert.NoError(t, err)
+	var written map[string]interface{}
+	assert.NoError(t, json.Unmarshal(statsJSON, &written))
+	assert.Equal(t, float64(4), written["valid_samples"])
+	_, err = os.Stat(path.Join(dir, datasetStatsHTMLFilename))
+	assert.NoError(t, err)
+}
+
+// TestValidateDatasetNoValidSamples verify a dataset without valid samples fails.
+func TestValidateDatasetNoValidSamples(t *testing.T) {
+	dir := t.TempDir()
+	generated := path.Join(dir, "generated_test.json")
+	assert.NoError(t, os.WriteFile(generated, []byte(`[{"instruction": "", "output": ""}]`), 0644))
+
+	w := NewJobProcessor(context.Background(), nil, nil, zap.NewExample().Sugar(), "job-id", "", "", "", "", "", 20)
+	_, err := w.validateDataset(dir, []string{generated})
+	assert.ErrorContains(t, err, "no valid samples out of 1 records")
+
+	_, err = w.validateDataset(dir, nil)
+	assert.ErrorContains(t, err, "no valid samples out of 0 records")
+}
@@ -0,0 +1,171 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math/bits"
+	"os"
+	"path/filepath"
+)
+
+const dedupReportFilename = "dedup.json"
+
+// dedupReport counts the samples dropped from the generated dataset
+type dedupReport struct {
+	Samples         int            `json:"samples"`
+	Kept            int            `json:"kept"`
+	ExactDuplicates int            `json:"exact_duplicates"`
+	NearDuplicates  int            `json:"near_duplicates"`
+	MaxDistance     int            `json:"max_distance"`
+	DroppedPerFile  map[string]int `json:"dropped_per_file"`
+}
+
+// Diversity is the share of samples left once duplicates are dropped
+func (r dedupReport) Diversity() float64 {
+	if r.Samples == 0 {
+		return 0
+	}
+	return float64(r.Kept) / float64(r.Samples)
+}
+
+// dedupDataset drops exact and near duplicate samples from the dataset files, rewriting them in
+// place. Samples are near duplicates when the Hamming distance of their simhashes is at most
+// DedupMaxDistance. Invalid records are left for the statistics report.
+func (w *Worker) dedupDataset(outputDir string, files []string) (*dedupReport, error) {
+	report := &dedupReport{MaxDistance: DedupMaxDistance, DroppedPerFile: make(map[string]int)}
+	seen := make(map[string]bool)
+	var kept []uint64
+
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return report, err
+		}
+		records, format, err := readDatasetRecords(content)
+		if err != nil {
+			// Already reported by the dataset validation
+			continue
+		}
+
+		var unique []json.RawMessage
+		for _, raw := range records {
+			sample, _, err := parseDatasetRecord(raw)
+			if err != nil {
+				unique = append(unique, raw)
+				continue
+			}
+			report.Samples++
+
+			key := sample.key()
+			if seen[key] {
+				report.ExactDuplicates++
+				continue
+			}
+			seen[key] = true
+			hash := simhash(sample.Prompt + "\n" + sample.Response)
+			if DedupMaxDistance > 0 && nearDuplicate(hash, kept, DedupMaxDistance) {
+				report.NearDuplicates++
+				continue
+			}
+			kept = append(kept, hash)
+			unique = append(unique, raw)
+		}
+
+		dropped := len(records) - len(unique)
+		if dropped == 0 {
+			continue
+		}
+		report.DroppedPerFile[filepath.Base(file)] = dropped
+		if err := writeDatasetRecords(file, content, unique, format); err != nil {
+			return report, fmt.Errorf("could not rewrite %s: %w", filepath.Base(file), err)
+		}
+	}
+	report.Kept = report.Samples - report.ExactDuplicates - report.NearDuplicates
+
+	reportJSON, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return report, fmt.Errorf("could not marshal dedup report: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(outputDir, dedupReportFilename), reportJSON, 0644); err != nil {
+		return report, fmt.Errorf("could not write dedup report: %w", err)
+	}
+	w.logger.Infof("Dropped %d exact and %d near duplicates, kept %d of %d samples (%.1f%% diversity)",
+		report.ExactDuplicates, report.NearDuplicates, report.Kept, report.Samples, report.Diversity()*100)
+	return report, nil
+}
+
+// writeDatasetRecords writes the records back in the format the file was read in. Other fields
+// of a `data` object are kept.
+func writeDatasetRecords(file string, original []byte, records []json.RawMessage, format datasetFormat) error {
+	if records == nil {
+		records = []json.RawMessage{}
+	}
+
+	var content []byte
+	var err error
+	switch format {
+	case datasetFormatArray:
+		content, err = json.MarshalIndent(records, "", "  ")
+	case datasetFormatDataObject:
+		var object map[string]json.RawMessage
+		if err := json.Unmarshal(original, &object); err != nil {
+			return err
+		}
+		if object["data"], err = json.Marshal(records); err != nil {
+			return err
+		}
+		content, err = json.MarshalIndent(object, "", "  ")
+	case datasetFormatJSONLines:
+		for _, record := range records {
+			content = append(content, record...)
+			content = append(content, '\n')
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, content, 0644)
+}
+
+// simhash is the 64 bit simhash of the word unigrams and bigrams of the text, similar texts
+// differ in few bits
+func simhash(text string) uint64 {
+	tokens := tokenize(text)
+	var weights [64]int
+	add := func(feature string) {
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(feature))
+		sum := h.Sum64()
+		for bit := 0; bit < 64; bit++ {
+			if sum&(1<<bit) != 0 {
+				weights[bit]++
+			} else {
+				weights[bit]--
+			}
+		}
+	}
+	for n := 1; n <= 2; n++ {
+		for feature := range ngramCounts(tokens, n) {
+			add(feature)
+		}
+	}
+
+	var hash uint64
+	for bit, weight := range weights {
+		if weight > 0 {
+			hash |= 1 << bit
+		}
+	}
+	return hash
+}
+
+// nearDuplicate reports whether the hash is within maxDistance bits of any of the kept hashes
+func nearDuplicate(hash uint64, kept []uint64, maxDistance int) bool {
+	for _, other := range kept {
+		if bits.OnesCount64(hash^other) <= maxDistance {
+			return true
+		}
+	}
+	return false
+}
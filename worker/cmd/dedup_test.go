@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// TestDedupDataset verify exact and near duplicates are dropped across files and the file formats are kept.
+func TestDedupDataset(t *testing.T) {
+	saved := DedupMaxDistance
+	defer func() { DedupMaxDistance = saved }()
+	DedupMaxDistance = 5
+
+	dir := t.TempDir()
+	generated := path.Join(dir, "generated_test.json")
+	assert.NoError(t, os.WriteFile(generated, []byte(`[
+		{"instruction": "What is the capital of France?", "output": "The capital of France is Paris, a city known for the Eiffel Tower, the Louvre museum and its cafes along the Seine river."},
+		{"instruction": "What is the capital of France?", "output": "The capital of France is Paris, a city famous for the Eiffel Tower, the Louvre museum and its cafes along the Seine river."},
+		{"instruction": "How do plants make food?", "output": "Plants use photosynthesis to turn sunlight, water and carbon dioxide into glucose and oxygen inside their leaves."},
+		{"instruction": "", "output": ""}
+	]`), 0644))
+	sdg := path.Join(dir, "sdg_1_0_qna.yaml.json")
+	assert.NoError(t, os.WriteFile(sdg, []byte(`{"model": "mixtral", "data": [
+		{"instruction": "How do plants make food?", "output": "Plants use photosynthesis to turn sunlight, water and carbon dioxide into glucose and oxygen inside their leaves."}
+	]}`), 0644))
+
+	w := NewJobProcessor(context.Background(), nil, nil, zap.NewExample().Sugar(), "job-id", "", "", "", "", "", 20)
+	report, err := w.dedupDataset(dir, []string{generated, sdg})
+	assert.NoError(t, err)
+	assert.Equal(t, 4, report.Samples)
+	assert.Equal(t, 1, report.ExactDuplicates)
+	assert.Equal(t, 1, report.NearDuplicates)
+	assert.Equal(t, 2, report.Kept)
+	assert.Equal(t, 0.5, report.Diversity())
+	assert.Equal(t, map[string]int{"generated_test.json": 1, "sdg_1_0_qna.yaml.json": 1}, report.DroppedPerFile)
+
+	content, err := os.ReadFile(generated)
+	assert.NoError(t, err)
+	records, format, err := readDatasetRecords(content)
+	assert.NoError(t, err)
+	assert.Equal(t, datasetFormatArray, format)
+	assert.Len(t, records, 3, "the invalid record is left in place")
+
+	content, err = os.ReadFile(sdg)
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), `"model": "mixtral"`)
+	records, format, err = readDatasetRecords(content)
+	assert.NoError(t, err)
+	assert.Equal(t, datasetFormatDataObject, format)
+	assert.Empty(t, records)
+
+	_, err = os.Stat(path.Join(dir, dedupReportFilename))
+	assert.NoError(t, err)
+}
+
+// TestDedupExactOnly verify a zero distance keeps near duplicates.
+func TestDedupExactOnly(t *testing.T) {
+	saved := DedupMaxDistance
+	defer func() { DedupMaxDistance = saved }()
+	DedupMaxDistance = 0
+
+	dir := t.TempDir()
+	train := path.Join(dir, "generated_test.jsonl")
+	assert.NoError(t, os.WriteFile(train, []byte(`{"user": "Name a fruit", "assistant": "Apple"}
+{"user": "Name a fruit", "assistant": "Apple"}
+{"user": "Name a fruit", "assistant": "Apples"}
+`), 0644))
+
+	w := NewJobProcessor(context.Background(), nil, nil, zap.NewExample().Sugar(), "job-id", "", "", "", "", "", 20)
+	report, err := w.dedupDataset(dir, []string{train})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, report.ExactDuplicates)
+	assert.Equal(t, 0, report.NearDuplicates)
+
+	content, err := os.ReadFile(train)
+	assert.NoError(t, err)
+	assert.Equal(t, "{\"user\": \"Name a fruit\", \"assistant\": \"Apple\"}\n{\"user\": \"Name a fruit\", \"assistant\": \"Apples\"}\n", string(content))
+}
@@ -0,0 +1,432 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/instructlab/instructlab-bot/pkg/jobqueue"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+const (
+	doctorPass = "PASS"
+	doctorWarn = "WARN"
+	doctorFail = "FAIL"
+	// doctorTimeout bounds every check that talks to another service
+	doctorTimeout = 10 * time.Second
+	// certExpiryWarning is how long before their expiry certificates are reported
+	certExpiryWarning = 30 * 24 * time.Hour
+)
+
+// doctorCheck is one line of the doctor report
+type doctorCheck struct {
+	Name   string
+	Status string
+	Detail string
+}
+
+func passCheck(name, format string, args ...interface{}) doctorCheck {
+	return doctorCheck{Name: name, Status: doctorPass, Detail: fmt.Sprintf(format, args...)}
+}
+
+func warnCheck(name, format string, args ...interface{}) doctorCheck {
+	return doctorCheck{Name: name, Status: doctorWarn, Detail: fmt.Sprintf(format, args...)}
+}
+
+func failCheck(name, format string, args ...interface{}) doctorCheck {
+	return doctorCheck{Name: name, Status: doctorFail, Detail: fmt.Sprintf(format, args...)}
+}
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+}
+
+// doctorCmd shares the flags of the generate command, see its init
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check that the worker can reach everything it needs to process jobs.",
+	// A failed check is not a usage error, and Execute prints the error
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		logger := initLogger(Debug, LogFormat)
+		w := NewJobProcessor(ctx, nil, nil, logger.Sugar(), "doctor",
+			PreCheckEndpointURL,
+			SdgEndpointURL,
+			TlsClientCertPath,
+			TlsClientKeyPath,
+			TlsServerCaCertPath,
+			MaxSeed)
+
+		checks := []doctorCheck{checkGithubToken(), checkRedis(ctx), checkS3(ctx), checkS3Lifecycle(ctx)}
+		// An invalid worker config is reported by the config checks
+		var containers map[string]containerConfig
+		var kubernetes map[string]kubernetesConfig
+		if workerCfg, err := readWorkerConfig(ConfigFile); err == nil {
+			containers = workerCfg.IlabContainers
+			kubernetes = workerCfg.IlabKubernetes
+		}
+		_, defaultContainer := containers[defaultEnvPolicy]
+		_, defaultKubernetes := kubernetes[defaultEnvPolicy]
+		if !defaultContainer && !defaultKubernetes {
+			checks = append(checks, checkIlab(ctx))
+		}
+		checks = append(checks, checkIlabContainers(ctx, containers)...)
+		checks = append(checks, checkIlabKubernetes(ctx, kubernetes)...)
+		checks = append(checks, checkWorkerConfig()...)
+		checks = append(checks, w.checkEndpoints()...)
+		checks = append(checks, checkCertificates(time.Now())...)
+		checks = append(checks, checkGPU(ctx))
+
+		failed := writeDoctorReport(os.Stdout, checks)
+		if err := writeLifecyclePolicy(os.Stdout); err != nil {
+			return err
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d of %d checks failed", failed, len(checks))
+		}
+		return nil
+	},
+}
+
+// optionalFlag returns a copy of flag that is not required, sharing its value
+func optionalFlag(flag *pflag.Flag) *pflag.Flag {
+	optional := *flag
+	optional.Annotations = nil
+	for key, values := range flag.Annotations {
+		if key == cobra.BashCompOneRequiredFlag {
+			continue
+		}
+		if optional.Annotations == nil {
+			optional.Annotations = make(map[string][]string)
+		}
+		optional.Annotations[key] = values
+	}
+	return &optional
+}
+
+// writeDoctorReport prints the checks and returns how many failed
+func writeDoctorReport(out io.Writer, checks []doctorCheck) int {
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	failed := 0
+	for _, check := range checks {
+		if check.Status == doctorFail {
+			failed++
+		}
+		fmt.Fprintf(tw, "[%s]\t%s\t%s\n", check.Status, check.Name, check.Detail)
+	}
+	_ = tw.Flush()
+	return failed
+}
+
+// checkGithubToken makes sure the worker has a token to fetch the taxonomy with
+func checkGithubToken() doctorCheck {
+	const name = "GitHub token"
+	if GithubToken == "" {
+		return failCheck(name, "--github-token or ILWORKER_GITHUB_TOKEN is not set, the taxonomy can't be fetched")
+	}
+	return passCheck(name, "set")
+}
+
+// checkRedis makes sure the job queue is reachable
+func checkRedis(ctx context.Context) doctorCheck {
+	const name = "Redis"
+	queue := jobqueue.New(jobqueue.Options{Addr: RedisHost, Timeout: doctorTimeout})
+	defer queue.Close()
+	if err := queue.Ping(ctx).Err(); err != nil {
+		return failCheck(name, "PING to %s failed: %v", RedisHost, err)
+	}
+	return passCheck(name, "connected to %s", RedisHost)
+}
+
+// checkS3 makes sure the credentials can write, and delete, an object in the results bucket
+func checkS3(ctx context.Context) doctorCheck {
+	const name = "S3"
+	ctx, cancel := context.WithTimeout(ctx, doctorTimeout)
+	defer cancel()
+
+	cfg, err := awsconfig.LoadDefaultConfig(ctx, awsconfig.WithRegion(AWSRegion))
+	if err != nil {
+		return failCheck(name, "could not load the AWS config: %v", err)
+	}
+	if _, err := cfg.Credentials.Retrieve(ctx); err != nil {
+		return failCheck(name, "no usable AWS credentials: %v", err)
+	}
+
+	svc := newS3Client(cfg)
+	hostname, _ := os.Hostname()
+	key := path.Join(S3KeyPrefix, fmt.Sprintf("doctor/%s-%d", hostname, time.Now().Unix()))
+	// The write is encrypted like the job uploads, so a missing KMS permission shows up here
+	if _, err := svc.PutObject(ctx, putObjectInput(key, strings.NewReader("instructlab-bot worker doctor"), "", "")); err != nil {
+		return failCheck(name, "could not write to bucket %s in %s: %v", S3Bucket, AWSRegion, err)
+	}
+	if _, err := svc.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(S3Bucket),
+		Key:    aws.String(key),
+	}); err != nil {
+		return warnCheck(name, "wrote to bucket %s but could not delete %s: %v", S3Bucket, key, err)
+	}
+	return passCheck(name, "can write to bucket %s in %s", S3Bucket, AWSRegion)
+}
+
+// checkIlab makes sure the ilab binary used by the local jobs runs
+func checkIlab(ctx context.Context) doctorCheck {
+	const name = "ilab"
+	lab := ilabPath()
+	labPath, err := exec.LookPath(lab)
+	if err != nil {
+		return failCheck(name, "%s not found: %v", lab, err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, doctorTimeout)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, labPath, "--version").CombinedOutput()
+	if err != nil {
+		return failCheck(name, "%s --version failed: %v", labPath, err)
+	}
+	version, err := parseIlabVersion(string(output))
+	if err != nil {
+		return warnCheck(name, "%s (%s): %v", strings.TrimSpace(string(output)), labPath, err)
+	}
+	return passCheck(name, "%s (%s), runs ilab %s", version.Raw, labPath, strings.Join(version.args(ilabDiff), " "))
+}
+
+// checkIlabContainers makes sure the container runtimes are installed and reports the images
+// that will be pulled by the first job using them
+func checkIlabContainers(ctx context.Context, containers map[string]containerConfig) []doctorCheck {
+	var checks []doctorCheck
+	for jobType, container := range containers {
+		name := fmt.Sprintf("ilab container (%s)", jobType)
+		runtimePath, err := exec.LookPath(container.runtime())
+		if err != nil {
+			checks = append(checks, failCheck(name, "%s not found: %v", container.runtime(), err))
+			continue
+		}
+		inspectCtx, cancel := context.WithTimeout(ctx, doctorTimeout)
+		err = exec.CommandContext(inspectCtx, runtimePath, "image", "inspect", container.Image).Run()
+		cancel()
+		if err != nil {
+			checks = append(checks, warnCheck(name, "image %s is not present locally, %s will pull it", container.Image, container.runtime()))
+			continue
+		}
+		checks = append(checks, passCheck(name, "image %s is present (%s)", container.Image, runtimePath))
+	}
+	sort.Slice(checks, func(i, j int) bool { return checks[i].Name < checks[j].Name })
+	return checks
+}
+
+// checkIlabKubernetes makes sure kubectl is installed and allowed to run the Jobs of every
+// Kubernetes config
+func checkIlabKubernetes(ctx context.Context, configs map[string]kubernetesConfig) []doctorCheck {
+	var checks []doctorCheck
+	for jobType, cfg := range configs {
+		name := fmt.Sprintf("ilab kubernetes (%s)", jobType)
+		e := kubernetesExecutor{cfg: cfg}
+		var resource string
+		var output []byte
+		var err error
+		for _, resource = range []string{"jobs.batch", "secrets"} {
+			authCtx, cancel := context.WithTimeout(ctx, doctorTimeout)
+			output, err = e.kubectl(authCtx, "auth", "can-i", "create", resource).CombinedOutput()
+			cancel()
+			if err != nil {
+				break
+			}
+		}
+		if err != nil {
+			checks = append(checks, failCheck(name, "can't create %s: %v: %s", resource, err, strings.TrimSpace(string(output))))
+			continue
+		}
+		checks = append(checks, passCheck(name, "can create jobs of image %s with claim %s", cfg.Image, cfg.WorkClaim))
+	}
+	sort.Slice(checks, func(i, j int) bool { return checks[i].Name < checks[j].Name })
+	return checks
+}
+
+// checkWorkerConfig validates the settings the generate command refuses to start without,
+// and the ilab config used by the local jobs
+func checkWorkerConfig() []doctorCheck {
+	const name = "Config"
+	var checks []doctorCheck
+
+	workerCfg, err := readWorkerConfig(ConfigFile)
+	if err != nil {
+		checks = append(checks, failCheck(name, "%v", err))
+	} else if prompts, err := newPromptTemplates(workerCfg.PromptTemplates); err != nil {
+		checks = append(checks, failCheck(name, "invalid prompt templates in %s: %v", ConfigFile, err))
+	} else if _, err := newReportRenderer(workerCfg.Report); err != nil {
+		checks = append(checks, failCheck(name, "invalid report templates in %s: %v", ConfigFile, err))
+	} else {
+		checks = append(checks, passCheck(name, "%s is valid, prompt templates version %s", ConfigFile, prompts.Version))
+	}
+
+	if err := validateSDGAuth(); err != nil {
+		checks = append(checks, failCheck(name, "invalid SDG auth settings: %v", err))
+	}
+	if err := validateS3Settings(); err != nil {
+		checks = append(checks, failCheck(name, "invalid S3 settings: %v", err))
+	}
+	if err := validateLintRules(); err != nil {
+		checks = append(checks, failCheck(name, "invalid lint settings: %v", err))
+	}
+	if err := validateEncryptedArtifacts(); err != nil {
+		checks = append(checks, failCheck(name, "invalid artifact encryption settings: %v", err))
+	} else if ArtifactEncryptionKey != "" {
+		if c, err := loadArtifactCipher(ArtifactEncryptionKey); err != nil {
+			checks = append(checks, failCheck(name, "invalid artifact encryption settings: %v", err))
+		} else {
+			checks = append(checks, passCheck(name, "artifacts matching %s are encrypted with key %s", strings.Join(EncryptedArtifacts, ", "), c.KeyID()))
+		}
+	}
+	if err := defaultPipelineParams().validate(); err != nil {
+		checks = append(checks, failCheck(name, "invalid generate pipeline settings: %v", err))
+	}
+
+	if _, err := readIlabConfig(); os.IsNotExist(err) {
+		checks = append(checks, warnCheck(name, "no ilab %s, generate-local, train and evaluate jobs need one", ilabConfigPath))
+	} else if err != nil {
+		checks = append(checks, failCheck(name, "invalid ilab %s: %v", ilabConfigPath, err))
+	} else {
+		checks = append(checks, passCheck(name, "ilab %s is valid", ilabConfigPath))
+	}
+	return checks
+}
+
+// checkEndpoints makes sure every precheck endpoint serves a model and the SDG endpoint answers
+func (w *Worker) checkEndpoints() []doctorCheck {
+	var checks []doctorCheck
+
+	const precheckName = "Precheck endpoint"
+	ctx, cancel := context.WithTimeout(w.ctx, doctorTimeout)
+	defer cancel()
+	w.ctx = ctx
+	for _, endpoint := range splitEndpoints(w.precheckEndpoint) {
+		if model, err := w.fetchEndpointModelName(endpoint, true); err != nil {
+			checks = append(checks, failCheck(precheckName, "%s: %v", endpoint, err))
+		} else {
+			checks = append(checks, passCheck(precheckName, "%s serves %s", endpoint, model))
+		}
+	}
+
+	// The SDG service only answers POST requests, any HTTP response shows it is reachable
+	const sdgName = "SDG endpoint"
+	client, err := w.sdgHTTPClient()
+	if err != nil {
+		return append(checks, failCheck(sdgName, "%v", err))
+	}
+	client.Timeout = doctorTimeout
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, w.sdgEndpoint, nil)
+	if err != nil {
+		return append(checks, failCheck(sdgName, "invalid endpoint %s: %v", w.sdgEndpoint, err))
+	}
+	setSDGAuthHeaders(req)
+	resp, err := client.Do(req)
+	if err != nil {
+		return append(checks, failCheck(sdgName, "%s: %v", w.sdgEndpoint, err))
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return append(checks, failCheck(sdgName, "%s rejected the credentials: %s", w.sdgEndpoint, resp.Status))
+	}
+	return append(checks, passCheck(sdgName, "%s answered %s", w.sdgEndpoint, resp.Status))
+}
+
+// checkCertificates reports expired or soon to expire TLS certificates. They are only
+// required with the mtls SDG auth mode.
+func checkCertificates(now time.Time) []doctorCheck {
+	required := SdgAuthMode == sdgAuthMTLS || SdgAuthMode == ""
+	var checks []doctorCheck
+	for _, cert := range []struct{ name, path string }{
+		{"TLS client certificate", TlsClientCertPath},
+		{"TLS server CA certificate", TlsServerCaCertPath},
+	} {
+		if cert.path == "" {
+			continue
+		}
+		if _, err := os.Stat(cert.path); os.IsNotExist(err) && !required {
+			continue
+		}
+		checks = append(checks, checkCertificate(cert.name, cert.path, now))
+	}
+	return checks
+}
+
+// checkCertificate checks every certificate of a PEM file is valid at now
+func checkCertificate(name, certPath string, now time.Time) doctorCheck {
+	content, err := os.ReadFile(certPath)
+	if err != nil {
+		return failCheck(name, "%v", err)
+	}
+
+	var earliest *x509.Certificate
+	for block, rest := pem.Decode(content); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return failCheck(name, "%s: %v", certPath, err)
+		}
+		if earliest == nil || cert.NotAfter.Before(earliest.NotAfter) {
+			earliest = cert
+		}
+	}
+	if earliest == nil {
+		return failCheck(name, "%s holds no PEM certificate", certPath)
+	}
+
+	expiry := earliest.NotAfter.UTC().Format(time.RFC3339)
+	switch {
+	case now.Before(earliest.NotBefore):
+		return failCheck(name, "%s is not valid before %s", certPath, earliest.NotBefore.UTC().Format(time.RFC3339))
+	case now.After(earliest.NotAfter):
+		return failCheck(name, "%s expired on %s", certPath, expiry)
+	case earliest.NotAfter.Sub(now) < certExpiryWarning:
+		return warnCheck(name, "%s expires on %s", certPath, expiry)
+	}
+	return passCheck(name, "%s valid until %s", certPath, expiry)
+}
+
+// checkGPU looks for the NVIDIA GPUs generate-local and train jobs run on. Workers that only
+// run precheck and sdg-svc jobs don't need one.
+func checkGPU(ctx context.Context) doctorCheck {
+	const name = "GPU"
+	if _, err := exec.LookPath("nvidia-smi"); err != nil {
+		return warnCheck(name, "nvidia-smi not found, generate-local and train jobs will run on the CPU")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, doctorTimeout)
+	defer cancel()
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "nvidia-smi", "--query-gpu=name,memory.total", "--format=csv,noheader")
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return failCheck(name, "nvidia-smi failed: %v %s", err, strings.TrimSpace(stderr.String()))
+	}
+	gpus := strings.Split(strings.TrimSpace(string(output)), "\n")
+	if len(gpus) == 1 && gpus[0] == "" {
+		return warnCheck(name, "nvidia-smi found no GPU")
+	}
+	return passCheck(name, "%d GPU(s): %s", len(gpus), strings.Join(gpus, "; "))
+}
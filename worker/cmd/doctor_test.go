@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeTestCertificate(t *testing.T, notBefore, notAfter time.Time) string {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "worker"},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	certPath := filepath.Join(t.TempDir(), "cert.pem")
+	assert.NoError(t, os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	return certPath
+}
+
+// TestCheckCertificate verify expired and soon to expire certificates are reported.
+func TestCheckCertificate(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	valid := writeTestCertificate(t, now.AddDate(-1, 0, 0), now.AddDate(1, 0, 0))
+	assert.Equal(t, doctorPass, checkCertificate("cert", valid, now).Status)
+
+	expiring := writeTestCertificate(t, now.AddDate(-1, 0, 0), now.AddDate(0, 0, 7))
+	check := checkCertificate("cert", expiring, now)
+	assert.Equal(t, doctorWarn, check.Status)
+	assert.Contains(t, check.Detail, "expires on 2024-06-08")
+
+	expired := writeTestCertificate(t, now.AddDate(-1, 0, 0), now.AddDate(0, 0, -1))
+	check = checkCertificate("cert", expired, now)
+	assert.Equal(t, doctorFail, check.Status)
+	assert.Contains(t, check.Detail, "expired on 2024-05-31")
+
+	notPEM := filepath.Join(t.TempDir(), "cert.pem")
+	assert.NoError(t, os.WriteFile(notPEM, []byte("not a certificate"), 0600))
+	assert.Equal(t, doctorFail, checkCertificate("cert", notPEM, now).Status)
+	assert.Equal(t, doctorFail, checkCertificate("cert", filepath.Join(t.TempDir(), "missing.pem"), now).Status)
+}
+
+// TestWriteDoctorReport verify the report lists every check and counts the failed ones.
+func TestWriteDoctorReport(t *testing.T) {
+	var out bytes.Buffer
+	failed := writeDoctorReport(&out, []doctorCheck{
+		passCheck("Redis", "connected to %s", "localhost:6379"),
+		warnCheck("GPU", "nvidia-smi not found"),
+		failCheck("S3", "could not write to bucket %s", "results"),
+	})
+	assert.Equal(t, 1, failed)
+	assert.Equal(t, "[PASS]  Redis  connected to localhost:6379\n"+
+		"[WARN]  GPU    nvidia-smi not found\n"+
+		"[FAIL]  S3     could not write to bucket results\n", out.String())
+}
+
+// TestDoctorGithubToken verify doctor reports a missing GitHub token as a failed check, while
+// generate still requires it.
+func TestDoctorGithubToken(t *testing.T) {
+	doctorFlag := doctorCmd.Flags().Lookup("github-token")
+	if assert.NotNil(t, doctorFlag) {
+		assert.NotContains(t, doctorFlag.Annotations, cobra.BashCompOneRequiredFlag)
+	}
+	assert.Contains(t, generateCmd.Flags().Lookup("github-token").Annotations, cobra.BashCompOneRequiredFlag)
+
+	saved := GithubToken
+	defer func() { GithubToken = saved }()
+	GithubToken = ""
+	assert.Equal(t, doctorFail, checkGithubToken().Status)
+	GithubToken = "token"
+	assert.Equal(t, doctorPass, checkGithubToken().Status)
+}
@@ -0,0 +1,335 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/instructlab/instructlab-bot/pkg/jobqueue"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	dryRunFilename        = "dry_run.md"
+	dryRunSummaryFilename = "dry_run_summary.md"
+)
+
+// supportsDryRun reports whether the job type can be planned without running it, the job types
+// working on the changed taxonomy files
+func supportsDryRun(jobType string) bool {
+	switch jobType {
+	case jobPreCheck, jobGenerateLocal, jobSDG:
+		return true
+	}
+	return false
+}
+
+// loadDryRun reads the dry run flag the bot sets on jobs queued with --dry-run
+func (w *Worker) loadDryRun() (bool, error) {
+	value, err := w.jobField(jobqueue.FieldDryRun)
+	if err != nil {
+		return false, err
+	}
+	return value == "true", nil
+}
+
+// dryRunFile is a changed taxonomy file checked by a dry run
+type dryRunFile struct {
+	taxonomyFile
+	SeedExamples int
+	Problems     []string
+	// category is the error category of the problems the real job would fail on
+	category errorCategory
+}
+
+// dryRunCommand is a command the job would run, an ilab command line or an HTTP request
+type dryRunCommand struct {
+	Description string
+	Command     string
+}
+
+// dryRunPlan is what a job would do with the changed files
+type dryRunPlan struct {
+	JobType  string
+	Files    []dryRunFile
+	Commands []dryRunCommand
+}
+
+// checkSeedExamples parses a changed file and checks its seed examples have the question and answer
+// strings the jobs send to the models
+func checkSeedExamples(taxonomyDir string, file taxonomyFile) dryRunFile {
+	checked := dryRunFile{taxonomyFile: file}
+	content, err := os.ReadFile(filepath.Join(taxonomyDir, filepath.FromSlash(file.Path)))
+	if err != nil {
+		checked.Problems = append(checked.Problems, fmt.Sprintf("could not be read: %v", err))
+		checked.category = errorUnknown
+		return checked
+	}
+	var data map[string]interface{}
+	if err := yaml.Unmarshal(content, &data); err != nil {
+		checked.Problems = append(checked.Problems, fmt.Sprintf("could not be parsed: %v", err))
+		checked.category = errorInvalidYAML
+		return checked
+	}
+	seedExamples, ok := data["seed_examples"].([]interface{})
+	if !ok {
+		checked.Problems = append(checked.Problems, "seed_examples not found or not a list")
+		checked.category = errorMissingSeedExamples
+		return checked
+	}
+
+	checked.SeedExamples = len(seedExamples)
+	for i, item := range seedExamples {
+		if _, ok := item.(map[interface{}]interface{}); !ok {
+			checked.Problems = append(checked.Problems, fmt.Sprintf("seed example %d is not a mapping", i+1))
+			continue
+		}
+		for _, field := range []string{"question", "answer"} {
+			if strings.TrimSpace(seedExampleField(item, field)) == "" {
+				checked.Problems = append(checked.Problems, fmt.Sprintf("seed example %d has no %s", i+1, field))
+			}
+		}
+	}
+	return checked
+}
+
+// runDryRun runs ilab diff, classifies and lints the changed files, checks their seed examples and
+// writes the commands the job would run into the output directory, without calling any model
+func (w *Worker) runDryRun(lab, workDir, outputDir, jobType string) error {
+	diffArgs := w.ilabArgs(ilabDiff, "--taxonomy-path", w.taxonomyDir)
+	cmd := w.ilabCommand(lab, workDir, append(diffArgs, w.taxonomyBaseArgs()...)...)
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	// Like the precheck, a diff failing on a file it can't validate still lists the changed files
+	if err := cmd.Run(); commandFailed(err) {
+		w.logger.Warnf("Command %s failed: %v", cmd, err)
+	} else if err != nil {
+		return fmt.Errorf("could not run command %s: %w", cmd, err)
+	}
+
+	plan := dryRunPlan{
+		JobType:  jobType,
+		Commands: []dryRunCommand{{Description: "List the changed taxonomy files", Command: cmd.String()}},
+	}
+	taxonomyFiles := w.classifyChangedFiles(splitLines(stdout.String()))
+	if len(taxonomyFiles) == 0 {
+		return fmt.Errorf("No modified YAML files detected in the PR for the dry run")
+	}
+	w.lintTaxonomyFiles(taxonomyFilePaths(taxonomyFiles), outputDir)
+	for _, file := range taxonomyFiles {
+		plan.Files = append(plan.Files, checkSeedExamples(w.taxonomyDir, file))
+	}
+
+	var commands []dryRunCommand
+	var err error
+	switch jobType {
+	case jobPreCheck:
+		commands, err = w.precheckDryRunCommands(plan.Files)
+	case jobGenerateLocal:
+		generate := w.ilabCommand(lab, WorkDir, w.generateLocalArgs(outputDir, "")...)
+		commands = []dryRunCommand{{Description: "Generate the synthetic data", Command: generate.String()}}
+	case jobSDG:
+		commands, err = w.sdgDryRunCommands(plan.Files)
+	}
+	if err != nil {
+		return err
+	}
+	plan.Commands = append(plan.Commands, commands...)
+
+	if err := os.WriteFile(filepath.Join(outputDir, dryRunFilename), []byte(secretRedactor.redact(plan.markdown())), 0644); err != nil {
+		return fmt.Errorf("could not write %s: %w", dryRunFilename, err)
+	}
+	if err := w.writeSummary(outputDir, dryRunSummaryFilename, plan.summary()); err != nil {
+		w.logger.Error(err)
+	}
+	return plan.err()
+}
+
+// precheckDryRunCommands are the chat completion requests of the precheck, one per seed question and model
+func (w *Worker) precheckDryRunCommands(files []dryRunFile) ([]dryRunCommand, error) {
+	targets, err := w.precheckTargets(w.getModelNameFromConfig())
+	if err != nil {
+		return nil, err
+	}
+
+	var commands []dryRunCommand
+	for _, file := range files {
+		if file.category != "" {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(w.taxonomyDir, filepath.FromSlash(file.Path)))
+		if err != nil {
+			return nil, err
+		}
+		var data map[string]interface{}
+		if err := yaml.Unmarshal(content, &data); err != nil {
+			return nil, err
+		}
+		taskDescription, _ := data["task_description"].(string)
+		seedExamples, _ := data["seed_examples"].([]interface{})
+		for _, example := range seedExamples {
+			question := seedExampleField(example, "question")
+			if question == "" {
+				continue
+			}
+			prompt := promptData{
+				Question:        question,
+				Context:         seedExampleField(example, "context"),
+				TaskDescription: taskDescription,
+				TaxonomyPath:    file.Path,
+			}
+			messages, err := precheckPrompts.render(file.Kind, prompt)
+			if err != nil {
+				return nil, fmt.Errorf("could not build the precheck prompt of %s: %w", file.Path, err)
+			}
+			messages = w.genParams.applySystemPrompt(messages)
+			ungrounded, err := w.ungroundedMessages(file.Kind, prompt)
+			if err != nil {
+				return nil, fmt.Errorf("could not build the precheck prompt of %s: %w", file.Path, err)
+			}
+			if w.paraphrases > 0 {
+				body, err := json.MarshalIndent(w.chatRequest(targets[0], paraphraseMessages(question, w.paraphrases)), "", "  ")
+				if err != nil {
+					return nil, fmt.Errorf("failed to marshal chat request: %w", err)
+				}
+				commands = append(commands, dryRunCommand{
+					Description: fmt.Sprintf("Ask %s for %d paraphrases of %q, each then asked like the question", targetDescription(targets[0]), w.paraphrases, truncateString(question, 80)),
+					Command:     fmt.Sprintf("POST %s\n%s", chatCompletionsURL(targets[0].Endpoint), body),
+				})
+			}
+			for _, target := range targets {
+				body, err := json.MarshalIndent(w.chatRequest(target, messages), "", "  ")
+				if err != nil {
+					return nil, fmt.Errorf("failed to marshal chat request: %w", err)
+				}
+				commands = append(commands, dryRunCommand{
+					Description: fmt.Sprintf("Ask %s %q", targetDescription(target), truncateString(question, 80)),
+					Command:     fmt.Sprintf("POST %s\n%s", chatCompletionsURL(target.Endpoint), body),
+				})
+				if ungrounded == nil {
+					continue
+				}
+				body, err = json.MarshalIndent(w.chatRequest(target, ungrounded), "", "  ")
+				if err != nil {
+					return nil, fmt.Errorf("failed to marshal chat request: %w", err)
+				}
+				commands = append(commands, dryRunCommand{
+					Description: fmt.Sprintf("Ask %s %q without its context", targetDescription(target), truncateString(question, 80)),
+					Command:     fmt.Sprintf("POST %s\n%s", chatCompletionsURL(target.Endpoint), body),
+				})
+			}
+		}
+	}
+	return commands, nil
+}
+
+// targetDescription names a precheck target and its other endpoints for the dry run
+func targetDescription(target precheckTarget) string {
+	name := target.label()
+	if name == "" {
+		name = "the model"
+	}
+	if endpoints := target.endpoints(); len(endpoints) > 1 {
+		name += fmt.Sprintf(" (failing over to %s)", strings.Join(endpoints[1:], ", "))
+	}
+	return name
+}
+
+// sdgDryRunCommands are the SDG requests of the job, one per changed file, with the seed examples
+// over --max-seed left out as the job would
+func (w *Worker) sdgDryRunCommands(files []dryRunFile) ([]dryRunCommand, error) {
+	var commands []dryRunCommand
+	for _, file := range files {
+		if file.category != "" {
+			continue
+		}
+		filePath := filepath.Join(w.taxonomyDir, filepath.FromSlash(file.Path))
+		content, err := os.ReadFile(filePath)
+		if err != nil {
+			return nil, err
+		}
+
+		description := fmt.Sprintf("Generate the synthetic data of %s", file.Path)
+		var data map[string]interface{}
+		if err := yaml.Unmarshal(content, &data); err != nil {
+			return nil, err
+		}
+		if seedExamples, ok := data["seed_examples"].([]interface{}); ok && len(seedExamples) > w.maxSeed {
+			kept := sampleSeedExamples(seedExamples, w.maxSeed, MaxSeedStrategy, MaxSeedRandomSeed)
+			sampled := make([]interface{}, 0, len(kept))
+			for _, index := range kept {
+				sampled = append(sampled, seedExamples[index])
+			}
+			data["seed_examples"] = sampled
+			if content, err = yaml.Marshal(data); err != nil {
+				return nil, err
+			}
+			description += fmt.Sprintf(", with %d of its %d seed examples chosen by the %s strategy", len(kept), len(seedExamples), MaxSeedStrategy)
+		}
+
+		request, err := w.newSDGRequest(filePath, file.Path, content, w.numInstructions)
+		if err != nil {
+			return nil, err
+		}
+		var body bytes.Buffer
+		if err := json.Indent(&body, request.body, "", "  "); err != nil {
+			return nil, err
+		}
+		commands = append(commands, dryRunCommand{
+			Description: description,
+			Command:     fmt.Sprintf("POST %s\n%s", request.url, body.String()),
+		})
+	}
+	return commands, nil
+}
+
+// err fails the dry run when the job would fail on the changed files, with the category the job
+// would fail with. The other problems are only reported.
+func (p dryRunPlan) err() error {
+	var failed []string
+	var category errorCategory
+	for _, file := range p.Files {
+		if file.category == "" {
+			continue
+		}
+		if category == "" {
+			category = file.category
+		}
+		for _, problem := range file.Problems {
+			failed = append(failed, fmt.Sprintf("%s: %s", file.Path, problem))
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	return categorize(category, fmt.Errorf("the %s job would fail on the changed files:\n%s", p.JobType, strings.Join(failed, "\n")))
+}
+
+// summary is the markdown table of the changed files posted on the check run
+func (p dryRunPlan) summary() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "### Dry run\n\nThe %s job would check %d file(s) and run %d command(s).\n\n", p.JobType, len(p.Files), len(p.Commands))
+	sb.WriteString("| File | Type | Seed examples | Problems |\n|---|---|---|---|\n")
+	for _, file := range p.Files {
+		problems := "none"
+		if len(file.Problems) > 0 {
+			problems = strings.Join(file.Problems, "<br>")
+		}
+		fmt.Fprintf(&sb, "| `%s` | %s | %d | %s |\n", file.Path, file.Kind, file.SeedExamples, problems)
+	}
+	return sb.String()
+}
+
+// markdown lists the changed files and every command of the job in order
+func (p dryRunPlan) markdown() string {
+	var sb strings.Builder
+	sb.WriteString(p.summary())
+	sb.WriteString("\n## Commands\n")
+	for i, command := range p.Commands {
+		fmt.Fprintf(&sb, "\n%d. %s\n\n```\n%s\n```\n", i+1, command.Description, command.Command)
+	}
+	return sb.String()
+}
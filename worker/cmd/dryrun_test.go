@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// writeTaxonomy writes the files into a temporary taxonomy and returns its root
+func writeTaxonomy(t *testing.T, files map[string]string) string {
+	taxonomyDir := t.TempDir()
+	for file, content := range files {
+		assert.NoError(t, os.MkdirAll(filepath.Join(taxonomyDir, filepath.Dir(file)), 0755))
+		assert.NoError(t, os.WriteFile(filepath.Join(taxonomyDir, file), []byte(content), 0644))
+	}
+	return taxonomyDir
+}
+
+// TestCheckSeedExamples verify the dry run reports the seed examples the jobs could not send.
+func TestCheckSeedExamples(t *testing.T) {
+	taxonomyDir := writeTaxonomy(t, map[string]string{
+		"compositional_skills/haiku/qna.yaml":  "seed_examples:\n- question: Write a haiku\n  answer: An old silent pond\n- question: Write another one\n- just a string\n",
+		"compositional_skills/empty/qna.yaml":  "task_description: nothing\n",
+		"compositional_skills/broken/qna.yaml": "seed_examples: [\n",
+	})
+
+	checked := checkSeedExamples(taxonomyDir, taxonomyFile{Path: "compositional_skills/haiku/qna.yaml", Kind: taxonomyTypeSkill})
+	assert.Equal(t, 3, checked.SeedExamples)
+	assert.Equal(t, []string{"seed example 2 has no answer", "seed example 3 is not a mapping"}, checked.Problems)
+	assert.Empty(t, checked.category)
+
+	checked = checkSeedExamples(taxonomyDir, taxonomyFile{Path: "compositional_skills/empty/qna.yaml"})
+	assert.Equal(t, errorMissingSeedExamples, checked.category)
+
+	checked = checkSeedExamples(taxonomyDir, taxonomyFile{Path: "compositional_skills/broken/qna.yaml"})
+	assert.Equal(t, errorInvalidYAML, checked.category)
+}
+
+// TestDryRunPlanErr verify a dry run only fails on the files the job would fail on.
+func TestDryRunPlanErr(t *testing.T) {
+	plan := dryRunPlan{JobType: jobPreCheck, Files: []dryRunFile{
+		{taxonomyFile: taxonomyFile{Path: "a/qna.yaml"}, Problems: []string{"seed example 1 has no answer"}},
+	}}
+	assert.NoError(t, plan.err())
+
+	plan.Files = append(plan.Files, dryRunFile{taxonomyFile: taxonomyFile{Path: "b/qna.yaml"}, Problems: []string{"seed_examples not found or not a list"}, category: errorMissingSeedExamples})
+	err := plan.err()
+	assert.EqualError(t, err, "the precheck job would fail on the changed files:\nb/qna.yaml: seed_examples not found or not a list")
+	assert.Equal(t, errorMissingSeedExamples, errorCategoryOf(err))
+	assert.Contains(t, plan.summary(), "| `a/qna.yaml` |  | 0 | seed example 1 has no answer |")
+}
+
+// TestDryRunCommands verify the precheck and SDG requests are listed as they would be sent.
+func TestDryRunCommands(t *testing.T) {
+	savedMaxSeedStrategy := MaxSeedStrategy
+	defer func() { MaxSeedStrategy = savedMaxSeedStrategy }()
+	MaxSeedStrategy = seedSampleFirst
+
+	taxonomyDir := writeTaxonomy(t, map[string]string{
+		"compositional_skills/haiku/qna.yaml": "seed_examples:\n- question: Write a haiku\n  answer: An old silent pond\n- question: Write another one\n  answer: A frog jumps in\n",
+	})
+	files := []dryRunFile{{taxonomyFile: taxonomyFile{Path: "compositional_skills/haiku/qna.yaml", Kind: taxonomyTypeSkill}, SeedExamples: 2}}
+
+	w := NewJobProcessor(context.Background(), nil, nil, zap.NewExample().Sugar(), "job-id", "https://merlinite.example.com/v1", "https://sdg.example.com/v1/skill", "", "", "", 1)
+	w.taxonomyDir = taxonomyDir
+	w.numInstructions = 10
+
+	commands, err := w.precheckDryRunCommands(files)
+	if assert.NoError(t, err) && assert.Len(t, commands, 2) {
+		assert.Equal(t, `Ask the model "Write a haiku"`, commands[0].Description)
+		assert.Contains(t, commands[0].Command, "POST https://merlinite.example.com/v1/chat/completions\n")
+		assert.Contains(t, commands[0].Command, "Write a haiku")
+	}
+
+	commands, err = w.sdgDryRunCommands(files)
+	if assert.NoError(t, err) && assert.Len(t, commands, 1) {
+		assert.Equal(t, "Generate the synthetic data of compositional_skills/haiku/qna.yaml, with 1 of its 2 seed examples chosen by the first strategy", commands[0].Description)
+		assert.Contains(t, commands[0].Command, "POST https://sdg.example.com/v1/skill\n")
+		assert.Contains(t, commands[0].Command, `"num_samples": 10`)
+		assert.NotContains(t, commands[0].Command, "Write another one")
+	}
+}
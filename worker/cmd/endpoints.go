@@ -0,0 +1,218 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Strategies choosing the precheck endpoint a question is sent to first
+const (
+	endpointRoundRobin = "round-robin"
+	endpointLatency    = "latency"
+)
+
+// splitEndpoints parses a comma separated list of endpoints
+func splitEndpoints(endpoints string) []string {
+	var urls []string
+	seen := make(map[string]bool)
+	for _, url := range strings.Split(endpoints, ",") {
+		url = strings.TrimSpace(url)
+		if url != "" && !seen[url] {
+			seen[url] = true
+			urls = append(urls, url)
+		}
+	}
+	return urls
+}
+
+// validateEndpointStrategy checks the --precheck-endpoint-strategy flag
+func validateEndpointStrategy(strategy string) error {
+	switch strategy {
+	case "", endpointRoundRobin, endpointLatency:
+		return nil
+	}
+	return fmt.Errorf("unknown precheck endpoint strategy %q, expected %s or %s", strategy, endpointRoundRobin, endpointLatency)
+}
+
+// endpointState is what the worker knows of the health of an endpoint
+type endpointState struct {
+	url string
+	// latency is the moving average of the successful requests, 0 until one succeeded
+	latency time.Duration
+	// downUntil is the end of the cooldown of an endpoint that failed
+	downUntil time.Time
+	checkedAt time.Time
+}
+
+// endpointPool spreads the requests of a target over its endpoints and keeps the endpoints
+// that fail out of the rotation for PrecheckEndpointCooldown
+type endpointPool struct {
+	mu        sync.Mutex
+	endpoints []*endpointState
+	next      int
+}
+
+var (
+	endpointPoolsMu sync.Mutex
+	// endpointPools are shared by the jobs of the worker so the health of the endpoints outlives a job
+	endpointPools = make(map[string]*endpointPool)
+)
+
+// endpointPoolFor returns the pool of the endpoints, creating it on first use
+func endpointPoolFor(endpoints []string) *endpointPool {
+	key := strings.Join(endpoints, ",")
+	endpointPoolsMu.Lock()
+	defer endpointPoolsMu.Unlock()
+	if pool, ok := endpointPools[key]; ok {
+		return pool
+	}
+	pool := &endpointPool{}
+	for _, url := range endpoints {
+		pool.endpoints = append(pool.endpoints, &endpointState{url: url})
+	}
+	endpointPools[key] = pool
+	return pool
+}
+
+// order returns the endpoints in the order they should be tried. Endpoints in their cooldown
+// come last, the one recovering first, so a request is still attempted when all of them failed.
+func (p *endpointPool) order(now time.Time) []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var up, down []*endpointState
+	for _, endpoint := range p.endpoints {
+		if now.Before(endpoint.downUntil) {
+			down = append(down, endpoint)
+		} else {
+			up = append(up, endpoint)
+		}
+	}
+
+	if PrecheckEndpointStrategy == endpointLatency {
+		// Endpoints without a measured latency go first so they get measured
+		sort.SliceStable(up, func(i, j int) bool { return up[i].latency < up[j].latency })
+	} else if len(up) > 0 {
+		start := p.next % len(up)
+		up = append(up[start:len(up):len(up)], up[:start]...)
+		p.next++
+	}
+	sort.SliceStable(down, func(i, j int) bool { return down[i].downUntil.Before(down[j].downUntil) })
+
+	urls := make([]string, 0, len(p.endpoints))
+	for _, endpoint := range append(up, down...) {
+		urls = append(urls, endpoint.url)
+	}
+	return urls
+}
+
+func (p *endpointPool) state(url string) *endpointState {
+	for _, endpoint := range p.endpoints {
+		if endpoint.url == url {
+			return endpoint
+		}
+	}
+	return nil
+}
+
+// markUp records a successful request to the endpoint, ending its cooldown
+func (p *endpointPool) markUp(url string, latency time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	endpoint := p.state(url)
+	if endpoint == nil {
+		return
+	}
+	endpoint.downUntil = time.Time{}
+	if endpoint.latency == 0 {
+		endpoint.latency = latency
+	} else {
+		endpoint.latency = (3*endpoint.latency + latency) / 4
+	}
+}
+
+// markDown takes the endpoint out of the rotation for PrecheckEndpointCooldown
+func (p *endpointPool) markDown(url string, now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if endpoint := p.state(url); endpoint != nil {
+		endpoint.downUntil = now.Add(PrecheckEndpointCooldown)
+	}
+}
+
+// healthCheck requests the models of the endpoints not checked for PrecheckHealthInterval, in
+// parallel, and returns the endpoints that failed along with their error
+func (p *endpointPool) healthCheck(ctx context.Context, client *http.Client, apiKey string) map[string]error {
+	now := time.Now()
+	p.mu.Lock()
+	var urls []string
+	for _, endpoint := range p.endpoints {
+		if endpoint.checkedAt.IsZero() || now.Sub(endpoint.checkedAt) >= PrecheckHealthInterval {
+			endpoint.checkedAt = now
+			urls = append(urls, endpoint.url)
+		}
+	}
+	p.mu.Unlock()
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		failures = make(map[string]error)
+	)
+	for _, url := range urls {
+		wg.Add(1)
+		go func(url string) {
+			defer wg.Done()
+			start := time.Now()
+			if err := checkEndpointHealth(ctx, client, url, apiKey); err != nil {
+				p.markDown(url, time.Now())
+				mu.Lock()
+				failures[url] = err
+				mu.Unlock()
+				return
+			}
+			p.markUp(url, time.Since(start))
+		}(url)
+	}
+	wg.Wait()
+	return failures
+}
+
+// checkEndpointHealth requests the models of an OpenAI compatible endpoint
+func checkEndpointHealth(ctx context.Context, client *http.Client, endpoint, apiKey string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(endpoint, "/")+"/models", nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// checkPrecheckEndpoints health checks the endpoints of the targets served by several of them,
+// so the first questions skip the endpoints that are down
+func (w *Worker) checkPrecheckEndpoints(client *http.Client, targets []precheckTarget) {
+	for _, target := range targets {
+		if len(target.Endpoints) < 2 {
+			continue
+		}
+		failures := endpointPoolFor(target.Endpoints).healthCheck(w.ctx, client, target.APIKey)
+		for url, err := range failures {
+			w.logger.Warnf("Precheck endpoint %s failed its health check: %v", url, err)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// TestEndpointPoolOrder verify the endpoints rotate, the fastest go first with the latency strategy
+// and the ones that failed go last.
+func TestEndpointPoolOrder(t *testing.T) {
+	savedStrategy, savedCooldown := PrecheckEndpointStrategy, PrecheckEndpointCooldown
+	defer func() { PrecheckEndpointStrategy, PrecheckEndpointCooldown = savedStrategy, savedCooldown }()
+	PrecheckEndpointStrategy, PrecheckEndpointCooldown = endpointRoundRobin, time.Minute
+
+	now := time.Now()
+	pool := &endpointPool{endpoints: []*endpointState{{url: "a"}, {url: "b"}, {url: "c"}}}
+	assert.Equal(t, []string{"a", "b", "c"}, pool.order(now))
+	assert.Equal(t, []string{"b", "c", "a"}, pool.order(now))
+
+	pool.markDown("b", now)
+	assert.Equal(t, []string{"a", "c", "b"}, pool.order(now))
+	assert.Equal(t, []string{"a", "b", "c"}, pool.order(now.Add(2*time.Minute)))
+
+	PrecheckEndpointStrategy = endpointLatency
+	pool.markUp("a", 3*time.Second)
+	pool.markUp("c", time.Second)
+	assert.Equal(t, []string{"c", "a", "b"}, pool.order(now))
+	// b was never measured, it goes first once its cooldown ended
+	assert.Equal(t, []string{"b", "c", "a"}, pool.order(now.Add(2*time.Minute)))
+	pool.markUp("b", 2*time.Second)
+	assert.Equal(t, []string{"c", "b", "a"}, pool.order(now), "a success ends the cooldown")
+}
+
+// TestChatCompletionFailover verify a question fails over to the next endpoint, which answers it.
+func TestChatCompletionFailover(t *testing.T) {
+	savedStrategy, savedCooldown := PrecheckEndpointStrategy, PrecheckEndpointCooldown
+	defer func() { PrecheckEndpointStrategy, PrecheckEndpointCooldown = savedStrategy, savedCooldown }()
+	PrecheckEndpointStrategy, PrecheckEndpointCooldown = endpointLatency, time.Minute
+
+	downRequests := 0
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downRequests++
+		http.Error(w, "overloaded", http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"choices": [{"message": {"role": "assistant", "content": "Paris."}, "finish_reason": "stop"}]}`)
+	}))
+	defer up.Close()
+
+	w := NewJobProcessor(context.Background(), nil, nil, zap.NewExample().Sugar(), "job-id",
+		down.URL+","+up.URL, "", "", "", "", 20)
+	targets, err := w.precheckTargets("unknown")
+	assert.NoError(t, err)
+	assert.Equal(t, []precheckTarget{{Endpoint: down.URL, Endpoints: []string{down.URL, up.URL}}}, targets)
+
+	result, err := w.chatCompletion(context.Background(), http.DefaultClient, targets[0], nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "Paris.", result.Answer)
+	assert.Equal(t, up.URL, result.Endpoint)
+	assert.Equal(t, 2, result.Attempts)
+	if assert.Len(t, result.Warnings, 1) {
+		assert.Contains(t, result.Warnings[0], "request 1 to "+down.URL+" failed")
+	}
+
+	// The endpoint that failed is skipped during its cooldown
+	result, err = w.chatCompletion(context.Background(), http.DefaultClient, targets[0], nil)
+	assert.NoError(t, err)
+	assert.Equal(t, up.URL, result.Endpoint)
+	assert.Equal(t, 1, downRequests)
+}
+
+// TestEndpointPoolHealthCheck verify the endpoints that fail their health check are taken out of the rotation.
+func TestEndpointPoolHealthCheck(t *testing.T) {
+	savedCooldown, savedInterval := PrecheckEndpointCooldown, PrecheckHealthInterval
+	defer func() { PrecheckEndpointCooldown, PrecheckHealthInterval = savedCooldown, savedInterval }()
+	PrecheckEndpointCooldown, PrecheckHealthInterval = time.Minute, time.Hour
+
+	checks := 0
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		checks++
+		assert.Equal(t, "/models", r.URL.Path)
+		assert.Equal(t, "Bearer key", r.Header.Get("Authorization"))
+		fmt.Fprintln(w, `{"object": "list", "data": []}`)
+	}))
+	defer healthy.Close()
+	unhealthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusBadGateway)
+	}))
+	defer unhealthy.Close()
+
+	pool := &endpointPool{endpoints: []*endpointState{{url: unhealthy.URL}, {url: healthy.URL}}}
+	failures := pool.healthCheck(context.Background(), http.DefaultClient, "key")
+	assert.Len(t, failures, 1)
+	assert.Contains(t, failures, unhealthy.URL)
+	assert.Equal(t, []string{healthy.URL, unhealthy.URL}, pool.order(time.Now()))
+
+	// Endpoints checked within the interval are not checked again
+	assert.Empty(t, pool.healthCheck(context.Background(), http.DefaultClient, "key"))
+	assert.Equal(t, 1, checks)
+}
@@ -0,0 +1,335 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/instructlab/instructlab-bot/pkg/jobqueue"
+)
+
+const (
+	evaluationFilename        = "evaluation.json"
+	evaluationSummaryFilename = "evaluation_summary.md"
+)
+
+// evaluationBranchEntry matches the numbered entries of the branch benchmark reports:
+// `1. name: 0.74 -> 0.84 (+0.1)`, `1. name: 7.0` for new entries or just `1. name`
+var evaluationBranchEntry = regexp.MustCompile(`^\d+\.\s+(.+?)(?::\s+([0-9.eE+-]+)(?:\s+->\s+([0-9.eE+-]+))?(?:\s+\(.*\))?)?$`)
+
+// evaluationParams select what an evaluate job compares
+type evaluationParams struct {
+	Benchmark  string `json:"benchmark"`
+	Model      string `json:"model"`
+	BaseModel  string `json:"base_model"`
+	Branch     string `json:"branch,omitempty"`
+	BaseBranch string `json:"base_branch,omitempty"`
+}
+
+// branchBenchmark reports whether the benchmark compares the taxonomy of two branches
+// in a single run instead of the general scores of two models
+func (p evaluationParams) branchBenchmark() bool {
+	return strings.HasSuffix(p.Benchmark, "_branch")
+}
+
+// evaluationScore is one metric of the base and the new model, a side is nil when the
+// report does not have it
+type evaluationScore struct {
+	Name string   `json:"name"`
+	Base *float64 `json:"base"`
+	New  *float64 `json:"new"`
+}
+
+// delta is the change of the score, if both sides are known
+func (s evaluationScore) delta() (float64, bool) {
+	if s.Base == nil || s.New == nil {
+		return 0, false
+	}
+	return *s.New - *s.Base, true
+}
+
+// evaluationResult is the structured output of an evaluate job
+type evaluationResult struct {
+	evaluationParams
+	Scores []evaluationScore `json:"scores"`
+}
+
+// loadEvaluationParams resolves the evaluation settings from the job overrides, the worker
+// settings and the evaluate section of the ilab config, in that order
+func (w *Worker) loadEvaluationParams(prNumber string) (evaluationParams, error) {
+	params := evaluationParams{
+		Benchmark:  EvaluateBenchmark,
+		Model:      EvaluateModel,
+		BaseModel:  EvaluateBaseModel,
+		BaseBranch: EvaluateBaseBranch,
+	}
+	if cfg, err := readIlabConfig(); err == nil {
+		if params.Model == "" {
+			params.Model = cfg.Evaluate.Model
+		}
+		if params.BaseModel == "" {
+			params.BaseModel = cfg.Evaluate.BaseModel
+		}
+	}
+
+	for field, value := range map[jobqueue.Field]*string{
+		jobqueue.FieldBenchmark:  &params.Benchmark,
+		jobqueue.FieldModel:      &params.Model,
+		jobqueue.FieldBaseModel:  &params.BaseModel,
+		jobqueue.FieldBaseBranch: &params.BaseBranch,
+	} {
+		override, err := w.jobField(field)
+		if err != nil {
+			return params, err
+		}
+		if override != "" {
+			*value = override
+		}
+	}
+
+	switch params.Benchmark {
+	case "mmlu", "mt_bench":
+		params.BaseBranch = ""
+	case "mt_bench_branch":
+		if prNumber == "" {
+			return params, fmt.Errorf("the %s benchmark compares a PR with its base branch and needs a PR", params.Benchmark)
+		}
+		// gitOperations checks the PR out into this branch
+		params.Branch = fmt.Sprintf("pr-%s", prNumber)
+		if params.BaseBranch == "" {
+			return params, fmt.Errorf("the %s benchmark needs a base branch", params.Benchmark)
+		}
+	default:
+		return params, fmt.Errorf("invalid benchmark %q, it must be mmlu, mt_bench or mt_bench_branch", params.Benchmark)
+	}
+	if params.Model == "" {
+		return params, fmt.Errorf("no model to evaluate, set --evaluate-model or the evaluate model of the ilab config")
+	}
+	if params.BaseModel == "" {
+		return params, fmt.Errorf("no base model to compare with, set --evaluate-base-model or the evaluate base_model of the ilab config")
+	}
+	return params, nil
+}
+
+// evaluateArgs returns the `ilab model evaluate` arguments of a run evaluating model
+func (w *Worker) evaluateArgs(params evaluationParams, model string) []string {
+	args := w.ilabArgs(ilabEvaluate, "--benchmark", params.Benchmark, "--model", model)
+	if params.branchBenchmark() {
+		args = append(args,
+			"--base-model", params.BaseModel,
+			"--branch", params.Branch,
+			"--base-branch", params.BaseBranch,
+			"--taxonomy-path", w.taxonomyDir)
+	}
+	return args
+}
+
+// runEvaluateCommand runs `ilab model evaluate`, keeping its output in logFilename
+func (w *Worker) runEvaluateCommand(lab, workDir, outputDir, logFilename string, args []string) (string, error) {
+	logFile, err := os.Create(filepath.Join(outputDir, logFilename))
+	if err != nil {
+		return "", fmt.Errorf("could not create %s: %w", logFilename, err)
+	}
+	defer logFile.Close()
+
+	var out bytes.Buffer
+	cmd := w.ilabCommand(lab, workDir, args...)
+	cmd.Stdout = io.MultiWriter(&out, logFile, os.Stdout)
+	cmd.Stderr = io.MultiWriter(logFile, os.Stderr)
+	w.cmdRun = cmd.String()
+	w.logger.Infof("Running the evaluate command: %s", w.cmdRun)
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("error running command (%s): %v. \nDetails: %s", w.cmdRun, err, lastLines(out.String(), trainLogErrorLines))
+	}
+	return out.String(), nil
+}
+
+// runEvaluate scores the model against the base model and writes the comparison into the
+// output directory and the job summary
+func (w *Worker) runEvaluate(lab, workDir, outputDir, prNumber string) error {
+	params, err := w.loadEvaluationParams(prNumber)
+	if err != nil {
+		return err
+	}
+
+	result := evaluationResult{evaluationParams: params}
+	if params.branchBenchmark() {
+		report, err := w.runEvaluateCommand(lab, workDir, outputDir, "evaluate.log", w.evaluateArgs(params, params.Model))
+		if err != nil {
+			return err
+		}
+		result.Scores = parseBranchScores(parseEvaluationReport(report))
+	} else {
+		newReport, err := w.runEvaluateCommand(lab, workDir, outputDir, "evaluate.log", w.evaluateArgs(params, params.Model))
+		if err != nil {
+			return err
+		}
+		baseReport, err := w.runEvaluateCommand(lab, workDir, outputDir, "evaluate_base.log", w.evaluateArgs(params, params.BaseModel))
+		if err != nil {
+			return err
+		}
+		result.Scores = mergeEvaluationScores(
+			parseModelScores(parseEvaluationReport(baseReport)),
+			parseModelScores(parseEvaluationReport(newReport)))
+	}
+	if len(result.Scores) == 0 {
+		return fmt.Errorf("no scores found in the %s evaluation output", params.Benchmark)
+	}
+
+	resultJSON, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not marshal evaluation results: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(outputDir, evaluationFilename), resultJSON, 0644); err != nil {
+		return fmt.Errorf("could not write evaluation results: %w", err)
+	}
+	if err := w.writeSummary(outputDir, evaluationSummaryFilename, evaluationMarkdownSummary(result)); err != nil {
+		w.logger.Errorf("Could not write evaluation summary: %v", err)
+	}
+	if params.branchBenchmark() {
+		if err := w.recordAreaScores(evaluationAreaScores(result.Scores)); err != nil {
+			w.logger.Errorf("Could not record the area scores: %v", err)
+		}
+	}
+	return nil
+}
+
+// parseEvaluationReport splits the report printed by `ilab model evaluate` into its
+// `### NAME:` sections
+func parseEvaluationReport(report string) map[string][]string {
+	sections := make(map[string][]string)
+	current := ""
+	for _, line := range strings.Split(report, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "#") {
+			current = ""
+			if strings.HasPrefix(line, "### ") && strings.HasSuffix(line, ":") {
+				current = strings.TrimSuffix(strings.TrimPrefix(line, "### "), ":")
+				sections[current] = nil
+			}
+			continue
+		}
+		if current != "" && line != "" {
+			sections[current] = append(sections[current], line)
+		}
+	}
+	return sections
+}
+
+// parseModelScores reads the scores of a single model report: the average, the MT-Bench
+// turns and the MMLU task scores
+func parseModelScores(sections map[string][]string) []evaluationScore {
+	var scores []evaluationScore
+	for _, section := range []string{"AVERAGE", "TURN ONE", "TURN TWO"} {
+		lines := sections[section]
+		if len(lines) == 0 {
+			continue
+		}
+		if value, ok := parseScore(strings.Fields(lines[0])[0]); ok {
+			scores = append(scores, evaluationScore{Name: strings.ToLower(section), New: value})
+		}
+	}
+	for _, line := range sections["SCORES"] {
+		name, value, found := strings.Cut(line, " - ")
+		if !found {
+			continue
+		}
+		if score, ok := parseScore(strings.TrimSpace(value)); ok {
+			scores = append(scores, evaluationScore{Name: strings.TrimSpace(name), New: score})
+		}
+	}
+	return scores
+}
+
+// parseBranchScores reads the per taxonomy file scores of a branch report
+func parseBranchScores(sections map[string][]string) []evaluationScore {
+	var scores []evaluationScore
+	for _, section := range []string{"IMPROVEMENTS", "REGRESSIONS", "NO CHANGE", "NEW"} {
+		for _, line := range sections[section] {
+			match := evaluationBranchEntry.FindStringSubmatch(line)
+			if match == nil {
+				continue
+			}
+			score := evaluationScore{Name: strings.TrimSpace(match[1])}
+			switch {
+			case match[3] != "":
+				score.Base, _ = parseScore(match[2])
+				score.New, _ = parseScore(match[3])
+			case match[2] != "" && section == "NEW":
+				score.New, _ = parseScore(match[2])
+			case match[2] != "":
+				// Unchanged entries have a single score for both branches
+				score.Base, _ = parseScore(match[2])
+				score.New = score.Base
+			}
+			scores = append(scores, score)
+		}
+	}
+	return scores
+}
+
+func parseScore(text string) (*float64, bool) {
+	value, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return nil, false
+	}
+	return &value, true
+}
+
+// mergeEvaluationScores pairs the scores of the base and the new model by name, in the order
+// of the new model report
+func mergeEvaluationScores(base, candidate []evaluationScore) []evaluationScore {
+	baseScores := make(map[string]*float64, len(base))
+	for _, score := range base {
+		baseScores[score.Name] = score.New
+	}
+	merged := make([]evaluationScore, 0, len(candidate))
+	seen := make(map[string]bool, len(candidate))
+	for _, score := range candidate {
+		merged = append(merged, evaluationScore{Name: score.Name, Base: baseScores[score.Name], New: score.New})
+		seen[score.Name] = true
+	}
+	for _, score := range base {
+		if !seen[score.Name] {
+			merged = append(merged, evaluationScore{Name: score.Name, Base: score.New})
+		}
+	}
+	return merged
+}
+
+// evaluationMarkdownSummary renders the scores of both models as a markdown table
+func evaluationMarkdownSummary(result evaluationResult) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "### Evaluation summary (%s)\n\n", result.Benchmark)
+	fmt.Fprintf(&sb, "**Model:** `%s`, **base model:** `%s`", result.Model, result.BaseModel)
+	if result.branchBenchmark() {
+		fmt.Fprintf(&sb, ", **branch:** `%s`, **base branch:** `%s`", result.Branch, result.BaseBranch)
+	}
+	sb.WriteString("\n\n| Score | Base | New | Change |\n|-------|------|-----|--------|\n")
+
+	formatScore := func(value *float64) string {
+		if value == nil {
+			return "-"
+		}
+		return fmt.Sprintf("%.3f", *value)
+	}
+	for i, score := range result.Scores {
+		change := "-"
+		if delta, ok := score.delta(); ok {
+			change = fmt.Sprintf("%+.3f", delta)
+		}
+		row := fmt.Sprintf("| %s | %s | %s | %s |\n", markdownCell(score.Name, 0), formatScore(score.Base), formatScore(score.New), change)
+		if sb.Len()+len(row) > maxSummaryLength {
+			fmt.Fprintf(&sb, "\n_%d more scores are available in the full results._\n", len(result.Scores)-i)
+			break
+		}
+		sb.WriteString(row)
+	}
+	return sb.String()
+}
@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func score(value float64) *float64 {
+	return &value
+}
+
+// TestParseModelScores verify the MMLU and MT-Bench reports of a single model are read.
+func TestParseModelScores(t *testing.T) {
+	mmlu := `# KNOWLEDGE EVALUATION REPORT
+
+## MODEL
+models/granite-7b-lab
+
+### AVERAGE:
+0.45 (across 2)
+
+### SCORES:
+mmlu_abstract_algebra - 0.3
+mmlu_anatomy - 0.6
+`
+	assert.Equal(t, []evaluationScore{
+		{Name: "average", New: score(0.45)},
+		{Name: "mmlu_abstract_algebra", New: score(0.3)},
+		{Name: "mmlu_anatomy", New: score(0.6)},
+	}, parseModelScores(parseEvaluationReport(mmlu)))
+
+	mtBench := `# SKILL EVALUATION REPORT
+
+## MODEL
+models/granite-7b-lab
+
+### AVERAGE:
+6.5 (across 80)
+
+### TURN ONE:
+7.0
+
+### TURN TWO:
+6.0
+`
+	assert.Equal(t, []evaluationScore{
+		{Name: "average", New: score(6.5)},
+		{Name: "turn one", New: score(7.0)},
+		{Name: "turn two", New: score(6.0)},
+	}, parseModelScores(parseEvaluationReport(mtBench)))
+
+	assert.Empty(t, parseModelScores(parseEvaluationReport("Traceback (most recent call last):")))
+}
+
+// TestParseBranchScores verify the per file changes of a branch report are read.
+func TestParseBranchScores(t *testing.T) {
+	report := `# SKILL EVALUATION REPORT
+
+## BASE MODEL
+models/base
+
+## MODEL
+models/new
+
+### AVERAGE:
++1.0 (across 3)
+
+### IMPROVEMENTS:
+1. compositional_skills/writing/qna.yaml: 5.0 -> 7.0 (+2.0)
+
+### REGRESSIONS:
+1. compositional_skills/math/qna.yaml: 6.0 -> 5.0 (-1.0)
+
+### NO CHANGE:
+1. compositional_skills/poems/qna.yaml
+
+### NEW:
+1. compositional_skills/jokes/qna.yaml: 8.0
+`
+	assert.Equal(t, []evaluationScore{
+		{Name: "compositional_skills/writing/qna.yaml", Base: score(5.0), New: score(7.0)},
+		{Name: "compositional_skills/math/qna.yaml", Base: score(6.0), New: score(5.0)},
+		{Name: "compositional_skills/poems/qna.yaml"},
+		{Name: "compositional_skills/jokes/qna.yaml", New: score(8.0)},
+	}, parseBranchScores(parseEvaluationReport(report)))
+}
+
+// TestMergeEvaluationScores verify the scores of both models are paired by name.
+func TestMergeEvaluationScores(t *testing.T) {
+	base := []evaluationScore{{Name: "average", New: score(0.4)}, {Name: "mmlu_anatomy", New: score(0.5)}}
+	candidate := []evaluationScore{{Name: "average", New: score(0.45)}, {Name: "mmlu_astronomy", New: score(0.7)}}
+	assert.Equal(t, []evaluationScore{
+		{Name: "average", Base: score(0.4), New: score(0.45)},
+		{Name: "mmlu_astronomy", New: score(0.7)},
+		{Name: "mmlu_anatomy", Base: score(0.5)},
+	}, mergeEvaluationScores(base, candidate))
+}
+
+// TestEvaluationMarkdownSummary verify the comparison table of both models.
+func TestEvaluationMarkdownSummary(t *testing.T) {
+	summary := evaluationMarkdownSummary(evaluationResult{
+		evaluationParams: evaluationParams{Benchmark: "mt_bench_branch", Model: "new", BaseModel: "base", Branch: "pr-1", BaseBranch: "main"},
+		Scores: []evaluationScore{
+			{Name: "writing|qna.yaml", Base: score(5), New: score(7)},
+			{Name: "jokes/qna.yaml", New: score(8)},
+		},
+	})
+	assert.Contains(t, summary, "### Evaluation summary (mt_bench_branch)")
+	assert.Contains(t, summary, "**branch:** `pr-1`, **base branch:** `main`")
+	assert.Contains(t, summary, "| writing\\|qna.yaml | 5.000 | 7.000 | +2.000 |")
+	assert.Contains(t, summary, "| jokes/qna.yaml | - | 8.000 | - |")
+}
@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"errors"
+	"io"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// executor runs the ilab commands of the jobs, on the worker host, in a container or in a Kubernetes Job
+type executor interface {
+	run(c *ilabCommand) error
+	// describe returns the command line executed for c, for the logs and the job results
+	describe(c *ilabCommand) string
+}
+
+// ilabCommand is an ilab command of a job, run by the executor of the job type. Like an exec.Cmd,
+// its output goes to Stdout and Stderr, and is discarded when they are nil.
+type ilabCommand struct {
+	w    *Worker
+	exec executor
+	lab  string
+	// dir is the working directory of the command, empty is the current directory
+	dir    string
+	args   []string
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// ilabCommand returns the ilab command args of the job, running in dir
+func (w *Worker) ilabCommand(lab, dir string, args ...string) *ilabCommand {
+	return &ilabCommand{w: w, exec: executorFor(w.jobType), lab: lab, dir: dir, args: args}
+}
+
+func (c *ilabCommand) Run() error {
+	start := time.Now()
+	err := c.exec.run(c)
+	c.w.logStep("ilab "+strings.Join(c.args, " "), start, err)
+	return err
+}
+
+func (c *ilabCommand) String() string {
+	return c.exec.describe(c)
+}
+
+// executorFor returns the executor of the job type. The config of the job type wins over the
+// default one, a Kubernetes config over a container one.
+func executorFor(jobType string) executor {
+	for _, key := range []string{jobType, defaultEnvPolicy} {
+		if cfg, ok := ilabKubernetes[key]; ok {
+			return kubernetesExecutor{cfg: cfg}
+		}
+		if cfg, ok := ilabContainers[key]; ok {
+			return containerExecutor{cfg: cfg}
+		}
+	}
+	return localExecutor{}
+}
+
+// commandFailed reports whether err is an ilab command that ran and exited with an error, rather
+// than one that could not run
+func commandFailed(err error) bool {
+	var exitErr *exec.ExitError
+	var jobErr *kubernetesJobFailed
+	return errors.As(err, &exitErr) || errors.As(err, &jobErr)
+}
+
+// localExecutor runs the ilab commands on the worker host
+type localExecutor struct{}
+
+func (localExecutor) command(c *ilabCommand) *exec.Cmd {
+	cmd := exec.CommandContext(c.w.ctx, c.lab, c.args...)
+	cmd.Dir = c.dir
+	cmd.Env = c.w.subprocessEnv()
+	cmd.Stdout = c.Stdout
+	cmd.Stderr = c.Stderr
+	return cmd
+}
+
+func (e localExecutor) run(c *ilabCommand) error {
+	return e.command(c).Run()
+}
+
+func (e localExecutor) describe(c *ilabCommand) string {
+	return e.command(c).String()
+}
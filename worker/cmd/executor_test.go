@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestExecutorFor verify the config of the job type wins over the default one, and Kubernetes over containers.
+func TestExecutorFor(t *testing.T) {
+	defer func() { ilabContainers, ilabKubernetes = nil, nil }()
+	assert.Equal(t, localExecutor{}, executorFor(jobTrain))
+
+	ilabContainers = map[string]containerConfig{
+		defaultEnvPolicy: {Image: "ilab:default"},
+		jobTrain:         {Image: "ilab:train"},
+	}
+	assert.Equal(t, containerExecutor{cfg: containerConfig{Image: "ilab:train"}}, executorFor(jobTrain))
+	assert.Equal(t, containerExecutor{cfg: containerConfig{Image: "ilab:default"}}, executorFor(jobGenerateLocal))
+
+	ilabKubernetes = map[string]kubernetesConfig{jobTrain: {Image: "ilab:gpu", WorkClaim: "work"}}
+	assert.Equal(t, kubernetesExecutor{cfg: kubernetesConfig{Image: "ilab:gpu", WorkClaim: "work"}}, executorFor(jobTrain))
+	assert.Equal(t, containerExecutor{cfg: containerConfig{Image: "ilab:default"}}, executorFor(jobGenerateLocal))
+}
+
+// TestLocalCommand verify ilab runs on the host in the directory of the command.
+func TestLocalCommand(t *testing.T) {
+	w := &Worker{ctx: context.Background(), job: "7", jobType: jobTrain}
+	cmd := localExecutor{}.command(w.ilabCommand("/venv/bin/ilab", "/work", "train"))
+	assert.Equal(t, []string{"/venv/bin/ilab", "train"}, cmd.Args)
+	assert.Equal(t, "/work", cmd.Dir)
+}
+
+// TestCommandFailed verify commands that ran and failed are told apart from commands that could not run.
+func TestCommandFailed(t *testing.T) {
+	assert.True(t, commandFailed(fmt.Errorf("diff: %w", &kubernetesJobFailed{name: "ilab-job-1"})))
+	assert.True(t, commandFailed(&exec.ExitError{}))
+	assert.False(t, commandFailed(errors.New("executable file not found")))
+	assert.False(t, commandFailed(nil))
+}
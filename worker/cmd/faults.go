@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Faults the worker can be told to hit with --inject-fault, so that the retries, the error
+// reports and the partial artifacts of failed jobs can be tested end to end in staging
+const (
+	// faultS3Upload fails every upload to S3
+	faultS3Upload = "s3-upload"
+	// faultSDG500 answers every SDG request with a 500
+	faultSDG500 = "sdg-500"
+	// faultGitTimeout times out every fetch of the taxonomy
+	faultGitTimeout = "git-timeout"
+)
+
+var knownFaults = map[string]bool{
+	faultS3Upload:   true,
+	faultSDG500:     true,
+	faultGitTimeout: true,
+}
+
+// errInjectedFault is the cause of the failures injected by --inject-fault
+var errInjectedFault = errors.New("injected fault")
+
+// validateFaults checks the --inject-fault flag
+func validateFaults(faults []string) error {
+	for _, fault := range faults {
+		if !knownFaults[fault] {
+			names := make([]string, 0, len(knownFaults))
+			for name := range knownFaults {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return fmt.Errorf("unknown fault %q in --inject-fault, expected %s", fault, strings.Join(names, ", "))
+		}
+	}
+	return nil
+}
+
+// faultInjected reports whether the worker was told to hit fault
+func faultInjected(fault string) bool {
+	for _, injected := range InjectFaults {
+		if injected == fault {
+			return true
+		}
+	}
+	return false
+}
+
+// injectedFault is the error of an injected fault, categorized the way the real failure is
+func injectedFault(fault string) error {
+	switch fault {
+	case faultGitTimeout:
+		return fmt.Errorf("%w %s: %w", errInjectedFault, fault, context.DeadlineExceeded)
+	default:
+		return fmt.Errorf("%w %s", errInjectedFault, fault)
+	}
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// TestValidateFaults verify only the known faults can be injected.
+func TestValidateFaults(t *testing.T) {
+	assert.NoError(t, validateFaults(nil))
+	assert.NoError(t, validateFaults([]string{faultS3Upload, faultSDG500, faultGitTimeout}))
+	assert.ErrorContains(t, validateFaults([]string{"redis"}), "expected git-timeout, s3-upload, sdg-500")
+}
+
+// TestInjectedFaults verify the injected faults fail the stages they target after their retries,
+// categorized like the real failures.
+func TestInjectedFaults(t *testing.T) {
+	defer saveSDGRequestSettings()()
+	retries, backoff := S3UploadRetries, S3UploadRetryBackoff
+	defer func() {
+		InjectFaults = nil
+		S3UploadRetries, S3UploadRetryBackoff = retries, backoff
+	}()
+	InjectFaults = []string{faultS3Upload, faultSDG500, faultGitTimeout}
+	SdgMaxRetries, SdgRetryBackoff = 2, 0
+	S3UploadRetries, S3UploadRetryBackoff = 1, 0
+
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+	}))
+	defer server.Close()
+	w := &Worker{logger: zap.NewNop().Sugar()}
+	_, err := w.postSDGRequest(context.Background(), server.Client(), server.URL+"/skill", []byte(`{}`))
+	assert.ErrorIs(t, err, errInjectedFault)
+	assert.ErrorContains(t, err, "unexpected status code 500")
+	assert.Zero(t, requests.Load())
+
+	file := filepath.Join(t.TempDir(), "generated.json")
+	require.NoError(t, os.WriteFile(file, []byte("{}"), 0o644))
+	err = uploadFile(context.Background(), nil, "generated.json", file, "application/json", "", zap.NewNop().Sugar())
+	assert.ErrorIs(t, err, errInjectedFault)
+
+	err = injectedFault(faultGitTimeout)
+	assert.True(t, errors.Is(err, errInjectedFault))
+	assert.Equal(t, errorTimeout, errorCategoryOf(err))
+}
@@ -0,0 +1,190 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	OutputKeepLast int
+	OutputMaxAge   time.Duration
+	GcDryRun       bool
+)
+
+// outputDirPattern matches the output directories of the jobs, <type>-pr-<n>-<sha> and
+// <type>-branch-<branch>-<sha>
+var outputDirPattern = regexp.MustCompile(`^(` + jobSDG + `|` + jobGenerateLocal + `|` + jobPreCheck + `|` + jobTrain + `|` + jobEvaluate + `)-(pr-[0-9]+|branch-.+)-[0-9a-f]{7,40}$`)
+
+func init() {
+	gcCmd.Flags().BoolVarP(&GcDryRun, "dry-run", "", false, "List the directories that would be removed without removing them")
+	rootCmd.AddCommand(gcCmd)
+}
+
+var gcCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Remove the job output directories of the work directory past --output-keep-last or --output-max-age.",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		workDir := WorkDir
+		if workDir == "" {
+			workDir = "."
+		}
+		dirs, err := listOutputDirs(workDir)
+		if err != nil {
+			return err
+		}
+		expired := expiredOutputDirs(dirs, OutputKeepLast, OutputMaxAge, time.Now(), "")
+		if !GcDryRun {
+			if expired, err = removeOutputDirs(expired); err != nil {
+				return err
+			}
+		}
+		writeGcReport(cmd.OutOrStdout(), dirs, expired, GcDryRun, time.Now())
+		return nil
+	},
+}
+
+// jobOutputDir is an output directory of a job in the work directory
+type jobOutputDir struct {
+	Path    string
+	ModTime time.Time
+	Size    int64
+}
+
+// listOutputDirs returns the job output directories of the work directory, the most recent first
+func listOutputDirs(workDir string) ([]jobOutputDir, error) {
+	entries, err := os.ReadDir(workDir)
+	if err != nil {
+		return nil, fmt.Errorf("could not read the work directory: %w", err)
+	}
+	var dirs []jobOutputDir
+	for _, entry := range entries {
+		if !entry.IsDir() || !outputDirPattern.MatchString(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		dir := jobOutputDir{Path: filepath.Join(workDir, entry.Name()), ModTime: info.ModTime()}
+		_ = filepath.WalkDir(dir.Path, func(_ string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return nil
+			}
+			if info, err := d.Info(); err == nil {
+				dir.Size += info.Size()
+			}
+			return nil
+		})
+		dirs = append(dirs, dir)
+	}
+	sort.SliceStable(dirs, func(i, j int) bool { return dirs[i].ModTime.After(dirs[j].ModTime) })
+	return dirs, nil
+}
+
+// expiredOutputDirs returns the directories past the keepLast most recent ones or older than
+// maxAge, never keep. 0 disables either limit.
+func expiredOutputDirs(dirs []jobOutputDir, keepLast int, maxAge time.Duration, now time.Time, keep string) []jobOutputDir {
+	var expired []jobOutputDir
+	for i, dir := range dirs {
+		if dir.Path == keep {
+			continue
+		}
+		if (keepLast > 0 && i >= keepLast) || (maxAge > 0 && now.Sub(dir.ModTime) > maxAge) {
+			expired = append(expired, dir)
+		}
+	}
+	return expired
+}
+
+// removeOutputDirs removes the directories and returns the ones removed, with the first error
+func removeOutputDirs(dirs []jobOutputDir) ([]jobOutputDir, error) {
+	var removed []jobOutputDir
+	var firstErr error
+	for _, dir := range dirs {
+		if err := os.RemoveAll(dir.Path); err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("could not remove %s: %w", dir.Path, err)
+			}
+			continue
+		}
+		removed = append(removed, dir)
+	}
+	return removed, firstErr
+}
+
+// writeGcReport lists the output directories with their size and age, and the space reclaimed
+func writeGcReport(out io.Writer, dirs, removed []jobOutputDir, dryRun bool, now time.Time) {
+	isRemoved := make(map[string]bool)
+	var freed, total int64
+	for _, dir := range removed {
+		isRemoved[dir.Path] = true
+		freed += dir.Size
+	}
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "DIRECTORY\tSIZE\tAGE\tSTATUS")
+	for _, dir := range dirs {
+		total += dir.Size
+		status := ""
+		if isRemoved[dir.Path] {
+			status = "removed"
+			if dryRun {
+				status = "would be removed"
+			}
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", filepath.Base(dir.Path), formatBytes(dir.Size), now.Sub(dir.ModTime).Truncate(time.Minute), status)
+	}
+	_ = tw.Flush()
+	verb := "Removed"
+	if dryRun {
+		verb = "Would remove"
+	}
+	fmt.Fprintf(out, "%s %d of %d directories, %s of %s\n", verb, len(removed), len(dirs), formatBytes(freed), formatBytes(total))
+}
+
+// formatBytes formats a size in bytes with binary units, 1.5 GiB
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// collectOutputDirs removes the output directories of the earlier jobs past the retention of the
+// worker, once the results of the job are uploaded. The directory of the job is always kept.
+func (w *Worker) collectOutputDirs(outputDir string) {
+	if OutputKeepLast <= 0 && OutputMaxAge <= 0 {
+		return
+	}
+	dirs, err := listOutputDirs(filepath.Dir(outputDir))
+	if err != nil {
+		w.logger.Errorf("Could not list the output directories: %v", err)
+		return
+	}
+	removed, err := removeOutputDirs(expiredOutputDirs(dirs, OutputKeepLast, OutputMaxAge, time.Now(), outputDir))
+	if err != nil {
+		w.logger.Errorf("Could not remove the old output directories: %v", err)
+	}
+	if len(removed) > 0 {
+		var freed int64
+		for _, dir := range removed {
+			freed += dir.Size
+		}
+		w.logger.Infof("Removed %d old output directories, %s", len(removed), formatBytes(freed))
+	}
+}
@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestListOutputDirs verify only the job output directories are listed, the most recent first, with their size.
+func TestListOutputDirs(t *testing.T) {
+	workDir := t.TempDir()
+	now := time.Now()
+	for i, name := range []string{"precheck-pr-1-abc1234", "generate-branch-main-def5678", "taxonomy", "precheck-pr-x-abc1234"} {
+		dir := filepath.Join(workDir, name)
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, "sub"), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "sub", "file.txt"), bytes.Repeat([]byte("a"), 100*(i+1)), 0644))
+		require.NoError(t, os.Chtimes(dir, now, now.Add(-time.Duration(i)*time.Hour)))
+	}
+
+	dirs, err := listOutputDirs(workDir)
+	require.NoError(t, err)
+	require.Len(t, dirs, 2)
+	assert.Equal(t, filepath.Join(workDir, "precheck-pr-1-abc1234"), dirs[0].Path)
+	assert.Equal(t, int64(100), dirs[0].Size)
+	assert.Equal(t, filepath.Join(workDir, "generate-branch-main-def5678"), dirs[1].Path)
+	assert.Equal(t, int64(200), dirs[1].Size)
+}
+
+// TestExpiredOutputDirs verify the directories past the most recent ones or too old expire, never the kept one.
+func TestExpiredOutputDirs(t *testing.T) {
+	now := time.Now()
+	dirs := []jobOutputDir{
+		{Path: "a", ModTime: now},
+		{Path: "b", ModTime: now.Add(-time.Hour)},
+		{Path: "c", ModTime: now.Add(-48 * time.Hour)},
+		{Path: "d", ModTime: now.Add(-72 * time.Hour)},
+	}
+	paths := func(dirs []jobOutputDir) []string {
+		var paths []string
+		for _, dir := range dirs {
+			paths = append(paths, dir.Path)
+		}
+		return paths
+	}
+
+	assert.Empty(t, expiredOutputDirs(dirs, 0, 0, now, ""))
+	assert.Equal(t, []string{"c", "d"}, paths(expiredOutputDirs(dirs, 2, 0, now, "")))
+	assert.Equal(t, []string{"c", "d"}, paths(expiredOutputDirs(dirs, 0, 24*time.Hour, now, "")))
+	assert.Equal(t, []string{"b", "c", "d"}, paths(expiredOutputDirs(dirs, 1, 24*time.Hour, now, "")))
+	assert.Equal(t, []string{"c"}, paths(expiredOutputDirs(dirs, 2, 0, now, "d")))
+}
+
+// TestGcReport verify the report gives the size of the directories and the space reclaimed.
+func TestGcReport(t *testing.T) {
+	now := time.Now()
+	dirs := []jobOutputDir{
+		{Path: "/w/precheck-pr-1-abc1234", ModTime: now.Add(-time.Hour), Size: 2048},
+		{Path: "/w/precheck-pr-2-abc1234", ModTime: now.Add(-2 * time.Hour), Size: 3 * 1024 * 1024},
+	}
+	var out bytes.Buffer
+	writeGcReport(&out, dirs, dirs[1:], true, now)
+	assert.Contains(t, out.String(), "precheck-pr-2-abc1234  3.0 MiB  2h0m0s  would be removed")
+	assert.Contains(t, out.String(), "Would remove 1 of 2 directories, 3.0 MiB of 3.0 MiB")
+
+	assert.Equal(t, "512 B", formatBytes(512))
+	assert.Equal(t, "1.5 KiB", formatBytes(1536))
+	assert.Equal(t, "2.0 GiB", formatBytes(2<<30))
+}
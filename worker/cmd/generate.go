@@ -12,46 +12,129 @@ import (
 	"math"
 	"net/http"
 	"os"
-	"os/exec"
 	"os/signal"
 	"path"
 	"path/filepath"
 	"strings"
 	"sync"
-	"syscall"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/go-git/go-git/v5"
 	gitconfig "github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
 	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
-	"github.com/gomodule/redigo/redis"
+	"github.com/instructlab/instructlab-bot/pkg/controlplane"
+	"github.com/instructlab/instructlab-bot/pkg/jobqueue"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"go.uber.org/zap"
 	"gopkg.in/yaml.v2"
 )
 
 var (
-	WorkDir             string
-	VenvDir             string
-	PreCheckEndpointURL string
-	SdgEndpointURL      string
-	NumInstructions     int
-	GitRemote           string
-	Origin              string
-	GithubUsername      string
-	GithubToken         string
-	S3Bucket            string
-	AWSRegion           string
-	TlsClientCertPath   string
-	TlsClientKeyPath    string
-	TlsServerCaCertPath string
-	TlsInsecure         bool
-	MaxSeed             int
-	TaxonomyFolders     = []string{"compositional_skills", "knowledge"}
+	WorkDir                   string
+	VenvDir                   string
+	PreCheckEndpointURL       string
+	SdgEndpointURL            string
+	NumInstructions           int
+	GitRemote                 string
+	Origin                    string
+	GithubUsername            string
+	GithubToken               string
+	S3Bucket                  string
+	S3KeyPrefix               string
+	S3SSE                     string
+	S3SSEKMSKeyID             string
+	S3ObjectTags              bool
+	S3DatasetStorageClass     string
+	S3ReportStorageClass      string
+	S3EndpointURL             string
+	S3PathStyle               bool
+	S3PublicURL               string
+	S3UploadPartSizeMB        int
+	S3UploadRetries           int
+	S3UploadRetryBackoff      time.Duration
+	AWSRegion                 string
+	TlsClientCertPath         string
+	TlsClientKeyPath          string
+	TlsServerCaCertPath       string
+	TlsInsecure               bool
+	MaxSeed                   int
+	MaxSeedStrategy           string
+	MaxSeedRandomSeed         int64
+	YamlMaxLineLength         int
+	KnowledgeMaxDocBytes      int64
+	ComplianceLicenses        = []string{"CC-BY-4.0", "CC-BY-SA-4.0", "CC0-1.0", "Apache-2.0", "MIT"}
+	PrecheckAPIKey            string
+	PrecheckRequestTimeout    time.Duration
+	PrecheckMaxRetries        int
+	PrecheckRetryBackoff      time.Duration
+	PrecheckFailureBudget     float64
+	PrecheckTemperature       float64
+	PrecheckMaxTokens         int
+	PrecheckTopP              float64
+	PrecheckSystemPrompt      string
+	PrecheckCacheTTL          time.Duration
+	PrecheckHistoryTTL        time.Duration
+	PrecheckQuestionTimeout   time.Duration
+	PrecheckMaxAnswerLength   int
+	PrecheckAnswerTruncation  string
+	PrecheckLanguageCheck     bool
+	PrecheckBatchSize         int
+	PrecheckEndpointStrategy  string
+	PrecheckEndpointCooldown  time.Duration
+	PrecheckHealthInterval    time.Duration
+	PrecheckWarmupTimeout     time.Duration
+	PrecheckMaxFiles          int
+	PrecheckMaxQuestions      int
+	PrecheckOversizeAction    string
+	CostPer1KPromptTokens     float64
+	CostPer1KCompletionTokens float64
+	CostCurrency              string
+	EmbeddingsEndpointURL     string
+	EmbeddingsModel           string
+	EmbeddingsAPIKey          string
+	SdgAuthMode               string
+	SdgToken                  string
+	SdgAPIKeyHeader           string
+	SdgRequestTimeout         time.Duration
+	SdgMaxRetries             int
+	SdgRetryBackoff           time.Duration
+	SdgPollInterval           time.Duration
+	SdgPollTimeout            time.Duration
+	SdgConcurrency            int
+	SdgModel                  string
+	SdgKnowledgeEndpointURL   string
+	GeneratePipeline          string
+	GenerateSdgScaleFactor    int
+	GenerateChunkWordCount    int
+	DedupDataset              bool
+	DedupMaxDistance          int
+	TrainNumEpochs            int
+	TrainIters                int
+	TrainDevice               string
+	TrainCheckpointDir        string
+	EvaluateBenchmark         string
+	EvaluateModel             string
+	EvaluateBaseModel         string
+	EvaluateBaseBranch        string
+	HealthPort                int
+	RedisMaxActive            int
+	RedisIdleTimeout          time.Duration
+	RedisRetryTimeout         time.Duration
+	ControlPlaneAddr          string
+	ControlPlaneTLSCert       string
+	ControlPlaneTLSKey        string
+	ControlPlaneTLSCA         string
+	WorkerName                string
+	InjectFaults              []string
+	ServeLocalModel           bool
+	ServeLocalModelPort       int
+	ServeLocalModelPath       string
+	ServeLocalReadyTimeout    time.Duration
+	TaxonomyFolders           = []string{"compositional_skills", "knowledge"}
 )
 
 const (
@@ -62,22 +145,17 @@ const (
 	jobSDG                   = "sdg-svc"
 	jobGenerateLocal         = "generate"
 	jobPreCheck              = "precheck"
-	sdgModel                 = "mistralai/mixtral-8x7b-instruct-v0-1"
+	jobTrain                 = "train"
+	jobEvaluate              = "evaluate"
+	defaultSdgModel          = "mistralai/mixtral-8x7b-instruct-v0-1"
 	jsonViewerFilenameSuffix = "-viewer.html"
 	ctxPrompt                = "Answer this based on the following context:"
 )
 
-const (
-	jobStatusSuccess = "success"
-	jobStatusError   = "error"
-	jobStatusRunning = "running"
-	jobStatusPending = "pending"
-)
-
 // Worker encapsulates dependencies and methods to process jobs
 type Worker struct {
 	ctx                 context.Context
-	pool                *redis.Pool
+	queue               *jobqueue.Client
 	svc                 *s3.Client
 	logger              *zap.SugaredLogger
 	job                 string
@@ -89,12 +167,62 @@ type Worker struct {
 	tlsServerCaCertPath string
 	maxSeed             int
 	cmdRun              string
+	gitRemote           string
+	taxonomyDir         string
+	s3Prefix            string
+	s3Tags              string
+	models              []string
+	genParams           generationParams
+	pipelineParams      pipelineParams
+	numInstructions     int
+	// branch is set on scheduled jobs, which run against a branch of the taxonomy instead of a PR
+	branch string
+	// baseRef is the branch a PR is merged into and prSha the head of the PR the job was queued
+	// for, the job runs on that commit even when the PR was pushed to since
+	baseRef   string
+	prSha     string
+	jobType   string
+	envPolicy envPolicy
+	// jobHome holds the HOME and temporary directory of the ilab commands, when the job has its own
+	jobHome     string
+	ilabVersion ilabVersion
+	// ilabConfigFile is the ilab config rendered for the job, empty when the worker has none
+	ilabConfigFile string
+	// chatlogDir holds the chat logs of the job until they are moved to its output directory
+	chatlogDir string
+	// source and modelName are recorded in the provenance of the results
+	source    jobSource
+	modelName string
+	// jobLog is the structured log of the job, uploaded with its results
+	jobLog *jobLog
+	// metrics are published with the results of the job
+	metrics jobMetrics
+	// annotations are posted on the check run of the job, lint and compliance findings together
+	annotations []lintProblem
+	// dryRun jobs check the changed files and list their commands instead of running them
+	dryRun bool
+	// grounded prechecks ask the knowledge questions without their context too
+	grounded bool
+	// paraphrases is how many paraphrases of each question the precheck asks
+	paraphrases int
+	// prefetched are the answers of the batched precheck requests, keyed like the answer cache
+	prefetched map[string]*chatResult
+	// control is the control plane that assigned the job, nil when it was popped from Redis
+	control        *controlPlane
+	progressStream *controlplane.ProgressClient
+	// jobFields are the fields the control plane assigned the job with, and resultFields the
+	// fields the job sets, sent with its results
+	jobFields    map[jobqueue.Field]string
+	resultFields map[jobqueue.Field]interface{}
+	// progress is the last progress published, progressMu guards it and its publication
+	progressMu sync.Mutex
+	progress   jobProgress
 }
 
-func NewJobProcessor(ctx context.Context, pool *redis.Pool, svc *s3.Client, logger *zap.SugaredLogger, job, precheckEndpoint, sdgEndpoint, tlsClientCertPath, tlsClientKeyPath, tlsServerCaCertPath string, maxSeed int) *Worker {
+func NewJobProcessor(ctx context.Context, queue *jobqueue.Client, svc *s3.Client, logger *zap.SugaredLogger, job, precheckEndpoint, sdgEndpoint, tlsClientCertPath, tlsClientKeyPath, tlsServerCaCertPath string, maxSeed int) *Worker {
 	return &Worker{
 		ctx:                 ctx,
-		pool:                pool,
+		queue:               queue,
 		svc:                 svc,
 		logger:              logger,
 		job:                 job,
@@ -105,32 +233,125 @@ func NewJobProcessor(ctx context.Context, pool *redis.Pool, svc *s3.Client, logg
 		tlsClientKeyPath:    tlsClientKeyPath,
 		tlsServerCaCertPath: tlsServerCaCertPath,
 		maxSeed:             maxSeed,
+		gitRemote:           GitRemote,
 	}
 }
 
-type IlabConfig struct {
-	Generate struct {
-		Model string `yaml:"model"`
-	} `yaml:"generate"`
-}
-
 func init() {
 	generateCmd.Flags().StringVarP(&WorkDir, "work-dir", "w", "", "Directory to work in")
 	generateCmd.Flags().StringVarP(&VenvDir, "venv-dir", "v", "", "The virtual environment directory")
-	generateCmd.Flags().StringVarP(&PreCheckEndpointURL, "precheck-endpoint-url", "e", "", "Endpoint hosting the model API. Default, it assumes the model is served locally.")
-	generateCmd.Flags().StringVarP(&SdgEndpointURL, "sdg-endpoint-url", "", "http://localhost:8000/v1", "Endpoint hosting the model API. Default, it assumes the model is served locally.")
+	generateCmd.Flags().StringVarP(&PreCheckEndpointURL, "precheck-endpoint-url", "e", "", "Endpoint hosting the model API, or a comma separated list of endpoints serving the same model. Default, it assumes the model is served locally.")
+	generateCmd.Flags().StringVarP(&SdgEndpointURL, "sdg-endpoint-url", "", "http://localhost:8000/v1", "SDG endpoint for skills. Default, it assumes the model is served locally.")
+	generateCmd.Flags().StringVarP(&SdgKnowledgeEndpointURL, "sdg-knowledge-endpoint-url", "", "", "SDG endpoint for knowledge. Defaults to the skills endpoint with a trailing /skill replaced by /knowledge")
+	generateCmd.Flags().StringVarP(&SdgModel, "sdg-model", "", defaultSdgModel, "Model ID requested from the SDG service")
 	generateCmd.Flags().IntVarP(&NumInstructions, "num-instructions", "n", 10, "The number of instructions to generate")
-	generateCmd.Flags().StringVarP(&GitRemote, "git-remote", "", "https://github.com/instructlab/taxonomy", "The git remote for the taxonomy repo")
+	generateCmd.Flags().StringVarP(&GeneratePipeline, "generate-pipeline", "", "", "Pipeline of generate-local jobs, simple or full. Defaults to the ilab default")
+	generateCmd.Flags().IntVarP(&GenerateSdgScaleFactor, "generate-sdg-scale-factor", "", 0, "Number of instructions generated per seed example by generate-local jobs. 0 uses the ilab default")
+	generateCmd.Flags().IntVarP(&GenerateChunkWordCount, "generate-chunk-word-count", "", 0, "Number of words per chunk of knowledge documents in generate-local jobs. 0 uses the ilab default")
+	generateCmd.Flags().BoolVarP(&DedupDataset, "dedup-dataset", "", false, "Drop exact and near duplicate samples from the generated dataset before upload")
+	generateCmd.Flags().IntVarP(&DedupMaxDistance, "dedup-max-distance", "", 3, "Maximum simhash Hamming distance, out of 64 bits, of two samples considered near duplicates. Set to 0 to only drop exact duplicates")
+	generateCmd.Flags().IntVarP(&TrainNumEpochs, "train-num-epochs", "", 0, "Number of epochs of train jobs. 0 uses the ilab default")
+	generateCmd.Flags().IntVarP(&TrainIters, "train-iters", "", 0, "Number of iterations of train jobs. 0 uses the ilab default")
+	generateCmd.Flags().StringVarP(&TrainDevice, "train-device", "", "", "Device train jobs run on, for example cuda. Defaults to the ilab default")
+	generateCmd.Flags().StringVarP(&TrainCheckpointDir, "train-checkpoint-dir", "", "training_results", "Directory, relative to the work directory, where ilab train writes its checkpoints")
+	generateCmd.Flags().BoolVarP(&ServeLocalModel, "serve-local-model", "", false, "Start ilab serve before generate-local jobs, and precheck jobs without a precheck endpoint, and stop it after them")
+	generateCmd.Flags().IntVarP(&ServeLocalModelPort, "serve-local-model-port", "", 0, "Port of the model server started by --serve-local-model. 0 picks a free port")
+	generateCmd.Flags().StringVarP(&ServeLocalModelPath, "serve-local-model-path", "", "", "Model served by --serve-local-model. Defaults to the serve model of the ilab config")
+	generateCmd.Flags().DurationVarP(&ServeLocalReadyTimeout, "serve-local-ready-timeout", "", 5*time.Minute, "How long the model server started by --serve-local-model has to serve its model")
+	generateCmd.Flags().StringVarP(&EvaluateBenchmark, "evaluate-benchmark", "", "mmlu", "Benchmark of evaluate jobs: mmlu, mt_bench or mt_bench_branch")
+	generateCmd.Flags().StringVarP(&EvaluateModel, "evaluate-model", "", "", "Model or checkpoint evaluate jobs score, defaults to the evaluate model of the ilab config")
+	generateCmd.Flags().StringVarP(&EvaluateBaseModel, "evaluate-base-model", "", "", "Model evaluate jobs compare against, defaults to the evaluate base_model of the ilab config")
+	generateCmd.Flags().StringVarP(&EvaluateBaseBranch, "evaluate-base-branch", "", "main", "Taxonomy branch the PR is compared against by the branch benchmarks")
+	generateCmd.Flags().StringVarP(&GitRemote, "git-remote", "", "https://github.com/instructlab/taxonomy", "The default git remote for the taxonomy repo, used when a job does not specify one")
 	generateCmd.Flags().StringVarP(&Origin, "origin", "o", "origin", "The origin to fetch from")
 	generateCmd.Flags().StringVarP(&GithubUsername, "github-username", "u", "instructlab-bot", "The GitHub username to use for authentication")
 	generateCmd.Flags().StringVarP(&GithubToken, "github-token", "g", "", "The GitHub token to use for authentication")
 	generateCmd.Flags().StringVarP(&S3Bucket, "s3-bucket", "b", "instruct-lab-bot", "The S3 bucket to use")
+	generateCmd.Flags().StringVarP(&S3KeyPrefix, "s3-key-prefix", "", "", "Prefix of every key the worker uploads, for example prod/ or staging/ to share a bucket between environments")
+	generateCmd.Flags().StringVarP(&S3SSE, "s3-sse", "", "", "Server-side encryption of the uploads: sse-s3 or sse-kms. Defaults to the bucket default")
+	generateCmd.Flags().StringVarP(&S3SSEKMSKeyID, "s3-sse-kms-key-id", "", "", "KMS key ID of the sse-kms encryption. Defaults to the AWS managed key of S3")
+	generateCmd.Flags().BoolVarP(&S3ObjectTags, "s3-object-tags", "", true, "Tag the uploads with their job ID, PR or branch and repository. Needs the s3:PutObjectTagging permission")
+	generateCmd.Flags().StringVarP(&S3DatasetStorageClass, "s3-dataset-storage-class", "", "", "Storage class of the uploaded datasets, logs and other outputs such as STANDARD_IA or INTELLIGENT_TIERING. Defaults to the bucket default")
+	generateCmd.Flags().StringVarP(&S3ReportStorageClass, "s3-report-storage-class", "", "", "Storage class of the uploaded HTML reports and viewers such as STANDARD_IA or INTELLIGENT_TIERING. Defaults to the bucket default")
+	generateCmd.Flags().StringVarP(&S3EndpointURL, "s3-endpoint-url", "", "", "Endpoint of an S3 compatible storage such as MinIO. Defaults to AWS S3")
+	generateCmd.Flags().BoolVarP(&S3PathStyle, "s3-path-style", "", false, "Address the bucket in the path of the URLs rather than in the hostname")
+	generateCmd.Flags().StringVarP(&S3PublicURL, "s3-public-url", "", "", "Base URL of the links to the uploads, for example a CloudFront distribution in front of the bucket. Defaults to the bucket URL")
+	generateCmd.Flags().IntVarP(&S3UploadPartSizeMB, "s3-upload-part-size-mb", "", 16, "Size in MiB of the parts of the multipart uploads. The larger uploads are sent in parts, at least 5")
+	generateCmd.Flags().IntVarP(&S3UploadRetries, "s3-upload-retries", "", 3, "Number of times a failed or corrupted upload of a job file is retried, a multipart upload resumes from its last uploaded part")
+	generateCmd.Flags().DurationVarP(&S3UploadRetryBackoff, "s3-upload-retry-backoff", "", 2*time.Second, "Delay before the first retry of a failed upload, doubled on every further retry")
 	generateCmd.Flags().StringVarP(&AWSRegion, "aws-region", "a", "us-east-2", "The AWS region to use for the S3 Bucket")
 	generateCmd.Flags().StringVarP(&TlsClientCertPath, "tls-client-cert", "", "client-tls-crt.pem2", "Path to the TLS client certificate. Defaults to 'client-tls-crt.pem2'")
 	generateCmd.Flags().StringVarP(&TlsClientKeyPath, "tls-client-key", "", "client-tls-key.pem2", "Path to the TLS client key. Defaults to 'client-tls-key.pem2'")
 	generateCmd.Flags().StringVarP(&TlsServerCaCertPath, "tls-server-ca-cert", "", "server-ca-crt.pem2", "Path to the TLS server CA certificate. Defaults to 'server-ca-crt.pem2'")
+	generateCmd.Flags().DurationVarP(&SdgRequestTimeout, "sdg-request-timeout", "", 30*time.Minute, "Timeout for a single SDG request. Set to 0 to disable")
+	generateCmd.Flags().IntVarP(&SdgMaxRetries, "sdg-max-retries", "", 2, "Number of times an SDG request failing with a connection error or a 5xx response is retried")
+	generateCmd.Flags().DurationVarP(&SdgRetryBackoff, "sdg-retry-backoff", "", 5*time.Second, "Delay before the first retry of a failed SDG request, doubled on every further retry")
+	generateCmd.Flags().DurationVarP(&SdgPollInterval, "sdg-poll-interval", "", 10*time.Second, "How often an asynchronous SDG job is polled after the service answers 202 with a Location header")
+	generateCmd.Flags().DurationVarP(&SdgPollTimeout, "sdg-poll-timeout", "", 2*time.Hour, "How long an asynchronous SDG job is polled before giving up. Set to 0 to disable")
+	generateCmd.Flags().IntVarP(&SdgConcurrency, "sdg-concurrency", "", 4, "Maximum number of taxonomy files sent to the SDG service at the same time")
 	generateCmd.Flags().BoolVarP(&TlsInsecure, "tls-insecure", "", false, "Whether to skip TLS verification")
+	generateCmd.Flags().StringVarP(&SdgAuthMode, "sdg-auth-mode", "", sdgAuthMTLS, "How to authenticate to the SDG endpoint: mtls, bearer, api-key or none")
+	generateCmd.Flags().StringVarP(&SdgToken, "sdg-token", "", "", "Token sent to the SDG endpoint with the bearer and api-key auth modes")
+	generateCmd.Flags().StringVarP(&SdgAPIKeyHeader, "sdg-api-key-header", "", "X-API-Key", "Header carrying the SDG token with the api-key auth mode")
 	generateCmd.Flags().IntVarP(&MaxSeed, "max-seed", "m", 40, "Maximum number of seed Q&A pairs to process to SDG.")
+	generateCmd.Flags().StringSliceVarP(&TaxonomyFolders, "taxonomy-folders", "", TaxonomyFolders, "Top level folders of the taxonomy holding contributions, knowledge holds the knowledge ones and the others skills")
+	generateCmd.Flags().StringVarP(&MaxSeedStrategy, "max-seed-strategy", "", seedSampleFirst, "Seed Q&A pairs kept when a file has more than --max-seed: first, random or stratified, every context in turn")
+	generateCmd.Flags().Int64VarP(&MaxSeedRandomSeed, "max-seed-random-seed", "", 1, "Seed of the random --max-seed-strategy, the same seed keeps the same pairs")
+	generateCmd.Flags().StringVarP(&PrecheckAPIKey, "precheck-api-key", "", "", "API key sent as a bearer token to the precheck endpoint")
+	generateCmd.Flags().DurationVarP(&PrecheckRequestTimeout, "precheck-request-timeout", "", 2*time.Minute, "Timeout for a single precheck model request")
+	generateCmd.Flags().DurationVarP(&PrecheckQuestionTimeout, "precheck-question-timeout", "", 10*time.Minute, "Wall clock limit of a precheck question, its retries and failovers included. The question is reported as TIMEOUT past it. Set to 0 to disable the limit")
+	generateCmd.Flags().IntVarP(&PrecheckBatchSize, "precheck-batch-size", "", 1, "Number of precheck questions sent in a single request to a precheck endpoint supporting batch inference, vLLM-style. 1 sends a request per question")
+	generateCmd.Flags().IntVarP(&PrecheckMaxAnswerLength, "precheck-max-answer-length", "", 0, "Maximum number of characters of a precheck answer, see --precheck-answer-truncation. 0 disables the limit")
+	generateCmd.Flags().StringVarP(&PrecheckAnswerTruncation, "precheck-answer-truncation", "", answerLengthTruncate, "What precheck jobs do with an answer over --precheck-max-answer-length: truncate, to cut it at the limit, or flag, to keep it whole and flag it in the summary")
+	generateCmd.Flags().BoolVarP(&PrecheckLanguageCheck, "precheck-language-check", "", true, "Flag the precheck answers in another language than their question in the summary")
+	generateCmd.Flags().IntVarP(&PrecheckMaxRetries, "precheck-max-retries", "", 2, "Number of times a failed precheck model request is retried")
+	generateCmd.Flags().DurationVarP(&PrecheckRetryBackoff, "precheck-retry-backoff", "", 2*time.Second, "Delay before the first retry of a failed precheck model request, doubled on every further retry")
+	generateCmd.Flags().Float64VarP(&PrecheckFailureBudget, "precheck-failure-budget", "", 10, "Percentage of precheck questions allowed to fail before the whole job fails")
+	generateCmd.Flags().Float64VarP(&PrecheckTemperature, "precheck-temperature", "", -1, "Sampling temperature for precheck questions. Negative values use the model server default")
+	generateCmd.Flags().IntVarP(&PrecheckMaxTokens, "precheck-max-tokens", "", 0, "Maximum number of tokens in a precheck answer. 0 uses the model server default")
+	generateCmd.Flags().Float64VarP(&PrecheckTopP, "precheck-top-p", "", -1, "Nucleus sampling top_p for precheck questions. Negative values use the model server default")
+	generateCmd.Flags().StringVarP(&PrecheckSystemPrompt, "precheck-system-prompt", "", "", "System prompt for precheck questions, overriding the prompt templates")
+	generateCmd.Flags().StringVarP(&PrecheckEndpointStrategy, "precheck-endpoint-strategy", "", endpointRoundRobin, "How questions are spread over the endpoints of a precheck model: round-robin or latency, the fastest healthy endpoint first")
+	generateCmd.Flags().DurationVarP(&PrecheckEndpointCooldown, "precheck-endpoint-cooldown", "", 30*time.Second, "How long a precheck endpoint that failed is only used once the other endpoints failed too")
+	generateCmd.Flags().DurationVarP(&PrecheckHealthInterval, "precheck-health-interval", "", time.Minute, "Minimum delay between two health checks of the endpoints of a precheck model, run at the start of the precheck jobs")
+	generateCmd.Flags().DurationVarP(&PrecheckWarmupTimeout, "precheck-warmup-timeout", "", 5*time.Minute, "How long precheck jobs wait for the models to answer a warm-up prompt before the questions. Set to 0 to skip the warm-up")
+	generateCmd.Flags().IntVarP(&PrecheckMaxFiles, "precheck-max-files", "", 50, "Maximum number of taxonomy files a precheck job checks. Set to 0 to disable the limit")
+	generateCmd.Flags().IntVarP(&PrecheckMaxQuestions, "precheck-max-questions", "", 500, "Maximum number of seed questions a precheck job asks each model. Set to 0 to disable the limit")
+	generateCmd.Flags().StringVarP(&PrecheckOversizeAction, "precheck-oversize-action", "", prSizeSample, "What precheck jobs do with a PR over --precheck-max-files or --precheck-max-questions: sample, to check part of it with a notice in the summary, or reject, to fail the job and ask for the PR to be split")
+	generateCmd.Flags().DurationVarP(&PrecheckCacheTTL, "precheck-cache-ttl", "", 7*24*time.Hour, "How long precheck answers are cached in Redis, keyed by model and prompt. Set to 0 to disable the cache")
+	generateCmd.Flags().DurationVarP(&PrecheckHistoryTTL, "precheck-history-ttl", "", 30*24*time.Hour, "How long the precheck answers of a PR are kept in Redis to report the changes of the next prechecks of the PR. Set to 0 to disable the comparison")
+	generateCmd.Flags().Float64VarP(&CostPer1KPromptTokens, "cost-per-1k-prompt-tokens", "", 0, "Price of 1K prompt tokens, used to estimate the inference cost of a job")
+	generateCmd.Flags().Float64VarP(&CostPer1KCompletionTokens, "cost-per-1k-completion-tokens", "", 0, "Price of 1K completion tokens, used to estimate the inference cost of a job")
+	generateCmd.Flags().StringVarP(&CostCurrency, "cost-currency", "", "USD", "Currency of the token prices")
+	generateCmd.Flags().StringVarP(&EmbeddingsEndpointURL, "embeddings-endpoint-url", "", "", "OpenAI compatible endpoint used to compare precheck answers by embedding similarity. Only lexical metrics are computed when unset")
+	generateCmd.Flags().StringVarP(&EmbeddingsModel, "embeddings-model", "", "", "Model requested from the embeddings endpoint")
+	generateCmd.Flags().StringVarP(&EmbeddingsAPIKey, "embeddings-api-key", "", "", "API key sent as a bearer token to the embeddings endpoint")
+	generateCmd.Flags().StringSliceVarP(&ComplianceLicenses, "compliance-licenses", "", ComplianceLicenses, "SPDX identifiers of the licenses accepted in the attribution.txt of knowledge contributions. Set to an empty list to accept any license")
+	generateCmd.Flags().Int64VarP(&KnowledgeMaxDocBytes, "knowledge-max-doc-bytes", "", 10*1024*1024, "Maximum size in bytes of a single knowledge document. Set to 0 to disable the check")
+	generateCmd.Flags().IntVarP(&YamlMaxLineLength, "yaml-max-line-length", "", 120, "Maximum line length allowed by the taxonomy YAML lint. Set to 0 to disable the check")
+	generateCmd.Flags().IntVarP(&LintMinAnswerLength, "lint-min-answer-length", "", 10, "Minimum length in characters of the seed example answers. Set to 0 to disable the check")
+	generateCmd.Flags().BoolVarP(&LintQuestionMark, "lint-question-mark", "", true, "Check that the questions of the knowledge seed examples end with a question mark")
+	generateCmd.Flags().IntVarP(&LintMaxContextTokens, "lint-max-context-tokens", "", 500, "Maximum estimated tokens of a seed example context. Set to 0 to disable the check")
+	generateCmd.Flags().IntVarP(&LintMinQnaPairs, "lint-min-qna-pairs", "", 3, "Minimum Q&A pairs of a knowledge seed example. Set to 0 to disable the check")
+	generateCmd.Flags().StringSliceVarP(&LintErrorRules, "lint-error-rules", "", nil, "Content quality rules reported as errors rather than warnings: answer-length, question-mark, context-tokens, qna-pairs")
+	generateCmd.Flags().IntVarP(&RedisMaxActive, "redis-max-active", "", 16, "Maximum number of open Redis connections, the worker waits for one when they are all in use. 0 is 10 per CPU")
+	generateCmd.Flags().DurationVarP(&RedisIdleTimeout, "redis-idle-timeout", "", 5*time.Minute, "Idle Redis connections are closed after this long")
+	generateCmd.Flags().DurationVarP(&RedisRetryTimeout, "redis-retry-timeout", "", 2*time.Minute, "How long the results of a job are retried while Redis is unreachable")
+	generateCmd.Flags().StringVarP(&ControlPlaneAddr, "control-plane-addr", "", "", "host:port of the gRPC control plane of the bot. When set, the bot pushes the jobs to the worker and receives their progress and results, instead of the worker polling the Redis queue")
+	generateCmd.Flags().StringVarP(&ControlPlaneTLSCert, "control-plane-tls-cert", "", "", "Client certificate of the worker for the mutual TLS of the control plane, its common name names the worker. If blank, the control plane is reached without TLS")
+	generateCmd.Flags().StringVarP(&ControlPlaneTLSKey, "control-plane-tls-key", "", "", "Key of the control plane client certificate")
+	generateCmd.Flags().StringVarP(&ControlPlaneTLSCA, "control-plane-tls-ca", "", "", "CA the certificate of the control plane is checked against")
+	generateCmd.Flags().StringVarP(&WorkerName, "worker-name", "", "", "Name the worker registers with on the control plane, without a client certificate. Defaults to the hostname")
+	generateCmd.Flags().IntVarP(&HealthPort, "health-port", "", 0, "Port serving the /healthz and /readyz probes. 0 disables them")
+	generateCmd.Flags().StringSliceVarP(&InjectFaults, "inject-fault", "", nil, "Faults to fail every job with, for testing in staging: s3-upload, sdg-500, git-timeout")
+	_ = generateCmd.Flags().MarkHidden("inject-fault")
+	generateCmd.Flags().StringVarP(&ProvenanceSigningKey, "provenance-signing-key", "", "", "PEM private key, Ed25519, ECDSA or RSA, signing the provenance uploaded with the results of every job. If blank, no provenance is uploaded")
+	generateCmd.Flags().StringVarP(&ProvenanceKeyID, "provenance-key-id", "", "", "Key ID recorded in the provenance signatures. Defaults to the SHA-256 of the public key")
+	generateCmd.Flags().StringVarP(&ArtifactEncryptionKey, "artifact-encryption-key", "", "", "File holding a base64 AES-256 key, from openssl rand -base64 32, encrypting the --encrypted-artifacts before their upload. If blank, the artifacts are uploaded as they are")
+	generateCmd.Flags().StringSliceVarP(&EncryptedArtifacts, "encrypted-artifacts", "", []string{"*.log", "*.json", "*.jsonl", "*.yaml", "*.md", "*.html"}, "Name patterns of the job files holding contributor content, encrypted with --artifact-encryption-key")
+	generateCmd.Flags().StringVarP(&ArtifactKeyLocation, "artifact-key-location", "", "", "Where the reviewers get the artifact encryption key, told on the access page of the jobs")
+	generateCmd.Flags().IntVarP(&OutputKeepLast, "output-keep-last", "", 20, "Number of the most recent job output directories kept in the work directory after a successful upload. 0 keeps them all")
+	generateCmd.Flags().DurationVarP(&OutputMaxAge, "output-max-age", "", 0, "Job output directories older than this are removed from the work directory after a successful upload. 0 disables the limit")
 	if GithubToken == "" {
 		GithubToken = os.Getenv("ILWORKER_GITHUB_TOKEN")
 	}
@@ -147,77 +368,184 @@ func init() {
 	}
 	_ = generateCmd.MarkFlagRequired("github-token")
 	rootCmd.AddCommand(generateCmd)
+	// doctor checks the worker with the settings it runs with, and reports a missing required flag
+	// as a failed check rather than refusing to run
+	generateCmd.Flags().VisitAll(func(flag *pflag.Flag) {
+		doctorCmd.Flags().AddFlag(optionalFlag(flag))
+	})
+	// dashboard uploads to the bucket of the job results, with the same prefix and encryption
+	for _, name := range []string{"s3-bucket", "s3-key-prefix", "s3-sse", "s3-sse-kms-key-id", "s3-endpoint-url", "s3-path-style", "s3-public-url", "s3-upload-part-size-mb", "aws-region"} {
+		dashboardCmd.Flags().AddFlag(generateCmd.Flags().Lookup(name))
+	}
+	// gc reclaims the output directories with the retention of the worker
+	for _, name := range []string{"work-dir", "output-keep-last", "output-max-age"} {
+		gcCmd.Flags().AddFlag(generateCmd.Flags().Lookup(name))
+	}
 }
 
 var generateCmd = &cobra.Command{
 	Use:   "generate",
 	Short: "Listen for jobs on the 'generate' Redis queue and process them.",
 	Run: func(cmd *cobra.Command, args []string) {
-		logger := initLogger(Debug)
+		logger := initLogger(Debug, LogFormat)
 		sugar := logger.Sugar()
 
-		ctx, cancel := signal.NotifyContext(cmd.Context(), syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGINT)
+		ctx, cancel := signal.NotifyContext(cmd.Context(), shutdownSignals...)
 		defer cancel()
 
-		sugar.Info("Starting generate worker")
+		sugar.Infof("Starting generate worker %s", versionString())
 
-		// Initialize Redis connection pool
-		pool := &redis.Pool{
-			MaxIdle: 3,
-			Dial: func() (redis.Conn, error) {
-				return redis.DialContext(ctx, "tcp", RedisHost)
-			},
+		if err := validateSDGAuth(); err != nil {
+			log.Fatalf("invalid SDG auth settings, %v", err)
+		}
+		if err := defaultPipelineParams().validate(); err != nil {
+			log.Fatalf("invalid generate pipeline settings, %v", err)
+		}
+		if err := validateEndpointStrategy(PrecheckEndpointStrategy); err != nil {
+			log.Fatalf("invalid precheck settings, %v", err)
+		}
+		if err := validatePRSizeAction(PrecheckOversizeAction); err != nil {
+			log.Fatalf("invalid precheck settings, %v", err)
+		}
+		if err := validateAnswerTruncation(PrecheckAnswerTruncation); err != nil {
+			log.Fatalf("invalid precheck settings, %v", err)
+		}
+		if PrecheckBatchSize < 1 {
+			log.Fatalf("invalid precheck settings, --precheck-batch-size must be at least 1")
+		}
+		if err := validateFaults(InjectFaults); err != nil {
+			log.Fatalf("invalid fault injection settings, %v", err)
+		}
+		if len(InjectFaults) > 0 {
+			sugar.Warnf("Injecting faults in every job: %s", strings.Join(InjectFaults, ", "))
+		}
+		if err := validateSeedSampling(MaxSeedStrategy); err != nil {
+			log.Fatalf("invalid SDG settings, %v", err)
+		}
+		if err := validateS3Settings(); err != nil {
+			log.Fatalf("invalid S3 settings, %v", err)
+		}
+		if err := validateLintRules(); err != nil {
+			log.Fatalf("invalid lint settings, %v", err)
+		}
+		if err := validateEncryptedArtifacts(); err != nil {
+			log.Fatalf("invalid artifact encryption settings, %v", err)
+		}
+		if ArtifactEncryptionKey != "" {
+			c, err := loadArtifactCipher(ArtifactEncryptionKey)
+			if err != nil {
+				log.Fatalf("invalid artifact encryption settings, %v", err)
+			}
+			artifactEncryption = c
+			sugar.Infof("Encrypting the artifacts matching %s with key %s", strings.Join(EncryptedArtifacts, ", "), c.KeyID())
+		}
+		if ProvenanceSigningKey != "" {
+			signer, err := loadProvenanceSigner(ProvenanceSigningKey, ProvenanceKeyID)
+			if err != nil {
+				log.Fatalf("invalid provenance settings, %v", err)
+			}
+			provenanceSigner = signer
 		}
-		defer pool.Close()
+
+		workerCfg, err := readWorkerConfig(ConfigFile)
+		if err != nil {
+			log.Fatalf("unable to load worker config, %v", err)
+		}
+		prompts, err := newPromptTemplates(workerCfg.PromptTemplates)
+		if err != nil {
+			log.Fatalf("unable to load prompt templates, %v", err)
+		}
+		precheckPrompts = prompts
+		precheckModels = workerCfg.PrecheckModels
+		sdgRoutes = workerCfg.SdgRoutes
+		subprocessEnvPolicies = workerCfg.SubprocessEnv
+		ilabContainers = workerCfg.IlabContainers
+		ilabKubernetes = workerCfg.IlabKubernetes
+		secretRedactor = newRedactor(workerSecrets(workerCfg))
+		if reportTemplates, err = newReportRenderer(workerCfg.Report); err != nil {
+			log.Fatalf("unable to load report templates, %v", err)
+		}
+		sugar.Infof("Using precheck prompt templates version %s", precheckPrompts.Version)
+
+		// Initialize the Redis client of the job queue
+		queue := newRedisClient()
+		defer queue.Close()
 
 		cfg, err := awsconfig.LoadDefaultConfig(ctx, awsconfig.WithRegion(AWSRegion))
 		if err != nil {
 			log.Fatalf("unable to load SDK config, %v", err)
 		}
 
-		svc := s3.NewFromConfig(cfg)
+		svc := newS3Client(cfg)
+
+		// Jobs detect the version of their own executor, this only reports the one of the default executor
+		if !TestMode {
+			startup := &Worker{ctx: ctx, logger: sugar, job: "startup"}
+			if err := startup.detectIlabVersion(ilabPath()); err != nil {
+				sugar.Warnf("Could not detect the ilab version: %v", err)
+			} else {
+				sugar.Infof("Using ilab %s", startup.ilabVersion)
+			}
+		}
+
+		var control *controlPlane
+		if ControlPlaneAddr != "" {
+			control, err = newControlPlane(workerName(), sugar)
+			if err != nil {
+				log.Fatalf("unable to reach the control plane, %v", err)
+			}
+			defer control.Close()
+		}
+
+		health := newHealthServer(queue, svc)
+		if HealthPort > 0 {
+			healthSrv := health.serve(HealthPort, sugar)
+			defer healthSrv.Close()
+		}
 
 		sigChan := make(chan os.Signal, 1)
 		stopChan := make(chan struct{})
 
-		signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+		signal.Notify(sigChan, shutdownSignals...)
 
 		var wg sync.WaitGroup
 		wg.Add(1)
-		go func(stopChan <-chan struct{}) {
-			defer wg.Done()
-			timer := time.NewTicker(1 * time.Second)
-			for {
-				select {
-				case <-stopChan:
-					sugar.Info("Shutting down job listener")
-					return
-				case <-timer.C:
-					conn := pool.Get()
-					job, err := redis.String(conn.Do("RPOP", "generate"))
-					conn.Close()
-					if err == redis.ErrNil {
-						continue
-					} else if err != nil {
-						sugar.Errorf("Could not pop from redis queue: %v", err)
-						continue
+		if control != nil {
+			go control.run(ctx, &wg, stopChan, queue, svc, sugar)
+		} else {
+			go func(stopChan <-chan struct{}) {
+				defer wg.Done()
+				timer := time.NewTicker(1 * time.Second)
+				var backoff queueBackoff
+				for {
+					select {
+					case <-stopChan:
+						sugar.Info("Shutting down job listener")
+						return
+					case <-timer.C:
+						job := backoff.popJob(ctx, queue, sugar)
+						if job == "" {
+							continue
+						}
+						NewJobProcessor(ctx, queue, svc, sugar, job,
+							PreCheckEndpointURL,
+							SdgEndpointURL,
+							TlsClientCertPath,
+							TlsClientKeyPath,
+							TlsServerCaCertPath,
+							MaxSeed).processJob()
 					}
-					NewJobProcessor(ctx, pool, svc, sugar, job,
-						PreCheckEndpointURL,
-						SdgEndpointURL,
-						TlsClientCertPath,
-						TlsClientKeyPath,
-						TlsServerCaCertPath,
-						MaxSeed).processJob()
 				}
-			}
-		}(stopChan)
+			}(stopChan)
+		}
 
 		wg.Add(1)
 		go func(ch <-chan os.Signal) {
 			defer wg.Done()
 			<-ch
 			sugar.Info("Shutting down")
+			// Stop advertising readiness while the current job finishes
+			health.draining.Store(true)
 			close(stopChan)
 		}(sigChan)
 
@@ -225,17 +553,72 @@ var generateCmd = &cobra.Command{
 	},
 }
 
-// runPrecheck runs lab chat against git diffed yaml files
-func (w *Worker) runPrecheck(lab, outputDir, modelName string) error {
+// prepareJobChatlogDir creates the chat log directory of the job under data/chatlogs of the
+// work directory. Files left there by an earlier run of the job are removed, and the directory
+// is removed after the job, so jobs never pick up each other's chat logs.
+func (w *Worker) prepareJobChatlogDir(workDir string) (func(), error) {
+	dir, err := filepath.Abs(filepath.Join(workDir, "data", "chatlogs", "job-"+w.job))
+	if err != nil {
+		return nil, err
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return nil, fmt.Errorf("could not clear the chat log directory of job %s: %w", w.job, err)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("could not create the chat log directory of job %s: %w", w.job, err)
+	}
+	w.chatlogDir = dir
+	return func() {
+		if err := os.RemoveAll(dir); err != nil {
+			w.logger.Errorf("Could not remove the chat log directory of job %s: %v", w.job, err)
+		}
+	}, nil
+}
+
+// runPrecheck asks the precheck model the seed questions of the git diffed yaml files
+func (w *Worker) runPrecheck(lab, outputDir, modelName string, history *precheckHistory) error {
 	workDir := "."
 	if WorkDir != "" {
 		workDir = WorkDir
 	}
-	chatlogDir := path.Join(workDir, "data", "chatlogs")
-	combinedYAMLPath := path.Join(outputDir, "combined_chatlogs.yaml")
-	combinedYAMLHTMLPath := path.Join(outputDir, "combined_chatlogs.html")
+	chatlogDir := w.chatlogDir
+	combinedYAMLPath := filepath.Join(outputDir, "combined_chatlogs.yaml")
+	combinedYAMLHTMLPath := filepath.Join(outputDir, "combined_chatlogs.html")
+	var scoreRows []precheckScore
+	var records []precheckRecord
+	var summaryRows []precheckSummaryRow
+	var skipped []skippedQuestion
+	totalQuestions := 0
+	var comparisonRows []precheckComparison
+	var targetNames []string
+	var sample *precheckSample
+	usage := newJobUsage()
 
 	defer func() {
+		if err := w.recordJobUsage(outputDir, usage); err != nil {
+			w.logger.Errorf("Could not record token usage: %v", err)
+		}
+		if err := writePrecheckComparison(outputDir, targetNames, comparisonRows); err != nil {
+			w.logger.Errorf("Could not write precheck comparison: %v", err)
+		}
+		if err := writePrecheckScores(outputDir, scoreRows); err != nil {
+			w.logger.Errorf("Could not write precheck scores: %v", err)
+		}
+		if err := writePrecheckRecords(outputDir, records); err != nil {
+			w.logger.Errorf("Could not write precheck records: %v", err)
+		}
+		if err := w.savePrecheckHistory(history); err != nil {
+			w.logger.Errorf("Could not save the precheck history: %v", err)
+		}
+		if len(targetNames) > 0 {
+			if err := w.recordAreaScores(precheckAreaScores(summaryRows, targetNames[0])); err != nil {
+				w.logger.Errorf("Could not record the area scores: %v", err)
+			}
+		}
+		if err := w.writePrecheckSummary(outputDir, summaryRows, skipped, sample); err != nil {
+			w.logger.Errorf("Could not write precheck summary: %v", err)
+		}
+
 		// Move everything from chatlogDir to outputDir
 		chatlogFiles, err := os.ReadDir(chatlogDir)
 		if err != nil {
@@ -249,7 +632,7 @@ func (w *Worker) runPrecheck(lab, outputDir, modelName string) error {
 		for _, file := range chatlogFiles {
 			if strings.HasSuffix(file.Name(), ".yaml") {
 				// Read individual YAML files
-				content, err := os.ReadFile(path.Join(chatlogDir, file.Name()))
+				content, err := os.ReadFile(filepath.Join(chatlogDir, file.Name()))
 				if err != nil {
 					w.logger.Errorf("Could not read file %s: %v", file.Name(), err)
 					continue
@@ -261,14 +644,13 @@ func (w *Worker) runPrecheck(lab, outputDir, modelName string) error {
 					continue
 				}
 				combinedLogs = append(combinedLogs, logData)
-
+				fileNames = append(fileNames, file.Name())
 			}
 			// Move individual file to outputDir
-			if err := os.Rename(path.Join(chatlogDir, file.Name()), path.Join(outputDir, file.Name())); err != nil {
+			if err := os.Rename(filepath.Join(chatlogDir, file.Name()), filepath.Join(outputDir, file.Name())); err != nil {
 				w.logger.Errorf("Could not move file %s: %v", file.Name(), err)
 				continue
 			}
-			fileNames = append(fileNames, file.Name())
 		}
 
 		// Write the combined YAML file
@@ -291,69 +673,124 @@ func (w *Worker) runPrecheck(lab, outputDir, modelName string) error {
 			}
 			defer combinedLogHtmlFile.Close()
 
-			// build yamlEntries array from files
-			var yamlEntries []string
+			// show every chat log, with the diff of the answers when the contributor gave one
+			var chatlogs []reportFile
 			var yamlFileBytes []byte
-			for _, yamlFile := range combinedLogs {
+			for i, yamlFile := range combinedLogs {
 				yamlFileBytes, err = yaml.Marshal(yamlFile)
 				if err != nil {
 					w.logger.Errorf("Could not create unmarshal map to yaml: %v", err)
 				}
-				yamlEntries = append(yamlEntries, string(yamlFileBytes))
+				chatlogs = append(chatlogs, chatlogReportFile(fileNames[i], yamlFile, string(yamlFileBytes)))
 			}
-			if err := generateAllHTML(combinedLogHtmlFile, yamlEntries, fileNames); err != nil {
+			if err := generateAllHTML(combinedLogHtmlFile, "Precheck chat logs", w.reportMetadata(""), chatlogs); err != nil {
 				w.logger.Errorf("Could not generate index.html: %v", err)
 			}
 			w.logger.Infof("Combined log file written to %s", combinedLogHtmlFile)
 		}
 	}()
 
-	cmd := exec.CommandContext(w.ctx, lab, "diff")
-	cmd.Dir = workDir
-	cmd.Env = os.Environ()
+	diffArgs := w.ilabArgs(ilabDiff, "--taxonomy-path", w.taxonomyDir)
+	cmd := w.ilabCommand(lab, workDir, append(diffArgs, w.taxonomyBaseArgs()...)...)
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
 	cmd.Stderr = os.Stderr
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		w.logger.Errorf("Could not get stdout pipe: %v", err)
-		return err
-	}
 
 	w.logger.Debug("Running ilab diff")
-	if err := cmd.Start(); err != nil {
-		w.logger.Errorf("Could not start command(%s %s): %v", cmd.Path, strings.Join(cmd.Args, " "), err)
+	// ilab diff fails on taxonomy files it can't validate but still lists the changed files,
+	// only a command that did not run at all stops the precheck
+	if err := cmd.Run(); commandFailed(err) {
+		w.logger.Warnf("Command %s failed: %v", cmd, err)
+	} else if err != nil {
+		w.logger.Errorf("Could not run command %s: %v", cmd, err)
 		return err
 	}
+	outputStr := stdout.String()
+	w.logger.Debugf("Output: %s", outputStr)
+
+	taxonomyFiles := w.classifyChangedFiles(splitLines(outputStr))
+
+	// Early check for YAML file presence before further processing
+	if len(taxonomyFiles) == 0 {
+		errMsg := "No modified YAML files detected in the PR for precheck"
+		w.logger.Error(errMsg)
+		return fmt.Errorf(errMsg)
+	}
 
-	output, err := io.ReadAll(stdout)
+	// A PR over the precheck limits is sampled or rejected rather than keeping the worker for hours
+	taxonomyFiles, sample, err := w.limitPrecheck(taxonomyFiles)
 	if err != nil {
-		w.logger.Errorf("Could not read stdout: %v", err)
+		w.logger.Error(err)
 		return err
 	}
-	outputStr := string(output)
-	w.logger.Debugf("Output: %s", outputStr)
 
-	yamlFileCount := 0
-	labDiffOutput := strings.Split(outputStr, "\n")
+	// ilab diff only lists the YAML files, the attribution and context files changed with them
+	// are shown on a page of their own
+	if err := w.writeAttachments(outputDir); err != nil {
+		w.logger.Warnf("Could not list the changed attachments: %v", err)
+	}
 
-	// Early check for YAML file presence before further processing
-	for _, file := range labDiffOutput {
-		if strings.HasSuffix(file, ".yaml") {
-			yamlFileCount++
+	changedFiles := taxonomyFilePaths(taxonomyFiles)
+	lintResults := w.lintTaxonomyFiles(changedFiles, outputDir)
+	lintFailed := make(map[string]bool)
+	for _, result := range lintResults {
+		lintFailed[result.Path] = result.hasErrors()
+	}
+
+	var knowledgeFiles []string
+	for _, file := range taxonomyFiles {
+		if file.Kind == taxonomyTypeKnowledge && !lintFailed[file.Path] {
+			knowledgeFiles = append(knowledgeFiles, file.Path)
 		}
 	}
+	if err := w.checkCompliance(knowledgeFiles, outputDir); err != nil {
+		w.logger.Error(err)
+		return err
+	}
+	if err := w.checkKnowledgeDocuments(knowledgeFiles, outputDir); err != nil {
+		w.logger.Error(err)
+		return err
+	}
 
-	if yamlFileCount == 0 {
-		errMsg := "No modified YAML files detected in the PR for precheck"
-		w.logger.Error(errMsg)
-		return fmt.Errorf(errMsg)
+	httpClient := precheckHTTPClient()
+	targets, err := w.precheckTargets(modelName)
+	if err != nil {
+		w.logger.Error(err)
+		return err
+	}
+	for _, target := range targets {
+		targetNames = append(targetNames, target.Name)
+	}
+	w.checkPrecheckEndpoints(httpClient, targets)
+	if err := w.warmUpTargets(httpClient, targets); err != nil {
+		w.logger.Error(err)
+		return err
 	}
 
-	// Proceed with YAML files processing if they exist
-	for _, file := range labDiffOutput {
-		if !strings.HasSuffix(file, ".yaml") {
-			continue
-		}
-		filePath := path.Join(workDir, "taxonomy", file)
+	manifest := precheckManifest{
+		JobID:            w.job,
+		Models:           targets,
+		PromptTemplate:   precheckPrompts.Version,
+		GenerationParams: w.genParams,
+		Sample:           sample,
+		Grounded:         w.grounded,
+		Paraphrases:      w.paraphrases,
+	}
+	if err := writePrecheckManifest(outputDir, manifest); err != nil {
+		w.logger.Error(err)
+	}
+
+	questions := countSeedExamples(w.taxonomyDir, changedFiles)
+	if sample != nil {
+		questions = sample.checked()
+	}
+	progress := jobProgress{Total: questions * len(targets)}
+	w.setJobProgress(progress)
+
+	// Every file is checked with the prompts of its type, knowledge and skill files of a PR alike
+	for _, changed := range taxonomyFiles {
+		file := changed.Path
+		filePath := filepath.Join(w.taxonomyDir, filepath.FromSlash(file))
 
 		f, err := os.Open(filePath)
 		if err != nil {
@@ -371,21 +808,37 @@ func (w *Worker) runPrecheck(lab, outputDir, modelName string) error {
 		var data map[string]interface{}
 		err = yaml.Unmarshal(content, &data)
 		if err != nil {
-			// Odds are, the PR was not yaml-linted since it's invalid YAML failing unmarshalling
-			err = fmt.Errorf("the original taxonomy YAML likely did not pass yaml-linting, here is the unmarshalling error: %v", err)
+			err = fmt.Errorf("the taxonomy YAML %s could not be parsed: %v", file, err)
+			if lintFailed[file] {
+				err = fmt.Errorf("%v\n\nLint errors:\n%s", err, lintErrorSummary(lintResults))
+			}
+			err = categorize(errorInvalidYAML, err)
 			w.logger.Error(err)
 			return err
 		}
 
+		taskDescription, _ := data["task_description"].(string)
+
 		// Check if "seed_examples" exists and is a list
 		seedExamples, ok := data["seed_examples"].([]interface{})
 		if !ok {
-			err = fmt.Errorf("seed_examples not found or not a list")
+			err = categorize(errorMissingSeedExamples, fmt.Errorf("seed_examples not found or not a list in %s", file))
 			w.logger.Error(err)
 			return err
 		}
 
-		for _, item := range seedExamples {
+		// seedIndexes are the positions of the asked seed examples in the file
+		seedIndexes := make([]int, len(seedExamples))
+		for i := range seedIndexes {
+			seedIndexes[i] = i
+		}
+		if sample != nil {
+			seedIndexes = sampleSeedExamples(seedExamples, sample.Questions[file], seedSampleStratified, 0)
+			seedExamples = sampledSeedExamples(seedExamples, sample.Questions[file])
+		}
+		// The targets supporting batches answer the questions of the file in a few requests
+		w.prefetchAnswers(httpClient, targets, w.seedExamplePrompts(changed.Kind, file, taskDescription, seedExamples))
+		for i, item := range seedExamples {
 			example, ok := item.(map[interface{}]interface{})
 			if !ok {
 				w.logger.Error("Invalid seed example format")
@@ -398,113 +851,408 @@ func (w *Worker) runPrecheck(lab, outputDir, modelName string) error {
 			}
 
 			context, hasContext := example["context"].(string)
-			originalQuestion := question
-			// Slicing args breaks ilab chat for context, use Sprintf to control spacing
-			if hasContext {
-				// Append the context to the question with a specific format
-				question = fmt.Sprintf("%s %s %s.", question, ctxPrompt, context)
-			}
-			commandStr := fmt.Sprintf("chat --quick-question %s", question)
-			if TlsInsecure {
-				commandStr += " --tls-insecure"
+			prompt := promptData{
+				Question:        question,
+				Context:         context,
+				TaskDescription: taskDescription,
+				TaxonomyPath:    file,
 			}
-			if PreCheckEndpointURL != localEndpoint && modelName != "unknown" {
-				commandStr += fmt.Sprintf(" --endpoint-url %s --model %s", PreCheckEndpointURL, modelName)
+			messages, err := precheckPrompts.render(changed.Kind, prompt)
+			var ungrounded []chatMessage
+			if err == nil {
+				ungrounded, err = w.ungroundedMessages(changed.Kind, prompt)
 			}
-			cmdArgs := strings.Fields(commandStr)
-			cmd := exec.Command(lab, cmdArgs...)
-			// Register the command for reporting/logging
-			w.cmdRun = cmd.String()
-			w.logger.Infof("Running the precheck command: %s", cmd.String())
-
-			cmd.Dir = workDir
-			cmd.Env = os.Environ()
-			var out bytes.Buffer
-			var errOut bytes.Buffer
-			cmd.Stdout = &out
-			cmd.Stderr = &errOut
-			err = cmd.Run()
+			totalQuestions += len(targets)
 			if err != nil {
-				w.logger.Errorf("Precheck command failed with error: %v; stderr: %s", err, errOut.String())
+				w.logger.Errorf("Could not build the precheck prompt: %v", err)
+				for _, target := range targets {
+					skipped = append(skipped, skippedQuestion{File: file, Model: target.Name, Question: question, Reason: err.Error()})
+				}
+				progress.Done, progress.Skipped = totalQuestions, len(skipped)
+				progress.LatestFile, progress.LatestQuestion = file, question
+				w.setJobProgress(progress)
 				continue
 			}
 
-			logData := map[string]interface{}{
-				"input": map[string]string{
-					"question": originalQuestion,
-				},
-				"output": out.String(),
-			}
+			messages = w.genParams.applySystemPrompt(messages)
 
-			if hasContext {
-				logData["input"].(map[string]string)["context"] = context
+			// The robustness check asks every model the same paraphrases of the question
+			var paraphrases []string
+			var paraphrased [][]chatMessage
+			var paraphraseWarning string
+			if w.paraphrases > 0 {
+				paraphrases, paraphrased, err = w.paraphrasedPrompts(w.ctx, httpClient, targets[0], changed.Kind, prompt, usage)
+				if err != nil {
+					w.logger.Errorf("Could not paraphrase the precheck question: %v", err)
+					paraphraseWarning = fmt.Sprintf("the question could not be paraphrased: %v", err)
+				}
 			}
 
-			logYAML, err := yaml.Marshal(logData)
-			if err != nil {
-				w.logger.Errorf("Could not marshal log data to YAML: %v", err)
-				continue
+			expectedAnswer, _ := example["answer"].(string)
+			var comparison *precheckComparison
+			if len(targets) > 1 {
+				comparison = &precheckComparison{
+					File:           file,
+					Question:       question,
+					ExpectedAnswer: expectedAnswer,
+					Answers:        make(map[string]string),
+					Issues:         make(map[string]string),
+				}
 			}
-
 			// Generate uniquely timestamped filenames for the combined input/output YAML files
 			timestamp := time.Now().Format("2006-01-02T15_04_05")
-			logFileName := fmt.Sprintf("chat_%s.yaml", timestamp)
-			err = os.WriteFile(path.Join(chatlogDir, logFileName), logYAML, 0644)
-			if err != nil {
-				w.logger.Errorf("Could not write chatlog to file: %v", err)
-				continue
-			}
 
-			// Create a combined .log file
-			logText := fmt.Sprintf("Input: %s\n\nOutput:\n%s\n", originalQuestion, out.String())
-			logFileName = fmt.Sprintf("chat_%s.log", timestamp)
-			err = os.WriteFile(path.Join(chatlogDir, logFileName), []byte(logText), 0644)
-			if err != nil {
-				w.logger.Errorf("Could not write chat log to file: %v", err)
-				continue
+			for _, target := range targets {
+				// Register the request for reporting/logging
+				w.cmdRun = fmt.Sprintf("POST %s model=%s", chatCompletionsURL(target.Endpoint), target.Model)
+				w.logger.Infof("Running the precheck question: %s", w.cmdRun)
+
+				result, err := w.askQuestion(httpClient, target, messages)
+				if err != nil {
+					w.logger.Errorf("Precheck question failed with error: %v", err)
+					skipped = append(skipped, skippedQuestion{File: file, Model: target.Name, Question: question, Reason: err.Error(), Timeout: isTimeout(err)})
+					continue
+				}
+
+				logData := map[string]interface{}{
+					"input": map[string]string{
+						"question": question,
+					},
+					"taxonomy_type":     changed.Kind,
+					"output":            result.Answer,
+					"prompt_template":   precheckPrompts.Version,
+					"generation_params": w.genParams,
+					"finish_reason":     result.FinishReason,
+					"usage":             result.Usage,
+					"latency_ms":        result.Latency.Milliseconds(),
+				}
+				if result.Endpoint != "" {
+					logData["endpoint"] = result.Endpoint
+				}
+				if warnings := answerWarnings(result); len(warnings) > 0 {
+					logData["warnings"] = warnings
+				}
+				if target.Name != "" {
+					logData["model"] = target.Name
+				}
+				usage.add(target.label(), result.Usage, result.Cached)
+				if result.Cached {
+					logData["cached"] = true
+				}
+
+				if hasContext {
+					logData["input"].(map[string]string)["context"] = context
+				}
+
+				// The grounded precheck records the answer without the context next to the other
+				var withoutContext *groundedAnswer
+				if ungrounded != nil {
+					ungroundedResult, err := w.askQuestion(httpClient, target, ungrounded)
+					if err != nil {
+						w.logger.Errorf("Precheck question without context failed with error: %v", err)
+						logData["warnings"] = append(answerWarnings(result), fmt.Sprintf("the question without the context failed: %v", err))
+					} else {
+						usage.add(target.label(), ungroundedResult.Usage, ungroundedResult.Cached)
+						withoutContext = &groundedAnswer{Answer: ungroundedResult.Answer, FinishReason: ungroundedResult.FinishReason}
+						logData["output_without_context"] = ungroundedResult.Answer
+					}
+				}
+
+				var paraphraseAnswers []paraphraseAnswer
+				var paraphraseWarnings []string
+				if paraphraseWarning != "" {
+					paraphraseWarnings = append(paraphraseWarnings, paraphraseWarning)
+				}
+				for i, paraphraseMessages := range paraphrased {
+					paraphraseResult, err := w.askQuestion(httpClient, target, paraphraseMessages)
+					if err != nil {
+						w.logger.Errorf("Precheck paraphrase failed with error: %v", err)
+						paraphraseWarnings = append(paraphraseWarnings, fmt.Sprintf("the paraphrase %q failed: %v", paraphrases[i], err))
+						continue
+					}
+					usage.add(target.label(), paraphraseResult.Usage, paraphraseResult.Cached)
+					scores := w.compareAnswers(w.ctx, httpClient, result.Answer, paraphraseResult.Answer)
+					paraphraseAnswers = append(paraphraseAnswers, paraphraseAnswer{Question: paraphrases[i], Answer: paraphraseResult.Answer, Score: scores.Score()})
+				}
+				if len(paraphraseWarnings) > 0 {
+					warnings, _ := logData["warnings"].([]string)
+					logData["warnings"] = append(warnings, paraphraseWarnings...)
+				}
+
+				summaryRow := precheckSummaryRow{
+					File:           file,
+					Kind:           changed.Kind,
+					Model:          target.Name,
+					Question:       question,
+					Answer:         result.Answer,
+					FinishReason:   result.FinishReason,
+					TooLong:        result.TooLong,
+					WithoutContext: withoutContext,
+					Paraphrases:    paraphraseAnswers,
+				}
+				if PrecheckLanguageCheck {
+					summaryRow.QuestionLanguage, summaryRow.AnswerLanguage = detectLanguage(question), detectLanguage(result.Answer)
+					if summaryRow.languageMismatch() {
+						logData["language_mismatch"] = map[string]string{"question": summaryRow.QuestionLanguage, "answer": summaryRow.AnswerLanguage}
+					}
+				}
+				if consistency, ok := summaryRow.consistency(); ok {
+					logData["paraphrases"] = paraphraseAnswers
+					logData["paraphrase_consistency"] = consistency
+				}
+				if expectedAnswer != "" {
+					scores := w.compareAnswers(w.ctx, httpClient, expectedAnswer, result.Answer)
+					summaryRow.Scores = &scores
+					logData["input"].(map[string]string)["answer"] = expectedAnswer
+					logData["scores"] = scores
+					if withoutContext != nil {
+						groundedScores := w.compareAnswers(w.ctx, httpClient, expectedAnswer, withoutContext.Answer)
+						withoutContext.Scores = &groundedScores
+						logData["scores_without_context"] = groundedScores
+					}
+				}
+				summaryRow.Change = history.record(w.job, summaryRow)
+				if summaryRow.Change != nil {
+					logData["change"] = summaryRow.Change.Status
+				}
+				if summaryRow.Scores != nil {
+					scoreRows = append(scoreRows, precheckScore{
+						File:           file,
+						Model:          target.Name,
+						Question:       question,
+						ExpectedAnswer: expectedAnswer,
+						ModelAnswer:    result.Answer,
+						Scores:         *summaryRow.Scores,
+						Change:         summaryRow.Change.label(summaryRow.Scores),
+					})
+				}
+				summaryRows = append(summaryRows, summaryRow)
+				records = append(records, precheckRecord{
+					JobID:        w.job,
+					Model:        target.label(),
+					File:         file,
+					SeedIndex:    seedIndexes[i],
+					TaxonomyType: changed.Kind,
+					Question:     question,
+					Context:      context,
+					Reference:    expectedAnswer,
+					ModelAnswer:  result.Answer,
+					FinishReason: result.FinishReason,
+					Scores:       summaryRow.Scores,
+					LatencyMs:    result.Latency.Milliseconds(),
+					Tokens:       result.Usage,
+					Cached:       result.Cached,
+					Prompt:       precheckPrompts.Version,
+				})
+				if comparison != nil {
+					comparison.Answers[target.Name] = result.Answer
+					if issue := answerIssue(result.Answer, result.FinishReason); issue != "" {
+						comparison.Issues[target.Name] = issue
+					}
+				}
+
+				logYAML, err := yaml.Marshal(logData)
+				if err != nil {
+					w.logger.Errorf("Could not marshal log data to YAML: %v", err)
+					continue
+				}
+
+				logFileBase := "chat_" + timestamp
+				if comparison != nil {
+					logFileBase += "_" + target.Name
+				}
+				err = os.WriteFile(filepath.Join(chatlogDir, logFileBase+".yaml"), logYAML, 0644)
+				if err != nil {
+					w.logger.Errorf("Could not write chatlog to file: %v", err)
+					continue
+				}
+
+				// Create a combined .log file
+				logText := fmt.Sprintf("Input: %s\n\nOutput:\n%s\n", question, result.Answer)
+				if withoutContext != nil {
+					logText += fmt.Sprintf("\nOutput without the context:\n%s\n", withoutContext.Answer)
+				}
+				for _, p := range paraphraseAnswers {
+					logText += fmt.Sprintf("\nParaphrase: %s\n\nOutput:\n%s\n", p.Question, p.Answer)
+				}
+				err = os.WriteFile(filepath.Join(chatlogDir, logFileBase+".log"), []byte(logText), 0644)
+				if err != nil {
+					w.logger.Errorf("Could not write chat log to file: %v", err)
+					continue
+				}
+			}
+			if comparison != nil {
+				comparisonRows = append(comparisonRows, *comparison)
 			}
+			progress.Done, progress.Skipped = totalQuestions, len(skipped)
+			progress.LatestFile, progress.LatestQuestion = file, question
+			w.setJobProgress(progress)
 
 			// Sleep to ensure unique timestamps for filenames
 			time.Sleep(1 * time.Second)
 		}
 	}
-	return nil
+	return checkFailureBudget(totalQuestions, skipped)
 }
 
 // processJob processes a given job, all jobs start here
 func (w *Worker) processJob() {
+	w.startJobLog()
 	sugar := w.logger.With("job", w.job)
 	sugar.Infof("Processing job %s", w.job)
 
-	// Get a new Redis connection from the pool for this operation
-	conn := w.pool.Get()
-	defer conn.Close()
-
-	// Set job status to 'pending'
-	if _, err := conn.Do("SET", fmt.Sprintf("jobs:%s:status", w.job), jobStatusRunning); err != nil {
-		sugar.Errorf("Could not set job status to pending in redis: %v", err)
-		return
+	// Set job status to 'running', the start time lets the bot estimate when the job completes and
+	// fail it if the worker stops reporting. The control plane starts the jobs it assigns.
+	if w.control == nil {
+		if err := w.queue.Start(w.ctx, w.job, map[jobqueue.Field]interface{}{
+			jobqueue.FieldStatus:        jobqueue.StatusRunning,
+			jobqueue.FieldStartTime:     time.Now().Unix(),
+			jobqueue.FieldWorkerVersion: versionString(),
+		}); err != nil {
+			sugar.Errorf("Could not set job status to pending in redis: %v", err)
+			return
+		}
 	}
+	// The progress updates are the heartbeat of the job, the jobs without any still send them
+	stopHeartbeat := w.startHeartbeat()
+	defer stopHeartbeat()
 
-	prNumber, err := redis.String(conn.Do("GET", fmt.Sprintf("jobs:%s:pr_number", w.job)))
+	// Scheduled jobs have no PR and name the branch they run against instead
+	prNumber, err := w.jobField(jobqueue.FieldPRNumber)
 	if err != nil {
 		sugar.Errorf("Could not get pr_number from redis: %v", err)
 		return
 	}
+	if prNumber == "" {
+		w.branch, err = w.jobField(jobqueue.FieldBranch)
+		if err != nil {
+			sugar.Errorf("Could not get branch from redis: %v", err)
+			return
+		}
+		if w.branch == "" {
+			sugar.Errorf("Job %s has neither a PR number nor a branch", w.job)
+			return
+		}
+	} else {
+		if w.baseRef, err = w.jobField(jobqueue.FieldBaseRef); err != nil {
+			sugar.Errorf("Could not get base_ref from redis: %v", err)
+			return
+		}
+		if w.prSha, err = w.jobField(jobqueue.FieldPRSHA); err != nil {
+			sugar.Errorf("Could not get pr_sha from redis: %v", err)
+			return
+		}
+	}
 
-	jobType, err := redis.String(conn.Do("GET", fmt.Sprintf("jobs:%s:job_type", w.job)))
+	jobType, err := w.jobField(jobqueue.FieldJobType)
 	if err != nil {
 		sugar.Errorf("Could not get job_type from redis: %v", err)
 		return
 	}
+	if jobType == "" {
+		sugar.Errorf("Job %s has no job type", w.job)
+		return
+	}
+
+	repoOwner, err := w.jobField(jobqueue.FieldRepoOwner)
+	if err != nil {
+		sugar.Errorf("Could not get repo_owner from redis: %v", err)
+		return
+	}
+
+	repoName, err := w.jobField(jobqueue.FieldRepoName)
+	if err != nil {
+		sugar.Errorf("Could not get repo_name from redis: %v", err)
+		return
+	}
+
+	// Jobs queued for a specific repository carry their own remote, older jobs fall back to --git-remote
+	jobGitRemote, err := w.jobField(jobqueue.FieldGitRemote)
+	if err != nil {
+		sugar.Errorf("Could not get git_remote from redis: %v", err)
+		return
+	}
+	if jobGitRemote != "" {
+		w.gitRemote = jobGitRemote
+	}
+
+	s3Prefix, err := w.jobField(jobqueue.FieldS3Prefix)
+	if err != nil {
+		sugar.Errorf("Could not get s3_prefix from redis: %v", err)
+		return
+	}
+	// The prefix of the worker environment comes before the one of the repository
+	w.s3Prefix = path.Join(S3KeyPrefix, s3Prefix)
+	w.s3Tags = s3ObjectTags(w.job, prNumber, w.branch, repoOwner, repoName)
+
+	// Precheck jobs may ask for a comparison across several of the configured models
+	models, err := w.jobField(jobqueue.FieldModels)
+	if err != nil {
+		sugar.Errorf("Could not get models from redis: %v", err)
+		return
+	}
+	w.models = splitModelNames(models)
+
+	// Pipeline stages are only queued after the previous stage, this guards against requeued jobs
+	if err := w.checkJobDependency(); err != nil {
+		sugar.Errorf("Job dependency not met: %v", err)
+		w.reportJobError(err)
+		return
+	}
+
+	// Generation parameters default to the worker settings and can be overridden per job
+	w.genParams, err = w.loadGenerationParams()
+	if err != nil {
+		sugar.Errorf("Could not load generation parameters: %v", err)
+		w.reportJobError(err)
+		return
+	}
+	w.pipelineParams, err = w.loadPipelineParams()
+	if err != nil {
+		sugar.Errorf("Could not load pipeline parameters: %v", err)
+		w.reportJobError(err)
+		return
+	}
+	w.numInstructions, err = w.loadNumInstructions()
+	if err != nil {
+		sugar.Errorf("Could not load the number of instructions: %v", err)
+		w.reportJobError(err)
+		return
+	}
+	w.dryRun, err = w.loadDryRun()
+	if err != nil {
+		sugar.Errorf("Could not load the dry run flag: %v", err)
+		w.reportJobError(err)
+		return
+	}
+	w.grounded, err = w.loadGrounded()
+	if err != nil {
+		sugar.Errorf("Could not load the grounded flag: %v", err)
+		w.reportJobError(err)
+		return
+	}
+	w.paraphrases, err = w.loadParaphrases()
+	if err != nil {
+		sugar.Errorf("Could not load the paraphrases option: %v", err)
+		w.reportJobError(err)
+		return
+	}
 	switch jobType {
 	case jobGenerateLocal:
 	case jobPreCheck:
 	case jobSDG:
+	case jobTrain:
+	case jobEvaluate:
 	default:
 		sugar.Errorf("Unknown job type: %s", jobType)
 		return
 	}
+	if w.dryRun && !supportsDryRun(jobType) {
+		err := fmt.Errorf("%s jobs have no dry run", jobType)
+		sugar.Error(err)
+		w.reportJobError(err)
+		return
+	}
 
 	// If in test mode, immediately post to the results queue
 	if TestMode {
@@ -515,7 +1263,11 @@ func (w *Worker) processJob() {
 		return
 	}
 
-	sugar = sugar.With("pr_number", prNumber)
+	if w.branch != "" {
+		sugar = sugar.With("branch", w.branch)
+	} else {
+		sugar = sugar.With("pr_number", prNumber)
+	}
 
 	workDir, err := os.Getwd()
 	if err != nil {
@@ -525,26 +1277,101 @@ func (w *Worker) processJob() {
 	if WorkDir != "" {
 		workDir = WorkDir
 	}
-	taxonomyDir := path.Join(workDir, "taxonomy")
-	sugar = sugar.With("work_dir", workDir, "origin", Origin)
+	w.taxonomyDir = taxonomyDirForRepo(workDir, repoOwner, repoName, w.gitRemote)
+	sugar = sugar.With("work_dir", workDir, "origin", Origin, "git_remote", w.gitRemote)
 
-	headHash, err := w.gitOperations(sugar, taxonomyDir, prNumber)
+	gitStart := time.Now()
+	headHash, err := w.gitOperations(sugar, w.taxonomyDir, prNumber)
+	w.logStep("git", gitStart, err)
 	if err != nil {
 		w.logger.Errorf("git operations error: %v", err)
-		wrappedErr := fmt.Errorf("git operations error: %w", err)
+		wrappedErr := categorize(errorGitFetchFailed, fmt.Errorf("git operations error: %w", err))
 		w.reportJobError(wrappedErr)
 		return
 	}
 
+	w.source = jobSource{
+		Repository: path.Join(repoOwner, repoName),
+		GitRemote:  w.gitRemote,
+		PR:         prNumber,
+		Branch:     w.branch,
+		Commit:     headHash,
+		JobType:    jobType,
+	}
+
 	outDirName := fmt.Sprintf("%s-pr-%s-%s", jobType, prNumber, headHash)
-	outputDir := path.Join(workDir, outDirName)
+	if w.branch != "" {
+		outDirName = fmt.Sprintf("%s-branch-%s-%s", jobType, strings.ReplaceAll(w.branch, "/", "-"), headHash)
+	}
+	outputDir := filepath.Join(workDir, outDirName)
 
 	sugar = sugar.With("out_dir", outputDir)
 	_ = os.MkdirAll(outputDir, 0755)
+	if err := w.jobLog.open(filepath.Join(outputDir, jobLogFilename)); err != nil {
+		sugar.Error(err)
+	}
+	defer w.closeJobLog(outputDir)
 
-	lab := "ilab"
-	if VenvDir != "" {
-		lab = path.Join(VenvDir, "bin", "ilab")
+	w.jobType = jobType
+	cleanupJobHome, err := w.prepareJobHome()
+	if err != nil {
+		sugar.Error(err)
+		w.reportJobError(err)
+		return
+	}
+	defer cleanupJobHome()
+
+	cleanupChatlogs, err := w.prepareJobChatlogDir(workDir)
+	if err != nil {
+		sugar.Error(err)
+		w.reportJobError(err)
+		return
+	}
+	defer cleanupChatlogs()
+
+	if err := w.prepareJobIlabConfig(outputDir); err != nil {
+		sugar.Error(err)
+		w.reportJobError(err)
+		return
+	}
+
+	lab := ilabPath()
+	if err := w.detectIlabVersion(lab); err != nil {
+		sugar.Warnf("Could not detect the ilab version, using the commands of ilab before %s: %v", ilabGroupedSince, err)
+	} else {
+		sugar = sugar.With("ilab_version", w.ilabVersion.String())
+		if err := w.recordIlabVersion(outputDir); err != nil {
+			sugar.Error(err)
+		}
+	}
+
+	// Dry runs check the changed files and list the commands of the job without calling any model
+	if w.dryRun {
+		runStart := time.Now()
+		if err := w.runDryRun(lab, workDir, outputDir, jobType); err != nil {
+			sugar.Errorf("Dry run failed: %v", err)
+			w.reportFailedJob(outputDir, prNumber, outDirName, err)
+			return
+		}
+		w.logStep("dry run", runStart, nil)
+		w.publishJobResults(sugar, outputDir, prNumber, outDirName, jobType, repoOwner, repoName)
+		return
+	}
+
+	// The model server of local jobs is started by the worker rather than left running
+	var modelEndpoint string
+	if ServeLocalModel && needsLocalModel(jobType) {
+		server, err := w.startModelServer(lab, outputDir)
+		if err != nil {
+			sugar.Error(err)
+			w.reportFailedJob(outputDir, prNumber, outDirName, err)
+			return
+		}
+		defer server.stop()
+		modelEndpoint = server.endpoint
+		if jobType == jobPreCheck {
+			w.precheckEndpoint = modelEndpoint
+		}
 	}
 
 	var modelName string
@@ -559,68 +1386,109 @@ func (w *Worker) processJob() {
 	} else {
 		modelName = w.getModelNameFromConfig()
 	}
+	w.modelName = modelName
 
-	var cmd *exec.Cmd
+	var cmd *ilabCommand
+	runStart := time.Now()
 	switch jobType {
 	case jobGenerateLocal:
 		// @instructlab-bot generate-local
 		// Runs generate on the local worker node
-		generateArgs := []string{"generate", "--num-instructions", fmt.Sprintf("%d", NumInstructions), "--output-dir", outputDir}
-
-		cmd = exec.CommandContext(w.ctx, lab, generateArgs...)
-		if WorkDir != "" {
-			cmd.Dir = WorkDir
+		generateArgs := w.generateLocalArgs(outputDir, modelEndpoint)
+		if err := w.recordPipelineParams(outputDir, w.pipelineParams); err != nil {
+			sugar.Error(err)
 		}
 
+		cmd = w.ilabCommand(lab, WorkDir, generateArgs...)
+
 		var stderr bytes.Buffer
 		// Capture both the ilab err buffer and the os.Stderr
 		cmd.Stderr = io.MultiWriter(&stderr, os.Stderr)
-		cmd.Env = os.Environ()
 		cmd.Stdout = os.Stdout
 
 		sugar.Debug(fmt.Sprintf("Running %s job", jobType))
 		// Run the command
 		sugar.Infof("Running the generate command: %s", cmd.String())
 		if err := cmd.Run(); err != nil {
-			detailedErr := fmt.Errorf("Error running command (%s %s): %v. \nDetails: %s", cmd.Path, strings.Join(generateArgs, " "), err, stderr.String())
+			detailedErr := fmt.Errorf("Error running command (%s %s): %v. \nDetails: %s", lab, strings.Join(generateArgs, " "), err, stderr.String())
 			sugar.Errorf(detailedErr.Error())
-			w.reportJobError(detailedErr)
+			w.writeStderrLog(outputDir, "generate", stderr.Bytes())
+			w.reportFailedJob(outputDir, prNumber, outDirName, detailedErr)
+			return
+		}
+
+		datasetFiles, err := generatedDatasetFiles(outputDir)
+		if err != nil {
+			sugar.Errorf("Could not list generated dataset files: %v", err)
+		}
+		if err := w.processDataset(outputDir, datasetFiles); err != nil {
+			sugar.Errorf("Generated dataset validation failed: %v", err)
+			w.reportFailedJob(outputDir, prNumber, outDirName, err)
 			return
 		}
 	case jobPreCheck:
 		// @instructlab-bot precheck
 		// Runs precheck on a backend node
-		err = w.runPrecheck(lab, outputDir, modelName)
+		// The answers are compared with the previous precheck of the PR
+		history := w.loadPrecheckHistory(repoOwner, repoName, prNumber, headHash)
+		err = w.runPrecheck(lab, outputDir, modelName, history)
 		if err != nil {
 			sugar.Errorf("Could not run precheck: %v", err)
-			w.reportJobError(err)
+			w.reportFailedJob(outputDir, prNumber, outDirName, err)
 			return
 		}
 	case jobSDG:
 		// @instructlab-bot generate
 		// Runs generate on the SDG backend
 		// ilab diff is run since the sdg generation is not part of upstream cli
-		cmdDiff := exec.Command("ilab", "diff")
+		diffArgs := w.ilabArgs(ilabDiff, "--taxonomy-path", w.taxonomyDir)
+		cmdDiff := w.ilabCommand(lab, workDir, append(diffArgs, w.taxonomyBaseArgs()...)...)
 		var stderr bytes.Buffer
+		var diffOutput bytes.Buffer
+		cmdDiff.Stdout = &diffOutput
 		cmdDiff.Stderr = &stderr
 
-		diffOutput, err := cmdDiff.Output()
-		if err != nil {
-			detailedErr := fmt.Errorf("Failed to execute 'ilab diff': %v. \nDetails: %s", err, stderr.String())
-			w.reportJobError(detailedErr)
+		if err := cmdDiff.Run(); err != nil {
+			detailedErr := fmt.Errorf("Failed to execute '%s': %v. \nDetails: %s", cmdDiff, err, stderr.String())
+			w.writeStderrLog(outputDir, "diff", stderr.Bytes())
+			w.reportFailedJob(outputDir, prNumber, outDirName, detailedErr)
 			sugar.Errorf(detailedErr.Error())
 			return
 		}
 
-		diffOutputLines := strings.Split(string(diffOutput), "\n")
-		// Filter taxonomy files ending in .yaml and prepare them relative to workDir
+		// Classify the taxonomy files and prepare them relative to workDir
+		classified := w.classifyChangedFiles(splitLines(diffOutput.String()))
+		changedFiles := taxonomyFilePaths(classified)
 		var taxonomyFiles []string
-		for _, line := range diffOutputLines {
-			if strings.HasSuffix(line, ".yaml") {
-				relativePath := filepath.Join("taxonomy", line)
-				taxonomyFiles = append(taxonomyFiles, relativePath)
+		for _, file := range changedFiles {
+			taxonomyFiles = append(taxonomyFiles, filepath.Join(w.taxonomyDir, filepath.FromSlash(file)))
+		}
+		// SDG is not asked to generate data from files that fail the lint, the findings are
+		// annotated on the PR
+		if summary := lintErrorSummary(w.lintTaxonomyFiles(changedFiles, outputDir)); summary != "" {
+			err := fmt.Errorf("lint found errors in the taxonomy files:\n%s", summary)
+			sugar.Error(err)
+			w.reportFailedJob(outputDir, prNumber, outDirName, err)
+			return
+		}
+
+		// Catch compliance problems and broken knowledge document references before sending anything to SDG
+		var knowledgeFiles []string
+		for _, file := range classified {
+			if file.Kind == taxonomyTypeKnowledge {
+				knowledgeFiles = append(knowledgeFiles, file.Path)
 			}
 		}
+		if err := w.checkCompliance(knowledgeFiles, outputDir); err != nil {
+			sugar.Error(err)
+			w.reportFailedJob(outputDir, prNumber, outDirName, err)
+			return
+		}
+		if err := w.checkKnowledgeDocuments(knowledgeFiles, outputDir); err != nil {
+			sugar.Error(err)
+			w.reportFailedJob(outputDir, prNumber, outDirName, err)
+			return
+		}
 
 		// Uncomment to bypass ilab diff
 		//taxonomyFiles, err := discoverGitTaxonomyFiles(taxonomyDir, "main")
@@ -636,7 +1504,9 @@ func (w *Worker) processJob() {
 
 		// Process each YAML file and filter questions if over the max seed
 		filteredFiles := []string{}
-		for _, file := range taxonomyFiles {
+		var filteredPaths []string
+		var samplings []seedSampling
+		for i, file := range taxonomyFiles {
 			f, err := os.Open(file)
 			if err != nil {
 				sugar.Errorf("Failed to open file: %v", err)
@@ -653,7 +1523,13 @@ func (w *Worker) processJob() {
 
 			if seedExamples, ok := data["seed_examples"].([]interface{}); ok && len(seedExamples) > w.maxSeed {
 				originalCount := len(seedExamples)
-				data["seed_examples"] = seedExamples[:w.maxSeed]
+				kept := sampleSeedExamples(seedExamples, w.maxSeed, MaxSeedStrategy, MaxSeedRandomSeed)
+				sampled := make([]interface{}, 0, len(kept))
+				for _, index := range kept {
+					sampled = append(sampled, seedExamples[index])
+				}
+				data["seed_examples"] = sampled
+				samplings = append(samplings, newSeedSampling(changedFiles[i], MaxSeedStrategy, MaxSeedRandomSeed, seedExamples, kept))
 				outputData, err := yaml.Marshal(data)
 				if err != nil {
 					sugar.Errorf("Failed to re-marshal filtered YAML data: %v", err)
@@ -672,41 +1548,84 @@ func (w *Worker) processJob() {
 					sugar.Errorf("Failed to write filtered data to the new QNA file: %v", err)
 					continue
 				}
-				sugar.Infof("Trimmed %s from %d to %d Q&A pairs", file, originalCount, w.maxSeed)
+				sugar.Infof("Trimmed %s from %d to %d Q&A pairs with the %s strategy", file, originalCount, w.maxSeed, MaxSeedStrategy)
 
 				filteredFiles = append(filteredFiles, filteredQNA.Name())
 			} else {
 				// No filtering needed, use the original file
 				filteredFiles = append(filteredFiles, file)
 			}
+			filteredPaths = append(filteredPaths, changedFiles[i])
+		}
+
+		if err := writeSeedSampling(outputDir, samplings); err != nil {
+			sugar.Error(err)
 		}
 
 		// Generate data with potentially filtered files
-		outputFiles, err := w.datagenSvc(filteredFiles, outputDir, NumInstructions)
+		outputFiles, err := w.datagenSvc(filteredFiles, filteredPaths, outputDir, w.numInstructions)
 		if err != nil {
 			sugar.Errorf("Failed to generate data: %v", err)
-			w.reportJobError(err)
+			w.reportFailedJob(outputDir, prNumber, outDirName, err)
 			return
 		}
 		sugar.Infof("Generated data written to: %v", outputFiles)
 
+		if err := w.processDataset(outputDir, outputFiles); err != nil {
+			sugar.Errorf("Generated dataset validation failed: %v", err)
+			w.reportFailedJob(outputDir, prNumber, outDirName, err)
+			return
+		}
+	case jobTrain:
+		// @instructlab-bot train
+		// Trains the model on the data of the generate-local job of the PR
+		if err := w.runTrain(lab, workDir, outputDir, repoOwner, repoName, prNumber); err != nil {
+			sugar.Errorf("Could not run train: %v", err)
+			w.reportJobError(err)
+			return
+		}
+	case jobEvaluate:
+		// @instructlab-bot evaluate
+		// Compares the scores of the model and the base model on a benchmark
+		if err := w.runEvaluate(lab, workDir, outputDir, prNumber); err != nil {
+			sugar.Errorf("Could not run evaluate: %v", err)
+			w.reportJobError(err)
+			return
+		}
+
 	default:
 		sugar.Errorf("Unknown job type: %s", jobType)
 		return
 	}
 
+	w.logStep(jobType, runStart, nil)
+	w.publishJobResults(sugar, outputDir, prNumber, outDirName, jobType, repoOwner, repoName)
+}
+
+// publishJobResults uploads the output directory of a successful job and notifies the "results"
+// queue with the public URL of the results
+func (w *Worker) publishJobResults(sugar *zap.SugaredLogger, outputDir, prNumber, outDirName, jobType, repoOwner, repoName string) {
 	// handle file operations and get the index file key
+	uploadStart := time.Now()
 	indexUpKey := w.handleOutputFiles(outputDir, prNumber, outDirName)
+	w.logStep("upload", uploadStart, nil)
 	if indexUpKey == "" {
 		sugar.Errorf("Failed to handle output files correctly")
 		return
 	}
 
-	indexPublicURL := fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", S3Bucket, AWSRegion, indexUpKey)
+	if jobType == jobGenerateLocal && w.branch == "" && !w.dryRun {
+		if err := w.recordTrainingData(outputDir, w.s3JobDir(outDirName), repoOwner, repoName, prNumber); err != nil {
+			sugar.Errorf("Could not record the training data: %v", err)
+		}
+	}
+
+	indexPublicURL := s3PublicURL(indexUpKey)
 
 	// Notify the "results" queue that the job is done with the public URL
 	w.postJobResults(indexPublicURL, jobType)
 	sugar.Infof("Job done")
+	w.collectOutputDirs(outputDir)
 }
 
 // gitOperations handles the Git-related operations for a job and returns the head hash
@@ -715,9 +1634,9 @@ func (w *Worker) gitOperations(sugar *zap.SugaredLogger, taxonomyDir string, prN
 
 	var r *git.Repository
 	if _, err := os.Stat(taxonomyDir); os.IsNotExist(err) {
-		sugar.Warnf("Taxonomy directory does not exist, cloning from %s", GitRemote)
+		sugar.Warnf("Taxonomy directory does not exist, cloning from %s", w.gitRemote)
 		r, err = git.PlainClone(taxonomyDir, false, &git.CloneOptions{
-			URL: GitRemote,
+			URL: w.gitRemote,
 			Auth: &githttp.BasicAuth{
 				Username: GithubUsername,
 				Password: GithubToken,
@@ -737,13 +1656,16 @@ func (w *Worker) gitOperations(sugar *zap.SugaredLogger, taxonomyDir string, prN
 		var lastErr error
 		for attempt := 1; attempt <= gitMaxRetries; attempt++ {
 			sugar.Debug("Fetching from origin")
-			err := r.Fetch(&git.FetchOptions{
-				RemoteName: Origin,
-				Auth: &githttp.BasicAuth{
-					Username: GithubUsername,
-					Password: GithubToken,
-				},
-			})
+			err := injectedFault(faultGitTimeout)
+			if !faultInjected(faultGitTimeout) {
+				err = r.Fetch(&git.FetchOptions{
+					RemoteName: Origin,
+					Auth: &githttp.BasicAuth{
+						Username: GithubUsername,
+						Password: GithubToken,
+					},
+				})
+			}
 			if err == nil {
 				return nil
 			}
@@ -764,20 +1686,21 @@ func (w *Worker) gitOperations(sugar *zap.SugaredLogger, taxonomyDir string, prN
 		return "", fmt.Errorf("could not get worktree: %v", err)
 	}
 
-	sugar.Debug("Checking out main")
-	// Retry mechanism for checking out main branch
+	baseRef := w.prBaseRef()
+	sugar.Debugf("Checking out %s", baseRef)
+	// Retry mechanism for checking out the base branch
 	retryCheckout := func() error {
 		var lastErr error
 		for attempt := 1; attempt <= gitMaxRetries; attempt++ {
 			err := wt.Checkout(&git.CheckoutOptions{
-				Branch: plumbing.ReferenceName(fmt.Sprintf("refs/remotes/%s/main", Origin)),
+				Branch: plumbing.NewRemoteReferenceName(Origin, baseRef),
 			})
 			if err == nil {
 				return nil
 			}
 			lastErr = err
 			if attempt < gitMaxRetries {
-				sugar.Infof("Retrying checkout of main, attempt %d/%d", attempt+1, gitMaxRetries)
+				sugar.Infof("Retrying checkout of %s, attempt %d/%d", baseRef, attempt+1, gitMaxRetries)
 				time.Sleep(gitRetryDelay)
 			}
 		}
@@ -785,7 +1708,11 @@ func (w *Worker) gitOperations(sugar *zap.SugaredLogger, taxonomyDir string, prN
 	}
 
 	if err := retryCheckout(); err != nil {
-		return "", fmt.Errorf("could not checkout main after retries: %v", err)
+		return "", fmt.Errorf("could not checkout %s after retries: %v", baseRef, err)
+	}
+
+	if w.branch != "" {
+		return w.checkoutBranch(sugar, r, wt)
 	}
 
 	prBranchName := fmt.Sprintf("pr-%s", prNumber)
@@ -823,56 +1750,156 @@ func (w *Worker) gitOperations(sugar *zap.SugaredLogger, taxonomyDir string, prN
 	if err != nil {
 		return "", fmt.Errorf("could not get HEAD: %v", err)
 	}
+	if w.prSha == "" || head.Hash().String() == w.prSha {
+		return head.Hash().String(), nil
+	}
+
+	// The PR was pushed to since the job was queued, the job runs on the commit it was queued for
+	sugar.Infof("PR head moved from %s to %s since the job was queued, checking out %s", w.prSha, head.Hash(), w.prSha)
+	if err := checkoutCommit(r, wt, w.prSha); err != nil {
+		sugar.Debugf("Fetching commit %s", w.prSha)
+		err = r.Fetch(&git.FetchOptions{
+			RemoteName: Origin,
+			RefSpecs:   []gitconfig.RefSpec{gitconfig.RefSpec(fmt.Sprintf("%s:refs/heads/%s", w.prSha, prBranchName))},
+			Auth: &githttp.BasicAuth{
+				Username: "instructlab-bot",
+				Password: GithubToken,
+			},
+			Force: true,
+		})
+		if err != nil && err != git.NoErrAlreadyUpToDate {
+			return "", fmt.Errorf("commit %s of PR %s is no longer available, it was likely force-pushed away: %v", w.prSha, prNumber, err)
+		}
+		if err := checkoutCommit(r, wt, w.prSha); err != nil {
+			return "", fmt.Errorf("could not checkout commit %s of PR %s: %v", w.prSha, prNumber, err)
+		}
+	}
+	return w.prSha, nil
+}
+
+// prBaseRef is the branch the PR of the job is merged into, main for the jobs queued without one
+func (w *Worker) prBaseRef() string {
+	if w.baseRef == "" {
+		return "main"
+	}
+	return w.baseRef
+}
+
+// checkoutCommit moves the checked out branch to the commit, which must be in the repository
+func checkoutCommit(r *git.Repository, wt *git.Worktree, sha string) error {
+	hash := plumbing.NewHash(sha)
+	if _, err := r.CommitObject(hash); err != nil {
+		return err
+	}
+	return wt.Reset(&git.ResetOptions{Commit: hash, Mode: git.HardReset})
+}
+
+// checkoutBranch checks out the remote branch of a scheduled job and returns its head hash
+func (w *Worker) checkoutBranch(sugar *zap.SugaredLogger, r *git.Repository, wt *git.Worktree) (string, error) {
+	sugar.Debugf("Checking out branch %s", w.branch)
+	ref, err := r.Reference(plumbing.NewRemoteReferenceName(Origin, w.branch), true)
+	if err != nil {
+		return "", fmt.Errorf("could not find branch %s: %v", w.branch, err)
+	}
+	if err := wt.Checkout(&git.CheckoutOptions{Hash: ref.Hash()}); err != nil {
+		return "", fmt.Errorf("could not checkout branch %s: %v", w.branch, err)
+	}
+	return ref.Hash().String(), nil
+}
 
-	return head.Hash().String(), nil
+// taxonomyBaseArgs makes ilab consider the whole taxonomy for scheduled jobs, PR jobs only
+// look at the files changed against the branch the PR is merged into
+func (w *Worker) taxonomyBaseArgs() []string {
+	if w.branch != "" {
+		return []string{"--taxonomy-base", "empty"}
+	}
+	if w.baseRef == "" {
+		return nil
+	}
+	return []string{"--taxonomy-base", Origin + "/" + w.baseRef}
+}
+
+// taxonomyDirForRepo returns the local checkout directory for a job's repository. The default
+// remote keeps using the "taxonomy" directory, other repositories are cloned under "repos/<owner>/<name>".
+func taxonomyDirForRepo(workDir, repoOwner, repoName, gitRemote string) string {
+	if gitRemote == GitRemote || repoOwner == "" || repoName == "" {
+		return filepath.Join(workDir, "taxonomy")
+	}
+	return filepath.Join(workDir, "repos", repoOwner, repoName)
 }
 
 // postJobResults posts the results of a job to a Redis queue
 func (w *Worker) postJobResults(URL, jobType string) {
-	conn := w.pool.Get()
-	defer conn.Close()
-
 	// Calculate the job duration and round it up
 	jobDuration := time.Since(w.jobStart).Seconds()
 	roundedDuration := math.Ceil(jobDuration)
 	w.logger.Infof("Job took %.0fs to run", roundedDuration)
+	modelName := w.determineModelName(jobType)
 
-	if _, err := conn.Do("SET", fmt.Sprintf("jobs:%s:duration", w.job), roundedDuration); err != nil {
-		w.logger.Errorf("Could not set job duration in redis: %v", err)
+	fields := map[jobqueue.Field]interface{}{
+		jobqueue.FieldDuration:  roundedDuration,
+		jobqueue.FieldStatus:    jobqueue.StatusSuccess,
+		jobqueue.FieldS3URL:     URL,
+		jobqueue.FieldCmd:       secretRedactor.redact(w.cmdRun),
+		jobqueue.FieldModelName: modelName,
 	}
-
-	if _, err := conn.Do("SET", fmt.Sprintf("jobs:%s:status", w.job), jobStatusSuccess); err != nil {
-		w.logger.Errorf("Could not set job status in redis: %v", err)
+	if artifactEncryption != nil {
+		fields[jobqueue.FieldEncrypted] = "true"
 	}
+	w.addMetrics(fields)
+	w.withRedis("post the job results", func() error {
+		return w.completeJob(fields)
+	})
 
-	if _, err := conn.Do("SET", fmt.Sprintf("jobs:%s:s3_url", w.job), URL); err != nil {
-		w.logger.Errorf("Could not set s3_url in redis: %v", err)
-	}
+	// Queued apart, a retry of the results must not queue the next stage twice
+	w.withRedis("queue the next pipeline stage", w.queueNextJob)
+}
 
-	if _, err := conn.Do("SET", fmt.Sprintf("jobs:%s:cmd", w.job), w.cmdRun); err != nil {
-		w.logger.Errorf("Could not set cmd in redis: %v", err)
+// queueNextJob queues the next stage of the pipeline of a successful job, if any
+func (w *Worker) queueNextJob() error {
+	nextJob, err := w.jobField(jobqueue.FieldNextJob)
+	if err != nil || nextJob == "" {
+		return err
 	}
+	if err := w.queue.Enqueue(w.ctx, nextJob); err != nil {
+		return fmt.Errorf("could not queue job %s after job %s: %w", nextJob, w.job, err)
+	}
+	w.logger.Infof("Queued the next pipeline job %s", nextJob)
+	return nil
+}
 
-	modelName := w.determineModelName(jobType)
-
-	if _, err := conn.Do("SET", fmt.Sprintf("jobs:%s:model_name", w.job), modelName); err != nil {
-		w.logger.Errorf("Could not set model name in redis: %v", err)
+// checkJobDependency makes sure the job a pipeline stage depends on succeeded
+func (w *Worker) checkJobDependency() error {
+	dependsOn, err := w.jobField(jobqueue.FieldDependsOn)
+	if err != nil || dependsOn == "" {
+		return err
 	}
+	status, err := w.queue.Get(w.ctx, dependsOn, jobqueue.FieldStatus)
+	if err != nil {
+		return err
+	}
+	if status != jobqueue.StatusSuccess {
+		return fmt.Errorf("job %s depends on job %s, which has not succeeded (status %q)", w.job, dependsOn, status)
+	}
+	return nil
+}
 
-	if _, err := conn.Do("LPUSH", "results", w.job); err != nil {
-		w.logger.Errorf("Could not push to redis queue: %v", err)
+// ilabPath returns the ilab binary of the virtual environment, or the one on the PATH
+func ilabPath() string {
+	if VenvDir == "" {
+		return "ilab"
 	}
+	return filepath.Join(VenvDir, venvBinDir, "ilab")
+}
+
+// splitLines splits the output of a command in lines, whether they end with \n or \r\n
+func splitLines(output string) []string {
+	return strings.Split(strings.ReplaceAll(output, "\r\n", "\n"), "\n")
 }
 
 // getModelNameFromConfig retrieves the model name from the config file or precheckEndpoint
 func (w *Worker) getModelNameFromConfig() string {
-	cfgData, err := os.ReadFile(ilabConfigPath)
-	if err != nil {
-		return "unknown"
-	}
-
-	var cfg IlabConfig
-	err = yaml.Unmarshal(cfgData, &cfg)
+	cfg, err := readIlabConfig()
 	if err != nil || cfg.Generate.Model == "" {
 		return "unknown"
 	}
@@ -882,9 +1909,25 @@ func (w *Worker) getModelNameFromConfig() string {
 
 // fetchModelName hits the defined precheckEndpoint with "/models" appended to extract the model name.
 // If fullName is true, it returns the entire ID value; if false, it returns the parsed out name after the double hyphens.
+// With several precheck endpoints, the first one that answers names the model.
 func (w *Worker) fetchModelName(fullName bool) (string, error) {
+	var lastErr error
+	for _, endpoint := range splitEndpoints(w.precheckEndpoint) {
+		name, err := w.fetchEndpointModelName(endpoint, fullName)
+		if err == nil {
+			return name, nil
+		}
+		lastErr = err
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no precheck endpoint configured")
+	}
+	return "", lastErr
+}
+
+// fetchEndpointModelName extracts the model name from the models of a single endpoint, see fetchModelName
+func (w *Worker) fetchEndpointModelName(endpoint string, fullName bool) (string, error) {
 	// Ensure the endpoint URL ends with "/models"
-	endpoint := w.precheckEndpoint
 	if !strings.HasSuffix(endpoint, "/") {
 		endpoint += "/"
 	}
@@ -952,24 +1995,61 @@ func (w *Worker) fetchModelName(fullName bool) (string, error) {
 	return "", fmt.Errorf("model name not found in response")
 }
 
-// reportJobError push app errors into the redis job 'errors' key
+// reportJobError push app errors into the redis job 'errors' key, and their category into 'error_category'
 func (w *Worker) reportJobError(err error) {
-	conn := w.pool.Get()
-	defer conn.Close()
+	// Failed jobs used their GPU too, the bot quotas and the cost reports count their duration
+	duration := math.Ceil(time.Since(w.jobStart).Seconds())
 
-	if _, err := conn.Do("SET", fmt.Sprintf("jobs:%s:errors", w.job), err.Error()); err != nil {
-		w.logger.Errorf("Failed to set the error for job %s: %v", w.job, err)
-		return
+	fields := map[jobqueue.Field]interface{}{
+		jobqueue.FieldErrors:        secretRedactor.redact(err.Error()),
+		jobqueue.FieldErrorCategory: string(errorCategoryOf(err)),
+		jobqueue.FieldDuration:      duration,
+		jobqueue.FieldStatus:        jobqueue.StatusError,
 	}
+	w.withRedis("report the job error", func() error {
+		return w.completeJob(fields)
+	})
+}
 
-	if _, err := conn.Do("SET", fmt.Sprintf("jobs:%s:status", w.job), jobStatusError); err != nil {
-		w.logger.Errorf("Could not set job status in redis: %v", err)
+// reportFailedJob uploads what a failed job produced so far under a failed/ prefix, so the
+// contributor can look at the logs and chatlogs from the error comment, then reports the error
+func (w *Worker) reportFailedJob(outputDir, prNumber, outDirName string, err error) {
+	if indexUpKey := w.handleOutputFiles(outputDir, prNumber, path.Join("failed", outDirName)); indexUpKey != "" {
+
+		indexPublicURL := s3PublicURL(indexUpKey)
+		if err := w.setJobField(jobqueue.FieldFailedURL, indexPublicURL); err != nil {
+			w.logger.Errorf("Could not set the failed artifacts URL of job %s: %v", w.job, err)
+		}
+		if artifactEncryption != nil {
+			if err := w.setJobField(jobqueue.FieldEncrypted, "true"); err != nil {
+				w.logger.Errorf("Could not flag the encrypted artifacts of job %s: %v", w.job, err)
+			}
+		}
 	}
+	w.reportJobError(err)
+}
 
-	if _, err := conn.Do("LPUSH", "results", w.job); err != nil {
-		w.logger.Errorf("Could not push error results to redis queue: %v", err)
+// writeStderrLog saves the stderr captured from an ilab command that failed, so it is uploaded with the other artifacts
+func (w *Worker) writeStderrLog(outputDir, command string, stderr []byte) {
+	if len(stderr) == 0 {
 		return
 	}
+	logFile := filepath.Join(outputDir, fmt.Sprintf("ilab_%s_stderr.log", command))
+	if err := os.WriteFile(logFile, stderr, 0644); err != nil {
+		w.logger.Errorf("Could not write %s: %v", logFile, err)
+	}
+}
+
+// generateLocalArgs are the arguments of the ilab generate command of generate-local jobs, modelEndpoint
+// is the model server started for the job, if any
+func (w *Worker) generateLocalArgs(outputDir, modelEndpoint string) []string {
+	generateArgs := w.ilabArgs(ilabGenerate, "--num-instructions", fmt.Sprintf("%d", w.numInstructions), "--output-dir", outputDir, "--taxonomy-path", w.taxonomyDir)
+	generateArgs = append(generateArgs, w.taxonomyBaseArgs()...)
+	generateArgs = append(generateArgs, w.pipelineParams.args()...)
+	if modelEndpoint != "" {
+		generateArgs = append(generateArgs, "--endpoint-url", modelEndpoint)
+	}
+	return generateArgs
 }
 
 // determineModelName decides the model name based on jobType and configuration.
@@ -978,6 +2058,10 @@ func (w *Worker) determineModelName(jobType string) string {
 		return "sdg service backend"
 	}
 
+	if jobType == jobPreCheck && len(w.models) > 0 {
+		return strings.Join(w.models, ", ")
+	}
+
 	// precheck is the only case we use a remote OpenAI endpoint right now
 	if PreCheckEndpointURL != localEndpoint && jobType == jobPreCheck {
 		modelName, err := w.fetchModelName(false)
@@ -991,88 +2075,56 @@ func (w *Worker) determineModelName(jobType string) string {
 	return w.getModelNameFromConfig()
 }
 
-// datagenSvc generates data for the given taxonomy files and writes the results to the specified output directory.
-func (w *Worker) datagenSvc(taxonomyFiles []string, outputDir string, numSamples int) ([]string, error) {
-	var outputFiles []string
-	httpClient, err := w.createTLSHttpClient()
+// datagenSvc sends the taxonomy files to the SDG service. taxonomyPaths holds the path of every
+// file relative to the taxonomy root, which picks the SDG endpoint and model for it.
+func (w *Worker) datagenSvc(taxonomyFiles, taxonomyPaths []string, outputDir string, numSamples int) ([]string, error) {
+	httpClient, err := w.sdgHTTPClient()
 	if err != nil {
 		return nil, err
 	}
 
-	for _, tf := range taxonomyFiles {
+	requests := make([]sdgRequest, 0, len(taxonomyFiles))
+	var bodies []string
+	for i, tf := range taxonomyFiles {
 		tfData, err := os.ReadFile(tf)
 		if err != nil {
 			return nil, fmt.Errorf("failed to read taxonomy file '%s': %w", tf, err)
 		}
 
-		var jsonData []byte
-		var requestURL string
-
-		if strings.Contains(tf, "taxonomy/knowledge") {
-			tfMap, err := w.createKnowledgePostJSON(tfData, numSamples)
-			if err != nil {
-				return nil, err
-			}
-			jsonData, err = json.Marshal(tfMap)
-			if err != nil {
-				return nil, fmt.Errorf("failed to marshal knowledge JSON post: %w", err)
-			}
-			// Adjust endpoint for knowledge
-			requestURL = strings.Replace(w.sdgEndpoint, "skill", "knowledge", -1)
-		} else {
-			tfMap, err := w.createSkillsPostJSON(tfData, numSamples)
-			if err != nil {
-				return nil, err
-			}
-			jsonData, err = json.Marshal(tfMap)
-			if err != nil {
-				return nil, fmt.Errorf("failed to marshal skills JSON post: %w", err)
-			}
-			// Use the existing endpoint for skills
-			requestURL = w.sdgEndpoint
-		}
-
-		// Modify the endpoint URL if the filepath includes "taxonomy/knowledge"
-		if strings.Contains(tf, "taxonomy/knowledge") {
-			requestURL = strings.Replace(requestURL, "skill", "knowledge", -1)
-		}
-
-		request, err := http.NewRequestWithContext(w.ctx, "POST", requestURL, bytes.NewBuffer(jsonData))
+		request, err := w.newSDGRequest(tf, taxonomyPaths[i], tfData, numSamples)
 		if err != nil {
-			return nil, fmt.Errorf("failed to create request: %w", err)
-		}
-		request.Header.Set("Content-Type", "application/json")
-		request.Header.Set("Accept", "application/json")
-
-		w.logger.Infof("SDG Post Details: %v", request)
-
-		// Register the body for reporting/logging
-		w.cmdRun = string(jsonData)
-
-		response, err := httpClient.Do(request)
-		if err != nil {
-			return nil, fmt.Errorf("failed to execute request: %w", err)
-		}
-		defer response.Body.Close()
-
-		responseBody, err := io.ReadAll(response.Body)
-		if err != nil {
-			return nil, fmt.Errorf("failed to read response body: %w", err)
+			return nil, err
 		}
+		requests = append(requests, request)
+		bodies = append(bodies, string(request.body))
+	}
 
-		if response.StatusCode != http.StatusOK {
-			return nil, fmt.Errorf("unexpected status code %d: %s", response.StatusCode, string(responseBody))
-		}
+	// Register the bodies for reporting/logging
+	w.cmdRun = strings.Join(bodies, "\n")
 
-		outputPath := path.Join(outputDir, fmt.Sprintf("sdg_%d_%s.json", time.Now().Unix(), filepath.Base(tf)))
-		if err := os.WriteFile(outputPath, responseBody, 0644); err != nil {
-			return nil, fmt.Errorf("failed to write output file: %w", err)
-		}
+	return w.runSDGRequests(httpClient, requests, outputDir)
+}
 
-		outputFiles = append(outputFiles, outputPath)
+// newSDGRequest builds the generation request of a taxonomy file for the SDG endpoint its path is routed to
+func (w *Worker) newSDGRequest(taxonomyFile, taxonomyPath string, tfData []byte, numSamples int) (sdgRequest, error) {
+	target := w.sdgTarget(taxonomyPath)
+	var tfMap map[string]interface{}
+	var err error
+	if target.knowledge {
+		tfMap, err = w.createKnowledgePostJSON(tfData, target.model, numSamples)
+	} else {
+		tfMap, err = w.createSkillsPostJSON(tfData, target.model, numSamples)
+	}
+	if err != nil {
+		return sdgRequest{}, err
+	}
+	jsonData, err := json.Marshal(tfMap)
+	if err != nil {
+		return sdgRequest{}, fmt.Errorf("failed to marshal JSON post for '%s': %w", taxonomyPath, err)
 	}
 
-	return outputFiles, nil
+	w.logger.Infof("Routing %s to SDG endpoint %s with model %s", taxonomyPath, target.endpoint, target.model)
+	return sdgRequest{taxonomyFile: taxonomyFile, url: target.endpoint, body: jsonData}, nil
 }
 
 func (w *Worker) createTLSHttpClient() (*http.Client, error) {
@@ -1102,27 +2154,27 @@ func (w *Worker) createTLSHttpClient() (*http.Client, error) {
 }
 
 // createKnowledgePostJSON convert a skills taxonomy file from YAML to json
-func (w *Worker) createSkillsPostJSON(tfData []byte, numSamples int) (map[string]interface{}, error) {
+func (w *Worker) createSkillsPostJSON(tfData []byte, model string, numSamples int) (map[string]interface{}, error) {
 	var tfMapInterface map[interface{}]interface{}
 	if err := yaml.Unmarshal(tfData, &tfMapInterface); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal YAML: %w", err)
 	}
 	tfMap := interfaceMapToStringMap(tfMapInterface).(map[string]interface{})
 
-	tfMap["mm_model_id"] = sdgModel
+	tfMap["mm_model_id"] = model
 	tfMap["num_samples"] = numSamples
 	return tfMap, nil
 }
 
 // createKnowledgePostJSON convert a knowledge taxonomy file from YAML to json
-func (w *Worker) createKnowledgePostJSON(tfData []byte, numSamples int) (map[string]interface{}, error) {
+func (w *Worker) createKnowledgePostJSON(tfData []byte, model string, numSamples int) (map[string]interface{}, error) {
 	var tfMapInterface map[interface{}]interface{}
 	if err := yaml.Unmarshal(tfData, &tfMapInterface); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal YAML: %w", err)
 	}
 	tfMap := interfaceMapToStringMap(tfMapInterface).(map[string]interface{})
 
-	tfMap["mm_model_id"] = sdgModel
+	tfMap["mm_model_id"] = model
 	tfMap["num_samples"] = numSamples
 
 	// Handle the 'document' field if it exists
@@ -1167,6 +2219,11 @@ func interfaceMapToStringMap(in interface{}) interface{} {
 	return in
 }
 
+// s3JobDir is the S3 directory the output files of the job are uploaded to
+func (w *Worker) s3JobDir(outDirName string) string {
+	return path.Join(w.s3Prefix, fmt.Sprintf("%s-job-%s", outDirName, w.job))
+}
+
 func (w *Worker) handleOutputFiles(outputDir, prNumber, outDirName string) string {
 	sugar := w.logger.With("directory", outputDir)
 
@@ -1177,18 +2234,28 @@ func (w *Worker) handleOutputFiles(outputDir, prNumber, outDirName string) strin
 	}
 
 	publicFiles := make([]map[string]string, 0)
+	// uploaded are the files of the job recorded in its provenance
+	var uploaded []string
 	// Append job ID to outDirName for uniqueness
-	jobSpecificOutDirName := fmt.Sprintf("%s-job-%s", outDirName, w.job)
+	jobSpecificOutDirName := w.s3JobDir(outDirName)
 
 	for _, item := range items {
 		filename := item.Name()
-		fullPath := path.Join(outputDir, filename)
+		fullPath := filepath.Join(outputDir, filename)
 		info, err := item.Info()
 		if err != nil {
 			sugar.Errorf("Could not get info for file %s: %v", filename, err)
 			continue
 		}
 
+		// Mask the secrets before the viewers are generated and the files uploaded
+		if info.ModTime().After(w.jobStart) && !item.IsDir() {
+			if err := secretRedactor.redactFile(fullPath); err != nil {
+				sugar.Errorf("Could not redact file %s: %v", filename, err)
+				continue
+			}
+		}
+
 		// Strip the context prompt out from the question in the precheck logs
 		if info.ModTime().After(w.jobStart) && strings.HasSuffix(filename, ".log") {
 			content, err := os.ReadFile(fullPath)
@@ -1211,95 +2278,114 @@ func (w *Worker) handleOutputFiles(outputDir, prNumber, outDirName string) strin
 
 		// Only process files created after the job start time
 		if info.ModTime().After(w.jobStart) {
-			if strings.HasSuffix(filename, ".json") || strings.HasSuffix(filename, ".jsonl") {
-				formattedJSONKey := generateFormattedJSON(w.ctx, outputDir, filename, w.svc, w.logger)
-				if formattedJSONKey != "" {
-					formattedJSONURL := fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", S3Bucket, AWSRegion, formattedJSONKey)
-					publicFiles = append(publicFiles, map[string]string{
-						"name": filename + jsonViewerFilenameSuffix,
-						"url":  formattedJSONURL,
-					})
+			// The sensitive files are only uploaded encrypted, without their viewers
+			encrypted := !item.IsDir() && encryptedArtifact(filename)
+			jobLogFile := filename == jobLogFilename
+			if encrypted {
+				encryptedPath, err := artifactEncryption.encryptFile(fullPath)
+				if err != nil {
+					sugar.Errorf("Could not encrypt file %s: %v", filename, err)
+					continue
 				}
+				fullPath, filename = encryptedPath, filepath.Base(encryptedPath)
 			}
+			upKey := fmt.Sprintf("%s/%s", jobSpecificOutDirName, filename)
+			publicURL := s3PublicURL(upKey)
+
+			if !encrypted {
+				if strings.HasSuffix(filename, ".json") || strings.HasSuffix(filename, ".jsonl") {
+					var formattedJSONKey string
+					if strings.HasSuffix(filename, ".jsonl") {
+						// Datasets are too large to embed, the viewer fetches the uploaded file
+						formattedJSONKey = generateJSONLViewer(w.ctx, outputDir, filename, w.s3Prefix, publicURL, w.s3Tags, w.svc, w.logger)
+					} else {
+						formattedJSONKey = generateFormattedJSON(w.ctx, outputDir, filename, w.s3Prefix, w.s3Tags, w.svc, w.logger)
+					}
+					if formattedJSONKey != "" {
+						formattedJSONURL := s3PublicURL(formattedJSONKey)
+						publicFiles = append(publicFiles, map[string]string{
+							"name": filename + jsonViewerFilenameSuffix,
+							"url":  formattedJSONURL,
+						})
+					}
+				}
 
-			formattedYAMLKey := generateFormattedYAML(w.ctx, outputDir, filename, w.svc, w.logger)
-			if formattedYAMLKey != "" {
-				yamlFilename := strings.TrimSuffix(filename, path.Ext(filename)) + ".yaml-viewer"
-				formattedYAMLURL := fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", S3Bucket, AWSRegion, formattedYAMLKey)
-				publicFiles = append(publicFiles, map[string]string{
-					"name": yamlFilename + ".html",
-					"url":  formattedYAMLURL,
-				})
+				formattedYAMLKey := generateFormattedYAML(w.ctx, outputDir, filename, w.s3Prefix, w.s3Tags, w.svc, w.logger)
+				if formattedYAMLKey != "" {
+					yamlFilename := strings.TrimSuffix(filename, filepath.Ext(filename)) + ".yaml-viewer"
+					formattedYAMLURL := s3PublicURL(formattedYAMLKey)
+					publicFiles = append(publicFiles, map[string]string{
+						"name": yamlFilename + ".html",
+						"url":  formattedYAMLURL,
+					})
+				}
 			}
 
 			var contentType string
-			if strings.HasSuffix(filename, ".json") || strings.Contains(filename, "json-viewer.html") {
+			if encrypted {
+				contentType = "application/octet-stream"
+			} else if strings.HasSuffix(filename, ".json") || strings.Contains(filename, "json-viewer.html") {
 				contentType = "application/json-lines+json"
+			} else if filename == attachmentsFilename {
+				contentType = "text/html"
 			} else {
 				contentType = "text/plain"
 			}
 
 			// Upload the job file and add it to the publicFiles list
-			file, err := os.Open(fullPath)
-			if err != nil {
-				sugar.Errorf("Could not open file: %v", err)
-				continue
-			}
-			defer file.Close()
-
-			upKey := fmt.Sprintf("%s/%s", jobSpecificOutDirName, filename)
-			_, err = w.svc.PutObject(w.ctx, &s3.PutObjectInput{
-				Bucket:      aws.String(S3Bucket),
-				Key:         aws.String(upKey),
-				Body:        file,
-				ContentType: aws.String(contentType),
-			})
-			if err != nil {
+			if err := uploadFile(w.ctx, w.svc, upKey, fullPath, contentType, w.s3Tags, sugar); err != nil {
 				sugar.Errorf("Could not upload file to S3: %v", err)
 				continue
 			}
-			publicURL := fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", S3Bucket, AWSRegion, upKey)
+			if jobLogFile && w.jobLog != nil {
+				w.jobLog.key = upKey
+			}
 			publicFiles = append(publicFiles, map[string]string{
 				"name": filename,
 				"url":  publicURL,
 			})
+			if !item.IsDir() && filename != provenanceFilename {
+				uploaded = append(uploaded, filename)
+			}
 		}
 	}
 
-	if len(publicFiles) == 0 {
-		return ""
-	}
-
-	// Generate index.html
-	indexFile, err := os.Create(path.Join(outputDir, "index.html"))
-	if err != nil {
-		sugar.Errorf("Could not create index.html: %v", err)
-		return ""
+	// The provenance covers the files as they were uploaded, once redacted
+	if provenanceSigner != nil && len(uploaded) > 0 {
+		upKey := fmt.Sprintf("%s/%s", jobSpecificOutDirName, provenanceFilename)
+		if err := w.writeProvenance(outputDir, uploaded); err != nil {
+			sugar.Errorf("Could not write the provenance: %v", err)
+		} else if err := uploadFile(w.ctx, w.svc, upKey, filepath.Join(outputDir, provenanceFilename), "application/jsonl", w.s3Tags, sugar); err != nil {
+			sugar.Errorf("Could not upload the provenance to S3: %v", err)
+		} else {
+			publicFiles = append(publicFiles, map[string]string{
+				"name": provenanceFilename,
+				"url":  s3PublicURL(upKey),
+			})
+		}
 	}
-	defer indexFile.Close()
 
-	if err := generateIndexHTML(indexFile, prNumber, publicFiles); err != nil {
-		sugar.Errorf("Could not generate index.html: %v", err)
+	if len(publicFiles) == 0 {
 		return ""
 	}
 
-	// Re-open index file for uploading
-	indexFile, err = os.Open(path.Join(outputDir, "index.html"))
-	if err != nil {
-		sugar.Errorf("Could not re-open index.html: %v", err)
-		return ""
+	name := fmt.Sprintf("PR %s", prNumber)
+	if w.branch != "" {
+		name = fmt.Sprintf("branch %s", w.branch)
 	}
-	defer indexFile.Close()
-
 	indexUpKey := fmt.Sprintf("%s/index.html", jobSpecificOutDirName)
-	_, err = w.svc.PutObject(w.ctx, &s3.PutObjectInput{
-		Bucket:      aws.String(S3Bucket),
-		Key:         aws.String(indexUpKey),
-		Body:        indexFile,
-		ContentType: aws.String("text/html"),
-	})
-	if err != nil {
-		sugar.Errorf("Could not upload index.html to S3: %v", err)
+	render := func(indexFile io.Writer) error {
+		return generateIndexHTML(indexFile, name, w.reportMetadata(prNumber), publicFiles)
+	}
+	// The results link to the instructions to decrypt the artifacts rather than to the artifacts
+	if artifactEncryption != nil {
+		indexUpKey = fmt.Sprintf("%s/%s", jobSpecificOutDirName, accessFilename)
+		render = func(accessFile io.Writer) error {
+			return generateAccessHTML(accessFile, name, w.reportMetadata(prNumber), publicFiles)
+		}
+	}
+	if err := uploadStream(w.ctx, w.svc, indexUpKey, "text/html", w.s3Tags, render); err != nil {
+		sugar.Errorf("Could not upload %s to S3: %v", path.Base(indexUpKey), err)
 		return ""
 	}
 
@@ -7,8 +7,12 @@ import (
 	"net/http/httptest"
 	"os"
 	"regexp"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/zap"
 )
@@ -21,11 +25,13 @@ func TestGenerateIndexHTML(t *testing.T) {
 	defer os.Remove(f.Name())
 
 	presignedFiles := []map[string]string{
-		{"name": "file1", "url": "http://example.com/file1"},
-		{"name": "file2", "url": "http://example.com/file2"},
+		{"name": "precheck.log", "url": "http://example.com/precheck.log"},
+		{"name": "combined_chatlogs.yaml", "url": "http://example.com/combined_chatlogs.yaml"},
+		{"name": "combined_chatlogs.html", "url": "http://example.com/combined_chatlogs.html"},
 	}
+	metadata := []reportField{{Name: "Job", Value: "42"}, {Name: "Pull request", Value: "123"}}
 
-	if err := generateIndexHTML(f, "123", presignedFiles); err != nil {
+	if err := generateIndexHTML(f, "PR 123", metadata, presignedFiles); err != nil {
 		t.Fatal(err)
 	}
 
@@ -34,81 +40,18 @@ func TestGenerateIndexHTML(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-
-	expected := `
-<!DOCTYPE html>
-<html>
-<head>
-    <title>Generated Data for PR 123</title>
-    <style>
-        :root {
-            --primary-color: #007bff;
-            --hover-color: #0056b3;
-            --text-color: #333;
-            --background-color: #f8f9fa;
-            --link-color: #0066cc;
-            --link-hover-color: #0044cc;
-        }
-
-        body {
-            font-family: 'Segoe UI', Tahoma, Geneva, Verdana, sans-serif;
-            background-color: var(--background-color);
-            margin: 0;
-            padding: 20px;
-            color: var(--text-color);
-        }
-
-        h1 {
-            color: var(--primary-color);
-            text-align: center;
-            margin-bottom: 2rem;
-        }
-
-        ul {
-            list-style-type: none;
-            padding: 0;
-            max-width: 600px;
-            margin: auto;
-        }
-
-        li {
-            background-color: #fff;
-            margin-bottom: 10px;
-            padding: 10px;
-            border-radius: 5px;
-            box-shadow: 0 2px 4px rgba(0,0,0,0.1);
-            transition: transform 0.2s ease-in-out;
-        }
-
-        li:hover {
-            transform: translateY(-3px);
-        }
-
-        a {
-            color: var(--link-color);
-            text-decoration: none;
-            font-weight: 500;
-        }
-
-        a:hover {
-            color: var(--link-hover-color);
-            text-decoration: underline;
-        }
-    </style>
-</head>
-<body>
-    <h1>Generated Data for PR 123</h1>
-	<ul>
-		<li><a href="http://example.com/file1">file1</a></li>
-		<li><a href="http://example.com/file2">file2</a></li>
-	</ul>
-</body>
-</html>`
-
-	normalizedExpected := normalizeHTML(expected)
-	normalizedActual := normalizeHTML(string(contents))
-
-	assert.Equal(t, normalizedExpected, normalizedActual)
+	html := string(contents)
+
+	assert.Contains(t, html, "<title>Generated Data for PR 123</title>")
+	assert.Contains(t, html, "<h1>Generated Data for PR 123</h1>")
+	assert.Contains(t, html, "<dt>Pull request</dt>\n            <dd>123</dd>")
+	assert.Contains(t, html, `<li class="artifact"><a href="http://example.com/precheck.log">precheck.log</a></li>`)
+	// The artifacts are grouped by type, data first and logs last
+	data := strings.Index(html, "<h2>Data</h2>")
+	viewers := strings.Index(html, "<h2>Viewers</h2>")
+	logs := strings.Index(html, "<h2>Logs</h2>")
+	assert.True(t, data > 0 && data < viewers && viewers < logs, "unexpected section order")
+	assert.NotContains(t, html, "<h2>Other</h2>")
 }
 
 // TestFetchModelName verify the model name is extracted from the id key.
@@ -227,6 +170,52 @@ func TestFetchModelNameWithInvalidObject(t *testing.T) {
 	assert.Empty(t, modelName, "The model name should be empty for invalid object field")
 }
 
+// TestSplitLines verify ilab output is split the same with Unix and Windows line endings.
+func TestSplitLines(t *testing.T) {
+	expected := []string{"compositional_skills/writing/qna.yaml", "knowledge/science/qna.yaml", ""}
+	assert.Equal(t, expected, splitLines("compositional_skills/writing/qna.yaml\nknowledge/science/qna.yaml\n"))
+	assert.Equal(t, expected, splitLines("compositional_skills/writing/qna.yaml\r\nknowledge/science/qna.yaml\r\n"))
+}
+
+// TestTaxonomyBaseArgs verifies PR jobs diff against their base branch and scheduled jobs the whole taxonomy.
+func TestTaxonomyBaseArgs(t *testing.T) {
+	assert.Nil(t, (&Worker{}).taxonomyBaseArgs())
+	assert.Equal(t, []string{"--taxonomy-base", Origin + "/release-1.0"}, (&Worker{baseRef: "release-1.0"}).taxonomyBaseArgs())
+	assert.Equal(t, []string{"--taxonomy-base", "empty"}, (&Worker{branch: "main"}).taxonomyBaseArgs())
+	assert.Equal(t, "main", (&Worker{}).prBaseRef())
+	assert.Equal(t, "release-1.0", (&Worker{baseRef: "release-1.0"}).prBaseRef())
+}
+
+// TestCheckoutCommit verifies a job runs on the commit it was queued for after the PR moved on.
+func TestCheckoutCommit(t *testing.T) {
+	dir := t.TempDir()
+	r, err := git.PlainInit(dir, false)
+	assert.NoError(t, err)
+	wt, err := r.Worktree()
+	assert.NoError(t, err)
+
+	commit := func(content string) string {
+		assert.NoError(t, os.WriteFile(dir+"/qna.yaml", []byte(content), 0o644))
+		_, err := wt.Add("qna.yaml")
+		assert.NoError(t, err)
+		hash, err := wt.Commit(content, &git.CommitOptions{Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()}})
+		assert.NoError(t, err)
+		return hash.String()
+	}
+	queued := commit("queued")
+	commit("pushed")
+
+	assert.NoError(t, checkoutCommit(r, wt, queued))
+	head, err := r.Head()
+	assert.NoError(t, err)
+	assert.Equal(t, queued, head.Hash().String())
+	content, err := os.ReadFile(dir + "/qna.yaml")
+	assert.NoError(t, err)
+	assert.Equal(t, "queued", string(content))
+
+	assert.Error(t, checkoutCommit(r, wt, "0123456789abcdef0123456789abcdef01234567"))
+}
+
 // Replace all whitespace sequences with a single space. Remove spaces between HTML tags
 func normalizeHTML(input string) string {
 	compacted := regexp.MustCompile(`\s+`).ReplaceAllString(input, " ")
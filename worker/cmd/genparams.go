@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/instructlab/instructlab-bot/pkg/jobqueue"
+)
+
+const precheckManifestFilename = "manifest.json"
+
+// generationParams are the sampling parameters sent with every precheck question. Unset
+// values are left to the model server defaults.
+type generationParams struct {
+	Temperature  *float64 `json:"temperature,omitempty" yaml:"temperature,omitempty"`
+	MaxTokens    *int     `json:"max_tokens,omitempty" yaml:"max_tokens,omitempty"`
+	TopP         *float64 `json:"top_p,omitempty" yaml:"top_p,omitempty"`
+	SystemPrompt string   `json:"system_prompt,omitempty" yaml:"system_prompt,omitempty"`
+}
+
+// precheckManifest records how the precheck results were produced so they can be reproduced
+type precheckManifest struct {
+	JobID            string           `json:"job_id"`
+	Models           []precheckTarget `json:"models"`
+	PromptTemplate   string           `json:"prompt_template"`
+	GenerationParams generationParams `json:"generation_params"`
+	// Sample is the part of the PR checked when it is over the precheck limits
+	Sample *precheckSample `json:"sample,omitempty"`
+	// Grounded prechecks ask the knowledge questions without their context too
+	Grounded bool `json:"grounded,omitempty"`
+	// Paraphrases is how many paraphrases of each question were asked
+	Paraphrases int `json:"paraphrases,omitempty"`
+}
+
+// defaultGenerationParams returns the generation parameters set on the worker
+func defaultGenerationParams() generationParams {
+	var params generationParams
+	if PrecheckTemperature >= 0 {
+		temperature := PrecheckTemperature
+		params.Temperature = &temperature
+	}
+	if PrecheckMaxTokens > 0 {
+		maxTokens := PrecheckMaxTokens
+		params.MaxTokens = &maxTokens
+	}
+	if PrecheckTopP >= 0 {
+		topP := PrecheckTopP
+		params.TopP = &topP
+	}
+	params.SystemPrompt = PrecheckSystemPrompt
+	return params
+}
+
+// loadGenerationParams applies the per-job overrides stored on the job to the worker defaults
+func (w *Worker) loadGenerationParams() (generationParams, error) {
+	params := defaultGenerationParams()
+
+	get := func(field jobqueue.Field) (string, error) {
+		return w.jobField(field)
+	}
+
+	value, err := get(jobqueue.FieldTemperature)
+	if err != nil {
+		return params, err
+	}
+	if value != "" {
+		temperature, err := strconv.ParseFloat(value, 64)
+		if err != nil || temperature < 0 || temperature > 2 {
+			return params, fmt.Errorf("invalid temperature %q, it must be between 0 and 2", value)
+		}
+		params.Temperature = &temperature
+	}
+
+	if value, err = get(jobqueue.FieldMaxTokens); err != nil {
+		return params, err
+	}
+	if value != "" {
+		maxTokens, err := strconv.Atoi(value)
+		if err != nil || maxTokens <= 0 {
+			return params, fmt.Errorf("invalid max_tokens %q, it must be a positive integer", value)
+		}
+		params.MaxTokens = &maxTokens
+	}
+
+	if value, err = get(jobqueue.FieldTopP); err != nil {
+		return params, err
+	}
+	if value != "" {
+		topP, err := strconv.ParseFloat(value, 64)
+		if err != nil || topP <= 0 || topP > 1 {
+			return params, fmt.Errorf("invalid top_p %q, it must be greater than 0 and at most 1", value)
+		}
+		params.TopP = &topP
+	}
+
+	if value, err = get(jobqueue.FieldSystemPrompt); err != nil {
+		return params, err
+	}
+	if value != "" {
+		params.SystemPrompt = value
+	}
+	return params, nil
+}
+
+// applySystemPrompt replaces the system prompt of the rendered messages when one is configured
+func (p generationParams) applySystemPrompt(messages []chatMessage) []chatMessage {
+	if p.SystemPrompt == "" {
+		return messages
+	}
+	result := []chatMessage{{Role: "system", Content: p.SystemPrompt}}
+	for _, m := range messages {
+		if m.Role != "system" {
+			result = append(result, m)
+		}
+	}
+	return result
+}
+
+// writePrecheckManifest writes the precheck settings into the output directory
+func writePrecheckManifest(outputDir string, manifest precheckManifest) error {
+	manifestJSON, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not marshal precheck manifest: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(outputDir, precheckManifestFilename), manifestJSON, 0644); err != nil {
+		return fmt.Errorf("could not write precheck manifest: %w", err)
+	}
+	return nil
+}
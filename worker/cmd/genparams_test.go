@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestDefaultGenerationParams verify unset worker parameters are left to the model server.
+func TestDefaultGenerationParams(t *testing.T) {
+	savedTemp, savedMax, savedTopP := PrecheckTemperature, PrecheckMaxTokens, PrecheckTopP
+	defer func() { PrecheckTemperature, PrecheckMaxTokens, PrecheckTopP = savedTemp, savedMax, savedTopP }()
+
+	PrecheckTemperature, PrecheckMaxTokens, PrecheckTopP = -1, 0, -1
+	body, err := json.Marshal(chatCompletionRequest{Messages: []chatMessage{}, Temperature: defaultGenerationParams().Temperature})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"messages": []}`, string(body))
+
+	PrecheckTemperature, PrecheckMaxTokens, PrecheckTopP = 0, 256, 0.9
+	params := defaultGenerationParams()
+	assert.Equal(t, 0.0, *params.Temperature, "a zero temperature is a valid setting")
+	assert.Equal(t, 256, *params.MaxTokens)
+	assert.Equal(t, 0.9, *params.TopP)
+}
+
+// TestApplySystemPrompt verify a configured system prompt replaces the templated one.
+func TestApplySystemPrompt(t *testing.T) {
+	messages := []chatMessage{
+		{Role: "system", Content: defaultSystemPrompt},
+		{Role: "user", Content: "Why?"},
+	}
+	assert.Equal(t, messages, generationParams{}.applySystemPrompt(messages))
+
+	result := generationParams{SystemPrompt: "Be brief."}.applySystemPrompt(messages)
+	assert.Equal(t, []chatMessage{{Role: "system", Content: "Be brief."}, {Role: "user", Content: "Why?"}}, result)
+
+	result = generationParams{SystemPrompt: "Be brief."}.applySystemPrompt(messages[1:])
+	assert.Equal(t, []chatMessage{{Role: "system", Content: "Be brief."}, {Role: "user", Content: "Why?"}}, result)
+}
@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/instructlab/instructlab-bot/pkg/jobqueue"
+)
+
+// groundedMargin is how much lower the score of an answer without the context can be and still
+// count as answered as well as with it
+const groundedMargin = 0.1
+
+// groundedAnswer is the answer of a knowledge question asked without its seed context, recorded
+// next to the answer with the context by the grounded precheck
+type groundedAnswer struct {
+	Answer       string
+	FinishReason string
+	Scores       *similarityScores
+}
+
+// loadGrounded reads whether the precheck asks the knowledge questions without their context too
+func (w *Worker) loadGrounded() (bool, error) {
+	value, err := w.jobField(jobqueue.FieldGrounded)
+	if err != nil {
+		return false, err
+	}
+	return value == "true", nil
+}
+
+// ungroundedMessages renders the question of a knowledge seed example without its context, for
+// the grounded precheck. It returns no messages when the question is not asked twice: the job is
+// not grounded, the file is a skill or the seed example has no context.
+func (w *Worker) ungroundedMessages(kind string, data promptData) ([]chatMessage, error) {
+	if !w.grounded || kind != taxonomyTypeKnowledge || strings.TrimSpace(data.Context) == "" {
+		return nil, nil
+	}
+	data.Context = ""
+	messages, err := precheckPrompts.render(kind, data)
+	if err != nil {
+		return nil, err
+	}
+	return w.genParams.applySystemPrompt(messages), nil
+}
+
+// knownWithoutContext tells whether the model answered as well without the context, when both
+// answers were scored
+func (r precheckSummaryRow) knownWithoutContext() (bool, bool) {
+	if r.WithoutContext == nil || r.Scores == nil || r.WithoutContext.Scores == nil {
+		return false, false
+	}
+	without := r.WithoutContext.Scores.Score()
+	return without >= lowSimilarityThreshold && without >= r.Scores.Score()-groundedMargin, true
+}
+
+// groundedMarkdownSummary compares the answers with and without the context of the knowledge
+// questions asked both ways, "" when there are none
+func groundedMarkdownSummary(rows []precheckSummaryRow) string {
+	var table strings.Builder
+	asked, scored, known := 0, 0, 0
+	for i, row := range rows {
+		if row.WithoutContext == nil {
+			continue
+		}
+		asked++
+		with, without, verdict := "-", "-", "-"
+		if row.Scores != nil {
+			with = fmt.Sprintf("%.2f", row.Scores.Score())
+		}
+		if row.WithoutContext.Scores != nil {
+			without = fmt.Sprintf("%.2f", row.WithoutContext.Scores.Score())
+		}
+		if isKnown, ok := row.knownWithoutContext(); ok {
+			scored++
+			verdict = "📄 needs the document"
+			if isKnown {
+				known++
+				verdict = "🧠 known without it"
+			}
+		}
+		fmt.Fprintf(&table, "| %d | %s | %s | %s | %s | %s |\n", i+1,
+			markdownCell(row.Question, summaryQuestionLength),
+			markdownCell(row.WithoutContext.Answer, summaryAnswerLength),
+			with, without, verdict)
+	}
+	if asked == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("\n#### Answers without the context\n\n")
+	b.WriteString("The knowledge questions were asked a second time without their seed context, to tell what the model already knows from what it needs the knowledge document for.")
+	if scored > 0 {
+		fmt.Fprintf(&b, " %d of %d scored questions were answered as well without the context.", known, scored)
+	}
+	b.WriteString("\n\n| # | Question | Model answer without context | Score with context | Score without context | Verdict |\n")
+	b.WriteString("|---|----------|------------------------------|--------------------|-----------------------|---------|\n")
+	b.WriteString(table.String())
+	return b.String()
+}
@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestUngroundedMessages verify only the knowledge questions with a context are asked again without it.
+func TestUngroundedMessages(t *testing.T) {
+	w := &Worker{}
+	data := promptData{Question: "Who won?", Context: "The home team won"}
+	messages, err := w.ungroundedMessages(taxonomyTypeKnowledge, data)
+	assert.NoError(t, err)
+	assert.Nil(t, messages, "the questions are asked once when the job is not grounded")
+
+	w.grounded = true
+	messages, err = w.ungroundedMessages(taxonomyTypeKnowledge, data)
+	assert.NoError(t, err)
+	assert.Equal(t, []chatMessage{
+		{Role: "system", Content: defaultSystemPrompt},
+		{Role: "user", Content: "Who won?"},
+	}, messages)
+
+	messages, err = w.ungroundedMessages(taxonomyTypeSkill, data)
+	assert.NoError(t, err)
+	assert.Nil(t, messages)
+	messages, err = w.ungroundedMessages(taxonomyTypeKnowledge, promptData{Question: "Who won?"})
+	assert.NoError(t, err)
+	assert.Nil(t, messages)
+}
+
+// TestGroundedMarkdownSummary verify the answers without the context are compared with the grounded ones.
+func TestGroundedMarkdownSummary(t *testing.T) {
+	high, low := similarityScores{RougeL: 0.9}, similarityScores{RougeL: 0.2}
+	rows := []precheckSummaryRow{
+		{File: "knowledge/history/qna.yaml", Kind: taxonomyTypeKnowledge, Question: "Who won?", Answer: "The home team", Scores: &high,
+			WithoutContext: &groundedAnswer{Answer: "The home team", Scores: &high}},
+		{File: "knowledge/history/qna.yaml", Kind: taxonomyTypeKnowledge, Question: "When?", Answer: "In 1990", Scores: &high,
+			WithoutContext: &groundedAnswer{Answer: "I don't know", Scores: &low}},
+		{File: "compositional_skills/poetry/qna.yaml", Kind: taxonomyTypeSkill, Question: "Write a haiku", Answer: "Leaves fall"},
+	}
+	assert.Empty(t, groundedMarkdownSummary(rows[2:]))
+
+	summary := groundedMarkdownSummary(rows)
+	assert.Contains(t, summary, "1 of 2 scored questions were answered as well without the context.")
+	assert.Contains(t, summary, "| 1 | Who won? | The home team | 0.90 | 0.90 | 🧠 known without it |")
+	assert.Contains(t, summary, "| 2 | When? | I don't know | 0.90 | 0.20 | 📄 needs the document |")
+	assert.NotContains(t, summary, "Write a haiku")
+
+	summary = precheckMarkdownSummary(rows, nil)
+	assert.Contains(t, summary, "#### Answers without the context")
+	assert.Contains(t, summary, "**Model answer without the context:**\n\n> I don't know")
+}
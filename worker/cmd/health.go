@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/instructlab/instructlab-bot/pkg/jobqueue"
+	"go.uber.org/zap"
+)
+
+// readinessTimeout bounds each dependency check of the readiness probe
+const readinessTimeout = 2 * time.Second
+
+// readinessCheck is a dependency the worker can't process jobs without
+type readinessCheck struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+// healthServer answers the liveness and readiness probes of the worker. A draining worker,
+// finishing its current job before it exits, is alive but not ready.
+type healthServer struct {
+	checks   []readinessCheck
+	draining atomic.Bool
+}
+
+func newHealthServer(queue *jobqueue.Client, svc *s3.Client) *healthServer {
+	h := &healthServer{}
+	h.checks = append(h.checks, readinessCheck{name: "redis", check: func(ctx context.Context) error {
+		return queue.Ping(ctx).Err()
+	}})
+	// Test mode never posts to S3
+	if !TestMode {
+		h.checks = append(h.checks, readinessCheck{name: "s3", check: func(ctx context.Context) error {
+			_, err := svc.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(S3Bucket)})
+			return err
+		}})
+	}
+	return h
+}
+
+func (h *healthServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(rw http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(rw, "ok")
+		fmt.Fprintf(rw, "worker %s\n", versionString())
+	})
+	mux.HandleFunc("/readyz", func(rw http.ResponseWriter, r *http.Request) {
+		if problems := h.notReady(r.Context()); len(problems) > 0 {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintln(rw, strings.Join(problems, "\n"))
+			return
+		}
+		fmt.Fprintln(rw, "ok")
+	})
+	return mux
+}
+
+// notReady lists why the worker is not ready, it is empty when the worker is ready
+func (h *healthServer) notReady(ctx context.Context) []string {
+	var problems []string
+	if h.draining.Load() {
+		problems = append(problems, "draining: the worker is shutting down")
+	}
+	for _, c := range h.checks {
+		checkCtx, cancel := context.WithTimeout(ctx, readinessTimeout)
+		if err := c.check(checkCtx); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", c.name, err))
+		}
+		cancel()
+	}
+	return problems
+}
+
+// serve starts answering the probes on port, the returned server is to be shut down by the caller
+func (h *healthServer) serve(port int, logger *zap.SugaredLogger) *http.Server {
+	srv := &http.Server{
+		Addr:              net.JoinHostPort("", strconv.Itoa(port)),
+		Handler:           h.handler(),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	go func() {
+		logger.Infof("Serving health probes on %s", srv.Addr)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.Errorf("Health probe server hit an error: %v", err)
+		}
+	}()
+	return srv
+}
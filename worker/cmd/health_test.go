@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func probe(t *testing.T, h *healthServer, path string) (int, string) {
+	srv := httptest.NewServer(h.handler())
+	defer srv.Close()
+	resp, err := http.Get(srv.URL + path)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	return resp.StatusCode, string(body)
+}
+
+// TestHealthProbes verify the worker is ready only when its dependencies are reachable and it is not draining.
+func TestHealthProbes(t *testing.T) {
+	var s3Err error
+	h := &healthServer{checks: []readinessCheck{
+		{name: "redis", check: func(ctx context.Context) error { return nil }},
+		{name: "s3", check: func(ctx context.Context) error { return s3Err }},
+	}}
+
+	status, body := probe(t, h, "/readyz")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "ok\n", body)
+
+	s3Err = fmt.Errorf("bucket not found")
+	status, body = probe(t, h, "/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, "s3: bucket not found\n", body)
+
+	s3Err = nil
+	h.draining.Store(true)
+	status, body = probe(t, h, "/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Contains(t, body, "draining")
+
+	// A draining worker is still alive
+	status, body = probe(t, h, "/healthz")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "ok\nworker "+versionString()+"\n", body)
+}
@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/instructlab/instructlab-bot/pkg/jobqueue"
+)
+
+const ilabVersionFilename = "ilab_version.txt"
+
+// The ilab commands run by the worker, mapped to their arguments by ilabSubcommands
+const (
+	ilabDiff     = "diff"
+	ilabGenerate = "generate"
+	ilabTrain    = "train"
+	ilabEvaluate = "evaluate"
+	ilabServe    = "serve"
+)
+
+// ilabGroupedSince is the first ilab release with the noun-verb commands, the flat ones were
+// deprecated in it and removed in the next release
+var ilabGroupedSince = ilabVersion{Major: 0, Minor: 17}
+
+// ilabSubcommands are the arguments of the worker commands before and since ilabGroupedSince
+var ilabSubcommands = map[string]struct{ flat, grouped []string }{
+	ilabDiff:     {flat: []string{"diff"}, grouped: []string{"taxonomy", "diff"}},
+	ilabGenerate: {flat: []string{"generate"}, grouped: []string{"data", "generate"}},
+	ilabTrain:    {flat: []string{"train"}, grouped: []string{"model", "train"}},
+	ilabServe:    {flat: []string{"serve"}, grouped: []string{"model", "serve"}},
+	// evaluate was only ever released as a model command
+	ilabEvaluate: {flat: []string{"model", "evaluate"}, grouped: []string{"model", "evaluate"}},
+}
+
+var ilabVersionPattern = regexp.MustCompile(`(\d+)\.(\d+)(?:\.(\d+))?`)
+
+// ilabVersion is the version of the ilab CLI running the commands of a job. The zero value is
+// an unknown version, which uses the flat commands the worker always used.
+type ilabVersion struct {
+	Major int
+	Minor int
+	Patch int
+	// Raw is the output of ilab --version
+	Raw string
+}
+
+// parseIlabVersion reads the output of ilab --version, for example "ilab, version 0.16.1"
+func parseIlabVersion(output string) (ilabVersion, error) {
+	raw := strings.TrimSpace(output)
+	match := ilabVersionPattern.FindStringSubmatch(raw)
+	if match == nil {
+		return ilabVersion{}, fmt.Errorf("no version in ilab --version output %q", raw)
+	}
+	v := ilabVersion{Raw: raw}
+	v.Major, _ = strconv.Atoi(match[1])
+	v.Minor, _ = strconv.Atoi(match[2])
+	if match[3] != "" {
+		v.Patch, _ = strconv.Atoi(match[3])
+	}
+	return v, nil
+}
+
+func (v ilabVersion) String() string {
+	if v == (ilabVersion{}) {
+		return "unknown"
+	}
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+func (v ilabVersion) atLeast(other ilabVersion) bool {
+	if v.Major != other.Major {
+		return v.Major > other.Major
+	}
+	if v.Minor != other.Minor {
+		return v.Minor > other.Minor
+	}
+	return v.Patch >= other.Patch
+}
+
+// args returns the arguments of the ilab command followed by args
+func (v ilabVersion) args(command string, args ...string) []string {
+	forms, ok := ilabSubcommands[command]
+	if !ok {
+		panic(fmt.Sprintf("unknown ilab command %q", command))
+	}
+	subcommand := forms.flat
+	if v.atLeast(ilabGroupedSince) {
+		subcommand = forms.grouped
+	}
+	return append(append([]string{}, subcommand...), args...)
+}
+
+// ilabArgs returns the arguments of the ilab command for the ilab version of the job, reading
+// the ilab config of the job when it has one
+func (w *Worker) ilabArgs(command string, args ...string) []string {
+	if w.ilabConfigFile != "" {
+		return append([]string{"--config", w.ilabConfigFile}, w.ilabVersion.args(command, args...)...)
+	}
+	return w.ilabVersion.args(command, args...)
+}
+
+// detectIlabVersion runs ilab --version with the executor of the job type, the version
+// can differ from one job type to the next when they run in containers
+func (w *Worker) detectIlabVersion(lab string) error {
+	var stdout, stderr bytes.Buffer
+	cmd := w.ilabCommand(lab, "", "--version")
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("could not run %s: %v: %s", cmd, err, strings.TrimSpace(stderr.String()))
+	}
+	version, err := parseIlabVersion(stdout.String())
+	if err != nil {
+		return err
+	}
+	w.ilabVersion = version
+	return nil
+}
+
+// recordIlabVersion saves the ilab version with the job results and in the job metadata
+func (w *Worker) recordIlabVersion(outputDir string) error {
+	if err := os.WriteFile(filepath.Join(outputDir, ilabVersionFilename), []byte(w.ilabVersion.Raw+"\n"), 0644); err != nil {
+		return fmt.Errorf("could not write the ilab version: %w", err)
+	}
+	if w.queue == nil {
+		return nil
+	}
+
+	if err := w.setJobField(jobqueue.FieldIlabVersion, w.ilabVersion.String()); err != nil {
+		return fmt.Errorf("could not set ilab version for job %s: %w", w.job, err)
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestParseIlabVersion verify the version is read from the ilab --version output of the released CLIs.
+func TestParseIlabVersion(t *testing.T) {
+	v, err := parseIlabVersion("ilab, version 0.16.1\n")
+	assert.NoError(t, err)
+	assert.Equal(t, ilabVersion{Major: 0, Minor: 16, Patch: 1, Raw: "ilab, version 0.16.1"}, v)
+	assert.Equal(t, "0.16.1", v.String())
+
+	v, err = parseIlabVersion("ilab, version 0.17")
+	assert.NoError(t, err)
+	assert.Equal(t, "0.17.0", v.String())
+
+	_, err = parseIlabVersion("Usage: ilab [OPTIONS] COMMAND [ARGS]...")
+	assert.Error(t, err)
+	assert.Equal(t, "unknown", ilabVersion{}.String())
+}
+
+// TestIlabVersionArgs verify the noun-verb commands are used from ilab 0.17 and the flat ones before.
+func TestIlabVersionArgs(t *testing.T) {
+	flat := ilabVersion{Major: 0, Minor: 16, Patch: 1, Raw: "ilab, version 0.16.1"}
+	grouped := ilabVersion{Major: 0, Minor: 17, Patch: 1, Raw: "ilab, version 0.17.1"}
+
+	assert.Equal(t, []string{"diff", "--quiet"}, flat.args(ilabDiff, "--quiet"))
+	assert.Equal(t, []string{"taxonomy", "diff", "--quiet"}, grouped.args(ilabDiff, "--quiet"))
+	assert.Equal(t, []string{"generate"}, flat.args(ilabGenerate))
+	assert.Equal(t, []string{"data", "generate"}, grouped.args(ilabGenerate))
+	assert.Equal(t, []string{"model", "train"}, ilabVersion{Major: 1}.args(ilabTrain))
+	assert.Equal(t, []string{"model", "evaluate"}, flat.args(ilabEvaluate))
+	// An unknown version keeps the flat commands
+	assert.Equal(t, []string{"train"}, ilabVersion{}.args(ilabTrain))
+
+	// The arguments of the command are not shared with the table
+	args := grouped.args(ilabDiff)
+	args[0] = "changed"
+	assert.Equal(t, []string{"taxonomy", "diff"}, grouped.args(ilabDiff))
+}
@@ -0,0 +1,212 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+// jobIlabConfigFilename is the ilab config rendered for a job in its output directory
+const jobIlabConfigFilename = "ilab_config.yaml"
+
+// IlabConfig is the ilab config.yaml, the sections ilab reads and the evaluate models the
+// worker reads
+type IlabConfig struct {
+	Chat struct {
+		Context         string  `yaml:"context"`
+		GreedyMode      bool    `yaml:"greedy_mode"`
+		LogsDir         string  `yaml:"logs_dir"`
+		MaxTokens       *int    `yaml:"max_tokens"`
+		Model           string  `yaml:"model"`
+		Session         *string `yaml:"session"`
+		ViMode          bool    `yaml:"vi_mode"`
+		VisibleOverflow bool    `yaml:"visible_overflow"`
+	} `yaml:"chat"`
+	General struct {
+		LogLevel string `yaml:"log_level"`
+	} `yaml:"general"`
+	Generate struct {
+		ChunkWordCount  int    `yaml:"chunk_word_count"`
+		Model           string `yaml:"model"`
+		NumCpus         int    `yaml:"num_cpus"`
+		NumInstructions int    `yaml:"num_instructions"`
+		OutputDir       string `yaml:"output_dir"`
+		PromptFile      string `yaml:"prompt_file"`
+		SeedFile        string `yaml:"seed_file"`
+		TaxonomyBase    string `yaml:"taxonomy_base"`
+		TaxonomyPath    string `yaml:"taxonomy_path"`
+	} `yaml:"generate"`
+	Serve struct {
+		GpuLayers  int    `yaml:"gpu_layers"`
+		HostPort   string `yaml:"host_port"`
+		MaxCtxSize int    `yaml:"max_ctx_size"`
+		ModelPath  string `yaml:"model_path"`
+	} `yaml:"serve"`
+	Evaluate struct {
+		Model     string `yaml:"model,omitempty"`
+		BaseModel string `yaml:"base_model,omitempty"`
+	} `yaml:"evaluate,omitempty"`
+}
+
+// ilabInitOptions are the flags of the init command
+type ilabInitOptions struct {
+	ModelPath         string
+	TaxonomyPath      string
+	TaxonomyBase      string
+	OutputDir         string
+	ChatLogsDir       string
+	ServeHostPort     string
+	EvaluateModel     string
+	EvaluateBaseModel string
+}
+
+var (
+	initOptions ilabInitOptions
+	initConfig  string
+	initForce   bool
+)
+
+func init() {
+	initCmd.Flags().StringVarP(&initConfig, "output", "o", ilabConfigPath, "Path of the ilab config to write")
+	initCmd.Flags().BoolVarP(&initForce, "force", "f", false, "Overwrite an existing ilab config")
+	initCmd.Flags().StringVarP(&initOptions.ModelPath, "model-path", "", "models/merlinite-7b-lab-Q4_K_M.gguf", "Model chatted with, served and used to generate")
+	initCmd.Flags().StringVarP(&initOptions.TaxonomyPath, "taxonomy-path", "", "taxonomy", "Default taxonomy checkout, each job uses the checkout of its repository")
+	initCmd.Flags().StringVarP(&initOptions.TaxonomyBase, "taxonomy-base", "", "origin/main", "Branch the taxonomy changes are compared to")
+	initCmd.Flags().StringVarP(&initOptions.OutputDir, "output-dir", "", "generated", "Default output directory of generate, each job uses its own output directory")
+	initCmd.Flags().StringVarP(&initOptions.ChatLogsDir, "chat-logs-dir", "", "data/chatlogs", "Directory of the chat logs")
+	initCmd.Flags().StringVarP(&initOptions.ServeHostPort, "serve-host-port", "", "127.0.0.1:8000", "Host and port the model is served on")
+	initCmd.Flags().StringVarP(&initOptions.EvaluateModel, "evaluate-model", "", "", "Trained model of the evaluate jobs")
+	initCmd.Flags().StringVarP(&initOptions.EvaluateBaseModel, "evaluate-base-model", "", "", "Base model the evaluate jobs compare the trained model to")
+	rootCmd.AddCommand(initCmd)
+}
+
+var initCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Write the ilab config of the worker",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if _, err := os.Stat(initConfig); err == nil && !initForce {
+			return fmt.Errorf("%s already exists, use --force to overwrite it", initConfig)
+		}
+		data, err := yaml.Marshal(newIlabConfig(initOptions))
+		if err != nil {
+			return err
+		}
+		if dir := filepath.Dir(initConfig); dir != "." {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return err
+			}
+		}
+		if err := os.WriteFile(initConfig, data, 0644); err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "Wrote %s\n", initConfig)
+		return nil
+	},
+}
+
+// newIlabConfig returns the ilab config of the options, with the defaults of ilab elsewhere
+func newIlabConfig(opts ilabInitOptions) IlabConfig {
+	var cfg IlabConfig
+	cfg.Chat.Context = "default"
+	cfg.Chat.LogsDir = opts.ChatLogsDir
+	cfg.Chat.Model = opts.ModelPath
+	cfg.Chat.VisibleOverflow = true
+	cfg.General.LogLevel = "INFO"
+	cfg.Generate.ChunkWordCount = 1000
+	cfg.Generate.Model = opts.ModelPath
+	cfg.Generate.NumCpus = 10
+	cfg.Generate.NumInstructions = 100
+	cfg.Generate.OutputDir = opts.OutputDir
+	cfg.Generate.PromptFile = "prompt.txt"
+	cfg.Generate.SeedFile = "seed_tasks.json"
+	cfg.Generate.TaxonomyBase = opts.TaxonomyBase
+	cfg.Generate.TaxonomyPath = opts.TaxonomyPath
+	cfg.Serve.GpuLayers = -1
+	cfg.Serve.HostPort = opts.ServeHostPort
+	cfg.Serve.MaxCtxSize = 4096
+	cfg.Serve.ModelPath = opts.ModelPath
+	cfg.Evaluate.Model = opts.EvaluateModel
+	cfg.Evaluate.BaseModel = opts.EvaluateBaseModel
+	return cfg
+}
+
+// readIlabConfig reads the ilab config of the worker
+func readIlabConfig() (IlabConfig, error) {
+	var cfg IlabConfig
+	cfgData, err := os.ReadFile(ilabConfigPath)
+	if err != nil {
+		return cfg, err
+	}
+	err = yaml.Unmarshal(cfgData, &cfg)
+	return cfg, err
+}
+
+// renderJobIlabConfig returns the ilab config of the worker with the paths of the job. The
+// settings the worker does not know about are kept as they are.
+func renderJobIlabConfig(base []byte, taxonomyDir, outputDir, chatlogDir string) ([]byte, error) {
+	var doc yaml.MapSlice
+	if err := yaml.Unmarshal(base, &doc); err != nil {
+		return nil, err
+	}
+	doc = setConfigValue(doc, []string{"generate", "taxonomy_path"}, taxonomyDir)
+	doc = setConfigValue(doc, []string{"generate", "output_dir"}, outputDir)
+	if chatlogDir != "" {
+		doc = setConfigValue(doc, []string{"chat", "logs_dir"}, chatlogDir)
+	}
+	return yaml.Marshal(doc)
+}
+
+// setConfigValue sets the value at the path of keys, adding the missing sections
+func setConfigValue(doc yaml.MapSlice, keys []string, value interface{}) yaml.MapSlice {
+	for i, item := range doc {
+		if item.Key != keys[0] {
+			continue
+		}
+		if len(keys) == 1 {
+			doc[i].Value = value
+		} else {
+			section, _ := item.Value.(yaml.MapSlice)
+			doc[i].Value = setConfigValue(section, keys[1:], value)
+		}
+		return doc
+	}
+	if len(keys) > 1 {
+		value = setConfigValue(nil, keys[1:], value)
+	}
+	return append(doc, yaml.MapItem{Key: keys[0], Value: value})
+}
+
+// prepareJobIlabConfig renders the ilab config of the job in its output directory, so the
+// jobs running side by side never share the taxonomy, output and chat log paths. Without an ilab config,
+// the ilab commands keep the defaults of ilab.
+func (w *Worker) prepareJobIlabConfig(outputDir string) error {
+	w.ilabConfigFile = ""
+	base, err := os.ReadFile(ilabConfigPath)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("could not read the ilab config: %w", err)
+	}
+	taxonomyDir, err := filepath.Abs(w.taxonomyDir)
+	if err != nil {
+		return err
+	}
+	outputDir, err = filepath.Abs(outputDir)
+	if err != nil {
+		return err
+	}
+	data, err := renderJobIlabConfig(base, taxonomyDir, outputDir, w.chatlogDir)
+	if err != nil {
+		return fmt.Errorf("invalid ilab %s: %w", ilabConfigPath, err)
+	}
+	path := filepath.Join(outputDir, jobIlabConfigFilename)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("could not write the ilab config of job %s: %w", w.job, err)
+	}
+	w.ilabConfigFile = path
+	return nil
+}
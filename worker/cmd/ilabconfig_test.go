@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v2"
+)
+
+// TestNewIlabConfig verify the generated config has the paths of the flags and reads back.
+func TestNewIlabConfig(t *testing.T) {
+	data, err := yaml.Marshal(newIlabConfig(ilabInitOptions{
+		ModelPath:     "models/granite.gguf",
+		TaxonomyPath:  "/work/taxonomy",
+		TaxonomyBase:  "origin/main",
+		OutputDir:     "/work/generated",
+		ChatLogsDir:   "/work/chatlogs",
+		ServeHostPort: "127.0.0.1:8001",
+	}))
+	require.NoError(t, err)
+	// The evaluate section is left out without evaluate models
+	assert.NotContains(t, string(data), "evaluate")
+
+	var cfg IlabConfig
+	require.NoError(t, yaml.Unmarshal(data, &cfg))
+	assert.Equal(t, "models/granite.gguf", cfg.Generate.Model)
+	assert.Equal(t, "models/granite.gguf", cfg.Serve.ModelPath)
+	assert.Equal(t, "/work/taxonomy", cfg.Generate.TaxonomyPath)
+	assert.Equal(t, "/work/generated", cfg.Generate.OutputDir)
+	assert.Equal(t, "/work/chatlogs", cfg.Chat.LogsDir)
+	assert.Equal(t, "127.0.0.1:8001", cfg.Serve.HostPort)
+}
+
+// TestInitCmd verify an existing ilab config is only overwritten with --force.
+func TestInitCmd(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("generate: {}\n"), 0644))
+	defer func() { initConfig, initForce = ilabConfigPath, false }()
+
+	initConfig, initForce = path, false
+	assert.Error(t, initCmd.RunE(initCmd, nil))
+
+	initForce = true
+	var out bytes.Buffer
+	initCmd.SetOut(&out)
+	require.NoError(t, initCmd.RunE(initCmd, nil))
+	assert.Contains(t, out.String(), path)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "taxonomy_path:")
+}
+
+// TestRenderJobIlabConfig verify the job paths replace the global ones and the other settings are kept.
+func TestRenderJobIlabConfig(t *testing.T) {
+	base := []byte(`chat:
+  model: models/merlinite.gguf
+generate:
+  model: models/merlinite.gguf
+  taxonomy_path: taxonomy
+  output_dir: generated
+custom:
+  key: value
+`)
+	data, err := renderJobIlabConfig(base, "/work/taxonomy-org", "/work/generate-pr-1-abc", "/work/data/chatlogs/job-1")
+	require.NoError(t, err)
+
+	var cfg IlabConfig
+	require.NoError(t, yaml.Unmarshal(data, &cfg))
+	assert.Equal(t, "/work/taxonomy-org", cfg.Generate.TaxonomyPath)
+	assert.Equal(t, "/work/generate-pr-1-abc", cfg.Generate.OutputDir)
+	assert.Equal(t, "models/merlinite.gguf", cfg.Generate.Model)
+	assert.Equal(t, "/work/data/chatlogs/job-1", cfg.Chat.LogsDir)
+	assert.Contains(t, string(data), "custom:\n  key: value\n")
+
+	// A config without a generate section gets one
+	data, err = renderJobIlabConfig([]byte("serve:\n  host_port: 127.0.0.1:8000\n"), "/t", "/o", "")
+	require.NoError(t, err)
+	assert.Equal(t, "serve:\n  host_port: 127.0.0.1:8000\ngenerate:\n  taxonomy_path: /t\n  output_dir: /o\n", string(data))
+
+	_, err = renderJobIlabConfig([]byte("generate: [\n"), "/t", "/o", "")
+	assert.Error(t, err)
+}
+
+// TestIlabArgsJobConfig verify the ilab commands read the config of the job when it has one.
+func TestIlabArgsJobConfig(t *testing.T) {
+	w := &Worker{ilabVersion: ilabVersion{Major: 0, Minor: 17}}
+	assert.Equal(t, []string{"data", "generate"}, w.ilabArgs(ilabGenerate))
+	w.ilabConfigFile = "/work/out/ilab_config.yaml"
+	assert.Equal(t, []string{"--config", "/work/out/ilab_config.yaml", "data", "generate", "--quiet"}, w.ilabArgs(ilabGenerate, "--quiet"))
+}
+
+// TestPrepareJobChatlogDir verify the chat logs of a job start empty and are removed after it.
+func TestPrepareJobChatlogDir(t *testing.T) {
+	workDir := t.TempDir()
+	w := &Worker{job: "42", logger: zap.NewNop().Sugar()}
+	stale := filepath.Join(workDir, "data", "chatlogs", "job-42", "chat_stale.yaml")
+	require.NoError(t, os.MkdirAll(filepath.Dir(stale), 0755))
+	require.NoError(t, os.WriteFile(stale, []byte("stale"), 0644))
+	other := filepath.Join(workDir, "data", "chatlogs", "job-43")
+	require.NoError(t, os.MkdirAll(other, 0755))
+
+	cleanup, err := w.prepareJobChatlogDir(workDir)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Dir(stale), w.chatlogDir)
+	assert.NoFileExists(t, stale)
+	assert.DirExists(t, w.chatlogDir)
+
+	cleanup()
+	assert.NoDirExists(t, w.chatlogDir)
+	// The chat logs of the other jobs are left alone
+	assert.DirExists(t, other)
+}
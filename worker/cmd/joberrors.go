@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// errorCategory tells the bot what kind of failure a job hit, so the PR comment can say whether
+// the contributor can fix it or it is an infrastructure problem
+type errorCategory string
+
+const (
+	errorInvalidYAML              errorCategory = "invalid-yaml"
+	errorMissingSeedExamples      errorCategory = "missing-seed-examples"
+	errorComplianceFailed         errorCategory = "compliance-failed"
+	errorPRTooLarge               errorCategory = "pr-too-large"
+	errorModelEndpointUnreachable errorCategory = "model-endpoint-unreachable"
+	errorGitFetchFailed           errorCategory = "git-fetch-failed"
+	errorTimeout                  errorCategory = "timeout"
+	errorOutOfDisk                errorCategory = "out-of-disk"
+	errorUnknown                  errorCategory = "unknown"
+)
+
+// jobError is an error tagged with its category where the cause is known
+type jobError struct {
+	category errorCategory
+	err      error
+}
+
+func (e *jobError) Error() string {
+	return e.err.Error()
+}
+
+func (e *jobError) Unwrap() error {
+	return e.err
+}
+
+// categorize tags err with category
+func categorize(category errorCategory, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &jobError{category: category, err: err}
+}
+
+// modelEndpointError tags the failure of a request to a model endpoint: a timeout, or a failure to
+// connect that means the endpoint is unreachable. Only the model calls tag their errors with it,
+// the failures of Redis, S3 or git don't tell anything about the model.
+func modelEndpointError(err error) error {
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, os.ErrDeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return categorize(errorTimeout, err)
+	}
+	var opErr *net.OpError
+	var dnsErr *net.DNSError
+	if errors.As(err, &opErr) || errors.As(err, &dnsErr) || errors.Is(err, syscall.ECONNREFUSED) {
+		return categorize(errorModelEndpointUnreachable, err)
+	}
+	return err
+}
+
+// errorCategoryOf returns the category err was tagged with, or else the one of its cause when
+// that is recognizable. Subprocess errors only carry their output, so their text is checked for a
+// full disk.
+func errorCategoryOf(err error) errorCategory {
+	var tagged *jobError
+	if errors.As(err, &tagged) {
+		return tagged.category
+	}
+
+	msg := strings.ToLower(err.Error())
+	if errors.Is(err, syscall.ENOSPC) || strings.Contains(msg, "no space left on device") {
+		return errorOutOfDisk
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return errorTimeout
+	}
+	return errorUnknown
+}
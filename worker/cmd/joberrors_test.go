@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestErrorCategoryOf verify tagged errors keep their category and common causes are recognized.
+func TestErrorCategoryOf(t *testing.T) {
+	tagged := categorize(errorInvalidYAML, fmt.Errorf("the taxonomy YAML could not be parsed"))
+	assert.Equal(t, errorInvalidYAML, errorCategoryOf(tagged))
+	assert.Equal(t, errorGitFetchFailed, errorCategoryOf(fmt.Errorf("job failed: %w", categorize(errorGitFetchFailed, fmt.Errorf("no remote")))))
+	assert.Nil(t, categorize(errorTimeout, nil))
+
+	assert.Equal(t, errorOutOfDisk, errorCategoryOf(fmt.Errorf("write: %w", syscall.ENOSPC)))
+	assert.Equal(t, errorOutOfDisk, errorCategoryOf(fmt.Errorf("Error running command. \nDetails: OSError: [Errno 28] No space left on device")))
+	assert.Equal(t, errorTimeout, errorCategoryOf(fmt.Errorf("request: %w", context.DeadlineExceeded)))
+	// Only the model calls tell an unreachable model endpoint, not the failures of Redis or S3
+	assert.Equal(t, errorUnknown, errorCategoryOf(&net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}))
+	assert.Equal(t, errorUnknown, errorCategoryOf(fmt.Errorf("dial tcp: lookup merlinite: no such host")))
+	assert.Equal(t, errorUnknown, errorCategoryOf(fmt.Errorf("redis: connection pool timeout")))
+	assert.Equal(t, errorUnknown, errorCategoryOf(fmt.Errorf("something else")))
+}
+
+// TestModelEndpointError verify the failures of the model calls are tagged through the wrapping.
+func TestModelEndpointError(t *testing.T) {
+	refused := fmt.Errorf("failed to execute chat request: %w", &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED})
+	assert.Equal(t, errorModelEndpointUnreachable, errorCategoryOf(fmt.Errorf("precheck: %w", &retryableError{err: modelEndpointError(refused)})))
+	assert.Equal(t, errorModelEndpointUnreachable, errorCategoryOf(modelEndpointError(&net.DNSError{Err: "no such host", Name: "merlinite", IsNotFound: true})))
+	assert.Equal(t, errorTimeout, errorCategoryOf(modelEndpointError(fmt.Errorf("failed to execute request: %w", context.DeadlineExceeded))))
+	assert.Equal(t, errorUnknown, errorCategoryOf(modelEndpointError(fmt.Errorf("unexpected status code 400"))))
+}
@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	// jobLogFilename is the structured log of a job, uploaded with its results
+	jobLogFilename = "worker_log.jsonl"
+
+	logFormatConsole = "console"
+	logFormatJSON    = "json"
+)
+
+// jobLog holds the JSON log entries of a job, in memory until the output directory of the job
+// exists and in the job log file after that
+type jobLog struct {
+	mu   sync.Mutex
+	buf  bytes.Buffer
+	file *os.File
+	// key is the S3 key the log was uploaded to with the job results
+	key string
+}
+
+func (l *jobLog) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file != nil {
+		return l.file.Write(p)
+	}
+	return l.buf.Write(p)
+}
+
+func (l *jobLog) Sync() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file != nil {
+		return l.file.Sync()
+	}
+	return nil
+}
+
+// open moves the log into the file at path, with the entries logged so far
+func (l *jobLog) open(path string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("could not create the job log: %w", err)
+	}
+	if _, err := l.buf.WriteTo(file); err != nil {
+		file.Close()
+		return fmt.Errorf("could not write the job log: %w", err)
+	}
+	l.file = file
+	return nil
+}
+
+func (l *jobLog) close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+// jsonEncoderConfig is the encoder of the JSON logs, with the field names log aggregators expect
+func jsonEncoderConfig() zapcore.EncoderConfig {
+	cfg := zap.NewProductionEncoderConfig()
+	cfg.EncodeTime = zapcore.ISO8601TimeEncoder
+	cfg.EncodeDuration = zapcore.MillisDurationEncoder
+	return cfg
+}
+
+// validateLogFormat checks the --log-format flag
+func validateLogFormat(format string) error {
+	switch format {
+	case logFormatConsole, logFormatJSON:
+		return nil
+	}
+	return fmt.Errorf("unknown log format %q, expected %s or %s", format, logFormatConsole, logFormatJSON)
+}
+
+// startJobLog tees every entry of the job logger, at debug level, into the job log. The log
+// is kept in memory until openJobLog is called.
+func (w *Worker) startJobLog() {
+	w.jobLog = &jobLog{}
+	core := redactingCore{Core: zapcore.NewCore(zapcore.NewJSONEncoder(jsonEncoderConfig()), zapcore.AddSync(w.jobLog), zapcore.DebugLevel)}
+	w.logger = w.logger.WithOptions(zap.WrapCore(func(c zapcore.Core) zapcore.Core {
+		return zapcore.NewTee(c, core)
+	}))
+}
+
+// closeJobLog closes the job log, and uploads it again when it was uploaded with the job
+// results, so the artifact also holds the entries logged after the upload. It is encrypted again
+// when the artifacts are.
+func (w *Worker) closeJobLog(outputDir string) {
+	if err := w.jobLog.close(); err != nil {
+		w.logger.Errorf("Could not close the job log: %v", err)
+	}
+	if w.jobLog.key == "" || w.svc == nil {
+		return
+	}
+	path, contentType := filepath.Join(outputDir, jobLogFilename), "text/plain"
+	if encryptedArtifact(jobLogFilename) {
+		encryptedPath, err := artifactEncryption.encryptFile(path)
+		if err != nil {
+			w.logger.Errorf("Could not encrypt the job log: %v", err)
+			return
+		}
+		path, contentType = encryptedPath, "application/octet-stream"
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		w.logger.Errorf("Could not open the job log: %v", err)
+		return
+	}
+	defer file.Close()
+	if _, err := w.svc.PutObject(w.ctx, putObjectInput(w.jobLog.key, file, contentType, w.s3Tags)); err != nil {
+		w.logger.Errorf("Could not upload the job log to S3: %v", err)
+	}
+}
+
+// logStep logs the duration of a step of the job, for the job log
+func (w *Worker) logStep(step string, start time.Time, err error) {
+	if err != nil {
+		w.logger.Infow("Job step failed", "step", step, "duration", time.Since(start), "error", err.Error())
+		return
+	}
+	w.logger.Infow("Job step done", "step", step, "duration", time.Since(start))
+}
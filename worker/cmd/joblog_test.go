@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// TestJobLog verify the job log keeps the entries logged before its file exists, at debug level, as JSON lines.
+func TestJobLog(t *testing.T) {
+	w := &Worker{job: "7", logger: zap.NewNop().Sugar()}
+	w.startJobLog()
+	w.logger.Debugw("Fetching job", "job_type", jobTrain)
+
+	dir := t.TempDir()
+	assert.NoError(t, w.jobLog.open(filepath.Join(dir, jobLogFilename)))
+	w.logStep("git", time.Now().Add(-2*time.Second), nil)
+	w.logStep("ilab model train", time.Now(), errors.New("exit status 1"))
+	w.closeJobLog(dir)
+
+	file, err := os.Open(filepath.Join(dir, jobLogFilename))
+	assert.NoError(t, err)
+	defer file.Close()
+	var entries []map[string]interface{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry map[string]interface{}
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &entry))
+		entries = append(entries, entry)
+	}
+	assert.Len(t, entries, 3)
+	assert.Equal(t, "debug", entries[0]["level"])
+	assert.Equal(t, jobTrain, entries[0]["job_type"])
+	assert.Equal(t, "git", entries[1]["step"])
+	assert.GreaterOrEqual(t, entries[1]["duration"], float64(2000))
+	assert.Equal(t, "Job step failed", entries[2]["msg"])
+	assert.Equal(t, "exit status 1", entries[2]["error"])
+}
+
+// TestValidateLogFormat verify only the console and json log formats are accepted.
+func TestValidateLogFormat(t *testing.T) {
+	assert.NoError(t, validateLogFormat(logFormatConsole))
+	assert.NoError(t, validateLogFormat(logFormatJSON))
+	assert.Error(t, validateLogFormat("logfmt"))
+	assert.NotNil(t, initLogger(false, logFormatJSON))
+}
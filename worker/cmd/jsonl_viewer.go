@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"html/template"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"go.uber.org/zap"
+)
+
+const (
+	// jsonlViewerChunkSize is the size of the range requests of the JSONL viewer
+	jsonlViewerChunkSize = 1 << 20
+	// jsonlFieldSampleLines are the first lines of a JSONL file read for the fields of its records
+	jsonlFieldSampleLines = 100
+	// maxJSONLLineSize bounds the lines read for the fields
+	maxJSONLLineSize = 16 << 20
+)
+
+var jsonlViewerTemplate = template.Must(template.ParseFS(defaultReportTemplates, "reports/jsonl_viewer.html"))
+
+// jsonlViewerData is the data of the JSONL viewer page
+type jsonlViewerData struct {
+	Name string
+	// DataURL is the public URL of the uploaded JSONL file, the viewer fetches it in chunks
+	DataURL   string
+	Fields    []string
+	ChunkSize int
+}
+
+// jsonlFields returns the sorted top level keys of the first records of a JSONL file. It fails
+// when the first record is not a JSON object.
+func jsonlFields(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), maxJSONLLineSize)
+	for records := 0; records < jsonlFieldSampleLines && scanner.Scan(); {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var record map[string]json.RawMessage
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			if records == 0 {
+				return nil, err
+			}
+			continue
+		}
+		records++
+		for key := range record {
+			seen[key] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	fields := make([]string, 0, len(seen))
+	for key := range seen {
+		fields = append(fields, key)
+	}
+	sort.Strings(fields)
+	return fields, nil
+}
+
+// generateJSONLViewer uploads a paginated viewer of a JSONL file, which does not embed the records
+// but fetches them from dataURL as they are read or searched. The file must be a JSON object per line.
+func generateJSONLViewer(ctx context.Context, outputDir, filename, s3Prefix, dataURL, s3Tags string, svc *s3.Client, logger *zap.SugaredLogger) string {
+	inputFile := filepath.Join(outputDir, filename)
+	s3Key := path.Join(s3Prefix, filepath.Base(outputDir), filename+jsonViewerFilenameSuffix)
+
+	fields, err := jsonlFields(inputFile)
+	if err != nil {
+		logger.Debugf("Skipping the viewer of %s, it is not JSON lines: %v", filename, err)
+		return ""
+	}
+
+	err = uploadStream(ctx, svc, s3Key, "text/html", s3Tags, func(w io.Writer) error {
+		return jsonlViewerTemplate.Execute(w, jsonlViewerData{
+			Name:      filename,
+			DataURL:   dataURL,
+			Fields:    fields,
+			ChunkSize: jsonlViewerChunkSize,
+		})
+	})
+	if err != nil {
+		logger.Errorf("Could not upload formatted HTML file to S3: %v", err)
+		return ""
+	}
+	return s3Key
+}
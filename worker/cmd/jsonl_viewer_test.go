@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestJSONLFields verify the fields of the records are collected and other files are refused.
+func TestJSONLFields(t *testing.T) {
+	dir := t.TempDir()
+	dataset := filepath.Join(dir, "train.jsonl")
+	assert.NoError(t, os.WriteFile(dataset, []byte("{\"user\": \"q1\", \"assistant\": \"a1\"}\n\n{\"user\": \"q2\", \"system\": \"s\"}\nnot json\n"), 0644))
+	fields, err := jsonlFields(dataset)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"assistant", "system", "user"}, fields)
+
+	array := filepath.Join(dir, "array.jsonl")
+	assert.NoError(t, os.WriteFile(array, []byte(`[{"user": "q1"}]`), 0644))
+	_, err = jsonlFields(array)
+	assert.Error(t, err)
+}
+
+// TestJSONLViewerTemplate verify the viewer fetches the data file rather than embedding it, with the values escaped.
+func TestJSONLViewerTemplate(t *testing.T) {
+	var out bytes.Buffer
+	assert.NoError(t, jsonlViewerTemplate.Execute(&out, jsonlViewerData{
+		Name:      "train.jsonl",
+		DataURL:   "https://bucket.s3.us-east-1.amazonaws.com/generate/train.jsonl",
+		Fields:    []string{"assistant", "<user>"},
+		ChunkSize: jsonlViewerChunkSize,
+	}))
+	html := out.String()
+	assert.Contains(t, html, `const dataURL = "https://bucket.s3.us-east-1.amazonaws.com/generate/train.jsonl";`)
+	assert.Contains(t, html, "const chunkSize =  1048576 ;")
+	assert.Contains(t, html, `<option value="&lt;user&gt;">&lt;user&gt;</option>`)
+}
@@ -0,0 +1,323 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	knowledgeDocsFilename = "knowledge_documents.json"
+	// knowledgeCloneTimeout bounds the clone of a knowledge document repo
+	knowledgeCloneTimeout = 5 * time.Minute
+	// knowledgeDocumentRef holds the commit of the documents when it is not the head of the repo
+	knowledgeDocumentRef = "refs/heads/knowledge-document"
+)
+
+// knowledgeDocument is the document reference section of a knowledge qna.yaml
+type knowledgeDocument struct {
+	Repo     string   `yaml:"repo"`
+	Commit   string   `yaml:"commit"`
+	Patterns []string `yaml:"patterns"`
+}
+
+// knowledgeDocSummary describes a single document matched by the knowledge patterns
+type knowledgeDocSummary struct {
+	Path   string `json:"path"`
+	Format string `json:"format"`
+	Bytes  int64  `json:"bytes"`
+	Words  int    `json:"words"`
+}
+
+// knowledgeDocReport is the verification result for one knowledge taxonomy file
+type knowledgeDocReport struct {
+	TaxonomyFile      string                `json:"taxonomy_file"`
+	Repo              string                `json:"repo"`
+	Commit            string                `json:"commit"`
+	Patterns          []string              `json:"patterns"`
+	UnmatchedPatterns []string              `json:"unmatched_patterns,omitempty"`
+	Documents         []knowledgeDocSummary `json:"documents"`
+	TotalWords        int                   `json:"total_words"`
+	Errors            []string              `json:"errors,omitempty"`
+}
+
+// checkKnowledgeDocuments clones the documents referenced by each knowledge file at the pinned
+// commit, verifies the patterns and size limits and writes a summary into the output directory.
+// An error is returned if any of the references are broken.
+func (w *Worker) checkKnowledgeDocuments(knowledgeFiles []string, outputDir string) error {
+	if len(knowledgeFiles) == 0 {
+		return nil
+	}
+
+	cloneDirs := make(map[string]string)
+	defer func() {
+		for _, dir := range cloneDirs {
+			_ = os.RemoveAll(dir)
+		}
+	}()
+
+	var reports []knowledgeDocReport
+	var problems []string
+	for _, file := range knowledgeFiles {
+		report := knowledgeDocReport{TaxonomyFile: file}
+
+		content, err := os.ReadFile(filepath.Join(w.taxonomyDir, file))
+		if err != nil {
+			return fmt.Errorf("could not read knowledge file %s: %w", file, err)
+		}
+		var qna struct {
+			Document knowledgeDocument `yaml:"document"`
+		}
+		if err := yaml.Unmarshal(content, &qna); err != nil {
+			return fmt.Errorf("could not parse knowledge file %s: %w", file, err)
+		}
+		doc := qna.Document
+		report.Repo, report.Commit, report.Patterns = doc.Repo, doc.Commit, doc.Patterns
+
+		switch {
+		case doc.Repo == "":
+			report.Errors = append(report.Errors, "document.repo is missing")
+		case doc.Commit == "":
+			report.Errors = append(report.Errors, "document.commit is missing")
+		case len(doc.Patterns) == 0:
+			report.Errors = append(report.Errors, "document.patterns is missing")
+		}
+
+		if len(report.Errors) == 0 {
+			cacheKey := doc.Repo + "@" + doc.Commit
+			cloneDir, ok := cloneDirs[cacheKey]
+			if !ok {
+				w.logger.Infof("Fetching knowledge document repo %s at %s", doc.Repo, doc.Commit)
+				cloneDir, err = cloneDocumentRepo(w.ctx, doc.Repo, doc.Commit)
+				if err != nil {
+					report.Errors = append(report.Errors, err.Error())
+				} else {
+					cloneDirs[cacheKey] = cloneDir
+				}
+			}
+			if cloneDir != "" {
+				verifyKnowledgeDocuments(cloneDir, &report)
+			}
+		}
+
+		for _, e := range report.Errors {
+			problems = append(problems, fmt.Sprintf("%s: %s", file, e))
+		}
+		reports = append(reports, report)
+	}
+
+	reportJSON, err := json.MarshalIndent(reports, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not marshal knowledge document summary: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(outputDir, knowledgeDocsFilename), reportJSON, 0644); err != nil {
+		return fmt.Errorf("could not write knowledge document summary: %w", err)
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("knowledge document verification failed:\n%s", strings.Join(problems, "\n"))
+	}
+	return nil
+}
+
+// cloneDocumentRepo clones a knowledge document repository into a temporary directory and
+// checks out the requested commit. The URL comes from the contribution, only https repos are
+// cloned, shallowly and within knowledgeCloneTimeout. A commit other than the head of the default
+// branch is fetched alone, which needs its full hash.
+func cloneDocumentRepo(ctx context.Context, repoURL, commit string) (string, error) {
+	if u, err := url.Parse(repoURL); err != nil || u.Scheme != "https" || u.Host == "" {
+		return "", fmt.Errorf("document repo %s is not an https URL", repoURL)
+	}
+	ctx, cancel := context.WithTimeout(ctx, knowledgeCloneTimeout)
+	defer cancel()
+
+	dir, err := os.MkdirTemp("", "knowledge-doc-*")
+	if err != nil {
+		return "", fmt.Errorf("could not create temp dir for %s: %v", repoURL, err)
+	}
+
+	r, err := git.PlainCloneContext(ctx, dir, false, &git.CloneOptions{URL: repoURL, Depth: 1, SingleBranch: true})
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return "", fmt.Errorf("could not clone document repo %s: %v", repoURL, err)
+	}
+
+	hash, err := r.ResolveRevision(plumbing.Revision(commit))
+	if err != nil && plumbing.IsHash(commit) {
+		err = r.FetchContext(ctx, &git.FetchOptions{
+			RefSpecs: []config.RefSpec{config.RefSpec(commit + ":" + knowledgeDocumentRef)},
+			Depth:    1,
+		})
+		if err == nil || errors.Is(err, git.NoErrAlreadyUpToDate) {
+			hash, err = r.ResolveRevision(plumbing.Revision(commit))
+		}
+	}
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return "", fmt.Errorf("commit %s not found in document repo %s: %v", commit, repoURL, err)
+	}
+
+	wt, err := r.Worktree()
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return "", fmt.Errorf("could not get worktree for %s: %v", repoURL, err)
+	}
+	if err := wt.Checkout(&git.CheckoutOptions{Hash: *hash}); err != nil {
+		_ = os.RemoveAll(dir)
+		return "", fmt.Errorf("could not checkout %s in document repo %s: %v", commit, repoURL, err)
+	}
+	return dir, nil
+}
+
+// verifyKnowledgeDocuments matches the report patterns against the files in the cloned
+// repository and records a summary of every matched document
+func verifyKnowledgeDocuments(cloneDir string, report *knowledgeDocReport) {
+	var files []string
+	_ = filepath.WalkDir(cloneDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(cloneDir, p)
+		if err == nil {
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+
+	matched := make(map[string]bool)
+	for _, pattern := range report.Patterns {
+		re, err := globToRegexp(strings.TrimSpace(pattern))
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("invalid pattern %q: %v", pattern, err))
+			continue
+		}
+		found := false
+		for _, f := range files {
+			if re.MatchString(f) {
+				found = true
+				matched[f] = true
+			}
+		}
+		if !found {
+			report.UnmatchedPatterns = append(report.UnmatchedPatterns, pattern)
+			report.Errors = append(report.Errors, fmt.Sprintf("pattern %q does not match any file in %s@%s", pattern, report.Repo, report.Commit))
+		}
+	}
+
+	for _, f := range files {
+		if !matched[f] {
+			continue
+		}
+		summary, err := summarizeDocument(filepath.Join(cloneDir, f))
+		if err != nil {
+			report.Errors = append(report.Errors, err.Error())
+			continue
+		}
+		summary.Path = f
+		if KnowledgeMaxDocBytes > 0 && summary.Bytes > KnowledgeMaxDocBytes {
+			report.Errors = append(report.Errors, fmt.Sprintf("document %s is %d bytes, over the %d byte limit", f, summary.Bytes, KnowledgeMaxDocBytes))
+		}
+		report.Documents = append(report.Documents, summary)
+		report.TotalWords += summary.Words
+	}
+}
+
+// summarizeDocument detects the document format and counts the words of text documents. Symlinks
+// are rejected since they could point anywhere on the worker, and documents over the size limit
+// are not read.
+func summarizeDocument(docPath string) (knowledgeDocSummary, error) {
+	info, err := os.Lstat(docPath)
+	if err != nil {
+		return knowledgeDocSummary{}, fmt.Errorf("could not stat document %s: %v", docPath, err)
+	}
+	if !info.Mode().IsRegular() {
+		return knowledgeDocSummary{}, fmt.Errorf("document %s is not a regular file", docPath)
+	}
+	summary := knowledgeDocSummary{
+		Format: detectDocumentFormat(docPath),
+		Bytes:  info.Size(),
+	}
+	if KnowledgeMaxDocBytes > 0 && summary.Bytes > KnowledgeMaxDocBytes {
+		return summary, nil
+	}
+
+	switch summary.Format {
+	case "markdown", "text", "restructuredtext", "asciidoc":
+		file, err := os.Open(docPath)
+		if err != nil {
+			return knowledgeDocSummary{}, fmt.Errorf("could not read document %s: %v", docPath, err)
+		}
+		defer file.Close()
+		content, err := io.ReadAll(io.LimitReader(file, summary.Bytes))
+		if err != nil {
+			return knowledgeDocSummary{}, fmt.Errorf("could not read document %s: %v", docPath, err)
+		}
+		summary.Words = len(strings.Fields(string(content)))
+	}
+	return summary, nil
+}
+
+// detectDocumentFormat maps a document file extension to a format name
+func detectDocumentFormat(docPath string) string {
+	switch strings.ToLower(filepath.Ext(docPath)) {
+	case ".md", ".markdown":
+		return "markdown"
+	case ".txt":
+		return "text"
+	case ".rst":
+		return "restructuredtext"
+	case ".adoc":
+		return "asciidoc"
+	case ".pdf":
+		return "pdf"
+	case ".html", ".htm":
+		return "html"
+	default:
+		return "unknown"
+	}
+}
+
+// globToRegexp converts a glob pattern supporting `*`, `?` and `**` into an anchored regexp
+func globToRegexp(pattern string) (*regexp.Regexp, error) {
+	var sb strings.Builder
+	sb.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case c == '*' && strings.HasPrefix(pattern[i:], "**/"):
+			sb.WriteString("(.*/)?")
+			i += 2
+		case c == '*' && strings.HasPrefix(pattern[i:], "**"):
+			sb.WriteString(".*")
+			i++
+		case c == '*':
+			sb.WriteString("[^/]*")
+		case c == '?':
+			sb.WriteString("[^/]")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	sb.WriteString("$")
+	return regexp.Compile(sb.String())
+}
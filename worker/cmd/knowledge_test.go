@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestGlobToRegexp verify knowledge document patterns match like ilab globs.
+func TestGlobToRegexp(t *testing.T) {
+	tests := []struct {
+		pattern string
+		file    string
+		match   bool
+	}{
+		{"*.md", "README.md", true},
+		{"*.md", "docs/guide.md", false},
+		{"docs/*.md", "docs/guide.md", true},
+		{"**/*.md", "guide.md", true},
+		{"**/*.md", "docs/nested/guide.md", true},
+		{"docs/**", "docs/nested/guide.md", true},
+		{"chapter?.txt", "chapter1.txt", true},
+		{"chapter?.txt", "chapter10.txt", false},
+		{"file.(1).md", "file.(1).md", true},
+	}
+	for _, tt := range tests {
+		re, err := globToRegexp(tt.pattern)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.match, re.MatchString(tt.file), "pattern %q against %q", tt.pattern, tt.file)
+	}
+}
+
+// TestVerifyKnowledgeDocuments verify unmatched patterns and oversized documents are reported.
+func TestVerifyKnowledgeDocuments(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.MkdirAll(path.Join(dir, "docs"), 0755))
+	assert.NoError(t, os.WriteFile(path.Join(dir, "docs", "history.md"), []byte("# History\n\nSome words here."), 0644))
+	assert.NoError(t, os.WriteFile(path.Join(dir, "docs", "manual.pdf"), make([]byte, 64), 0644))
+
+	report := knowledgeDocReport{
+		Repo:     "https://github.com/example/docs",
+		Commit:   "abc123",
+		Patterns: []string{"docs/*.md", "*.pdf"},
+	}
+	verifyKnowledgeDocuments(dir, &report)
+
+	assert.Equal(t, []string{"*.pdf"}, report.UnmatchedPatterns)
+	if assert.Len(t, report.Documents, 1) {
+		assert.Equal(t, "docs/history.md", report.Documents[0].Path)
+		assert.Equal(t, "markdown", report.Documents[0].Format)
+		assert.Equal(t, 5, report.Documents[0].Words)
+	}
+	assert.Len(t, report.Errors, 1)
+
+	saved := KnowledgeMaxDocBytes
+	KnowledgeMaxDocBytes = 10
+	defer func() { KnowledgeMaxDocBytes = saved }()
+
+	report = knowledgeDocReport{Patterns: []string{"docs/**"}}
+	verifyKnowledgeDocuments(dir, &report)
+	assert.Len(t, report.Documents, 2)
+	assert.Len(t, report.Errors, 2, "both documents are over the size limit")
+}
+
+// TestVerifyKnowledgeDocumentsSymlink verify a document linking outside the clone is never read.
+func TestVerifyKnowledgeDocumentsSymlink(t *testing.T) {
+	dir := t.TempDir()
+	secret := path.Join(t.TempDir(), "secret.md")
+	assert.NoError(t, os.WriteFile(secret, []byte("worker secret"), 0600))
+	assert.NoError(t, os.Symlink(secret, path.Join(dir, "leak.md")))
+	assert.NoError(t, os.Symlink("/dev/zero", path.Join(dir, "zero.md")))
+
+	report := knowledgeDocReport{Patterns: []string{"*.md"}}
+	verifyKnowledgeDocuments(dir, &report)
+	assert.Empty(t, report.Documents)
+	if assert.Len(t, report.Errors, 2) {
+		assert.Contains(t, report.Errors[0], "is not a regular file")
+		assert.Contains(t, report.Errors[1], "is not a regular file")
+	}
+}
+
+// TestCloneDocumentRepoScheme verify only https document repos are cloned, not the disk of the worker.
+func TestCloneDocumentRepoScheme(t *testing.T) {
+	for _, repoURL := range []string{"file:///etc", "/srv/taxonomy", "http://example.com/docs.git", "ssh://git@example.com/docs.git", "https://"} {
+		_, err := cloneDocumentRepo(context.Background(), repoURL, "main")
+		assert.ErrorContains(t, err, "is not an https URL", repoURL)
+	}
+}
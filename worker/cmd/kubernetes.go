@@ -0,0 +1,294 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// kubernetesJobTTL keeps finished Jobs around for debugging before Kubernetes deletes them
+	kubernetesJobTTL = 24 * time.Hour
+	// workVolume is the volume of the Job pods mounting the work directory shared with the worker
+	workVolume = "work"
+)
+
+// kubernetesPollInterval is how often the status of a Kubernetes Job is checked
+var kubernetesPollInterval = 10 * time.Second
+
+// kubernetesConfig runs the ilab commands of a job type as Kubernetes Jobs. The pods mount the
+// work directory of the worker from a PersistentVolumeClaim, so the worker collects their output
+// like the one of local commands.
+type kubernetesConfig struct {
+	// Kubectl is the kubectl binary, defaults to kubectl on the PATH
+	Kubectl   string `yaml:"kubectl"`
+	Namespace string `yaml:"namespace"`
+	Image     string `yaml:"image"`
+	// WorkClaim is the PersistentVolumeClaim holding the work directory of the worker
+	WorkClaim      string            `yaml:"work_claim"`
+	ServiceAccount string            `yaml:"service_account"`
+	Requests       map[string]string `yaml:"requests"`
+	Limits         map[string]string `yaml:"limits"`
+	// GPUs is the number of nvidia.com/gpu the pods request
+	GPUs         int               `yaml:"gpus"`
+	NodeSelector map[string]string `yaml:"node_selector"`
+	// ActiveDeadlineSeconds bounds the run time of the Jobs, 0 is unbounded
+	ActiveDeadlineSeconds int64 `yaml:"active_deadline_seconds"`
+}
+
+// ilabKubernetes are keyed by job type, the default config applies to the job types without one
+var ilabKubernetes map[string]kubernetesConfig
+
+// validateKubernetes checks the Kubernetes configs are keyed by job type and name an image and a claim
+func validateKubernetes(configs map[string]kubernetesConfig) error {
+	for key, cfg := range configs {
+		switch key {
+		case defaultEnvPolicy, jobGenerateLocal, jobPreCheck, jobSDG, jobTrain, jobEvaluate:
+		default:
+			return fmt.Errorf("unknown job type %q in ilab_kubernetes", key)
+		}
+		if cfg.Image == "" {
+			return fmt.Errorf("ilab_kubernetes %s has no image", key)
+		}
+		if cfg.WorkClaim == "" {
+			return fmt.Errorf("ilab_kubernetes %s has no work_claim", key)
+		}
+	}
+	return nil
+}
+
+// kubernetesJobFailed is a Kubernetes Job whose pod ran and failed
+type kubernetesJobFailed struct {
+	name string
+}
+
+func (e *kubernetesJobFailed) Error() string {
+	return fmt.Sprintf("kubernetes job %s failed", e.name)
+}
+
+// kubernetesExecutor runs every ilab command as a Kubernetes Job, the worker only creates the
+// Job, waits for it and collects its logs
+type kubernetesExecutor struct {
+	cfg kubernetesConfig
+}
+
+func (e kubernetesExecutor) kubectl(ctx context.Context, args ...string) *exec.Cmd {
+	kubectl := e.cfg.Kubectl
+	if kubectl == "" {
+		kubectl = "kubectl"
+	}
+	if e.cfg.Namespace != "" {
+		args = append([]string{"--namespace", e.cfg.Namespace}, args...)
+	}
+	return exec.CommandContext(ctx, kubectl, args...)
+}
+
+// manifest returns the Job running the ilab command args in dir, with the work directory mounted
+// at workDir. The environment of the container comes from the Secret of the same name, so the
+// credentials it holds are not stored in the Job spec.
+func (e kubernetesExecutor) manifest(name, job, workDir, dir string, args []string) map[string]interface{} {
+	limits := make(map[string]string)
+	for resource, quantity := range e.cfg.Limits {
+		limits[resource] = quantity
+	}
+	if e.cfg.GPUs > 0 {
+		limits["nvidia.com/gpu"] = strconv.Itoa(e.cfg.GPUs)
+	}
+
+	podSpec := map[string]interface{}{
+		"restartPolicy": "Never",
+		"containers": []map[string]interface{}{{
+			"name":       "ilab",
+			"image":      e.cfg.Image,
+			"command":    []string{"ilab"},
+			"args":       args,
+			"workingDir": dir,
+			"envFrom":    []map[string]interface{}{{"secretRef": map[string]string{"name": name}}},
+			"resources": map[string]interface{}{
+				"requests": e.cfg.Requests,
+				"limits":   limits,
+			},
+			"volumeMounts": []map[string]string{{"name": workVolume, "mountPath": workDir}},
+		}},
+		"volumes": []map[string]interface{}{{
+			"name":                  workVolume,
+			"persistentVolumeClaim": map[string]string{"claimName": e.cfg.WorkClaim},
+		}},
+	}
+	if e.cfg.ServiceAccount != "" {
+		podSpec["serviceAccountName"] = e.cfg.ServiceAccount
+	}
+	if len(e.cfg.NodeSelector) > 0 {
+		podSpec["nodeSelector"] = e.cfg.NodeSelector
+	}
+
+	jobSpec := map[string]interface{}{
+		"backoffLimit":            0,
+		"ttlSecondsAfterFinished": int(kubernetesJobTTL.Seconds()),
+		"template":                map[string]interface{}{"spec": podSpec},
+	}
+	if e.cfg.ActiveDeadlineSeconds > 0 {
+		jobSpec["activeDeadlineSeconds"] = e.cfg.ActiveDeadlineSeconds
+	}
+	return map[string]interface{}{
+		"apiVersion": "batch/v1",
+		"kind":       "Job",
+		"metadata": map[string]interface{}{
+			"name":   name,
+			"labels": kubernetesLabels(job),
+		},
+		"spec": jobSpec,
+	}
+}
+
+// secretManifest returns the Secret holding the environment of the Job name. It is owned by the
+// Job, so Kubernetes deletes it with the Job.
+func (e kubernetesExecutor) secretManifest(name, job, jobUID string, env []string) map[string]interface{} {
+	data := make(map[string]string)
+	for _, kv := range env {
+		envName, value, _ := strings.Cut(kv, "=")
+		// The image sets its own paths, and the pod is isolated from the worker HOME anyway
+		if matchesEnv(containerEnvSkipped, envName) || matchesEnv(jobHomeEnv, envName) {
+			continue
+		}
+		data[envName] = value
+	}
+	return map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"type":       "Opaque",
+		"metadata": map[string]interface{}{
+			"name":   name,
+			"labels": kubernetesLabels(job),
+			"ownerReferences": []map[string]string{{
+				"apiVersion": "batch/v1",
+				"kind":       "Job",
+				"name":       name,
+				"uid":        jobUID,
+			}},
+		},
+		"stringData": data,
+	}
+}
+
+func kubernetesLabels(job string) map[string]string {
+	return map[string]string{
+		"app.kubernetes.io/managed-by": "instructlab-bot-worker",
+		"instructlab-bot/job":          job,
+	}
+}
+
+func (e kubernetesExecutor) run(c *ilabCommand) error {
+	w := c.w
+	workDir := WorkDir
+	if workDir == "" {
+		workDir, _ = os.Getwd()
+	}
+	workDir, _ = filepath.Abs(workDir)
+	dir := c.dir
+	if dir == "" {
+		dir = workDir
+	}
+
+	name := fmt.Sprintf("ilab-job-%s-%s", w.job, strconv.FormatInt(time.Now().UnixNano(), 36))
+	manifest, err := json.Marshal(e.manifest(name, w.job, workDir, dir, c.args))
+	if err != nil {
+		return fmt.Errorf("could not create the manifest of kubernetes job %s: %w", name, err)
+	}
+	// The pod waits for its Secret, created once the Job has the UID the Secret is owned by
+	var stderr bytes.Buffer
+	create := e.kubectl(w.ctx, "create", "--filename", "-", "--output", "jsonpath={.metadata.uid}")
+	create.Stdin = bytes.NewReader(manifest)
+	create.Stderr = &stderr
+	uid, err := create.Output()
+	if err != nil {
+		return fmt.Errorf("could not create kubernetes job %s: %v: %s", name, err, strings.TrimSpace(stderr.String()))
+	}
+	w.logger.Infof("Created kubernetes job %s", name)
+
+	secret, err := json.Marshal(e.secretManifest(name, w.job, strings.TrimSpace(string(uid)), w.subprocessEnv()))
+	if err != nil {
+		e.deleteJob(w, name)
+		return fmt.Errorf("could not create the secret of kubernetes job %s: %w", name, err)
+	}
+	createSecret := e.kubectl(w.ctx, "create", "--filename", "-")
+	createSecret.Stdin = bytes.NewReader(secret)
+	if output, err := createSecret.CombinedOutput(); err != nil {
+		e.deleteJob(w, name)
+		return fmt.Errorf("could not create the secret of kubernetes job %s: %v: %s", name, err, strings.TrimSpace(string(output)))
+	}
+
+	succeeded, err := e.wait(w.ctx, name)
+
+	// The pod read its environment when it started, the credentials are not kept for the TTL of the Job
+	deleteSecret := e.kubectl(context.Background(), "delete", "secret", name, "--ignore-not-found", "--wait=false")
+	if output, deleteErr := deleteSecret.CombinedOutput(); deleteErr != nil {
+		w.logger.Errorf("Could not delete the secret of kubernetes job %s: %v: %s", name, deleteErr, strings.TrimSpace(string(output)))
+	}
+
+	// The logs are collected even when the job was cancelled, to see how far it went
+	logs := e.kubectl(context.Background(), "logs", "job/"+name, "--all-containers")
+	logs.Stdout = c.Stdout
+	logs.Stderr = c.Stderr
+	if logsErr := logs.Run(); logsErr != nil {
+		w.logger.Errorf("Could not collect the logs of kubernetes job %s: %v", name, logsErr)
+	}
+
+	if err != nil {
+		e.deleteJob(w, name)
+		return err
+	}
+	if !succeeded {
+		return &kubernetesJobFailed{name: name}
+	}
+	return nil
+}
+
+// deleteJob deletes the Job name, its pod and its Secret
+func (e kubernetesExecutor) deleteJob(w *Worker, name string) {
+	deleteJob := e.kubectl(context.Background(), "delete", "job", name, "--cascade=foreground", "--wait=false")
+	if output, err := deleteJob.CombinedOutput(); err != nil {
+		w.logger.Errorf("Could not delete kubernetes job %s: %v: %s", name, err, strings.TrimSpace(string(output)))
+	}
+}
+
+// wait polls the Job until it succeeded or failed
+func (e kubernetesExecutor) wait(ctx context.Context, name string) (bool, error) {
+	ticker := time.NewTicker(kubernetesPollInterval)
+	defer ticker.Stop()
+	for {
+		output, err := e.kubectl(ctx, "get", "job", name, "--output", "jsonpath={.status.succeeded}/{.status.failed}").Output()
+		if err != nil {
+			if ctx.Err() != nil {
+				return false, ctx.Err()
+			}
+			return false, fmt.Errorf("could not get the status of kubernetes job %s: %w", name, err)
+		}
+		if succeeded, failed := parseJobStatus(string(output)); succeeded || failed {
+			return succeeded, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// parseJobStatus reads the succeeded/failed pod counts of a Job, the counts are empty until a pod finished
+func parseJobStatus(status string) (succeeded, failed bool) {
+	succeededPods, failedPods, _ := strings.Cut(strings.TrimSpace(status), "/")
+	return succeededPods != "" && succeededPods != "0", failedPods != "" && failedPods != "0"
+}
+
+func (e kubernetesExecutor) describe(c *ilabCommand) string {
+	return fmt.Sprintf("kubernetes job (image %s): ilab %s", e.cfg.Image, strings.Join(c.args, " "))
+}
@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestKubernetesManifest verify the Job runs ilab once in the work directory with the resources and environment of the job.
+func TestKubernetesManifest(t *testing.T) {
+	e := kubernetesExecutor{cfg: kubernetesConfig{
+		Image:                 "ilab:gpu",
+		WorkClaim:             "worker-work",
+		ServiceAccount:        "ilab",
+		Requests:              map[string]string{"memory": "32Gi"},
+		GPUs:                  2,
+		NodeSelector:          map[string]string{"gpu": "a100"},
+		ActiveDeadlineSeconds: 3600,
+	}}
+	content, err := json.Marshal(e.manifest("ilab-job-7-abc", "7", "/work", "/work/taxonomy", []string{"train", "--num-epochs", "1"}))
+	assert.NoError(t, err)
+
+	var job struct {
+		Metadata struct {
+			Name   string            `json:"name"`
+			Labels map[string]string `json:"labels"`
+		} `json:"metadata"`
+		Spec struct {
+			BackoffLimit          int   `json:"backoffLimit"`
+			ActiveDeadlineSeconds int64 `json:"activeDeadlineSeconds"`
+			Template              struct {
+				Spec struct {
+					RestartPolicy      string            `json:"restartPolicy"`
+					ServiceAccountName string            `json:"serviceAccountName"`
+					NodeSelector       map[string]string `json:"nodeSelector"`
+					Containers         []struct {
+						Image      string              `json:"image"`
+						Command    []string            `json:"command"`
+						Args       []string            `json:"args"`
+						WorkingDir string              `json:"workingDir"`
+						Env        []map[string]string `json:"env"`
+						EnvFrom    []struct {
+							SecretRef map[string]string `json:"secretRef"`
+						} `json:"envFrom"`
+						Resources struct {
+							Requests map[string]string `json:"requests"`
+							Limits   map[string]string `json:"limits"`
+						} `json:"resources"`
+						VolumeMounts []map[string]string `json:"volumeMounts"`
+					} `json:"containers"`
+					Volumes []struct {
+						PersistentVolumeClaim map[string]string `json:"persistentVolumeClaim"`
+					} `json:"volumes"`
+				} `json:"spec"`
+			} `json:"template"`
+		} `json:"spec"`
+	}
+	assert.NoError(t, json.Unmarshal(content, &job))
+	assert.Equal(t, "ilab-job-7-abc", job.Metadata.Name)
+	assert.Equal(t, "7", job.Metadata.Labels["instructlab-bot/job"])
+	assert.Equal(t, 0, job.Spec.BackoffLimit)
+	assert.Equal(t, int64(3600), job.Spec.ActiveDeadlineSeconds)
+
+	pod := job.Spec.Template.Spec
+	assert.Equal(t, "Never", pod.RestartPolicy)
+	assert.Equal(t, "ilab", pod.ServiceAccountName)
+	assert.Equal(t, map[string]string{"gpu": "a100"}, pod.NodeSelector)
+	assert.Len(t, pod.Containers, 1)
+	container := pod.Containers[0]
+	assert.Equal(t, "ilab:gpu", container.Image)
+	assert.Equal(t, []string{"ilab"}, container.Command)
+	assert.Equal(t, []string{"train", "--num-epochs", "1"}, container.Args)
+	assert.Equal(t, "/work/taxonomy", container.WorkingDir)
+	assert.Empty(t, container.Env, "the environment is in the secret of the job")
+	if assert.Len(t, container.EnvFrom, 1) {
+		assert.Equal(t, "ilab-job-7-abc", container.EnvFrom[0].SecretRef["name"])
+	}
+	assert.Equal(t, map[string]string{"memory": "32Gi"}, container.Resources.Requests)
+	assert.Equal(t, map[string]string{"nvidia.com/gpu": "2"}, container.Resources.Limits)
+	assert.Equal(t, []map[string]string{{"name": workVolume, "mountPath": "/work"}}, container.VolumeMounts)
+	assert.Equal(t, "worker-work", pod.Volumes[0].PersistentVolumeClaim["claimName"])
+}
+
+// TestKubernetesSecretManifest verify the environment of the job is in a Secret owned by its Job.
+func TestKubernetesSecretManifest(t *testing.T) {
+	e := kubernetesExecutor{cfg: kubernetesConfig{Image: "ilab:gpu", WorkClaim: "worker-work"}}
+	env := []string{"PATH=/usr/bin", "HOME=/tmp/job/home", "HF_TOKEN=hf"}
+	content, err := json.Marshal(e.secretManifest("ilab-job-7-abc", "7", "0f4d", env))
+	assert.NoError(t, err)
+
+	var secret struct {
+		Kind     string `json:"kind"`
+		Metadata struct {
+			Name            string              `json:"name"`
+			Labels          map[string]string   `json:"labels"`
+			OwnerReferences []map[string]string `json:"ownerReferences"`
+		} `json:"metadata"`
+		StringData map[string]string `json:"stringData"`
+	}
+	assert.NoError(t, json.Unmarshal(content, &secret))
+	assert.Equal(t, "Secret", secret.Kind)
+	assert.Equal(t, "ilab-job-7-abc", secret.Metadata.Name)
+	assert.Equal(t, "7", secret.Metadata.Labels["instructlab-bot/job"])
+	assert.Equal(t, []map[string]string{{"apiVersion": "batch/v1", "kind": "Job", "name": "ilab-job-7-abc", "uid": "0f4d"}}, secret.Metadata.OwnerReferences)
+	assert.Equal(t, map[string]string{"HF_TOKEN": "hf"}, secret.StringData)
+}
+
+// TestParseJobStatus verify a Job is only done once a pod succeeded or failed.
+func TestParseJobStatus(t *testing.T) {
+	for status, expected := range map[string][2]bool{
+		"/":    {false, false},
+		"1/":   {true, false},
+		"/1\n": {false, true},
+		"0/0":  {false, false},
+	} {
+		succeeded, failed := parseJobStatus(status)
+		assert.Equal(t, expected, [2]bool{succeeded, failed}, status)
+	}
+}
+
+// TestValidateKubernetes verify the Kubernetes configs are keyed by job type and name an image and a claim.
+func TestValidateKubernetes(t *testing.T) {
+	assert.NoError(t, validateKubernetes(map[string]kubernetesConfig{jobTrain: {Image: "ilab", WorkClaim: "work"}}))
+	assert.Error(t, validateKubernetes(map[string]kubernetesConfig{jobTrain: {Image: "ilab"}}))
+	assert.Error(t, validateKubernetes(map[string]kubernetesConfig{jobTrain: {WorkClaim: "work"}}))
+	assert.Error(t, validateKubernetes(map[string]kubernetesConfig{"unknown": {Image: "ilab", WorkClaim: "work"}}))
+}
@@ -0,0 +1,147 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+const (
+	// minLanguageWords is the number of stop words a Latin script text needs for its language to
+	// be told, shorter texts are not detected
+	minLanguageWords = 2
+	// minScriptShare is the share of the letters of a text a script other than Latin needs for
+	// the text to be in it, code and names in Latin script are common in other languages
+	minScriptShare = 0.3
+)
+
+// languageScripts tell the languages, or the families of languages, written in their own script
+var languageScripts = []struct {
+	Name   string
+	Script *unicode.RangeTable
+}{
+	{"Japanese", unicode.Hiragana},
+	{"Japanese", unicode.Katakana},
+	{"Korean", unicode.Hangul},
+	{"Chinese", unicode.Han},
+	{"Cyrillic script", unicode.Cyrillic},
+	{"Arabic script", unicode.Arabic},
+	{"Hebrew", unicode.Hebrew},
+	{"Devanagari script", unicode.Devanagari},
+	{"Greek", unicode.Greek},
+	{"Thai", unicode.Thai},
+}
+
+// languageStopWords are the most frequent words of the languages written in Latin script, the
+// words shared by several languages count for each of them
+var languageStopWords = map[string][]string{
+	"English":    {"the", "and", "is", "are", "of", "to", "in", "that", "it", "with", "for", "was", "on", "this", "be", "by", "what", "which", "how", "not", "or", "from", "have", "has", "can", "does", "why", "who", "an"},
+	"Spanish":    {"el", "la", "los", "las", "de", "que", "y", "es", "en", "un", "una", "por", "con", "para", "del", "al", "se", "no", "como", "más", "lo", "qué", "cómo", "cuál", "cuáles", "dónde", "son", "está", "su"},
+	"French":     {"le", "la", "les", "de", "des", "et", "est", "un", "une", "du", "en", "que", "qui", "dans", "pour", "pas", "sur", "au", "avec", "ce", "sont", "il", "elle", "quel", "quelle", "comment", "pourquoi", "où"},
+	"German":     {"der", "die", "das", "und", "ist", "ein", "eine", "nicht", "zu", "den", "mit", "von", "sich", "auf", "für", "dem", "des", "im", "auch", "es", "wie", "was", "sind", "werden", "welche", "warum", "wer"},
+	"Italian":    {"il", "lo", "la", "gli", "le", "di", "che", "è", "e", "un", "una", "per", "non", "con", "del", "della", "sono", "come", "anche", "più", "nel", "cosa", "quale", "perché", "dove"},
+	"Portuguese": {"o", "a", "os", "as", "de", "que", "e", "é", "um", "uma", "do", "da", "em", "para", "com", "não", "por", "se", "mais", "como", "dos", "das", "são", "qual", "onde", "porque"},
+	"Dutch":      {"de", "het", "een", "en", "van", "is", "dat", "in", "op", "te", "zijn", "niet", "met", "voor", "die", "er", "wat", "hoe", "ook", "naar", "worden", "waarom", "welke"},
+}
+
+// stopWordLanguages indexes the languages of every stop word
+var stopWordLanguages = func() map[string][]string {
+	index := make(map[string][]string)
+	for language, words := range languageStopWords {
+		for _, word := range words {
+			index[word] = append(index[word], language)
+		}
+	}
+	return index
+}()
+
+// detectLanguage tells the language of a text, by its script or else by its stop words. It is ""
+// when the text is too short or too mixed to tell.
+func detectLanguage(text string) string {
+	letters := 0
+	scripts := make(map[string]int)
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		for _, ls := range languageScripts {
+			if unicode.Is(ls.Script, r) {
+				scripts[ls.Name]++
+				break
+			}
+		}
+	}
+	if letters == 0 {
+		return ""
+	}
+	// Japanese mixes kana with Han characters, any kana tells it from Chinese
+	if scripts["Japanese"] > 0 && float64(scripts["Japanese"]+scripts["Chinese"]) >= minScriptShare*float64(letters) {
+		return "Japanese"
+	}
+	best, bestCount := "", 0
+	for name, count := range scripts {
+		if count > bestCount || (count == bestCount && name < best) {
+			best, bestCount = name, count
+		}
+	}
+	if float64(bestCount) >= minScriptShare*float64(letters) {
+		return best
+	}
+
+	counts := make(map[string]int)
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool { return !unicode.IsLetter(r) })
+	for _, word := range words {
+		for _, language := range stopWordLanguages[word] {
+			counts[language]++
+		}
+	}
+	best, bestCount, runnerUp := "", 0, 0
+	for language, count := range counts {
+		switch {
+		case count > bestCount:
+			best, bestCount, runnerUp = language, count, bestCount
+		case count > runnerUp:
+			runnerUp = count
+		}
+	}
+	if bestCount < minLanguageWords || bestCount == runnerUp {
+		return ""
+	}
+	return best
+}
+
+// languageMismatch reports whether the model answered in another language than the question,
+// when both languages could be told
+func (r precheckSummaryRow) languageMismatch() bool {
+	return r.QuestionLanguage != "" && r.AnswerLanguage != "" && r.QuestionLanguage != r.AnswerLanguage
+}
+
+// languageMarkdownSummary lists the answers in another language than their question, "" when
+// there are none
+func languageMarkdownSummary(rows []precheckSummaryRow) string {
+	var table strings.Builder
+	mismatches := 0
+	for i, row := range rows {
+		if !row.languageMismatch() {
+			continue
+		}
+		mismatches++
+		question := markdownCell(row.Question, summaryQuestionLength)
+		if row.Model != "" {
+			question += " (" + row.Model + ")"
+		}
+		fmt.Fprintf(&table, "| %d | %s | %s | %s |\n", i+1, question, row.QuestionLanguage, row.AnswerLanguage)
+	}
+	if mismatches == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("\n#### Answers in another language\n\n")
+	fmt.Fprintf(&b, "**%d of %d answers are not in the language of their question.** Models often answer the questions of non-English contributions in English, such answers tell little about what the model knows.\n\n", mismatches, len(rows))
+	b.WriteString("| # | Question | Question language | Answer language |\n")
+	b.WriteString("|---|----------|-------------------|-----------------|\n")
+	b.WriteString(table.String())
+	return b.String()
+}
@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestDetectLanguage verify the languages are told by their script or their stop words, and
+// short or mixed texts are not told.
+func TestDetectLanguage(t *testing.T) {
+	for text, language := range map[string]string{
+		"What is the capital of France?":                              "English",
+		"¿Cuál es la capital de Francia?":                             "Spanish",
+		"Quelle est la capitale de la France et pourquoi?":            "French",
+		"Was ist die Hauptstadt von Frankreich und wie groß ist sie?": "German",
+		"Qual è la capitale della Francia?":                           "Italian",
+		"Wat is de hoofdstad van Frankrijk en hoe groot is het?":      "Dutch",
+		"Qual é a capital da França? Onde fica?":                      "Portuguese",
+		"法国的首都是哪里？":                                                   "Chinese",
+		"フランスの首都はどこですか？":                                              "Japanese",
+		"프랑스의 수도는 어디입니까?":                                             "Korean",
+		"Какая столица Франции?":                                      "Cyrillic script",
+		"Столица Франции — Париж, по-французски Paris.":               "Cyrillic script",
+		"Paris": "",
+		"42":    "",
+		"":      "",
+	} {
+		assert.Equal(t, language, detectLanguage(text), text)
+	}
+}
+
+// TestLanguageMarkdownSummary verify the answers in another language than their question are
+// flagged and listed, the ones whose language could not be told are not.
+func TestLanguageMarkdownSummary(t *testing.T) {
+	rows := []precheckSummaryRow{
+		{File: "knowledge/geo/qna.yaml", Question: "¿Cuál es la capital de Francia?", Answer: "The capital of France is Paris.",
+			QuestionLanguage: "Spanish", AnswerLanguage: "English"},
+		{File: "knowledge/geo/qna.yaml", Question: "¿Dónde está Lyon?", Answer: "Lyon está en el este de Francia.",
+			QuestionLanguage: "Spanish", AnswerLanguage: "Spanish"},
+		{File: "knowledge/geo/qna.yaml", Question: "¿Y Niza?", Answer: "Niza", QuestionLanguage: "Spanish"},
+	}
+	assert.Empty(t, languageMarkdownSummary(rows[1:]))
+	assert.Empty(t, rows[2].flag())
+
+	summary := languageMarkdownSummary(rows)
+	assert.Contains(t, summary, "**1 of 3 answers are not in the language of their question.**")
+	assert.Contains(t, summary, "| 1 | ¿Cuál es la capital de Francia? | Spanish | English |")
+	assert.NotContains(t, summary, "Lyon")
+
+	summary = precheckMarkdownSummary(rows, nil)
+	assert.Contains(t, summary, "| - | 🌐 English answer |")
+	assert.Contains(t, summary, "#### Answers in another language")
+}
@@ -0,0 +1,267 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/instructlab/instructlab-bot/pkg/jobqueue"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+const (
+	lintLevelError   = "failure"
+	lintLevelWarning = "warning"
+
+	lintRuleSyntax        = "syntax"
+	lintRuleLineLength    = "line-length"
+	lintRuleTrailingSpace = "trailing-spaces"
+	lintRuleIndentation   = "indentation"
+	lintRuleDuplicateKeys = "key-duplicates"
+
+	lintIndentSpaces      = 2
+	lintResultsFilename   = "lint_results.json"
+	lintReportFilename    = "lint_report.html"
+	maxLintAnnotationsLen = 50
+)
+
+var yamlErrorLineRegex = regexp.MustCompile(`line (\d+)`)
+
+// lintProblem is a single lint finding. The JSON field names match the GitHub
+// check-run annotation format so the bot can post them without conversion.
+type lintProblem struct {
+	Path    string `json:"path"`
+	Line    int    `json:"start_line"`
+	EndLine int    `json:"end_line"`
+	Column  int    `json:"start_column,omitempty"`
+	Level   string `json:"annotation_level"`
+	Rule    string `json:"title"`
+	Message string `json:"message"`
+}
+
+// lintFileResult holds the lint findings and content of a single linted file.
+type lintFileResult struct {
+	Path     string
+	Lines    []string
+	Problems []lintProblem
+	// Quality are the findings of the content quality rules, reported in a section of their own
+	Quality []lintProblem
+}
+
+// allProblems are the YAML findings followed by the content quality ones
+func (r lintFileResult) allProblems() []lintProblem {
+	return append(append([]lintProblem(nil), r.Problems...), r.Quality...)
+}
+
+// hasErrors reports whether any of the findings are errors rather than warnings
+func (r lintFileResult) hasErrors() bool {
+	for _, p := range r.allProblems() {
+		if p.Level == lintLevelError {
+			return true
+		}
+	}
+	return false
+}
+
+// lintYAML runs the yamllint-equivalent rules over a YAML document. The path is
+// only used to label the findings.
+func lintYAML(filePath string, content []byte, maxLineLength int) lintFileResult {
+	result := lintFileResult{
+		Path:  filePath,
+		Lines: strings.Split(strings.TrimSuffix(string(content), "\n"), "\n"),
+	}
+
+	addProblem := func(line, column int, level, rule, msg string) {
+		result.Problems = append(result.Problems, lintProblem{
+			Path:    filePath,
+			Line:    line,
+			EndLine: line,
+			Column:  column,
+			Level:   level,
+			Rule:    rule,
+			Message: msg,
+		})
+	}
+
+	inBlockScalar := false
+	blockScalarIndent := 0
+	for i, line := range result.Lines {
+		lineNum := i + 1
+
+		if length := utf8.RuneCountInString(line); maxLineLength > 0 && length > maxLineLength {
+			addProblem(lineNum, maxLineLength+1, lintLevelWarning, lintRuleLineLength,
+				fmt.Sprintf("line too long (%d > %d characters)", length, maxLineLength))
+		}
+
+		if trimmed := strings.TrimRight(line, " \t"); len(trimmed) != len(line) {
+			addProblem(lineNum, len(trimmed)+1, lintLevelError, lintRuleTrailingSpace, "trailing spaces")
+		}
+
+		content := strings.TrimLeft(line, " \t")
+		if content == "" {
+			continue
+		}
+		leading := line[:len(line)-len(content)]
+		indent := len(leading)
+
+		// Lines inside a block scalar (| or >) are free-form text
+		if inBlockScalar {
+			if indent > blockScalarIndent {
+				continue
+			}
+			inBlockScalar = false
+		}
+
+		if strings.Contains(leading, "\t") {
+			addProblem(lineNum, strings.Index(leading, "\t")+1, lintLevelError, lintRuleIndentation,
+				"wrong indentation: found a tab character")
+		} else if indent%lintIndentSpaces != 0 && !strings.HasPrefix(content, "#") {
+			addProblem(lineNum, indent+1, lintLevelError, lintRuleIndentation,
+				fmt.Sprintf("wrong indentation: expected a multiple of %d spaces but found %d", lintIndentSpaces, indent))
+		}
+
+		if isBlockScalarStart(content) {
+			inBlockScalar = true
+			blockScalarIndent = indent
+		}
+	}
+
+	var root yamlv3.Node
+	if err := yamlv3.Unmarshal(content, &root); err != nil {
+		line := 1
+		if m := yamlErrorLineRegex.FindStringSubmatch(err.Error()); m != nil {
+			line, _ = strconv.Atoi(m[1])
+		}
+		addProblem(line, 1, lintLevelError, lintRuleSyntax, strings.TrimPrefix(err.Error(), "yaml: "))
+	} else {
+		for _, dup := range findDuplicateKeys(&root) {
+			addProblem(dup.Line, dup.Column, lintLevelError, lintRuleDuplicateKeys,
+				fmt.Sprintf("duplication of key %q in mapping", dup.Value))
+		}
+	}
+
+	sort.SliceStable(result.Problems, func(a, b int) bool {
+		if result.Problems[a].Line != result.Problems[b].Line {
+			return result.Problems[a].Line < result.Problems[b].Line
+		}
+		return result.Problems[a].Column < result.Problems[b].Column
+	})
+	return result
+}
+
+// isBlockScalarStart reports whether the line opens a literal or folded block scalar
+func isBlockScalarStart(content string) bool {
+	content = strings.TrimSpace(strings.SplitN(content, " #", 2)[0])
+	for _, indicator := range []string{"|", "|-", "|+", ">", ">-", ">+"} {
+		if content == indicator || strings.HasSuffix(content, ": "+indicator) || strings.HasSuffix(content, "- "+indicator) {
+			return true
+		}
+	}
+	return false
+}
+
+// findDuplicateKeys walks the node tree and returns every mapping key node that repeats an earlier key
+func findDuplicateKeys(node *yamlv3.Node) []*yamlv3.Node {
+	var dups []*yamlv3.Node
+	if node.Kind == yamlv3.MappingNode {
+		seen := make(map[string]bool)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i]
+			if seen[key.Value] {
+				dups = append(dups, key)
+			}
+			seen[key.Value] = true
+		}
+	}
+	for _, child := range node.Content {
+		dups = append(dups, findDuplicateKeys(child)...)
+	}
+	return dups
+}
+
+// lintTaxonomyFiles lints the changed taxonomy files, writes the JSON results and the annotated
+// HTML report into the output directory and stores the findings on the job for the bot to annotate.
+func (w *Worker) lintTaxonomyFiles(taxonomyFiles []string, outputDir string) []lintFileResult {
+	var results []lintFileResult
+	var annotations []lintProblem
+	for _, file := range taxonomyFiles {
+		content, err := os.ReadFile(filepath.Join(w.taxonomyDir, file))
+		if err != nil {
+			w.logger.Errorf("Could not read %s for linting: %v", file, err)
+			continue
+		}
+		result := lintYAML(file, content, YamlMaxLineLength)
+		result.Quality = lintQuality(file, content)
+		if problems := len(result.Problems) + len(result.Quality); problems > 0 {
+			w.logger.Infof("Lint found %d problem(s) in %s", problems, file)
+		}
+		results = append(results, result)
+		annotations = append(annotations, result.allProblems()...)
+	}
+	w.setLintMetrics(results)
+
+	resultsJSON, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		w.logger.Errorf("Could not marshal lint results: %v", err)
+		return results
+	}
+	if err := os.WriteFile(filepath.Join(outputDir, lintResultsFilename), resultsJSON, 0644); err != nil {
+		w.logger.Errorf("Could not write lint results: %v", err)
+	}
+
+	reportFile, err := os.Create(filepath.Join(outputDir, lintReportFilename))
+	if err != nil {
+		w.logger.Errorf("Could not create %s: %v", lintReportFilename, err)
+	} else {
+		defer reportFile.Close()
+		if err := generateLintHTML(reportFile, results); err != nil {
+			w.logger.Errorf("Could not generate %s: %v", lintReportFilename, err)
+		}
+	}
+
+	w.setJobAnnotations(annotations)
+	return results
+}
+
+// setJobAnnotations adds check-run annotations to the ones of the job and stores them in redis,
+// the first maxLintAnnotationsLen of them are kept
+func (w *Worker) setJobAnnotations(annotations []lintProblem) {
+	if len(annotations) == 0 {
+		return
+	}
+	w.annotations = append(w.annotations, annotations...)
+	if len(w.annotations) > maxLintAnnotationsLen {
+		w.annotations = w.annotations[:maxLintAnnotationsLen]
+	}
+	if w.queue == nil {
+		return
+	}
+	annotationsJSON, err := json.Marshal(w.annotations)
+	if err != nil {
+		w.logger.Errorf("Could not marshal annotations: %v", err)
+		return
+	}
+
+	if err := w.setJobField(jobqueue.FieldAnnotations, string(annotationsJSON)); err != nil {
+		w.logger.Errorf("Could not set annotations in redis: %v", err)
+	}
+}
+
+// lintErrorSummary renders the error-level findings as a short plain text list
+func lintErrorSummary(results []lintFileResult) string {
+	var sb strings.Builder
+	for _, r := range results {
+		for _, p := range r.allProblems() {
+			if p.Level == lintLevelError {
+				fmt.Fprintf(&sb, "%s:%d:%d: [%s] %s\n", p.Path, p.Line, p.Column, p.Rule, p.Message)
+			}
+		}
+	}
+	return sb.String()
+}
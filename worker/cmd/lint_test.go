@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestLintYAML verify each lint rule reports the offending line.
+func TestLintYAML(t *testing.T) {
+	content := `task_description: test skill
+created_by: someone 
+seed_examples:
+  - question: What is the answer to this question which is definitely going to be far too long?
+    answer: |
+      Free-form   text
+         keeps its own indentation
+  - question: Another question
+    context:
+       odd: indentation
+created_by: duplicate
+`
+	result := lintYAML("compositional_skills/test/qna.yaml", []byte(content), 80)
+
+	rulesByLine := make(map[int][]string)
+	for _, p := range result.Problems {
+		assert.Equal(t, "compositional_skills/test/qna.yaml", p.Path)
+		rulesByLine[p.Line] = append(rulesByLine[p.Line], p.Rule)
+	}
+
+	assert.Equal(t, []string{lintRuleTrailingSpace}, rulesByLine[2], "trailing spaces should be reported")
+	assert.Equal(t, []string{lintRuleLineLength}, rulesByLine[4], "long lines should be reported")
+	assert.Empty(t, rulesByLine[6], "block scalar content should not be linted for indentation")
+	assert.Empty(t, rulesByLine[7], "block scalar content should not be linted for indentation")
+	assert.Equal(t, []string{lintRuleIndentation}, rulesByLine[10], "odd indentation should be reported")
+	assert.Equal(t, []string{lintRuleDuplicateKeys}, rulesByLine[11], "duplicate keys should be reported")
+	assert.True(t, result.hasErrors())
+}
+
+// TestLintYAMLSyntaxError verify invalid YAML is reported with its line number.
+func TestLintYAMLSyntaxError(t *testing.T) {
+	content := "task_description: test\nseed_examples:\n  - question: [unclosed\n"
+	result := lintYAML("knowledge/test/qna.yaml", []byte(content), 120)
+
+	if assert.Len(t, result.Problems, 1) {
+		assert.Equal(t, lintRuleSyntax, result.Problems[0].Rule)
+		assert.Equal(t, lintLevelError, result.Problems[0].Level)
+	}
+}
+
+// TestLintYAMLClean verify a well formed file has no findings.
+func TestLintYAMLClean(t *testing.T) {
+	content := "task_description: test\nseed_examples:\n  - question: Why?\n    answer: >\n      Because.\n"
+	result := lintYAML("knowledge/test/qna.yaml", []byte(content), 120)
+	assert.Empty(t, result.Problems)
+	assert.False(t, result.hasErrors())
+}
@@ -0,0 +1,143 @@
+package cmd
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// The content quality rules, evaluated on the seed examples of the taxonomy files
+const (
+	lintRuleAnswerLength  = "answer-length"
+	lintRuleQuestionMark  = "question-mark"
+	lintRuleContextTokens = "context-tokens"
+	lintRuleQnaPairs      = "qna-pairs"
+
+	// lintCharsPerToken estimates the tokens of a context without the tokenizer of the model, English
+	// text averages about 4 characters per token
+	lintCharsPerToken = 4
+)
+
+var (
+	LintMinAnswerLength  int
+	LintQuestionMark     bool
+	LintMaxContextTokens int
+	LintMinQnaPairs      int
+	LintErrorRules       []string
+)
+
+// lintQualityRules are the content quality rules that --lint-error-rules can report as errors
+var lintQualityRules = []string{lintRuleAnswerLength, lintRuleQuestionMark, lintRuleContextTokens, lintRuleQnaPairs}
+
+// validateLintRules checks the rules of --lint-error-rules
+func validateLintRules() error {
+	for _, rule := range LintErrorRules {
+		if !slices.Contains(lintQualityRules, rule) {
+			return fmt.Errorf("unknown --lint-error-rules rule %q, expected one of %s", rule, strings.Join(lintQualityRules, ", "))
+		}
+	}
+	return nil
+}
+
+// lintQualityLevel is the level the findings of a content quality rule are reported at, warnings
+// unless the rule is listed by --lint-error-rules
+func lintQualityLevel(rule string) string {
+	if slices.Contains(LintErrorRules, rule) {
+		return lintLevelError
+	}
+	return lintLevelWarning
+}
+
+// estimateTokens is the approximate token count of a text
+func estimateTokens(text string) int {
+	return (utf8.RuneCountInString(strings.TrimSpace(text)) + lintCharsPerToken - 1) / lintCharsPerToken
+}
+
+// lintQuality checks the seed examples of a taxonomy file against the content quality rules. The
+// questions of skills are often instructions, they need no question mark, and only knowledge seed
+// examples group several Q&A pairs under a context. A file that can't be parsed has no findings,
+// lintYAML reports it.
+func lintQuality(filePath string, content []byte) []lintProblem {
+	var root yamlv3.Node
+	if err := yamlv3.Unmarshal(content, &root); err != nil || len(root.Content) == 0 {
+		return nil
+	}
+	seedExamples := mappingValue(root.Content[0], "seed_examples")
+	if seedExamples == nil || seedExamples.Kind != yamlv3.SequenceNode {
+		return nil
+	}
+	knowledge := false
+	if file, ok := parseTaxonomyPath("", filePath); ok {
+		knowledge = file.Kind == taxonomyTypeKnowledge
+	}
+
+	var problems []lintProblem
+	addProblem := func(node *yamlv3.Node, rule, msg string) {
+		problems = append(problems, lintProblem{
+			Path:    filePath,
+			Line:    node.Line,
+			EndLine: node.Line,
+			Column:  node.Column,
+			Level:   lintQualityLevel(rule),
+			Rule:    rule,
+			Message: msg,
+		})
+	}
+	checkPair := func(example int, pair *yamlv3.Node) {
+		if question := mappingValue(pair, "question"); question != nil && knowledge && LintQuestionMark {
+			if text := strings.TrimSpace(question.Value); text != "" && !strings.HasSuffix(text, "?") {
+				addProblem(question, lintRuleQuestionMark, fmt.Sprintf("the question of seed example %d does not end with a question mark", example))
+			}
+		}
+		if answer := mappingValue(pair, "answer"); answer != nil && LintMinAnswerLength > 0 {
+			if length := utf8.RuneCountInString(strings.TrimSpace(answer.Value)); length < LintMinAnswerLength {
+				addProblem(answer, lintRuleAnswerLength, fmt.Sprintf("the answer of seed example %d is too short (%d < %d characters)", example, length, LintMinAnswerLength))
+			}
+		}
+	}
+
+	for i, example := range seedExamples.Content {
+		if example.Kind != yamlv3.MappingNode {
+			continue
+		}
+		if context := mappingValue(example, "context"); context != nil && LintMaxContextTokens > 0 {
+			if tokens := estimateTokens(context.Value); tokens > LintMaxContextTokens {
+				addProblem(context, lintRuleContextTokens, fmt.Sprintf("the context of seed example %d is too long (about %d > %d tokens)", i+1, tokens, LintMaxContextTokens))
+			}
+		}
+		pairs := 0
+		if mappingValue(example, "question") != nil {
+			pairs++
+			checkPair(i+1, example)
+		}
+		if qna := mappingValue(example, "questions_and_answers"); qna != nil && qna.Kind == yamlv3.SequenceNode {
+			for _, pair := range qna.Content {
+				if pair.Kind == yamlv3.MappingNode {
+					pairs++
+					checkPair(i+1, pair)
+				}
+			}
+		}
+		if knowledge && LintMinQnaPairs > 0 && pairs < LintMinQnaPairs {
+			addProblem(example, lintRuleQnaPairs, fmt.Sprintf("seed example %d has %d Q&A pairs, at least %d are expected", i+1, pairs, LintMinQnaPairs))
+		}
+	}
+	return problems
+}
+
+// mappingValue is the value of a key of a mapping node, nil when the node is not a mapping or
+// lacks the key
+func mappingValue(node *yamlv3.Node, key string) *yamlv3.Node {
+	if node.Kind != yamlv3.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
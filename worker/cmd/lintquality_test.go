@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// setLintQualityRules enables the content quality rules for the duration of the test
+func setLintQualityRules(t *testing.T, errorRules ...string) {
+	minAnswer, questionMark, maxContext, minPairs, levels := LintMinAnswerLength, LintQuestionMark, LintMaxContextTokens, LintMinQnaPairs, LintErrorRules
+	t.Cleanup(func() {
+		LintMinAnswerLength, LintQuestionMark, LintMaxContextTokens, LintMinQnaPairs, LintErrorRules = minAnswer, questionMark, maxContext, minPairs, levels
+	})
+	LintMinAnswerLength, LintQuestionMark, LintMaxContextTokens, LintMinQnaPairs, LintErrorRules = 10, true, 20, 3, errorRules
+}
+
+// TestLintQualityKnowledge verify each content quality rule reports the offending node of a
+// knowledge file.
+func TestLintQualityKnowledge(t *testing.T) {
+	setLintQualityRules(t, lintRuleQnaPairs)
+	content := `version: 3
+seed_examples:
+  - context: |
+      The sky appears blue because of the Rayleigh scattering of sunlight by the molecules of the air.
+    questions_and_answers:
+      - question: Why is the sky blue?
+        answer: Rayleigh scattering of sunlight.
+      - question: Name the scattering
+        answer: Rayleigh
+  - context: Short context.
+    questions_and_answers:
+      - question: What scatters sunlight?
+        answer: The molecules of the air.
+      - question: What color is the sky?
+        answer: The sky is blue.
+      - question: When is the sky red?
+        answer: At sunset and sunrise.
+`
+	problems := lintQuality("knowledge/science/qna.yaml", []byte(content))
+	var found []string
+	for _, p := range problems {
+		found = append(found, strings.Join([]string{p.Rule, p.Level}, ":"))
+	}
+	assert.Equal(t, []string{
+		"context-tokens:warning",
+		"question-mark:warning",
+		"answer-length:warning",
+		"qna-pairs:failure",
+	}, found)
+	assert.Equal(t, 3, problems[0].Line)
+	assert.Equal(t, 8, problems[1].Line)
+	assert.Equal(t, "the question of seed example 1 does not end with a question mark", problems[1].Message)
+	assert.Equal(t, 9, problems[2].Line)
+	assert.Equal(t, "the answer of seed example 1 is too short (8 < 10 characters)", problems[2].Message)
+	assert.Equal(t, "seed example 1 has 2 Q&A pairs, at least 3 are expected", problems[3].Message)
+}
+
+// TestLintQualitySkill verify the questions of skills may be instructions and their seed examples
+// hold a single Q&A pair.
+func TestLintQualitySkill(t *testing.T) {
+	setLintQualityRules(t)
+	content := `version: 2
+seed_examples:
+  - question: Write a haiku about the sea
+    answer: Waves fold into foam
+  - question: Write a haiku about rain
+    answer: Short
+`
+	problems := lintQuality("compositional_skills/writing/haiku/qna.yaml", []byte(content))
+	if assert.Len(t, problems, 1) {
+		assert.Equal(t, lintRuleAnswerLength, problems[0].Rule)
+		assert.Equal(t, 6, problems[0].Line)
+	}
+
+	assert.Empty(t, lintQuality("compositional_skills/writing/haiku/qna.yaml", []byte("seed_examples: [")))
+}
+
+func TestValidateLintRules(t *testing.T) {
+	setLintQualityRules(t, lintRuleAnswerLength, lintRuleContextTokens)
+	assert.NoError(t, validateLintRules())
+	LintErrorRules = []string{"answer-lenght"}
+	assert.ErrorContains(t, validateLintRules(), `unknown --lint-error-rules rule "answer-lenght"`)
+}
+
+func TestEstimateTokens(t *testing.T) {
+	assert.Equal(t, 0, estimateTokens("  "))
+	assert.Equal(t, 1, estimateTokens("sky"))
+	assert.Equal(t, 3, estimateTokens(" The sky is "))
+}
+
+// TestLintReportQuality verify the content quality findings are listed in their own section.
+func TestLintReportQuality(t *testing.T) {
+	path := filepath.Join(t.TempDir(), lintReportFilename)
+	reportFile, err := os.Create(path)
+	assert.NoError(t, err)
+	assert.NoError(t, generateLintHTML(reportFile, []lintFileResult{{
+		Path:    "knowledge/science/qna.yaml",
+		Lines:   []string{"version: 3"},
+		Quality: []lintProblem{{Line: 8, Column: 9, Level: lintLevelWarning, Rule: lintRuleQuestionMark, Message: "no question mark"}},
+	}}))
+	assert.NoError(t, reportFile.Close())
+	html, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Contains(t, string(html), "<h1>Content Quality</h1>")
+	assert.Contains(t, string(html), `<li class="problem warning">8:9 [question-mark] no question mark</li>`)
+}
@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"encoding/json"
+
+	"github.com/instructlab/instructlab-bot/pkg/jobqueue"
+)
+
+// The metrics of a job, published to `jobs:<id>:metrics` for the merge policies of the bot
+const (
+	metricLintErrors       = "lint_errors"
+	metricLintWarnings     = "lint_warnings"
+	metricQualityErrors    = "quality_errors"
+	metricQualityWarnings  = "quality_warnings"
+	metricComplianceErrors = "compliance_errors"
+	metricAnswers          = "answers"
+	metricSkippedQuestions = "skipped_questions"
+	metricTimedOut         = "timed_out_questions"
+	metricTruncatedAnswers = "truncated_answers"
+	metricEmptyAnswers     = "empty_answers"
+	metricLowSimilarity    = "low_similarity_answers"
+	metricLanguageMismatch = "language_mismatches"
+	metricMinScore         = "min_score"
+	metricMeanScore        = "mean_score"
+	metricRecords          = "records"
+	metricValidSamples     = "valid_samples"
+	metricInvalidRecords   = "invalid_records"
+	metricEmptyFields      = "empty_fields"
+	metricDuplicateRate    = "duplicate_rate"
+)
+
+// jobMetrics are the numeric results of a job
+type jobMetrics map[string]float64
+
+func (w *Worker) setMetric(name string, value float64) {
+	if w.metrics == nil {
+		w.metrics = jobMetrics{}
+	}
+	w.metrics[name] = value
+}
+
+// setLintMetrics counts the lint findings of the job, the content quality ones apart
+func (w *Worker) setLintMetrics(results []lintFileResult) {
+	errors, warnings, qualityErrors, qualityWarnings := 0, 0, 0, 0
+	for _, result := range results {
+		for _, problem := range result.Problems {
+			if problem.Level == lintLevelError {
+				errors++
+			} else {
+				warnings++
+			}
+		}
+		for _, problem := range result.Quality {
+			if problem.Level == lintLevelError {
+				qualityErrors++
+			} else {
+				qualityWarnings++
+			}
+		}
+	}
+	w.setMetric(metricLintErrors, float64(errors))
+	w.setMetric(metricLintWarnings, float64(warnings))
+	w.setMetric(metricQualityErrors, float64(qualityErrors))
+	w.setMetric(metricQualityWarnings, float64(qualityWarnings))
+}
+
+// setPrecheckMetrics summarizes the answers of a precheck, the scores are left out when no answer
+// could be compared with the answer of the contributor
+func (w *Worker) setPrecheckMetrics(rows []precheckSummaryRow, skipped []skippedQuestion) {
+	truncated, empty, low, scored, mismatches := 0, 0, 0, 0, 0
+	minScore, total := 0.0, 0.0
+	for _, row := range rows {
+		if row.languageMismatch() {
+			mismatches++
+		}
+		switch answerIssue(row.Answer, row.FinishReason) {
+		case answerTruncated:
+			truncated++
+		case answerEmpty:
+			empty++
+		}
+		if row.Scores == nil {
+			continue
+		}
+		score := row.Scores.Score()
+		if score < lowSimilarityThreshold {
+			low++
+		}
+		if scored == 0 || score < minScore {
+			minScore = score
+		}
+		total += score
+		scored++
+	}
+	w.setMetric(metricAnswers, float64(len(rows)))
+	w.setMetric(metricSkippedQuestions, float64(len(skipped)))
+	timedOut := 0
+	for _, q := range skipped {
+		if q.Timeout {
+			timedOut++
+		}
+	}
+	w.setMetric(metricTimedOut, float64(timedOut))
+	w.setMetric(metricTruncatedAnswers, float64(truncated))
+	w.setMetric(metricEmptyAnswers, float64(empty))
+	w.setMetric(metricLowSimilarity, float64(low))
+	w.setMetric(metricLanguageMismatch, float64(mismatches))
+	if scored > 0 {
+		w.setMetric(metricMinScore, minScore)
+		w.setMetric(metricMeanScore, total/float64(scored))
+	}
+}
+
+// setDatasetMetrics records the validation of the generated dataset
+func (w *Worker) setDatasetMetrics(stats *datasetStats) {
+	w.setMetric(metricRecords, float64(stats.Records))
+	w.setMetric(metricValidSamples, float64(stats.ValidSamples))
+	w.setMetric(metricInvalidRecords, float64(stats.InvalidRecords))
+	w.setMetric(metricEmptyFields, float64(stats.EmptyFields))
+	w.setMetric(metricDuplicateRate, stats.DuplicateRate)
+}
+
+// addMetrics adds the metrics of the job to the result fields read by the bot
+func (w *Worker) addMetrics(fields map[jobqueue.Field]interface{}) {
+	if len(w.metrics) == 0 {
+		return
+	}
+	metricsJSON, err := json.Marshal(w.metrics)
+	if err != nil {
+		w.logger.Errorf("Could not marshal job metrics: %v", err)
+		return
+	}
+	fields[jobqueue.FieldMetrics] = string(metricsJSON)
+}
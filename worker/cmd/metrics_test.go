@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestPrecheckMetrics verify the answers are counted and only the compared ones are scored.
+func TestPrecheckMetrics(t *testing.T) {
+	w := &Worker{job: "7"}
+	w.setPrecheckMetrics([]precheckSummaryRow{{Answer: "a", FinishReason: "stop"}}, nil)
+	assert.Equal(t, jobMetrics{
+		metricAnswers:          1,
+		metricSkippedQuestions: 0,
+		metricTimedOut:         0,
+		metricTruncatedAnswers: 0,
+		metricEmptyAnswers:     0,
+		metricLowSimilarity:    0,
+		metricLanguageMismatch: 0,
+	}, w.metrics)
+
+	low, high := similarityScores{RougeL: 0.2}, similarityScores{RougeL: 0.8}
+	w.setPrecheckMetrics([]precheckSummaryRow{
+		{Answer: "a", FinishReason: "length", Scores: &low},
+		{Answer: "b", FinishReason: "stop", Scores: &high},
+		{Answer: " ", FinishReason: "length", QuestionLanguage: "Spanish", AnswerLanguage: "English"},
+	}, []skippedQuestion{{Question: "c", Reason: "timeout"}, {Question: "d", Reason: "TIMEOUT: no answer within 1m0s", Timeout: true}})
+	assert.Equal(t, 3.0, w.metrics[metricAnswers])
+	assert.Equal(t, 2.0, w.metrics[metricSkippedQuestions])
+	assert.Equal(t, 1.0, w.metrics[metricTimedOut])
+	assert.Equal(t, 1.0, w.metrics[metricTruncatedAnswers])
+	assert.Equal(t, 1.0, w.metrics[metricEmptyAnswers], "an empty answer is not counted as truncated")
+	assert.Equal(t, 1.0, w.metrics[metricLowSimilarity])
+	assert.Equal(t, 1.0, w.metrics[metricLanguageMismatch])
+	assert.Equal(t, 0.2, w.metrics[metricMinScore])
+	assert.InDelta(t, 0.5, w.metrics[metricMeanScore], 1e-9)
+}
+
+// TestLintMetrics verify errors and warnings are counted apart.
+func TestLintMetrics(t *testing.T) {
+	w := &Worker{job: "7"}
+	w.setLintMetrics([]lintFileResult{
+		{Path: "a.yaml", Problems: []lintProblem{{Level: lintLevelError}, {Level: lintLevelWarning}}},
+		{Path: "b.yaml", Problems: []lintProblem{{Level: lintLevelWarning}}, Quality: []lintProblem{{Level: lintLevelWarning}}},
+	})
+	assert.Equal(t, 1.0, w.metrics[metricLintErrors])
+	assert.Equal(t, 2.0, w.metrics[metricLintWarnings])
+	assert.Equal(t, 0.0, w.metrics[metricQualityErrors])
+	assert.Equal(t, 1.0, w.metrics[metricQualityWarnings])
+}
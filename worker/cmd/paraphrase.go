@@ -0,0 +1,167 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/instructlab/instructlab-bot/pkg/jobqueue"
+)
+
+const (
+	// maxParaphrases bounds the paraphrases of each question, every one of them is asked to every model
+	maxParaphrases = 5
+	// consistencyThreshold is the mean similarity of the answers to the paraphrases and to the
+	// question below which the answers are flagged as inconsistent
+	consistencyThreshold = 0.5
+)
+
+// paraphrasePrompt asks the model for paraphrases of a seed question, one per line
+const paraphrasePrompt = `Rewrite the following question in %d different ways. Keep its meaning and the facts it asks about, only change the wording. Answer with one question per line, without numbering or any other text.
+
+Question: %s`
+
+// paraphraseListMarker matches the numbering or bullet models put before the lines of a list
+var paraphraseListMarker = regexp.MustCompile(`^\s*(?:[-*•]|\d+[.)])\s*`)
+
+// paraphraseAnswer is the answer of the model to a paraphrase of a seed question
+type paraphraseAnswer struct {
+	Question string  `yaml:"question"`
+	Answer   string  `yaml:"output"`
+	Score    float64 `yaml:"similarity"`
+}
+
+// loadParaphrases reads how many paraphrases of each question the precheck asks, 0 for none
+func (w *Worker) loadParaphrases() (int, error) {
+	value, err := w.jobField(jobqueue.FieldParaphrases)
+	if err != nil || value == "" {
+		return 0, err
+	}
+	paraphrases, err := strconv.Atoi(value)
+	if err != nil || paraphrases < 0 || paraphrases > maxParaphrases {
+		return 0, fmt.Errorf("invalid paraphrases %q, it must be an integer between 0 and %d", value, maxParaphrases)
+	}
+	return paraphrases, nil
+}
+
+// paraphraseMessages are the messages asking for the paraphrases of a question
+func paraphraseMessages(question string, count int) []chatMessage {
+	return []chatMessage{
+		{Role: "system", Content: defaultSystemPrompt},
+		{Role: "user", Content: fmt.Sprintf(paraphrasePrompt, count, question)},
+	}
+}
+
+// parseParaphrases reads the paraphrases from the answer of the model, dropping the list
+// markers, the duplicates and the question itself
+func parseParaphrases(question, answer string, count int) []string {
+	seen := map[string]bool{strings.ToLower(strings.TrimSpace(question)): true}
+	var paraphrases []string
+	for _, line := range splitLines(answer) {
+		line = strings.TrimSpace(paraphraseListMarker.ReplaceAllString(line, ""))
+		key := strings.ToLower(line)
+		if line == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		paraphrases = append(paraphrases, line)
+		if len(paraphrases) == count {
+			break
+		}
+	}
+	return paraphrases
+}
+
+// paraphraseQuestion asks the target for the paraphrases of a question. The first target
+// paraphrases the questions for all of them, so that the models answer the same questions.
+func (w *Worker) paraphraseQuestion(ctx context.Context, client *http.Client, target precheckTarget, question string) ([]string, *chatResult, error) {
+	result, err := w.cachedChatCompletion(ctx, client, target, paraphraseMessages(question, w.paraphrases))
+	if err != nil {
+		return nil, nil, err
+	}
+	paraphrases := parseParaphrases(question, result.Answer, w.paraphrases)
+	if len(paraphrases) == 0 {
+		return nil, result, fmt.Errorf("the model returned no paraphrase of the question")
+	}
+	return paraphrases, result, nil
+}
+
+// paraphrasedPrompts paraphrases the question of a seed example and renders the prompts of
+// the paraphrases, with the context and the system prompt of the question
+func (w *Worker) paraphrasedPrompts(ctx context.Context, client *http.Client, target precheckTarget, kind string, data promptData, usage *jobUsage) ([]string, [][]chatMessage, error) {
+	paraphrases, result, err := w.paraphraseQuestion(ctx, client, target, data.Question)
+	if result != nil {
+		usage.add(target.label(), result.Usage, result.Cached)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	prompts := make([][]chatMessage, 0, len(paraphrases))
+	for _, paraphrase := range paraphrases {
+		data.Question = paraphrase
+		messages, err := precheckPrompts.render(kind, data)
+		if err != nil {
+			return nil, nil, err
+		}
+		prompts = append(prompts, w.genParams.applySystemPrompt(messages))
+	}
+	return paraphrases, prompts, nil
+}
+
+// consistency is the mean similarity of the answers to the paraphrases with the answer to the
+// question, false when no paraphrase was answered
+func (r precheckSummaryRow) consistency() (float64, bool) {
+	if len(r.Paraphrases) == 0 {
+		return 0, false
+	}
+	total := 0.0
+	for _, p := range r.Paraphrases {
+		total += p.Score
+	}
+	return total / float64(len(r.Paraphrases)), true
+}
+
+// inconsistent tells whether the answers changed with the wording of the question
+func (r precheckSummaryRow) inconsistent() bool {
+	consistency, ok := r.consistency()
+	return ok && consistency < consistencyThreshold
+}
+
+// paraphraseMarkdownSummary reports the consistency of the answers across the paraphrases of
+// the questions, "" when none were paraphrased
+func paraphraseMarkdownSummary(rows []precheckSummaryRow) string {
+	var table strings.Builder
+	asked, inconsistent := 0, 0
+	for i, row := range rows {
+		consistency, ok := row.consistency()
+		if !ok {
+			continue
+		}
+		asked++
+		verdict := "✅ consistent"
+		if row.inconsistent() {
+			inconsistent++
+			verdict = "🔀 inconsistent"
+		}
+		fmt.Fprintf(&table, "| %d | %s | %d | %.2f | %s |\n", i+1,
+			markdownCell(row.Question, summaryQuestionLength),
+			len(row.Paraphrases), consistency, verdict)
+	}
+	if asked == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("\n#### Answers to paraphrased questions\n\n")
+	b.WriteString("The questions were asked again in other words, and the answers compared with the answer to the original question. Answers changing with the wording hint at knowledge the model does not hold firmly.")
+	if inconsistent > 0 {
+		fmt.Fprintf(&b, " **%d of %d questions got inconsistent answers.**", inconsistent, asked)
+	}
+	b.WriteString("\n\n| # | Question | Paraphrases | Consistency | Verdict |\n")
+	b.WriteString("|---|----------|-------------|-------------|---------|\n")
+	b.WriteString(table.String())
+	return b.String()
+}
@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestParseParaphrases verify list markers, duplicates and the question itself are dropped.
+func TestParseParaphrases(t *testing.T) {
+	answer := "1. Which team won?\n2) who won?\n\n- Which side was victorious?\n* Which team won?\nWho came out on top?"
+	assert.Equal(t, []string{"Which team won?", "Which side was victorious?"}, parseParaphrases("Who won?", answer, 2))
+	assert.Equal(t, []string{"Which team won?", "Which side was victorious?", "Who came out on top?"}, parseParaphrases("Who won?", answer, 5))
+	assert.Empty(t, parseParaphrases("Who won?", "Who won?\n", 3))
+}
+
+// TestParaphraseMarkdownSummary verify answers changing with the wording of the question are flagged.
+func TestParaphraseMarkdownSummary(t *testing.T) {
+	rows := []precheckSummaryRow{
+		{File: "knowledge/history/qna.yaml", Question: "Who won?", Answer: "The home team",
+			Paraphrases: []paraphraseAnswer{{Question: "Which team won?", Answer: "The home team", Score: 1}, {Question: "Who was victorious?", Answer: "The home team did", Score: 0.8}}},
+		{File: "knowledge/history/qna.yaml", Question: "When?", Answer: "In 1990",
+			Paraphrases: []paraphraseAnswer{{Question: "In which year?", Answer: "I don't know", Score: 0.1}}},
+		{File: "knowledge/history/qna.yaml", Question: "Where?", Answer: "In Paris"},
+	}
+	assert.Empty(t, paraphraseMarkdownSummary(rows[2:]))
+	assert.Empty(t, rows[2].flag())
+
+	summary := paraphraseMarkdownSummary(rows)
+	assert.Contains(t, summary, "**1 of 2 questions got inconsistent answers.**")
+	assert.Contains(t, summary, "| 1 | Who won? | 2 | 0.90 | ✅ consistent |")
+	assert.Contains(t, summary, "| 2 | When? | 1 | 0.10 | 🔀 inconsistent |")
+	assert.NotContains(t, summary, "Where?")
+
+	summary = precheckMarkdownSummary(rows, nil)
+	assert.Contains(t, summary, "| - | 🔀 inconsistent |")
+	assert.Contains(t, summary, "**Paraphrase (similarity 0.10):**\n\n> In which year?\n\n> I don't know")
+}
@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/instructlab/instructlab-bot/pkg/jobqueue"
+)
+
+const pipelineParamsFilename = "pipeline.json"
+
+// pipelineParams select the `ilab generate` pipeline of generate-local jobs. Unset values
+// are left to the ilab defaults.
+type pipelineParams struct {
+	Pipeline       string `json:"pipeline,omitempty"`
+	SdgScaleFactor int    `json:"sdg_scale_factor,omitempty"`
+	ChunkWordCount int    `json:"chunk_word_count,omitempty"`
+}
+
+// defaultPipelineParams returns the pipeline parameters set on the worker
+func defaultPipelineParams() pipelineParams {
+	return pipelineParams{
+		Pipeline:       GeneratePipeline,
+		SdgScaleFactor: GenerateSdgScaleFactor,
+		ChunkWordCount: GenerateChunkWordCount,
+	}
+}
+
+// validate rejects pipelines ilab does not know and non positive sizes
+func (p pipelineParams) validate() error {
+	switch p.Pipeline {
+	case "", "simple", "full":
+	default:
+		return fmt.Errorf("invalid pipeline %q, it must be simple or full", p.Pipeline)
+	}
+	if p.SdgScaleFactor < 0 {
+		return fmt.Errorf("invalid sdg_scale_factor %d, it must be a positive integer", p.SdgScaleFactor)
+	}
+	if p.ChunkWordCount < 0 {
+		return fmt.Errorf("invalid chunk_word_count %d, it must be a positive integer", p.ChunkWordCount)
+	}
+	return nil
+}
+
+// args returns the `ilab generate` arguments for the parameters that are set
+func (p pipelineParams) args() []string {
+	var args []string
+	if p.Pipeline != "" {
+		args = append(args, "--pipeline", p.Pipeline)
+	}
+	if p.SdgScaleFactor > 0 {
+		args = append(args, "--sdg-scale-factor", strconv.Itoa(p.SdgScaleFactor))
+	}
+	if p.ChunkWordCount > 0 {
+		args = append(args, "--chunk-word-count", strconv.Itoa(p.ChunkWordCount))
+	}
+	return args
+}
+
+// loadPipelineParams applies the per-job overrides stored on the job to the worker defaults
+func (w *Worker) loadPipelineParams() (pipelineParams, error) {
+	params := defaultPipelineParams()
+
+	get := func(field jobqueue.Field) (string, error) {
+		return w.jobField(field)
+	}
+
+	value, err := get(jobqueue.FieldPipeline)
+	if err != nil {
+		return params, err
+	}
+	if value != "" {
+		params.Pipeline = value
+	}
+
+	if value, err = get(jobqueue.FieldSdgScaleFactor); err != nil {
+		return params, err
+	}
+	if value != "" {
+		if params.SdgScaleFactor, err = strconv.Atoi(value); err != nil || params.SdgScaleFactor <= 0 {
+			return params, fmt.Errorf("invalid sdg_scale_factor %q, it must be a positive integer", value)
+		}
+	}
+
+	if value, err = get(jobqueue.FieldChunkWordCount); err != nil {
+		return params, err
+	}
+	if value != "" {
+		if params.ChunkWordCount, err = strconv.Atoi(value); err != nil || params.ChunkWordCount <= 0 {
+			return params, fmt.Errorf("invalid chunk_word_count %q, it must be a positive integer", value)
+		}
+	}
+	return params, params.validate()
+}
+
+// loadNumInstructions returns the number of instructions of the generate jobs, the worker
+// default unless the job overrides it
+func (w *Worker) loadNumInstructions() (int, error) {
+	value, err := w.jobField(jobqueue.FieldNumInstructions)
+	if err != nil {
+		return 0, err
+	}
+	if value == "" {
+		return NumInstructions, nil
+	}
+	numInstructions, err := strconv.Atoi(value)
+	if err != nil || numInstructions <= 0 {
+		return 0, fmt.Errorf("invalid num_instructions %q, it must be a positive integer", value)
+	}
+	return numInstructions, nil
+}
+
+// recordPipelineParams writes the pipeline parameters of a generate-local job into the output
+// directory and the job metadata
+func (w *Worker) recordPipelineParams(outputDir string, params pipelineParams) error {
+	paramsJSON, err := json.MarshalIndent(params, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not marshal pipeline parameters: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(outputDir, pipelineParamsFilename), paramsJSON, 0644); err != nil {
+		return fmt.Errorf("could not write pipeline parameters: %w", err)
+	}
+	if w.queue == nil {
+		return nil
+	}
+
+	if err := w.setJobField(jobqueue.FieldPipelineParams, paramsJSON); err != nil {
+		return fmt.Errorf("could not set pipeline parameters for job %s: %w", w.job, err)
+	}
+	return nil
+}
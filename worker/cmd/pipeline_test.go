@@ -0,0 +1,24 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestPipelineParamsArgs verify only the parameters that are set are passed to ilab.
+func TestPipelineParamsArgs(t *testing.T) {
+	assert.Empty(t, pipelineParams{}.args())
+
+	params := pipelineParams{Pipeline: "full", SdgScaleFactor: 30, ChunkWordCount: 800}
+	assert.Equal(t, []string{"--pipeline", "full", "--sdg-scale-factor", "30", "--chunk-word-count", "800"}, params.args())
+}
+
+// TestPipelineParamsValidate verify unknown pipelines and negative sizes are rejected.
+func TestPipelineParamsValidate(t *testing.T) {
+	assert.NoError(t, pipelineParams{}.validate())
+	assert.NoError(t, pipelineParams{Pipeline: "simple", SdgScaleFactor: 1, ChunkWordCount: 1}.validate())
+	assert.ErrorContains(t, pipelineParams{Pipeline: "large"}.validate(), "invalid pipeline")
+	assert.ErrorContains(t, pipelineParams{SdgScaleFactor: -1}.validate(), "invalid sdg_scale_factor")
+	assert.ErrorContains(t, pipelineParams{ChunkWordCount: -1}.validate(), "invalid chunk_word_count")
+}
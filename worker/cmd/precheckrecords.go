@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const precheckRecordsFilename = "precheck_results.jsonl"
+
+// precheckRecord is an answered precheck question in precheck_results.jsonl, a line per question
+// and model for the analytics over the prechecks of many PRs. The field names are stable: fields
+// are added, never renamed or removed.
+type precheckRecord struct {
+	JobID string `json:"job_id"`
+	Model string `json:"model,omitempty"`
+	File  string `json:"file"`
+	// SeedIndex is the position of the seed example in the file, from 0
+	SeedIndex    int               `json:"seed_index"`
+	TaxonomyType string            `json:"taxonomy_type"`
+	Question     string            `json:"question"`
+	Context      string            `json:"context,omitempty"`
+	Reference    string            `json:"reference,omitempty"`
+	ModelAnswer  string            `json:"model_answer"`
+	FinishReason string            `json:"finish_reason"`
+	Scores       *similarityScores `json:"scores,omitempty"`
+	LatencyMs    int64             `json:"latency_ms"`
+	Tokens       chatUsage         `json:"tokens"`
+	Cached       bool              `json:"cached"`
+	Prompt       string            `json:"prompt_template"`
+}
+
+// writePrecheckRecords writes the records of the answered questions into the output directory
+func writePrecheckRecords(outputDir string, records []precheckRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+	file, err := os.Create(filepath.Join(outputDir, precheckRecordsFilename))
+	if err != nil {
+		return fmt.Errorf("could not create %s: %w", precheckRecordsFilename, err)
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	encoder.SetEscapeHTML(false)
+	for _, record := range records {
+		if err := encoder.Encode(record); err != nil {
+			return fmt.Errorf("could not write %s: %w", precheckRecordsFilename, err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("could not write %s: %w", precheckRecordsFilename, err)
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestWritePrecheckRecords verify a record is written per line with the stable field names.
+func TestWritePrecheckRecords(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, writePrecheckRecords(dir, nil))
+	assert.NoFileExists(t, filepath.Join(dir, precheckRecordsFilename))
+
+	scores := similarityScores{RougeL: 0.5, BLEU: 0.25}
+	records := []precheckRecord{
+		{JobID: "7", File: "knowledge/a/qna.yaml", SeedIndex: 2, TaxonomyType: taxonomyTypeKnowledge, Question: "<Who> won?", Reference: "The home team",
+			ModelAnswer: "The home team", FinishReason: "stop", Scores: &scores, LatencyMs: 120, Tokens: chatUsage{PromptTokens: 10, CompletionTokens: 3, TotalTokens: 13}, Prompt: "default"},
+		{JobID: "7", Model: "granite", File: "compositional_skills/b/qna.yaml", TaxonomyType: taxonomyTypeSkill, Question: "Write a haiku", ModelAnswer: "Leaves fall", FinishReason: "stop", Cached: true, Prompt: "default"},
+	}
+	assert.NoError(t, writePrecheckRecords(dir, records))
+
+	content, err := os.ReadFile(filepath.Join(dir, precheckRecordsFilename))
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+	assert.Len(t, lines, 2)
+	assert.Equal(t, `{"job_id":"7","file":"knowledge/a/qna.yaml","seed_index":2,"taxonomy_type":"knowledge","question":"<Who> won?","reference":"The home team",`+
+		`"model_answer":"The home team","finish_reason":"stop","scores":{"rouge_l":0.5,"bleu":0.25},"latency_ms":120,`+
+		`"tokens":{"prompt_tokens":10,"completion_tokens":3,"total_tokens":13},"cached":false,"prompt_template":"default"}`, lines[0])
+	assert.Contains(t, lines[1], `"model":"granite"`)
+	assert.NotContains(t, lines[1], `"scores"`)
+}
@@ -0,0 +1,19 @@
+//go:build !windows
+
+package cmd
+
+import (
+	"os"
+	"syscall"
+)
+
+// shutdownSignals stop the worker once its current job is done
+var shutdownSignals = []os.Signal{syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGINT}
+
+// venvBinDir is the directory of a virtual environment holding its executables
+const venvBinDir = "bin"
+
+// stopProcess asks the process to exit
+func stopProcess(p *os.Process) error {
+	return p.Signal(syscall.SIGTERM)
+}
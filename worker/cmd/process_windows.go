@@ -0,0 +1,20 @@
+//go:build windows
+
+package cmd
+
+import (
+	"os"
+	"syscall"
+)
+
+// shutdownSignals stop the worker once its current job is done. Go delivers Ctrl+C and
+// Ctrl+Break as os.Interrupt, and closing the console or ending the session as SIGTERM.
+var shutdownSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+// venvBinDir is the directory of a virtual environment holding its executables
+const venvBinDir = "Scripts"
+
+// stopProcess ends the process, Windows can't ask a process without a console to exit
+func stopProcess(p *os.Process) error {
+	return p.Kill()
+}
@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/instructlab/instructlab-bot/pkg/jobqueue"
+	"gopkg.in/yaml.v2"
+)
+
+// jobProgress is the partial progress of a job, published to `jobs:<id>:progress`
+type jobProgress struct {
+	Done           int    `json:"done"`
+	Total          int    `json:"total"`
+	Skipped        int    `json:"skipped"`
+	LatestFile     string `json:"latest_file,omitempty"`
+	LatestQuestion string `json:"latest_question,omitempty"`
+	UpdatedAt      int64  `json:"updated_at"`
+}
+
+// countSeedExamples counts the seed examples of the taxonomy files, unreadable files count as none
+func countSeedExamples(taxonomyDir string, files []string) int {
+	total := 0
+	for _, file := range files {
+		content, err := os.ReadFile(filepath.Join(taxonomyDir, file))
+		if err != nil {
+			continue
+		}
+		var data struct {
+			SeedExamples []interface{} `yaml:"seed_examples"`
+		}
+		if err := yaml.Unmarshal(content, &data); err != nil {
+			continue
+		}
+		total += len(data.SeedExamples)
+	}
+	return total
+}
+
+// jobHeartbeatInterval is how often a running job publishes its progress again, so that the bot
+// does not take a long job without progress updates for one whose worker stopped
+var jobHeartbeatInterval = time.Minute
+
+// setJobProgress publishes the progress of the job so the bot and API can report partial results
+func (w *Worker) setJobProgress(progress jobProgress) {
+	if w.queue == nil && w.control == nil {
+		return
+	}
+	w.progressMu.Lock()
+	defer w.progressMu.Unlock()
+	progress.UpdatedAt = time.Now().Unix()
+	progress.LatestQuestion = truncateString(progress.LatestQuestion, summaryQuestionLength)
+	w.progress = progress
+	progressJSON, err := json.Marshal(progress)
+	if err != nil {
+		w.logger.Errorf("Could not marshal job progress: %v", err)
+		return
+	}
+
+	if w.control != nil {
+		if err := w.sendControlPlaneProgress(progressJSON); err != nil {
+			w.logger.Errorf("Could not send job progress to the control plane: %v", err)
+		}
+		return
+	}
+	if err := w.queue.Set(w.ctx, w.job, jobqueue.FieldProgress, progressJSON); err != nil {
+		w.logger.Errorf("Could not set job progress: %v", err)
+	}
+}
+
+// startHeartbeat publishes the last progress of the job every jobHeartbeatInterval, refreshing
+// its updated_at heartbeat whatever the job type, until the returned stop is called
+func (w *Worker) startHeartbeat() (stop func()) {
+	ctx, cancel := context.WithCancel(w.ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(jobHeartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				w.progressMu.Lock()
+				progress := w.progress
+				w.progressMu.Unlock()
+				w.setJobProgress(progress)
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
@@ -0,0 +1,20 @@
+package cmd
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestCountSeedExamples verify the progress total counts the seed examples of every changed file.
+func TestCountSeedExamples(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.MkdirAll(path.Join(dir, "knowledge", "a"), 0755))
+	assert.NoError(t, os.WriteFile(path.Join(dir, "knowledge", "a", "qna.yaml"),
+		[]byte("seed_examples:\n  - question: one\n  - question: two\n  - question: three\n"), 0644))
+	assert.NoError(t, os.WriteFile(path.Join(dir, "knowledge", "a", "broken.yaml"), []byte("seed_examples: [\n"), 0644))
+
+	assert.Equal(t, 3, countSeedExamples(dir, []string{"knowledge/a/qna.yaml", "knowledge/a/broken.yaml", "knowledge/missing.yaml"}))
+}
@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+const (
+	defaultPromptTemplateVersion = "default"
+	defaultUserPromptTemplate    = "{{ .Question }}{{ if .Context }} " + ctxPrompt + " {{ .Context }}.{{ end }}"
+	taxonomyTypeKnowledge        = "knowledge"
+	taxonomyTypeSkill            = "skill"
+)
+
+// promptTemplateSpec is the raw system and user templates for one taxonomy type
+type promptTemplateSpec struct {
+	System string `yaml:"system"`
+	User   string `yaml:"user"`
+}
+
+// promptTemplateConfig is the `prompt_templates` section of the worker config file
+type promptTemplateConfig struct {
+	Version   string             `yaml:"version"`
+	Skill     promptTemplateSpec `yaml:"skill"`
+	Knowledge promptTemplateSpec `yaml:"knowledge"`
+}
+
+// promptData is the data available to the prompt templates
+type promptData struct {
+	Question        string
+	Context         string
+	TaskDescription string
+	TaxonomyPath    string
+}
+
+type compiledPrompt struct {
+	system *template.Template
+	user   *template.Template
+}
+
+// promptTemplates holds the parsed precheck prompt templates for skills and knowledge
+type promptTemplates struct {
+	Version   string
+	skill     compiledPrompt
+	knowledge compiledPrompt
+}
+
+// precheckPrompts are the templates used to build the precheck questions, replaced at
+// startup by the templates of the worker config file when present
+var precheckPrompts = mustDefaultPromptTemplates()
+
+func mustDefaultPromptTemplates() *promptTemplates {
+	p, err := newPromptTemplates(promptTemplateConfig{})
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// loadPromptTemplates reads the prompt templates from the worker config file. The defaults,
+// which match the `ilab chat` prompts, are used for anything not set in the file.
+func loadPromptTemplates(configPath string) (*promptTemplates, error) {
+	cfg, err := readWorkerConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+	return newPromptTemplates(cfg.PromptTemplates)
+}
+
+func newPromptTemplates(cfg promptTemplateConfig) (*promptTemplates, error) {
+	p := &promptTemplates{Version: cfg.Version}
+	if p.Version == "" {
+		p.Version = defaultPromptTemplateVersion
+	}
+
+	var err error
+	if p.skill, err = compilePrompt(taxonomyTypeSkill, cfg.Skill); err != nil {
+		return nil, err
+	}
+	if p.knowledge, err = compilePrompt(taxonomyTypeKnowledge, cfg.Knowledge); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func compilePrompt(name string, spec promptTemplateSpec) (compiledPrompt, error) {
+	if spec.System == "" {
+		spec.System = defaultSystemPrompt
+	}
+	if spec.User == "" {
+		spec.User = defaultUserPromptTemplate
+	}
+
+	system, err := template.New(name + "-system").Option("missingkey=error").Parse(spec.System)
+	if err != nil {
+		return compiledPrompt{}, fmt.Errorf("invalid %s system prompt template: %w", name, err)
+	}
+	user, err := template.New(name + "-user").Option("missingkey=error").Parse(spec.User)
+	if err != nil {
+		return compiledPrompt{}, fmt.Errorf("invalid %s user prompt template: %w", name, err)
+	}
+	return compiledPrompt{system: system, user: user}, nil
+}
+
+// taxonomyType returns whether a taxonomy file is a knowledge or a skill contribution
+func taxonomyType(file string) string {
+	if parsed, ok := parseTaxonomyPath("", file); ok {
+		return parsed.Kind
+	}
+	return taxonomyTypeSkill
+}
+
+// render builds the chat messages for a question of the given taxonomy type
+func (p *promptTemplates) render(kind string, data promptData) ([]chatMessage, error) {
+	prompt := p.skill
+	if kind == taxonomyTypeKnowledge {
+		prompt = p.knowledge
+	}
+
+	var system, user bytes.Buffer
+	if err := prompt.system.Execute(&system, data); err != nil {
+		return nil, fmt.Errorf("could not render system prompt: %w", err)
+	}
+	if err := prompt.user.Execute(&user, data); err != nil {
+		return nil, fmt.Errorf("could not render user prompt: %w", err)
+	}
+
+	var messages []chatMessage
+	if s := strings.TrimSpace(system.String()); s != "" {
+		messages = append(messages, chatMessage{Role: "system", Content: s})
+	}
+	return append(messages, chatMessage{Role: "user", Content: strings.TrimSpace(user.String())}), nil
+}
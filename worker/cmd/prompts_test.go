@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestDefaultPromptTemplates verify the default templates match the ilab chat prompt format.
+func TestDefaultPromptTemplates(t *testing.T) {
+	p, err := loadPromptTemplates("")
+	assert.NoError(t, err)
+	assert.Equal(t, defaultPromptTemplateVersion, p.Version)
+
+	messages, err := p.render(taxonomyTypeKnowledge, promptData{Question: "Who won?", Context: "The home team won"})
+	assert.NoError(t, err)
+	assert.Equal(t, []chatMessage{
+		{Role: "system", Content: defaultSystemPrompt},
+		{Role: "user", Content: "Who won? " + ctxPrompt + " The home team won."},
+	}, messages)
+
+	messages, err = p.render(taxonomyTypeSkill, promptData{Question: "Write a haiku"})
+	assert.NoError(t, err)
+	assert.Equal(t, "Write a haiku", messages[1].Content)
+}
+
+// TestLoadPromptTemplates verify templates are read from the worker config file per taxonomy type.
+func TestLoadPromptTemplates(t *testing.T) {
+	configPath := path.Join(t.TempDir(), "instructlab-worker.yaml")
+	config := `precheck-endpoint-url: http://localhost:8000/v1
+prompt_templates:
+  version: v2
+  knowledge:
+    system: "Only answer from the context."
+    user: "Context: {{ .Context }}\nQuestion: {{ .Question }}"
+  skill:
+    system: ""
+    user: "{{ .TaskDescription }}: {{ .Question }}"
+`
+	assert.NoError(t, os.WriteFile(configPath, []byte(config), 0644))
+
+	p, err := loadPromptTemplates(configPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "v2", p.Version)
+
+	messages, err := p.render(taxonomyType("knowledge/history/qna.yaml"), promptData{Question: "Who won?", Context: "The home team"})
+	assert.NoError(t, err)
+	assert.Equal(t, []chatMessage{
+		{Role: "system", Content: "Only answer from the context."},
+		{Role: "user", Content: "Context: The home team\nQuestion: Who won?"},
+	}, messages)
+
+	messages, err = p.render(taxonomyType("compositional_skills/poetry/qna.yaml"), promptData{Question: "Write a haiku", TaskDescription: "poems"})
+	assert.NoError(t, err)
+	assert.Equal(t, defaultSystemPrompt, messages[0].Content, "an empty system template falls back to the default")
+	assert.Equal(t, "poems: Write a haiku", messages[1].Content)
+
+	assert.NoError(t, os.WriteFile(configPath, []byte("prompt_templates:\n  skill:\n    user: \"{{ .Question\"\n"), 0644))
+	_, err = loadPromptTemplates(configPath)
+	assert.Error(t, err, "invalid templates should fail to load")
+}
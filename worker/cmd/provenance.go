@@ -0,0 +1,375 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	// provenanceFilename is the signed provenance of the job, uploaded with its results
+	provenanceFilename = "provenance.intoto.jsonl"
+	// provenancePayloadType is the DSSE payload type of in-toto statements
+	provenancePayloadType = "application/vnd.in-toto+json"
+	intotoStatementType   = "https://in-toto.io/Statement/v1"
+	slsaProvenanceType    = "https://slsa.dev/provenance/v1"
+	// provenanceBuildType names the way the worker produces the results of a job
+	provenanceBuildType = "https://github.com/instructlab/instructlab-bot/worker/job@v1"
+)
+
+var (
+	ProvenanceSigningKey string
+	ProvenanceKeyID      string
+	ProvenancePublicKey  string
+	ProvenanceDir        string
+)
+
+// provenanceSigner signs the provenance of the jobs, nil when --provenance-signing-key is unset
+var provenanceSigner *dsseSigner
+
+func init() {
+	verifyProvenanceCmd.Flags().StringVarP(&ProvenancePublicKey, "public-key", "", "", "PEM public key the provenance is signed with")
+	verifyProvenanceCmd.Flags().StringVarP(&ProvenanceDir, "dir", "", "", "Directory holding the downloaded results, checked against the digests of the provenance")
+	_ = verifyProvenanceCmd.MarkFlagRequired("public-key")
+	rootCmd.AddCommand(verifyProvenanceCmd)
+}
+
+var verifyProvenanceCmd = &cobra.Command{
+	Use:   "verify-provenance <provenance.intoto.jsonl>",
+	Short: "Verify the signature of the provenance of a job, and the digests of its results with --dir.",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		publicKey, err := readPublicKey(ProvenancePublicKey)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(args[0])
+		if err != nil {
+			return err
+		}
+		statement, err := verifyProvenance(bytes.TrimSpace(data), publicKey)
+		if err != nil {
+			return err
+		}
+		if ProvenanceDir != "" {
+			if err := verifyProvenanceSubjects(statement, ProvenanceDir); err != nil {
+				return err
+			}
+		}
+		source := statement.Predicate.BuildDefinition.ExternalParameters
+		fmt.Fprintf(cmd.OutOrStdout(), "Verified job %s of %s at %s, %d files\n",
+			statement.Predicate.RunDetails.Metadata.InvocationID, source.Repository, source.Commit, len(statement.Subject))
+		return nil
+	},
+}
+
+// jobSource is what the results of a job were produced from
+type jobSource struct {
+	Repository string `json:"repository,omitempty"`
+	GitRemote  string `json:"git_remote,omitempty"`
+	PR         string `json:"pr,omitempty"`
+	Branch     string `json:"branch,omitempty"`
+	Commit     string `json:"commit"`
+	JobType    string `json:"job_type"`
+}
+
+// provenanceParameters are the settings of the worker that shaped the results of a job
+type provenanceParameters struct {
+	Model            string           `json:"model,omitempty"`
+	Models           []string         `json:"models,omitempty"`
+	NumInstructions  int              `json:"num_instructions,omitempty"`
+	GenerationParams generationParams `json:"generation_params"`
+	PipelineParams   pipelineParams   `json:"pipeline_params"`
+}
+
+type provenanceDigest map[string]string
+
+type provenanceSubject struct {
+	Name   string           `json:"name"`
+	Digest provenanceDigest `json:"digest"`
+}
+
+type provenanceDependency struct {
+	URI    string           `json:"uri"`
+	Digest provenanceDigest `json:"digest"`
+}
+
+// provenanceStatement is an in-toto statement with a SLSA provenance predicate
+type provenanceStatement struct {
+	Type          string              `json:"_type"`
+	Subject       []provenanceSubject `json:"subject"`
+	PredicateType string              `json:"predicateType"`
+	Predicate     struct {
+		BuildDefinition struct {
+			BuildType            string                 `json:"buildType"`
+			ExternalParameters   jobSource              `json:"externalParameters"`
+			InternalParameters   provenanceParameters   `json:"internalParameters"`
+			ResolvedDependencies []provenanceDependency `json:"resolvedDependencies"`
+		} `json:"buildDefinition"`
+		RunDetails struct {
+			Builder struct {
+				ID      string            `json:"id"`
+				Version map[string]string `json:"version"`
+			} `json:"builder"`
+			Metadata struct {
+				InvocationID string    `json:"invocationId"`
+				StartedOn    time.Time `json:"startedOn"`
+				FinishedOn   time.Time `json:"finishedOn"`
+			} `json:"metadata"`
+		} `json:"runDetails"`
+	} `json:"predicate"`
+}
+
+// dsseEnvelope is a signed payload in the Dead Simple Signing Envelope format
+type dsseEnvelope struct {
+	PayloadType string          `json:"payloadType"`
+	Payload     string          `json:"payload"`
+	Signatures  []dsseSignature `json:"signatures"`
+}
+
+type dsseSignature struct {
+	KeyID string `json:"keyid"`
+	Sig   string `json:"sig"`
+}
+
+// dsseSigner signs DSSE envelopes with an Ed25519, ECDSA or RSA key
+type dsseSigner struct {
+	key   crypto.Signer
+	keyID string
+}
+
+// loadProvenanceSigner reads the PKCS #8 or EC private key at path. The key ID defaults to the
+// SHA-256 of the public key.
+func loadProvenanceSigner(path, keyID string) (*dsseSigner, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s is not a PEM file", path)
+	}
+	var key interface{}
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not parse the private key of %s: %w", path, err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%s holds a key that can't sign", path)
+	}
+	if keyID == "" {
+		der, err := x509.MarshalPKIXPublicKey(signer.Public())
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(der)
+		keyID = "SHA256:" + hex.EncodeToString(sum[:])
+	}
+	return &dsseSigner{key: signer, keyID: keyID}, nil
+}
+
+// dssePAE is the pre-authentication encoding of a DSSE payload, the message that is signed
+func dssePAE(payloadType string, payload []byte) []byte {
+	return []byte(fmt.Sprintf("DSSEv1 %d %s %d %s", len(payloadType), payloadType, len(payload), payload))
+}
+
+func (s *dsseSigner) sign(payloadType string, payload []byte) (dsseEnvelope, error) {
+	message := dssePAE(payloadType, payload)
+	var sig []byte
+	var err error
+	if _, ok := s.key.(ed25519.PrivateKey); ok {
+		sig, err = s.key.Sign(rand.Reader, message, crypto.Hash(0))
+	} else {
+		digest := sha256.Sum256(message)
+		sig, err = s.key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	}
+	if err != nil {
+		return dsseEnvelope{}, fmt.Errorf("could not sign the provenance: %w", err)
+	}
+	return dsseEnvelope{
+		PayloadType: payloadType,
+		Payload:     base64.StdEncoding.EncodeToString(payload),
+		Signatures:  []dsseSignature{{KeyID: s.keyID, Sig: base64.StdEncoding.EncodeToString(sig)}},
+	}, nil
+}
+
+// readPublicKey reads a PEM PKIX public key
+func readPublicKey(path string) (crypto.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s is not a PEM file", path)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse the public key of %s: %w", path, err)
+	}
+	return key, nil
+}
+
+// verifyDSSESignature checks sig is a signature of message by publicKey
+func verifyDSSESignature(publicKey crypto.PublicKey, message, sig []byte) bool {
+	digest := sha256.Sum256(message)
+	switch key := publicKey.(type) {
+	case ed25519.PublicKey:
+		return ed25519.Verify(key, message, sig)
+	case *ecdsa.PublicKey:
+		return ecdsa.VerifyASN1(key, digest[:], sig)
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig) == nil
+	}
+	return false
+}
+
+// verifyProvenance checks the envelope is signed by publicKey and returns its statement
+func verifyProvenance(data []byte, publicKey crypto.PublicKey) (provenanceStatement, error) {
+	var statement provenanceStatement
+	var envelope dsseEnvelope
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return statement, fmt.Errorf("invalid provenance envelope: %w", err)
+	}
+	if envelope.PayloadType != provenancePayloadType {
+		return statement, fmt.Errorf("unexpected payload type %q", envelope.PayloadType)
+	}
+	payload, err := base64.StdEncoding.DecodeString(envelope.Payload)
+	if err != nil {
+		return statement, fmt.Errorf("invalid provenance payload: %w", err)
+	}
+	verified := false
+	for _, signature := range envelope.Signatures {
+		sig, err := base64.StdEncoding.DecodeString(signature.Sig)
+		if err == nil && verifyDSSESignature(publicKey, dssePAE(envelope.PayloadType, payload), sig) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return statement, errors.New("the provenance is not signed by the public key")
+	}
+	if err := json.Unmarshal(payload, &statement); err != nil {
+		return statement, fmt.Errorf("invalid provenance statement: %w", err)
+	}
+	if statement.Type != intotoStatementType || statement.PredicateType != slsaProvenanceType {
+		return statement, fmt.Errorf("unexpected statement %s with predicate %s", statement.Type, statement.PredicateType)
+	}
+	return statement, nil
+}
+
+// verifyProvenanceSubjects checks the files of dir have the digests of the statement
+func verifyProvenanceSubjects(statement provenanceStatement, dir string) error {
+	for _, subject := range statement.Subject {
+		digest, err := fileSHA256(filepath.Join(dir, filepath.FromSlash(subject.Name)))
+		if err != nil {
+			return err
+		}
+		if digest != subject.Digest["sha256"] {
+			return fmt.Errorf("%s has the SHA-256 %s, the provenance records %s", subject.Name, digest, subject.Digest["sha256"])
+		}
+	}
+	return nil
+}
+
+// fileSHA256 returns the hex SHA-256 of the file at path
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	sum, err := sha256Sum(f)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(sum), nil
+}
+
+// provenanceStatement returns the provenance of the files of the job in outputDir
+func (w *Worker) provenanceStatement(outputDir string, files []string, finished time.Time) (provenanceStatement, error) {
+	var statement provenanceStatement
+	statement.Type = intotoStatementType
+	statement.PredicateType = slsaProvenanceType
+	sorted := append([]string{}, files...)
+	sort.Strings(sorted)
+	for _, name := range sorted {
+		digest, err := fileSHA256(filepath.Join(outputDir, name))
+		if err != nil {
+			return statement, fmt.Errorf("could not hash %s: %w", name, err)
+		}
+		statement.Subject = append(statement.Subject, provenanceSubject{Name: name, Digest: provenanceDigest{"sha256": digest}})
+	}
+
+	build := &statement.Predicate.BuildDefinition
+	build.BuildType = provenanceBuildType
+	build.ExternalParameters = w.source
+	build.InternalParameters = provenanceParameters{
+		Model:            w.modelName,
+		Models:           w.models,
+		NumInstructions:  w.numInstructions,
+		GenerationParams: w.genParams,
+		PipelineParams:   w.pipelineParams,
+	}
+	build.ResolvedDependencies = []provenanceDependency{{
+		URI:    "git+" + w.gitRemote,
+		Digest: provenanceDigest{"gitCommit": w.source.Commit},
+	}}
+
+	run := &statement.Predicate.RunDetails
+	run.Builder.ID = provenanceBuildType + "#" + workerName()
+	run.Builder.Version = map[string]string{"worker": Version}
+	if w.ilabVersion != (ilabVersion{}) {
+		run.Builder.Version["ilab"] = w.ilabVersion.String()
+	}
+	run.Metadata.InvocationID = w.job
+	run.Metadata.StartedOn = w.jobStart.UTC()
+	run.Metadata.FinishedOn = finished.UTC()
+	return statement, nil
+}
+
+// writeProvenance signs the provenance of the files of the job and writes it to outputDir
+func (w *Worker) writeProvenance(outputDir string, files []string) error {
+	statement, err := w.provenanceStatement(outputDir, files, time.Now())
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(statement)
+	if err != nil {
+		return fmt.Errorf("could not marshal the provenance: %w", err)
+	}
+	envelope, err := provenanceSigner.sign(provenancePayloadType, payload)
+	if err != nil {
+		return err
+	}
+	line, err := json.Marshal(envelope)
+	if err != nil {
+		return fmt.Errorf("could not marshal the provenance envelope: %w", err)
+	}
+	return os.WriteFile(filepath.Join(outputDir, provenanceFilename), append(line, '\n'), 0644)
+}
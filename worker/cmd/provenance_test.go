@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestKeys writes the PKCS #8 private key and the public key of key in dir
+func writeTestKeys(t *testing.T, dir string, key interface{}, public interface{}) (string, string) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	privatePath := filepath.Join(dir, "provenance.key")
+	require.NoError(t, os.WriteFile(privatePath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600))
+	der, err = x509.MarshalPKIXPublicKey(public)
+	require.NoError(t, err)
+	publicPath := filepath.Join(dir, "provenance.pub")
+	require.NoError(t, os.WriteFile(publicPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0644))
+	return privatePath, publicPath
+}
+
+// TestProvenanceSignVerify verify the provenance signed by Ed25519 and ECDSA keys verifies with the public key only.
+func TestProvenanceSignVerify(t *testing.T) {
+	dir := t.TempDir()
+	edPublic, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	ecPrivate, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	for name, keys := range map[string][2]interface{}{
+		"ed25519": {edPrivate, edPublic},
+		"ecdsa":   {ecPrivate, &ecPrivate.PublicKey},
+	} {
+		t.Run(name, func(t *testing.T) {
+			privatePath, publicPath := writeTestKeys(t, t.TempDir(), keys[0], keys[1])
+			signer, err := loadProvenanceSigner(privatePath, "")
+			require.NoError(t, err)
+			assert.Contains(t, signer.keyID, "SHA256:")
+
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "generated.jsonl"), []byte("{}\n"), 0644))
+			w := &Worker{
+				job:       "7",
+				jobStart:  time.Now(),
+				gitRemote: "https://github.com/org/taxonomy",
+				modelName: "granite",
+				source:    jobSource{Repository: "org/taxonomy", PR: "12", Commit: "abc1234", JobType: jobGenerateLocal},
+			}
+			provenanceSigner = signer
+			defer func() { provenanceSigner = nil }()
+			require.NoError(t, w.writeProvenance(dir, []string{"generated.jsonl"}))
+
+			publicKey, err := readPublicKey(publicPath)
+			require.NoError(t, err)
+			data, err := os.ReadFile(filepath.Join(dir, provenanceFilename))
+			require.NoError(t, err)
+			statement, err := verifyProvenance(data, publicKey)
+			require.NoError(t, err)
+			assert.Equal(t, "7", statement.Predicate.RunDetails.Metadata.InvocationID)
+			assert.Equal(t, "org/taxonomy", statement.Predicate.BuildDefinition.ExternalParameters.Repository)
+			assert.Equal(t, "granite", statement.Predicate.BuildDefinition.InternalParameters.Model)
+			assert.Equal(t, "abc1234", statement.Predicate.BuildDefinition.ResolvedDependencies[0].Digest["gitCommit"])
+			require.Len(t, statement.Subject, 1)
+			assert.Equal(t, "generated.jsonl", statement.Subject[0].Name)
+			assert.NoError(t, verifyProvenanceSubjects(statement, dir))
+
+			// A dataset changed after the job no longer matches
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "generated.jsonl"), []byte("{\"x\":1}\n"), 0644))
+			assert.Error(t, verifyProvenanceSubjects(statement, dir))
+		})
+	}
+}
+
+// TestVerifyProvenanceTampered verify a changed payload or another key fails the verification.
+func TestVerifyProvenanceTampered(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	otherPublic, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer := &dsseSigner{key: private, keyID: "test"}
+
+	payload, err := json.Marshal(provenanceStatement{Type: intotoStatementType, PredicateType: slsaProvenanceType})
+	require.NoError(t, err)
+	envelope, err := signer.sign(provenancePayloadType, payload)
+	require.NoError(t, err)
+	data, err := json.Marshal(envelope)
+	require.NoError(t, err)
+
+	_, err = verifyProvenance(data, public)
+	assert.NoError(t, err)
+	_, err = verifyProvenance(data, otherPublic)
+	assert.Error(t, err)
+
+	envelope.Payload = base64.StdEncoding.EncodeToString(append(payload, ' '))
+	data, err = json.Marshal(envelope)
+	require.NoError(t, err)
+	_, err = verifyProvenance(data, public)
+	assert.Error(t, err)
+
+	assert.Equal(t, "DSSEv1 29 http://example.com/HelloWorld 11 hello world", string(dssePAE("http://example.com/HelloWorld", []byte("hello world"))))
+}
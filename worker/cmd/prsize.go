@@ -0,0 +1,171 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The actions of a precheck job when its PR is over --precheck-max-files or --precheck-max-questions
+const (
+	// prSizeSample asks a sample of the questions and says so in the summary
+	prSizeSample = "sample"
+	// prSizeReject fails the job and asks the contributor to split the PR
+	prSizeReject = "reject"
+)
+
+// validatePRSizeAction checks the --precheck-oversize-action flag
+func validatePRSizeAction(action string) error {
+	switch action {
+	case prSizeSample, prSizeReject:
+		return nil
+	}
+	return fmt.Errorf("unknown precheck oversize action %q, expected %s or %s", action, prSizeSample, prSizeReject)
+}
+
+// precheckSample is the part of a PR over the precheck limits that a precheck job checks
+type precheckSample struct {
+	MaxFiles       int `json:"max_files,omitempty"`
+	MaxQuestions   int `json:"max_questions,omitempty"`
+	TotalFiles     int `json:"total_files"`
+	TotalQuestions int `json:"total_questions"`
+	// Files are the checked files, in the order of the diff
+	Files []taxonomyFile `json:"-"`
+	// Questions is the number of seed questions asked per checked file
+	Questions    map[string]int `json:"questions"`
+	DroppedFiles []string       `json:"dropped_files,omitempty"`
+}
+
+// samplePrecheck keeps the first maxFiles files and spreads maxQuestions questions evenly over
+// them, counts being the number of seed questions of every file. It returns nil when the PR is
+// within the limits, a limit of 0 being no limit.
+func samplePrecheck(files []taxonomyFile, counts []int, maxFiles, maxQuestions int) *precheckSample {
+	total := 0
+	for _, count := range counts {
+		total += count
+	}
+	overFiles := maxFiles > 0 && len(files) > maxFiles
+	overQuestions := maxQuestions > 0 && total > maxQuestions
+	if !overFiles && !overQuestions {
+		return nil
+	}
+
+	sample := &precheckSample{
+		MaxFiles:       maxFiles,
+		MaxQuestions:   maxQuestions,
+		TotalFiles:     len(files),
+		TotalQuestions: total,
+		Questions:      make(map[string]int),
+	}
+	kept := len(files)
+	if overFiles {
+		kept = maxFiles
+	}
+	quotas := append([]int(nil), counts[:kept]...)
+	if maxQuestions > 0 {
+		quotas = questionQuotas(quotas, maxQuestions)
+	}
+	for i, file := range files {
+		if i >= kept || (quotas[i] == 0 && counts[i] > 0) {
+			sample.DroppedFiles = append(sample.DroppedFiles, file.Path)
+			continue
+		}
+		sample.Files = append(sample.Files, file)
+		sample.Questions[file.Path] = quotas[i]
+	}
+	return sample
+}
+
+// questionQuotas hands out max questions one per file in turn, so that the small files are
+// checked in full and the large ones share what is left
+func questionQuotas(counts []int, max int) []int {
+	quotas := make([]int, len(counts))
+	for left := max; left > 0; {
+		handed := false
+		for i, count := range counts {
+			if left > 0 && quotas[i] < count {
+				quotas[i]++
+				left--
+				handed = true
+			}
+		}
+		if !handed {
+			break
+		}
+	}
+	return quotas
+}
+
+// checked is the number of seed questions the sample asks
+func (s *precheckSample) checked() int {
+	checked := 0
+	for _, count := range s.Questions {
+		checked += count
+	}
+	return checked
+}
+
+// limits describes the limits the PR is over
+func (s *precheckSample) limits() string {
+	var limits []string
+	if s.MaxFiles > 0 && s.TotalFiles > s.MaxFiles {
+		limits = append(limits, fmt.Sprintf("%d files", s.MaxFiles))
+	}
+	if s.MaxQuestions > 0 && s.TotalQuestions > s.MaxQuestions {
+		limits = append(limits, fmt.Sprintf("%d questions", s.MaxQuestions))
+	}
+	return strings.Join(limits, " and ")
+}
+
+// rejection is the error failing a precheck job when oversized PRs are rejected
+func (s *precheckSample) rejection() error {
+	return categorize(errorPRTooLarge, fmt.Errorf("the PR changes %d taxonomy files with %d seed questions, more than the %s a precheck job checks. Split the PR into smaller ones so that each can be checked in full",
+		s.TotalFiles, s.TotalQuestions, s.limits()))
+}
+
+// notice tells the reviewers of the summary which part of the PR was checked, "" for a PR
+// checked in full
+func (s *precheckSample) notice() string {
+	if s == nil {
+		return ""
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "> ⚠️ **Partial precheck:** this PR changes %d taxonomy files with %d seed questions, more than the %s a precheck job checks. Only %d questions of %d files were asked.",
+		s.TotalFiles, s.TotalQuestions, s.limits(), s.checked(), len(s.Files))
+	if len(s.DroppedFiles) > 0 {
+		sb.WriteString(" These files were not checked:\n>\n")
+		for _, file := range s.DroppedFiles {
+			fmt.Fprintf(&sb, "> - `%s`\n", file)
+		}
+		sb.WriteString(">\n>")
+	}
+	sb.WriteString(" Consider splitting the PR into smaller ones so that every question is checked.\n\n")
+	return sb.String()
+}
+
+// sampledSeedExamples keeps max of the seed examples of a file, an example of every context in turn
+func sampledSeedExamples(examples []interface{}, max int) []interface{} {
+	var kept []interface{}
+	for _, i := range sampleSeedExamples(examples, max, seedSampleStratified, 0) {
+		kept = append(kept, examples[i])
+	}
+	return kept
+}
+
+// limitPrecheck applies the precheck limits to the changed files. It returns the files to check
+// and the sample taken, nil when the PR is within the limits, or the rejection of the PR.
+func (w *Worker) limitPrecheck(files []taxonomyFile) ([]taxonomyFile, *precheckSample, error) {
+	counts := make([]int, len(files))
+	for i, file := range files {
+		counts[i] = countSeedExamples(w.taxonomyDir, []string{file.Path})
+	}
+	sample := samplePrecheck(files, counts, PrecheckMaxFiles, PrecheckMaxQuestions)
+	if sample == nil {
+		return files, nil, nil
+	}
+	if PrecheckOversizeAction == prSizeReject {
+		return nil, nil, sample.rejection()
+	}
+	w.logger.Warnf("The PR is over the precheck limits of %s, checking %d of its %d questions in %d of its %d files",
+		sample.limits(), sample.checked(), sample.TotalQuestions, len(sample.Files), sample.TotalFiles)
+	return sample.Files, sample, nil
+}
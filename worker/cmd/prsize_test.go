@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func skillFiles(paths ...string) []taxonomyFile {
+	var files []taxonomyFile
+	for _, path := range paths {
+		files = append(files, taxonomyFile{Path: path, Folder: "compositional_skills", Kind: taxonomyTypeSkill})
+	}
+	return files
+}
+
+// TestSamplePrecheck verify a PR within the limits is checked in full, and the questions of an
+// oversized one are spread over its first files.
+func TestSamplePrecheck(t *testing.T) {
+	files := skillFiles("a/qna.yaml", "b/qna.yaml", "c/qna.yaml")
+
+	assert.Nil(t, samplePrecheck(files, []int{5, 5, 5}, 3, 15))
+	assert.Nil(t, samplePrecheck(files, []int{50, 50, 50}, 0, 0), "0 disables the limits")
+
+	sample := samplePrecheck(files, []int{2, 10, 10}, 0, 12)
+	assert.Equal(t, map[string]int{"a/qna.yaml": 2, "b/qna.yaml": 5, "c/qna.yaml": 5}, sample.Questions)
+	assert.Equal(t, 12, sample.checked())
+	assert.Empty(t, sample.DroppedFiles)
+	assert.Equal(t, "12 questions", sample.limits())
+
+	sample = samplePrecheck(files, []int{2, 10, 10}, 2, 0)
+	assert.Equal(t, map[string]int{"a/qna.yaml": 2, "b/qna.yaml": 10}, sample.Questions)
+	assert.Equal(t, []string{"c/qna.yaml"}, sample.DroppedFiles)
+	assert.Len(t, sample.Files, 2)
+
+	sample = samplePrecheck(files, []int{4, 4, 4}, 0, 2)
+	assert.Equal(t, []string{"c/qna.yaml"}, sample.DroppedFiles, "files left without questions are not checked")
+	assert.Equal(t, 2, sample.checked())
+}
+
+// TestPrecheckSampleNotice verify the notice names the limits and the files left out, and a PR
+// checked in full has none.
+func TestPrecheckSampleNotice(t *testing.T) {
+	var sample *precheckSample
+	assert.Empty(t, sample.notice())
+
+	sample = samplePrecheck(skillFiles("a/qna.yaml", "b/qna.yaml"), []int{30, 30}, 1, 20)
+	notice := sample.notice()
+	assert.Contains(t, notice, "2 taxonomy files with 60 seed questions, more than the 1 files and 20 questions")
+	assert.Contains(t, notice, "Only 20 questions of 1 files were asked")
+	assert.Contains(t, notice, "> - `b/qna.yaml`")
+
+	err := sample.rejection()
+	assert.Equal(t, errorPRTooLarge, errorCategoryOf(err))
+	assert.Contains(t, err.Error(), "Split the PR")
+
+	assert.NoError(t, validatePRSizeAction(prSizeReject))
+	assert.Error(t, validatePRSizeAction("skip"))
+}
+
+// TestSampledSeedExamples verify the questions asked of a sampled file cover its contexts.
+func TestSampledSeedExamples(t *testing.T) {
+	examples := seedExamples("x", "x", "y", "y")
+	kept := sampledSeedExamples(examples, 2)
+	assert.Equal(t, []interface{}{examples[0], examples[2]}, kept)
+}
@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// The policies of --precheck-answer-truncation for the answers over --precheck-max-answer-length
+const (
+	// answerLengthTruncate cuts the answer at the limit
+	answerLengthTruncate = "truncate"
+	// answerLengthFlag keeps the whole answer and flags it in the summary
+	answerLengthFlag = "flag"
+)
+
+// timeoutMarker starts the reason of the questions without an answer within --precheck-question-timeout
+const timeoutMarker = "TIMEOUT"
+
+// validateAnswerTruncation checks the --precheck-answer-truncation flag
+func validateAnswerTruncation(policy string) error {
+	switch policy {
+	case answerLengthTruncate, answerLengthFlag:
+		return nil
+	}
+	return fmt.Errorf("unknown precheck answer truncation %q, expected %s or %s", policy, answerLengthTruncate, answerLengthFlag)
+}
+
+// questionTimeoutError is a precheck question that got no answer within --precheck-question-timeout,
+// its retries and failovers included
+type questionTimeoutError struct {
+	timeout time.Duration
+}
+
+func (e *questionTimeoutError) Error() string {
+	return fmt.Sprintf("%s: no answer within %s", timeoutMarker, e.timeout)
+}
+
+// askQuestion asks a precheck question, giving up after --precheck-question-timeout so that one
+// pathological prompt cannot stall the job, and applies the answer length policy
+func (w *Worker) askQuestion(client *http.Client, target precheckTarget, messages []chatMessage) (*chatResult, error) {
+	ctx := w.ctx
+	if PrecheckQuestionTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(w.ctx, PrecheckQuestionTimeout)
+		defer cancel()
+	}
+	result, err := w.cachedChatCompletion(ctx, client, target, messages)
+	if err != nil {
+		// The job itself being cancelled is not the question timing out
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) && w.ctx.Err() == nil {
+			return nil, &questionTimeoutError{timeout: PrecheckQuestionTimeout}
+		}
+		return nil, err
+	}
+	return limitAnswerLength(result, PrecheckMaxAnswerLength, PrecheckAnswerTruncation), nil
+}
+
+// limitAnswerLength applies the truncation policy to an answer over maxLength characters. The
+// cached answer is left whole, the limit applies to the answers of the job only.
+func limitAnswerLength(result *chatResult, maxLength int, policy string) *chatResult {
+	if maxLength <= 0 || len([]rune(result.Answer)) <= maxLength {
+		return result
+	}
+	limited := *result
+	limited.TooLong = true
+	limited.Warnings = append(append([]string(nil), result.Warnings...), fmt.Sprintf("the answer is over the %d characters limit", maxLength))
+	if policy == answerLengthTruncate {
+		limited.Answer = truncateString(result.Answer, maxLength)
+		limited.Warnings[len(limited.Warnings)-1] = fmt.Sprintf("the answer was cut at the %d characters limit", maxLength)
+	}
+	return &limited
+}
+
+// isTimeout tells whether a precheck question was skipped because it timed out
+func isTimeout(err error) bool {
+	var timeout *questionTimeoutError
+	return errors.As(err, &timeout)
+}
@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// TestAskQuestionTimeout verify a question is given up after the question timeout, retries included.
+func TestAskQuestionTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer server.Close()
+
+	defer func(timeout time.Duration) { PrecheckQuestionTimeout = timeout }(PrecheckQuestionTimeout)
+	PrecheckQuestionTimeout = 100 * time.Millisecond
+	w := &Worker{ctx: context.Background(), logger: zap.NewNop().Sugar()}
+	target := precheckTarget{Endpoint: server.URL}
+
+	_, err := w.askQuestion(server.Client(), target, []chatMessage{{Role: "user", Content: "Who won?"}})
+	assert.True(t, isTimeout(err), "got %v", err)
+	assert.Equal(t, "TIMEOUT: no answer within 100ms", err.Error())
+}
+
+// TestLimitAnswerLength verify long answers are cut or flagged depending on the policy.
+func TestLimitAnswerLength(t *testing.T) {
+	result := &chatResult{Answer: strings.Repeat("é", 20), FinishReason: "stop", Warnings: []string{"request 1 failed"}}
+	assert.Same(t, result, limitAnswerLength(result, 0, answerLengthTruncate))
+	assert.Same(t, result, limitAnswerLength(result, 20, answerLengthTruncate))
+
+	cut := limitAnswerLength(result, 10, answerLengthTruncate)
+	assert.Equal(t, strings.Repeat("é", 9)+"…", cut.Answer)
+	assert.True(t, cut.TooLong)
+	assert.Equal(t, []string{"request 1 failed", "the answer was cut at the 10 characters limit"}, cut.Warnings)
+	assert.Equal(t, []string{"request 1 failed"}, result.Warnings, "the cached answer should be left whole")
+
+	flagged := limitAnswerLength(result, 10, answerLengthFlag)
+	assert.Equal(t, result.Answer, flagged.Answer)
+	assert.Equal(t, "📏 too long", precheckSummaryRow{Answer: flagged.Answer, TooLong: flagged.TooLong}.flag())
+
+	assert.NoError(t, validateAnswerTruncation(answerLengthFlag))
+	assert.Error(t, validateAnswerTruncation("drop"))
+}
+
+// TestSkippedTimeout verify timed out questions are marked in the summary.
+func TestSkippedTimeout(t *testing.T) {
+	skipped := []skippedQuestion{{File: "knowledge/a/qna.yaml", Question: "Who won?", Reason: (&questionTimeoutError{timeout: time.Minute}).Error(), Timeout: true}}
+	summary := precheckMarkdownSummary(nil, skipped)
+	assert.Contains(t, summary, "- `knowledge/a/qna.yaml`: Who won? — **`TIMEOUT`** no answer within 1m0s")
+}
@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	redactedPlaceholder = "[REDACTED]"
+	// minSecretLength keeps short values, which would mask unrelated text, out of the redaction
+	minSecretLength = 4
+)
+
+// defaultRedactEnv are the variables whose values are always masked, redact_env adds to them
+var defaultRedactEnv = []string{"AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN", "GITHUB_TOKEN", "GH_TOKEN", "HF_TOKEN"}
+
+// urlCredentialsPattern matches the user and password of URLs such as git remotes
+var urlCredentialsPattern = regexp.MustCompile(`(?i)\b([a-z][a-z0-9+.-]*://)[^/\s:@]+:[^/\s@]+@`)
+
+// redactor masks the secret values of the worker
+type redactor struct {
+	replacer *strings.Replacer
+}
+
+// newRedactor masks the secrets, the longest first so a secret containing another one is masked whole
+func newRedactor(secrets []string) *redactor {
+	var values []string
+	for _, secret := range secrets {
+		if len(secret) >= minSecretLength {
+			values = append(values, secret)
+		}
+	}
+	sort.Slice(values, func(i, j int) bool { return len(values[i]) > len(values[j]) })
+	var oldnew []string
+	for _, value := range values {
+		oldnew = append(oldnew, value, redactedPlaceholder)
+	}
+	return &redactor{replacer: strings.NewReplacer(oldnew...)}
+}
+
+// secretRedactor masks the secrets in the logs, the job metadata and the artifacts. It is set
+// once the flags and the worker config are read.
+var secretRedactor = newRedactor(nil)
+
+// workerSecrets returns the secrets of the flags, the worker config and the environment
+func workerSecrets(cfg *workerConfig) []string {
+	secrets := []string{GithubToken, PrecheckAPIKey, EmbeddingsAPIKey, SdgToken}
+	for _, model := range cfg.PrecheckModels {
+		secrets = append(secrets, model.APIKey)
+	}
+	for _, name := range append(append([]string{}, defaultRedactEnv...), cfg.RedactEnv...) {
+		secrets = append(secrets, os.Getenv(name))
+	}
+	return secrets
+}
+
+func (r *redactor) redact(s string) string {
+	return urlCredentialsPattern.ReplaceAllString(r.replacer.Replace(s), "${1}"+redactedPlaceholder+"@")
+}
+
+// redactFile masks the secrets in the file at path, it is only rewritten when it holds one
+func (r *redactor) redactFile(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	redacted := []byte(r.redact(string(content)))
+	if bytes.Equal(content, redacted) {
+		return nil
+	}
+	return os.WriteFile(path, redacted, 0644)
+}
+
+// redactingCore masks the secrets in the messages and the string and error fields of the
+// entries of a zap core
+type redactingCore struct {
+	zapcore.Core
+}
+
+func (c redactingCore) With(fields []zapcore.Field) zapcore.Core {
+	return redactingCore{Core: c.Core.With(redactFields(fields))}
+}
+
+func (c redactingCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+	return checked
+}
+
+func (c redactingCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	entry.Message = secretRedactor.redact(entry.Message)
+	return c.Core.Write(entry, redactFields(fields))
+}
+
+func redactFields(fields []zapcore.Field) []zapcore.Field {
+	redacted := make([]zapcore.Field, len(fields))
+	for i, field := range fields {
+		switch field.Type {
+		case zapcore.StringType:
+			field.String = secretRedactor.redact(field.String)
+		case zapcore.ErrorType:
+			if err, ok := field.Interface.(error); ok && err != nil {
+				field = zapcore.Field{Key: field.Key, Type: zapcore.StringType, String: secretRedactor.redact(err.Error())}
+			}
+		case zapcore.StringerType:
+			if stringer, ok := field.Interface.(interface{ String() string }); ok && stringer != nil {
+				field = zapcore.Field{Key: field.Key, Type: zapcore.StringType, String: secretRedactor.redact(stringer.String())}
+			}
+		}
+		redacted[i] = field
+	}
+	return redacted
+}
@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"context"
+	"time"
+
+	"github.com/instructlab/instructlab-bot/pkg/jobqueue"
+	"go.uber.org/zap"
+)
+
+const (
+	// redisDialTimeout bounds connecting to Redis and each command, none of the worker commands block
+	redisDialTimeout = 10 * time.Second
+	// redisRetryBackoff is the first delay before reconnecting to Redis, doubled on every failure
+	redisRetryBackoff = time.Second
+)
+
+// newRedisClient returns the job queue client of the worker. Connections idle for longer than
+// RedisIdleTimeout are closed and at most RedisMaxActive are open at once.
+func newRedisClient() *jobqueue.Client {
+	return jobqueue.New(jobqueue.Options{
+		Addr:        RedisHost,
+		PoolSize:    RedisMaxActive,
+		IdleTimeout: RedisIdleTimeout,
+		Timeout:     redisDialTimeout,
+	})
+}
+
+// queueBackoff slows down the polling of the job queue while Redis is unreachable, so an outage
+// logs an error every backoff rather than every second. It also pauses the polling during a
+// maintenance.
+type queueBackoff struct {
+	failures int
+	down     time.Time
+	retryAt  time.Time
+	// maintenance is set while a maintenance pauses the polling
+	maintenance bool
+}
+
+// ready reports whether the queue can be polled again
+func (b *queueBackoff) ready(now time.Time) bool {
+	return !now.Before(b.retryAt)
+}
+
+// fail records a failed poll and returns the delay before the next one
+func (b *queueBackoff) fail(now time.Time) time.Duration {
+	if b.failures == 0 {
+		b.down = now
+	}
+	b.failures++
+	delay := backoffDelay(redisRetryBackoff, b.failures)
+	b.retryAt = now.Add(delay)
+	return delay
+}
+
+// succeed records a successful poll and returns how long Redis was unreachable, 0 when it was not
+func (b *queueBackoff) succeed(now time.Time) time.Duration {
+	if b.failures == 0 {
+		return 0
+	}
+	outage := now.Sub(b.down)
+	*b = queueBackoff{maintenance: b.maintenance}
+	return outage
+}
+
+// popJob pops the next job of the queue, "" when there is none, Redis is backing off or a
+// maintenance is in progress
+func (b *queueBackoff) popJob(ctx context.Context, queue *jobqueue.Client, logger *zap.SugaredLogger) string {
+	now := time.Now()
+	if !b.ready(now) {
+		return ""
+	}
+	job := ""
+	maintenance, err := queue.Maintenance(ctx)
+	if err == nil && maintenance == nil {
+		job, err = queue.Dequeue(ctx)
+	}
+	if err != nil {
+		delay := b.fail(now)
+		logger.Errorf("Could not pop from redis queue, retrying in %s: %v", delay.Round(time.Second), err)
+		return ""
+	}
+	if outage := b.succeed(now); outage > 0 {
+		logger.Infof("Reconnected to redis after %s", outage.Round(time.Second))
+	}
+	if paused := maintenance != nil; paused != b.maintenance {
+		b.maintenance = paused
+		if paused {
+			logger.Infof("Not taking jobs during the maintenance. %s", maintenance.Notice())
+		} else {
+			logger.Info("The maintenance is over, taking jobs again")
+		}
+	}
+	return job
+}
+
+// withRedis runs fn, and runs it again, backing off, for up to RedisRetryTimeout while it fails
+// to reach Redis, so a Redis restart does not lose the results of a job. fn must be safe to repeat.
+func (w *Worker) withRedis(op string, fn func() error) {
+	deadline := time.Now().Add(RedisRetryTimeout)
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil {
+			if attempt > 1 {
+				w.logger.Infof("Reconnected to redis to %s", op)
+			}
+			return
+		}
+		if !jobqueue.IsConnectionError(err) {
+			w.logger.Errorf("Could not %s: %v", op, err)
+			return
+		}
+
+		delay := backoffDelay(redisRetryBackoff, attempt)
+		if time.Now().Add(delay).After(deadline) {
+			w.logger.Errorf("Could not %s, redis is unreachable: %v", op, err)
+			return
+		}
+		w.logger.Warnf("Lost the redis connection to %s, retrying in %s: %v", op, delay.Round(time.Second), err)
+		select {
+		case <-w.ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+	}
+}
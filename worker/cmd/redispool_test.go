@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/instructlab/instructlab-bot/pkg/jobqueue"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// fakeRedis answers every command with the reply, enough for RPOP and SET. The connections are
+// closed right away while down is set, like a Redis restarting.
+func fakeRedis(t *testing.T, reply string, down *atomic.Bool) (string, *atomic.Int32) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	t.Cleanup(func() { listener.Close() })
+	var commands atomic.Int32
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+				for {
+					// A command is an array of bulk strings, *<n> then $<len> and the value for each
+					header, err := reader.ReadString('\n')
+					if err != nil {
+						return
+					}
+					n, _ := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(header, "*")))
+					for i := 0; i < 2*n; i++ {
+						if _, err := reader.ReadString('\n'); err != nil {
+							return
+						}
+					}
+					commands.Add(1)
+					if down.Load() {
+						return
+					}
+					fmt.Fprint(conn, reply)
+				}
+			}(conn)
+		}
+	}()
+	return listener.Addr().String(), &commands
+}
+
+// TestQueueBackoff verify polling backs off while Redis is down and resumes once it is back.
+func TestQueueBackoff(t *testing.T) {
+	var down atomic.Bool
+	down.Store(true)
+	addr, commands := fakeRedis(t, "$-1\r\n", &down)
+	queue := jobqueue.New(jobqueue.Options{Addr: addr})
+	defer queue.Close()
+
+	var backoff queueBackoff
+	ctx := context.Background()
+	logger := zap.NewExample().Sugar()
+	assert.Equal(t, "", backoff.popJob(ctx, queue, logger))
+	polled := commands.Load()
+	assert.Greater(t, polled, int32(0))
+	assert.Equal(t, "", backoff.popJob(ctx, queue, logger))
+	assert.Equal(t, polled, commands.Load(), "no poll while backing off")
+	assert.False(t, backoff.ready(time.Now()))
+
+	delay := backoff.fail(time.Now())
+	assert.GreaterOrEqual(t, delay, 2*redisRetryBackoff, "the delay doubles on every failure")
+
+	down.Store(false)
+	backoff.retryAt = time.Now()
+	assert.Equal(t, "", backoff.popJob(ctx, queue, logger))
+	assert.Equal(t, queueBackoff{}, backoff, "a successful poll resets the backoff")
+}
+
+// TestQueueBackoffMaintenance verify no job is popped during a maintenance.
+func TestQueueBackoffMaintenance(t *testing.T) {
+	var down atomic.Bool
+	maintenance := `{"message":"model upgrade","started":"2026-10-16T20:00:00Z"}`
+	addr, commands := fakeRedis(t, fmt.Sprintf("$%d\r\n%s\r\n", len(maintenance), maintenance), &down)
+	queue := jobqueue.New(jobqueue.Options{Addr: addr})
+	defer queue.Close()
+
+	var backoff queueBackoff
+	assert.Equal(t, "", backoff.popJob(context.Background(), queue, zap.NewExample().Sugar()))
+	assert.Equal(t, int32(1), commands.Load(), "only the maintenance is read")
+	assert.True(t, backoff.maintenance)
+	assert.True(t, backoff.ready(time.Now()))
+}
+
+// TestWithRedis verify an operation is repeated while Redis is unreachable, and only then.
+func TestWithRedis(t *testing.T) {
+	saved := RedisRetryTimeout
+	defer func() { RedisRetryTimeout = saved }()
+	RedisRetryTimeout = 10 * time.Second
+
+	var down atomic.Bool
+	addr, _ := fakeRedis(t, "+OK\r\n", &down)
+	queue := jobqueue.New(jobqueue.Options{Addr: addr})
+	defer queue.Close()
+
+	w := NewJobProcessor(context.Background(), queue, nil, zap.NewExample().Sugar(), "job-id", "", "", "", "", "", 20)
+	calls := 0
+	w.withRedis("set the status", func() error {
+		calls++
+		// Redis comes back after the first attempt
+		down.Store(calls == 1)
+		return queue.Set(w.ctx, w.job, jobqueue.FieldStatus, jobqueue.StatusSuccess)
+	})
+	assert.Equal(t, 2, calls)
+
+	errAddr, _ := fakeRedis(t, "-ERR unknown command\r\n", &atomic.Bool{})
+	errQueue := jobqueue.New(jobqueue.Options{Addr: errAddr})
+	defer errQueue.Close()
+	calls = 0
+	w.withRedis("set the status", func() error {
+		calls++
+		return errQueue.Set(w.ctx, w.job, jobqueue.FieldStatus, jobqueue.StatusSuccess)
+	})
+	assert.Equal(t, 1, calls, "no retry of an error reply")
+
+	RedisRetryTimeout = 0
+	down.Store(true)
+	calls = 0
+	w.withRedis("set the status", func() error {
+		calls++
+		return queue.Set(w.ctx, w.job, jobqueue.FieldStatus, jobqueue.StatusSuccess)
+	})
+	assert.Equal(t, 1, calls, "no retry past the retry timeout")
+}
@@ -0,0 +1,209 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/instructlab/instructlab-bot/pkg/jobqueue"
+)
+
+// regressionMargin is how much the score of an answer has to change from the previous precheck
+// to count as improved or regressed
+const regressionMargin = 0.05
+
+// The changes of an answer since the previous precheck of the PR
+const (
+	changeNew       = "new"
+	changeImproved  = "improved"
+	changeRegressed = "regressed"
+	changeUnchanged = "unchanged"
+	// changeChanged is an answer that differs from the previous one, with no score to rank them
+	changeChanged = "changed"
+)
+
+// precheckHistoryEntry is the last answer of a model to a question of the PR
+type precheckHistoryEntry struct {
+	Question string   `json:"question"`
+	Answer   string   `json:"answer"`
+	Score    *float64 `json:"score,omitempty"`
+	Commit   string   `json:"commit,omitempty"`
+	JobID    string   `json:"job_id"`
+}
+
+// answerChange compares an answer with the answer of the previous precheck to the same question
+type answerChange struct {
+	Status         string
+	PreviousAnswer string
+	PreviousScore  *float64
+	PreviousCommit string
+}
+
+// precheckHistory holds the answers of the previous prechecks of a PR, keyed by a hash of the
+// file, the model and the question, and collects the answers of the running one
+type precheckHistory struct {
+	key      string
+	commit   string
+	previous map[string]precheckHistoryEntry
+	current  map[string]interface{}
+}
+
+// loadPrecheckHistory reads the answers of the previous prechecks of the PR. It returns nil when
+// the history is disabled or the job has no PR, a precheck then reports no changes.
+func (w *Worker) loadPrecheckHistory(repoOwner, repoName, prNumber, commit string) *precheckHistory {
+	if w.queue == nil || PrecheckHistoryTTL <= 0 || prNumber == "" {
+		return nil
+	}
+	h := &precheckHistory{
+		key:      jobqueue.PrecheckHistoryKey(repoOwner, repoName, prNumber),
+		commit:   commit,
+		previous: make(map[string]precheckHistoryEntry),
+		current:  make(map[string]interface{}),
+	}
+	entries, err := w.queue.Client.HGetAll(w.ctx, h.key).Result()
+	if err != nil {
+		w.logger.Warnf("Could not read the previous precheck answers: %v", err)
+		return h
+	}
+	for hash, value := range entries {
+		var entry precheckHistoryEntry
+		if err := json.Unmarshal([]byte(value), &entry); err != nil {
+			w.logger.Warnf("Ignoring unreadable previous precheck answer %s: %v", hash, err)
+			continue
+		}
+		h.previous[hash] = entry
+	}
+	return h
+}
+
+// questionHash identifies a question of the PR across its commits
+func questionHash(file, model, question string) string {
+	hash := sha256.New()
+	hash.Write([]byte(file))
+	hash.Write([]byte{0})
+	hash.Write([]byte(model))
+	hash.Write([]byte{0})
+	hash.Write([]byte(strings.TrimSpace(question)))
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// record compares the answer with the previous one to the question and keeps it for the next
+// precheck. It returns nil on the first precheck of the PR, which has nothing to compare with.
+func (h *precheckHistory) record(jobID string, row precheckSummaryRow) *answerChange {
+	if h == nil {
+		return nil
+	}
+	hash := questionHash(row.File, row.Model, row.Question)
+	entry := precheckHistoryEntry{Question: row.Question, Answer: row.Answer, Commit: h.commit, JobID: jobID}
+	if row.Scores != nil {
+		score := row.Scores.Score()
+		entry.Score = &score
+	}
+	if encoded, err := json.Marshal(entry); err == nil {
+		h.current[hash] = encoded
+	}
+
+	if len(h.previous) == 0 {
+		return nil
+	}
+	previous, ok := h.previous[hash]
+	if !ok {
+		return &answerChange{Status: changeNew}
+	}
+	change := &answerChange{PreviousAnswer: previous.Answer, PreviousScore: previous.Score, PreviousCommit: previous.Commit}
+	change.Status = compareWithPrevious(previous, entry)
+	return change
+}
+
+// compareWithPrevious ranks an answer against the previous one by their scores, or tells whether
+// it changed when they were not scored
+func compareWithPrevious(previous, current precheckHistoryEntry) string {
+	if previous.Score != nil && current.Score != nil {
+		switch delta := *current.Score - *previous.Score; {
+		case delta > regressionMargin:
+			return changeImproved
+		case delta < -regressionMargin:
+			return changeRegressed
+		}
+		return changeUnchanged
+	}
+	if strings.TrimSpace(previous.Answer) == strings.TrimSpace(current.Answer) {
+		return changeUnchanged
+	}
+	return changeChanged
+}
+
+// savePrecheckHistory stores the answers of the precheck for the next one, the questions it did
+// not ask keep their previous answers
+func (w *Worker) savePrecheckHistory(h *precheckHistory) error {
+	if h == nil || len(h.current) == 0 {
+		return nil
+	}
+	_, err := w.queue.Client.TxPipelined(w.ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(w.ctx, h.key, h.current)
+		pipe.Expire(w.ctx, h.key, PrecheckHistoryTTL)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("could not save the precheck answers: %w", err)
+	}
+	return nil
+}
+
+// label is the change shown in the summary table, with the scores when both answers have one
+func (c *answerChange) label(scores *similarityScores) string {
+	if c == nil {
+		return ""
+	}
+	icons := map[string]string{
+		changeNew:       "🆕",
+		changeImproved:  "📈",
+		changeRegressed: "📉",
+		changeUnchanged: "➖",
+		changeChanged:   "🔄",
+	}
+	label := icons[c.Status] + " " + c.Status
+	if c.PreviousScore != nil && scores != nil {
+		label += fmt.Sprintf(" (%.2f → %.2f)", *c.PreviousScore, scores.Score())
+	}
+	return label
+}
+
+// previousCommitLabel names the commit of a previous answer in its details
+func previousCommitLabel(commit string) string {
+	if commit == "" {
+		return ""
+	}
+	if len(commit) > 7 {
+		commit = commit[:7]
+	}
+	return " (" + commit + ")"
+}
+
+// changeSummary counts the changes of the answers since the previous prechecks of the PR, ""
+// when there were none to compare with
+func changeSummary(rows []precheckSummaryRow) string {
+	counts := make(map[string]int)
+	for _, row := range rows {
+		if row.Change != nil {
+			counts[row.Change.Status]++
+		}
+	}
+	if len(counts) == 0 {
+		return ""
+	}
+	var parts []string
+	for _, status := range []string{changeRegressed, changeImproved, changeChanged, changeUnchanged, changeNew} {
+		if counts[status] > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", counts[status], status))
+		}
+	}
+	summary := "Compared with the previous precheck of this PR: " + strings.Join(parts, ", ") + "."
+	if counts[changeRegressed] > 0 {
+		summary = "⚠️ " + summary + " Check the regressed answers marked 📉 below."
+	}
+	return summary + "\n\n"
+}
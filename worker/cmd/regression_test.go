@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestPrecheckHistoryRecord verify answers are compared with the previous precheck of the same question.
+func TestPrecheckHistoryRecord(t *testing.T) {
+	var disabled *precheckHistory
+	assert.Nil(t, disabled.record("1", precheckSummaryRow{Question: "Who won?"}))
+
+	first := &precheckHistory{commit: "aaaaaaaaaa", previous: map[string]precheckHistoryEntry{}, current: map[string]interface{}{}}
+	high := similarityScores{RougeL: 0.9}
+	assert.Nil(t, first.record("1", precheckSummaryRow{File: "knowledge/a/qna.yaml", Question: "Who won?", Answer: "The home team", Scores: &high}),
+		"the first precheck of a PR has nothing to compare with")
+	assert.Len(t, first.current, 1)
+
+	// The answers of the first precheck are the previous ones of the next
+	second := &precheckHistory{commit: "bbbbbbbbbb", previous: map[string]precheckHistoryEntry{}, current: map[string]interface{}{}}
+	for hash, encoded := range first.current {
+		var entry precheckHistoryEntry
+		assert.NoError(t, json.Unmarshal(encoded.([]byte), &entry))
+		second.previous[hash] = entry
+	}
+	low := similarityScores{RougeL: 0.2}
+	change := second.record("2", precheckSummaryRow{File: "knowledge/a/qna.yaml", Question: "Who won? ", Answer: "Nobody", Scores: &low})
+	assert.Equal(t, changeRegressed, change.Status)
+	assert.Equal(t, "The home team", change.PreviousAnswer)
+	assert.Equal(t, "aaaaaaaaaa", change.PreviousCommit)
+	assert.Equal(t, "📉 regressed (0.90 → 0.20)", change.label(&low))
+
+	assert.Equal(t, changeNew, second.record("2", precheckSummaryRow{File: "knowledge/a/qna.yaml", Question: "When?", Answer: "1990"}).Status)
+	assert.Equal(t, changeNew, second.record("2", precheckSummaryRow{File: "knowledge/a/qna.yaml", Model: "granite", Question: "Who won?"}).Status,
+		"the answers of another model are not compared")
+}
+
+// TestCompareWithPrevious verify answers are ranked by score, or by text when they were not scored.
+func TestCompareWithPrevious(t *testing.T) {
+	score := func(s float64) *float64 { return &s }
+	assert.Equal(t, changeImproved, compareWithPrevious(precheckHistoryEntry{Score: score(0.5)}, precheckHistoryEntry{Score: score(0.6)}))
+	assert.Equal(t, changeUnchanged, compareWithPrevious(precheckHistoryEntry{Score: score(0.5)}, precheckHistoryEntry{Score: score(0.52)}))
+	assert.Equal(t, changeRegressed, compareWithPrevious(precheckHistoryEntry{Score: score(0.5)}, precheckHistoryEntry{Score: score(0.4)}))
+	assert.Equal(t, changeUnchanged, compareWithPrevious(precheckHistoryEntry{Answer: "Paris"}, precheckHistoryEntry{Answer: "Paris\n"}))
+	assert.Equal(t, changeChanged, compareWithPrevious(precheckHistoryEntry{Answer: "Paris"}, precheckHistoryEntry{Answer: "Lyon"}))
+}
+
+// TestPrecheckMarkdownSummaryChanges verify the summary reports the changes since the previous precheck.
+func TestPrecheckMarkdownSummaryChanges(t *testing.T) {
+	rows := []precheckSummaryRow{{File: "knowledge/a/qna.yaml", Question: "Who won?", Answer: "The home team"}}
+	assert.NotContains(t, precheckMarkdownSummary(rows, nil), "Change")
+
+	previous, current := 0.9, similarityScores{RougeL: 0.2}
+	rows = []precheckSummaryRow{
+		{File: "knowledge/a/qna.yaml", Question: "Who won?", Answer: "Nobody", Scores: &current,
+			Change: &answerChange{Status: changeRegressed, PreviousAnswer: "The home team", PreviousScore: &previous, PreviousCommit: "aaaaaaaaaa"}},
+		{File: "knowledge/a/qna.yaml", Question: "When?", Answer: "1990", Change: &answerChange{Status: changeNew}},
+	}
+	summary := precheckMarkdownSummary(rows, nil)
+	assert.Contains(t, summary, "⚠️ Compared with the previous precheck of this PR: 1 regressed, 1 new.")
+	assert.Contains(t, summary, "| Flag | Change |")
+	assert.Contains(t, summary, "| 📉 regressed (0.90 → 0.20) |")
+	assert.Contains(t, summary, "| 🆕 new |")
+	assert.Contains(t, summary, "**Previous answer (aaaaaaa):**\n\n> The home team")
+}
@@ -0,0 +1,247 @@
+package cmd
+
+import (
+	"embed"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	reportIndexPage    = "index.html"
+	reportCombinedPage = "combined.html"
+	// reportAccessPage replaces the index of the jobs with encrypted artifacts
+	reportAccessPage = accessFilename
+	// reportAttachmentsPage shows the attribution and context files changed by a PR
+	reportAttachmentsPage = attachmentsFilename
+	// reportDashboardPage is the page of the dashboard command rather than of a job
+	reportDashboardPage = "dashboard.html"
+	reportLayout        = "layout.html"
+)
+
+// The artifact sections of the job index, in display order
+const (
+	sectionEncrypted = "Encrypted"
+	sectionData      = "Data"
+	sectionViewers   = "Viewers"
+	sectionLogs      = "Logs"
+	sectionOther     = "Other"
+)
+
+//go:embed reports/*.html
+var defaultReportTemplates embed.FS
+
+// reportConfig is the `report` section of the worker config file, it brands the job reports
+// and can replace their templates
+type reportConfig struct {
+	Title         string `yaml:"title"`
+	LogoURL       string `yaml:"logo_url"`
+	PrimaryColor  string `yaml:"primary_color"`
+	StylesheetURL string `yaml:"stylesheet_url"`
+	Footer        string `yaml:"footer"`
+	// TemplatesDir holds templates replacing the default ones of the same file name
+	TemplatesDir string `yaml:"templates_dir"`
+}
+
+// reportBranding is the branding of the reports, the defaults filled in
+type reportBranding struct {
+	Title         string
+	LogoURL       string
+	PrimaryColor  string
+	StylesheetURL string
+	Footer        string
+}
+
+// reportField is a line of the job metadata header
+type reportField struct {
+	Name  string
+	Value string
+}
+
+// reportFile is an artifact of a report, linked by the index and shown by the combined page
+type reportFile struct {
+	Name    string
+	URL     string
+	Content string
+	// Diff compares the answers of a precheck chat log
+	Diff *answerDiff
+}
+
+type reportSection struct {
+	Name  string
+	Files []reportFile
+}
+
+// reportData is the data available to the report templates
+type reportData struct {
+	Title    string
+	Branding reportBranding
+	Metadata []reportField
+	Sections []reportSection
+	// Dashboard is the data of the dashboard page
+	Dashboard *dashboardData
+	// Access is the data of the access page
+	Access *accessData
+	// Attachments are the data of the attachments page
+	Attachments []attachment
+}
+
+// reportFuncs are the functions available to the report templates
+var reportFuncs = template.FuncMap{
+	// hasDiff reports whether one of the files compares answers
+	"hasDiff": func(files []reportFile) bool {
+		for _, file := range files {
+			if file.Diff != nil {
+				return true
+			}
+		}
+		return false
+	},
+}
+
+// reportRenderer holds the parsed templates of every report page
+type reportRenderer struct {
+	branding reportBranding
+	pages    map[string]*template.Template
+}
+
+// reportTemplates render the job reports, replaced at startup by the templates and branding of
+// the worker config file when present
+var reportTemplates = mustDefaultReportRenderer()
+
+func mustDefaultReportRenderer() *reportRenderer {
+	r, err := newReportRenderer(reportConfig{})
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+func newReportRenderer(cfg reportConfig) (*reportRenderer, error) {
+	r := &reportRenderer{
+		branding: reportBranding{
+			Title:         cfg.Title,
+			LogoURL:       cfg.LogoURL,
+			PrimaryColor:  cfg.PrimaryColor,
+			StylesheetURL: cfg.StylesheetURL,
+			Footer:        cfg.Footer,
+		},
+		pages: make(map[string]*template.Template),
+	}
+	if r.branding.Title == "" {
+		r.branding.Title = "InstructLab Bot"
+	}
+	if r.branding.PrimaryColor == "" {
+		r.branding.PrimaryColor = "#007bff"
+	}
+
+	for _, page := range []string{reportIndexPage, reportCombinedPage, reportDashboardPage, reportAccessPage, reportAttachmentsPage} {
+		tmpl, err := template.New(page).Funcs(reportFuncs).ParseFS(defaultReportTemplates, "reports/"+reportLayout, "reports/"+page)
+		if err != nil {
+			return nil, fmt.Errorf("invalid default report template %s: %w", page, err)
+		}
+		if cfg.TemplatesDir != "" {
+			for _, name := range []string{reportLayout, page} {
+				path := filepath.Join(cfg.TemplatesDir, name)
+				if _, err := os.Stat(path); os.IsNotExist(err) {
+					continue
+				} else if err != nil {
+					return nil, fmt.Errorf("could not read report template %s: %w", path, err)
+				}
+				if tmpl, err = tmpl.ParseFiles(path); err != nil {
+					return nil, fmt.Errorf("invalid report template %s: %w", path, err)
+				}
+			}
+		}
+		// Catch the templates that only fail when executed, such as a missing field
+		if err := tmpl.Execute(io.Discard, r.sampleData()); err != nil {
+			return nil, fmt.Errorf("invalid report template %s: %w", page, err)
+		}
+		r.pages[page] = tmpl
+	}
+	return r, nil
+}
+
+func (r *reportRenderer) sampleData() reportData {
+	return reportData{
+		Title:    "Report",
+		Branding: r.branding,
+		Metadata: []reportField{{Name: "Job", Value: "1"}},
+		Sections: []reportSection{{Name: sectionLogs, Files: []reportFile{
+			{Name: "job.log", URL: "https://example.com/job.log", Content: "log"},
+			{Name: "chat.yaml", URL: "https://example.com/chat.yaml", Content: "output: blue", Diff: newAnswerDiff("Color?", "Sky", "model", "The sky is blue", "blue")},
+		}}},
+		Dashboard: sampleDashboard(),
+		Access:    &accessData{KeyID: "0a1b2c3d4e5f6a7b", KeyLocation: "the data team", Files: []string{"chat.log.enc"}},
+		Attachments: []attachment{
+			{Path: "knowledge/science/attribution.txt", Status: attachmentModified, Lines: []attachmentLine{{Op: "delete", Text: "Revision: 1\n"}, {Op: "insert", Text: "Revision: 2\n"}}},
+			{Path: "knowledge/science/context.md", Status: attachmentAdded, Omitted: "binary file"},
+		},
+	}
+}
+
+// render writes the page with the title, metadata and sections, in the branding of the renderer
+func (r *reportRenderer) render(out io.Writer, page, title string, metadata []reportField, sections []reportSection) error {
+	return r.pages[page].Execute(out, reportData{
+		Title:    title,
+		Branding: r.branding,
+		Metadata: metadata,
+		Sections: sections,
+	})
+}
+
+// artifactSection returns the section of the job index listing the artifact
+func artifactSection(name string) string {
+	switch {
+	case strings.HasSuffix(name, encryptedSuffix):
+		return sectionEncrypted
+	case strings.HasSuffix(name, ".html"):
+		return sectionViewers
+	case strings.HasSuffix(name, ".log"), name == jobLogFilename:
+		return sectionLogs
+	case strings.HasSuffix(name, ".json"), strings.HasSuffix(name, ".jsonl"), strings.HasSuffix(name, ".yaml"), strings.HasSuffix(name, ".yml"):
+		return sectionData
+	}
+	return sectionOther
+}
+
+// groupArtifacts splits the artifacts into the sections of the job index, the empty ones left out
+func groupArtifacts(files []reportFile) []reportSection {
+	var sections []reportSection
+	for _, name := range []string{sectionEncrypted, sectionData, sectionViewers, sectionLogs, sectionOther} {
+		section := reportSection{Name: name}
+		for _, file := range files {
+			if artifactSection(file.Name) == name {
+				section.Files = append(section.Files, file)
+			}
+		}
+		if len(section.Files) > 0 {
+			sections = append(sections, section)
+		}
+	}
+	return sections
+}
+
+// reportMetadata is the header of the reports of the job
+func (w *Worker) reportMetadata(prNumber string) []reportField {
+	fields := []reportField{{Name: "Job", Value: w.job}}
+	if w.jobType != "" {
+		fields = append(fields, reportField{Name: "Type", Value: w.jobType})
+	}
+	if w.branch != "" {
+		fields = append(fields, reportField{Name: "Branch", Value: w.branch})
+	} else if prNumber != "" {
+		fields = append(fields, reportField{Name: "Pull request", Value: prNumber})
+	}
+	if w.ilabVersion != (ilabVersion{}) {
+		fields = append(fields, reportField{Name: "ilab", Value: w.ilabVersion.String()})
+	}
+	if !w.jobStart.IsZero() {
+		fields = append(fields, reportField{Name: "Started", Value: w.jobStart.UTC().Format(time.RFC3339)})
+	}
+	return fields
+}
@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestReportBranding verify the branding of the config is applied and the values are escaped.
+func TestReportBranding(t *testing.T) {
+	r, err := newReportRenderer(reportConfig{
+		Title:         "Taxonomy Bot",
+		LogoURL:       "https://example.com/logo.png",
+		PrimaryColor:  "#cc0000",
+		StylesheetURL: "https://example.com/report.css",
+		Footer:        "Operated by <the team>",
+	})
+	assert.NoError(t, err)
+
+	var out bytes.Buffer
+	assert.NoError(t, r.render(&out, reportIndexPage, "Report", nil, nil))
+	html := out.String()
+	assert.Contains(t, html, `<p class="brand">Taxonomy Bot</p>`)
+	assert.Contains(t, html, `<img class="logo" src="https://example.com/logo.png" alt="">`)
+	assert.Contains(t, html, "--primary-color: #cc0000;")
+	assert.Contains(t, html, `<link rel="stylesheet" href="https://example.com/report.css">`)
+	assert.Contains(t, html, "<footer>Operated by &lt;the team&gt;</footer>")
+	assert.NotContains(t, html, `class="metadata"`)
+}
+
+// TestReportTemplatesDir verify templates of the templates directory replace the default ones they redefine.
+func TestReportTemplatesDir(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, reportLayout), []byte(`{{ define "footer" }}<footer>custom</footer>{{ end }}`), 0644))
+	r, err := newReportRenderer(reportConfig{TemplatesDir: dir})
+	assert.NoError(t, err)
+
+	var out bytes.Buffer
+	assert.NoError(t, r.render(&out, reportCombinedPage, "Precheck chat logs", nil, []reportSection{
+		{Name: sectionLogs, Files: []reportFile{{Name: "chat.yaml", Content: "answer: <b>yes</b>"}}},
+	}))
+	html := out.String()
+	assert.Contains(t, html, "<footer>custom</footer>")
+	assert.Contains(t, html, "<h3>chat.yaml</h3>")
+	assert.Contains(t, html, "<pre>answer: &lt;b&gt;yes&lt;/b&gt;</pre>")
+	assert.Contains(t, html, `<input id="filter"`)
+
+	// Templates failing to parse or to execute are rejected at startup
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, reportIndexPage), []byte(`{{ template "layout" . }}{{ define "content" }}{{ .Missing }}{{ end }}`), 0644))
+	_, err = newReportRenderer(reportConfig{TemplatesDir: dir})
+	assert.Error(t, err)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, reportIndexPage), []byte(`{{ template "layout" . `), 0644))
+	_, err = newReportRenderer(reportConfig{TemplatesDir: dir})
+	assert.Error(t, err)
+}
+
+// TestReportMetadata verify the header describes the job, its PR or branch and its ilab version.
+func TestReportMetadata(t *testing.T) {
+	w := &Worker{job: "7", jobType: jobPreCheck, ilabVersion: ilabVersion{Minor: 17, Raw: "ilab, version 0.17.0"}}
+	assert.Equal(t, []reportField{
+		{Name: "Job", Value: "7"},
+		{Name: "Type", Value: jobPreCheck},
+		{Name: "Pull request", Value: "12"},
+		{Name: "ilab", Value: "0.17.0"},
+	}, w.reportMetadata("12"))
+
+	w = &Worker{job: "8", branch: "main"}
+	assert.Equal(t, []reportField{{Name: "Job", Value: "8"}, {Name: "Branch", Value: "main"}}, w.reportMetadata(""))
+}
+
+// TestArtifactSection verify the artifacts are grouped by type.
+func TestArtifactSection(t *testing.T) {
+	assert.Equal(t, sectionData, artifactSection("train_merlinite.jsonl"))
+	assert.Equal(t, sectionViewers, artifactSection("summary.json"+jsonViewerFilenameSuffix))
+	assert.Equal(t, sectionLogs, artifactSection("ilab_generate_stderr.log"))
+	assert.Equal(t, sectionLogs, artifactSection(jobLogFilename))
+	assert.Equal(t, sectionOther, artifactSection(ilabVersionFilename))
+	assert.Equal(t, sectionEncrypted, artifactSection("precheck_chat.log"+encryptedSuffix))
+}
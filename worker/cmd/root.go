@@ -9,25 +9,33 @@ import (
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
 var (
-	RedisHost string
-	Debug     bool
-	TestMode  bool
+	RedisHost  string
+	Debug      bool
+	TestMode   bool
+	ConfigFile string
+	LogFormat  string
 )
 
 func init() {
 	rootCmd.PersistentFlags().StringVarP(&RedisHost, "redis", "r", "localhost:6379", "The Redis instance to connect to")
 	rootCmd.PersistentFlags().BoolVarP(&TestMode, "test", "t", false, "Enable test mode - do not run generate or post to S3")
 	rootCmd.PersistentFlags().BoolVarP(&Debug, "debug", "d", false, "Enable debug logging")
+	rootCmd.PersistentFlags().StringVarP(&ConfigFile, "config", "c", "instructlab-worker.yaml", "Path to the worker config file. Flags can be set in it by name, and it holds the precheck prompt templates")
+	rootCmd.PersistentFlags().StringVarP(&LogFormat, "log-format", "", logFormatConsole, "Format of the worker logs: console or json, for log aggregators")
 }
 
 var rootCmd = &cobra.Command{
 	Use:   "worker",
 	Short: "Worker receives jobs from a Redis queue and processes them.",
 	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
-		return initializeConfig(cmd)
+		if err := initializeConfig(cmd); err != nil {
+			return err
+		}
+		return validateLogFormat(LogFormat)
 	},
 }
 
@@ -38,21 +46,27 @@ func Execute() {
 	}
 }
 
-func initLogger(debug bool) *zap.Logger {
+func initLogger(debug bool, format string) *zap.Logger {
 	level := zap.InfoLevel
 
 	if debug {
 		level = zap.DebugLevel
 	}
 
+	encoderConfig := zap.NewDevelopmentEncoderConfig()
+	if format == logFormatJSON {
+		encoderConfig = jsonEncoderConfig()
+	}
 	loggerConfig := zap.Config{
 		Level:            zap.NewAtomicLevelAt(level),
-		Encoding:         "console",
-		EncoderConfig:    zap.NewDevelopmentEncoderConfig(),
+		Encoding:         format,
+		EncoderConfig:    encoderConfig,
 		OutputPaths:      []string{"stderr"},
 		ErrorOutputPaths: []string{"stderr"},
 	}
-	logger, _ := loggerConfig.Build()
+	logger, _ := loggerConfig.Build(zap.WrapCore(func(c zapcore.Core) zapcore.Core {
+		return redactingCore{Core: c}
+	}))
 	return logger
 }
 
@@ -61,6 +75,17 @@ func initializeConfig(cmd *cobra.Command) error {
 	v.SetEnvPrefix("ILWORKER")
 	v.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
 	v.AutomaticEnv()
+	if ConfigFile != "" {
+		if _, err := os.Stat(ConfigFile); err == nil {
+			v.SetConfigFile(ConfigFile)
+			v.SetConfigType("yaml")
+			if err := v.ReadInConfig(); err != nil {
+				return fmt.Errorf("could not read worker config %s: %w", ConfigFile, err)
+			}
+		} else if cmd.Flags().Changed("config") {
+			return fmt.Errorf("worker config %s not found: %w", ConfigFile, err)
+		}
+	}
 	bindFlags(cmd, v)
 	return nil
 }
@@ -0,0 +1,231 @@
+package cmd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"go.uber.org/zap"
+)
+
+// sha256MetadataKey is the object metadata holding the hex SHA-256 of an uploaded file,
+// x-amz-meta-sha256 in the responses of S3
+const sha256MetadataKey = "sha256"
+
+// uploadFile uploads the file at filePath to key with its SHA-256 in the sha256 metadata, then
+// checks with HeadObject that the object is complete. Failed uploads are retried
+// --s3-upload-retries times, and the files larger than a part resume the multipart upload the
+// failed attempt, or a previous run of the job, left behind.
+func uploadFile(ctx context.Context, svc *s3.Client, key, filePath, contentType, tags string, logger *zap.SugaredLogger) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	digest, err := sha256Sum(io.NewSectionReader(file, 0, info.Size()))
+	if err != nil {
+		return fmt.Errorf("could not checksum %s: %w", filePath, err)
+	}
+
+	for attempt := 1; ; attempt++ {
+		err = uploadFileOnce(ctx, svc, key, file, info.Size(), digest, contentType, tags)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil || attempt > S3UploadRetries {
+			return err
+		}
+		delay := backoffDelay(S3UploadRetryBackoff, attempt)
+		logger.Infof("Retrying the upload of %s in %s, attempt %d/%d: %v", key, delay, attempt+1, S3UploadRetries+1, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+func uploadFileOnce(ctx context.Context, svc *s3.Client, key string, file *os.File, size int64, digest []byte, contentType, tags string) error {
+	if faultInjected(faultS3Upload) {
+		return injectedFault(faultS3Upload)
+	}
+	input := putObjectInput(key, io.NewSectionReader(file, 0, size), contentType, tags)
+	if input.Metadata == nil {
+		input.Metadata = map[string]string{}
+	}
+	input.Metadata[sha256MetadataKey] = hex.EncodeToString(digest)
+
+	checksum := base64.StdEncoding.EncodeToString(digest)
+	if size > s3PartSize() {
+		var err error
+		if checksum, err = resumeMultipartUpload(ctx, svc, input, file, size); err != nil {
+			return err
+		}
+	} else {
+		input.ChecksumSHA256 = aws.String(checksum)
+		if _, err := svc.PutObject(ctx, input); err != nil {
+			return err
+		}
+	}
+	return verifyUpload(ctx, svc, key, size, hex.EncodeToString(digest), checksum)
+}
+
+// resumeMultipartUpload uploads file in parts, continuing the pending multipart upload of the key
+// if there is one: its parts with the same size and SHA-256 are kept, the others uploaded again.
+// The upload is not aborted on failure so that the next attempt resumes it, a lifecycle rule
+// should abort the incomplete multipart uploads of the bucket after a few days. It returns the
+// composite checksum of the object.
+func resumeMultipartUpload(ctx context.Context, svc *s3.Client, input *s3.PutObjectInput, file *os.File, size int64) (string, error) {
+	uploadID, uploaded, err := pendingMultipartUpload(ctx, svc, *input.Key)
+	if err != nil {
+		return "", err
+	}
+	if uploadID == "" {
+		created, err := svc.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+			Bucket:               input.Bucket,
+			Key:                  input.Key,
+			ContentType:          input.ContentType,
+			Metadata:             input.Metadata,
+			ServerSideEncryption: input.ServerSideEncryption,
+			SSEKMSKeyId:          input.SSEKMSKeyId,
+			Tagging:              input.Tagging,
+			ChecksumAlgorithm:    types.ChecksumAlgorithmSha256,
+		})
+		if err != nil {
+			return "", err
+		}
+		uploadID = aws.ToString(created.UploadId)
+	}
+
+	partSize := s3PartSize()
+	var parts []types.CompletedPart
+	partDigests := sha256.New()
+	for number, offset := int32(1), int64(0); offset < size; number, offset = number+1, offset+partSize {
+		section := io.NewSectionReader(file, offset, min(partSize, size-offset))
+		partDigest, err := sha256Sum(section)
+		if err != nil {
+			return "", err
+		}
+		if _, err := section.Seek(0, io.SeekStart); err != nil {
+			return "", err
+		}
+		partDigests.Write(partDigest)
+		checksum := base64.StdEncoding.EncodeToString(partDigest)
+
+		if part, ok := uploaded[number]; ok && aws.ToString(part.ChecksumSHA256) == checksum && aws.ToInt64(part.Size) == section.Size() {
+			parts = append(parts, types.CompletedPart{PartNumber: aws.Int32(number), ETag: part.ETag, ChecksumSHA256: part.ChecksumSHA256})
+			continue
+		}
+		out, err := svc.UploadPart(ctx, &s3.UploadPartInput{
+			Bucket:         input.Bucket,
+			Key:            input.Key,
+			UploadId:       aws.String(uploadID),
+			PartNumber:     aws.Int32(number),
+			Body:           section,
+			ChecksumSHA256: aws.String(checksum),
+		})
+		if err != nil {
+			return "", fmt.Errorf("could not upload part %d: %w", number, err)
+		}
+		parts = append(parts, types.CompletedPart{PartNumber: aws.Int32(number), ETag: out.ETag, ChecksumSHA256: aws.String(checksum)})
+	}
+
+	if _, err := svc.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          input.Bucket,
+		Key:             input.Key,
+		UploadId:        aws.String(uploadID),
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+	}); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s-%d", base64.StdEncoding.EncodeToString(partDigests.Sum(nil)), len(parts)), nil
+}
+
+// pendingMultipartUpload returns the most recent multipart upload of key that was not completed
+// and its uploaded parts by number, or no upload ID
+func pendingMultipartUpload(ctx context.Context, svc *s3.Client, key string) (string, map[int32]types.Part, error) {
+	list, err := svc.ListMultipartUploads(ctx, &s3.ListMultipartUploadsInput{
+		Bucket: aws.String(S3Bucket),
+		Prefix: aws.String(key),
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	var latest *types.MultipartUpload
+	for i, upload := range list.Uploads {
+		if aws.ToString(upload.Key) != key {
+			continue
+		}
+		if latest == nil || aws.ToTime(upload.Initiated).After(aws.ToTime(latest.Initiated)) {
+			latest = &list.Uploads[i]
+		}
+	}
+	if latest == nil {
+		return "", nil, nil
+	}
+
+	uploadID := aws.ToString(latest.UploadId)
+	parts := make(map[int32]types.Part)
+	paginator := s3.NewListPartsPaginator(svc, &s3.ListPartsInput{
+		Bucket:   aws.String(S3Bucket),
+		Key:      aws.String(key),
+		UploadId: aws.String(uploadID),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return "", nil, err
+		}
+		for _, part := range page.Parts {
+			parts[aws.ToInt32(part.PartNumber)] = part
+		}
+	}
+	return uploadID, parts, nil
+}
+
+// verifyUpload checks the size and the sha256 metadata of an uploaded object, and its checksum
+// when the storage reports one
+func verifyUpload(ctx context.Context, svc *s3.Client, key string, size int64, digest, checksum string) error {
+	head, err := svc.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket:       aws.String(S3Bucket),
+		Key:          aws.String(key),
+		ChecksumMode: types.ChecksumModeEnabled,
+	})
+	if err != nil {
+		return fmt.Errorf("could not verify the upload: %w", err)
+	}
+	if got := aws.ToInt64(head.ContentLength); got != size {
+		return fmt.Errorf("the uploaded object has %d bytes, expected %d", got, size)
+	}
+	if got := head.Metadata[sha256MetadataKey]; got != digest {
+		return fmt.Errorf("the uploaded object has the SHA-256 %q, expected %s", got, digest)
+	}
+	if got := aws.ToString(head.ChecksumSHA256); got != "" && checksum != "" && got != checksum {
+		return fmt.Errorf("the uploaded object has the checksum %s, expected %s", got, checksum)
+	}
+	return nil
+}
+
+func sha256Sum(r io.Reader) ([]byte, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, r); err != nil {
+		return nil, err
+	}
+	return hash.Sum(nil), nil
+}
+
+func s3PartSize() int64 {
+	return int64(S3UploadPartSizeMB) << 20
+}
@@ -0,0 +1,172 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// fakeS3 is the bucket "bot" of an S3 compatible storage, with the operations of uploadFile
+type fakeS3 struct {
+	objects  map[string][]byte
+	metadata map[string]string
+	// uploads are the parts of the pending multipart uploads by upload ID
+	uploads map[string]map[int][]byte
+	keys    map[string]string
+	// partPuts counts the uploaded parts, truncate truncates the next objects put
+	partPuts int
+	puts     int
+	truncate int
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{
+		objects:  make(map[string][]byte),
+		metadata: make(map[string]string),
+		uploads:  make(map[string]map[int][]byte),
+		keys:     make(map[string]string),
+	}
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/bot"), "/")
+	query := r.URL.Query()
+	body, _ := io.ReadAll(r.Body)
+	uploadID := query.Get("uploadId")
+	switch {
+	case r.Method == http.MethodHead:
+		object, ok := f.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(object)))
+		w.Header().Set("x-amz-meta-sha256", f.metadata[key])
+	case r.Method == http.MethodPut && uploadID != "":
+		number, _ := strconv.Atoi(query.Get("partNumber"))
+		f.uploads[uploadID][number] = body
+		f.partPuts++
+		w.Header().Set("ETag", fmt.Sprintf("%q", fmt.Sprint(number)))
+	case r.Method == http.MethodPut:
+		f.puts++
+		if f.truncate > 0 {
+			f.truncate--
+			body = body[:len(body)/2]
+		}
+		f.objects[key] = body
+		f.metadata[key] = r.Header.Get("x-amz-meta-sha256")
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		uploadID = fmt.Sprintf("upload-%d", len(f.uploads)+1)
+		f.uploads[uploadID] = make(map[int][]byte)
+		f.keys[uploadID] = key
+		f.metadata[key] = r.Header.Get("x-amz-meta-sha256")
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><Bucket>bot</Bucket><Key>%s</Key><UploadId>%s</UploadId></InitiateMultipartUploadResult>", key, uploadID)
+	case r.Method == http.MethodPost:
+		var object []byte
+		for number := 1; number <= len(f.uploads[uploadID]); number++ {
+			object = append(object, f.uploads[uploadID][number]...)
+		}
+		f.objects[key] = object
+		delete(f.uploads, uploadID)
+		fmt.Fprintf(w, "<CompleteMultipartUploadResult><Key>%s</Key><ETag>\"done\"</ETag></CompleteMultipartUploadResult>", key)
+	case query.Has("uploads"):
+		fmt.Fprint(w, "<ListMultipartUploadsResult><Bucket>bot</Bucket>")
+		for id := range f.uploads {
+			fmt.Fprintf(w, "<Upload><Key>%s</Key><UploadId>%s</UploadId><Initiated>2024-06-01T00:00:00.000Z</Initiated></Upload>", f.keys[id], id)
+		}
+		fmt.Fprint(w, "</ListMultipartUploadsResult>")
+	case uploadID != "":
+		var numbers []int
+		for number := range f.uploads[uploadID] {
+			numbers = append(numbers, number)
+		}
+		sort.Ints(numbers)
+		fmt.Fprint(w, "<ListPartsResult><IsTruncated>false</IsTruncated>")
+		for _, number := range numbers {
+			part := f.uploads[uploadID][number]
+			digest := sha256.Sum256(part)
+			fmt.Fprintf(w, "<Part><PartNumber>%d</PartNumber><ETag>\"%d\"</ETag><Size>%d</Size><ChecksumSHA256>%s</ChecksumSHA256></Part>",
+				number, number, len(part), base64.StdEncoding.EncodeToString(digest[:]))
+		}
+		fmt.Fprint(w, "</ListPartsResult>")
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+func newFakeS3Client(t *testing.T, fake *fakeS3) *s3.Client {
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	bucket, endpoint, pathStyle := S3Bucket, S3EndpointURL, S3PathStyle
+	retries, backoff, partSize := S3UploadRetries, S3UploadRetryBackoff, S3UploadPartSizeMB
+	t.Cleanup(func() {
+		S3Bucket, S3EndpointURL, S3PathStyle = bucket, endpoint, pathStyle
+		S3UploadRetries, S3UploadRetryBackoff, S3UploadPartSizeMB = retries, backoff, partSize
+	})
+	S3Bucket, S3EndpointURL, S3PathStyle = "bot", server.URL, true
+	S3UploadRetries, S3UploadRetryBackoff, S3UploadPartSizeMB = 1, 0, 5
+	return newS3Client(aws.Config{Region: "us-east-2", Credentials: aws.AnonymousCredentials{}})
+}
+
+func writeTestFile(t *testing.T, content []byte) string {
+	filePath := filepath.Join(t.TempDir(), "generated.jsonl")
+	assert.NoError(t, os.WriteFile(filePath, content, 0644))
+	return filePath
+}
+
+// TestUploadFile verify the file is uploaded with its SHA-256 and a truncated upload is retried.
+func TestUploadFile(t *testing.T) {
+	fake := newFakeS3()
+	svc := newFakeS3Client(t, fake)
+	content := []byte(`{"question": "what is a fox?"}` + "\n")
+	filePath := writeTestFile(t, content)
+	digest := sha256.Sum256(content)
+
+	fake.truncate = 1
+	assert.NoError(t, uploadFile(context.Background(), svc, "job/generated.jsonl", filePath, "text/plain", "", zap.NewNop().Sugar()))
+	assert.Equal(t, 2, fake.puts)
+	assert.Equal(t, content, fake.objects["job/generated.jsonl"])
+	assert.Equal(t, hex.EncodeToString(digest[:]), fake.metadata["job/generated.jsonl"])
+
+	fake.truncate = 2
+	assert.Error(t, uploadFile(context.Background(), svc, "job/generated.jsonl", filePath, "text/plain", "", zap.NewNop().Sugar()))
+}
+
+// TestUploadFileResumesMultipartUpload verify the parts of a pending upload with the same content
+// are kept and the others uploaded.
+func TestUploadFileResumesMultipartUpload(t *testing.T) {
+	fake := newFakeS3()
+	svc := newFakeS3Client(t, fake)
+	content := bytes.Repeat([]byte("0123456789abcdef"), 11<<16)
+	filePath := writeTestFile(t, content)
+
+	fake.uploads["upload-1"] = map[int][]byte{
+		1: content[:5<<20],
+		2: bytes.Repeat([]byte("x"), 5<<20),
+	}
+	fake.keys["upload-1"] = "job/generated.jsonl"
+	digest := sha256.Sum256(content)
+	fake.metadata["job/generated.jsonl"] = hex.EncodeToString(digest[:])
+
+	assert.NoError(t, uploadFile(context.Background(), svc, "job/generated.jsonl", filePath, "text/plain", "", zap.NewNop().Sugar()))
+	assert.Equal(t, 2, fake.partPuts)
+	assert.True(t, bytes.Equal(content, fake.objects["job/generated.jsonl"]))
+	assert.Empty(t, fake.uploads)
+}
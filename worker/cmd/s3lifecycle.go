@@ -0,0 +1,201 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+const (
+	// s3IADays is the minimum age of the objects S3 moves to the infrequent access classes
+	s3IADays = 30
+	// s3DatasetArchiveDays is the age the datasets, rarely downloaded once their PR is merged,
+	// are moved to GLACIER_IR at
+	s3DatasetArchiveDays = 90
+	// s3AbortMultipartDays is the age the incomplete multipart uploads are aborted at, long
+	// after the retries of the worker gave up on them
+	s3AbortMultipartDays = 7
+)
+
+// lifecyclePolicy is a bucket lifecycle configuration in the JSON format of
+// aws s3api put-bucket-lifecycle-configuration
+type lifecyclePolicy struct {
+	Rules []lifecycleRule
+}
+
+type lifecycleRule struct {
+	ID                             string
+	Status                         string
+	Filter                         lifecycleFilter
+	Transitions                    []lifecycleTransition `json:",omitempty"`
+	AbortIncompleteMultipartUpload *lifecycleAbort       `json:",omitempty"`
+}
+
+type lifecycleFilter struct {
+	Prefix *string       `json:",omitempty"`
+	Tag    *lifecycleTag `json:",omitempty"`
+	And    *lifecycleAnd `json:",omitempty"`
+}
+
+type lifecycleAnd struct {
+	Prefix string
+	Tags   []lifecycleTag
+}
+
+type lifecycleTag struct {
+	Key   string
+	Value string
+}
+
+type lifecycleTransition struct {
+	Days         int
+	StorageClass string
+}
+
+type lifecycleAbort struct {
+	DaysAfterInitiation int
+}
+
+// artifactFilter selects the artifacts of a kind under the key prefix by their tag
+func artifactFilter(kind string) lifecycleFilter {
+	tag := lifecycleTag{Key: s3ArtifactTag, Value: kind}
+	if S3KeyPrefix == "" {
+		return lifecycleFilter{Tag: &tag}
+	}
+	return lifecycleFilter{And: &lifecycleAnd{Prefix: S3KeyPrefix, Tags: []lifecycleTag{tag}}}
+}
+
+// s3LifecycleTransitions are the transitions recommended for the artifacts uploaded in class: the
+// ones still in STANDARD move to STANDARD_IA once they are old enough, and to GLACIER_IR after
+// archiveDays unless it is 0. INTELLIGENT_TIERING moves its objects by itself.
+func s3LifecycleTransitions(class string, archiveDays int) []lifecycleTransition {
+	var transitions []lifecycleTransition
+	switch types.StorageClass(class) {
+	case "", types.StorageClassStandard:
+		transitions = append(transitions, lifecycleTransition{Days: s3IADays, StorageClass: string(types.TransitionStorageClassStandardIa)})
+		fallthrough
+	case types.StorageClassStandardIa, types.StorageClassOnezoneIa:
+		if archiveDays > 0 {
+			transitions = append(transitions, lifecycleTransition{Days: archiveDays, StorageClass: string(types.TransitionStorageClassGlacierIr)})
+		}
+	}
+	return transitions
+}
+
+// recommendedLifecycle is the lifecycle policy recommended for the uploads under the key prefix
+// with the configured storage classes. The datasets and reports are told apart by their tag, so
+// their transitions need --s3-object-tags. The reports are browsed for as long as their PR is, they
+// are never archived.
+func recommendedLifecycle() lifecyclePolicy {
+	var policy lifecyclePolicy
+	if S3ObjectTags {
+		for _, kind := range []struct {
+			name        string
+			archiveDays int
+		}{
+			{s3ArtifactDataset, s3DatasetArchiveDays},
+			{s3ArtifactReport, 0},
+		} {
+			transitions := s3LifecycleTransitions(s3StorageClass(kind.name), kind.archiveDays)
+			if len(transitions) == 0 {
+				continue
+			}
+			policy.Rules = append(policy.Rules, lifecycleRule{
+				ID:          "instructlab-bot-" + kind.name + "s",
+				Status:      string(types.ExpirationStatusEnabled),
+				Filter:      artifactFilter(kind.name),
+				Transitions: transitions,
+			})
+		}
+	}
+	prefix := S3KeyPrefix
+	policy.Rules = append(policy.Rules, lifecycleRule{
+		ID:                             "instructlab-bot-incomplete-uploads",
+		Status:                         string(types.ExpirationStatusEnabled),
+		Filter:                         lifecycleFilter{Prefix: &prefix},
+		AbortIncompleteMultipartUpload: &lifecycleAbort{DaysAfterInitiation: s3AbortMultipartDays},
+	})
+	return policy
+}
+
+// writeLifecyclePolicy prints the recommended lifecycle policy of the bucket and how to apply it
+func writeLifecyclePolicy(out io.Writer) error {
+	policy, err := json.MarshalIndent(recommendedLifecycle(), "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "\nRecommended lifecycle policy of bucket %s, it replaces the current rules of the bucket so merge them in first:\n", S3Bucket)
+	fmt.Fprintf(out, "  aws s3api put-bucket-lifecycle-configuration --bucket %s --lifecycle-configuration file://lifecycle.json\n", S3Bucket)
+	if !S3ObjectTags {
+		fmt.Fprintln(out, "The datasets and reports are told apart by their tag, --s3-object-tags is needed to move them to cheaper storage classes.")
+	}
+	fmt.Fprintf(out, "%s\n", policy)
+	return nil
+}
+
+// lifecycleRulePrefix is the key prefix a lifecycle rule applies to
+func lifecycleRulePrefix(rule types.LifecycleRule) string {
+	// The rules created before the filters were introduced carry their prefix
+	if rule.Prefix != nil {
+		return *rule.Prefix
+	}
+	switch filter := rule.Filter.(type) {
+	case *types.LifecycleRuleFilterMemberPrefix:
+		return filter.Value
+	case *types.LifecycleRuleFilterMemberAnd:
+		if filter.Value.Prefix != nil {
+			return *filter.Value.Prefix
+		}
+	}
+	return ""
+}
+
+// lifecycleRulesCovering counts the enabled lifecycle rules applying to some of the keys under prefix
+func lifecycleRulesCovering(rules []types.LifecycleRule, prefix string) int {
+	covering := 0
+	for _, rule := range rules {
+		if rule.Status != types.ExpirationStatusEnabled {
+			continue
+		}
+		rulePrefix := lifecycleRulePrefix(rule)
+		if strings.HasPrefix(prefix, rulePrefix) || strings.HasPrefix(rulePrefix, prefix) {
+			covering++
+		}
+	}
+	return covering
+}
+
+// checkS3Lifecycle reports the buckets without a lifecycle rule for the uploads, which stay in
+// their storage class forever
+func checkS3Lifecycle(ctx context.Context) doctorCheck {
+	const name = "S3 lifecycle"
+	ctx, cancel := context.WithTimeout(ctx, doctorTimeout)
+	defer cancel()
+
+	cfg, err := awsconfig.LoadDefaultConfig(ctx, awsconfig.WithRegion(AWSRegion))
+	if err != nil {
+		return warnCheck(name, "could not load the AWS config: %v", err)
+	}
+	output, err := newS3Client(cfg).GetBucketLifecycleConfiguration(ctx, &s3.GetBucketLifecycleConfigurationInput{Bucket: aws.String(S3Bucket)})
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && apiErr.ErrorCode() == "NoSuchLifecycleConfiguration" {
+		return warnCheck(name, "bucket %s has no lifecycle rule, see the recommended policy below", S3Bucket)
+	}
+	if err != nil {
+		return warnCheck(name, "could not read the lifecycle rules of bucket %s: %v", S3Bucket, err)
+	}
+	covering := lifecycleRulesCovering(output.Rules, S3KeyPrefix)
+	if covering == 0 {
+		return warnCheck(name, "no lifecycle rule of bucket %s applies to %q, see the recommended policy below", S3Bucket, S3KeyPrefix)
+	}
+	return passCheck(name, "%d lifecycle rules of bucket %s apply to %q", covering, S3Bucket, S3KeyPrefix)
+}
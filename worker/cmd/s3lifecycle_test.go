@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestRecommendedLifecycle verify the datasets and reports move to cheaper storage classes by
+// their tag, unless their storage class already moves them.
+func TestRecommendedLifecycle(t *testing.T) {
+	defer func(prefix, dataset, report string, tags bool) {
+		S3KeyPrefix, S3DatasetStorageClass, S3ReportStorageClass, S3ObjectTags = prefix, dataset, report, tags
+	}(S3KeyPrefix, S3DatasetStorageClass, S3ReportStorageClass, S3ObjectTags)
+
+	S3KeyPrefix, S3DatasetStorageClass, S3ReportStorageClass, S3ObjectTags = "prod/", "", "", true
+	policy := recommendedLifecycle()
+	assert.Len(t, policy.Rules, 3)
+	datasets := policy.Rules[0]
+	assert.Equal(t, "instructlab-bot-datasets", datasets.ID)
+	assert.Equal(t, &lifecycleAnd{Prefix: "prod/", Tags: []lifecycleTag{{Key: "artifact", Value: "dataset"}}}, datasets.Filter.And)
+	assert.Equal(t, []lifecycleTransition{{30, "STANDARD_IA"}, {90, "GLACIER_IR"}}, datasets.Transitions)
+	assert.Equal(t, []lifecycleTransition{{30, "STANDARD_IA"}}, policy.Rules[1].Transitions)
+	assert.Equal(t, "prod/", *policy.Rules[2].Filter.Prefix)
+	assert.Equal(t, 7, policy.Rules[2].AbortIncompleteMultipartUpload.DaysAfterInitiation)
+
+	S3KeyPrefix, S3DatasetStorageClass, S3ReportStorageClass = "", "STANDARD_IA", "INTELLIGENT_TIERING"
+	policy = recommendedLifecycle()
+	assert.Len(t, policy.Rules, 2)
+	assert.Equal(t, &lifecycleTag{Key: "artifact", Value: "dataset"}, policy.Rules[0].Filter.Tag)
+	assert.Equal(t, []lifecycleTransition{{90, "GLACIER_IR"}}, policy.Rules[0].Transitions)
+
+	S3ObjectTags = false
+	policy = recommendedLifecycle()
+	assert.Len(t, policy.Rules, 1)
+	var out bytes.Buffer
+	assert.NoError(t, writeLifecyclePolicy(&out))
+	assert.Contains(t, out.String(), "--s3-object-tags is needed")
+	assert.Contains(t, out.String(), `"DaysAfterInitiation": 7`)
+}
+
+// TestLifecycleRulesCovering verify the enabled rules of the prefix, of a parent or of a
+// subdirectory of it are counted.
+func TestLifecycleRulesCovering(t *testing.T) {
+	rules := []types.LifecycleRule{
+		{Status: types.ExpirationStatusEnabled, Filter: &types.LifecycleRuleFilterMemberPrefix{Value: ""}},
+		{Status: types.ExpirationStatusEnabled, Filter: &types.LifecycleRuleFilterMemberAnd{Value: types.LifecycleRuleAndOperator{Prefix: aws.String("prod/jobs/")}}},
+		{Status: types.ExpirationStatusDisabled, Filter: &types.LifecycleRuleFilterMemberPrefix{Value: "prod/"}},
+		{Status: types.ExpirationStatusEnabled, Filter: &types.LifecycleRuleFilterMemberPrefix{Value: "staging/"}},
+	}
+	assert.Equal(t, 2, lifecycleRulesCovering(rules, "prod/"))
+	assert.Equal(t, 1, lifecycleRulesCovering(rules, "dev/"))
+}
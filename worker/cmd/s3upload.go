@@ -0,0 +1,236 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// The server-side encryption modes of --s3-sse
+const (
+	s3SSENone = ""
+	// s3SSES3 encrypts with the keys managed by S3
+	s3SSES3 = "sse-s3"
+	// s3SSEKMS encrypts with a KMS key, --s3-sse-kms-key-id or else the AWS managed key of S3
+	s3SSEKMS = "sse-kms"
+)
+
+// The kinds of artifacts, each uploaded in its own storage class and tagged with its kind so that
+// lifecycle rules can tell them apart
+const (
+	// s3ArtifactDataset is the generated data, the logs and every other output of the jobs
+	s3ArtifactDataset = "dataset"
+	// s3ArtifactReport is the HTML pages browsed from the links of the results
+	s3ArtifactReport = "report"
+	// s3ArtifactTag is the tag holding the kind of an artifact
+	s3ArtifactTag = "artifact"
+	// s3RepoMetadata is the metadata holding the repository of the job of an artifact, owner/name,
+	// the API server checks the users can read it before serving the artifact
+	s3RepoMetadata = "repo"
+)
+
+// s3StorageClasses are the storage classes of --s3-dataset-storage-class and
+// --s3-report-storage-class. The archive classes are left out, their objects can't be downloaded
+// from the links of the results until they are restored.
+var s3StorageClasses = []types.StorageClass{
+	types.StorageClassStandard,
+	types.StorageClassStandardIa,
+	types.StorageClassOnezoneIa,
+	types.StorageClassIntelligentTiering,
+	types.StorageClassGlacierIr,
+}
+
+// validateS3Settings checks the encryption and key prefix flags of the uploads
+func validateS3Settings() error {
+	switch S3SSE {
+	case s3SSENone, s3SSES3:
+		if S3SSEKMSKeyID != "" {
+			return fmt.Errorf("--s3-sse-kms-key-id needs --s3-sse %s", s3SSEKMS)
+		}
+	case s3SSEKMS:
+	default:
+		return fmt.Errorf("unknown S3 server-side encryption %q, expected %s or %s", S3SSE, s3SSES3, s3SSEKMS)
+	}
+	if S3UploadPartSizeMB < int(manager.MinUploadPartSize>>20) {
+		return fmt.Errorf("--s3-upload-part-size-mb must be at least %d", manager.MinUploadPartSize>>20)
+	}
+	for flag, value := range map[string]string{"--s3-dataset-storage-class": S3DatasetStorageClass, "--s3-report-storage-class": S3ReportStorageClass} {
+		if value != "" && !validStorageClass(value) {
+			return fmt.Errorf("unknown %s %q, expected one of %s", flag, value, storageClassNames())
+		}
+	}
+	if strings.HasPrefix(S3KeyPrefix, "/") {
+		return fmt.Errorf("the S3 key prefix %q must not start with /", S3KeyPrefix)
+	}
+	for flag, value := range map[string]string{"--s3-endpoint-url": S3EndpointURL, "--s3-public-url": S3PublicURL} {
+		if value == "" {
+			continue
+		}
+		if u, err := url.Parse(value); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%s %q is not an http or https URL", flag, value)
+		}
+	}
+	return nil
+}
+
+func validStorageClass(class string) bool {
+	for _, c := range s3StorageClasses {
+		if string(c) == class {
+			return true
+		}
+	}
+	return false
+}
+
+func storageClassNames() string {
+	names := make([]string, 0, len(s3StorageClasses))
+	for _, c := range s3StorageClasses {
+		names = append(names, string(c))
+	}
+	return strings.Join(names, ", ")
+}
+
+// s3ArtifactKind tells the HTML reports from the datasets and the other outputs by their content type
+func s3ArtifactKind(contentType string) string {
+	if strings.HasPrefix(contentType, "text/html") {
+		return s3ArtifactReport
+	}
+	return s3ArtifactDataset
+}
+
+// s3StorageClass is the storage class the artifacts of a kind are uploaded in, "" for the default
+// of the bucket
+func s3StorageClass(kind string) string {
+	if kind == s3ArtifactReport {
+		return S3ReportStorageClass
+	}
+	return S3DatasetStorageClass
+}
+
+// newS3Client is the client of the uploads, to AWS S3 or the S3 compatible storage of
+// --s3-endpoint-url
+func newS3Client(cfg aws.Config) *s3.Client {
+	return s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if S3EndpointURL != "" {
+			o.BaseEndpoint = aws.String(S3EndpointURL)
+		}
+		o.UsePathStyle = S3PathStyle
+	})
+}
+
+// s3PublicURL is the link to an uploaded key in index.html and in the PR comments: under
+// --s3-public-url when the bucket is served through a CDN or a custom domain, else the bucket URL
+// of the endpoint in virtual-hosted or path style
+func s3PublicURL(key string) string {
+	if S3PublicURL != "" {
+		return strings.TrimSuffix(S3PublicURL, "/") + "/" + key
+	}
+	scheme, host := "https", fmt.Sprintf("s3.%s.amazonaws.com", AWSRegion)
+	if S3EndpointURL != "" {
+		if u, err := url.Parse(S3EndpointURL); err == nil {
+			scheme, host = u.Scheme, u.Host
+		}
+	}
+	if S3PathStyle {
+		return fmt.Sprintf("%s://%s/%s/%s", scheme, host, S3Bucket, key)
+	}
+	return fmt.Sprintf("%s://%s.%s/%s", scheme, S3Bucket, host, key)
+}
+
+// s3ObjectTags are the tags of the objects uploaded for a job, so that storage policies and
+// lifecycle rules can select them. Scheduled jobs are tagged with their branch instead of a PR.
+func s3ObjectTags(jobID, prNumber, branch, repoOwner, repoName string) string {
+	tags := url.Values{}
+	tags.Set("job", jobID)
+	if prNumber != "" {
+		tags.Set("pr", prNumber)
+	}
+	if branch != "" {
+		tags.Set("branch", branch)
+	}
+	if repoOwner != "" && repoName != "" {
+		tags.Set("repo", repoOwner+"/"+repoName)
+	}
+	return tags.Encode()
+}
+
+// putObjectInput is the upload of body to key in the bucket, in the storage class of its kind of
+// artifact, encrypted as configured and tagged with tags and its kind unless --s3-object-tags is off.
+// The repository of the tags is always kept in the metadata of the object, it outlives the job keys.
+func putObjectInput(key string, body io.Reader, contentType, tags string) *s3.PutObjectInput {
+	input := &s3.PutObjectInput{
+		Bucket: aws.String(S3Bucket),
+		Key:    aws.String(key),
+		Body:   body,
+	}
+	kind := s3ArtifactKind(contentType)
+	if class := s3StorageClass(kind); class != "" {
+		input.StorageClass = types.StorageClass(class)
+	}
+	if contentType != "" {
+		input.ContentType = aws.String(contentType)
+	}
+	switch S3SSE {
+	case s3SSES3:
+		input.ServerSideEncryption = types.ServerSideEncryptionAes256
+	case s3SSEKMS:
+		input.ServerSideEncryption = types.ServerSideEncryptionAwsKms
+		if S3SSEKMSKeyID != "" {
+			input.SSEKMSKeyId = aws.String(S3SSEKMSKeyID)
+		}
+	}
+	if repo := s3TagValue(tags, "repo"); repo != "" {
+		input.Metadata = map[string]string{s3RepoMetadata: repo}
+	}
+	if S3ObjectTags && tags != "" {
+		if values, err := url.ParseQuery(tags); err == nil {
+			values.Set(s3ArtifactTag, kind)
+			tags = values.Encode()
+		}
+		input.Tagging = aws.String(tags)
+	}
+	return input
+}
+
+// s3TagValue is the value of a tag of the tags of s3ObjectTags
+func s3TagValue(tags, key string) string {
+	values, err := url.ParseQuery(tags)
+	if err != nil {
+		return ""
+	}
+	return values.Get(key)
+}
+
+// newUploader uploads the bodies larger than --s3-upload-part-size-mb in parts, so that large
+// outputs and bodies that cannot be read twice need not be held in memory or on disk in full
+func newUploader(svc *s3.Client) *manager.Uploader {
+	return manager.NewUploader(svc, func(u *manager.Uploader) {
+		u.PartSize = s3PartSize()
+	})
+}
+
+// uploadStream uploads what write writes to key as it is written, without writing it to disk
+// first. The upload fails when write does.
+func uploadStream(ctx context.Context, svc *s3.Client, key, contentType, tags string, write func(io.Writer) error) error {
+	if faultInjected(faultS3Upload) {
+		return injectedFault(faultS3Upload)
+	}
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(write(writer))
+	}()
+	// The storage checks the SHA-256 of every part as it receives them
+	input := putObjectInput(key, reader, contentType, tags)
+	input.ChecksumAlgorithm = types.ChecksumAlgorithmSha256
+	_, err := newUploader(svc).Upload(ctx, input)
+	// Unblock write when the upload stopped reading early
+	reader.CloseWithError(err)
+	return err
+}
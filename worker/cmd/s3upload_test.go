@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestPutObjectInput verify the uploads are encrypted, stored and tagged as configured.
+func TestPutObjectInput(t *testing.T) {
+	defer func(sse, keyID string, tags bool) {
+		S3SSE, S3SSEKMSKeyID, S3ObjectTags = sse, keyID, tags
+	}(S3SSE, S3SSEKMSKeyID, S3ObjectTags)
+	defer func(dataset, report string) {
+		S3DatasetStorageClass, S3ReportStorageClass = dataset, report
+	}(S3DatasetStorageClass, S3ReportStorageClass)
+	tags := s3ObjectTags("42", "7", "", "instructlab", "taxonomy")
+
+	S3SSE, S3SSEKMSKeyID, S3ObjectTags = "", "", true
+	S3DatasetStorageClass, S3ReportStorageClass = "", ""
+	input := putObjectInput("prod/job/index.html", strings.NewReader(""), "text/html", tags)
+	assert.Equal(t, "prod/job/index.html", *input.Key)
+	assert.Equal(t, "text/html", *input.ContentType)
+	assert.Empty(t, input.ServerSideEncryption)
+	assert.Empty(t, input.StorageClass)
+	assert.Equal(t, "artifact=report&job=42&pr=7&repo=instructlab%2Ftaxonomy", *input.Tagging)
+	assert.Equal(t, map[string]string{"repo": "instructlab/taxonomy"}, input.Metadata)
+
+	S3DatasetStorageClass, S3ReportStorageClass = "INTELLIGENT_TIERING", "STANDARD_IA"
+	input = putObjectInput("prod/job/index.html", strings.NewReader(""), "text/html", tags)
+	assert.Equal(t, types.StorageClassStandardIa, input.StorageClass)
+	input = putObjectInput("prod/job/data.jsonl", strings.NewReader(""), "application/json-lines+json", tags)
+	assert.Equal(t, types.StorageClassIntelligentTiering, input.StorageClass)
+	assert.Equal(t, "artifact=dataset&job=42&pr=7&repo=instructlab%2Ftaxonomy", *input.Tagging)
+
+	S3SSE = s3SSES3
+	input = putObjectInput("key", strings.NewReader(""), "", tags)
+	assert.Equal(t, types.ServerSideEncryptionAes256, input.ServerSideEncryption)
+	assert.Nil(t, input.SSEKMSKeyId)
+	assert.Nil(t, input.ContentType)
+
+	S3SSE, S3SSEKMSKeyID, S3ObjectTags = s3SSEKMS, "alias/bot", false
+	input = putObjectInput("key", strings.NewReader(""), "", tags)
+	assert.Equal(t, types.ServerSideEncryptionAwsKms, input.ServerSideEncryption)
+	assert.Equal(t, "alias/bot", *input.SSEKMSKeyId)
+	assert.Nil(t, input.Tagging)
+	// The repository is kept without the tags
+	assert.Equal(t, map[string]string{"repo": "instructlab/taxonomy"}, input.Metadata)
+	assert.Nil(t, putObjectInput("key", strings.NewReader(""), "", s3ObjectTags("3", "", "main", "", "")).Metadata)
+}
+
+// TestS3ObjectTags verify scheduled jobs are tagged with their branch.
+func TestS3ObjectTags(t *testing.T) {
+	assert.Equal(t, "branch=main&job=3&repo=instructlab%2Ftaxonomy", s3ObjectTags("3", "", "main", "instructlab", "taxonomy"))
+	assert.Equal(t, "job=3", s3ObjectTags("3", "", "", "", ""))
+}
+
+// TestValidateS3Settings verify unknown encryption modes, a KMS key without sse-kms and absolute
+// prefixes are refused.
+func TestValidateS3Settings(t *testing.T) {
+	defer func(sse, keyID, prefix string) {
+		S3SSE, S3SSEKMSKeyID, S3KeyPrefix = sse, keyID, prefix
+	}(S3SSE, S3SSEKMSKeyID, S3KeyPrefix)
+
+	S3SSE, S3SSEKMSKeyID, S3KeyPrefix = s3SSEKMS, "key", "staging/"
+	assert.NoError(t, validateS3Settings())
+	S3SSE = s3SSES3
+	assert.Error(t, validateS3Settings())
+	S3SSE, S3SSEKMSKeyID = "aes", ""
+	assert.Error(t, validateS3Settings())
+	S3SSE, S3KeyPrefix = "", "/prod"
+	assert.Error(t, validateS3Settings())
+}
+
+// TestValidateS3StorageClasses verify the archive and unknown storage classes are refused.
+func TestValidateS3StorageClasses(t *testing.T) {
+	defer func(dataset, report string) {
+		S3DatasetStorageClass, S3ReportStorageClass = dataset, report
+	}(S3DatasetStorageClass, S3ReportStorageClass)
+
+	S3DatasetStorageClass, S3ReportStorageClass = "GLACIER_IR", "STANDARD_IA"
+	assert.NoError(t, validateS3Settings())
+	S3DatasetStorageClass = "DEEP_ARCHIVE"
+	assert.Error(t, validateS3Settings())
+	S3DatasetStorageClass, S3ReportStorageClass = "", "standard_ia"
+	assert.Error(t, validateS3Settings())
+}
+
+// TestS3PublicURL verify the links follow the public URL, the endpoint and the addressing style.
+func TestS3PublicURL(t *testing.T) {
+	defer func(bucket, region, endpoint, public string, pathStyle bool) {
+		S3Bucket, AWSRegion, S3EndpointURL, S3PublicURL, S3PathStyle = bucket, region, endpoint, public, pathStyle
+	}(S3Bucket, AWSRegion, S3EndpointURL, S3PublicURL, S3PathStyle)
+
+	S3Bucket, AWSRegion, S3EndpointURL, S3PublicURL, S3PathStyle = "bot", "us-east-2", "", "", false
+	assert.Equal(t, "https://bot.s3.us-east-2.amazonaws.com/prod/index.html", s3PublicURL("prod/index.html"))
+	S3PathStyle = true
+	assert.Equal(t, "https://s3.us-east-2.amazonaws.com/bot/prod/index.html", s3PublicURL("prod/index.html"))
+	S3EndpointURL = "http://minio.local:9000"
+	assert.Equal(t, "http://minio.local:9000/bot/prod/index.html", s3PublicURL("prod/index.html"))
+	S3PublicURL = "https://artifacts.example.com/"
+	assert.Equal(t, "https://artifacts.example.com/prod/index.html", s3PublicURL("prod/index.html"))
+}
+
+// TestValidateS3URLs verify the endpoint and public URLs must be http or https URLs.
+func TestValidateS3URLs(t *testing.T) {
+	defer func(endpoint, public string) {
+		S3EndpointURL, S3PublicURL = endpoint, public
+	}(S3EndpointURL, S3PublicURL)
+
+	S3EndpointURL, S3PublicURL = "http://minio:9000", "https://d111.cloudfront.net"
+	assert.NoError(t, validateS3Settings())
+	S3PublicURL = "d111.cloudfront.net"
+	assert.Error(t, validateS3Settings())
+	S3EndpointURL, S3PublicURL = "ftp://minio", ""
+	assert.Error(t, validateS3Settings())
+}
+
+// TestUploadStream verify a body is uploaded as it is written and a failed write fails the upload.
+func TestUploadStream(t *testing.T) {
+	defer func(bucket, endpoint string, pathStyle bool) {
+		S3Bucket, S3EndpointURL, S3PathStyle = bucket, endpoint, pathStyle
+	}(S3Bucket, S3EndpointURL, S3PathStyle)
+
+	uploads := make(map[string]string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Method == http.MethodPut {
+			uploads[r.URL.Path] = string(body)
+		}
+	}))
+	defer server.Close()
+	S3Bucket, S3EndpointURL, S3PathStyle = "bot", server.URL, true
+	svc := newS3Client(aws.Config{Region: "us-east-2", Credentials: aws.AnonymousCredentials{}})
+
+	err := uploadStream(context.Background(), svc, "job/index.html", "text/html", "", func(w io.Writer) error {
+		_, err := io.WriteString(w, "<html></html>")
+		return err
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "<html></html>", uploads["/bot/job/index.html"])
+
+	err = uploadStream(context.Background(), svc, "job/broken.html", "text/html", "", func(w io.Writer) error {
+		return errors.New("template failed")
+	})
+	assert.Error(t, err)
+	assert.NotContains(t, uploads, "/bot/job/broken.html")
+}
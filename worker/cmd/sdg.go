@@ -0,0 +1,305 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sdgRequest is the generation request built for a single taxonomy file
+type sdgRequest struct {
+	taxonomyFile string
+	url          string
+	body         []byte
+}
+
+// sdgTarget is where the generation request for a taxonomy file is sent
+type sdgTarget struct {
+	endpoint  string
+	model     string
+	knowledge bool
+}
+
+// sdgTarget picks the SDG endpoint and model for a taxonomy file from its path relative to the
+// taxonomy root. The first matching route in the worker config overrides the defaults.
+func (w *Worker) sdgTarget(taxonomyPath string) sdgTarget {
+	taxonomyPath = filepath.ToSlash(taxonomyPath)
+	target := sdgTarget{
+		endpoint:  w.sdgEndpoint,
+		model:     SdgModel,
+		knowledge: taxonomyType(taxonomyPath) == taxonomyTypeKnowledge,
+	}
+	if target.knowledge {
+		target.endpoint = sdgKnowledgeEndpoint(w.sdgEndpoint)
+	}
+
+	for _, route := range sdgRoutes {
+		if !strings.HasPrefix(taxonomyPath, route.Prefix) {
+			continue
+		}
+		if route.Endpoint != "" {
+			target.endpoint = route.Endpoint
+		}
+		if route.Model != "" {
+			target.model = route.Model
+		}
+		break
+	}
+	return target
+}
+
+// sdgKnowledgeEndpoint is the configured knowledge endpoint, or the skills endpoint with its
+// last path element switched from skill to knowledge
+func sdgKnowledgeEndpoint(skillEndpoint string) string {
+	if SdgKnowledgeEndpointURL != "" {
+		return SdgKnowledgeEndpointURL
+	}
+	u, err := url.Parse(skillEndpoint)
+	if err != nil {
+		return skillEndpoint
+	}
+	trimmed := strings.TrimSuffix(u.Path, "/")
+	if path.Base(trimmed) == "skill" {
+		u.Path = path.Join(path.Dir(trimmed), "knowledge")
+	}
+	return u.String()
+}
+
+// runSDGRequests sends the requests to the SDG service, at most SdgConcurrency at a time, and
+// writes every response to outputDir. The output files are returned in the order of the
+// requests. The first failure cancels the requests still in flight.
+func (w *Worker) runSDGRequests(client *http.Client, requests []sdgRequest, outputDir string) ([]string, error) {
+	ctx, cancel := context.WithCancel(w.ctx)
+	defer cancel()
+
+	limit := SdgConcurrency
+	if limit < 1 {
+		limit = 1
+	}
+	sem := make(chan struct{}, limit)
+	outputFiles := make([]string, len(requests))
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	for i, req := range requests {
+		wg.Add(1)
+		go func(i int, req sdgRequest) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				return
+			}
+
+			outputFile, err := w.runSDGRequest(ctx, client, req, outputDir, i)
+			if err != nil {
+				errOnce.Do(func() {
+					firstErr = fmt.Errorf("SDG request for '%s' failed: %w", req.taxonomyFile, err)
+					cancel()
+				})
+				return
+			}
+			outputFiles[i] = outputFile
+		}(i, req)
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := w.ctx.Err(); err != nil {
+		return nil, err
+	}
+	return outputFiles, nil
+}
+
+func (w *Worker) runSDGRequest(ctx context.Context, client *http.Client, req sdgRequest, outputDir string, index int) (string, error) {
+	responseBody, err := w.postSDGRequest(ctx, client, req.url, req.body)
+	if err != nil {
+		return "", err
+	}
+
+	// The index keeps files generated from taxonomy files with the same name apart
+	outputPath := filepath.Join(outputDir, fmt.Sprintf("sdg_%d_%d_%s.json", time.Now().Unix(), index, filepath.Base(req.taxonomyFile)))
+	if err := os.WriteFile(outputPath, responseBody, 0644); err != nil {
+		return "", fmt.Errorf("failed to write output file: %w", err)
+	}
+	return outputPath, nil
+}
+
+// postSDGRequest sends a generation request to the SDG service. Connection errors and 5xx
+// responses are retried, and a 202 response with a Location header is polled until the
+// generation finishes.
+func (w *Worker) postSDGRequest(ctx context.Context, client *http.Client, requestURL string, body []byte) ([]byte, error) {
+	var lastErr error
+	for attempt := 1; attempt <= SdgMaxRetries+1; attempt++ {
+		responseBody, err := w.doSDGRequest(ctx, client, requestURL, body)
+		if err == nil {
+			return responseBody, nil
+		}
+		lastErr = err
+		retryable, ok := err.(*retryableError)
+		if !ok || ctx.Err() != nil || attempt > SdgMaxRetries {
+			break
+		}
+
+		delay := backoffDelay(SdgRetryBackoff, attempt)
+		if retryable.retryAfter > delay {
+			delay = retryable.retryAfter
+		}
+		w.logger.Infof("Retrying SDG request in %s, attempt %d/%d: %v", delay, attempt+1, SdgMaxRetries+1, err)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+	return nil, lastErr
+}
+
+func (w *Worker) doSDGRequest(ctx context.Context, client *http.Client, requestURL string, body []byte) ([]byte, error) {
+	reqCtx := ctx
+	if SdgRequestTimeout > 0 {
+		var cancel context.CancelFunc
+		reqCtx, cancel = context.WithTimeout(ctx, SdgRequestTimeout)
+		defer cancel()
+	}
+
+	request, err := http.NewRequestWithContext(reqCtx, "POST", requestURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Accept", "application/json")
+	w.logger.Infof("SDG Post Details: %s %s", request.Method, request.URL)
+	setSDGAuthHeaders(request)
+	if faultInjected(faultSDG500) {
+		return nil, &retryableError{err: fmt.Errorf("unexpected status code %d: %w", http.StatusInternalServerError, injectedFault(faultSDG500))}
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, &retryableError{err: modelEndpointError(fmt.Errorf("failed to execute request: %w", err))}
+	}
+	defer response.Body.Close()
+
+	responseBody, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, &retryableError{err: fmt.Errorf("failed to read response body: %w", err)}
+	}
+
+	switch {
+	case response.StatusCode == http.StatusOK:
+		return responseBody, nil
+	case response.StatusCode == http.StatusAccepted && response.Header.Get("Location") != "":
+		location, err := request.URL.Parse(response.Header.Get("Location"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid SDG job location %q: %w", response.Header.Get("Location"), err)
+		}
+		// The generation runs asynchronously now, so it is polled rather than posted again
+		return w.pollSDGJob(ctx, client, request.URL, location)
+	case response.StatusCode >= 500 || response.StatusCode == http.StatusTooManyRequests:
+		return nil, &retryableError{
+			err:        fmt.Errorf("unexpected status code %d: %s", response.StatusCode, string(responseBody)),
+			retryAfter: retryAfter(response),
+		}
+	default:
+		return nil, fmt.Errorf("unexpected status code %d: %s", response.StatusCode, string(responseBody))
+	}
+}
+
+// pollSDGJob polls the location of an asynchronous SDG job until it returns the generated data.
+// 202 means the job is still running, transient failures are logged and polled again.
+func (w *Worker) pollSDGJob(ctx context.Context, client *http.Client, endpoint, location *url.URL) ([]byte, error) {
+	w.logger.Infof("SDG request accepted, polling %s", location)
+	if !sameOrigin(endpoint, location) {
+		w.logger.Warnf("SDG job %s is on another host than the SDG endpoint, it is polled without credentials", location)
+	}
+	if SdgPollTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, SdgPollTimeout)
+		defer cancel()
+	}
+
+	for {
+		delay := SdgPollInterval
+		responseBody, status, wait, err := w.getSDGJob(ctx, client, endpoint, location)
+		switch {
+		case err != nil:
+			w.logger.Warnf("Could not poll SDG job %s: %v", location, err)
+		case status == http.StatusOK:
+			return responseBody, nil
+		case status == http.StatusAccepted:
+		case status >= 500 || status == http.StatusTooManyRequests:
+			w.logger.Warnf("Polling SDG job %s returned status %d: %s", location, status, string(responseBody))
+		default:
+			return nil, fmt.Errorf("SDG job %s failed with status code %d: %s", location, status, string(responseBody))
+		}
+		if wait > delay {
+			delay = wait
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("SDG job %s did not finish: %w", location, ctx.Err())
+		case <-time.After(delay):
+		}
+	}
+}
+
+// getSDGJob polls the SDG job at location once. The credentials of the SDG endpoint are only sent
+// to the same scheme, host and port, not to wherever its Location header points.
+func (w *Worker) getSDGJob(ctx context.Context, client *http.Client, endpoint, location *url.URL) ([]byte, int, time.Duration, error) {
+	reqCtx := ctx
+	if SdgRequestTimeout > 0 {
+		var cancel context.CancelFunc
+		reqCtx, cancel = context.WithTimeout(ctx, SdgRequestTimeout)
+		defer cancel()
+	}
+	request, err := http.NewRequestWithContext(reqCtx, "GET", location.String(), nil)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	request.Header.Set("Accept", "application/json")
+	if sameOrigin(endpoint, location) {
+		setSDGAuthHeaders(request)
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	defer response.Body.Close()
+	responseBody, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	return responseBody, response.StatusCode, retryAfter(response), nil
+}
+
+// sameOrigin reports whether two URLs have the same scheme, host and port, the default port of
+// the scheme filled in
+func sameOrigin(a, b *url.URL) bool {
+	port := func(u *url.URL) string {
+		if p := u.Port(); p != "" {
+			return p
+		}
+		if strings.EqualFold(u.Scheme, "https") {
+			return "443"
+		}
+		return "80"
+	}
+	return strings.EqualFold(a.Scheme, b.Scheme) && strings.EqualFold(a.Hostname(), b.Hostname()) && port(a) == port(b)
+}
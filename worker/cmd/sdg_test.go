@@ -0,0 +1,211 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func saveSDGRequestSettings() func() {
+	timeout, retries, backoff, interval, pollTimeout := SdgRequestTimeout, SdgMaxRetries, SdgRetryBackoff, SdgPollInterval, SdgPollTimeout
+	concurrency := SdgConcurrency
+	return func() {
+		SdgRequestTimeout, SdgMaxRetries, SdgRetryBackoff, SdgPollInterval, SdgPollTimeout = timeout, retries, backoff, interval, pollTimeout
+		SdgConcurrency = concurrency
+	}
+}
+
+// TestPostSDGRequestAsync verify 5xx responses are retried and accepted jobs are polled until done.
+func TestPostSDGRequestAsync(t *testing.T) {
+	defer saveSDGRequestSettings()()
+	SdgRequestTimeout, SdgMaxRetries, SdgRetryBackoff, SdgPollInterval, SdgPollTimeout = time.Second, 2, 0, time.Millisecond, time.Second
+
+	posts, polls := 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "POST":
+			posts++
+			if posts == 1 {
+				rw.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			rw.Header().Set("Location", "/jobs/42")
+			rw.WriteHeader(http.StatusAccepted)
+		case "GET":
+			assert.Equal(t, "/jobs/42", r.URL.Path)
+			polls++
+			if polls < 3 {
+				rw.WriteHeader(http.StatusAccepted)
+				return
+			}
+			_, _ = rw.Write([]byte(`{"data": []}`))
+		}
+	}))
+	defer server.Close()
+
+	w := NewJobProcessor(context.Background(), nil, nil, zap.NewExample().Sugar(), "job-id", "", "", "", "", "", 20)
+	body, err := w.postSDGRequest(context.Background(), server.Client(), server.URL+"/skill", []byte(`{}`))
+	assert.NoError(t, err)
+	assert.Equal(t, `{"data": []}`, string(body))
+	assert.Equal(t, 2, posts)
+	assert.Equal(t, 3, polls)
+}
+
+// TestPollSDGJobCredentials verify the credentials of the SDG endpoint are not sent to a job
+// location on another host.
+func TestPollSDGJobCredentials(t *testing.T) {
+	defer saveSDGRequestSettings()()
+	SdgRequestTimeout, SdgMaxRetries, SdgPollInterval, SdgPollTimeout = time.Second, 1, time.Millisecond, time.Second
+	mode, token := SdgAuthMode, SdgToken
+	defer func() { SdgAuthMode, SdgToken = mode, token }()
+	SdgAuthMode, SdgToken = sdgAuthBearer, "secret"
+
+	jobs := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		assert.Empty(t, r.Header.Get("Authorization"))
+		_, _ = rw.Write([]byte(`{"data": []}`))
+	}))
+	defer jobs.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		rw.Header().Set("Location", jobs.URL+"/jobs/42")
+		rw.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	w := NewJobProcessor(context.Background(), nil, nil, zap.NewExample().Sugar(), "job-id", "", "", "", "", "", 20)
+	body, err := w.postSDGRequest(context.Background(), server.Client(), server.URL+"/skill", []byte(`{}`))
+	assert.NoError(t, err)
+	assert.Equal(t, `{"data": []}`, string(body))
+}
+
+func TestSameOrigin(t *testing.T) {
+	parse := func(raw string) *url.URL {
+		u, err := url.Parse(raw)
+		assert.NoError(t, err)
+		return u
+	}
+	endpoint := parse("https://sdg.example.com/skill")
+	assert.True(t, sameOrigin(endpoint, parse("https://SDG.example.com:443/jobs/42")))
+	assert.False(t, sameOrigin(endpoint, parse("http://sdg.example.com/jobs/42")))
+	assert.False(t, sameOrigin(endpoint, parse("https://sdg.example.com:8443/jobs/42")))
+	assert.False(t, sameOrigin(endpoint, parse("https://attacker.example.com/jobs/42")))
+}
+
+// TestPostSDGRequestTimeout verify hanging requests time out and client errors are not retried.
+func TestPostSDGRequestTimeout(t *testing.T) {
+	defer saveSDGRequestSettings()()
+	SdgRequestTimeout, SdgMaxRetries, SdgRetryBackoff = 50*time.Millisecond, 1, 0
+
+	var posts atomic.Int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		posts.Add(1)
+		if r.URL.Path == "/bad" {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	w := NewJobProcessor(context.Background(), nil, nil, zap.NewExample().Sugar(), "job-id", "", "", "", "", "", 20)
+	_, err := w.postSDGRequest(context.Background(), server.Client(), server.URL+"/slow", []byte(`{}`))
+	assert.Error(t, err)
+	assert.Equal(t, int32(2), posts.Load())
+
+	posts.Store(0)
+	_, err = w.postSDGRequest(context.Background(), server.Client(), server.URL+"/bad", []byte(`{}`))
+	assert.ErrorContains(t, err, "unexpected status code 400")
+	assert.Equal(t, int32(1), posts.Load())
+}
+
+// TestRunSDGRequestsConcurrently verify requests run in parallel up to the limit and outputs keep the request order.
+func TestRunSDGRequestsConcurrently(t *testing.T) {
+	defer saveSDGRequestSettings()()
+	SdgRequestTimeout, SdgMaxRetries, SdgConcurrency = time.Second, 0, 2
+
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		if r.URL.Path == "/missing" {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = rw.Write([]byte(r.URL.Path))
+	}))
+	defer server.Close()
+
+	var requests []sdgRequest
+	for i := 0; i < 5; i++ {
+		requests = append(requests, sdgRequest{taxonomyFile: "qna.yaml", url: fmt.Sprintf("%s/%d", server.URL, i), body: []byte(`{}`)})
+	}
+
+	w := NewJobProcessor(context.Background(), nil, nil, zap.NewExample().Sugar(), "job-id", "", "", "", "", "", 20)
+	outputFiles, err := w.runSDGRequests(server.Client(), requests, t.TempDir())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, maxInFlight)
+	assert.Len(t, outputFiles, 5)
+	for i, outputFile := range outputFiles {
+		data, err := os.ReadFile(outputFile)
+		assert.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("/%d", i), string(data))
+	}
+
+	requests[3].url = server.URL + "/missing"
+	_, err = w.runSDGRequests(server.Client(), requests, t.TempDir())
+	assert.ErrorContains(t, err, "unexpected status code 404")
+}
+
+// TestSDGTarget verify taxonomy files are routed by their path, with the first matching route winning.
+func TestSDGTarget(t *testing.T) {
+	savedRoutes, savedModel, savedKnowledge := sdgRoutes, SdgModel, SdgKnowledgeEndpointURL
+	defer func() { sdgRoutes, SdgModel, SdgKnowledgeEndpointURL = savedRoutes, savedModel, savedKnowledge }()
+
+	SdgModel, SdgKnowledgeEndpointURL = "default-model", ""
+	sdgRoutes = []sdgRouteConfig{
+		{Prefix: "knowledge/science/", Endpoint: "https://science.example.com/sdg"},
+		{Prefix: "knowledge/", Model: "knowledge-model"},
+		{Prefix: "compositional_skills/writing/", Model: "writing-model"},
+	}
+	w := NewJobProcessor(context.Background(), nil, nil, zap.NewExample().Sugar(), "job-id", "", "https://sdg.example.com/v1/skill", "", "", "", 20)
+
+	tests := []struct {
+		path string
+		want sdgTarget
+	}{
+		{"compositional_skills/grounded/qna.yaml", sdgTarget{endpoint: "https://sdg.example.com/v1/skill", model: "default-model"}},
+		{"compositional_skills/writing/poetry/qna.yaml", sdgTarget{endpoint: "https://sdg.example.com/v1/skill", model: "writing-model"}},
+		{"knowledge/history/qna.yaml", sdgTarget{endpoint: "https://sdg.example.com/v1/knowledge", model: "knowledge-model", knowledge: true}},
+		{"knowledge/science/physics/qna.yaml", sdgTarget{endpoint: "https://science.example.com/sdg", model: "default-model", knowledge: true}},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, w.sdgTarget(tt.path), tt.path)
+	}
+
+	SdgKnowledgeEndpointURL = "https://knowledge.example.com/sdg"
+	assert.Equal(t, "https://knowledge.example.com/sdg", w.sdgTarget("knowledge/history/qna.yaml").endpoint)
+}
@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+const (
+	sdgAuthMTLS   = "mtls"
+	sdgAuthBearer = "bearer"
+	sdgAuthAPIKey = "api-key"
+	sdgAuthNone   = "none"
+)
+
+// validateSDGAuth checks that the SDG auth mode is known and has the credentials it needs
+func validateSDGAuth() error {
+	switch SdgAuthMode {
+	case sdgAuthMTLS, sdgAuthNone:
+		return nil
+	case sdgAuthBearer:
+		if SdgToken == "" {
+			return fmt.Errorf("--sdg-token is required with --sdg-auth-mode %s", sdgAuthBearer)
+		}
+		return nil
+	case sdgAuthAPIKey:
+		if SdgToken == "" {
+			return fmt.Errorf("--sdg-token is required with --sdg-auth-mode %s", sdgAuthAPIKey)
+		}
+		if SdgAPIKeyHeader == "" {
+			return fmt.Errorf("--sdg-api-key-header must not be empty with --sdg-auth-mode %s", sdgAuthAPIKey)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown SDG auth mode %q, expected one of %s, %s, %s or %s",
+			SdgAuthMode, sdgAuthMTLS, sdgAuthBearer, sdgAuthAPIKey, sdgAuthNone)
+	}
+}
+
+// sdgHTTPClient returns the HTTP client for the SDG service. Only the mtls auth mode presents a
+// client certificate, the other modes still trust the server CA when one is available.
+func (w *Worker) sdgHTTPClient() (*http.Client, error) {
+	if SdgAuthMode == sdgAuthMTLS || SdgAuthMode == "" {
+		return w.createTLSHttpClient()
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: TlsInsecure}
+	if w.tlsServerCaCertPath != "" {
+		if caCert, err := os.ReadFile(w.tlsServerCaCertPath); err == nil {
+			caCertPool := x509.NewCertPool()
+			caCertPool.AppendCertsFromPEM(caCert)
+			tlsConfig.RootCAs = caCertPool
+		}
+	}
+	return &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig:       tlsConfig,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: 1 * time.Second,
+		},
+	}, nil
+}
+
+// setSDGAuthHeaders adds the credentials of the SDG auth mode to a request
+func setSDGAuthHeaders(request *http.Request) {
+	switch SdgAuthMode {
+	case sdgAuthBearer:
+		request.Header.Set("Authorization", "Bearer "+SdgToken)
+	case sdgAuthAPIKey:
+		request.Header.Set(SdgAPIKeyHeader, SdgToken)
+	}
+}
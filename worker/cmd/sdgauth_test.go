@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// TestSDGAuthHeaders verify the SDG request carries the credentials of the configured auth mode.
+func TestSDGAuthHeaders(t *testing.T) {
+	savedMode, savedToken, savedHeader := SdgAuthMode, SdgToken, SdgAPIKeyHeader
+	defer func() { SdgAuthMode, SdgToken, SdgAPIKeyHeader = savedMode, savedToken, savedHeader }()
+
+	var authorization, apiKey string
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		apiKey = r.Header.Get("X-Gateway-Key")
+		_, _ = rw.Write([]byte(`[]`))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	taxonomyFile := path.Join(dir, "qna.yaml")
+	assert.NoError(t, os.WriteFile(taxonomyFile, []byte("task_description: test\nseed_examples: []\n"), 0644))
+
+	w := NewJobProcessor(context.Background(), nil, nil, zap.NewExample().Sugar(), "job-id",
+		"", server.URL+"/skill", "", "", "", 20)
+
+	SdgAuthMode, SdgToken = sdgAuthBearer, "secret"
+	_, err := w.datagenSvc([]string{taxonomyFile}, []string{"compositional_skills/test/qna.yaml"}, dir, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "Bearer secret", authorization)
+
+	SdgAuthMode, SdgAPIKeyHeader = sdgAuthAPIKey, "X-Gateway-Key"
+	_, err = w.datagenSvc([]string{taxonomyFile}, []string{"compositional_skills/test/qna.yaml"}, dir, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "", authorization)
+	assert.Equal(t, "secret", apiKey)
+}
+
+// TestValidateSDGAuth verify auth modes without their credentials are rejected.
+func TestValidateSDGAuth(t *testing.T) {
+	savedMode, savedToken, savedHeader := SdgAuthMode, SdgToken, SdgAPIKeyHeader
+	defer func() { SdgAuthMode, SdgToken, SdgAPIKeyHeader = savedMode, savedToken, savedHeader }()
+
+	SdgAuthMode, SdgToken, SdgAPIKeyHeader = sdgAuthMTLS, "", "X-API-Key"
+	assert.NoError(t, validateSDGAuth())
+	SdgAuthMode = sdgAuthBearer
+	assert.Error(t, validateSDGAuth())
+	SdgToken = "secret"
+	assert.NoError(t, validateSDGAuth())
+	SdgAuthMode = "oauth"
+	assert.Error(t, validateSDGAuth())
+}
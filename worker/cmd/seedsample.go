@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+const seedSamplingFilename = "seed_sampling.json"
+
+// The strategies choosing the seed examples sent to SDG when a file has more than --max-seed
+const (
+	// seedSampleFirst keeps the first examples of the file
+	seedSampleFirst = "first"
+	// seedSampleRandom keeps a random sample, the same for the same --max-seed-random-seed
+	seedSampleRandom = "random"
+	// seedSampleStratified keeps examples of every context in turn, so no context is left out
+	// while another one has several examples kept
+	seedSampleStratified = "stratified"
+)
+
+// validateSeedSampling checks the --max-seed-strategy flag
+func validateSeedSampling(strategy string) error {
+	switch strategy {
+	case seedSampleFirst, seedSampleRandom, seedSampleStratified:
+		return nil
+	}
+	return fmt.Errorf("unknown max seed strategy %q, expected %s, %s or %s", strategy, seedSampleFirst, seedSampleRandom, seedSampleStratified)
+}
+
+// sampleSeedExamples returns the indexes of the max examples kept by the strategy, in the order of
+// the file
+func sampleSeedExamples(examples []interface{}, max int, strategy string, seed int64) []int {
+	if max >= len(examples) {
+		max = len(examples)
+	}
+	var kept []int
+	switch strategy {
+	case seedSampleRandom:
+		kept = rand.New(rand.NewSource(seed)).Perm(len(examples))[:max]
+	case seedSampleStratified:
+		kept = stratifiedSample(examples, max)
+	default:
+		for i := 0; i < max; i++ {
+			kept = append(kept, i)
+		}
+	}
+	sort.Ints(kept)
+	return kept
+}
+
+// stratifiedSample takes one example of every context in turn, the contexts in the order they
+// first appear, until max examples are taken
+func stratifiedSample(examples []interface{}, max int) []int {
+	var contexts []string
+	groups := make(map[string][]int)
+	for i, example := range examples {
+		context := seedExampleField(example, "context")
+		if _, ok := groups[context]; !ok {
+			contexts = append(contexts, context)
+		}
+		groups[context] = append(groups[context], i)
+	}
+
+	var kept []int
+	for round := 0; len(kept) < max; round++ {
+		for _, context := range contexts {
+			if round < len(groups[context]) && len(kept) < max {
+				kept = append(kept, groups[context][round])
+			}
+		}
+	}
+	return kept
+}
+
+// seedExampleField returns a string field of a seed example, "" when it has none
+func seedExampleField(example interface{}, field string) string {
+	var value interface{}
+	switch e := example.(type) {
+	case map[interface{}]interface{}:
+		value = e[field]
+	case map[string]interface{}:
+		value = e[field]
+	}
+	s, _ := value.(string)
+	return s
+}
+
+// droppedSeedExample is a seed example left out by the sampling
+type droppedSeedExample struct {
+	Index    int    `json:"index"`
+	Question string `json:"question,omitempty"`
+	Context  string `json:"context,omitempty"`
+}
+
+// seedSampling records which seed examples of a file were sent to SDG
+type seedSampling struct {
+	File     string               `json:"file"`
+	Strategy string               `json:"strategy"`
+	Seed     *int64               `json:"seed,omitempty"`
+	Total    int                  `json:"total"`
+	Kept     []int                `json:"kept"`
+	Dropped  []droppedSeedExample `json:"dropped"`
+}
+
+// newSeedSampling describes the sample of the examples of file, kept being their indexes
+func newSeedSampling(file, strategy string, seed int64, examples []interface{}, kept []int) seedSampling {
+	sampling := seedSampling{File: file, Strategy: strategy, Total: len(examples), Kept: kept}
+	if strategy == seedSampleRandom {
+		sampling.Seed = &seed
+	}
+	isKept := make(map[int]bool, len(kept))
+	for _, i := range kept {
+		isKept[i] = true
+	}
+	for i, example := range examples {
+		if !isKept[i] {
+			sampling.Dropped = append(sampling.Dropped, droppedSeedExample{
+				Index:    i,
+				Question: seedExampleField(example, "question"),
+				Context:  seedExampleField(example, "context"),
+			})
+		}
+	}
+	return sampling
+}
+
+// writeSeedSampling writes the sampled files into the output directory, nothing when no file was sampled
+func writeSeedSampling(outputDir string, samplings []seedSampling) error {
+	if len(samplings) == 0 {
+		return nil
+	}
+	content, err := json.MarshalIndent(samplings, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(outputDir, seedSamplingFilename), content, 0644); err != nil {
+		return fmt.Errorf("could not write %s: %w", seedSamplingFilename, err)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func seedExamples(contexts ...string) []interface{} {
+	var examples []interface{}
+	for i, context := range contexts {
+		examples = append(examples, map[interface{}]interface{}{"question": string(rune('a' + i)), "context": context})
+	}
+	return examples
+}
+
+// TestSampleSeedExamples verify every strategy keeps max examples, in the order of the file.
+func TestSampleSeedExamples(t *testing.T) {
+	examples := seedExamples("x", "x", "x", "x", "y", "z")
+
+	assert.Equal(t, []int{0, 1, 2}, sampleSeedExamples(examples, 3, seedSampleFirst, 1))
+	assert.Equal(t, []int{0, 1, 4, 5}, sampleSeedExamples(examples, 4, seedSampleStratified, 1))
+	assert.Equal(t, []int{0, 1, 2, 3, 4, 5}, sampleSeedExamples(examples, 10, seedSampleStratified, 1))
+
+	random := sampleSeedExamples(examples, 3, seedSampleRandom, 7)
+	assert.Len(t, random, 3)
+	assert.IsIncreasing(t, random)
+	assert.Equal(t, random, sampleSeedExamples(examples, 3, seedSampleRandom, 7), "the same seed keeps the same examples")
+
+	assert.NoError(t, validateSeedSampling(seedSampleStratified))
+	assert.Error(t, validateSeedSampling("last"))
+}
+
+// TestWriteSeedSampling verify the dropped examples are recorded with their question and context.
+func TestWriteSeedSampling(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, writeSeedSampling(dir, nil))
+	assert.NoFileExists(t, filepath.Join(dir, seedSamplingFilename))
+
+	examples := seedExamples("x", "y", "")
+	sampling := newSeedSampling("knowledge/a/qna.yaml", seedSampleRandom, 7, examples, []int{1})
+	assert.NoError(t, writeSeedSampling(dir, []seedSampling{sampling}))
+
+	content, err := os.ReadFile(filepath.Join(dir, seedSamplingFilename))
+	assert.NoError(t, err)
+	var decoded []seedSampling
+	assert.NoError(t, json.Unmarshal(content, &decoded))
+	if assert.Len(t, decoded, 1) {
+		assert.Equal(t, 3, decoded[0].Total)
+		assert.Equal(t, int64(7), *decoded[0].Seed)
+		assert.Equal(t, []droppedSeedExample{{Index: 0, Question: "a", Context: "x"}, {Index: 2, Question: "c"}}, decoded[0].Dropped)
+	}
+}
@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+const (
+	modelServeLogFilename = "ilab_serve.log"
+	modelServeHost        = "127.0.0.1"
+	modelServePollDelay   = time.Second
+	// modelServeStopTimeout is how long the model server has to exit once signaled before it is killed
+	modelServeStopTimeout = 15 * time.Second
+)
+
+// modelServer is an `ilab serve` child process serving the model of a local job
+type modelServer struct {
+	cmd *exec.Cmd
+	log *os.File
+	// endpoint is the OpenAI compatible base URL of the server
+	endpoint string
+	// exited is closed once the process exited, err is its exit error
+	exited chan struct{}
+	err    error
+}
+
+// needsLocalModel reports whether the job talks to a model served on the worker: generate-local
+// jobs, and precheck jobs without a remote precheck endpoint
+func needsLocalModel(jobType string) bool {
+	return jobType == jobGenerateLocal || (jobType == jobPreCheck && PreCheckEndpointURL == localEndpoint)
+}
+
+// freeLocalPort returns a TCP port nothing listens on
+func freeLocalPort() (int, error) {
+	listener, err := net.Listen("tcp", net.JoinHostPort(modelServeHost, "0"))
+	if err != nil {
+		return 0, err
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
+
+// startModelServer starts `ilab serve` on --serve-local-model-port, or on a free port, and waits
+// until it serves its model. Its output goes to ilab_serve.log in the output directory.
+func (w *Worker) startModelServer(lab, outputDir string) (*modelServer, error) {
+	port := ServeLocalModelPort
+	if port == 0 {
+		var err error
+		if port, err = freeLocalPort(); err != nil {
+			return nil, fmt.Errorf("could not find a free port for the model server: %w", err)
+		}
+	}
+	hostPort := net.JoinHostPort(modelServeHost, strconv.Itoa(port))
+
+	args := w.ilabArgs(ilabServe, "--host-port", hostPort)
+	if ServeLocalModelPath != "" {
+		args = append(args, "--model-path", ServeLocalModelPath)
+	}
+
+	logFile, err := os.Create(filepath.Join(outputDir, modelServeLogFilename))
+	if err != nil {
+		return nil, fmt.Errorf("could not create the model server log: %w", err)
+	}
+
+	// The server outlives the commands of the job, it can't run under the job context
+	cmd := exec.Command(lab, args...)
+	cmd.Dir = WorkDir
+	cmd.Env = w.subprocessEnv()
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	w.logger.Infof("Starting the model server: %s", cmd.String())
+	if err := cmd.Start(); err != nil {
+		logFile.Close()
+		return nil, fmt.Errorf("could not start the model server: %w", err)
+	}
+
+	server := &modelServer{
+		cmd:      cmd,
+		log:      logFile,
+		endpoint: "http://" + hostPort + "/v1",
+		exited:   make(chan struct{}),
+	}
+	go func() {
+		server.err = cmd.Wait()
+		close(server.exited)
+	}()
+
+	start := time.Now()
+	err = server.waitReady(w.ctx, ServeLocalReadyTimeout)
+	w.logStep("ilab serve", start, err)
+	if err != nil {
+		server.stop()
+		return nil, err
+	}
+	w.logger.Infof("Model server ready on %s after %s", server.endpoint, time.Since(start).Round(time.Second))
+	return server, nil
+}
+
+// waitReady polls the models of the server until it answers, it exits or the timeout expires
+func (s *modelServer) waitReady(ctx context.Context, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	client := &http.Client{Timeout: 5 * time.Second}
+	for {
+		if err := checkEndpointHealth(ctx, client, s.endpoint, ""); err == nil {
+			return nil
+		}
+		select {
+		case <-s.exited:
+			return fmt.Errorf("the model server exited before it was ready: %v, see %s", s.err, modelServeLogFilename)
+		case <-ctx.Done():
+			return fmt.Errorf("the model server was not ready after %s, see %s", timeout, modelServeLogFilename)
+		case <-time.After(modelServePollDelay):
+		}
+	}
+}
+
+// stop signals the model server to exit, kills it when it does not within modelServeStopTimeout,
+// and closes its log
+func (s *modelServer) stop() {
+	defer s.log.Close()
+	select {
+	case <-s.exited:
+		return
+	default:
+	}
+	_ = stopProcess(s.cmd.Process)
+	select {
+	case <-s.exited:
+	case <-time.After(modelServeStopTimeout):
+		_ = s.cmd.Process.Kill()
+		<-s.exited
+	}
+}
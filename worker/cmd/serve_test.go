@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// TestHelperModelServer is not a test, it stands in for `ilab serve` in TestStartModelServer
+func TestHelperModelServer(t *testing.T) {
+	if os.Getenv("ILWORKER_TEST_MODEL_SERVER") != "1" {
+		return
+	}
+	args := os.Args
+	for i, arg := range args {
+		if arg == "--host-port" && i+1 < len(args) {
+			fmt.Println("serving on", args[i+1])
+			http.HandleFunc("/v1/models", func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprintln(w, `{"object": "list", "data": [{"id": "merlinite", "object": "model"}]}`)
+			})
+			_ = http.ListenAndServe(args[i+1], nil)
+		}
+	}
+	os.Exit(2)
+}
+
+// fakeIlab writes an ilab script running the helper process of the test binary
+func fakeIlab(t *testing.T) string {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake ilab is a shell script")
+	}
+	lab := filepath.Join(t.TempDir(), "ilab")
+	script := fmt.Sprintf("#!/bin/sh\nILWORKER_TEST_MODEL_SERVER=1 exec %s -test.run=TestHelperModelServer -- \"$@\"\n", os.Args[0])
+	assert.NoError(t, os.WriteFile(lab, []byte(script), 0755))
+	return lab
+}
+
+// TestStartModelServer verify the model server is started on a free port, probed until ready and stopped.
+func TestStartModelServer(t *testing.T) {
+	saved := ServeLocalReadyTimeout
+	ServeLocalReadyTimeout = 30 * time.Second
+	defer func() { ServeLocalReadyTimeout = saved }()
+
+	w := NewJobProcessor(context.Background(), nil, nil, zap.NewExample().Sugar(), "job-id", "", "", "", "", "", 20)
+	outputDir := t.TempDir()
+	server, err := w.startModelServer(fakeIlab(t), outputDir)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Regexp(t, `^http://127\.0\.0\.1:\d+/v1$`, server.endpoint)
+	assert.NoError(t, checkEndpointHealth(context.Background(), http.DefaultClient, server.endpoint, ""))
+
+	server.stop()
+	assert.Error(t, checkEndpointHealth(context.Background(), http.DefaultClient, server.endpoint, ""))
+	log, err := os.ReadFile(filepath.Join(outputDir, modelServeLogFilename))
+	assert.NoError(t, err)
+	assert.Contains(t, string(log), "serving on 127.0.0.1:")
+}
+
+// TestStartModelServerExits negative test that a model server exiting before it is ready fails the job.
+func TestStartModelServerExits(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake ilab is a shell script")
+	}
+	saved := ServeLocalReadyTimeout
+	ServeLocalReadyTimeout = 30 * time.Second
+	defer func() { ServeLocalReadyTimeout = saved }()
+	lab := filepath.Join(t.TempDir(), "ilab")
+	assert.NoError(t, os.WriteFile(lab, []byte("#!/bin/sh\necho 'model not found' >&2\nexit 1\n"), 0755))
+
+	w := NewJobProcessor(context.Background(), nil, nil, zap.NewExample().Sugar(), "job-id", "", "", "", "", "", 20)
+	outputDir := t.TempDir()
+	_, err := w.startModelServer(lab, outputDir)
+	assert.ErrorContains(t, err, "exited before it was ready")
+	log, _ := os.ReadFile(filepath.Join(outputDir, modelServeLogFilename))
+	assert.Equal(t, "model not found\n", string(log))
+}
+
+// TestNeedsLocalModel verify only generate-local jobs and local prechecks start a model server.
+func TestNeedsLocalModel(t *testing.T) {
+	saved := PreCheckEndpointURL
+	defer func() { PreCheckEndpointURL = saved }()
+
+	PreCheckEndpointURL = localEndpoint
+	assert.True(t, needsLocalModel(jobGenerateLocal))
+	assert.True(t, needsLocalModel(jobPreCheck))
+	assert.False(t, needsLocalModel(jobTrain))
+
+	PreCheckEndpointURL = "https://merlinite.example.com/v1"
+	assert.False(t, needsLocalModel(jobPreCheck))
+}
@@ -0,0 +1,244 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const precheckScoresFilename = "precheck_scores.html"
+
+// similarityScores compares the answer of a seed example with the answer of the model
+type similarityScores struct {
+	Cosine *float64 `json:"cosine,omitempty" yaml:"cosine,omitempty"`
+	RougeL float64  `json:"rouge_l" yaml:"rouge_l"`
+	BLEU   float64  `json:"bleu" yaml:"bleu"`
+}
+
+// Score is the single value the report sorts by, the embedding similarity when available
+func (s similarityScores) Score() float64 {
+	if s.Cosine != nil {
+		return *s.Cosine
+	}
+	return s.RougeL
+}
+
+// precheckScore is one row of the precheck similarity report
+type precheckScore struct {
+	File           string
+	Model          string
+	Question       string
+	ExpectedAnswer string
+	ModelAnswer    string
+	Scores         similarityScores
+	// Change is how the answer changed since the previous precheck of the PR, "" on the first one
+	Change string
+}
+
+type embeddingsRequest struct {
+	Model string   `json:"model,omitempty"`
+	Input []string `json:"input"`
+}
+
+type embeddingsResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float64 `json:"embedding"`
+	} `json:"data"`
+}
+
+// compareAnswers computes the lexical metrics of the two answers and, when an embeddings
+// endpoint is configured, their cosine similarity
+func (w *Worker) compareAnswers(ctx context.Context, client *http.Client, expected, actual string) similarityScores {
+	scores := similarityScores{
+		RougeL: rougeL(expected, actual),
+		BLEU:   bleu(expected, actual),
+	}
+	if EmbeddingsEndpointURL == "" {
+		return scores
+	}
+
+	embeddings, err := fetchEmbeddings(ctx, client, []string{expected, actual})
+	if err != nil {
+		w.logger.Errorf("Could not compute embedding similarity: %v", err)
+		return scores
+	}
+	cosine := cosineSimilarity(embeddings[0], embeddings[1])
+	scores.Cosine = &cosine
+	return scores
+}
+
+// fetchEmbeddings requests the embeddings of the texts from the OpenAI compatible embeddings endpoint
+func fetchEmbeddings(ctx context.Context, client *http.Client, texts []string) ([][]float64, error) {
+	body, err := json.Marshal(embeddingsRequest{Model: EmbeddingsModel, Input: texts})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal embeddings request: %w", err)
+	}
+	url := strings.TrimSuffix(EmbeddingsEndpointURL, "/") + "/embeddings"
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if EmbeddingsAPIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+EmbeddingsAPIKey)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute embeddings request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read embeddings response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	var embResp embeddingsResponse
+	if err := json.Unmarshal(respBody, &embResp); err != nil {
+		return nil, fmt.Errorf("failed to parse embeddings response: %w", err)
+	}
+	if len(embResp.Data) != len(texts) {
+		return nil, fmt.Errorf("expected %d embeddings, got %d", len(texts), len(embResp.Data))
+	}
+
+	embeddings := make([][]float64, len(texts))
+	for i, d := range embResp.Data {
+		idx := d.Index
+		if idx < 0 || idx >= len(texts) {
+			idx = i
+		}
+		embeddings[idx] = d.Embedding
+	}
+	return embeddings, nil
+}
+
+// cosineSimilarity of two vectors, 0 if either is empty or their lengths differ
+func cosineSimilarity(a, b []float64) float64 {
+	if len(a) == 0 || len(a) != len(b) {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// tokenize lowercases the text and splits it into words
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// rougeL is the ROUGE-L F1 score, based on the longest common subsequence of words
+func rougeL(reference, candidate string) float64 {
+	ref, cand := tokenize(reference), tokenize(candidate)
+	if len(ref) == 0 || len(cand) == 0 {
+		return 0
+	}
+
+	prev := make([]int, len(cand)+1)
+	curr := make([]int, len(cand)+1)
+	for i := 1; i <= len(ref); i++ {
+		for j := 1; j <= len(cand); j++ {
+			if ref[i-1] == cand[j-1] {
+				curr[j] = prev[j-1] + 1
+			} else if prev[j] >= curr[j-1] {
+				curr[j] = prev[j]
+			} else {
+				curr[j] = curr[j-1]
+			}
+		}
+		prev, curr = curr, prev
+	}
+	lcs := float64(prev[len(cand)])
+	if lcs == 0 {
+		return 0
+	}
+	precision := lcs / float64(len(cand))
+	recall := lcs / float64(len(ref))
+	return 2 * precision * recall / (precision + recall)
+}
+
+// bleu is the sentence level BLEU-4 score with add-one smoothing of the higher order n-grams
+func bleu(reference, candidate string) float64 {
+	ref, cand := tokenize(reference), tokenize(candidate)
+	if len(ref) == 0 || len(cand) == 0 {
+		return 0
+	}
+
+	const maxN = 4
+	var logPrecision float64
+	for n := 1; n <= maxN; n++ {
+		refCounts := ngramCounts(ref, n)
+		candCounts := ngramCounts(cand, n)
+		var matches, total int
+		for gram, count := range candCounts {
+			total += count
+			if refCount := refCounts[gram]; refCount < count {
+				matches += refCount
+			} else {
+				matches += count
+			}
+		}
+		if n == 1 {
+			if matches == 0 {
+				return 0
+			}
+			logPrecision += math.Log(float64(matches) / float64(total))
+		} else {
+			logPrecision += math.Log(float64(matches+1) / float64(total+1))
+		}
+	}
+
+	brevity := 1.0
+	if len(cand) < len(ref) {
+		brevity = math.Exp(1 - float64(len(ref))/float64(len(cand)))
+	}
+	return brevity * math.Exp(logPrecision/maxN)
+}
+
+func ngramCounts(tokens []string, n int) map[string]int {
+	counts := make(map[string]int)
+	for i := 0; i+n <= len(tokens); i++ {
+		counts[strings.Join(tokens[i:i+n], " ")]++
+	}
+	return counts
+}
+
+// writePrecheckScores writes the similarity report into the output directory, most divergent answers first
+func writePrecheckScores(outputDir string, rows []precheckScore) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		return rows[i].Scores.Score() < rows[j].Scores.Score()
+	})
+
+	reportFile, err := os.Create(filepath.Join(outputDir, precheckScoresFilename))
+	if err != nil {
+		return fmt.Errorf("could not create %s: %w", precheckScoresFilename, err)
+	}
+	defer reportFile.Close()
+	return generateScoresHTML(reportFile, rows)
+}
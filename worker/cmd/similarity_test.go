@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestLexicalSimilarity verify ROUGE-L and BLEU rank close answers above divergent ones.
+func TestLexicalSimilarity(t *testing.T) {
+	reference := "The capital of France is Paris."
+
+	assert.InDelta(t, 1.0, rougeL(reference, "the capital of france is paris"), 1e-9)
+	assert.InDelta(t, 1.0, bleu(reference, "The capital of France is Paris!"), 1e-9)
+
+	// LCS of "the capital is paris" is 4 words: P=4/4, R=4/6
+	assert.InDelta(t, 0.8, rougeL(reference, "The capital is Paris"), 1e-9)
+
+	near := bleu(reference, "Paris is the capital of France.")
+	divergent := bleu(reference, "I do not know the answer.")
+	assert.Greater(t, near, divergent)
+	assert.Zero(t, bleu(reference, "Bonjour"))
+	assert.Zero(t, rougeL(reference, ""))
+}
+
+// TestCosineSimilarity verify the cosine of identical, orthogonal and mismatched vectors.
+func TestCosineSimilarity(t *testing.T) {
+	assert.InDelta(t, 1.0, cosineSimilarity([]float64{1, 2, 3}, []float64{2, 4, 6}), 1e-9)
+	assert.InDelta(t, 0.0, cosineSimilarity([]float64{1, 0}, []float64{0, 1}), 1e-9)
+	assert.Zero(t, cosineSimilarity([]float64{1, 0}, []float64{1}))
+}
+
+// TestWritePrecheckScores verify the report lists the most divergent answer first.
+func TestWritePrecheckScores(t *testing.T) {
+	dir := t.TempDir()
+	cosine := 0.2
+	rows := []precheckScore{
+		{File: "knowledge/a/qna.yaml", Question: "Q1", ExpectedAnswer: "A", ModelAnswer: "A", Scores: similarityScores{RougeL: 0.9}},
+		{File: "knowledge/a/qna.yaml", Question: "Q2 <b>", ExpectedAnswer: "B", ModelAnswer: "C", Scores: similarityScores{RougeL: 0.9, Cosine: &cosine}},
+	}
+	assert.NoError(t, writePrecheckScores(dir, rows))
+
+	content, err := os.ReadFile(path.Join(dir, precheckScoresFilename))
+	assert.NoError(t, err)
+	html := string(content)
+	assert.Contains(t, html, "Q2 &lt;b&gt;", "report content should be escaped")
+	assert.Less(t, strings.Index(html, "Q2 &lt;b&gt;"), strings.Index(html, ">Q1<"), "the lowest score should be listed first")
+	assert.Contains(t, html, "0.200")
+}
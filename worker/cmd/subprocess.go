@@ -0,0 +1,155 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// defaultEnvPolicy is the key of the subprocess environment policy applied to every job type
+const defaultEnvPolicy = "default"
+
+// workerCredentialEnv are never passed to the ilab commands unless a policy allows them
+var workerCredentialEnv = []string{"AWS_*", "ILWORKER_*", "GITHUB_TOKEN", "GH_TOKEN"}
+
+// baseEnv is what a scrubbed environment starts with, for the commands to run at all and find the GPUs
+var baseEnv = []string{
+	"PATH", "HOME", "TMPDIR", "LANG", "LC_*", "TZ", "USER", "LOGNAME", "SHELL", "TERM", "VIRTUAL_ENV",
+	"CUDA_*", "NVIDIA_*", "ROCM_*", "HIP_*",
+	// Windows
+	"SYSTEMROOT", "WINDIR", "COMSPEC", "PATHEXT", "USERPROFILE", "TMP", "TEMP",
+}
+
+// jobHomeEnv point at the HOME and temporary directory of a job with an isolated home
+var jobHomeEnv = []string{"HOME", "USERPROFILE", "TMPDIR", "TMP", "TEMP"}
+
+// subprocessEnvConfig controls the environment of the ilab commands. Variables matching allow are
+// always kept; the others are dropped when scrub is set or when they match deny. A trailing *
+// matches any suffix.
+type subprocessEnvConfig struct {
+	Scrub *bool `yaml:"scrub"`
+	// IsolateHome gives every job its own HOME and temporary directory, removed after the job
+	IsolateHome *bool    `yaml:"isolate_home"`
+	Allow       []string `yaml:"allow"`
+	Deny        []string `yaml:"deny"`
+}
+
+// subprocessEnvPolicies are keyed by job type, the default policy applies to all of them
+var subprocessEnvPolicies map[string]subprocessEnvConfig
+
+// envPolicy is the subprocess environment policy of a job type
+type envPolicy struct {
+	scrub       bool
+	isolateHome bool
+	allow       []string
+	deny        []string
+}
+
+// envPolicyFor merges the default policy with the one of the job type, the job type settings win
+// and its lists extend the default ones
+func envPolicyFor(policies map[string]subprocessEnvConfig, jobType string) envPolicy {
+	var policy envPolicy
+	for _, key := range []string{defaultEnvPolicy, jobType} {
+		cfg, ok := policies[key]
+		if !ok {
+			continue
+		}
+		if cfg.Scrub != nil {
+			policy.scrub = *cfg.Scrub
+		}
+		if cfg.IsolateHome != nil {
+			policy.isolateHome = *cfg.IsolateHome
+		}
+		policy.allow = append(policy.allow, cfg.Allow...)
+		policy.deny = append(policy.deny, cfg.Deny...)
+	}
+	if policy.scrub {
+		policy.allow = append(policy.allow, baseEnv...)
+	}
+	return policy
+}
+
+// filter returns the variables of environ the policy lets through, the worker credentials are
+// only let through when allowed
+func (p envPolicy) filter(environ []string) []string {
+	var env []string
+	for _, kv := range environ {
+		name, _, _ := strings.Cut(kv, "=")
+		if matchesEnv(p.allow, name) || (!p.scrub && !matchesEnv(p.deny, name) && !matchesEnv(workerCredentialEnv, name)) {
+			env = append(env, kv)
+		}
+	}
+	return env
+}
+
+func matchesEnv(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if name == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// validateSubprocessEnv checks the policies are keyed by job type and their patterns only use a trailing *
+func validateSubprocessEnv(policies map[string]subprocessEnvConfig) error {
+	for key, cfg := range policies {
+		switch key {
+		case defaultEnvPolicy, jobGenerateLocal, jobPreCheck, jobSDG, jobTrain, jobEvaluate:
+		default:
+			return fmt.Errorf("unknown job type %q in subprocess_env", key)
+		}
+		for _, pattern := range append(append([]string{}, cfg.Allow...), cfg.Deny...) {
+			if pattern == "" || strings.Contains(strings.TrimSuffix(pattern, "*"), "*") {
+				return fmt.Errorf("invalid environment variable pattern %q in subprocess_env %s, only a trailing * is supported", pattern, key)
+			}
+		}
+	}
+	return nil
+}
+
+// prepareJobHome creates the HOME and temporary directory of the job when its policy isolates them.
+// The returned function removes them.
+func (w *Worker) prepareJobHome() (func(), error) {
+	w.envPolicy = envPolicyFor(subprocessEnvPolicies, w.jobType)
+	if !w.envPolicy.isolateHome {
+		return func() {}, nil
+	}
+	dir, err := os.MkdirTemp("", fmt.Sprintf("ilab-job-%s-", w.job))
+	if err != nil {
+		return nil, fmt.Errorf("could not create the home directory of job %s: %w", w.job, err)
+	}
+	for _, sub := range []string{"home", "tmp"} {
+		if err := os.Mkdir(filepath.Join(dir, sub), 0700); err != nil {
+			_ = os.RemoveAll(dir)
+			return nil, fmt.Errorf("could not create the home directory of job %s: %w", w.job, err)
+		}
+	}
+	w.jobHome = dir
+	return func() {
+		if err := os.RemoveAll(dir); err != nil {
+			w.logger.Errorf("Could not remove the home directory of job %s: %v", w.job, err)
+		}
+	}, nil
+}
+
+// subprocessEnv is the environment of the ilab commands of the job
+func (w *Worker) subprocessEnv() []string {
+	env := w.envPolicy.filter(os.Environ())
+	if w.jobHome != "" {
+		// Only the home variables are replaced, the credentials the policy allowed are kept
+		env = slices.DeleteFunc(env, func(kv string) bool {
+			name, _, _ := strings.Cut(kv, "=")
+			return matchesEnv(jobHomeEnv, name)
+		})
+		home, tmp := filepath.Join(w.jobHome, "home"), filepath.Join(w.jobHome, "tmp")
+		env = append(env, "HOME="+home, "USERPROFILE="+home, "TMPDIR="+tmp, "TMP="+tmp, "TEMP="+tmp)
+	}
+	return env
+}
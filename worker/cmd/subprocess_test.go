@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+var testEnviron = []string{
+	"PATH=/usr/bin",
+	"HOME=/home/worker",
+	"AWS_SECRET_ACCESS_KEY=secret",
+	"ILWORKER_GITHUB_TOKEN=token",
+	"HF_TOKEN=hf",
+	"CUDA_VISIBLE_DEVICES=0",
+	"OTHER=value",
+}
+
+// TestEnvPolicyFilter verify the worker credentials never reach the ilab commands unless allowed.
+func TestEnvPolicyFilter(t *testing.T) {
+	inherit := envPolicyFor(nil, jobTrain)
+	assert.Equal(t, []string{"PATH=/usr/bin", "HOME=/home/worker", "HF_TOKEN=hf", "CUDA_VISIBLE_DEVICES=0", "OTHER=value"}, inherit.filter(testEnviron))
+
+	scrub := true
+	policies := map[string]subprocessEnvConfig{
+		defaultEnvPolicy: {Deny: []string{"HF_*"}},
+		jobTrain:         {Scrub: &scrub, Allow: []string{"HF_TOKEN", "AWS_SECRET_ACCESS_KEY"}},
+	}
+	assert.Equal(t, []string{"PATH=/usr/bin", "HOME=/home/worker", "CUDA_VISIBLE_DEVICES=0", "OTHER=value"},
+		envPolicyFor(policies, jobPreCheck).filter(testEnviron))
+	assert.Equal(t, []string{"PATH=/usr/bin", "HOME=/home/worker", "AWS_SECRET_ACCESS_KEY=secret", "HF_TOKEN=hf", "CUDA_VISIBLE_DEVICES=0"},
+		envPolicyFor(policies, jobTrain).filter(testEnviron))
+}
+
+// TestValidateSubprocessEnv verify policies are keyed by job type and only use trailing wildcards.
+func TestValidateSubprocessEnv(t *testing.T) {
+	assert.NoError(t, validateSubprocessEnv(map[string]subprocessEnvConfig{defaultEnvPolicy: {Allow: []string{"HF_*"}}, jobTrain: {}}))
+	assert.Error(t, validateSubprocessEnv(map[string]subprocessEnvConfig{"unknown": {}}))
+	assert.Error(t, validateSubprocessEnv(map[string]subprocessEnvConfig{jobTrain: {Deny: []string{"*_TOKEN"}}}))
+}
+
+// TestJobHome verify an isolated job gets its own HOME and temporary directory, removed after the job.
+func TestJobHome(t *testing.T) {
+	isolate := true
+	subprocessEnvPolicies = map[string]subprocessEnvConfig{jobGenerateLocal: {IsolateHome: &isolate}}
+	defer func() { subprocessEnvPolicies = nil }()
+
+	w := &Worker{job: "42", jobType: jobGenerateLocal, logger: zap.NewNop().Sugar()}
+	cleanup, err := w.prepareJobHome()
+	assert.NoError(t, err)
+	home := filepath.Join(w.jobHome, "home")
+	assert.DirExists(t, home)
+
+	env := w.subprocessEnv()
+	assert.Contains(t, env, "HOME="+home)
+	assert.Contains(t, env, "TMPDIR="+filepath.Join(w.jobHome, "tmp"))
+	assert.NotContains(t, env, "HOME="+os.Getenv("HOME"))
+
+	cleanup()
+	assert.NoDirExists(t, w.jobHome)
+}
+
+// TestJobHomeAllow verify the credentials a policy allows are still passed to an isolated job.
+func TestJobHomeAllow(t *testing.T) {
+	isolate := true
+	subprocessEnvPolicies = map[string]subprocessEnvConfig{jobTrain: {IsolateHome: &isolate, Allow: []string{"AWS_*", "GITHUB_TOKEN"}}}
+	defer func() { subprocessEnvPolicies = nil }()
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("GITHUB_TOKEN", "token")
+	t.Setenv("GH_TOKEN", "other")
+
+	w := &Worker{job: "42", jobType: jobTrain, logger: zap.NewNop().Sugar()}
+	cleanup, err := w.prepareJobHome()
+	assert.NoError(t, err)
+	defer cleanup()
+
+	env := w.subprocessEnv()
+	assert.Contains(t, env, "AWS_SECRET_ACCESS_KEY=secret")
+	assert.Contains(t, env, "GITHUB_TOKEN=token")
+	assert.NotContains(t, env, "GH_TOKEN=other")
+	assert.Contains(t, env, "HOME="+filepath.Join(w.jobHome, "home"))
+	assert.NotContains(t, env, "HOME="+os.Getenv("HOME"))
+}
@@ -0,0 +1,332 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/instructlab/instructlab-bot/pkg/jobqueue"
+)
+
+const (
+	precheckSummaryFilename = "precheck_summary.md"
+	// maxSummaryLength keeps the summary well within the 65536 character limit of a GitHub comment
+	maxSummaryLength       = 60000
+	summaryQuestionLength  = 80
+	summaryAnswerLength    = 120
+	lowSimilarityThreshold = 0.5
+)
+
+// precheckSummaryRow is a single answered precheck question
+type precheckSummaryRow struct {
+	File string
+	// Kind is the taxonomy type of the file, knowledge or skill
+	Kind         string
+	Model        string
+	Question     string
+	Answer       string
+	FinishReason string
+	Scores       *similarityScores
+	// WithoutContext is the answer to the question asked without its context by a grounded precheck
+	WithoutContext *groundedAnswer
+	// Paraphrases are the answers to the question asked in other words
+	Paraphrases []paraphraseAnswer
+	// Change compares the answer with the previous precheck of the PR
+	Change *answerChange
+	// TooLong answers are over --precheck-max-answer-length, cut or whole depending on the policy
+	TooLong bool
+	// QuestionLanguage and AnswerLanguage are detected with --precheck-language-check, "" when not told
+	QuestionLanguage string
+	AnswerLanguage   string
+}
+
+// skippedQuestion is a precheck question that could not be answered
+type skippedQuestion struct {
+	File     string `json:"file"`
+	Model    string `json:"model,omitempty"`
+	Question string `json:"question"`
+	Reason   string `json:"reason"`
+	// Timeout questions got no answer within --precheck-question-timeout
+	Timeout bool `json:"timeout,omitempty"`
+}
+
+// flag describes why a reviewer may want to look at the answer, if at all
+func (r precheckSummaryRow) flag() string {
+	var flags []string
+	if r.Scores != nil && r.Scores.Score() < lowSimilarityThreshold {
+		flags = append(flags, "⚠️ low similarity")
+	}
+	switch answerIssue(r.Answer, r.FinishReason) {
+	case answerEmpty:
+		flags = append(flags, "∅ empty")
+	case answerTruncated:
+		flags = append(flags, "✂️ truncated")
+	case answerFiltered:
+		flags = append(flags, "🚫 filtered")
+	}
+	if r.TooLong {
+		flags = append(flags, "📏 too long")
+	}
+	if r.inconsistent() {
+		flags = append(flags, "🔀 inconsistent")
+	}
+	if r.languageMismatch() {
+		flags = append(flags, "🌐 "+r.AnswerLanguage+" answer")
+	}
+	return strings.Join(flags, ", ")
+}
+
+// The issues of answers that are not complete, a comparison using them is partial
+const (
+	answerEmpty     = "empty"
+	answerTruncated = "truncated"
+	answerFiltered  = "filtered"
+)
+
+// answerKinds counts the answers per taxonomy type
+func answerKinds(rows []precheckSummaryRow) map[string]int {
+	kinds := make(map[string]int)
+	for _, row := range rows {
+		if row.Kind != "" {
+			kinds[row.Kind]++
+		}
+	}
+	return kinds
+}
+
+// kindLabel is the taxonomy type shown after the file in the details of an answer
+func kindLabel(kind string) string {
+	if kind == "" {
+		return ""
+	}
+	return " (" + kind + ")"
+}
+
+// answerIssue tells whether the answer is empty, cut short by max_tokens or by the content
+// filter of the model server, "" for a complete answer
+func answerIssue(answer, finishReason string) string {
+	switch {
+	case strings.TrimSpace(answer) == "":
+		return answerEmpty
+	case finishReason == "length":
+		return answerTruncated
+	case finishReason == "content_filter":
+		return answerFiltered
+	}
+	return ""
+}
+
+// answerWarnings are the notices of an answer recorded in its chat log: the requests that failed
+// before it, and why the answer is not complete
+func answerWarnings(result *chatResult) []string {
+	warnings := append([]string(nil), result.Warnings...)
+	switch answerIssue(result.Answer, result.FinishReason) {
+	case answerEmpty:
+		warnings = append(warnings, "the model returned an empty answer")
+	case answerTruncated:
+		warnings = append(warnings, "the answer was truncated at the max_tokens limit")
+	case answerFiltered:
+		warnings = append(warnings, "the answer was cut by the content filter of the model server")
+	}
+	return warnings
+}
+
+// summaryColumn is a column of the precheck summary table, cell renders the row at an index
+type summaryColumn struct {
+	name string
+	cell func(i int, row precheckSummaryRow) string
+}
+
+// summaryColumns are the columns of the precheck summary table, with the model of each answer when
+// the models are compared and the change of each answer when the PR was prechecked before
+func summaryColumns(compare, changes bool) []summaryColumn {
+	columns := []summaryColumn{
+		{"#", func(i int, _ precheckSummaryRow) string { return strconv.Itoa(i + 1) }},
+		{"File", func(_ int, row precheckSummaryRow) string { return markdownCell(path.Dir(row.File), 0) }},
+		{"Question", func(_ int, row precheckSummaryRow) string { return markdownCell(row.Question, summaryQuestionLength) }},
+	}
+	if compare {
+		columns = append(columns, summaryColumn{"Model", func(_ int, row precheckSummaryRow) string { return markdownCell(row.Model, 0) }})
+	}
+	columns = append(columns,
+		summaryColumn{"Model answer", func(_ int, row precheckSummaryRow) string { return markdownCell(row.Answer, summaryAnswerLength) }},
+		summaryColumn{"Score", func(_ int, row precheckSummaryRow) string {
+			if row.Scores == nil {
+				return "-"
+			}
+			return fmt.Sprintf("%.2f", row.Scores.Score())
+		}},
+		summaryColumn{"Flag", func(_ int, row precheckSummaryRow) string { return row.flag() }},
+	)
+	if changes {
+		columns = append(columns, summaryColumn{"Change", func(_ int, row precheckSummaryRow) string { return row.Change.label(row.Scores) }})
+	}
+	return columns
+}
+
+// precheckMarkdownSummary renders the answers as a markdown table followed by collapsible
+// sections holding the full answers
+func precheckMarkdownSummary(rows []precheckSummaryRow, skipped []skippedQuestion) string {
+	if len(rows) == 0 && len(skipped) == 0 {
+		return ""
+	}
+
+	compare := false
+	for _, row := range rows {
+		if row.Model != "" {
+			compare = true
+		}
+	}
+
+	var table strings.Builder
+	table.WriteString("### Precheck summary\n\n")
+	if kinds := answerKinds(rows); len(kinds) > 1 {
+		fmt.Fprintf(&table, "The PR changes knowledge and skill files, each checked with the prompts of its type: %d knowledge and %d skill answers.\n\n",
+			kinds[taxonomyTypeKnowledge], kinds[taxonomyTypeSkill])
+	}
+	changes := changeSummary(rows)
+	table.WriteString(changes)
+	columns := summaryColumns(compare, changes != "")
+	var header, separator strings.Builder
+	for _, column := range columns {
+		header.WriteString("| " + column.name + " ")
+		separator.WriteString("|" + strings.Repeat("-", len(column.name)+2))
+	}
+	table.WriteString(header.String() + "|\n" + separator.String() + "|\n")
+	for i, row := range rows {
+		cells := make([]string, 0, len(columns))
+		for _, column := range columns {
+			cells = append(cells, column.cell(i, row))
+		}
+		table.WriteString("| " + strings.Join(cells, " | ") + " |\n")
+	}
+
+	table.WriteString(groundedMarkdownSummary(rows))
+	table.WriteString(paraphraseMarkdownSummary(rows))
+	table.WriteString(languageMarkdownSummary(rows))
+
+	if len(skipped) > 0 {
+		fmt.Fprintf(&table, "\n#### Skipped questions\n\n%d questions could not be answered and are missing from the results:\n\n", len(skipped))
+		for _, q := range skipped {
+			question := markdownCell(q.Question, summaryQuestionLength)
+			if q.Model != "" {
+				question += " (" + q.Model + ")"
+			}
+			reason := markdownCell(q.Reason, summaryAnswerLength)
+			if q.Timeout {
+				reason = "**`" + timeoutMarker + "`** " + markdownCell(strings.TrimPrefix(q.Reason, timeoutMarker+": "), summaryAnswerLength)
+			}
+			fmt.Fprintf(&table, "- `%s`: %s — %s\n", q.File, question, reason)
+		}
+	}
+
+	var details strings.Builder
+	for i, row := range rows {
+		var section strings.Builder
+		title := markdownCell(row.Question, summaryQuestionLength)
+		if row.Model != "" {
+			title += " (" + row.Model + ")"
+		}
+		fmt.Fprintf(&section, "\n<details>\n<summary>%d. %s</summary>\n\n", i+1, title)
+		fmt.Fprintf(&section, "**File:** `%s`%s\n\n**Question:**\n\n%s\n\n**Model answer:**\n\n%s\n", row.File, kindLabel(row.Kind), quoteMarkdown(row.Question), quoteMarkdown(row.Answer))
+		if row.WithoutContext != nil {
+			fmt.Fprintf(&section, "\n**Model answer without the context:**\n\n%s\n", quoteMarkdown(row.WithoutContext.Answer))
+		}
+		if row.Change != nil && row.Change.Status != changeNew && row.Change.Status != changeUnchanged {
+			fmt.Fprintf(&section, "\n**Previous answer%s:**\n\n%s\n", previousCommitLabel(row.Change.PreviousCommit), quoteMarkdown(row.Change.PreviousAnswer))
+		}
+		for _, p := range row.Paraphrases {
+			fmt.Fprintf(&section, "\n**Paraphrase (similarity %.2f):**\n\n%s\n\n%s\n", p.Score, quoteMarkdown(p.Question), quoteMarkdown(p.Answer))
+		}
+		section.WriteString("\n</details>\n")
+
+		if table.Len()+details.Len()+section.Len() > maxSummaryLength {
+			fmt.Fprintf(&details, "\n_%d more answers are available in the full results._\n", len(rows)-i)
+			break
+		}
+		details.WriteString(section.String())
+	}
+
+	if table.Len()+details.Len() > maxSummaryLength {
+		return truncateString(table.String(), maxSummaryLength) + "\n\n_The summary was truncated, see the full results._\n"
+	}
+	return table.String() + details.String()
+}
+
+// markdownCell flattens text into a single table cell, truncated to maxLen runes when maxLen > 0
+func markdownCell(text string, maxLen int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if maxLen > 0 {
+		text = truncateString(text, maxLen)
+	}
+	return strings.ReplaceAll(markdownEscaper.Replace(text), "|", "\\|")
+}
+
+// quoteMarkdown renders text as a markdown block quote
+func quoteMarkdown(text string) string {
+	lines := strings.Split(strings.TrimSpace(markdownEscaper.Replace(text)), "\n")
+	for i, line := range lines {
+		lines[i] = "> " + line
+	}
+	return strings.Join(lines, "\n")
+}
+
+// markdownEscaper keeps the questions and answers from adding HTML to the comment of the bot or
+// mentioning GitHub users
+var markdownEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "@", "@\u200b")
+
+func truncateString(text string, maxLen int) string {
+	runes := []rune(text)
+	if len(runes) <= maxLen {
+		return text
+	}
+	return string(runes[:maxLen-1]) + "…"
+}
+
+// writePrecheckSummary saves the markdown summary with the job artifacts and on the job for the bot to post,
+// after the notice of the sample when only part of the PR was checked
+func (w *Worker) writePrecheckSummary(outputDir string, rows []precheckSummaryRow, skipped []skippedQuestion, sample *precheckSample) error {
+	w.setPrecheckMetrics(rows, skipped)
+	return w.writeSummary(outputDir, precheckSummaryFilename, sample.notice()+precheckMarkdownSummary(rows, skipped))
+}
+
+// writeSummary saves a markdown summary as filename in the output directory and on the job for the bot to post,
+// unless the summary is encrypted
+func (w *Worker) writeSummary(outputDir, filename, summary string) error {
+	if summary == "" {
+		return nil
+	}
+	if err := os.WriteFile(filepath.Join(outputDir, filename), []byte(summary), 0644); err != nil {
+		return fmt.Errorf("could not write %s: %w", filename, err)
+	}
+	// The answers of an encrypted summary are not posted on the PR either
+	if w.queue == nil || encryptedArtifact(filename) {
+		return nil
+	}
+
+	if err := w.setJobField(jobqueue.FieldSummary, secretRedactor.redact(summary)); err != nil {
+		return fmt.Errorf("could not set summary for job %s: %w", w.job, err)
+	}
+	return nil
+}
+
+// checkFailureBudget fails the job when more than PrecheckFailureBudget percent of the questions were skipped
+func checkFailureBudget(total int, skipped []skippedQuestion) error {
+	if total == 0 || len(skipped) == 0 {
+		return nil
+	}
+	failed := float64(len(skipped)) * 100 / float64(total)
+	if failed <= PrecheckFailureBudget {
+		return nil
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d of %d precheck questions failed (%.0f%%), over the %.0f%% failure budget:", len(skipped), total, failed, PrecheckFailureBudget)
+	for _, q := range skipped {
+		fmt.Fprintf(&sb, "\n- %s: %s: %s", q.File, truncateString(q.Question, summaryQuestionLength), q.Reason)
+	}
+	return fmt.Errorf("%s", sb.String())
+}
@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestPrecheckMarkdownSummary verify the summary table escapes, truncates and flags answers.
+func TestPrecheckMarkdownSummary(t *testing.T) {
+	assert.Empty(t, precheckMarkdownSummary(nil, nil))
+
+	low := similarityScores{RougeL: 0.1}
+	rows := []precheckSummaryRow{
+		{File: "knowledge/history/qna.yaml", Question: "Which is bigger, a | b?", Answer: "a\nis bigger", FinishReason: "stop"},
+		{File: "knowledge/history/qna.yaml", Question: "Why?", Answer: strings.Repeat("word ", 100), FinishReason: "length", Scores: &low},
+	}
+	summary := precheckMarkdownSummary(rows, nil)
+
+	assert.Contains(t, summary, "| 1 | knowledge/history | Which is bigger, a \\| b? | a is bigger | - |  |")
+	assert.Contains(t, summary, "| 0.10 | ⚠️ low similarity, ✂️ truncated |")
+	assert.Contains(t, summary, "…", "long answers should be truncated in the table")
+	assert.Contains(t, summary, "<summary>2. Why?</summary>")
+	assert.Contains(t, summary, "> a\n> is bigger", "full answers should be quoted in the details")
+}
+
+// TestPrecheckMarkdownSummaryCompare verify the model of each answer has its own column when the
+// models are compared.
+func TestPrecheckMarkdownSummaryCompare(t *testing.T) {
+	rows := []precheckSummaryRow{
+		{File: "knowledge/history/qna.yaml", Question: "Who won?", Model: "granite", Answer: "The home team"},
+		{File: "knowledge/history/qna.yaml", Question: "Who won?", Model: "merlinite", Answer: "The visitors"},
+	}
+	summary := precheckMarkdownSummary(rows, nil)
+	assert.Contains(t, summary, "| # | File | Question | Model | Model answer | Score | Flag |\n|---|------|----------|-------|--------------|-------|------|\n")
+	assert.Contains(t, summary, "| 2 | knowledge/history | Who won? | merlinite | The visitors | - |  |\n")
+}
+
+// TestPrecheckMarkdownSummaryEscape verify the questions and answers can't add HTML to the
+// comment or mention users.
+func TestPrecheckMarkdownSummaryEscape(t *testing.T) {
+	rows := []precheckSummaryRow{
+		{File: "knowledge/history/qna.yaml", Question: "Ask @octocat </details>", Answer: "<img src=x> & more", FinishReason: "stop"},
+	}
+	summary := precheckMarkdownSummary(rows, nil)
+	assert.Contains(t, summary, "| Ask @\u200boctocat &lt;/details&gt; | &lt;img src=x&gt; &amp; more |")
+	assert.Contains(t, summary, "> &lt;img src=x&gt; &amp; more")
+	assert.NotContains(t, summary, "@octocat")
+	assert.NotContains(t, summary, "<img")
+	assert.Equal(t, 1, strings.Count(summary, "</details>"))
+}
+
+// TestAnswerWarnings verify empty and cut answers are flagged after the failed requests.
+func TestAnswerWarnings(t *testing.T) {
+	assert.Empty(t, answerWarnings(&chatResult{Answer: "Paris.", FinishReason: "stop"}))
+	assert.Equal(t, []string{"request 1 to http://a failed: overloaded", "the model returned an empty answer"},
+		answerWarnings(&chatResult{Answer: "", FinishReason: "length", Warnings: []string{"request 1 to http://a failed: overloaded"}}))
+	assert.Equal(t, []string{"the answer was truncated at the max_tokens limit"}, answerWarnings(&chatResult{Answer: "Par", FinishReason: "length"}))
+	assert.Equal(t, answerFiltered, answerIssue("Par", "content_filter"))
+	assert.Equal(t, "∅ empty", precheckSummaryRow{Answer: "\n"}.flag())
+}
+
+// TestPrecheckMarkdownSummaryMixed verify a PR changing knowledge and skill files reports the answers of both.
+func TestPrecheckMarkdownSummaryMixed(t *testing.T) {
+	rows := []precheckSummaryRow{
+		{File: "knowledge/history/qna.yaml", Kind: taxonomyTypeKnowledge, Question: "Who won?", Answer: "The home team"},
+		{File: "compositional_skills/poetry/qna.yaml", Kind: taxonomyTypeSkill, Question: "Write a haiku", Answer: "Leaves fall"},
+		{File: "compositional_skills/poetry/qna.yaml", Kind: taxonomyTypeSkill, Question: "Write a limerick", Answer: "There once"},
+	}
+	summary := precheckMarkdownSummary(rows, nil)
+	assert.Contains(t, summary, "each checked with the prompts of its type: 1 knowledge and 2 skill answers")
+	assert.Contains(t, summary, "**File:** `knowledge/history/qna.yaml` (knowledge)")
+
+	summary = precheckMarkdownSummary(rows[1:], nil)
+	assert.NotContains(t, summary, "knowledge and skill files")
+}
+
+// TestPrecheckMarkdownSummaryLimit verify the summary stays within the comment size limit.
+func TestPrecheckMarkdownSummaryLimit(t *testing.T) {
+	var rows []precheckSummaryRow
+	for i := 0; i < 100; i++ {
+		rows = append(rows, precheckSummaryRow{File: "knowledge/a/qna.yaml", Question: "Q", Answer: strings.Repeat("x", 2000)})
+	}
+	summary := precheckMarkdownSummary(rows, nil)
+	assert.LessOrEqual(t, len(summary), maxSummaryLength)
+	assert.Contains(t, summary, "more answers are available in the full results")
+}
+
+// TestSkippedQuestions verify skipped questions are listed and the failure budget is enforced.
+func TestSkippedQuestions(t *testing.T) {
+	skipped := []skippedQuestion{{File: "knowledge/a/qna.yaml", Question: "Why?", Reason: "unexpected status code 503"}}
+
+	summary := precheckMarkdownSummary(nil, skipped)
+	assert.Contains(t, summary, "#### Skipped questions")
+	assert.Contains(t, summary, "- `knowledge/a/qna.yaml`: Why? — unexpected status code 503")
+
+	saved := PrecheckFailureBudget
+	PrecheckFailureBudget = 10
+	defer func() { PrecheckFailureBudget = saved }()
+
+	assert.NoError(t, checkFailureBudget(10, skipped), "10% of the questions is within the budget")
+	err := checkFailureBudget(5, skipped)
+	assert.ErrorContains(t, err, "1 of 5 precheck questions failed (20%), over the 10% failure budget")
+	assert.NoError(t, checkFailureBudget(0, nil))
+}
@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// knowledgeFolder is the top level folder of the knowledge contributions, the other
+// TaxonomyFolders hold skills
+const knowledgeFolder = "knowledge"
+
+// taxonomyFile is a changed file of the taxonomy, classified by its top level folder
+type taxonomyFile struct {
+	// Path is relative to the taxonomy root, with forward slashes
+	Path string
+	// Folder is the top level folder of the file, one of TaxonomyFolders
+	Folder string
+	// Kind is taxonomyTypeKnowledge or taxonomyTypeSkill
+	Kind string
+}
+
+// parseTaxonomyPath classifies a file by its top level folder relative to the taxonomy root.
+// Absolute paths under root are made relative to it. ok is false for the files outside
+// TaxonomyFolders.
+func parseTaxonomyPath(root, file string) (taxonomyFile, bool) {
+	file = strings.TrimSpace(file)
+	if root != "" && filepath.IsAbs(file) {
+		rel, err := filepath.Rel(root, file)
+		if err != nil {
+			return taxonomyFile{}, false
+		}
+		file = rel
+	}
+	file = path.Clean(strings.ReplaceAll(file, `\`, "/"))
+	if path.IsAbs(file) || file == ".." || strings.HasPrefix(file, "../") {
+		return taxonomyFile{}, false
+	}
+
+	folder, rest, found := strings.Cut(file, "/")
+	if !found || rest == "" {
+		return taxonomyFile{}, false
+	}
+	for _, taxonomyFolder := range TaxonomyFolders {
+		if folder != taxonomyFolder {
+			continue
+		}
+		kind := taxonomyTypeSkill
+		if folder == knowledgeFolder {
+			kind = taxonomyTypeKnowledge
+		}
+		return taxonomyFile{Path: file, Folder: folder, Kind: kind}, true
+	}
+	return taxonomyFile{}, false
+}
+
+// classifyTaxonomyFiles classifies the YAML files listed by ilab diff. The YAML files outside
+// TaxonomyFolders are returned apart, they are not contributions.
+func classifyTaxonomyFiles(root string, lines []string) (files []taxonomyFile, ignored []string) {
+	for _, line := range lines {
+		if !strings.HasSuffix(line, ".yaml") {
+			continue
+		}
+		if file, ok := parseTaxonomyPath(root, line); ok {
+			files = append(files, file)
+		} else {
+			ignored = append(ignored, line)
+		}
+	}
+	return files, ignored
+}
+
+// taxonomyFilePaths returns the paths of the files relative to the taxonomy root
+func taxonomyFilePaths(files []taxonomyFile) []string {
+	paths := make([]string, 0, len(files))
+	for _, file := range files {
+		paths = append(paths, file.Path)
+	}
+	return paths
+}
+
+// classifyChangedFiles classifies the files listed by ilab diff for the job, logging the YAML
+// files it leaves out
+func (w *Worker) classifyChangedFiles(lines []string) []taxonomyFile {
+	files, ignored := classifyTaxonomyFiles(w.taxonomyDir, lines)
+	for _, file := range ignored {
+		w.logger.Warnf("Ignoring %s, it is outside the taxonomy folders %s", file, strings.Join(TaxonomyFolders, ", "))
+	}
+	for _, file := range files {
+		w.logger.Debugf("Taxonomy file %s is a %s contribution", file.Path, file.Kind)
+	}
+	return files
+}
@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestParseTaxonomyPath verify files are classified by their top level folder relative to the taxonomy root.
+func TestParseTaxonomyPath(t *testing.T) {
+	tests := []struct {
+		file string
+		want taxonomyFile
+		ok   bool
+	}{
+		{"knowledge/history/qna.yaml", taxonomyFile{Path: "knowledge/history/qna.yaml", Folder: "knowledge", Kind: taxonomyTypeKnowledge}, true},
+		{"./compositional_skills/writing/knowledge/qna.yaml", taxonomyFile{Path: "compositional_skills/writing/knowledge/qna.yaml", Folder: "compositional_skills", Kind: taxonomyTypeSkill}, true},
+		{"/work/taxonomy/knowledge/science/qna.yaml", taxonomyFile{Path: "knowledge/science/qna.yaml", Folder: "knowledge", Kind: taxonomyTypeKnowledge}, true},
+		{`knowledge\history\qna.yaml`, taxonomyFile{Path: "knowledge/history/qna.yaml", Folder: "knowledge", Kind: taxonomyTypeKnowledge}, true},
+		{"taxonomy/knowledge/qna.yaml", taxonomyFile{}, false},
+		{"knowledge_base/qna.yaml", taxonomyFile{}, false},
+		{"../knowledge/qna.yaml", taxonomyFile{}, false},
+		{"/elsewhere/knowledge/qna.yaml", taxonomyFile{}, false},
+		{"knowledge", taxonomyFile{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseTaxonomyPath("/work/taxonomy", tt.file)
+		assert.Equal(t, tt.ok, ok, tt.file)
+		assert.Equal(t, tt.want, got, tt.file)
+	}
+}
+
+// TestClassifyTaxonomyFiles verify only the YAML files of the taxonomy folders are kept, the folders being configurable.
+func TestClassifyTaxonomyFiles(t *testing.T) {
+	saved := TaxonomyFolders
+	defer func() { TaxonomyFolders = saved }()
+
+	lines := []string{"knowledge/a/qna.yaml", "knowledge/a/doc.md", "foundational_skills/b/qna.yaml", ".yamllint.yaml"}
+	files, ignored := classifyTaxonomyFiles("", lines)
+	assert.Equal(t, []string{"knowledge/a/qna.yaml"}, taxonomyFilePaths(files))
+	assert.Equal(t, []string{"foundational_skills/b/qna.yaml", ".yamllint.yaml"}, ignored)
+
+	TaxonomyFolders = []string{"compositional_skills", "foundational_skills", "knowledge"}
+	files, _ = classifyTaxonomyFiles("", lines)
+	if assert.Len(t, files, 2) {
+		assert.Equal(t, taxonomyTypeSkill, files[1].Kind)
+	}
+	assert.Equal(t, taxonomyTypeKnowledge, taxonomyType("knowledge/a/qna.yaml"))
+}
@@ -4,228 +4,37 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"math"
 	"os"
 	"path"
+	"path/filepath"
+	"strings"
 	"text/template"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"go.uber.org/zap"
 	"sigs.k8s.io/yaml"
 )
 
-func generateAllHTML(allFile *os.File, logEntries []string, fileNames []string) error {
-	const INDEX_HTML = `
-<!DOCTYPE html>
-<html>
-<head>
-	<style>
-    	:root {
-        	--primary-color: #007bff;
-        	--hover-color: #0056b3;
-        	--text-color: #333;
-        	--background-color: #f8f9fa;
-        	--link-color: #0066cc;
-        	--link-hover-color: #0044cc;
-       	}
-       	body {
-           	font-family: 'Segoe UI', Tahoma, Geneva, Verdana, sans-serif;
-           	background-color: var(--background-color);
-           	margin: 0;
-           	padding: 20px;
-           	color: var(--text-color);
-       	}
-       	h1 {
-           	color: var(--primary-color);
-           	text-align: center;
-           	margin-bottom: 2rem;
-       	}
-       	a {
-           	color: var(--link-color);
-           	text-decoration: none;
-           	font-weight: 500;
-       	}	
-       	a:hover {
-           	color: var(--link-hover-color);
-           	text-decoration: underline;
-       	}
-		.item {
-			min-height: 300px
-		}
-		.item p {
-			max-width: fit-content;
-			margin-left: auto;
-			margin-right: auto;
-		}
-		.item h5 {
-			max-width: fit-content;
-			margin-left: auto;
-			margin-right: auto;
-		}
-   	</style>
-	<meta charset="utf-8">
-	<meta name="viewport" content="width=device-width, initial-scale=1">
-	<link rel="stylesheet" href="https://maxcdn.bootstrapcdn.com/bootstrap/3.4.1/css/bootstrap.min.css">
-	<script src="https://ajax.googleapis.com/ajax/libs/jquery/3.7.1/jquery.min.js"></script>
-	<script src="https://maxcdn.bootstrapcdn.com/bootstrap/3.4.1/js/bootstrap.min.js"></script>
-</head>
-<body>
-	<div class="container">
-		<h2>All Log Files as Carousel</h2>
-		<div id="logfileCarousel" class="carousel slide" data-ride="carousel" data-interval="false">
-			<ol class="carousel-indicators">
-			{{ range $index, $value := .Files }}
-				{{ if eq $index 0 }}
-				<li data-target="#logfileCarousel" data-slide-to="{{$index}}" class="active"></li>
-				{{ else }}
-				<li data-target="#logfileCarousel" data-slide-to="{{$index}}"></li>
-				{{ end}}
-			{{ end }}
-			</ol>
-			<div class="carousel-inner">
-			{{ $FileNames := .FileNames }}
-			{{ range $index, $value := .Files }}
-				{{ if eq $index 0 }}
-				<div class="item active">
-					<h5> {{ index $FileNames $index }} </h5>
-					<pre> {{ $value }} </pre>
-				</div>
-				{{ else }}
-				<div class="item">
-					<h5> {{ index $FileNames $index }} </h5>
-					<pre> {{ $value }} </pre>
-				</div>
-				{{ end}}
-			{{ end }}
-			</div>
-			<a class="left carousel-control" href="#logfileCarousel" data-slide="prev">
-				<span class="glyphicon glyphicon-chevron-left"></span>
-				<span class="sr-only">Previous</span>
-			</a>
-			<a class="right carousel-control" href="#logfileCarousel" data-slide="next">
-				<span class="glyphicon glyphicon-chevron-right"></span>
-				<span class="sr-only">Next</span>
-			</a>
-		</div>
-	</div>
-</body>
-</html>`
-
-	tmpl, err := template.New("index").Parse(INDEX_HTML)
-	if err != nil {
-		return fmt.Errorf("template parsing error: %w", err)
-	}
-
-	data := struct {
-		Files     []string
-		FileNames []string
-	}{
-		Files:     logEntries,
-		FileNames: fileNames,
-	}
-
-	return tmpl.Execute(allFile, data)
+// generateAllHTML shows the content of the files on one page
+func generateAllHTML(allFile io.Writer, title string, metadata []reportField, files []reportFile) error {
+	return reportTemplates.render(allFile, reportCombinedPage, title, metadata, []reportSection{{Name: sectionLogs, Files: files}})
 }
 
-func generateIndexHTML(indexFile *os.File, prNumber string, presignedFiles []map[string]string) error {
-	const INDEX_HTML = `
-<!DOCTYPE html>
-<html>
-<head>
-   <title>Generated Data for {{ .Name }}</title>
-   <style>
-       :root {
-           --primary-color: #007bff;
-           --hover-color: #0056b3;
-           --text-color: #333;
-           --background-color: #f8f9fa;
-           --link-color: #0066cc;
-           --link-hover-color: #0044cc;
-       }
-
-       body {
-           font-family: 'Segoe UI', Tahoma, Geneva, Verdana, sans-serif;
-           background-color: var(--background-color);
-           margin: 0;
-           padding: 20px;
-           color: var(--text-color);
-       }
-
-       h1 {
-           color: var(--primary-color);
-           text-align: center;
-           margin-bottom: 2rem;
-       }
-
-       ul {
-           list-style-type: none;
-           padding: 0;
-           max-width: 600px;
-           margin: auto;
-       }
-
-       li {
-           background-color: #fff;
-           margin-bottom: 10px;
-           padding: 10px;
-           border-radius: 5px;
-           box-shadow: 0 2px 4px rgba(0,0,0,0.1);
-           transition: transform 0.2s ease-in-out;
-       }
-
-       li:hover {
-           transform: translateY(-3px);
-       }
-
-       a {
-           color: var(--link-color);
-           text-decoration: none;
-           font-weight: 500;
-       }
-
-       a:hover {
-           color: var(--link-hover-color);
-           text-decoration: underline;
-       }
-   </style>
-</head>
-<body>
-   <h1>Generated Data for {{ .Name }}</h1>
-	<ul>
-	{{- range .Files}}
-		<li><a href="{{ .url }}">{{ .name }}</a></li>
-	{{- end }}
-	</ul>
-</body>
-</html>`
-
-	tmpl, err := template.New("index").Parse(INDEX_HTML)
-	if err != nil {
-		return fmt.Errorf("template parsing error: %w", err)
-	}
-
-	data := struct {
-		Name  string
-		Files []map[string]string
-	}{
-		Name:  fmt.Sprintf("PR %s", prNumber),
-		Files: presignedFiles,
+// generateIndexHTML links the uploaded artifacts of a job, grouped by type
+func generateIndexHTML(indexFile io.Writer, name string, metadata []reportField, presignedFiles []map[string]string) error {
+	files := make([]reportFile, len(presignedFiles))
+	for i, file := range presignedFiles {
+		files[i] = reportFile{Name: file["name"], URL: file["url"]}
 	}
-
-	return tmpl.Execute(indexFile, data)
+	return reportTemplates.render(indexFile, reportIndexPage, fmt.Sprintf("Generated Data for %s", name), metadata, groupArtifacts(files))
 }
 
 // Generate a JSON viewer only for files with valid JSON output
-func generateFormattedJSON(ctx context.Context, outputDir, filename string, svc *s3.Client, logger *zap.SugaredLogger) string {
-	inputFile := path.Join(outputDir, filename)
-	formattedHTMLFile := inputFile + jsonViewerFilenameSuffix
-
-	s3Key := fmt.Sprintf("%s/%s", path.Base(outputDir), path.Base(formattedHTMLFile))
-
-	// Check if formatted HTML file already exists from previous runs
-	if _, err := os.Stat(formattedHTMLFile); err == nil {
-		return s3Key
-	}
+func generateFormattedJSON(ctx context.Context, outputDir, filename, s3Prefix, s3Tags string, svc *s3.Client, logger *zap.SugaredLogger) string {
+	inputFile := filepath.Join(outputDir, filename)
+	s3Key := path.Join(s3Prefix, filepath.Base(outputDir), filename+jsonViewerFilenameSuffix)
 
 	jsonData, err := os.ReadFile(inputFile)
 	if err != nil {
@@ -234,8 +43,7 @@ func generateFormattedJSON(ctx context.Context, outputDir, filename string, svc
 	}
 
 	var temp interface{}
-	// If the JSON doesn't marshall, skip.
-	// TODO: support invalid top-level format such as an array in generate-local such as test_merlinite & train_merlinite
+	// If the JSON doesn't marshall, skip. JSON lines files have the viewer of generateJSONLViewer.
 	if err := json.Unmarshal(jsonData, &temp); err != nil {
 		return ""
 	}
@@ -246,7 +54,7 @@ func generateFormattedJSON(ctx context.Context, outputDir, filename string, svc
 		return ""
 	}
 
-	htmlContent := fmt.Sprintf(`
+	const jsonViewerHTML = `
 <!DOCTYPE html>
 <html>
 <head>
@@ -271,26 +79,11 @@ func generateFormattedJSON(ctx context.Context, outputDir, filename string, svc
 </script>
 </body>
 </html>
-`, encodedJSON)
-
-	err = os.WriteFile(formattedHTMLFile, []byte(htmlContent), 0644)
-	if err != nil {
-		logger.Errorf("Failed to write HTML file: %v", err)
-		return ""
-	}
-
-	file, err := os.Open(formattedHTMLFile)
-	if err != nil {
-		logger.Errorf("Could not open generated HTML file: %v", err)
-		return ""
-	}
-	defer file.Close()
-
-	_, err = svc.PutObject(ctx, &s3.PutObjectInput{
-		Bucket:      aws.String(S3Bucket),
-		Key:         aws.String(s3Key),
-		Body:        file,
-		ContentType: aws.String("text/html"),
+`
+	// The viewer is as large as the JSON it embeds, it is uploaded as it is rendered
+	err = uploadStream(ctx, svc, s3Key, "text/html", s3Tags, func(w io.Writer) error {
+		_, err := fmt.Fprintf(w, jsonViewerHTML, encodedJSON)
+		return err
 	})
 	if err != nil {
 		logger.Errorf("Could not upload formatted HTML file to S3: %v", err)
@@ -301,10 +94,9 @@ func generateFormattedJSON(ctx context.Context, outputDir, filename string, svc
 }
 
 // Generate formatted YAML HTML from JSON files
-func generateFormattedYAML(ctx context.Context, outputDir, filename string, svc *s3.Client, logger *zap.SugaredLogger) string {
-	inputFile := path.Join(outputDir, filename)
-	outputFile := inputFile + ".yaml.html"
-	s3Key := fmt.Sprintf("%s/%s", path.Base(outputDir), path.Base(outputFile))
+func generateFormattedYAML(ctx context.Context, outputDir, filename, s3Prefix, s3Tags string, svc *s3.Client, logger *zap.SugaredLogger) string {
+	inputFile := filepath.Join(outputDir, filename)
+	s3Key := path.Join(s3Prefix, filepath.Base(outputDir), filename+".yaml.html")
 
 	jsonData, err := os.ReadFile(inputFile)
 	if err != nil {
@@ -325,7 +117,7 @@ func generateFormattedYAML(ctx context.Context, outputDir, filename string, svc
 		return ""
 	}
 
-	htmlContent := fmt.Sprintf(`
+	const yamlViewerHTML = `
 <!DOCTYPE html>
 <html lang="en">
 <head>
@@ -349,31 +141,446 @@ func generateFormattedYAML(ctx context.Context, outputDir, filename string, svc
 </script>
 </body>
 </html>
-`, string(yamlData))
-
-	err = os.WriteFile(outputFile, []byte(htmlContent), 0644)
+`
+	err = uploadStream(ctx, svc, s3Key, "text/html", s3Tags, func(w io.Writer) error {
+		_, err := fmt.Fprintf(w, yamlViewerHTML, yamlData)
+		return err
+	})
 	if err != nil {
-		logger.Errorf("Failed to write HTML file: %v", err)
+		logger.Errorf("Could not upload formatted HTML file to S3: %v", err)
 		return ""
 	}
 
-	file, err := os.Open(outputFile)
+	return s3Key
+}
+
+// generateLintHTML renders the lint results as an annotated listing of each file
+func generateLintHTML(reportFile *os.File, results []lintFileResult) error {
+	const LINT_HTML = `
+<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="utf-8">
+    <title>YAML Lint Report</title>
+    <style>
+        body { font-family: 'Segoe UI', Tahoma, Geneva, Verdana, sans-serif; background-color: #f8f9fa; padding: 20px; color: #333; }
+        h1 { color: #007bff; text-align: center; }
+        h2 { font-size: 1.1rem; margin-top: 2rem; }
+        .clean { color: #28a745; }
+        table { border-collapse: collapse; width: 100%; background-color: #fff; font-family: monospace; font-size: 13px; }
+        td { padding: 0 8px; vertical-align: top; white-space: pre-wrap; }
+        td.num { color: #999; text-align: right; user-select: none; width: 1%; }
+        tr.failure { background-color: #fdecea; }
+        tr.warning { background-color: #fff8e1; }
+        .problem { font-family: 'Segoe UI', Tahoma, sans-serif; font-size: 12px; padding: 2px 8px; }
+        .problem.failure { color: #c62828; }
+        .problem.warning { color: #8d6e00; }
+    </style>
+</head>
+<body>
+    <h1>YAML Lint Report</h1>
+    {{- range .Files }}
+    <h2>{{ .Path | html }}{{ if not .Problems }} <span class="clean">&#10004; no problems</span>{{ end }}</h2>
+    {{- if .Problems }}
+    {{- $problems := .Problems }}
+    <table>
+    {{- range $index, $line := .Lines }}
+        {{- $num := inc $index }}
+        <tr class="{{ lineLevel $problems $num }}"><td class="num">{{ $num }}</td><td>{{ $line | html }}</td></tr>
+        {{- range $problems }}{{ if eq .Line $num }}
+        <tr><td></td><td class="problem {{ .Level }}">{{ .Line }}:{{ .Column }} [{{ .Rule }}] {{ .Message | html }}</td></tr>
+        {{- end }}{{ end }}
+    {{- end }}
+    </table>
+    {{- end }}
+    {{- end }}
+    {{- if hasQuality .Files }}
+    <h1>Content Quality</h1>
+    {{- range .Files }}{{ if .Quality }}
+    <h2>{{ .Path | html }}</h2>
+    <ul>
+    {{- range .Quality }}
+        <li class="problem {{ .Level }}">{{ .Line }}:{{ .Column }} [{{ .Rule }}] {{ .Message | html }}</li>
+    {{- end }}
+    </ul>
+    {{- end }}{{ end }}
+    {{- end }}
+</body>
+</html>`
+
+	funcs := template.FuncMap{
+		"inc": func(i int) int { return i + 1 },
+		"hasQuality": func(files []lintFileResult) bool {
+			for _, file := range files {
+				if len(file.Quality) > 0 {
+					return true
+				}
+			}
+			return false
+		},
+		"lineLevel": func(problems []lintProblem, line int) string {
+			level := ""
+			for _, p := range problems {
+				if p.Line == line {
+					if p.Level == lintLevelError {
+						return lintLevelError
+					}
+					level = p.Level
+				}
+			}
+			return level
+		},
+	}
+
+	tmpl, err := template.New("lint").Funcs(funcs).Parse(LINT_HTML)
 	if err != nil {
-		logger.Errorf("Could not open generated HTML file: %v", err)
-		return ""
+		return fmt.Errorf("template parsing error: %w", err)
 	}
-	defer file.Close()
 
-	_, err = svc.PutObject(ctx, &s3.PutObjectInput{
-		Bucket:      aws.String(S3Bucket),
-		Key:         aws.String(s3Key),
-		Body:        file,
-		ContentType: aws.String("text/html"),
-	})
+	data := struct {
+		Files []lintFileResult
+	}{
+		Files: results,
+	}
+
+	return tmpl.Execute(reportFile, data)
+}
+
+// generateScoresHTML renders the precheck similarity scores as a table sortable by any column
+func generateScoresHTML(reportFile *os.File, rows []precheckScore) error {
+	const SCORES_HTML = `
+<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="utf-8">
+    <title>Precheck Answer Similarity</title>
+    <style>
+        body { font-family: 'Segoe UI', Tahoma, Geneva, Verdana, sans-serif; background-color: #f8f9fa; padding: 20px; color: #333; }
+        h1 { color: #007bff; text-align: center; }
+        p.hint { text-align: center; color: #666; }
+        table { border-collapse: collapse; width: 100%; background-color: #fff; font-size: 13px; }
+        th { background-color: #007bff; color: #fff; cursor: pointer; padding: 6px 8px; text-align: left; }
+        th:hover { background-color: #0056b3; }
+        td { border-top: 1px solid #dee2e6; padding: 6px 8px; vertical-align: top; white-space: pre-wrap; }
+        td.score { font-family: monospace; text-align: right; white-space: nowrap; }
+        tr.low td.score { color: #c62828; font-weight: bold; }
+    </style>
+</head>
+<body>
+    <h1>Precheck Answer Similarity</h1>
+    <p class="hint">Sorted with the most divergent answers first. Click a column header to sort by it.</p>
+    <table id="scores">
+        <thead>
+        <tr>
+            <th data-type="number">Score</th>
+            <th data-type="number">Cosine</th>
+            <th data-type="number">ROUGE-L</th>
+            <th data-type="number">BLEU</th>
+            <th>Model</th>
+            <th>File</th>
+            <th>Question</th>
+            <th>Expected Answer</th>
+            <th>Model Answer</th>
+            {{- if .Changes }}
+            <th>Change</th>
+            {{- end }}
+        </tr>
+        </thead>
+        <tbody>
+        {{- range .Rows }}
+        <tr{{ if lt .Scores.Score 0.5 }} class="low"{{ end }}>
+            <td class="score">{{ printf "%.3f" .Scores.Score }}</td>
+            <td class="score">{{ if .Scores.Cosine }}{{ printf "%.3f" (deref .Scores.Cosine) }}{{ else }}-{{ end }}</td>
+            <td class="score">{{ printf "%.3f" .Scores.RougeL }}</td>
+            <td class="score">{{ printf "%.3f" .Scores.BLEU }}</td>
+            <td>{{ .Model | html }}</td>
+            <td>{{ .File | html }}</td>
+            <td>{{ .Question | html }}</td>
+            <td>{{ .ExpectedAnswer | html }}</td>
+            <td>{{ .ModelAnswer | html }}</td>
+            {{- if $.Changes }}
+            <td>{{ .Change | html }}</td>
+            {{- end }}
+        </tr>
+        {{- end }}
+        </tbody>
+    </table>
+    <script>
+        document.querySelectorAll('#scores th').forEach(function (th, col) {
+            var ascending = col !== 0;
+            th.addEventListener('click', function () {
+                var tbody = document.querySelector('#scores tbody');
+                var numeric = th.dataset.type === 'number';
+                var rows = Array.from(tbody.rows);
+                rows.sort(function (a, b) {
+                    var x = a.cells[col].innerText, y = b.cells[col].innerText;
+                    if (numeric) {
+                        x = isNaN(parseFloat(x)) ? -1 : parseFloat(x);
+                        y = isNaN(parseFloat(y)) ? -1 : parseFloat(y);
+                        return ascending ? x - y : y - x;
+                    }
+                    return ascending ? x.localeCompare(y) : y.localeCompare(x);
+                });
+                rows.forEach(function (row) { tbody.appendChild(row); });
+                ascending = !ascending;
+            });
+        });
+    </script>
+</body>
+</html>`
+
+	funcs := template.FuncMap{
+		"deref": func(f *float64) float64 { return *f },
+	}
+
+	tmpl, err := template.New("scores").Funcs(funcs).Parse(SCORES_HTML)
 	if err != nil {
-		logger.Errorf("Could not upload formatted HTML file to S3: %v", err)
-		return ""
+		return fmt.Errorf("template parsing error: %w", err)
 	}
 
-	return s3Key
+	data := struct {
+		Rows    []precheckScore
+		Changes bool
+	}{
+		Rows: rows,
+	}
+	for _, row := range rows {
+		if row.Change != "" {
+			data.Changes = true
+		}
+	}
+
+	return tmpl.Execute(reportFile, data)
+}
+
+// generateComparisonHTML renders the answers of several models to the same questions side by side
+func generateComparisonHTML(reportFile *os.File, models []string, rows []precheckComparison) error {
+	const COMPARISON_HTML = `
+<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="utf-8">
+    <title>Precheck Model Comparison</title>
+    <style>
+        body { font-family: 'Segoe UI', Tahoma, Geneva, Verdana, sans-serif; background-color: #f8f9fa; padding: 20px; color: #333; }
+        h1 { color: #007bff; text-align: center; }
+        table { border-collapse: collapse; width: 100%; background-color: #fff; font-size: 13px; table-layout: fixed; }
+        th { background-color: #007bff; color: #fff; padding: 6px 8px; text-align: left; }
+        td { border-top: 1px solid #dee2e6; padding: 6px 8px; vertical-align: top; white-space: pre-wrap; word-wrap: break-word; }
+        td.question { font-weight: 500; }
+        td.file { color: #666; font-family: monospace; font-size: 12px; }
+        .missing { color: #999; font-style: italic; }
+        .issue { color: #b35900; font-style: italic; }
+        p.partial { text-align: center; color: #b35900; }
+    </style>
+</head>
+<body>
+    <h1>Precheck Model Comparison</h1>
+    {{- if .Partial }}
+    <p class="partial">The comparison is partial: {{ .Partial }} answers are missing, empty or were cut short.</p>
+    {{- end }}
+    <table>
+        <thead>
+        <tr>
+            <th>Question</th>
+            <th>Expected Answer</th>
+            {{- range .Models }}
+            <th>{{ . | html }}</th>
+            {{- end }}
+        </tr>
+        </thead>
+        <tbody>
+        {{- $models := .Models }}
+        {{- range .Rows }}
+        {{- $answers := .Answers }}
+        {{- $issues := .Issues }}
+        <tr>
+            <td class="question">{{ .Question | html }}<br><span class="file">{{ .File | html }}</span></td>
+            <td>{{ .ExpectedAnswer | html }}</td>
+            {{- range $models }}
+            <td>{{ with index $answers . }}{{ . | html }}{{ else }}<span class="missing">no answer</span>{{ end }}
+                {{- with index $issues . }}<br><span class="issue">{{ . }} answer</span>{{ end }}</td>
+            {{- end }}
+        </tr>
+        {{- end }}
+        </tbody>
+    </table>
+</body>
+</html>`
+
+	tmpl, err := template.New("comparison").Parse(COMPARISON_HTML)
+	if err != nil {
+		return fmt.Errorf("template parsing error: %w", err)
+	}
+
+	partial := 0
+	for _, row := range rows {
+		for _, model := range models {
+			if _, ok := row.Answers[model]; !ok || row.Issues[model] != "" {
+				partial++
+			}
+		}
+	}
+
+	data := struct {
+		Models  []string
+		Rows    []precheckComparison
+		Partial int
+	}{
+		Models:  models,
+		Rows:    rows,
+		Partial: partial,
+	}
+
+	return tmpl.Execute(reportFile, data)
+}
+
+// generateDatasetStatsHTML renders the statistics and validation errors of the generated dataset
+func generateDatasetStatsHTML(reportFile *os.File, stats *datasetStats) error {
+	const DATASET_STATS_HTML = `
+<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="utf-8">
+    <title>Generated Dataset Statistics</title>
+    <style>
+        body { font-family: 'Segoe UI', Tahoma, Geneva, Verdana, sans-serif; background-color: #f8f9fa; padding: 20px; color: #333; }
+        h1 { color: #007bff; text-align: center; }
+        h2 { color: #007bff; font-size: 18px; }
+        table { border-collapse: collapse; background-color: #fff; font-size: 13px; }
+        th { background-color: #007bff; color: #fff; padding: 6px 8px; text-align: left; }
+        td { border-top: 1px solid #dee2e6; padding: 6px 8px; vertical-align: top; }
+        td.value { font-family: monospace; text-align: right; }
+        ul.errors { font-family: monospace; font-size: 12px; color: #dc3545; }
+        .file { color: #666; font-family: monospace; font-size: 12px; }
+    </style>
+</head>
+<body>
+    <h1>Generated Dataset Statistics</h1>
+    <table>
+        <tr><th>Metric</th><th>Value</th></tr>
+        <tr><td>Records</td><td class="value">{{ .Records }}</td></tr>
+        <tr><td>Valid samples</td><td class="value">{{ .ValidSamples }}</td></tr>
+        <tr><td>Invalid records</td><td class="value">{{ .InvalidRecords }}</td></tr>
+        <tr><td>Empty fields</td><td class="value">{{ .EmptyFields }}</td></tr>
+        <tr><td>Duplicates</td><td class="value">{{ .Duplicates }} ({{ percent .DuplicateRate }})</td></tr>
+        <tr><td>Average prompt length (chars)</td><td class="value">{{ printf "%.1f" .AvgPromptChars }}</td></tr>
+        <tr><td>Average response length (chars)</td><td class="value">{{ printf "%.1f" .AvgResponseChars }}</td></tr>
+    </table>
+    <h2>Files</h2>
+    {{- range .Files }}
+    <div class="file">{{ . | html }}</div>
+    {{- end }}
+    {{- if .Errors }}
+    <h2>Validation Errors</h2>
+    <ul class="errors">
+        {{- range .Errors }}
+        <li>{{ . | html }}</li>
+        {{- end }}
+        {{- if .TruncatedErrors }}
+        <li>... and {{ .TruncatedErrors }} more</li>
+        {{- end }}
+    </ul>
+    {{- end }}
+</body>
+</html>`
+
+	funcs := template.FuncMap{
+		"percent": func(rate float64) string {
+			return fmt.Sprintf("%.1f%%", rate*100)
+		},
+	}
+	tmpl, err := template.New("dataset").Funcs(funcs).Parse(DATASET_STATS_HTML)
+	if err != nil {
+		return fmt.Errorf("template parsing error: %w", err)
+	}
+
+	return tmpl.Execute(reportFile, stats)
+}
+
+// generateLossCurveHTML renders the training loss as a line chart followed by the logged values
+func generateLossCurveHTML(reportFile *os.File, losses []trainingLoss) error {
+	const LOSS_CURVE_HTML = `
+<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="utf-8">
+    <title>Training Loss</title>
+    <style>
+        body { font-family: 'Segoe UI', Tahoma, Geneva, Verdana, sans-serif; background-color: #f8f9fa; padding: 20px; color: #333; }
+        h1 { color: #007bff; text-align: center; }
+        svg { display: block; margin: 0 auto 20px auto; background-color: #fff; }
+        svg text { font-size: 12px; fill: #666; }
+        table { border-collapse: collapse; margin: 0 auto; background-color: #fff; font-size: 13px; }
+        th { background-color: #007bff; color: #fff; padding: 6px 8px; text-align: left; }
+        td { border-top: 1px solid #dee2e6; padding: 4px 8px; font-family: monospace; text-align: right; }
+    </style>
+</head>
+<body>
+    <h1>Training Loss</h1>
+    <svg width="{{ .Width }}" height="{{ .Height }}">
+        <line x1="{{ .Margin }}" y1="{{ .Margin }}" x2="{{ .Margin }}" y2="{{ .Bottom }}" stroke="#999"/>
+        <line x1="{{ .Margin }}" y1="{{ .Bottom }}" x2="{{ .Right }}" y2="{{ .Bottom }}" stroke="#999"/>
+        <text x="4" y="{{ .Margin }}">{{ printf "%.3f" .MaxLoss }}</text>
+        <text x="4" y="{{ .Bottom }}">{{ printf "%.3f" .MinLoss }}</text>
+        <text x="{{ .Margin }}" y="{{ .Height }}">step {{ .FirstStep }}</text>
+        <text x="{{ .Right }}" y="{{ .Height }}" text-anchor="end">step {{ .LastStep }}</text>
+        <polyline fill="none" stroke="#007bff" stroke-width="2" points="{{ .Points }}"/>
+    </svg>
+    <table>
+        <tr><th>Step</th><th>Loss</th></tr>
+        {{- range .Losses }}
+        <tr><td>{{ .Step }}</td><td>{{ printf "%.4f" .Loss }}</td></tr>
+        {{- end }}
+    </table>
+</body>
+</html>`
+
+	tmpl, err := template.New("loss").Parse(LOSS_CURVE_HTML)
+	if err != nil {
+		return fmt.Errorf("template parsing error: %w", err)
+	}
+
+	const width, height, margin = 800, 320, 50
+	minLoss, maxLoss := losses[0].Loss, losses[0].Loss
+	for _, l := range losses {
+		minLoss = math.Min(minLoss, l.Loss)
+		maxLoss = math.Max(maxLoss, l.Loss)
+	}
+	firstStep, lastStep := losses[0].Step, losses[len(losses)-1].Step
+	var points []string
+	for i, l := range losses {
+		x, y := 0.5, 0.5
+		if lastStep != firstStep {
+			x = float64(l.Step-firstStep) / float64(lastStep-firstStep)
+		} else if len(losses) > 1 {
+			x = float64(i) / float64(len(losses)-1)
+		}
+		if maxLoss != minLoss {
+			y = (l.Loss - minLoss) / (maxLoss - minLoss)
+		}
+		points = append(points, fmt.Sprintf("%.1f,%.1f", margin+x*(width-2*margin), height-margin-y*(height-2*margin)))
+	}
+
+	data := struct {
+		Width, Height, Margin, Bottom, Right int
+		MinLoss, MaxLoss                     float64
+		FirstStep, LastStep                  int
+		Points                               string
+		Losses                               []trainingLoss
+	}{
+		Width:     width,
+		Height:    height,
+		Margin:    margin,
+		Bottom:    height - margin,
+		Right:     width - margin,
+		MinLoss:   minLoss,
+		MaxLoss:   maxLoss,
+		FirstStep: firstStep,
+		LastStep:  lastStep,
+		Points:    strings.Join(points, " "),
+		Losses:    losses,
+	}
+
+	return tmpl.Execute(reportFile, data)
 }
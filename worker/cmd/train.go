@@ -0,0 +1,344 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/go-redis/redis/v8"
+	"github.com/instructlab/instructlab-bot/pkg/jobqueue"
+)
+
+const (
+	trainLogFilename         = "train.log"
+	trainLossFilename        = "loss.json"
+	trainLossCurveFilename   = "loss_curve.html"
+	trainCheckpointsFilename = "checkpoints.json"
+	trainLogErrorLines       = 20
+)
+
+// trainingLossPatterns match the loss reported by the ilab training backends: the Hugging Face
+// trainer logs `{'loss': 1.23, ..., 'epoch': 0.5}` and MLX logs `Iter 10: Train loss 1.23, ...`
+var trainingLossPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`'loss': ([0-9.eE+-]+)`),
+	regexp.MustCompile(`Iter (\d+): Train loss ([0-9.eE+-]+)`),
+}
+
+// trainingLoss is one logged point of the loss curve
+type trainingLoss struct {
+	Step int     `json:"step"`
+	Loss float64 `json:"loss"`
+}
+
+// checkpointFile describes a file written by the training run, the checkpoints themselves are
+// too large to be uploaded with the results
+type checkpointFile struct {
+	Path     string    `json:"path"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+}
+
+// recordTrainingData makes the train and test files of a generate-local job available to the
+// train jobs of the same PR
+func (w *Worker) recordTrainingData(outputDir, s3Dir, repoOwner, repoName, prNumber string) error {
+	var keys []string
+	for _, pattern := range []string{"train_*.jsonl", "test_*.jsonl"} {
+		files, err := filepath.Glob(filepath.Join(outputDir, pattern))
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			keys = append(keys, fmt.Sprintf("%s/%s", s3Dir, filepath.Base(file)))
+		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+
+	keysJSON, err := json.Marshal(keys)
+	if err != nil {
+		return fmt.Errorf("could not marshal training data keys: %w", err)
+	}
+	if err := w.setJobField(jobqueue.FieldTrainingData, keysJSON); err != nil {
+		return fmt.Errorf("could not set training data for job %s: %w", w.job, err)
+	}
+	if err := w.queue.Client.Set(w.ctx, jobqueue.LatestGenerateJobKey(repoOwner, repoName, prNumber), w.job, 0).Err(); err != nil {
+		return fmt.Errorf("could not record job %s as the latest generate job: %w", w.job, err)
+	}
+	return nil
+}
+
+// trainingDataKeys resolves the generate-local job a train job uses, the one named on the job or
+// else the latest one of the PR, and returns the S3 keys of its training data
+func (w *Worker) trainingDataKeys(repoOwner, repoName, prNumber string) (string, []string, error) {
+	generateJob, err := w.jobField(jobqueue.FieldGenerateJob)
+	if err != nil {
+		return "", nil, err
+	}
+	if generateJob == "" {
+		generateJob, err = w.queue.Client.Get(w.ctx, jobqueue.LatestGenerateJobKey(repoOwner, repoName, prNumber)).Result()
+		if err == redis.Nil {
+			return "", nil, fmt.Errorf("no generate-local results found for this PR, run generate-local first")
+		} else if err != nil {
+			return "", nil, err
+		}
+	}
+
+	// The generated data of other repositories and PRs is not the PR's to train on
+	var source prSubject
+	for field, value := range map[jobqueue.Field]*string{
+		jobqueue.FieldRepoOwner: &source.RepoOwner,
+		jobqueue.FieldRepoName:  &source.RepoName,
+		jobqueue.FieldPRNumber:  &source.PRNumber,
+	} {
+		if *value, err = w.queue.Get(w.ctx, generateJob, field); err != nil {
+			return generateJob, nil, err
+		}
+	}
+	if err := source.check(generateJob, prSubject{RepoOwner: repoOwner, RepoName: repoName, PRNumber: prNumber}); err != nil {
+		return generateJob, nil, err
+	}
+
+	keysJSON, err := w.queue.Get(w.ctx, generateJob, jobqueue.FieldTrainingData)
+	if err != nil {
+		return generateJob, nil, err
+	}
+	if keysJSON == "" {
+		return generateJob, nil, fmt.Errorf("job %s has no training data, only successful generate-local jobs can be trained on", generateJob)
+	}
+	var keys []string
+	if err := json.Unmarshal([]byte(keysJSON), &keys); err != nil {
+		return generateJob, nil, fmt.Errorf("could not parse the training data of job %s: %w", generateJob, err)
+	}
+	return generateJob, keys, nil
+}
+
+// prSubject is the repository and PR a job ran for
+type prSubject struct {
+	RepoOwner string
+	RepoName  string
+	PRNumber  string
+}
+
+// check fails unless the generate job ran for the PR of the train job, a job whose keys expired
+// is not trusted either
+func (s prSubject) check(generateJob string, pr prSubject) error {
+	if s != pr {
+		return fmt.Errorf("job %s did not generate data for %s/%s#%s, only the generate-local jobs of the PR can be trained on", generateJob, pr.RepoOwner, pr.RepoName, pr.PRNumber)
+	}
+	return nil
+}
+
+// downloadTrainingData fetches the training data into dataDir
+func (w *Worker) downloadTrainingData(keys []string, dataDir string) error {
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		return err
+	}
+	for _, key := range keys {
+		object, err := w.svc.GetObject(w.ctx, &s3.GetObjectInput{
+			Bucket: aws.String(S3Bucket),
+			Key:    aws.String(key),
+		})
+		if err != nil {
+			return fmt.Errorf("could not download %s: %w", key, err)
+		}
+		file, err := os.Create(filepath.Join(dataDir, path.Base(key)))
+		if err != nil {
+			object.Body.Close()
+			return err
+		}
+		_, err = io.Copy(file, object.Body)
+		object.Body.Close()
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("could not download %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// trainArgs returns the `ilab train` arguments for the worker settings and the job overrides
+func (w *Worker) trainArgs(dataDir string) ([]string, error) {
+	args := w.ilabArgs(ilabTrain, "--data-dir", dataDir)
+	numEpochs, iters := TrainNumEpochs, TrainIters
+	for field, value := range map[jobqueue.Field]*int{jobqueue.FieldNumEpochs: &numEpochs, jobqueue.FieldIters: &iters} {
+		override, err := w.jobField(field)
+		if err != nil {
+			return nil, err
+		}
+		if override == "" {
+			continue
+		}
+		if *value, err = strconv.Atoi(override); err != nil || *value <= 0 {
+			return nil, fmt.Errorf("invalid %s %q, it must be a positive integer", field, override)
+		}
+	}
+	if numEpochs > 0 {
+		args = append(args, "--num-epochs", strconv.Itoa(numEpochs))
+	}
+	if iters > 0 {
+		args = append(args, "--iters", strconv.Itoa(iters))
+	}
+	if TrainDevice != "" {
+		args = append(args, "--device", TrainDevice)
+	}
+	return args, nil
+}
+
+// runTrain trains the model on the data generated for the PR and writes the training log, the
+// loss curve and the checkpoint metadata into the output directory
+func (w *Worker) runTrain(lab, workDir, outputDir, repoOwner, repoName, prNumber string) error {
+	generateJob, keys, err := w.trainingDataKeys(repoOwner, repoName, prNumber)
+	if err != nil {
+		return err
+	}
+	w.logger.Infof("Training on the data of generate job %s", generateJob)
+	if err := w.setJobField(jobqueue.FieldGenerateJob, generateJob); err != nil {
+		w.logger.Errorf("Could not record the generate job of job %s: %v", w.job, err)
+	}
+
+	// The data is kept out of the output directory so it is not uploaded again
+	dataDir := outputDir + "-data"
+	defer os.RemoveAll(dataDir)
+	if err := w.downloadTrainingData(keys, dataDir); err != nil {
+		return err
+	}
+
+	args, err := w.trainArgs(dataDir)
+	if err != nil {
+		return err
+	}
+	logFile, err := os.Create(filepath.Join(outputDir, trainLogFilename))
+	if err != nil {
+		return fmt.Errorf("could not create %s: %w", trainLogFilename, err)
+	}
+	defer logFile.Close()
+
+	cmd := w.ilabCommand(lab, workDir, args...)
+	cmd.Stdout = io.MultiWriter(logFile, os.Stdout)
+	cmd.Stderr = io.MultiWriter(logFile, os.Stderr)
+	w.cmdRun = cmd.String()
+	w.logger.Infof("Running the train command: %s", w.cmdRun)
+	runErr := cmd.Run()
+
+	trainLog, err := os.ReadFile(logFile.Name())
+	if err != nil {
+		w.logger.Errorf("Could not read the training log: %v", err)
+	}
+	if err := writeTrainingLoss(outputDir, parseTrainingLoss(string(trainLog))); err != nil {
+		w.logger.Error(err)
+	}
+	if err := writeCheckpointMetadata(outputDir, filepath.Join(workDir, TrainCheckpointDir), w.jobStart); err != nil {
+		w.logger.Error(err)
+	}
+	if runErr != nil {
+		// The results of a failed job are not uploaded, so the end of the log goes into the error
+		return fmt.Errorf("error running command (%s): %v. \nDetails: %s", w.cmdRun, runErr, lastLines(string(trainLog), trainLogErrorLines))
+	}
+	return nil
+}
+
+// lastLines returns at most n trailing lines of the text
+func lastLines(text string, n int) string {
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// parseTrainingLoss extracts the loss curve from the training log. Lines without a step are
+// numbered in the order they were logged.
+func parseTrainingLoss(trainLog string) []trainingLoss {
+	var losses []trainingLoss
+	for _, line := range strings.Split(trainLog, "\n") {
+		for _, pattern := range trainingLossPatterns {
+			match := pattern.FindStringSubmatch(line)
+			if match == nil {
+				continue
+			}
+			point := trainingLoss{Step: len(losses) + 1}
+			lossText := match[len(match)-1]
+			if len(match) == 3 {
+				point.Step, _ = strconv.Atoi(match[1])
+			}
+			loss, err := strconv.ParseFloat(lossText, 64)
+			if err != nil {
+				continue
+			}
+			point.Loss = loss
+			losses = append(losses, point)
+			break
+		}
+	}
+	return losses
+}
+
+// writeTrainingLoss writes the loss curve as JSON and as an HTML chart into the output directory
+func writeTrainingLoss(outputDir string, losses []trainingLoss) error {
+	if len(losses) == 0 {
+		return nil
+	}
+	lossJSON, err := json.MarshalIndent(losses, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not marshal training loss: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(outputDir, trainLossFilename), lossJSON, 0644); err != nil {
+		return fmt.Errorf("could not write training loss: %w", err)
+	}
+
+	reportFile, err := os.Create(filepath.Join(outputDir, trainLossCurveFilename))
+	if err != nil {
+		return fmt.Errorf("could not create %s: %w", trainLossCurveFilename, err)
+	}
+	defer reportFile.Close()
+	return generateLossCurveHTML(reportFile, losses)
+}
+
+// writeCheckpointMetadata lists the files the training run wrote into the checkpoint directory
+func writeCheckpointMetadata(outputDir, checkpointDir string, since time.Time) error {
+	var checkpoints []checkpointFile
+	err := filepath.WalkDir(checkpointDir, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if info.ModTime().Before(since) {
+			return nil
+		}
+		rel, err := filepath.Rel(checkpointDir, file)
+		if err != nil {
+			return err
+		}
+		checkpoints = append(checkpoints, checkpointFile{Path: rel, Size: info.Size(), Modified: info.ModTime().UTC()})
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("could not list checkpoints in %s: %w", checkpointDir, err)
+	}
+	if len(checkpoints) == 0 {
+		return nil
+	}
+
+	checkpointsJSON, err := json.MarshalIndent(checkpoints, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not marshal checkpoint metadata: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(outputDir, trainCheckpointsFilename), checkpointsJSON, 0644); err != nil {
+		return fmt.Errorf("could not write checkpoint metadata: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestParseTrainingLoss verify the loss lines of both training backends are picked up.
+func TestParseTrainingLoss(t *testing.T) {
+	trainLog := `Loading model
+{'loss': 1.52, 'grad_norm': 0.8, 'learning_rate': 2e-05, 'epoch': 0.5}
+{'loss': 1.1, 'grad_norm': 0.7, 'learning_rate': 1e-05, 'epoch': 1.0}
+{'train_runtime': 12.3, 'train_loss': 1.31, 'epoch': 1.0}
+`
+	assert.Equal(t, []trainingLoss{{Step: 1, Loss: 1.52}, {Step: 2, Loss: 1.1}}, parseTrainingLoss(trainLog))
+
+	mlxLog := "Iter 10: Train loss 2.345, It/sec 1.2\nIter 10: Val loss 2.5\nIter 20: Train loss 1.9, It/sec 1.1\n"
+	assert.Equal(t, []trainingLoss{{Step: 10, Loss: 2.345}, {Step: 20, Loss: 1.9}}, parseTrainingLoss(mlxLog))
+
+	assert.Empty(t, parseTrainingLoss("no loss here"))
+}
+
+// TestWriteTrainingLoss verify the loss is written as JSON and as a chart.
+func TestWriteTrainingLoss(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, writeTrainingLoss(dir, nil))
+	_, err := os.Stat(path.Join(dir, trainLossFilename))
+	assert.True(t, os.IsNotExist(err), "nothing is written without a loss")
+
+	assert.NoError(t, writeTrainingLoss(dir, []trainingLoss{{Step: 10, Loss: 2}, {Step: 20, Loss: 1}}))
+	lossJSON, err := os.ReadFile(path.Join(dir, trainLossFilename))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `[{"step": 10, "loss": 2}, {"step": 20, "loss": 1}]`, string(lossJSON))
+
+	chart, err := os.ReadFile(path.Join(dir, trainLossCurveFilename))
+	assert.NoError(t, err)
+	assert.Contains(t, string(chart), `points="50.0,50.0 750.0,270.0"`)
+}
+
+// TestWriteCheckpointMetadata verify only the files written by the training run are listed.
+func TestWriteCheckpointMetadata(t *testing.T) {
+	outputDir, checkpointDir := t.TempDir(), t.TempDir()
+	old := path.Join(checkpointDir, "old.bin")
+	assert.NoError(t, os.WriteFile(old, []byte("old"), 0644))
+	assert.NoError(t, os.Chtimes(old, time.Now().Add(-time.Hour), time.Now().Add(-time.Hour)))
+	since := time.Now().Add(-time.Minute)
+	assert.NoError(t, os.MkdirAll(path.Join(checkpointDir, "checkpoint-10"), 0755))
+	assert.NoError(t, os.WriteFile(path.Join(checkpointDir, "checkpoint-10", "model.safetensors"), []byte("weights"), 0644))
+
+	assert.NoError(t, writeCheckpointMetadata(outputDir, checkpointDir, since))
+	checkpointsJSON, err := os.ReadFile(path.Join(outputDir, trainCheckpointsFilename))
+	assert.NoError(t, err)
+	var checkpoints []checkpointFile
+	assert.NoError(t, json.Unmarshal(checkpointsJSON, &checkpoints))
+	assert.Len(t, checkpoints, 1)
+	assert.Equal(t, "checkpoint-10/model.safetensors", checkpoints[0].Path)
+	assert.Equal(t, int64(7), checkpoints[0].Size)
+
+	assert.NoError(t, writeCheckpointMetadata(t.TempDir(), path.Join(checkpointDir, "missing"), since))
+}
+
+// TestLastLines verify only the end of a long log is kept.
+func TestLastLines(t *testing.T) {
+	assert.Equal(t, "b\nc", lastLines("a\nb\nc\n", 2))
+	assert.Equal(t, "a", lastLines("a", 2))
+}
+
+// TestPRSubjectCheck verify a train job only uses the generated data of its own PR.
+func TestPRSubjectCheck(t *testing.T) {
+	pr := prSubject{RepoOwner: "instructlab", RepoName: "taxonomy", PRNumber: "42"}
+	assert.NoError(t, pr.check("7", pr))
+	assert.ErrorContains(t, prSubject{RepoOwner: "other", RepoName: "taxonomy", PRNumber: "42"}.check("7", pr), "job 7 did not generate data for instructlab/taxonomy#42")
+	assert.Error(t, prSubject{RepoOwner: "instructlab", RepoName: "taxonomy", PRNumber: "43"}.check("7", pr))
+	assert.Error(t, prSubject{}.check("7", pr))
+}
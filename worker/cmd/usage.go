@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/instructlab/instructlab-bot/pkg/jobqueue"
+)
+
+const tokenUsageFilename = "token_usage.json"
+
+// modelUsage is the token count of the requests sent to one model
+type modelUsage struct {
+	Requests         int     `json:"requests"`
+	CachedRequests   int     `json:"cached_requests"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	TotalTokens      int     `json:"total_tokens"`
+	EstimatedCost    float64 `json:"estimated_cost"`
+}
+
+func (m *modelUsage) add(usage chatUsage, cached bool) {
+	m.Requests++
+	// Cached answers cost nothing, so only count that they were served
+	if cached {
+		m.CachedRequests++
+		return
+	}
+	m.PromptTokens += usage.PromptTokens
+	m.CompletionTokens += usage.CompletionTokens
+	m.TotalTokens += usage.TotalTokens
+}
+
+// jobUsage is the token usage and cost estimate of a job
+type jobUsage struct {
+	modelUsage
+	Currency string                 `json:"currency,omitempty"`
+	ByModel  map[string]*modelUsage `json:"by_model,omitempty"`
+}
+
+func newJobUsage() *jobUsage {
+	return &jobUsage{ByModel: make(map[string]*modelUsage)}
+}
+
+// add records the usage of one chat completion against the job and the model
+func (u *jobUsage) add(model string, usage chatUsage, cached bool) {
+	if model == "" {
+		model = "default"
+	}
+	m, ok := u.ByModel[model]
+	if !ok {
+		m = &modelUsage{}
+		u.ByModel[model] = m
+	}
+	m.add(usage, cached)
+	u.modelUsage.add(usage, cached)
+}
+
+// estimateCost prices the tokens with the configured cost per 1K prompt and completion tokens
+func (u *jobUsage) estimateCost() {
+	if CostPer1KPromptTokens == 0 && CostPer1KCompletionTokens == 0 {
+		return
+	}
+	u.Currency = CostCurrency
+	price := func(m *modelUsage) {
+		m.EstimatedCost = float64(m.PromptTokens)/1000*CostPer1KPromptTokens +
+			float64(m.CompletionTokens)/1000*CostPer1KCompletionTokens
+	}
+	price(&u.modelUsage)
+	for _, m := range u.ByModel {
+		price(m)
+	}
+}
+
+// summary is a one line description of the usage for the results comment
+func (u *jobUsage) summary() string {
+	models := make([]string, 0, len(u.ByModel))
+	for model := range u.ByModel {
+		models = append(models, model)
+	}
+	sort.Strings(models)
+
+	msg := fmt.Sprintf("%d requests, %d prompt + %d completion tokens", u.Requests, u.PromptTokens, u.CompletionTokens)
+	if u.CachedRequests > 0 {
+		msg += fmt.Sprintf(" (%d answers served from cache)", u.CachedRequests)
+	}
+	if u.Currency != "" {
+		msg += fmt.Sprintf(", estimated cost %.4f %s", u.EstimatedCost, u.Currency)
+	}
+	return msg
+}
+
+// recordJobUsage writes the token usage into the output directory and on the job
+func (w *Worker) recordJobUsage(outputDir string, usage *jobUsage) error {
+	if usage.Requests == 0 {
+		return nil
+	}
+	usage.estimateCost()
+
+	usageJSON, err := json.MarshalIndent(usage, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not marshal token usage: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(outputDir, tokenUsageFilename), usageJSON, 0644); err != nil {
+		return fmt.Errorf("could not write token usage: %w", err)
+	}
+	w.logger.Infof("Token usage: %s", usage.summary())
+	if w.queue == nil {
+		return nil
+	}
+
+	if err := w.setJobField(jobqueue.FieldTokenUsage, usageJSON); err != nil {
+		return fmt.Errorf("could not set token usage for job %s: %w", w.job, err)
+	}
+	return nil
+}
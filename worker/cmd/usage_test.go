@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestJobUsage verify usage is aggregated per model and cached answers are not billed.
+func TestJobUsage(t *testing.T) {
+	savedPrompt, savedCompletion := CostPer1KPromptTokens, CostPer1KCompletionTokens
+	CostPer1KPromptTokens, CostPer1KCompletionTokens = 0.5, 1.5
+	defer func() { CostPer1KPromptTokens, CostPer1KCompletionTokens = savedPrompt, savedCompletion }()
+
+	usage := newJobUsage()
+	usage.add("granite", chatUsage{PromptTokens: 1000, CompletionTokens: 200, TotalTokens: 1200}, false)
+	usage.add("granite", chatUsage{PromptTokens: 1000, CompletionTokens: 200, TotalTokens: 1200}, true)
+	usage.add("", chatUsage{PromptTokens: 2000, CompletionTokens: 800, TotalTokens: 2800}, false)
+	usage.estimateCost()
+
+	assert.Equal(t, 3, usage.Requests)
+	assert.Equal(t, 1, usage.CachedRequests)
+	assert.Equal(t, 3000, usage.PromptTokens)
+	assert.Equal(t, 1000, usage.CompletionTokens)
+	assert.InDelta(t, 3.0, usage.EstimatedCost, 1e-9)
+	assert.InDelta(t, 0.8, usage.ByModel["granite"].EstimatedCost, 1e-9)
+	assert.Equal(t, 1, usage.ByModel["default"].Requests)
+	assert.Equal(t, "3 requests, 3000 prompt + 1000 completion tokens (1 answers served from cache), estimated cost 3.0000 USD", usage.summary())
+}
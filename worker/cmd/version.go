@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"fmt"
+	"runtime/debug"
+
+	"github.com/spf13/cobra"
+)
+
+// The version of the worker, set at build time by the Makefile with
+// -ldflags "-X github.com/instructlab/instructlab-bot/worker/cmd.Version=..."
+var (
+	Version   = "dev"
+	GitCommit = ""
+	BuildDate = ""
+)
+
+func init() {
+	rootCmd.AddCommand(versionCmd)
+}
+
+var versionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "Print the version, git commit and build date of the worker",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Fprintf(cmd.OutOrStdout(), "worker %s\n", versionString())
+	},
+}
+
+// versionString describes the build of the worker, for example
+// "v0.3.0 (commit 1a2b3c4, built 2024-06-01T12:00:00Z)". Without the ldflags, the commit and
+// date recorded by go build are used.
+func versionString() string {
+	commit, date := GitCommit, BuildDate
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && commit == "":
+				commit = setting.Value
+			case setting.Key == "vcs.time" && date == "":
+				date = setting.Value
+			}
+		}
+	}
+	if len(commit) > 7 {
+		commit = commit[:7]
+	}
+	if commit == "" {
+		return Version
+	}
+	if date == "" {
+		return fmt.Sprintf("%s (commit %s)", Version, commit)
+	}
+	return fmt.Sprintf("%s (commit %s, built %s)", Version, commit, date)
+}
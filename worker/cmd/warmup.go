@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// warmupPrompt is the cheap prompt sent to the precheck models before the questions
+	warmupPrompt = "Reply with OK."
+	// warmupProbeTimeout bounds a single warm-up request, a loading model may hold it open
+	warmupProbeTimeout = 30 * time.Second
+)
+
+// warmUpTargets waits until every precheck target answers a cheap prompt, so the first questions
+// don't fail while the models are still loading. Each target gets PrecheckWarmupTimeout, 0
+// disables the warm-up.
+func (w *Worker) warmUpTargets(client *http.Client, targets []precheckTarget) error {
+	if PrecheckWarmupTimeout <= 0 {
+		return nil
+	}
+
+	start := time.Now()
+	errs := make([]error, len(targets))
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		wg.Add(1)
+		go func(i int, target precheckTarget) {
+			defer wg.Done()
+			errs[i] = w.warmUpTarget(w.ctx, client, target)
+		}(i, target)
+	}
+	wg.Wait()
+
+	err := errors.Join(errs...)
+	w.logStep("precheck warm-up", start, err)
+	if err != nil {
+		return categorize(errorModelEndpointUnreachable, err)
+	}
+	return nil
+}
+
+// warmUpTarget warms up the endpoints of the target in parallel. The target is ready once one of
+// them is, the endpoints that are not ready are left out of the rotation.
+func (w *Worker) warmUpTarget(ctx context.Context, client *http.Client, target precheckTarget) error {
+	endpoints := target.endpoints()
+	pool := endpointPoolFor(endpoints)
+	errs := make([]error, len(endpoints))
+	var wg sync.WaitGroup
+	for i, endpoint := range endpoints {
+		wg.Add(1)
+		go func(i int, endpoint string) {
+			defer wg.Done()
+			endpointTarget := target
+			endpointTarget.Endpoint = endpoint
+			errs[i] = w.warmUpEndpoint(ctx, client, endpointTarget)
+			if errs[i] != nil {
+				pool.markDown(endpoint, time.Now())
+			}
+		}(i, endpoint)
+	}
+	wg.Wait()
+
+	var failures []string
+	for i, err := range errs {
+		if err == nil {
+			return nil
+		}
+		failures = append(failures, fmt.Sprintf("%s: %v", endpoints[i], err))
+	}
+	name := target.label()
+	if name == "" {
+		name = "model"
+	}
+	return fmt.Errorf("precheck %s is not ready: %s", name, strings.Join(failures, "; "))
+}
+
+// warmUpEndpoint sends the warm-up prompt until the endpoint answers, backing off between
+// attempts, for up to PrecheckWarmupTimeout. Client errors are not waited out.
+func (w *Worker) warmUpEndpoint(ctx context.Context, client *http.Client, target precheckTarget) error {
+	ctx, cancel := context.WithTimeout(ctx, PrecheckWarmupTimeout)
+	defer cancel()
+
+	maxTokens := 1
+	request := chatCompletionRequest{
+		Model:     target.Model,
+		Messages:  []chatMessage{{Role: "user", Content: warmupPrompt}},
+		MaxTokens: &maxTokens,
+	}
+	for attempt := 1; ; attempt++ {
+		probeCtx, cancelProbe := context.WithTimeout(ctx, warmupProbeTimeout)
+		result, err := doChatRequest(probeCtx, client, target, request)
+		cancelProbe()
+		if err == nil {
+			w.logger.Infof("Precheck endpoint %s answered the warm-up prompt in %s", target.Endpoint, result.Latency.Round(time.Millisecond))
+			return nil
+		}
+		var retryable *retryableError
+		if !errors.As(err, &retryable) {
+			return err
+		}
+
+		delay := retryBackoff(attempt)
+		if retryable.retryAfter > delay {
+			delay = retryable.retryAfter
+		}
+		w.logger.Infof("Precheck endpoint %s is not ready, retrying the warm-up in %s: %v", target.Endpoint, delay, err)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("no answer after %s: %w", PrecheckWarmupTimeout, err)
+		case <-time.After(delay):
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func warmupWorker() *Worker {
+	return NewJobProcessor(context.Background(), nil, nil, zap.NewExample().Sugar(), "job-id", "", "", "", "", "", 20)
+}
+
+// TestWarmUpTargets verify the warm-up waits for a loading model to answer a one token prompt.
+func TestWarmUpTargets(t *testing.T) {
+	savedTimeout, savedBackoff := PrecheckWarmupTimeout, PrecheckRetryBackoff
+	defer func() { PrecheckWarmupTimeout, PrecheckRetryBackoff = savedTimeout, savedBackoff }()
+	PrecheckWarmupTimeout, PrecheckRetryBackoff = 10*time.Second, time.Millisecond
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		var req chatCompletionRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		if assert.NotNil(t, req.MaxTokens) {
+			assert.Equal(t, 1, *req.MaxTokens)
+		}
+		if requests < 3 {
+			http.Error(w, "model is loading", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, `{"choices": [{"message": {"role": "assistant", "content": "OK"}, "finish_reason": "length"}]}`)
+	}))
+	defer server.Close()
+
+	w := warmupWorker()
+	assert.NoError(t, w.warmUpTargets(http.DefaultClient, []precheckTarget{{Endpoint: server.URL}}))
+	assert.Equal(t, 3, requests)
+
+	PrecheckWarmupTimeout = 0
+	assert.NoError(t, w.warmUpTargets(http.DefaultClient, []precheckTarget{{Endpoint: server.URL}}))
+	assert.Equal(t, 3, requests, "a zero timeout skips the warm-up")
+}
+
+// TestWarmUpTargetsNotReady negative test that a model still not answering fails the job as unreachable.
+func TestWarmUpTargetsNotReady(t *testing.T) {
+	savedTimeout, savedBackoff := PrecheckWarmupTimeout, PrecheckRetryBackoff
+	defer func() { PrecheckWarmupTimeout, PrecheckRetryBackoff = savedTimeout, savedBackoff }()
+	PrecheckWarmupTimeout, PrecheckRetryBackoff = 100*time.Millisecond, 10*time.Millisecond
+
+	loading := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "model is loading", http.StatusServiceUnavailable)
+	}))
+	defer loading.Close()
+	missing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "model not found", http.StatusNotFound)
+	}))
+	defer missing.Close()
+
+	w := warmupWorker()
+	err := w.warmUpTargets(http.DefaultClient, []precheckTarget{{Name: "granite", Endpoint: loading.URL}})
+	assert.ErrorContains(t, err, "precheck granite is not ready")
+	assert.ErrorContains(t, err, "no answer after 100ms")
+	assert.Equal(t, errorModelEndpointUnreachable, errorCategoryOf(err))
+
+	start := time.Now()
+	err = w.warmUpTargets(http.DefaultClient, []precheckTarget{{Endpoint: missing.URL}})
+	assert.ErrorContains(t, err, "model not found")
+	assert.Less(t, time.Since(start), 100*time.Millisecond, "client errors are not waited out")
+}
+
+// TestWarmUpTargetEndpoints verify a target is ready when one of its endpoints is, the others leave the rotation.
+func TestWarmUpTargetEndpoints(t *testing.T) {
+	savedTimeout, savedBackoff, savedCooldown := PrecheckWarmupTimeout, PrecheckRetryBackoff, PrecheckEndpointCooldown
+	defer func() {
+		PrecheckWarmupTimeout, PrecheckRetryBackoff, PrecheckEndpointCooldown = savedTimeout, savedBackoff, savedCooldown
+	}()
+	PrecheckWarmupTimeout, PrecheckRetryBackoff, PrecheckEndpointCooldown = 100*time.Millisecond, 10*time.Millisecond, time.Minute
+
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "overloaded", http.StatusBadGateway)
+	}))
+	defer down.Close()
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"choices": [{"message": {"role": "assistant", "content": "OK"}, "finish_reason": "stop"}]}`)
+	}))
+	defer up.Close()
+
+	target := newPrecheckTarget("", []string{down.URL, up.URL})
+	assert.NoError(t, warmupWorker().warmUpTargets(http.DefaultClient, []precheckTarget{target}))
+	assert.Equal(t, []string{up.URL, down.URL}, endpointPoolFor(target.Endpoints).order(time.Now()))
+}